@@ -0,0 +1,217 @@
+// Package chunkcrypt contains a streaming AES-GCM encryption format.
+//
+// A stream begins with a magic string, followed by chunks, each one made of
+// a 4-byte big-endian length, a 12-byte nonce and the ciphertext.
+// The index of each chunk and a flag that marks the last chunk are used as
+// additional data, in order to detect reordering and truncation.
+package chunkcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	magic        = "MTXCRYPT1"
+	maxChunkSize = 64 * 1024
+	nonceSize    = 12
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func additionalData(index uint64, last bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, index)
+	if last {
+		ad[8] = 1
+	}
+	return ad
+}
+
+// Writer encrypts data and writes it to an underlying writer.
+// Close must be called in order to write the last chunk.
+type Writer struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+// NewWriter allocates a Writer. Key must be 16, 24 or 32 bytes long.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write([]byte(magic))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, maxChunkSize),
+	}, nil
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	n := 0
+
+	for len(p) > 0 {
+		l := maxChunkSize - len(w.buf)
+		if l > len(p) {
+			l = len(p)
+		}
+
+		w.buf = append(w.buf, p[:l]...)
+		p = p[l:]
+		n += l
+
+		if len(w.buf) == maxChunkSize {
+			err := w.writeChunk(false)
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close writes the last chunk and closes the underlying writer, if it is an io.Closer.
+func (w *Writer) Close() error {
+	err := w.writeChunk(true)
+
+	if c, ok := w.w.(io.Closer); ok {
+		err2 := c.Close()
+		if err == nil {
+			err = err2
+		}
+	}
+
+	return err
+}
+
+func (w *Writer) writeChunk(last bool) error {
+	nonce := make([]byte, nonceSize)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	ciphertext := w.aead.Seal(nil, nonce, w.buf, additionalData(w.index, last))
+
+	header := make([]byte, 4+nonceSize)
+	binary.BigEndian.PutUint32(header, uint32(len(ciphertext)))
+	copy(header[4:], nonce)
+
+	_, err = w.w.Write(append(header, ciphertext...))
+	if err != nil {
+		return err
+	}
+
+	w.buf = w.buf[:0]
+	w.index++
+	return nil
+}
+
+// Reader decrypts data read from an underlying reader.
+type Reader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+	done  bool
+}
+
+// NewReader allocates a Reader. Key must be 16, 24 or 32 bytes long.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make([]byte, len(magic))
+	_, err = io.ReadFull(r, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(m) != magic {
+		return nil, fmt.Errorf("invalid magic")
+	}
+
+	return &Reader{
+		r:    r,
+		aead: aead,
+	}, nil
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		err := r.readChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *Reader) readChunk() error {
+	header := make([]byte, 4+nonceSize)
+	_, err := io.ReadFull(r.r, header)
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	l := binary.BigEndian.Uint32(header)
+	if l > maxChunkSize+uint32(r.aead.Overhead()) {
+		return fmt.Errorf("chunk size (%d) is too big", l)
+	}
+
+	ciphertext := make([]byte, l)
+	_, err = io.ReadFull(r.r, ciphertext)
+	if err != nil {
+		return err
+	}
+
+	nonce := header[4:]
+
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, additionalData(r.index, false))
+	if err != nil {
+		plaintext, err = r.aead.Open(nil, nonce, ciphertext, additionalData(r.index, true))
+		if err != nil {
+			return fmt.Errorf("unable to decrypt chunk %d", r.index)
+		}
+		r.done = true
+	}
+
+	r.buf = plaintext
+	r.index++
+	return nil
+}
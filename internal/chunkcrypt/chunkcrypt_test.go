@@ -0,0 +1,80 @@
+package chunkcrypt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = bytes.Repeat([]byte{0x01}, 32)
+
+func TestReadWrite(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"small", 100},
+		{"chunk", maxChunkSize},
+		{"multiple chunks", maxChunkSize*2 + 500},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			plaintext := make([]byte, ca.size)
+			for i := range plaintext {
+				plaintext[i] = byte(i)
+			}
+
+			var buf bytes.Buffer
+
+			w, err := NewWriter(&buf, testKey)
+			require.NoError(t, err)
+
+			_, err = w.Write(plaintext[:ca.size/2])
+			require.NoError(t, err)
+
+			_, err = w.Write(plaintext[ca.size/2:])
+			require.NoError(t, err)
+
+			err = w.Close()
+			require.NoError(t, err)
+
+			r, err := NewReader(&buf, testKey)
+			require.NoError(t, err)
+
+			dec, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, dec)
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, testKey)
+	require.NoError(t, err)
+
+	_, err = w.Write(make([]byte, maxChunkSize+10))
+	require.NoError(t, err)
+
+	err = w.Close()
+	require.NoError(t, err)
+
+	t.Run("wrong key", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), bytes.Repeat([]byte{0x02}, 32))
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(r)
+		require.EqualError(t, err, "unable to decrypt chunk 0")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(buf.Bytes()[:len(magic)+4+nonceSize+maxChunkSize+16]), testKey)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(r)
+		require.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+}
@@ -3,9 +3,11 @@ package conf
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"sort"
 	"strings"
@@ -14,6 +16,7 @@ import (
 	"github.com/bluenviron/gohlslib"
 	"github.com/bluenviron/gortsplib/v3"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
 
 	"github.com/bluenviron/mediamtx/internal/conf/decrypt"
 	"github.com/bluenviron/mediamtx/internal/conf/env"
@@ -91,6 +94,7 @@ func contains(list []headers.AuthMethod, item headers.AuthMethod) bool {
 type Conf struct {
 	// general
 	LogLevel                  LogLevel        `json:"logLevel"`
+	LogFormat                 LogFormat       `json:"logFormat"`
 	LogDestinations           LogDestinations `json:"logDestinations"`
 	LogFile                   string          `json:"logFile"`
 	ReadTimeout               StringDuration  `json:"readTimeout"`
@@ -98,12 +102,33 @@ type Conf struct {
 	ReadBufferCount           int             `json:"readBufferCount"`
 	UDPMaxPayloadSize         int             `json:"udpMaxPayloadSize"`
 	ExternalAuthenticationURL string          `json:"externalAuthenticationURL"`
+	AuthMaxFailures           int             `json:"authMaxFailures"`
+	AuthFailuresPeriod        StringDuration  `json:"authFailuresPeriod"`
+	AuthBanDuration           StringDuration  `json:"authBanDuration"`
 	API                       bool            `json:"api"`
 	APIAddress                string          `json:"apiAddress"`
+	APIEncryption             bool            `json:"apiEncryption"`
+	APIServerKey              string          `json:"apiServerKey"`
+	APIServerCert             string          `json:"apiServerCert"`
+	APIClientCA               string          `json:"apiClientCA"`
+	APIDebug                  bool            `json:"apiDebug"`
+	APIAdminUser              Credential      `json:"apiAdminUser"`
+	APIAdminPass              Credential      `json:"apiAdminPass"`
+	Tenants                   Tenants         `json:"tenants"`
+	DrainTimeout              StringDuration  `json:"drainTimeout"`
 	Metrics                   bool            `json:"metrics"`
 	MetricsAddress            string          `json:"metricsAddress"`
 	PPROF                     bool            `json:"pprof"`
 	PPROFAddress              string          `json:"pprofAddress"`
+	OTLPTracesEndpoint        string          `json:"otlpTracesEndpoint"`
+	Playback                  bool            `json:"playback"`
+	PlaybackAddress           string          `json:"playbackAddress"`
+	Cluster                   bool            `json:"cluster"`
+	ClusterRedisAddress       string          `json:"clusterRedisAddress"`
+	ClusterRedisPassword      string          `json:"clusterRedisPassword"`
+	ClusterNodeAddress        string          `json:"clusterNodeAddress"`
+	OriginAddress             string          `json:"originAddress"`
+	OriginAPIAddress          string          `json:"originAPIAddress"`
 	RunOnConnect              string          `json:"runOnConnect"`
 	RunOnConnectRestart       bool            `json:"runOnConnectRestart"`
 
@@ -150,19 +175,86 @@ type Conf struct {
 	HLSDirectory       string         `json:"hlsDirectory"`
 
 	// WebRTC
-	WebRTC                  bool              `json:"webrtc"`
-	WebRTCDisable           bool              `json:"webrtcDisable"` // deprecated
-	WebRTCAddress           string            `json:"webrtcAddress"`
-	WebRTCEncryption        bool              `json:"webrtcEncryption"`
-	WebRTCServerKey         string            `json:"webrtcServerKey"`
-	WebRTCServerCert        string            `json:"webrtcServerCert"`
-	WebRTCAllowOrigin       string            `json:"webrtcAllowOrigin"`
-	WebRTCTrustedProxies    IPsOrCIDRs        `json:"webrtcTrustedProxies"`
-	WebRTCICEServers        []string          `json:"webrtcICEServers"` // deprecated
-	WebRTCICEServers2       []WebRTCICEServer `json:"webrtcICEServers2"`
-	WebRTCICEHostNAT1To1IPs []string          `json:"webrtcICEHostNAT1To1IPs"`
-	WebRTCICEUDPMuxAddress  string            `json:"webrtcICEUDPMuxAddress"`
-	WebRTCICETCPMuxAddress  string            `json:"webrtcICETCPMuxAddress"`
+	WebRTC                         bool                 `json:"webrtc"`
+	WebRTCDisable                  bool                 `json:"webrtcDisable"` // deprecated
+	WebRTCAddress                  string               `json:"webrtcAddress"`
+	WebRTCEncryption               bool                 `json:"webrtcEncryption"`
+	WebRTCServerKey                string               `json:"webrtcServerKey"`
+	WebRTCServerCert               string               `json:"webrtcServerCert"`
+	WebRTCClientCA                 string               `json:"webrtcClientCA"`
+	WebRTCDTLSKey                  string               `json:"webrtcDTLSKey"`
+	WebRTCDTLSCert                 string               `json:"webrtcDTLSCert"`
+	WebRTCAllowOrigin              string               `json:"webrtcAllowOrigin"`
+	WebRTCTrustedProxies           IPsOrCIDRs           `json:"webrtcTrustedProxies"`
+	WebRTCICEServers               []string             `json:"webrtcICEServers"` // deprecated
+	WebRTCICEServers2              []WebRTCICEServer    `json:"webrtcICEServers2"`
+	WebRTCICEHostNAT1To1IPs        []string             `json:"webrtcICEHostNAT1To1IPs"`
+	WebRTCICEUDPMuxAddress         string               `json:"webrtcICEUDPMuxAddress"`
+	WebRTCICETCPMuxAddress         string               `json:"webrtcICETCPMuxAddress"`
+	WebRTCICETCPFallback           bool                 `json:"webrtcICETCPFallback"`
+	WebRTCICEUDPPortMin            int                  `json:"webrtcICEUDPPortMin"`
+	WebRTCICEUDPPortMax            int                  `json:"webrtcICEUDPPortMax"`
+	WebRTCICEHostOnly              bool                 `json:"webrtcICEHostOnly"`
+	WebRTCICEHostIPs               []string             `json:"webrtcICEHostIPs"`
+	WebRTCOpusInbandFEC            bool                 `json:"webrtcOpusInbandFEC"`
+	WebRTCOpusDTX                  bool                 `json:"webrtcOpusDTX"`
+	WebRTCOpusMaxAverageBitrate    int                  `json:"webrtcOpusMaxAverageBitrate"`
+	WebRTCNACKBufferSize           int                  `json:"webrtcNACKBufferSize"`
+	WebRTCFECOverhead              int                  `json:"webrtcFECOverhead"`
+	WebRTCSVCAdaptation            bool                 `json:"webrtcSVCAdaptation"`
+	WebRTCH264FrameDropping        bool                 `json:"webrtcH264FrameDropping"`
+	WebRTCJitterBufferDepth        int                  `json:"webrtcJitterBufferDepth"`
+	WebRTCResumeTimeout            StringDuration       `json:"webrtcResumeTimeout"`
+	WebRTCHandshakeTimeout         StringDuration       `json:"webrtcHandshakeTimeout"`
+	WebRTCTrackGatherTimeout       StringDuration       `json:"webrtcTrackGatherTimeout"`
+	WebRTCMaxSessions              int                  `json:"webrtcMaxSessions"`
+	WebRTCMaxSessionsPerIP         int                  `json:"webrtcMaxSessionsPerIP"`
+	WebRTCSessionsRetryAfter       StringDuration       `json:"webrtcSessionsRetryAfter"`
+	WebRTCReadBufferMaxCount       int                  `json:"webrtcReadBufferMaxCount"`
+	WebRTCMaxVideoBitrate          int                  `json:"webrtcMaxVideoBitrate"`
+	WebRTCLoadMaxCPU               int                  `json:"webrtcLoadMaxCPU"`
+	WebRTCLoadMaxEgress            int                  `json:"webrtcLoadMaxEgress"`
+	WebRTCBalancerInstances        []string             `json:"webrtcBalancerInstances"`
+	WebRTCBalancerHook             string               `json:"webrtcBalancerHook"`
+	WebRTCAutoCreateRooms          bool                 `json:"webrtcAutoCreateRooms"`
+	WebRTCPathTemplate             string               `json:"webrtcPathTemplate"`
+	WebRTCRecordPath               string               `json:"webrtcRecordPath"`
+	WebRTCRecordRegion             string               `json:"webrtcRecordRegion"`
+	WebRTCRecordBuckets            []WebRTCRecordBucket `json:"webrtcRecordBuckets"`
+	WebRTCRecordS3Endpoint         string               `json:"webrtcRecordS3Endpoint"`
+	WebRTCRecordS3AccessKeyID      string               `json:"webrtcRecordS3AccessKeyID"`
+	WebRTCRecordS3SecretKey        string               `json:"webrtcRecordS3SecretKey"`
+	WebRTCRecordS3PathStyle        bool                 `json:"webrtcRecordS3PathStyle"`
+	WebRTCRecordS3SkipTLSVerify    bool                 `json:"webrtcRecordS3SkipTLSVerify"`
+	WebRTCRecordS3AllowedEndpoints []string             `json:"webrtcRecordS3AllowedEndpoints"`
+	WebRTCRecordSSE                RecordSSE            `json:"webrtcRecordSSE"`
+	WebRTCRecordSSEKMSKeyID        string               `json:"webrtcRecordSSEKMSKeyID"`
+	WebRTCRecordNASPath            string               `json:"webrtcRecordNASPath"`
+	WebRTCRecordNASMinFreeSpace    StringSize           `json:"webrtcRecordNASMinFreeSpace"`
+	WebRTCRecordNASRetryTimeout    StringDuration       `json:"webrtcRecordNASRetryTimeout"`
+	WebRTCRecordEncryptionKey      string               `json:"webrtcRecordEncryptionKey"`
+	WebRTCRecordOverlayCommand     string               `json:"webrtcRecordOverlayCommand"`
+	WebRTCRecordOverlayTimeout     StringDuration       `json:"webrtcRecordOverlayTimeout"`
+	WebRTCRecordLoudnessCommand    string               `json:"webrtcRecordLoudnessCommand"`
+	WebRTCRecordLoudnessTarget     float64              `json:"webrtcRecordLoudnessTarget"`
+	WebRTCRecordTracks             WebRTCRecordTracks   `json:"webrtcRecordTracks"`
+	WebRTCRecordGCMaxAge           StringDuration       `json:"webrtcRecordGCMaxAge"`
+	WebRTCRoomDVRDuration          StringDuration       `json:"webrtcRoomDVRDuration"`
+	WebRTCRoomDVRPath              string               `json:"webrtcRoomDVRPath"`
+	WebRTCRoomMaxEgress            StringSize           `json:"webrtcRoomMaxEgress"`
+	WebRTCRoomMaxRecordSize        StringSize           `json:"webrtcRoomMaxRecordSize"`
+	WebRTCRoomChatHistory          int                  `json:"webrtcRoomChatHistory"`
+	WebRTCRoomLogSize              int                  `json:"webrtcRoomLogSize"`
+	WebRTCRoomSlate                string               `json:"webrtcRoomSlate"`
+	WebRTCRoomSlateFrameRate       int                  `json:"webrtcRoomSlateFrameRate"`
+	WebRTCRoomProfiles             WebRTCRoomProfiles   `json:"webrtcRoomProfiles"`
+	WebRTCDataChannelMaxSize       StringSize           `json:"webrtcDataChannelMaxSize"`
+	WebRTCDataChannelMaxRate       int                  `json:"webrtcDataChannelMaxRate"`
+	WebRTCDataChannelLimitAction   string               `json:"webrtcDataChannelLimitAction"`
+	WebRTCHealthThreshold          int                  `json:"webrtcHealthThreshold"`
+	WebRTCHealthHook               string               `json:"webrtcHealthHook"`
+	WebRTCCaptureS3Prefix          string               `json:"webrtcCaptureS3Prefix"`
+	WebRTCGeoIPDatabase            string               `json:"webrtcGeoIPDatabase"`
 
 	// SRT
 	SRT        bool   `json:"srt"`
@@ -235,6 +327,63 @@ func (conf *Conf) Check() error {
 		}
 	}
 
+	if conf.OTLPTracesEndpoint != "" &&
+		!strings.HasPrefix(conf.OTLPTracesEndpoint, "http://") &&
+		!strings.HasPrefix(conf.OTLPTracesEndpoint, "https://") {
+		return fmt.Errorf("'otlpTracesEndpoint' must be a HTTP URL")
+	}
+	if conf.APIClientCA != "" && !conf.APIEncryption {
+		return fmt.Errorf("'apiClientCA' requires 'apiEncryption'")
+	}
+	if conf.APIDebug && (conf.APIAdminUser == "" || conf.APIAdminPass == "") {
+		return fmt.Errorf("'apiDebug' requires 'apiAdminUser' and 'apiAdminPass'")
+	}
+	if len(conf.Tenants) != 0 && (conf.APIAdminUser == "" || conf.APIAdminPass == "") {
+		return fmt.Errorf("'tenants' requires 'apiAdminUser' and 'apiAdminPass'")
+	}
+	err := conf.Tenants.Check()
+	if err != nil {
+		return err
+	}
+	if conf.Cluster {
+		if conf.ClusterRedisAddress == "" {
+			return fmt.Errorf("'cluster' requires 'clusterRedisAddress'")
+		}
+		if !strings.HasPrefix(conf.ClusterNodeAddress, "rtsp://") &&
+			!strings.HasPrefix(conf.ClusterNodeAddress, "rtsps://") {
+			return fmt.Errorf("'clusterNodeAddress' must be a RTSP URL")
+		}
+		_, err := url.Parse(conf.ClusterNodeAddress)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid URL", conf.ClusterNodeAddress)
+		}
+	}
+	if conf.OriginAddress != "" {
+		if !strings.HasPrefix(conf.OriginAddress, "rtsp://") &&
+			!strings.HasPrefix(conf.OriginAddress, "rtsps://") {
+			return fmt.Errorf("'originAddress' must be a RTSP URL")
+		}
+		_, err := url.Parse(conf.OriginAddress)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid URL", conf.OriginAddress)
+		}
+	}
+	if conf.OriginAPIAddress != "" &&
+		!strings.HasPrefix(conf.OriginAPIAddress, "http://") &&
+		!strings.HasPrefix(conf.OriginAPIAddress, "https://") {
+		return fmt.Errorf("'originAPIAddress' must be a HTTP URL")
+	}
+	if conf.AuthMaxFailures < 0 {
+		return fmt.Errorf("'authMaxFailures' can't be negative")
+	}
+	if conf.DrainTimeout <= 0 {
+		return fmt.Errorf("'drainTimeout' must be greater than zero")
+	}
+
+	if conf.AuthMaxFailures > 0 && (conf.AuthFailuresPeriod <= 0 || conf.AuthBanDuration <= 0) {
+		return fmt.Errorf("'authFailuresPeriod' and 'authBanDuration' must be greater than zero")
+	}
+
 	// RTSP
 	if conf.RTSPDisable {
 		conf.RTSP = false
@@ -278,12 +427,197 @@ func (conf *Conf) Check() error {
 	}
 	conf.WebRTCICEServers = nil
 	for _, server := range conf.WebRTCICEServers2 {
-		if !strings.HasPrefix(server.URL, "stun:") &&
-			!strings.HasPrefix(server.URL, "turn:") &&
-			!strings.HasPrefix(server.URL, "turns:") {
-			return fmt.Errorf("invalid ICE server: '%s'", server.URL)
+		err := server.Check()
+		if err != nil {
+			return err
 		}
 	}
+	if (conf.WebRTCDTLSKey == "") != (conf.WebRTCDTLSCert == "") {
+		return fmt.Errorf("'webrtcDTLSKey' and 'webrtcDTLSCert' must be set together")
+	}
+	if conf.WebRTCICETCPFallback && conf.WebRTCICETCPMuxAddress == "" {
+		return fmt.Errorf("'webrtcICETCPFallback' requires 'webrtcICETCPMuxAddress'")
+	}
+	if (conf.WebRTCICEUDPPortMin == 0) != (conf.WebRTCICEUDPPortMax == 0) {
+		return fmt.Errorf("'webrtcICEUDPPortMin' and 'webrtcICEUDPPortMax' must be set together")
+	}
+	if conf.WebRTCICEUDPPortMin != 0 {
+		if conf.WebRTCICEUDPPortMin < 1 || conf.WebRTCICEUDPPortMax > 65535 ||
+			conf.WebRTCICEUDPPortMin > conf.WebRTCICEUDPPortMax {
+			return fmt.Errorf("'webrtcICEUDPPortMin' and 'webrtcICEUDPPortMax' must be a valid port range")
+		}
+		if conf.WebRTCICEUDPMuxAddress != "" {
+			return fmt.Errorf("'webrtcICEUDPPortMin' and 'webrtcICEUDPPortMax' can't be used together with 'webrtcICEUDPMuxAddress'")
+		}
+	}
+	for _, ip := range conf.WebRTCICEHostIPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("'%s' in 'webrtcICEHostIPs' is not a valid IP", ip)
+		}
+	}
+	if conf.WebRTCOpusMaxAverageBitrate != 0 &&
+		(conf.WebRTCOpusMaxAverageBitrate < 6000 || conf.WebRTCOpusMaxAverageBitrate > 510000) {
+		return fmt.Errorf("'webrtcOpusMaxAverageBitrate' must be between 6000 and 510000")
+	}
+	if conf.WebRTCNACKBufferSize < 0 || conf.WebRTCNACKBufferSize > 32768 ||
+		(conf.WebRTCNACKBufferSize&(conf.WebRTCNACKBufferSize-1)) != 0 {
+		return fmt.Errorf("'webrtcNACKBufferSize' must be zero or a power of two between 1 and 32768")
+	}
+	if conf.WebRTCFECOverhead < 0 || conf.WebRTCFECOverhead > 100 {
+		return fmt.Errorf("'webrtcFECOverhead' must be between 0 and 100")
+	}
+	if conf.WebRTCJitterBufferDepth < 0 || conf.WebRTCJitterBufferDepth > 512 {
+		return fmt.Errorf("'webrtcJitterBufferDepth' must be between 0 and 512")
+	}
+	if conf.WebRTCResumeTimeout < 0 {
+		return fmt.Errorf("'webrtcResumeTimeout' can't be negative")
+	}
+	if conf.WebRTCPathTemplate != "" {
+		if !strings.Contains(conf.WebRTCPathTemplate, "%participant") &&
+			!strings.Contains(conf.WebRTCPathTemplate, "%path") {
+			return fmt.Errorf("'webrtcPathTemplate' must contain %%participant or %%path")
+		}
+
+		err := IsValidPathName(WebRTCPathTemplateReplacer("x", "x", "x", "x", "x").Replace(conf.WebRTCPathTemplate))
+		if err != nil {
+			return fmt.Errorf("invalid 'webrtcPathTemplate': %v", err)
+		}
+	}
+	if conf.WebRTCHandshakeTimeout <= 0 {
+		return fmt.Errorf("'webrtcHandshakeTimeout' must be greater than zero")
+	}
+	if conf.WebRTCTrackGatherTimeout <= 0 {
+		return fmt.Errorf("'webrtcTrackGatherTimeout' must be greater than zero")
+	}
+	if conf.WebRTCMaxSessions < 0 {
+		return fmt.Errorf("'webrtcMaxSessions' can't be negative")
+	}
+	if conf.WebRTCMaxSessionsPerIP < 0 {
+		return fmt.Errorf("'webrtcMaxSessionsPerIP' can't be negative")
+	}
+	if conf.WebRTCSessionsRetryAfter < 0 {
+		return fmt.Errorf("'webrtcSessionsRetryAfter' can't be negative")
+	}
+	if conf.WebRTCReadBufferMaxCount != 0 && conf.WebRTCReadBufferMaxCount < conf.ReadBufferCount {
+		return fmt.Errorf("'webrtcReadBufferMaxCount' must be zero or greater than or equal to 'readBufferCount'")
+	}
+	if conf.WebRTCClientCA != "" && !conf.WebRTCEncryption {
+		return fmt.Errorf("'webrtcClientCA' requires 'webrtcEncryption'")
+	}
+	if conf.WebRTCMaxVideoBitrate < 0 {
+		return fmt.Errorf("'webrtcMaxVideoBitrate' can't be negative")
+	}
+	if conf.WebRTCLoadMaxCPU < 0 || conf.WebRTCLoadMaxCPU > 100 {
+		return fmt.Errorf("'webrtcLoadMaxCPU' must be between 0 and 100")
+	}
+	if conf.WebRTCLoadMaxEgress < 0 {
+		return fmt.Errorf("'webrtcLoadMaxEgress' can't be negative")
+	}
+	for _, i := range conf.WebRTCBalancerInstances {
+		if !strings.HasPrefix(i, "http://") && !strings.HasPrefix(i, "https://") {
+			return fmt.Errorf("'webrtcBalancerInstances' must contain HTTP URLs")
+		}
+	}
+	if conf.WebRTCBalancerHook != "" {
+		if len(conf.WebRTCBalancerInstances) != 0 {
+			return fmt.Errorf("'webrtcBalancerInstances' and 'webrtcBalancerHook' can't be used together")
+		}
+		if !strings.HasPrefix(conf.WebRTCBalancerHook, "http://") &&
+			!strings.HasPrefix(conf.WebRTCBalancerHook, "https://") {
+			return fmt.Errorf("'webrtcBalancerHook' must be a HTTP URL")
+		}
+	}
+	if conf.WebRTCRecordPath == "" {
+		return fmt.Errorf("'webrtcRecordPath' must not be empty")
+	}
+	for _, b := range conf.WebRTCRecordBuckets {
+		err := CheckS3BucketName(b.Bucket)
+		if err != nil {
+			return err
+		}
+	}
+	if (conf.WebRTCRecordS3AccessKeyID != "") != (conf.WebRTCRecordS3SecretKey != "") {
+		return fmt.Errorf("'webrtcRecordS3AccessKeyID' and 'webrtcRecordS3SecretKey' must be set together")
+	}
+	for _, e := range conf.WebRTCRecordS3AllowedEndpoints {
+		if !strings.HasPrefix(e, "http://") && !strings.HasPrefix(e, "https://") {
+			return fmt.Errorf("'webrtcRecordS3AllowedEndpoints' must contain HTTP URLs")
+		}
+	}
+	if conf.WebRTCRecordSSEKMSKeyID != "" && conf.WebRTCRecordSSE != RecordSSEKMS {
+		return fmt.Errorf("'webrtcRecordSSEKMSKeyID' requires 'webrtcRecordSSE' to be 'kms'")
+	}
+	if conf.WebRTCRecordNASPath != "" && conf.WebRTCRecordSSE != RecordSSENo {
+		return fmt.Errorf("'webrtcRecordSSE' can't be used together with 'webrtcRecordNASPath'")
+	}
+	if conf.WebRTCRecordNASRetryTimeout < 0 {
+		return fmt.Errorf("'webrtcRecordNASRetryTimeout' can't be negative")
+	}
+	if conf.WebRTCRecordEncryptionKey != "" {
+		key, err := hex.DecodeString(conf.WebRTCRecordEncryptionKey)
+		if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+			return fmt.Errorf("'webrtcRecordEncryptionKey' must be a hex-encoded key of 16, 24 or 32 bytes")
+		}
+	}
+	if conf.WebRTCRecordOverlayCommand != "" && conf.WebRTCRecordEncryptionKey != "" {
+		return fmt.Errorf("'webrtcRecordOverlayCommand' can't be used together with 'webrtcRecordEncryptionKey'")
+	}
+	if conf.WebRTCRecordOverlayTimeout <= 0 {
+		return fmt.Errorf("'webrtcRecordOverlayTimeout' must be greater than zero")
+	}
+	if conf.WebRTCRecordLoudnessCommand != "" && conf.WebRTCRecordEncryptionKey != "" {
+		return fmt.Errorf("'webrtcRecordLoudnessCommand' can't be used together with 'webrtcRecordEncryptionKey'")
+	}
+	if conf.WebRTCRecordLoudnessTarget < -70 || conf.WebRTCRecordLoudnessTarget > 0 {
+		return fmt.Errorf("'webrtcRecordLoudnessTarget' must be between -70 and 0")
+	}
+	if conf.WebRTCRecordGCMaxAge < 0 {
+		return fmt.Errorf("'webrtcRecordGCMaxAge' can't be negative")
+	}
+	if conf.WebRTCRoomDVRDuration < 0 {
+		return fmt.Errorf("'webrtcRoomDVRDuration' must not be negative")
+	}
+	if conf.WebRTCRoomChatHistory < 0 {
+		return fmt.Errorf("'webrtcRoomChatHistory' can't be negative")
+	}
+	if conf.WebRTCRoomLogSize < 0 {
+		return fmt.Errorf("'webrtcRoomLogSize' can't be negative")
+	}
+	if conf.WebRTCRoomSlateFrameRate <= 0 || conf.WebRTCRoomSlateFrameRate > 90000 {
+		return fmt.Errorf("'webrtcRoomSlateFrameRate' must be between 1 and 90000")
+	}
+	for name, profile := range conf.WebRTCRoomProfiles {
+		if profile == nil {
+			return fmt.Errorf("room profile '%s' is empty", name)
+		}
+		err := profile.Check()
+		if err != nil {
+			return fmt.Errorf("invalid room profile '%s': %v", name, err)
+		}
+	}
+	if conf.WebRTCRoomDVRDuration > 0 && conf.WebRTCRoomDVRPath == "" {
+		return fmt.Errorf("'webrtcRoomDVRPath' must not be empty")
+	}
+	if conf.WebRTCDataChannelMaxRate < 0 {
+		return fmt.Errorf("'webrtcDataChannelMaxRate' can't be negative")
+	}
+	switch conf.WebRTCDataChannelLimitAction {
+	case "drop", "throttle", "close":
+
+	default:
+		return fmt.Errorf("invalid 'webrtcDataChannelLimitAction': '%s'", conf.WebRTCDataChannelLimitAction)
+	}
+	if conf.WebRTCHealthThreshold < 0 || conf.WebRTCHealthThreshold > 100 {
+		return fmt.Errorf("'webrtcHealthThreshold' must be between 0 and 100")
+	}
+	if conf.WebRTCHealthHook != "" &&
+		!strings.HasPrefix(conf.WebRTCHealthHook, "http://") &&
+		!strings.HasPrefix(conf.WebRTCHealthHook, "https://") {
+		return fmt.Errorf("'webrtcHealthHook' must be a HTTP URL")
+	}
+	if strings.HasPrefix(conf.WebRTCCaptureS3Prefix, "/") {
+		return fmt.Errorf("'webrtcCaptureS3Prefix' must not start with a slash")
+	}
 
 	// do not add automatically "all", since user may want to
 	// initialize all paths through API or hot reloading.
@@ -313,15 +647,24 @@ func (conf *Conf) Check() error {
 func (conf *Conf) UnmarshalJSON(b []byte) error {
 	// general
 	conf.LogLevel = LogLevel(logger.Info)
+	conf.LogFormat = LogFormat(logger.FormatText)
 	conf.LogDestinations = LogDestinations{logger.DestinationStdout}
 	conf.LogFile = "mediamtx.log"
 	conf.ReadTimeout = 10 * StringDuration(time.Second)
 	conf.WriteTimeout = 10 * StringDuration(time.Second)
 	conf.ReadBufferCount = 512
 	conf.UDPMaxPayloadSize = 1472
+	conf.AuthMaxFailures = 5
+	conf.AuthFailuresPeriod = StringDuration(1 * time.Minute)
+	conf.AuthBanDuration = StringDuration(10 * time.Minute)
+	conf.DrainTimeout = StringDuration(1 * time.Hour)
 	conf.APIAddress = "127.0.0.1:9997"
+	conf.APIServerKey = "server.key"
+	conf.APIServerCert = "server.crt"
 	conf.MetricsAddress = "127.0.0.1:9998"
 	conf.PPROFAddress = "127.0.0.1:9999"
+	conf.PlaybackAddress = ":9996"
+	conf.ClusterRedisAddress = "127.0.0.1:6379"
 
 	// RTSP
 	conf.RTSP = true
@@ -365,6 +708,29 @@ func (conf *Conf) UnmarshalJSON(b []byte) error {
 	conf.WebRTCServerCert = "server.crt"
 	conf.WebRTCAllowOrigin = "*"
 	conf.WebRTCICEServers2 = []WebRTCICEServer{{URL: "stun:stun.l.google.com:19302"}}
+	conf.WebRTCOpusInbandFEC = true
+	conf.WebRTCNACKBufferSize = 1024
+	conf.WebRTCJitterBufferDepth = 32
+	conf.WebRTCResumeTimeout = 10 * StringDuration(time.Second)
+	conf.WebRTCHandshakeTimeout = 10 * StringDuration(time.Second)
+	conf.WebRTCTrackGatherTimeout = 3 * StringDuration(time.Second)
+	conf.WebRTCSessionsRetryAfter = 5 * StringDuration(time.Second)
+	conf.WebRTCRecordPath = "streams/%club/%event/%room"
+	conf.WebRTCRecordRegion = "eu-west-3"
+	conf.WebRTCRecordOverlayTimeout = 10 * StringDuration(time.Minute)
+	conf.WebRTCRecordLoudnessTarget = -23
+	conf.WebRTCRecordTracks = WebRTCRecordTracks{"audio", "video", "metadata"}
+	conf.WebRTCRecordNASMinFreeSpace = 1024 * 1024 * 1024
+	conf.WebRTCRecordNASRetryTimeout = 5 * StringDuration(time.Minute)
+	conf.WebRTCRoomDVRPath = "./dvr/%path/%Y-%m-%d_%H-%M-%S-%f"
+	conf.WebRTCRoomChatHistory = 50
+	conf.WebRTCRoomLogSize = 1000
+	conf.WebRTCDataChannelMaxSize = 64 * 1024
+	conf.WebRTCDataChannelMaxRate = 100
+	conf.WebRTCDataChannelLimitAction = "drop"
+	conf.WebRTCHealthThreshold = 50
+	conf.WebRTCCaptureS3Prefix = "debug/captures/"
+	conf.WebRTCRoomSlateFrameRate = 30
 
 	// SRT
 	conf.SRT = true
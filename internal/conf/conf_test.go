@@ -52,6 +52,15 @@ func TestConfFromFile(t *testing.T) {
 			SourceOnDemandStartTimeout: 10 * StringDuration(time.Second),
 			SourceOnDemandCloseAfter:   10 * StringDuration(time.Second),
 			OverridePublisher:          true,
+			DuplicatePublisher:         "replace",
+			PublishPolicyAction:        "reject",
+			WebRTCLoadPolicy:           "reject",
+			TranscodeAudioAACPath:      "%path_aac",
+			RecordPath:                 "./recordings/%path/%Y-%m-%d_%H-%M-%S",
+			RecordPartDuration:         1 * StringDuration(time.Second),
+			RecordSegmentDuration:      1 * StringDuration(time.Hour),
+			DASHSegmentDuration:        2 * StringDuration(time.Second),
+			DASHSegmentCount:           7,
 			RPICameraWidth:             1920,
 			RPICameraHeight:            1080,
 			RPICameraContrast:          1,
@@ -122,6 +131,15 @@ func TestConfFromFileAndEnv(t *testing.T) {
 		SourceOnDemandStartTimeout: 10 * StringDuration(time.Second),
 		SourceOnDemandCloseAfter:   10 * StringDuration(time.Second),
 		OverridePublisher:          true,
+		DuplicatePublisher:         "replace",
+		PublishPolicyAction:        "reject",
+		WebRTCLoadPolicy:           "reject",
+		TranscodeAudioAACPath:      "%path_aac",
+		RecordPath:                 "./recordings/%path/%Y-%m-%d_%H-%M-%S",
+		RecordPartDuration:         1 * StringDuration(time.Second),
+		RecordSegmentDuration:      1 * StringDuration(time.Hour),
+		DASHSegmentDuration:        2 * StringDuration(time.Second),
+		DASHSegmentCount:           7,
 		RPICameraWidth:             1920,
 		RPICameraHeight:            1080,
 		RPICameraContrast:          1,
@@ -153,6 +171,15 @@ func TestConfFromEnvOnly(t *testing.T) {
 		SourceOnDemandStartTimeout: 10 * StringDuration(time.Second),
 		SourceOnDemandCloseAfter:   10 * StringDuration(time.Second),
 		OverridePublisher:          true,
+		DuplicatePublisher:         "replace",
+		PublishPolicyAction:        "reject",
+		WebRTCLoadPolicy:           "reject",
+		TranscodeAudioAACPath:      "%path_aac",
+		RecordPath:                 "./recordings/%path/%Y-%m-%d_%H-%M-%S",
+		RecordPartDuration:         1 * StringDuration(time.Second),
+		RecordSegmentDuration:      1 * StringDuration(time.Hour),
+		DASHSegmentDuration:        2 * StringDuration(time.Second),
+		DASHSegmentCount:           7,
 		RPICameraWidth:             1920,
 		RPICameraHeight:            1080,
 		RPICameraContrast:          1,
@@ -169,6 +196,14 @@ func TestConfFromEnvOnly(t *testing.T) {
 	}, pa)
 }
 
+func TestConfSample(t *testing.T) {
+	// the sample configuration file must be loadable as is
+	conf, hasFile, err := Load("../../mediamtx.yml")
+	require.NoError(t, err)
+	require.Equal(t, true, hasFile)
+	require.Equal(t, RecordSSENo, conf.WebRTCRecordSSE)
+}
+
 func TestConfEncryption(t *testing.T) {
 	key := "testing123testin"
 	plaintext := "paths:\n" +
@@ -216,6 +251,16 @@ func TestConfErrors(t *testing.T) {
 			`invalid: param`,
 			"json: unknown field \"invalid\"",
 		},
+		{
+			"invalid logFormat",
+			"logFormat: xml\n",
+			"invalid log format: 'xml'",
+		},
+		{
+			"invalid otlpTracesEndpoint",
+			"otlpTracesEndpoint: localhost:4318\n",
+			"'otlpTracesEndpoint' must be a HTTP URL",
+		},
 		{
 			"invalid readBufferCount",
 			"readBufferCount: 1001\n",
@@ -254,6 +299,448 @@ func TestConfErrors(t *testing.T) {
 			"webrtcICEServers: [testing]\n",
 			"invalid ICE server: 'testing'",
 		},
+		{
+			"invalid webrtcOpusMaxAverageBitrate",
+			"webrtcOpusMaxAverageBitrate: 1000\n",
+			"'webrtcOpusMaxAverageBitrate' must be between 6000 and 510000",
+		},
+		{
+			"invalid webrtcNACKBufferSize",
+			"webrtcNACKBufferSize: 1000\n",
+			"'webrtcNACKBufferSize' must be zero or a power of two between 1 and 32768",
+		},
+		{
+			"invalid webrtcFECOverhead",
+			"webrtcFECOverhead: 150\n",
+			"'webrtcFECOverhead' must be between 0 and 100",
+		},
+		{
+			"invalid webrtcJitterBufferDepth",
+			"webrtcJitterBufferDepth: -1\n",
+			"'webrtcJitterBufferDepth' must be between 0 and 512",
+		},
+		{
+			"negative webrtcResumeTimeout",
+			"webrtcResumeTimeout: -1s\n",
+			"'webrtcResumeTimeout' can't be negative",
+		},
+		{
+			"negative webrtcMaxSessions",
+			"webrtcMaxSessions: -1\n",
+			"'webrtcMaxSessions' can't be negative",
+		},
+		{
+			"negative webrtcMaxSessionsPerIP",
+			"webrtcMaxSessionsPerIP: -1\n",
+			"'webrtcMaxSessionsPerIP' can't be negative",
+		},
+		{
+			"invalid webrtcReadBufferMaxCount",
+			"webrtcReadBufferMaxCount: 10\n",
+			"'webrtcReadBufferMaxCount' must be zero or greater than or equal to 'readBufferCount'",
+		},
+		{
+			"empty webrtcRecordPath",
+			"webrtcRecordPath: \"\"\n",
+			"'webrtcRecordPath' must not be empty",
+		},
+		{
+			"invalid webrtcRecordBuckets",
+			"webrtcRecordBuckets:\n" +
+				"- clubPrefix: test\n" +
+				"  bucket: Invalid_Bucket\n",
+			"invalid S3 bucket name: 'Invalid_Bucket'",
+		},
+		{
+			"webrtcRecordS3AccessKeyID without secret",
+			"webrtcRecordS3AccessKeyID: myid\n",
+			"'webrtcRecordS3AccessKeyID' and 'webrtcRecordS3SecretKey' must be set together",
+		},
+		{
+			"invalid webrtcRecordS3AllowedEndpoints",
+			"webrtcRecordS3AllowedEndpoints: [minio:9000]\n",
+			"'webrtcRecordS3AllowedEndpoints' must contain HTTP URLs",
+		},
+		{
+			"invalid webrtcRecordEncryptionKey",
+			"webrtcRecordEncryptionKey: \"0102\"\n",
+			"'webrtcRecordEncryptionKey' must be a hex-encoded key of 16, 24 or 32 bytes",
+		},
+		{
+			"empty webrtcRoomDVRPath",
+			"webrtcRoomDVRDuration: 2m\n" +
+				"webrtcRoomDVRPath: \"\"\n",
+			"'webrtcRoomDVRPath' must not be empty",
+		},
+		{
+			"negative authMaxFailures",
+			"authMaxFailures: -1\n",
+			"'authMaxFailures' can't be negative",
+		},
+		{
+			"invalid authBanDuration",
+			"authBanDuration: 0s\n",
+			"'authFailuresPeriod' and 'authBanDuration' must be greater than zero",
+		},
+		{
+			"negative webrtcMaxVideoBitrate",
+			"webrtcMaxVideoBitrate: -1\n",
+			"'webrtcMaxVideoBitrate' can't be negative",
+		},
+		{
+			"zero webrtcHandshakeTimeout",
+			"webrtcHandshakeTimeout: 0s\n",
+			"'webrtcHandshakeTimeout' must be greater than zero",
+		},
+		{
+			"zero webrtcTrackGatherTimeout",
+			"webrtcTrackGatherTimeout: 0s\n",
+			"'webrtcTrackGatherTimeout' must be greater than zero",
+		},
+		{
+			"invalid room profile",
+			"webrtcRoomProfiles:\n" +
+				"  training:\n" +
+				"    maxParticipants: -1\n",
+			"invalid room profile 'training': 'maxParticipants' can't be negative",
+		},
+		{
+			"invalid room profile metadata format",
+			"webrtcRoomProfiles:\n" +
+				"  telemetry:\n" +
+				"    metadataFormat: xml\n",
+			"invalid room profile 'telemetry': invalid 'metadataFormat': 'xml'",
+		},
+		{
+			"invalid room profile metadata export",
+			"webrtcRoomProfiles:\n" +
+				"  telemetry:\n" +
+				"    metadataFormat: text\n" +
+				"    metadataExport: webvtt\n",
+			"invalid room profile 'telemetry': 'metadataExport' requires 'metadataFormat' to be 'json'",
+		},
+		{
+			"invalid room profile codec with e2ee",
+			"webrtcRoomProfiles:\n" +
+				"  private:\n" +
+				"    codecs: [h264, opus]\n" +
+				"    e2ee: yes\n",
+			"invalid room profile 'private': codec 'h264' can't be used with end-to-end encryption",
+		},
+		{
+			"invalid drainTimeout",
+			"drainTimeout: 0s\n",
+			"'drainTimeout' must be greater than zero",
+		},
+		{
+			"invalid webrtcRecordLoudnessTarget",
+			"webrtcRecordLoudnessTarget: 3\n",
+			"'webrtcRecordLoudnessTarget' must be between -70 and 0",
+		},
+		{
+			"invalid webrtcRecordTracks",
+			"webrtcRecordTracks: [audio, screen]\n",
+			"invalid track type: 'screen'",
+		},
+		{
+			"webrtcRecordSSE with webrtcRecordNASPath",
+			"webrtcRecordNASPath: /mnt/nas\n" +
+				"webrtcRecordSSE: s3\n",
+			"'webrtcRecordSSE' can't be used together with 'webrtcRecordNASPath'",
+		},
+		{
+			"negative webrtcRecordNASRetryTimeout",
+			"webrtcRecordNASRetryTimeout: -1s\n",
+			"'webrtcRecordNASRetryTimeout' can't be negative",
+		},
+		{
+			"negative webrtcRecordGCMaxAge",
+			"webrtcRecordGCMaxAge: -1h\n",
+			"'webrtcRecordGCMaxAge' can't be negative",
+		},
+		{
+			"duplicate webrtcRecordTracks",
+			"webrtcRecordTracks: [audio, audio]\n",
+			"track type set twice: 'audio'",
+		},
+		{
+			"invalid webrtcDataChannelLimitAction",
+			"webrtcDataChannelLimitAction: kick\n",
+			"invalid 'webrtcDataChannelLimitAction': 'kick'",
+		},
+		{
+			"negative webrtcDataChannelMaxRate",
+			"webrtcDataChannelMaxRate: -1\n",
+			"'webrtcDataChannelMaxRate' can't be negative",
+		},
+		{
+			"invalid webrtcHealthThreshold",
+			"webrtcHealthThreshold: 101\n",
+			"'webrtcHealthThreshold' must be between 0 and 100",
+		},
+		{
+			"invalid webrtcHealthHook",
+			"webrtcHealthHook: example.com\n",
+			"'webrtcHealthHook' must be a HTTP URL",
+		},
+		{
+			"invalid webrtcCaptureS3Prefix",
+			"webrtcCaptureS3Prefix: /debug\n",
+			"'webrtcCaptureS3Prefix' must not start with a slash",
+		},
+		{
+			"invalid webrtcRoomSlateFrameRate",
+			"webrtcRoomSlateFrameRate: 0\n",
+			"'webrtcRoomSlateFrameRate' must be between 1 and 90000",
+		},
+		{
+			"negative webrtcRoomChatHistory",
+			"webrtcRoomChatHistory: -1\n",
+			"'webrtcRoomChatHistory' can't be negative",
+		},
+		{
+			"webrtcPathTemplate without participant",
+			"webrtcPathTemplate: '%club/%event'\n",
+			"'webrtcPathTemplate' must contain %participant or %path",
+		},
+		{
+			"invalid webrtcPathTemplate",
+			"webrtcPathTemplate: '%club/%participant/'\n",
+			"invalid 'webrtcPathTemplate': can't end with a slash",
+		},
+		{
+			"negative webrtcRoomLogSize",
+			"webrtcRoomLogSize: -1\n",
+			"'webrtcRoomLogSize' can't be negative",
+		},
+		{
+			"apiClientCA without encryption",
+			"apiClientCA: ca.crt\n",
+			"'apiClientCA' requires 'apiEncryption'",
+		},
+		{
+			"apiDebug without credentials",
+			"apiDebug: yes\n",
+			"'apiDebug' requires 'apiAdminUser' and 'apiAdminPass'",
+		},
+		{
+			"tenants without credentials",
+			"tenants:\n" +
+				"  clubA:\n" +
+				"    apiToken: tokena\n" +
+				"    clubs: [club-a]\n" +
+				"    pathPrefix: club-a\n",
+			"'tenants' requires 'apiAdminUser' and 'apiAdminPass'",
+		},
+		{
+			"tenant without path prefix",
+			"apiAdminUser: admin\n" +
+				"apiAdminPass: admin\n" +
+				"tenants:\n" +
+				"  clubA:\n" +
+				"    apiToken: tokena\n" +
+				"    clubs: [club-a]\n",
+			"invalid tenant 'clubA': invalid 'pathPrefix': cannot be empty",
+		},
+		{
+			"tenants with the same club",
+			"apiAdminUser: admin\n" +
+				"apiAdminPass: admin\n" +
+				"tenants:\n" +
+				"  clubA:\n" +
+				"    apiToken: tokena\n" +
+				"    clubs: [club-a]\n" +
+				"    pathPrefix: club-a\n" +
+				"  clubB:\n" +
+				"    apiToken: tokenb\n" +
+				"    clubs: [club-b, club-a]\n" +
+				"    pathPrefix: club-b\n",
+			"club 'club-a' belongs to both tenants 'clubA' and 'clubB'",
+		},
+		{
+			"tenants with overlapping path prefixes",
+			"apiAdminUser: admin\n" +
+				"apiAdminPass: admin\n" +
+				"tenants:\n" +
+				"  clubA:\n" +
+				"    apiToken: tokena\n" +
+				"    clubs: [club-a]\n" +
+				"    pathPrefix: clubs\n" +
+				"  clubB:\n" +
+				"    apiToken: tokenb\n" +
+				"    clubs: [club-b]\n" +
+				"    pathPrefix: clubs/b\n",
+			"tenants 'clubA' and 'clubB' have overlapping path prefixes",
+		},
+		{
+			"cluster with invalid node address",
+			"cluster: yes\n" +
+				"clusterNodeAddress: 10.0.0.1:8554\n",
+			"'clusterNodeAddress' must be a RTSP URL",
+		},
+		{
+			"invalid origin address",
+			"originAddress: http://origin:8554\n",
+			"'originAddress' must be a RTSP URL",
+		},
+		{
+			"invalid origin API address",
+			"originAPIAddress: origin:9997\n",
+			"'originAPIAddress' must be a HTTP URL",
+		},
+		{
+			"origin source without origin address",
+			"paths:\n" +
+				"  all:\n" +
+				"    source: origin\n",
+			"source 'origin' requires 'originAddress'",
+		},
+		{
+			"path name with parent directory",
+			"paths:\n" +
+				"  x/../mypath:\n",
+			"invalid path name 'x/../mypath': can't contain '..' elements",
+		},
+		{
+			"invalid webrtcLoadMaxCPU",
+			"webrtcLoadMaxCPU: 101\n",
+			"'webrtcLoadMaxCPU' must be between 0 and 100",
+		},
+		{
+			"invalid webrtcLoadPolicy",
+			"paths:\n" +
+				"  all:\n" +
+				"    webrtcLoadPolicy: drop\n",
+			"invalid 'webrtcLoadPolicy': 'drop'",
+		},
+		{
+			"webrtcLoadPolicy redirect without URL",
+			"paths:\n" +
+				"  all:\n" +
+				"    webrtcLoadPolicy: redirect\n",
+			"'webrtcLoadPolicy' 'redirect' requires 'webrtcLoadRedirect' to be a HTTP URL",
+		},
+		{
+			"invalid webrtcBalancerInstances",
+			"webrtcBalancerInstances: [node1:8889]\n",
+			"'webrtcBalancerInstances' must contain HTTP URLs",
+		},
+		{
+			"webrtcBalancerInstances and webrtcBalancerHook",
+			"webrtcBalancerInstances: [http://node1:8889]\n" +
+				"webrtcBalancerHook: http://balancer/choose\n",
+			"'webrtcBalancerInstances' and 'webrtcBalancerHook' can't be used together",
+		},
+		{
+			"cluster source without cluster",
+			"paths:\n" +
+				"  all:\n" +
+				"    source: cluster\n",
+			"source 'cluster' requires 'cluster'",
+		},
+		{
+			"webrtcClientCA without encryption",
+			"webrtcClientCA: ca.crt\n",
+			"'webrtcClientCA' requires 'webrtcEncryption'",
+		},
+		{
+			"invalid srtReadPassphrase",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    srtReadPassphrase: short\n",
+			"SRT passphrases must be between 10 and 79 characters",
+		},
+		{
+			"invalid srtPushTargets",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    srtPushTargets: [rtmp://localhost/mystream]\n",
+			"'rtmp://localhost/mystream' is not a valid SRT URL",
+		},
+		{
+			"fallbackSource with static source",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    source: rtsp://localhost:8554/mystream\n" +
+				"    fallbackSource: slate\n",
+			"'fallbackSource' is useless when source is not 'publisher'",
+		},
+		{
+			"invalid fallbackSource",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    fallbackSource: mypath\n",
+			"'fallbackSource' must be different from the path name",
+		},
+		{
+			"publish policy with static source",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    source: rtsp://localhost:8554/mystream\n" +
+				"    publishMaxWidth: 1920\n",
+			"publish policies are useless when source is not 'publisher'",
+		},
+		{
+			"invalid publishPolicyAction",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    publishPolicyAction: drop\n",
+			"invalid 'publishPolicyAction': 'drop'",
+		},
+		{
+			"invalid duplicatePublisher",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    duplicatePublisher: kick\n",
+			"invalid 'duplicatePublisher': 'kick'",
+		},
+		{
+			"invalid transcodeAudioAACPath",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    transcodeAudioAAC: yes\n" +
+				"    transcodeAudioAACPath: '%path'\n",
+			"'transcodeAudioAACPath' must be different from the path name",
+		},
+		{
+			"webrtcRecordOverlayCommand with encryption",
+			"webrtcRecordOverlayCommand: ffmpeg\n" +
+				"webrtcRecordEncryptionKey: '00112233445566778899aabbccddeeff'\n",
+			"'webrtcRecordOverlayCommand' can't be used together with 'webrtcRecordEncryptionKey'",
+		},
+		{
+			"webrtcDTLSKey without webrtcDTLSCert",
+			"webrtcDTLSKey: dtls.key\n",
+			"'webrtcDTLSKey' and 'webrtcDTLSCert' must be set together",
+		},
+		{
+			"webrtcICETCPFallback without TCP mux",
+			"webrtcICETCPFallback: yes\n",
+			"'webrtcICETCPFallback' requires 'webrtcICETCPMuxAddress'",
+		},
+		{
+			"incomplete webrtc UDP port range",
+			"webrtcICEUDPPortMin: 10000\n",
+			"'webrtcICEUDPPortMin' and 'webrtcICEUDPPortMax' must be set together",
+		},
+		{
+			"invalid webrtc UDP port range",
+			"webrtcICEUDPPortMin: 20000\n" +
+				"webrtcICEUDPPortMax: 10000\n",
+			"'webrtcICEUDPPortMin' and 'webrtcICEUDPPortMax' must be a valid port range",
+		},
+		{
+			"invalid webrtcICEHostIPs",
+			"webrtcICEHostIPs: [192.168.1]\n",
+			"'192.168.1' in 'webrtcICEHostIPs' is not a valid IP",
+		},
+		{
+			"webrtc UDP port range with UDP mux",
+			"webrtcICEUDPPortMin: 10000\n" +
+				"webrtcICEUDPPortMax: 10100\n" +
+				"webrtcICEUDPMuxAddress: :8189\n",
+			"'webrtcICEUDPPortMin' and 'webrtcICEUDPPortMax' can't be used together with 'webrtcICEUDPMuxAddress'",
+		},
 		{
 			"non existent parameter 2",
 			"paths:\n" +
@@ -268,6 +755,58 @@ func TestConfErrors(t *testing.T) {
 				"    source: publisher\n",
 			"invalid path name '': cannot be empty",
 		},
+		{
+			"invalid webrtcReadCodecs",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    webrtcReadCodecs: [h265]\n",
+			"invalid WebRTC codec: 'h265'",
+		},
+		{
+			"duplicate webrtcReadCodecs",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    webrtcReadCodecs: [h264, opus, h264]\n",
+			"WebRTC codec set twice: 'h264'",
+		},
+		{
+			"negative path webrtcMaxVideoBitrate",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    webrtcMaxVideoBitrate: -1\n",
+			"'webrtcMaxVideoBitrate' can't be negative",
+		},
+		{
+			"negative path webrtcInactivityTimeout",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    webrtcInactivityTimeout: -1s\n",
+			"'webrtcInactivityTimeout' can't be negative",
+		},
+		{
+			"invalid recordPartDuration",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    record: yes\n" +
+				"    recordPartDuration: 2h\n",
+			"'recordPartDuration' must be less than 'recordSegmentDuration'",
+		},
+		{
+			"empty recordPath",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    record: yes\n" +
+				"    recordPath: \"\"\n",
+			"'recordPath' must not be empty",
+		},
+		{
+			"invalid dashSegmentCount",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    dash: yes\n" +
+				"    dashSegmentCount: 1\n",
+			"'dashSegmentCount' must be at least 3",
+		},
 		{
 			"double raspberry pi camera",
 			"paths:\n" +
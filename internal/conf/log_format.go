@@ -0,0 +1,55 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// LogFormat is the logFormat parameter.
+type LogFormat logger.Format
+
+// MarshalJSON implements json.Marshaler.
+func (d LogFormat) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case LogFormat(logger.FormatText):
+		out = "text"
+
+	case LogFormat(logger.FormatJSON):
+		out = "json"
+
+	default:
+		return nil, fmt.Errorf("invalid log format: %v", d)
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *LogFormat) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "text":
+		*d = LogFormat(logger.FormatText)
+
+	case "json":
+		*d = LogFormat(logger.FormatJSON)
+
+	default:
+		return fmt.Errorf("invalid log format: '%s'", in)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements envUnmarshaler.
+func (d *LogFormat) UnmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(`"` + s + `"`))
+}
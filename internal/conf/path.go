@@ -35,9 +35,27 @@ func IsValidPathName(name string) error {
 		return fmt.Errorf("can contain only alphanumeric characters, underscore, dot, tilde, minus or slash")
 	}
 
+	// path names are used to build file paths
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return fmt.Errorf("can't contain '..' elements")
+		}
+	}
+
 	return nil
 }
 
+// WebRTCPathTemplateReplacer returns a replacer that fills the variables of webrtcPathTemplate.
+func WebRTCPathTemplateReplacer(club string, event string, room string, participant string, path string) *strings.Replacer {
+	return strings.NewReplacer(
+		"%club", club,
+		"%event", event,
+		"%room", room,
+		"%participant", participant,
+		"%path", path,
+	)
+}
+
 // PathConf is a path configuration.
 type PathConf struct {
 	Regexp *regexp.Regexp `json:"-"`
@@ -61,9 +79,16 @@ type PathConf struct {
 	ReadIPs     IPsOrCIDRs `json:"readIPs"`
 
 	// publisher
-	OverridePublisher        bool   `json:"overridePublisher"`
-	DisablePublisherOverride bool   `json:"disablePublisherOverride"` // deprecated
-	Fallback                 string `json:"fallback"`
+	OverridePublisher        bool     `json:"overridePublisher"`
+	DisablePublisherOverride bool     `json:"disablePublisherOverride"` // deprecated
+	DuplicatePublisher       string   `json:"duplicatePublisher"`
+	Fallback                 string   `json:"fallback"`
+	FallbackSource           string   `json:"fallbackSource"`
+	PublishCodecs            []string `json:"publishCodecs"`
+	PublishMaxWidth          int      `json:"publishMaxWidth"`
+	PublishMaxHeight         int      `json:"publishMaxHeight"`
+	PublishMaxBitrate        int      `json:"publishMaxBitrate"`
+	PublishPolicyAction      string   `json:"publishPolicyAction"`
 
 	// rtsp
 	SourceProtocol      SourceProtocol `json:"sourceProtocol"`
@@ -74,6 +99,35 @@ type PathConf struct {
 	// redirect
 	SourceRedirect string `json:"sourceRedirect"`
 
+	// webrtc
+	WebRTCReadCodecs          WebRTCCodecs   `json:"webrtcReadCodecs"`
+	WebRTCMaxVideoBitrate     int            `json:"webrtcMaxVideoBitrate"`
+	WebRTCLoadPolicy          string         `json:"webrtcLoadPolicy"`
+	WebRTCLoadRedirect        string         `json:"webrtcLoadRedirect"`
+	WebRTCLoadMaxVideoBitrate int            `json:"webrtcLoadMaxVideoBitrate"`
+	WebRTCInactivityTimeout   StringDuration `json:"webrtcInactivityTimeout"`
+
+	// srt
+	SRTReadPassphrase    string   `json:"srtReadPassphrase"`
+	SRTPublishPassphrase string   `json:"srtPublishPassphrase"`
+	SRTPushTargets       []string `json:"srtPushTargets"`
+
+	// transcode
+	TranscodeAudioAAC     bool   `json:"transcodeAudioAAC"`
+	TranscodeAudioAACPath string `json:"transcodeAudioAACPath"`
+
+	// record
+	Record                bool           `json:"record"`
+	RecordPath            string         `json:"recordPath"`
+	RecordPartDuration    StringDuration `json:"recordPartDuration"`
+	RecordSegmentDuration StringDuration `json:"recordSegmentDuration"`
+	RecordBucket          string         `json:"recordBucket"`
+
+	// dash
+	DASH                bool           `json:"dash"`
+	DASHSegmentDuration StringDuration `json:"dashSegmentDuration"`
+	DASHSegmentCount    int            `json:"dashSegmentCount"`
+
 	// raspberry pi camera
 	RPICameraCamID             int     `json:"rpiCameraCamID"`
 	RPICameraWidth             int     `json:"rpiCameraWidth"`
@@ -239,6 +293,16 @@ func (pconf *PathConf) check(conf *Conf, name string) error {
 			return fmt.Errorf("'%s' is not a valid RTSP URL", pconf.SourceRedirect)
 		}
 
+	case pconf.Source == "cluster":
+		if !conf.Cluster {
+			return fmt.Errorf("source 'cluster' requires 'cluster'")
+		}
+
+	case pconf.Source == "origin":
+		if conf.OriginAddress == "" {
+			return fmt.Errorf("source 'origin' requires 'originAddress'")
+		}
+
 	case pconf.Source == "rpiCamera":
 		if pconf.Regexp != nil {
 			return fmt.Errorf(
@@ -267,6 +331,20 @@ func (pconf *PathConf) check(conf *Conf, name string) error {
 		pconf.OverridePublisher = true
 	}
 
+	switch pconf.DuplicatePublisher {
+	case "":
+		if pconf.OverridePublisher {
+			pconf.DuplicatePublisher = "replace"
+		} else {
+			pconf.DuplicatePublisher = "reject"
+		}
+
+	case "reject", "replace", "fork":
+
+	default:
+		return fmt.Errorf("invalid 'duplicatePublisher': '%s'", pconf.DuplicatePublisher)
+	}
+
 	if pconf.Fallback != "" {
 		if strings.HasPrefix(pconf.Fallback, "/") {
 			err := IsValidPathName(pconf.Fallback[1:])
@@ -281,6 +359,36 @@ func (pconf *PathConf) check(conf *Conf, name string) error {
 		}
 	}
 
+	if pconf.FallbackSource != "" {
+		if pconf.Source != "publisher" {
+			return fmt.Errorf("'fallbackSource' is useless when source is not 'publisher'")
+		}
+
+		err := IsValidPathName(pconf.FallbackSource)
+		if err != nil {
+			return fmt.Errorf("invalid fallback source: %s", err)
+		}
+
+		if pconf.FallbackSource == name {
+			return fmt.Errorf("'fallbackSource' must be different from the path name")
+		}
+	}
+
+	if pconf.HasPublishPolicy() && pconf.Source != "publisher" {
+		return fmt.Errorf("publish policies are useless when source is not 'publisher'")
+	}
+
+	if pconf.PublishMaxWidth < 0 || pconf.PublishMaxHeight < 0 || pconf.PublishMaxBitrate < 0 {
+		return fmt.Errorf("'publishMaxWidth', 'publishMaxHeight' and 'publishMaxBitrate' can't be negative")
+	}
+
+	switch pconf.PublishPolicyAction {
+	case "reject", "flag":
+
+	default:
+		return fmt.Errorf("invalid 'publishPolicyAction': '%s'", pconf.PublishPolicyAction)
+	}
+
 	if (pconf.PublishUser != "" && pconf.PublishPass == "") ||
 		(pconf.PublishUser == "" && pconf.PublishPass != "") {
 		return fmt.Errorf("read username and password must be both filled")
@@ -327,6 +435,81 @@ func (pconf *PathConf) check(conf *Conf, name string) error {
 		return fmt.Errorf("'runOnDemand' can be used only when source is 'publisher'")
 	}
 
+	if pconf.WebRTCMaxVideoBitrate < 0 {
+		return fmt.Errorf("'webrtcMaxVideoBitrate' can't be negative")
+	}
+
+	switch pconf.WebRTCLoadPolicy {
+	case "reject":
+
+	case "degrade":
+		if pconf.WebRTCLoadMaxVideoBitrate <= 0 {
+			return fmt.Errorf("'webrtcLoadPolicy' 'degrade' requires 'webrtcLoadMaxVideoBitrate'")
+		}
+
+	case "redirect":
+		if !strings.HasPrefix(pconf.WebRTCLoadRedirect, "http://") &&
+			!strings.HasPrefix(pconf.WebRTCLoadRedirect, "https://") {
+			return fmt.Errorf("'webrtcLoadPolicy' 'redirect' requires 'webrtcLoadRedirect' to be a HTTP URL")
+		}
+
+	default:
+		return fmt.Errorf("invalid 'webrtcLoadPolicy': '%s'", pconf.WebRTCLoadPolicy)
+	}
+
+	if pconf.WebRTCInactivityTimeout < 0 {
+		return fmt.Errorf("'webrtcInactivityTimeout' can't be negative")
+	}
+
+	for _, passphrase := range []string{pconf.SRTReadPassphrase, pconf.SRTPublishPassphrase} {
+		if passphrase != "" && (len(passphrase) < 10 || len(passphrase) > 79) {
+			return fmt.Errorf("SRT passphrases must be between 10 and 79 characters")
+		}
+	}
+
+	for _, target := range pconf.SRTPushTargets {
+		u, err := gourl.Parse(target)
+		if err != nil || u.Scheme != "srt" || u.Host == "" {
+			return fmt.Errorf("'%s' is not a valid SRT URL", target)
+		}
+	}
+
+	if pconf.TranscodeAudioAAC &&
+		(pconf.TranscodeAudioAACPath == "" || pconf.TranscodeAudioAACPath == "%path") {
+		return fmt.Errorf("'transcodeAudioAACPath' must be different from the path name")
+	}
+
+	if pconf.Record {
+		if pconf.RecordPath == "" {
+			return fmt.Errorf("'recordPath' must not be empty")
+		}
+
+		if pconf.RecordPartDuration <= 0 || pconf.RecordSegmentDuration <= 0 {
+			return fmt.Errorf("'recordPartDuration' and 'recordSegmentDuration' must be greater than zero")
+		}
+
+		if pconf.RecordPartDuration > pconf.RecordSegmentDuration {
+			return fmt.Errorf("'recordPartDuration' must be less than 'recordSegmentDuration'")
+		}
+	}
+
+	if pconf.RecordBucket != "" {
+		err := CheckS3BucketName(pconf.RecordBucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pconf.DASH {
+		if pconf.DASHSegmentDuration <= 0 {
+			return fmt.Errorf("'dashSegmentDuration' must be greater than zero")
+		}
+
+		if pconf.DASHSegmentCount < 3 {
+			return fmt.Errorf("'dashSegmentCount' must be at least 3")
+		}
+	}
+
 	return nil
 }
 
@@ -363,9 +546,19 @@ func (pconf PathConf) HasStaticSource() bool {
 		strings.HasPrefix(pconf.Source, "srt://") ||
 		strings.HasPrefix(pconf.Source, "whep://") ||
 		strings.HasPrefix(pconf.Source, "wheps://") ||
+		pconf.Source == "cluster" ||
+		pconf.Source == "origin" ||
 		pconf.Source == "rpiCamera"
 }
 
+// HasPublishPolicy checks whether the codecs, resolution or bitrate of publishers are limited.
+func (pconf PathConf) HasPublishPolicy() bool {
+	return len(pconf.PublishCodecs) != 0 ||
+		pconf.PublishMaxWidth != 0 ||
+		pconf.PublishMaxHeight != 0 ||
+		pconf.PublishMaxBitrate != 0
+}
+
 // HasOnDemandStaticSource checks whether the path has a on demand static source.
 func (pconf PathConf) HasOnDemandStaticSource() bool {
 	return pconf.HasStaticSource() && pconf.SourceOnDemand
@@ -387,6 +580,22 @@ func (pconf *PathConf) UnmarshalJSON(b []byte) error {
 
 	// publisher
 	pconf.OverridePublisher = true
+	pconf.PublishPolicyAction = "reject"
+
+	// webrtc
+	pconf.WebRTCLoadPolicy = "reject"
+
+	// transcode
+	pconf.TranscodeAudioAACPath = "%path_aac"
+
+	// record
+	pconf.RecordPath = "./recordings/%path/%Y-%m-%d_%H-%M-%S"
+	pconf.RecordPartDuration = 1 * StringDuration(time.Second)
+	pconf.RecordSegmentDuration = 1 * StringDuration(time.Hour)
+
+	// dash
+	pconf.DASHSegmentDuration = 2 * StringDuration(time.Second)
+	pconf.DASHSegmentCount = 7
 
 	// raspberry pi camera
 	pconf.RPICameraWidth = 1920
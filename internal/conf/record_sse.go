@@ -0,0 +1,66 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RecordSSE is the server-side encryption requested when uploading recordings.
+type RecordSSE int
+
+// supported server-side encryption modes.
+const (
+	RecordSSENo RecordSSE = iota
+	RecordSSES3
+	RecordSSEKMS
+)
+
+// MarshalJSON implements json.Marshaler.
+func (d RecordSSE) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case RecordSSENo:
+		out = "no"
+
+	case RecordSSES3:
+		out = "s3"
+
+	case RecordSSEKMS:
+		out = "kms"
+
+	default:
+		return nil, fmt.Errorf("invalid server-side encryption: %v", d)
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *RecordSSE) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "no", "false":
+		*d = RecordSSENo
+
+	case "s3":
+		*d = RecordSSES3
+
+	case "kms":
+		*d = RecordSSEKMS
+
+	default:
+		return fmt.Errorf("invalid server-side encryption: '%s'", in)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements envUnmarshaler.
+func (d *RecordSSE) UnmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(`"` + s + `"`))
+}
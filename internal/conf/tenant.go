@@ -0,0 +1,126 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tenant is a federation that is served by the server, with its own
+// API token, clubs, paths, recording bucket and quotas.
+type Tenant struct {
+	APIToken    Credential `json:"apiToken"`
+	Clubs       []string   `json:"clubs"`
+	PathPrefix  string     `json:"pathPrefix"`
+	Bucket      string     `json:"bucket"`
+	Region      string     `json:"region"`
+	MaxRooms    int        `json:"maxRooms"`
+	MaxSessions int        `json:"maxSessions"`
+}
+
+// Check checks the tenant.
+func (t Tenant) Check() error {
+	if t.APIToken == "" {
+		return fmt.Errorf("'apiToken' must not be empty")
+	}
+
+	if len(t.Clubs) == 0 {
+		return fmt.Errorf("'clubs' must not be empty")
+	}
+
+	err := IsValidPathName(t.PathPrefix)
+	if err != nil {
+		return fmt.Errorf("invalid 'pathPrefix': %v", err)
+	}
+
+	if t.Bucket != "" {
+		err := CheckS3BucketName(t.Bucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.MaxRooms < 0 {
+		return fmt.Errorf("'maxRooms' can't be negative")
+	}
+
+	if t.MaxSessions < 0 {
+		return fmt.Errorf("'maxSessions' can't be negative")
+	}
+
+	return nil
+}
+
+// OwnsClub checks whether rooms of a club belong to the tenant.
+func (t Tenant) OwnsClub(clubName string) bool {
+	for _, c := range t.Clubs {
+		if c == clubName {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnsPath checks whether a path belongs to the tenant, that is,
+// whether the path is the path prefix or is inside it.
+func (t Tenant) OwnsPath(name string) bool {
+	return name == t.PathPrefix || strings.HasPrefix(name, t.PathPrefix+"/")
+}
+
+// Tenants are tenants indexed by name.
+type Tenants map[string]*Tenant
+
+// Check checks the tenants and makes sure that they don't share tokens, clubs or paths.
+func (t Tenants) Check() error {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tenant := t[name]
+		if tenant == nil {
+			return fmt.Errorf("tenant '%s' is empty", name)
+		}
+
+		err := tenant.Check()
+		if err != nil {
+			return fmt.Errorf("invalid tenant '%s': %v", name, err)
+		}
+	}
+
+	for i, name := range names {
+		tenant := t[name]
+
+		for _, otherName := range names[i+1:] {
+			other := t[otherName]
+
+			if tenant.APIToken == other.APIToken {
+				return fmt.Errorf("tenants '%s' and '%s' have the same 'apiToken'", name, otherName)
+			}
+
+			for _, c := range tenant.Clubs {
+				if other.OwnsClub(c) {
+					return fmt.Errorf("club '%s' belongs to both tenants '%s' and '%s'", c, name, otherName)
+				}
+			}
+
+			if other.OwnsPath(tenant.PathPrefix) || tenant.OwnsPath(other.PathPrefix) {
+				return fmt.Errorf("tenants '%s' and '%s' have overlapping path prefixes", name, otherName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ByClub returns the name of the tenant that owns a club, or an empty string.
+func (t Tenants) ByClub(clubName string) string {
+	for name, tenant := range t {
+		if tenant.OwnsClub(clubName) {
+			return name
+		}
+	}
+	return ""
+}
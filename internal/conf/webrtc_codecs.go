@@ -0,0 +1,53 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// WebRTCCodecs is a list of WebRTC codecs, in order of preference.
+type WebRTCCodecs []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *WebRTCCodecs) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	for _, v := range in {
+		switch v {
+		case "av1", "vp9", "vp8", "h264", "opus", "g722", "g711":
+
+		default:
+			return fmt.Errorf("invalid WebRTC codec: '%s'", v)
+		}
+
+		if d.Contains(v) {
+			return fmt.Errorf("WebRTC codec set twice: '%s'", v)
+		}
+
+		*d = append(*d, v)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements envUnmarshaler.
+func (d *WebRTCCodecs) UnmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
+
+// Contains checks whether a codec is present.
+func (d WebRTCCodecs) Contains(v string) bool {
+	for _, item := range d {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,23 @@
 package conf
 
+import (
+	"fmt"
+	"strings"
+)
+
 // WebRTCICEServer is a WebRTC ICE Server.
 type WebRTCICEServer struct {
 	URL      string `json:"url"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+// Check checks the server URL.
+func (s WebRTCICEServer) Check() error {
+	if !strings.HasPrefix(s.URL, "stun:") &&
+		!strings.HasPrefix(s.URL, "turn:") &&
+		!strings.HasPrefix(s.URL, "turns:") {
+		return fmt.Errorf("invalid ICE server: '%s'", s.URL)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var s3BucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// CheckS3BucketName checks whether a S3 bucket name is valid.
+func CheckS3BucketName(name string) error {
+	if !s3BucketNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid S3 bucket name: '%s'", name)
+	}
+	return nil
+}
+
+// WebRTCRecordBucket routes recordings of rooms whose club name
+// starts with ClubPrefix to a S3 bucket.
+type WebRTCRecordBucket struct {
+	ClubPrefix string `json:"clubPrefix"`
+	Bucket     string `json:"bucket"`
+	Region     string `json:"region"`
+}
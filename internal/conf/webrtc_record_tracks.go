@@ -0,0 +1,53 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// WebRTCRecordTracks is a list of track types that are recorded.
+type WebRTCRecordTracks []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *WebRTCRecordTracks) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = WebRTCRecordTracks{}
+
+	for _, v := range in {
+		switch v {
+		case "audio", "video", "metadata":
+
+		default:
+			return fmt.Errorf("invalid track type: '%s'", v)
+		}
+
+		if d.Contains(v) {
+			return fmt.Errorf("track type set twice: '%s'", v)
+		}
+
+		*d = append(*d, v)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements envUnmarshaler.
+func (d *WebRTCRecordTracks) UnmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
+
+// Contains checks whether a track type is present.
+func (d WebRTCRecordTracks) Contains(v string) bool {
+	for _, item := range d {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
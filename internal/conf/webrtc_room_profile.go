@@ -0,0 +1,78 @@
+package conf
+
+import (
+	"fmt"
+)
+
+// WebRTCE2EECodecs are the codecs that can be forwarded when media is encrypted end-to-end,
+// since their packets can be routed without looking into frames.
+var WebRTCE2EECodecs = WebRTCCodecs{"vp8", "vp9", "opus", "g722", "g711"}
+
+// WebRTCRoomProfile contains settings that are applied to rooms
+// that are created with the profile.
+type WebRTCRoomProfile struct {
+	Codecs           WebRTCCodecs       `json:"codecs"`
+	MaxParticipants  int                `json:"maxParticipants"`
+	Bucket           string             `json:"bucket"`
+	Region           string             `json:"region"`
+	ICEServers       []WebRTCICEServer  `json:"iceServers"`
+	RecordTracks     WebRTCRecordTracks `json:"recordTracks"`
+	E2EE             bool               `json:"e2ee"`
+	MetadataFormat   string             `json:"metadataFormat"`
+	ValidateMetadata bool               `json:"validateMetadata"`
+	MetadataExport   string             `json:"metadataExport"`
+	LLHLS            bool               `json:"llhls"`
+}
+
+// Check checks the profile.
+func (p WebRTCRoomProfile) Check() error {
+	if p.MaxParticipants < 0 {
+		return fmt.Errorf("'maxParticipants' can't be negative")
+	}
+
+	if p.Bucket != "" {
+		err := CheckS3BucketName(p.Bucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch p.MetadataFormat {
+	case "", "text", "json", "csv", "protobuf", "binary":
+
+	default:
+		return fmt.Errorf("invalid 'metadataFormat': '%s'", p.MetadataFormat)
+	}
+
+	switch p.MetadataExport {
+	case "":
+
+	case "webvtt", "srt":
+		if p.MetadataFormat != "json" {
+			return fmt.Errorf("'metadataExport' requires 'metadataFormat' to be 'json'")
+		}
+
+	default:
+		return fmt.Errorf("invalid 'metadataExport': '%s'", p.MetadataExport)
+	}
+
+	if p.E2EE {
+		for _, codec := range p.Codecs {
+			if !WebRTCE2EECodecs.Contains(codec) {
+				return fmt.Errorf("codec '%s' can't be used with end-to-end encryption", codec)
+			}
+		}
+	}
+
+	for _, server := range p.ICEServers {
+		err := server.Check()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WebRTCRoomProfiles are room profiles indexed by name.
+type WebRTCRoomProfiles map[string]*WebRTCRoomProfile
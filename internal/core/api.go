@@ -3,10 +3,13 @@ package core
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +23,20 @@ import (
 
 var errAPINotFound = errors.New("not found")
 
+// errAPIDraining is returned when the server is draining and does not accept new rooms.
+var errAPIDraining = errors.New("server is draining")
+
+// errAPIBadRequest is returned when a request contains invalid parameters.
+// Its message is returned to the client.
+type errAPIBadRequest struct {
+	err error
+}
+
+// Error implements the error interface.
+func (e errAPIBadRequest) Error() string {
+	return e.err.Error()
+}
+
 func interfaceIsEmpty(i interface{}) bool {
 	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
 }
@@ -134,9 +151,120 @@ func paginate(itemsPtr interface{}, itemsPerPageStr string, pageStr string) (int
 	return paginate2(itemsPtr, itemsPerPage, page), nil
 }
 
+// filterFieldAliases contains alternative JSON names of filtered fields.
+var filterFieldAliases = map[string]string{
+	"path": "name", // paths are identified by name
+}
+
+// filterItems removes from a list the items that don't match the filters
+// provided in the query. Filters are applied to item fields by JSON name.
+func filterItems(itemsPtr interface{}, query url.Values) error {
+	ritems := reflect.ValueOf(itemsPtr).Elem()
+	rtype := ritems.Type().Elem().Elem()
+
+	fieldByJSONName := func(name string) (int, bool) {
+		for _, n := range []string{name, filterFieldAliases[name]} {
+			if n == "" {
+				continue
+			}
+
+			for i := 0; i < rtype.NumField(); i++ {
+				if strings.Split(rtype.Field(i).Tag.Get("json"), ",")[0] == n {
+					return i, true
+				}
+			}
+		}
+		return 0, false
+	}
+
+	type filter struct {
+		field int
+		match func(reflect.Value) bool
+	}
+
+	var filters []filter
+
+	for _, name := range []string{"state", "path", "roomID"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		field, ok := fieldByJSONName(name)
+		if !ok {
+			return fmt.Errorf("filter '%s' is not supported by this list", name)
+		}
+
+		filters = append(filters, filter{
+			field: field,
+			match: func(v reflect.Value) bool {
+				if v.Kind() == reflect.Ptr {
+					if v.IsNil() {
+						return false
+					}
+					v = v.Elem()
+				}
+				return fmt.Sprint(v.Interface()) == value
+			},
+		})
+	}
+
+	if value := query.Get("createdAfter"); value != "" {
+		field, ok := fieldByJSONName("created")
+		if !ok {
+			return fmt.Errorf("filter 'createdAfter' is not supported by this list")
+		}
+
+		createdAfter, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+
+		filters = append(filters, filter{
+			field: field,
+			match: func(v reflect.Value) bool {
+				return v.Interface().(time.Time).After(createdAfter)
+			},
+		})
+	}
+
+	if filters == nil {
+		return nil
+	}
+
+	n := 0
+
+	for i := 0; i < ritems.Len(); i++ {
+		item := ritems.Index(i)
+
+		matches := true
+		for _, f := range filters {
+			if !f.match(item.Elem().Field(f.field)) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			ritems.Index(n).Set(item)
+			n++
+		}
+	}
+
+	ritems.Set(ritems.Slice(0, n))
+
+	return nil
+}
+
 func abortWithError(ctx *gin.Context, err error) {
+	var badRequest errAPIBadRequest
+
 	if err == errAPINotFound {
 		ctx.AbortWithStatus(http.StatusNotFound)
+	} else if err == errAPIDraining {
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, &apiError{Error: err.Error()})
+	} else if errors.As(err, &badRequest) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, &apiError{Error: badRequest.Error()})
 	} else {
 		ctx.AbortWithStatus(http.StatusInternalServerError)
 	}
@@ -155,6 +283,8 @@ func paramName(ctx *gin.Context) (string, bool) {
 type apiPathManager interface {
 	apiPathsList() (*apiPathsList, error)
 	apiPathsGet(string) (*apiPath, error)
+	apiAuthBansList() (*apiAuthBansList, error)
+	apiAuthBansDelete(string) error
 }
 
 type apiHLSManager interface {
@@ -180,11 +310,26 @@ type apiWebRTCManager interface {
 	apiSessionsList() (*apiWebRTCSessionsList, error)
 	apiSessionsGet(uuid.UUID) (*apiWebRTCSession, error)
 	apiSessionsKick(uuid.UUID) error
-	apiRoomCreate(string,string ) (uuid.UUID, error)
+	apiSessionsMigrate(uuid.UUID, string) error
+	apiSessionsCapture(uuid.UUID, string, time.Duration) (*apiWebRTCSessionCapture, error)
+	apiRoomsList() (*apiWebRTCRoomsList, error)
+	apiRoomCreate(
+		string, string, *apiWebRTCRoomS3, []conf.WebRTCICEServer, *apiWebRTCRoomRestream, string, roomSchedule, string,
+	) (uuid.UUID, error)
 	apiRoomGet(uuid.UUID) (*apiWebRTCRoom, error)
 	apiRoomRecord(uuid.UUID) error
+	apiRoomRecordPause(uuid.UUID, bool) error
+	apiRoomProgram(uuid.UUID, string) error
+	apiRoomMix(uuid.UUID, *apiWebRTCRoomMix) error
+	apiRoomGeo(uuid.UUID, *apiWebRTCRoomGeo) error
+	apiRoomMessage(uuid.UUID, string) error
 	apiRoomCleanup(uuid.UUID) error
 	apiRoomJoin(uuid.UUID, string) error
+	apiRoomKeysCreate(uuid.UUID, string) (string, error)
+	apiRoomKeysRevoke(uuid.UUID, string) error
+	apiRoomTokensCreate(uuid.UUID, string, string, time.Duration) (string, time.Time, error)
+	apiRoomLogs(uuid.UUID, logger.Level) (*apiWebRTCRoomLogs, error)
+	apiRoomClone(uuid.UUID) (uuid.UUID, error)
 }
 
 type apiSRTServer interface {
@@ -196,6 +341,7 @@ type apiSRTServer interface {
 type apiParent interface {
 	logger.Writer
 	apiConfigSet(conf *conf.Conf)
+	apiDrain()
 }
 
 type api struct {
@@ -216,6 +362,10 @@ type api struct {
 
 func newAPI(
 	address string,
+	encryption bool,
+	serverKey string,
+	serverCert string,
+	clientCA string,
 	readTimeout conf.StringDuration,
 	conf *conf.Conf,
 	pathManager apiPathManager,
@@ -228,6 +378,16 @@ func newAPI(
 	srtServer apiSRTServer,
 	parent apiParent,
 ) (*api, error) {
+	if encryption {
+		if serverCert == "" {
+			return nil, fmt.Errorf("server cert is missing")
+		}
+	} else {
+		serverKey = ""
+		serverCert = ""
+		clientCA = ""
+	}
+
 	a := &api{
 		conf:          conf,
 		pathManager:   pathManager,
@@ -244,7 +404,7 @@ func newAPI(
 	router := gin.New()
 	router.SetTrustedProxies(nil) //nolint:errcheck
 
-	group := router.Group("/")
+	group := router.Group("/", a.mwTenantAuth)
 
 	group.GET("/v2/config/get", a.onConfigGet)
 	group.POST("/v2/config/set", a.onConfigSet)
@@ -260,6 +420,26 @@ func newAPI(
 	group.GET("/v2/paths/list", a.onPathsList)
 	group.GET("/v2/paths/get/*name", a.onPathsGet)
 
+	group.GET("/v2/authbans/list", a.onAuthBansList)
+	group.POST("/v2/authbans/delete/:ip", a.onAuthBansDelete)
+
+	group.GET("/v2/recordings/verify", a.onRecordingsVerify)
+	group.GET("/v2/recordings/garbage", a.onRecordingsGarbage)
+
+	group.POST("/v2/server/drain", a.onServerDrain)
+
+	if conf.APIDebug {
+		debugGroup := group.Group("/v2/debug", a.mwAdminAuth)
+		debugGroup.GET("/runtime", a.onDebugRuntime)
+		debugGroup.GET("/pprof/", a.onDebugPPROF)
+		debugGroup.GET("/pprof/:name", a.onDebugPPROF)
+		debugGroup.POST("/pprof/symbol", a.onDebugPPROF)
+
+		if !interfaceIsEmpty(a.webRTCManager) {
+			debugGroup.POST("/webrtcsessions/capture/:id", a.onDebugWebRTCSessionsCapture)
+		}
+	}
+
 	if !interfaceIsEmpty(a.rtspServer) {
 		group.GET("/v2/rtspconns/list", a.onRTSPConnsList)
 		group.GET("/v2/rtspconns/get/:id", a.onRTSPConnsGet)
@@ -292,11 +472,24 @@ func newAPI(
 		group.GET("/v2/webrtcsessions/list", a.onWebRTCSessionsList)
 		group.GET("/v2/webrtcsessions/get/:id", a.onWebRTCSessionsGet)
 		group.POST("/v2/webrtcsessions/kick/:id", a.onWebRTCSessionsKick)
+		group.POST("/v2/webrtcsessions/migrate/:id", a.onWebRTCSessionsMigrate)
+		group.GET("/v2/webrtcrooms/list", a.onWebRTCRoomsList)
 		group.GET("/v2/webrtcrooms/get/:id", a.onWebRTCRoomGet)
 		group.POST("/v2/webrtcrooms/create", a.onWebRTCRoomCreate)
 		group.POST("/v2/webrtcrooms/join/:id", a.onWebRTCRoomJoin)
 		group.POST("/v2/webrtcrooms/record/:id", a.onWebRTCRoomRecord)
+		group.POST("/v2/webrtcrooms/record/pause/:id", a.onWebRTCRoomRecordPause)
+		group.POST("/v2/webrtcrooms/record/resume/:id", a.onWebRTCRoomRecordResume)
+		group.POST("/v2/webrtcrooms/program/:id", a.onWebRTCRoomProgram)
+		group.POST("/v2/webrtcrooms/mix/:id", a.onWebRTCRoomMix)
+		group.POST("/v2/webrtcrooms/geo/:id", a.onWebRTCRoomGeo)
+		group.POST("/v2/webrtcrooms/message/:id", a.onWebRTCRoomMessage)
 		group.POST("/v2/webrtcrooms/cleanup/:id", a.onWebRTCRoomCleanup)
+		group.POST("/v2/webrtcrooms/keys/create/:id", a.onWebRTCRoomKeysCreate)
+		group.POST("/v2/webrtcrooms/keys/revoke/:id/:key", a.onWebRTCRoomKeysRevoke)
+		group.POST("/v2/webrtcrooms/tokens/create/:id", a.onWebRTCRoomTokensCreate)
+		group.GET("/v2/webrtcrooms/logs/:id", a.onWebRTCRoomLogs)
+		group.POST("/v2/webrtcrooms/clone/:id", a.onWebRTCRoomClone)
 	}
 
 	if !interfaceIsEmpty(a.srtServer) {
@@ -312,8 +505,9 @@ func newAPI(
 		network,
 		address,
 		time.Duration(readTimeout),
-		"",
-		"",
+		serverCert,
+		serverKey,
+		clientCA,
 		router,
 		a,
 	)
@@ -500,6 +694,16 @@ func (a *api) onPathsList(ctx *gin.Context) {
 		return
 	}
 
+	if tenant := requestTenant(ctx); tenant != nil {
+		data.Items = filterPathsByTenant(data.Items, tenant)
+	}
+
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -534,6 +738,12 @@ func (a *api) onRTSPConnsList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -568,6 +778,12 @@ func (a *api) onRTSPSessionsList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -618,6 +834,12 @@ func (a *api) onRTSPSConnsList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -652,6 +874,12 @@ func (a *api) onRTSPSSessionsList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -702,6 +930,12 @@ func (a *api) onRTMPConnsList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -752,6 +986,12 @@ func (a *api) onRTMPSConnsList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -802,6 +1042,12 @@ func (a *api) onHLSMuxersList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -836,6 +1082,16 @@ func (a *api) onWebRTCSessionsList(ctx *gin.Context) {
 		return
 	}
 
+	if tenant := requestTenant(ctx); tenant != nil {
+		data.Items = filterWebRTCSessionsByTenant(data.Items, tenant)
+	}
+
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -863,6 +1119,34 @@ func (a *api) onWebRTCSessionsGet(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, data)
 }
 
+func (a *api) onWebRTCRoomsList(ctx *gin.Context) {
+	data, err := a.webRTCManager.apiRoomsList()
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if tenant := requestTenant(ctx); tenant != nil {
+		data.Items = filterWebRTCRoomsByTenant(data.Items, tenant)
+	}
+
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
 func (a *api) onWebRTCRoomGet(ctx *gin.Context) {
 	uuid, err := uuid.Parse(ctx.Param("id"))
 	if err != nil {
@@ -872,6 +1156,9 @@ func (a *api) onWebRTCRoomGet(ctx *gin.Context) {
 
 	data, err := a.webRTCManager.apiRoomGet(uuid)
 	if err != nil {
+		if err == errAPINotFound && a.forwardToOrigin(ctx, "/v2/webrtcrooms/get/"+uuid.String()) {
+			return
+		}
 		abortWithError(ctx, err)
 		return
 	}
@@ -880,9 +1167,19 @@ func (a *api) onWebRTCRoomGet(ctx *gin.Context) {
 }
 
 type CreateRoomBody struct {
-	ClubName string `json:"clubName"`
-	EventName string `json:"eventName"`
+	ClubName       string                 `json:"clubName"`
+	EventName      string                 `json:"eventName"`
+	S3             *apiWebRTCRoomS3       `json:"s3"`
+	ICEServers     []conf.WebRTCICEServer `json:"iceServers"`
+	Restream       *apiWebRTCRoomRestream `json:"restream"`
+	Program        string                 `json:"program"`
+	StartTime      *time.Time             `json:"startTime"`
+	EndTime        *time.Time             `json:"endTime"`
+	Profile        string                 `json:"profile"`
+	PublishKeyPath string                 `json:"publishKeyPath"`
+	Geo            *apiWebRTCRoomGeo      `json:"geo"`
 }
+
 func (a *api) onWebRTCRoomCreate(ctx *gin.Context) {
 	var body CreateRoomBody
 	err := ctx.BindJSON(&body)
@@ -890,13 +1187,60 @@ func (a *api) onWebRTCRoomCreate(ctx *gin.Context) {
 		abortWithError(ctx, err)
 		return
 	}
-	roomId, err := a.webRTCManager.apiRoomCreate(body.ClubName, body.EventName)
+
+	if body.PublishKeyPath != "" {
+		err = conf.IsValidPathName(body.PublishKeyPath)
+		if err != nil {
+			abortWithError(ctx, errAPIBadRequest{fmt.Errorf("invalid publish key path: %w", err)})
+			return
+		}
+	}
+
+	if tenant := requestTenant(ctx); tenant != nil {
+		err = checkTenantRoomCreate(tenant, &body)
+		if err != nil {
+			abortWithError(ctx, errAPIBadRequest{err})
+			return
+		}
+	}
+
+	roomId, err := a.webRTCManager.apiRoomCreate(
+		body.ClubName, body.EventName, body.S3, body.ICEServers, body.Restream, body.Program,
+		newRoomSchedule(body.StartTime, body.EndTime), body.Profile)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	if body.Geo != nil {
+		err = a.webRTCManager.apiRoomGeo(roomId, body.Geo)
+		if err != nil {
+			a.webRTCManager.apiRoomCleanup(roomId) //nolint:errcheck
+			abortWithError(ctx, err)
+			return
+		}
+	}
+
+	if body.PublishKeyPath == "" {
+		ctx.JSON(http.StatusOK, roomId)
+		return
+	}
+
+	// the room is returned together with a publish key
+	key, err := a.webRTCManager.apiRoomKeysCreate(roomId, body.PublishKeyPath)
 	if err != nil {
+		a.webRTCManager.apiRoomCleanup(roomId) //nolint:errcheck
 		abortWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, roomId)
+	ctx.JSON(http.StatusOK, &apiWebRTCRoomCreated{
+		ID: roomId,
+		PublishKey: &apiWebRTCRoomPublishKey{
+			Path: body.PublishKeyPath,
+			Key:  key,
+		},
+	})
 }
 
 func (a *api) onWebRTCRoomJoin(ctx *gin.Context) {
@@ -935,6 +1279,118 @@ func (a *api) onWebRTCRoomRecord(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, nil)
 }
+func (a *api) onWebRTCRoomRecordPause(ctx *gin.Context) {
+	a.setWebRTCRoomRecordPaused(ctx, true)
+}
+
+func (a *api) onWebRTCRoomRecordResume(ctx *gin.Context) {
+	a.setWebRTCRoomRecordPaused(ctx, false)
+}
+
+func (a *api) setWebRTCRoomRecordPaused(ctx *gin.Context, pause bool) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	err = a.webRTCManager.apiRoomRecordPause(uuid, pause)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (a *api) onWebRTCRoomProgram(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCRoomProgramSwitch
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	err = a.webRTCManager.apiRoomProgram(uuid, body.Source)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (a *api) onWebRTCRoomMix(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCRoomMix
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	err = a.webRTCManager.apiRoomMix(uuid, &body)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (a *api) onWebRTCRoomGeo(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCRoomGeo
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	err = a.webRTCManager.apiRoomGeo(uuid, &body)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (a *api) onWebRTCRoomMessage(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCRoomMessage
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	err = a.webRTCManager.apiRoomMessage(uuid, body.Data)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
 func (a *api) onWebRTCRoomCleanup(ctx *gin.Context) {
 	uuid, err := uuid.Parse(ctx.Param("id"))
 	if err != nil {
@@ -950,6 +1406,117 @@ func (a *api) onWebRTCRoomCleanup(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, nil)
 }
+
+func (a *api) onWebRTCRoomKeysCreate(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCRoomPublishKey
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	key, err := a.webRTCManager.apiRoomKeysCreate(uuid, body.Path)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, &apiWebRTCRoomPublishKey{
+		Path: body.Path,
+		Key:  key,
+	})
+}
+
+func (a *api) onWebRTCRoomKeysRevoke(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	err = a.webRTCManager.apiRoomKeysRevoke(uuid, ctx.Param("key"))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (a *api) onWebRTCRoomTokensCreate(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCRoomAccessTokenReq
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	token, expiry, err := a.webRTCManager.apiRoomTokensCreate(uuid, body.Path, body.ParticipantID,
+		time.Duration(body.Duration))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, &apiWebRTCRoomAccessToken{
+		Path:          body.Path,
+		Token:         token,
+		Expiry:        expiry,
+		ParticipantID: body.ParticipantID,
+	})
+}
+
+func (a *api) onWebRTCRoomLogs(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	minLevel := conf.LogLevel(logger.Debug)
+	if q := ctx.Query("level"); q != "" {
+		err = minLevel.UnmarshalEnv(q)
+		if err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := a.webRTCManager.apiRoomLogs(uuid, logger.Level(minLevel))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *api) onWebRTCRoomClone(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	roomID, err := a.webRTCManager.apiRoomClone(uuid)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, roomID)
+}
+
 func (a *api) onWebRTCSessionsKick(ctx *gin.Context) {
 	uuid, err := uuid.Parse(ctx.Param("id"))
 	if err != nil {
@@ -966,6 +1533,149 @@ func (a *api) onWebRTCSessionsKick(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+func (a *api) onWebRTCSessionsMigrate(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCSessionMigrateReq
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	err = a.webRTCManager.apiSessionsMigrate(uuid, body.Path)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onAuthBansList(ctx *gin.Context) {
+	data, err := a.pathManager.apiAuthBansList()
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *api) onAuthBansDelete(ctx *gin.Context) {
+	err := a.pathManager.apiAuthBansDelete(ctx.Param("ip"))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// onServerDrain stops accepting new sessions and rooms, waits for ongoing rooms
+// to finish, then shuts down the server.
+func (a *api) onServerDrain(ctx *gin.Context) {
+	a.parent.apiDrain()
+
+	ctx.Status(http.StatusOK)
+}
+
+// onRecordingsVerify checks the uploaded recordings of a bucket against
+// the checksums computed while they were written.
+func (a *api) onRecordingsVerify(ctx *gin.Context) {
+	bucket := ctx.Query("bucket")
+	if bucket == "" {
+		abortWithError(ctx, errAPIBadRequest{fmt.Errorf("bucket is missing")})
+		return
+	}
+
+	a.mutex.Lock()
+	rc := newRoomRecordConf(a.conf)
+	a.mutex.Unlock()
+
+	storage, err := newRecordStorage(ctx.Request.Context(), rc)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	items, err := storage.VerifyObjects(ctx.Request.Context(), bucket, ctx.Query("prefix"))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	data := &apiRecordingVerificationsList{
+		Items: items,
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+// onRecordingsGarbage lists the stale files and empty directories that are going
+// to be removed by the garbage collector, without removing them.
+func (a *api) onRecordingsGarbage(ctx *gin.Context) {
+	a.mutex.Lock()
+	rc := newRoomRecordConf(a.conf)
+	a.mutex.Unlock()
+
+	maxAge := rc.gcMaxAge
+	if v := ctx.Query("maxAge"); v != "" {
+		var d conf.StringDuration
+		err := d.UnmarshalEnv(v)
+		if err != nil || d < 0 {
+			abortWithError(ctx, errAPIBadRequest{fmt.Errorf("invalid maxAge: '%s'", v)})
+			return
+		}
+		maxAge = time.Duration(d)
+	}
+
+	root, err := roomStateRoot(rc.path)
+	if err != nil {
+		abortWithError(ctx, errAPIBadRequest{err})
+		return
+	}
+
+	items, err := findRecordingGarbage(root, maxAge, time.Now())
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	data := &apiRecordingGarbageList{
+		Items: items,
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
 func (a *api) onSRTConnsList(ctx *gin.Context) {
 	data, err := a.srtServer.apiConnsList()
 	if err != nil {
@@ -973,6 +1683,12 @@ func (a *api) onSRTConnsList(ctx *gin.Context) {
 		return
 	}
 
+	err = filterItems(&data.Items, ctx.Request.URL.Query())
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
 	data.ItemCount = len(data.Items)
 	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
 	if err != nil {
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"net/http"
+	httppprof "net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// mwAdminAuth allows requests that provide the admin credentials through basic authentication.
+func (a *api) mwAdminAuth(ctx *gin.Context) {
+	a.mutex.Lock()
+	c := a.conf
+	a.mutex.Unlock()
+
+	user, pass, ok := ctx.Request.BasicAuth()
+	if !ok ||
+		!checkCredential(string(c.APIAdminUser), user) ||
+		!checkCredential(string(c.APIAdminPass), pass) {
+		ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	ctx.Next()
+}
+
+func (a *api) onDebugRuntime(ctx *gin.Context) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	data := &apiDebugRuntime{
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     ms.HeapAlloc,
+		HeapInuse:     ms.HeapInuse,
+		HeapObjects:   ms.HeapObjects,
+		Sys:           ms.Sys,
+		NumGC:         ms.NumGC,
+		GCPauseTotal:  time.Duration(ms.PauseTotalNs).String(),
+		GCCPUFraction: ms.GCCPUFraction,
+	}
+
+	if ms.LastGC != 0 {
+		t := time.Unix(0, int64(ms.LastGC))
+		data.LastGC = &t
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *api) onDebugPPROF(ctx *gin.Context) {
+	switch name := ctx.Param("name"); name {
+	case "":
+		httppprof.Index(ctx.Writer, ctx.Request)
+
+	case "cmdline":
+		httppprof.Cmdline(ctx.Writer, ctx.Request)
+
+	case "profile":
+		httppprof.Profile(ctx.Writer, ctx.Request)
+
+	case "symbol":
+		httppprof.Symbol(ctx.Writer, ctx.Request)
+
+	case "trace":
+		httppprof.Trace(ctx.Writer, ctx.Request)
+
+	default:
+		httppprof.Handler(name).ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
+
+func (a *api) onDebugWebRTCSessionsCapture(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var body apiWebRTCSessionCaptureReq
+	err = ctx.BindJSON(&body)
+	if err != nil {
+		return
+	}
+
+	data, err := a.webRTCManager.apiSessionsCapture(uuid, body.Format, time.Duration(body.Duration))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
@@ -8,17 +8,24 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 )
 
+type apiError struct {
+	Error string `json:"error"`
+}
+
 type apiPath struct {
-	Name          string         `json:"name"`
-	ConfName      string         `json:"confName"`
-	Conf          *conf.PathConf `json:"conf"`
-	Source        interface{}    `json:"source"`
-	SourceReady   bool           `json:"sourceReady"` // Deprecated: renamed to Ready
-	Ready         bool           `json:"ready"`
-	ReadyTime     *time.Time     `json:"readyTime"`
-	Tracks        []string       `json:"tracks"`
-	BytesReceived uint64         `json:"bytesReceived"`
-	Readers       []interface{}  `json:"readers"`
+	Name                   string         `json:"name"`
+	ConfName               string         `json:"confName"`
+	Conf                   *conf.PathConf `json:"conf"`
+	Source                 interface{}    `json:"source"`
+	BackupSource           interface{}    `json:"backupSource"`
+	BackupActive           bool           `json:"backupActive"`
+	PublishPolicyViolation *string        `json:"publishPolicyViolation"`
+	SourceReady            bool           `json:"sourceReady"` // Deprecated: renamed to Ready
+	Ready                  bool           `json:"ready"`
+	ReadyTime              *time.Time     `json:"readyTime"`
+	Tracks                 []string       `json:"tracks"`
+	BytesReceived          uint64         `json:"bytesReceived"`
+	Readers                []interface{}  `json:"readers"`
 }
 
 type apiPathsList struct {
@@ -121,12 +128,54 @@ type apiSRTConn struct {
 	BytesSent     uint64          `json:"bytesSent"`
 }
 
+type apiAuthBan struct {
+	IP    string    `json:"ip"`
+	Until time.Time `json:"until"`
+}
+
+type apiAuthBansList struct {
+	ItemCount int           `json:"itemCount"`
+	PageCount int           `json:"pageCount"`
+	Items     []*apiAuthBan `json:"items"`
+}
+
 type apiSRTConnsList struct {
 	ItemCount int           `json:"itemCount"`
 	PageCount int           `json:"pageCount"`
 	Items     []*apiSRTConn `json:"items"`
 }
 
+type apiDebugRuntime struct {
+	Goroutines    int        `json:"goroutines"`
+	HeapAlloc     uint64     `json:"heapAlloc"`
+	HeapInuse     uint64     `json:"heapInuse"`
+	HeapObjects   uint64     `json:"heapObjects"`
+	Sys           uint64     `json:"sys"`
+	NumGC         uint32     `json:"numGC"`
+	GCPauseTotal  string     `json:"gcPauseTotal"`
+	GCCPUFraction float64    `json:"gcCPUFraction"`
+	LastGC        *time.Time `json:"lastGC"`
+}
+
+// apiWebRTCSessionMigrateReq contains the path that a publisher is moved to.
+type apiWebRTCSessionMigrateReq struct {
+	Path string `json:"path"`
+}
+
+// apiWebRTCSessionCaptureReq contains the parameters of a capture of the RTP packets of a session.
+type apiWebRTCSessionCaptureReq struct {
+	Format   string              `json:"format"`
+	Duration conf.StringDuration `json:"duration"`
+}
+
+// apiWebRTCSessionCapture contains the destination of a capture.
+type apiWebRTCSessionCapture struct {
+	Format   string `json:"format"`
+	Duration string `json:"duration"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+}
+
 type apiWebRTCSessionState string
 
 const (
@@ -134,24 +183,181 @@ const (
 	apiWebRTCSessionStatePublish apiWebRTCSessionState = "publish"
 )
 
+type apiWebRTCSessionTrack struct {
+	Type          string               `json:"type"`
+	Codec         string               `json:"codec"`
+	BytesReceived uint64               `json:"bytesReceived"`
+	BytesSent     uint64               `json:"bytesSent"`
+	NACKsReceived uint64               `json:"nacksReceived"`
+	Active        *bool                `json:"active,omitempty"`
+	SVC           *apiWebRTCSessionSVC `json:"svc,omitempty"`
+}
+
+// apiWebRTCSessionSVC contains the highest layers of a SVC stream sent to a reader.
+type apiWebRTCSessionSVC struct {
+	SpatialLayer         int    `json:"spatialLayer"`
+	TemporalLayer        int    `json:"temporalLayer"`
+	BitrateDroppedFrames uint64 `json:"bitrateDroppedFrames"`
+}
+
 type apiWebRTCSession struct {
-	ID                        uuid.UUID             `json:"id"`
-	Created                   time.Time             `json:"created"`
-	RemoteAddr                string                `json:"remoteAddr"`
-	PeerConnectionEstablished bool                  `json:"peerConnectionEstablished"`
-	LocalCandidate            string                `json:"localCandidate"`
-	RemoteCandidate           string                `json:"remoteCandidate"`
-	State                     apiWebRTCSessionState `json:"state"`
-	Path                      string                `json:"path"`
-	BytesReceived             uint64                `json:"bytesReceived"`
-	BytesSent                 uint64                `json:"bytesSent"`
+	ID                        uuid.UUID                `json:"id"`
+	Created                   time.Time                `json:"created"`
+	RemoteAddr                string                   `json:"remoteAddr"`
+	PeerConnectionEstablished bool                     `json:"peerConnectionEstablished"`
+	LocalCandidate            string                   `json:"localCandidate"`
+	RemoteCandidate           string                   `json:"remoteCandidate"`
+	State                     apiWebRTCSessionState    `json:"state"`
+	Path                      string                   `json:"path"`
+	RoomID                    *uuid.UUID               `json:"roomID"`
+	ParticipantName           string                   `json:"participantName"`
+	ParticipantID             string                   `json:"participantID"`
+	BytesReceived             uint64                   `json:"bytesReceived"`
+	BytesSent                 uint64                   `json:"bytesSent"`
+	ReadBufferDiscarded       uint64                   `json:"readBufferDiscarded"`
+	Tracks                    []*apiWebRTCSessionTrack `json:"tracks"`
+	Health                    *apiWebRTCSessionHealth  `json:"health"`
+	Viewers                   *int                     `json:"viewers"`
+	Tenant                    string                   `json:"tenant"`
+}
+
+// apiWebRTCSessionHealth contains the health of a publisher,
+// that is the one of its least healthy track.
+type apiWebRTCSessionHealth struct {
+	Score            int     `json:"score"`
+	PacketLoss       float64 `json:"packetLoss"`
+	BitrateVariation float64 `json:"bitrateVariation"`
+	Frozen           bool    `json:"frozen"`
+
+	// whether enough samples have been taken
+	Ready bool `json:"-"`
 }
 
 type apiWebRTCRoom struct {
-	ID        uuid.UUID `json:"id"`
-	Created   time.Time `json:"created"`
-	Paths     []string  `json:"paths"`
-	Recording bool      `json:"recording"`
+	ID              uuid.UUID                      `json:"id"`
+	Created         time.Time                      `json:"created"`
+	Paths           []string                       `json:"paths"`
+	Recording       bool                           `json:"recording"`
+	RecordingPaused bool                           `json:"recordingPaused"`
+	EgressBytes     uint64                         `json:"egressBytes"`
+	RecordedBytes   uint64                         `json:"recordedBytes"`
+	Restream        []*apiWebRTCRoomRestreamTarget `json:"restream"`
+	Program         *apiWebRTCRoomProgram          `json:"program"`
+	StartTime       *time.Time                     `json:"startTime"`
+	EndTime         *time.Time                     `json:"endTime"`
+	Profile         string                         `json:"profile"`
+	RehearsalOf     *uuid.UUID                     `json:"rehearsalOf"`
+	Tenant          string                         `json:"tenant"`
+	Mix             *apiWebRTCRoomMix              `json:"mix"`
+	Geo             *apiWebRTCRoomGeo              `json:"geo"`
+}
+
+// apiWebRTCRoomRestream contains the external RTMP servers to which
+// a path of a room is pushed.
+type apiWebRTCRoomRestream struct {
+	Path    string   `json:"path"`
+	Targets []string `json:"targets"`
+}
+
+// apiWebRTCRoomProgram contains the state of the program of a room.
+type apiWebRTCRoomProgram struct {
+	Path     string `json:"path"`
+	Source   string `json:"source"`
+	State    string `json:"state"`
+	Error    string `json:"error,omitempty"`
+	RTSPUser string `json:"rtspUser"`
+	RTSPPass string `json:"rtspPass"`
+}
+
+// apiWebRTCRoomProgramSwitch contains the room path to forward to the program.
+type apiWebRTCRoomProgramSwitch struct {
+	Source string `json:"source"`
+}
+
+// apiWebRTCRoomMix contains the audio mix of a room, that is sent
+// to some participants only.
+type apiWebRTCRoomMix struct {
+	Path         string   `json:"path"`
+	Sources      []string `json:"sources"`
+	Participants []string `json:"participants"`
+}
+
+// apiWebRTCRoomGeo contains the countries and the networks
+// that are allowed to publish to or read a room.
+type apiWebRTCRoomGeo struct {
+	AllowCountries []string        `json:"allowCountries"`
+	DenyCountries  []string        `json:"denyCountries"`
+	AllowCIDRs     conf.IPsOrCIDRs `json:"allowCIDRs"`
+	DenyCIDRs      conf.IPsOrCIDRs `json:"denyCIDRs"`
+}
+
+// apiWebRTCRoomMessage contains a message that is sent to the data channels of participants.
+type apiWebRTCRoomMessage struct {
+	Data string `json:"data"`
+}
+
+// apiWebRTCRoomPublishKey contains a key that allows to publish to a path of a room
+// without the credentials of the path.
+type apiWebRTCRoomPublishKey struct {
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+// apiWebRTCRoomAccessTokenReq contains the path and the validity of a one-time access token of a room.
+type apiWebRTCRoomAccessTokenReq struct {
+	Path          string              `json:"path"`
+	Duration      conf.StringDuration `json:"duration"`
+	ParticipantID string              `json:"participantID"`
+}
+
+// apiWebRTCRoomAccessToken is a one-time token that allows to read a path of a room.
+type apiWebRTCRoomAccessToken struct {
+	Path          string    `json:"path"`
+	Token         string    `json:"token"`
+	Expiry        time.Time `json:"expiry"`
+	ParticipantID string    `json:"participantID"`
+}
+
+// apiWebRTCRoomLog is a log line of a room or of one of its sessions.
+type apiWebRTCRoomLog struct {
+	Time    time.Time     `json:"time"`
+	Level   conf.LogLevel `json:"level"`
+	Session string        `json:"session,omitempty"`
+	Message string        `json:"message"`
+}
+
+type apiWebRTCRoomLogs struct {
+	Items []*apiWebRTCRoomLog `json:"items"`
+}
+
+// apiWebRTCRoomCreated is returned when a room is created together with a publish key.
+type apiWebRTCRoomCreated struct {
+	ID         uuid.UUID                `json:"id"`
+	PublishKey *apiWebRTCRoomPublishKey `json:"publishKey"`
+}
+
+type apiWebRTCRoomRestreamTarget struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// apiWebRTCRoomS3 contains S3 parameters that override the configuration
+// for a single room.
+type apiWebRTCRoomS3 struct {
+	Bucket        *string `json:"bucket"`
+	Endpoint      *string `json:"endpoint"`
+	Region        *string `json:"region"`
+	AccessKeyID   *string `json:"accessKeyID"`
+	SecretKey     *string `json:"secretKey"`
+	PathStyle     *bool   `json:"pathStyle"`
+	SkipTLSVerify *bool   `json:"skipTLSVerify"`
+}
+
+type apiWebRTCRoomsList struct {
+	ItemCount int              `json:"itemCount"`
+	PageCount int              `json:"pageCount"`
+	Items     []*apiWebRTCRoom `json:"items"`
 }
 
 type apiWebRTCSessionsList struct {
@@ -159,3 +365,45 @@ type apiWebRTCSessionsList struct {
 	PageCount int                 `json:"pageCount"`
 	Items     []*apiWebRTCSession `json:"items"`
 }
+
+type apiRecordingVerificationStatus string
+
+const (
+	apiRecordingVerificationStatusValid   apiRecordingVerificationStatus = "valid"
+	apiRecordingVerificationStatusInvalid apiRecordingVerificationStatus = "invalid"
+	apiRecordingVerificationStatusMissing apiRecordingVerificationStatus = "missing"
+)
+
+// apiRecordingVerification is the result of the verification of an uploaded recording.
+type apiRecordingVerification struct {
+	Key      string                         `json:"key"`
+	Expected string                         `json:"expected"`
+	Actual   string                         `json:"actual"`
+	Status   apiRecordingVerificationStatus `json:"status"`
+}
+
+type apiRecordingVerificationsList struct {
+	ItemCount int                         `json:"itemCount"`
+	PageCount int                         `json:"pageCount"`
+	Items     []*apiRecordingVerification `json:"items"`
+}
+
+type apiRecordingGarbageType string
+
+const (
+	apiRecordingGarbageTypeFile      apiRecordingGarbageType = "file"
+	apiRecordingGarbageTypeDirectory apiRecordingGarbageType = "directory"
+)
+
+// apiRecordingGarbage is a stale file or an empty directory left by rooms.
+type apiRecordingGarbage struct {
+	Path     string                  `json:"path"`
+	Type     apiRecordingGarbageType `json:"type"`
+	Modified time.Time               `json:"modified"`
+}
+
+type apiRecordingGarbageList struct {
+	ItemCount int                    `json:"itemCount"`
+	PageCount int                    `json:"pageCount"`
+	Items     []*apiRecordingGarbage `json:"items"`
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forwardToOrigin forwards a request to the API of the origin instance,
+// in order to expose metadata of rooms that are hosted by the origin.
+// It returns false if no origin is configured.
+func (a *api) forwardToOrigin(ctx *gin.Context, pa string) bool {
+	a.mutex.Lock()
+	originAPIAddress := a.conf.OriginAPIAddress
+	readTimeout := a.conf.ReadTimeout
+	a.mutex.Unlock()
+
+	if originAPIAddress == "" {
+		return false
+	}
+
+	hc := &http.Client{
+		Timeout: time.Duration(readTimeout),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(originAPIAddress, "/")+pa, nil)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return true
+	}
+
+	// the origin scopes the request with the same credentials
+	if h := ctx.GetHeader("Authorization"); h != "" {
+		req.Header.Set("Authorization", h)
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadGateway)
+		return true
+	}
+	defer res.Body.Close()
+
+	ctx.Status(res.StatusCode)
+	if ct := res.Header.Get("Content-Type"); ct != "" {
+		ctx.Header("Content-Type", ct)
+	}
+	io.Copy(ctx.Writer, res.Body) //nolint:errcheck
+	return true
+}
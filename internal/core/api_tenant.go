@@ -0,0 +1,179 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+const apiTenantKey = "tenant"
+
+// routes that can be used by tenants. The other ones require the admin credentials.
+var apiTenantRoutes = []string{
+	"/v2/paths/",
+	"/v2/webrtcsessions/",
+	"/v2/webrtcrooms/",
+}
+
+// apiTenant is the tenant that performed a request.
+type apiTenant struct {
+	name string
+	conf *conf.Tenant
+}
+
+func apiTenantRouteAllowed(route string) bool {
+	for _, prefix := range apiTenantRoutes {
+		if strings.HasPrefix(route, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mwTenantAuth authenticates requests when tenants are configured.
+// Requests must provide either the token of a tenant, through bearer authentication,
+// or the admin credentials, through basic authentication.
+// Requests of tenants can only access their own rooms, sessions and paths.
+func (a *api) mwTenantAuth(ctx *gin.Context) {
+	a.mutex.Lock()
+	c := a.conf
+	a.mutex.Unlock()
+
+	if len(c.Tenants) == 0 {
+		ctx.Next()
+		return
+	}
+
+	user, pass, ok := ctx.Request.BasicAuth()
+	if ok &&
+		checkCredential(string(c.APIAdminUser), user) &&
+		checkCredential(string(c.APIAdminPass), pass) {
+		ctx.Next()
+		return
+	}
+
+	tenant := apiTenantByToken(c.Tenants, ctx.GetHeader("Authorization"))
+	if tenant == nil {
+		ctx.Header("WWW-Authenticate", `Bearer realm="mediamtx"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if !apiTenantRouteAllowed(ctx.FullPath()) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if !a.tenantOwnsResource(ctx, tenant) {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.Set(apiTenantKey, tenant)
+	ctx.Next()
+}
+
+func apiTenantByToken(tenants conf.Tenants, header string) *apiTenant {
+	token, ok := bearerToken(header)
+	if !ok || token == "" {
+		return nil
+	}
+
+	for name, t := range tenants {
+		if checkCredential(string(t.APIToken), token) {
+			return &apiTenant{name: name, conf: t}
+		}
+	}
+
+	return nil
+}
+
+// requestTenant returns the tenant that performed a request,
+// or nil if the request has been performed by the admin or tenants are not configured.
+func requestTenant(ctx *gin.Context) *apiTenant {
+	v, ok := ctx.Get(apiTenantKey)
+	if !ok {
+		return nil
+	}
+	return v.(*apiTenant)
+}
+
+// tenantOwnsResource checks whether the path, session or room in the URL belongs to the tenant.
+// Rooms and sessions that are not found are left to route handlers.
+func (a *api) tenantOwnsResource(ctx *gin.Context, tenant *apiTenant) bool {
+	route := ctx.FullPath()
+
+	if strings.HasPrefix(route, "/v2/paths/") {
+		if name, ok := paramName(ctx); ok {
+			return tenant.conf.OwnsPath(name)
+		}
+		return true
+	}
+
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		return true
+	}
+
+	if strings.HasPrefix(route, "/v2/webrtcsessions/") {
+		data, err := a.webRTCManager.apiSessionsGet(id)
+		return err != nil || data.Tenant == tenant.name
+	}
+
+	data, err := a.webRTCManager.apiRoomGet(id)
+	return err != nil || data.Tenant == tenant.name
+}
+
+func filterPathsByTenant(items []*apiPath, tenant *apiTenant) []*apiPath {
+	out := []*apiPath{}
+	for _, item := range items {
+		if tenant.conf.OwnsPath(item.Name) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func filterWebRTCSessionsByTenant(items []*apiWebRTCSession, tenant *apiTenant) []*apiWebRTCSession {
+	out := []*apiWebRTCSession{}
+	for _, item := range items {
+		if item.Tenant == tenant.name {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func filterWebRTCRoomsByTenant(items []*apiWebRTCRoom, tenant *apiTenant) []*apiWebRTCRoom {
+	out := []*apiWebRTCRoom{}
+	for _, item := range items {
+		if item.Tenant == tenant.name {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// checkTenantRoomCreate checks whether a tenant can create a room.
+// S3 parameters can't be overridden, since recordings of tenants are stored
+// into the bucket of the tenant.
+func checkTenantRoomCreate(tenant *apiTenant, body *CreateRoomBody) error {
+	if !tenant.conf.OwnsClub(body.ClubName) {
+		return fmt.Errorf("club '%s' doesn't belong to tenant '%s'", body.ClubName, tenant.name)
+	}
+
+	if body.S3 != nil {
+		return fmt.Errorf("'s3' can't be set by tenants")
+	}
+
+	if body.PublishKeyPath != "" && !tenant.conf.OwnsPath(body.PublishKeyPath) {
+		return fmt.Errorf("path '%s' doesn't belong to tenant '%s'", body.PublishKeyPath, tenant.name)
+	}
+
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -106,6 +107,287 @@ func TestPagination(t *testing.T) {
 	require.Equal(t, []int{5}, items)
 }
 
+func TestFilterItems(t *testing.T) {
+	roomID := uuid.New()
+	now := time.Now()
+
+	newItems := func() []*apiWebRTCSession {
+		return []*apiWebRTCSession{
+			{
+				Created: now.Add(-2 * time.Hour),
+				State:   apiWebRTCSessionStatePublish,
+				Path:    "mypath",
+				RoomID:  &roomID,
+			},
+			{
+				Created: now.Add(-1 * time.Hour),
+				State:   apiWebRTCSessionStateRead,
+				Path:    "mypath",
+				RoomID:  &roomID,
+			},
+			{
+				Created: now,
+				State:   apiWebRTCSessionStateRead,
+				Path:    "otherpath",
+			},
+		}
+	}
+
+	for _, ca := range []struct {
+		name  string
+		query url.Values
+		count int
+	}{
+		{
+			"none",
+			url.Values{},
+			3,
+		},
+		{
+			"state",
+			url.Values{"state": []string{"read"}},
+			2,
+		},
+		{
+			"path and state",
+			url.Values{"state": []string{"read"}, "path": []string{"mypath"}},
+			1,
+		},
+		{
+			"room",
+			url.Values{"roomID": []string{roomID.String()}},
+			2,
+		},
+		{
+			"created after",
+			url.Values{"createdAfter": []string{now.Add(-90 * time.Minute).Format(time.RFC3339)}},
+			2,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			items := newItems()
+			err := filterItems(&items, ca.query)
+			require.NoError(t, err)
+			require.Equal(t, ca.count, len(items))
+		})
+	}
+
+	items := newItems()
+	err := filterItems(&items, url.Values{"createdAfter": []string{"invalid"}})
+	require.Error(t, err)
+
+	paths := []*apiPath{{Name: "mypath"}, {Name: "otherpath"}}
+	err = filterItems(&paths, url.Values{"path": []string{"mypath"}})
+	require.NoError(t, err)
+	require.Equal(t, []*apiPath{{Name: "mypath"}}, paths)
+
+	err = filterItems(&paths, url.Values{"roomID": []string{roomID.String()}})
+	require.Error(t, err)
+}
+
+func TestAPIWebRTCRoomCreateErrors(t *testing.T) {
+	p, ok := newInstance("api: yes\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	for _, ca := range []struct {
+		name string
+		body string
+		err  string
+	}{
+		{
+			"empty club name",
+			`{"clubName":"","eventName":"myevent"}`,
+			"invalid club name: name is empty",
+		},
+		{
+			"invalid event name",
+			`{"clubName":"myclub","eventName":"../myevent"}`,
+			"invalid event name: name contains an invalid character: '/'",
+		},
+		{
+			"s3 skip tls verify",
+			`{"clubName":"myclub","eventName":"myevent","s3":{"skipTLSVerify":true}}`,
+			"'skipTLSVerify' can't be set for a single room",
+		},
+		{
+			"invalid s3 bucket",
+			`{"clubName":"myclub","eventName":"myevent","s3":{"bucket":"Invalid_Bucket"}}`,
+			"invalid S3 bucket name: 'Invalid_Bucket'",
+		},
+		{
+			"s3 endpoint not allowed",
+			`{"clubName":"myclub","eventName":"myevent","s3":{"endpoint":"http://localhost:9000",` +
+				`"accessKeyID":"myid","secretKey":"mysecret"}}`,
+			"endpoint 'http://localhost:9000' is not allowed",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			res, err := hc.Post("http://localhost:9997/v2/webrtcrooms/create",
+				"application/json", bytes.NewReader([]byte(ca.body)))
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+			var out apiError
+			err = json.NewDecoder(res.Body).Decode(&out)
+			require.NoError(t, err)
+			require.Equal(t, ca.err, out.Error)
+		})
+	}
+}
+
+func TestAPITenants(t *testing.T) {
+	p, ok := newInstance("api: yes\n" +
+		"apiAdminUser: admin\n" +
+		"apiAdminPass: adminpass\n" +
+		"tenants:\n" +
+		"  clubA:\n" +
+		"    apiToken: tokena\n" +
+		"    clubs: [club-a]\n" +
+		"    pathPrefix: club-a\n" +
+		"  clubB:\n" +
+		"    apiToken: tokenb\n" +
+		"    clubs: [club-b]\n" +
+		"    pathPrefix: club-b\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	do := func(method string, ur string, body string, setAuth func(req *http.Request)) (int, string) {
+		req, err := http.NewRequest(method, "http://localhost:9997"+ur, bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		if setAuth != nil {
+			setAuth(req)
+		}
+
+		res, err := hc.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		byts, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(byts)
+	}
+
+	admin := func(req *http.Request) {
+		req.SetBasicAuth("admin", "adminpass")
+	}
+	tenantA := func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer tokena")
+	}
+
+	code, _ := do(http.MethodGet, "/v2/webrtcrooms/list", "", nil)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = do(http.MethodGet, "/v2/webrtcrooms/list", "", func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer invalid")
+	})
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = do(http.MethodGet, "/v2/config/get", "", tenantA)
+	require.Equal(t, http.StatusForbidden, code)
+
+	code, _ = do(http.MethodGet, "/v2/config/get", "", admin)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = do(http.MethodGet, "/v2/webrtcrooms/list", "", tenantA)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = do(http.MethodGet, "/v2/paths/get/club-b/cam", "", tenantA)
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body := do(http.MethodPost, "/v2/webrtcrooms/create",
+		`{"clubName":"club-b","eventName":"myevent"}`, tenantA)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, `{"error":"club 'club-b' doesn't belong to tenant 'clubA'"}`, body)
+
+	code, body = do(http.MethodPost, "/v2/webrtcrooms/create",
+		`{"clubName":"club-a","eventName":"myevent","s3":{"bucket":"mybucket"}}`, tenantA)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, `{"error":"'s3' can't be set by tenants"}`, body)
+}
+
+func TestAPIWebRTCRoomGetOrigin(t *testing.T) {
+	roomID := uuid.New()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/webrtcrooms/get/"+roomID.String(), r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"` + roomID.String() + `","recording":true}`)) //nolint:errcheck
+	}))
+	defer origin.Close()
+
+	p, ok := newInstance("api: yes\n" +
+		"originAPIAddress: " + origin.URL + "\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	var out map[string]interface{}
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v2/webrtcrooms/get/"+roomID.String(), nil, &out)
+	require.Equal(t, map[string]interface{}{
+		"id":        roomID.String(),
+		"recording": true,
+	}, out)
+}
+
+func TestAPIDebug(t *testing.T) {
+	p, ok := newInstance("api: yes\n" +
+		"apiDebug: yes\n" +
+		"apiAdminUser: admin\n" +
+		"apiAdminPass: sha256:E9JJ8stBJ7QM+nV4ZoUCeHk/gU3tPFh/5YieiJp6n2w=\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	for _, ca := range []string{"no auth", "wrong pass", "ok"} {
+		t.Run(ca, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:9997/v2/debug/runtime", nil)
+			require.NoError(t, err)
+
+			switch ca {
+			case "wrong pass":
+				req.SetBasicAuth("admin", "wrong")
+			case "ok":
+				req.SetBasicAuth("admin", "testpass")
+			}
+
+			res, err := hc.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			if ca != "ok" {
+				require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+				return
+			}
+
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			var out apiDebugRuntime
+			err = json.NewDecoder(res.Body).Decode(&out)
+			require.NoError(t, err)
+			require.NotZero(t, out.Goroutines)
+			require.NotZero(t, out.HeapAlloc)
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:9997/v2/debug/pprof/goroutine", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "testpass")
+
+	res, err := hc.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
+
 func TestAPIConfigGet(t *testing.T) {
 	p, ok := newInstance("api: yes\n")
 	require.Equal(t, true, ok)
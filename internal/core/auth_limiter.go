@@ -0,0 +1,220 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maximum number of IPs that are tracked at once, in order to bound the memory
+// used when failures come from a large number of IPs.
+const authLimiterMaxEntries = 100000
+
+type authLimiterEntry struct {
+	failures     int
+	firstFailure time.Time
+	bannedUntil  time.Time
+}
+
+// authLimiter bans IPs that fail authentication too many times.
+// Entries are protected by a mutex, since failures are reported by the servers
+// of all protocols while bans are listed and removed through the API.
+type authLimiter struct {
+	maxFailures    int
+	failuresPeriod time.Duration
+	banDuration    time.Duration
+	maxEntries     int
+
+	mutex     sync.Mutex
+	entries   map[string]*authLimiterEntry
+	lastPrune time.Time
+}
+
+func newAuthLimiter(
+	maxFailures int,
+	failuresPeriod time.Duration,
+	banDuration time.Duration,
+) *authLimiter {
+	return &authLimiter{
+		maxFailures:    maxFailures,
+		failuresPeriod: failuresPeriod,
+		banDuration:    banDuration,
+		maxEntries:     authLimiterMaxEntries,
+		entries:        make(map[string]*authLimiterEntry),
+	}
+}
+
+func (l *authLimiter) expired(e *authLimiterEntry, now time.Time) bool {
+	return !now.Before(e.bannedUntil) && now.Sub(e.firstFailure) >= l.failuresPeriod
+}
+
+// prune removes entries whose failures and bans are expired.
+func (l *authLimiter) prune(now time.Time) {
+	for ip, e := range l.entries {
+		if l.expired(e, now) {
+			delete(l.entries, ip)
+		}
+	}
+	l.lastPrune = now
+}
+
+// evict removes the entry that is less useful to keep, in order to make room
+// for a new one: the one with the oldest failures if it is not banned,
+// otherwise the one with the ban that ends first.
+func (l *authLimiter) evict(now time.Time) {
+	var evictIP string
+	var evictEntry *authLimiterEntry
+
+	for ip, e := range l.entries {
+		if evictEntry == nil {
+			evictIP, evictEntry = ip, e
+			continue
+		}
+
+		banned := now.Before(e.bannedUntil)
+		evictBanned := now.Before(evictEntry.bannedUntil)
+
+		switch {
+		case banned != evictBanned:
+			if !banned {
+				evictIP, evictEntry = ip, e
+			}
+
+		case banned:
+			if e.bannedUntil.Before(evictEntry.bannedUntil) {
+				evictIP, evictEntry = ip, e
+			}
+
+		default:
+			if e.firstFailure.Before(evictEntry.firstFailure) {
+				evictIP, evictEntry = ip, e
+			}
+		}
+	}
+
+	delete(l.entries, evictIP)
+}
+
+// banned checks whether an IP is banned.
+func (l *authLimiter) banned(ip string) bool {
+	if l.maxFailures == 0 {
+		return false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e, ok := l.entries[ip]
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+
+	if now.Before(e.bannedUntil) {
+		return true
+	}
+
+	if now.Sub(e.firstFailure) >= l.failuresPeriod {
+		delete(l.entries, ip)
+	}
+
+	return false
+}
+
+// onFailure registers an authentication failure and returns true if the IP got banned.
+func (l *authLimiter) onFailure(ip string) bool {
+	if l.maxFailures == 0 {
+		return false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+
+	// entries of IPs that stopped failing are removed once per period,
+	// since banned() and onSuccess() are not called for them anymore.
+	if now.Sub(l.lastPrune) >= l.failuresPeriod {
+		l.prune(now)
+	}
+
+	e, ok := l.entries[ip]
+	if !ok {
+		if len(l.entries) >= l.maxEntries {
+			l.prune(now)
+
+			if len(l.entries) >= l.maxEntries {
+				l.evict(now)
+			}
+		}
+
+		e = &authLimiterEntry{firstFailure: now}
+		l.entries[ip] = e
+	} else if now.Sub(e.firstFailure) >= l.failuresPeriod {
+		e.failures = 0
+		e.firstFailure = now
+	}
+
+	e.failures++
+
+	if e.failures >= l.maxFailures {
+		e.failures = 0
+		e.firstFailure = now
+		e.bannedUntil = now.Add(l.banDuration)
+		return true
+	}
+
+	return false
+}
+
+// onSuccess resets the failures of an IP.
+func (l *authLimiter) onSuccess(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, ok := l.entries[ip]; ok && !time.Now().Before(e.bannedUntil) {
+		delete(l.entries, ip)
+	}
+}
+
+// apiBansList is called by api.
+func (l *authLimiter) apiBansList() *apiAuthBansList {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	data := &apiAuthBansList{
+		Items: []*apiAuthBan{},
+	}
+
+	now := time.Now()
+
+	for ip, e := range l.entries {
+		if now.Before(e.bannedUntil) {
+			data.Items = append(data.Items, &apiAuthBan{
+				IP:    ip,
+				Until: e.bannedUntil,
+			})
+		}
+	}
+
+	sort.Slice(data.Items, func(i, j int) bool {
+		return data.Items[i].Until.Before(data.Items[j].Until)
+	})
+
+	return data
+}
+
+// apiBansDelete is called by api.
+func (l *authLimiter) apiBansDelete(ip string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e, ok := l.entries[ip]
+	if !ok || !time.Now().Before(e.bannedUntil) {
+		return errAPINotFound
+	}
+
+	delete(l.entries, ip)
+	return nil
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthLimiter(t *testing.T) {
+	l := newAuthLimiter(3, time.Minute, time.Hour)
+
+	require.False(t, l.onFailure("1.2.3.4"))
+	require.False(t, l.onFailure("1.2.3.4"))
+	require.False(t, l.banned("1.2.3.4"))
+
+	// a success resets failures
+	l.onSuccess("1.2.3.4")
+	require.False(t, l.onFailure("1.2.3.4"))
+	require.False(t, l.onFailure("1.2.3.4"))
+	require.True(t, l.onFailure("1.2.3.4"))
+	require.True(t, l.banned("1.2.3.4"))
+	require.False(t, l.banned("5.6.7.8"))
+
+	// a success doesn't remove a ban
+	l.onSuccess("1.2.3.4")
+	require.True(t, l.banned("1.2.3.4"))
+
+	bans := l.apiBansList()
+	require.Len(t, bans.Items, 1)
+	require.Equal(t, "1.2.3.4", bans.Items[0].IP)
+
+	err := l.apiBansDelete("1.2.3.4")
+	require.NoError(t, err)
+	require.False(t, l.banned("1.2.3.4"))
+
+	err = l.apiBansDelete("1.2.3.4")
+	require.Equal(t, errAPINotFound, err)
+}
+
+func TestAuthLimiterFailuresPeriod(t *testing.T) {
+	l := newAuthLimiter(2, 50*time.Millisecond, time.Hour)
+
+	require.False(t, l.onFailure("1.2.3.4"))
+	time.Sleep(60 * time.Millisecond)
+
+	// failures older than the period are not counted
+	require.False(t, l.onFailure("1.2.3.4"))
+	require.True(t, l.onFailure("1.2.3.4"))
+}
+
+func TestAuthLimiterDisabled(t *testing.T) {
+	l := newAuthLimiter(0, 0, 0)
+
+	for i := 0; i < 10; i++ {
+		require.False(t, l.onFailure("1.2.3.4"))
+	}
+	require.False(t, l.banned("1.2.3.4"))
+}
+
+func TestAuthLimiterPrune(t *testing.T) {
+	l := newAuthLimiter(2, 50*time.Millisecond, 50*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		l.onFailure("1.2.3." + strconv.Itoa(i))
+	}
+	require.True(t, l.onFailure("1.2.3.0"))
+	require.Len(t, l.entries, 10)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// expired failures and bans are removed on the next failure
+	l.onFailure("5.6.7.8")
+	require.Len(t, l.entries, 1)
+}
+
+func TestAuthLimiterMaxEntries(t *testing.T) {
+	l := newAuthLimiter(2, time.Minute, time.Hour)
+	l.maxEntries = 3
+
+	require.False(t, l.onFailure("1.2.3.4"))
+	require.True(t, l.onFailure("1.2.3.4"))
+
+	for i := 0; i < 10; i++ {
+		l.onFailure("5.6.7." + strconv.Itoa(i))
+		require.LessOrEqual(t, len(l.entries), 3)
+	}
+
+	// entries that are not banned are evicted first
+	require.True(t, l.banned("1.2.3.4"))
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -46,11 +47,12 @@ func (e *errAuthentication) Error() string {
 type authProtocol string
 
 const (
-	authProtocolRTSP   authProtocol = "rtsp"
-	authProtocolRTMP   authProtocol = "rtmp"
-	authProtocolHLS    authProtocol = "hls"
-	authProtocolWebRTC authProtocol = "webrtc"
-	authProtocolSRT    authProtocol = "srt"
+	authProtocolRTSP     authProtocol = "rtsp"
+	authProtocolRTMP     authProtocol = "rtmp"
+	authProtocolHLS      authProtocol = "hls"
+	authProtocolWebRTC   authProtocol = "webrtc"
+	authProtocolSRT      authProtocol = "srt"
+	authProtocolPlayback authProtocol = "playback"
 )
 
 type authCredentials struct {
@@ -58,6 +60,8 @@ type authCredentials struct {
 	ip          net.IP
 	user        string
 	pass        string
+	token       string
+	certUser    string
 	proto       authProtocol
 	id          *uuid.UUID
 	rtspRequest *base.Request
@@ -65,6 +69,67 @@ type authCredentials struct {
 	rtspNonce   string
 }
 
+// provided checks whether the client provided any credential.
+func (c authCredentials) provided() bool {
+	if c.rtspRequest != nil {
+		if _, ok := c.rtspRequest.Header["Authorization"]; ok {
+			return true
+		}
+	}
+	return c.user != "" || c.pass != "" || c.token != "" || c.certUser != ""
+}
+
+// certificateUser returns the identity contained in the certificate
+// provided by a client, that is its common name or, if empty,
+// its first DNS or e-mail subject alternative name.
+func certificateUser(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	crt := state.PeerCertificates[0]
+
+	switch {
+	case crt.Subject.CommonName != "":
+		return crt.Subject.CommonName
+
+	case len(crt.DNSNames) != 0:
+		return crt.DNSNames[0]
+
+	case len(crt.EmailAddresses) != 0:
+		return crt.EmailAddresses[0]
+	}
+
+	return ""
+}
+
+// bearerToken returns the token contained in a "Authorization: Bearer" header.
+// The authentication scheme is case-insensitive (RFC 7235).
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// bearerTokenCredentials converts a bearer token into user and password.
+// Since clients like OBS can only provide a single token, credentials
+// can be passed in the "user:pass" format. Otherwise, the token is used as password.
+func bearerTokenCredentials(token string) (string, string) {
+	if i := strings.Index(token, ":"); i >= 0 {
+		return token[:i], token[i+1:]
+	}
+	return "", token
+}
+
+// checkCertificateUser checks whether the identity of a client has been verified
+// with a client certificate. In this case, a password is not needed.
+func checkCertificateUser(pathUser string, credentials authCredentials) bool {
+	return credentials.certUser != "" && credentials.user == "" &&
+		checkCredential(pathUser, credentials.certUser)
+}
+
 func doExternalAuthentication(
 	ur string,
 	path string,
@@ -75,6 +140,8 @@ func doExternalAuthentication(
 		IP       string     `json:"ip"`
 		User     string     `json:"user"`
 		Password string     `json:"password"`
+		Token    string     `json:"token"`
+		CertUser string     `json:"certUser"`
 		Path     string     `json:"path"`
 		Protocol string     `json:"protocol"`
 		ID       *uuid.UUID `json:"id"`
@@ -84,6 +151,8 @@ func doExternalAuthentication(
 		IP:       credentials.ip.String(),
 		User:     credentials.user,
 		Password: credentials.pass,
+		Token:    credentials.token,
+		CertUser: credentials.certUser,
 		Path:     path,
 		Protocol: string(credentials.proto),
 		ID:       credentials.id,
@@ -173,8 +242,8 @@ func doAuthentication(
 			if err != nil {
 				return &errAuthentication{message: err.Error()}
 			}
-		} else if !checkCredential(pathUser, credentials.user) ||
-			!checkCredential(pathPass, credentials.pass) {
+		} else if !checkCertificateUser(pathUser, credentials) &&
+			(!checkCredential(pathUser, credentials.user) || !checkCredential(pathPass, credentials.pass)) {
 			return &errAuthentication{message: "invalid credentials"}
 		}
 	}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerToken(t *testing.T) {
+	for _, ca := range []struct {
+		name   string
+		header string
+		token  string
+		ok     bool
+		user   string
+		pass   string
+	}{
+		{
+			"token",
+			"Bearer mytoken",
+			"mytoken",
+			true,
+			"",
+			"mytoken",
+		},
+		{
+			"user and pass",
+			"Bearer myuser:mypass",
+			"myuser:mypass",
+			true,
+			"myuser",
+			"mypass",
+		},
+		{
+			"lowercase scheme",
+			"bearer mytoken",
+			"mytoken",
+			true,
+			"",
+			"mytoken",
+		},
+		{
+			"no token",
+			"Bearer",
+			"",
+			false,
+			"",
+			"",
+		},
+		{
+			"basic",
+			"Basic bXl1c2VyOm15cGFzcw==",
+			"",
+			false,
+			"",
+			"",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			token, ok := bearerToken(ca.header)
+			require.Equal(t, ca.ok, ok)
+			require.Equal(t, ca.token, token)
+
+			if ok {
+				user, pass := bearerTokenCredentials(token)
+				require.Equal(t, ca.user, user)
+				require.Equal(t, ca.pass, pass)
+			}
+		})
+	}
+}
+
+func TestCertificateUser(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		crt  *x509.Certificate
+		user string
+	}{
+		{
+			"common name",
+			&x509.Certificate{
+				Subject:  pkix.Name{CommonName: "myuser"},
+				DNSNames: []string{"myhost"},
+			},
+			"myuser",
+		},
+		{
+			"dns name",
+			&x509.Certificate{
+				DNSNames:       []string{"myhost"},
+				EmailAddresses: []string{"me@example.com"},
+			},
+			"myhost",
+		},
+		{
+			"email",
+			&x509.Certificate{
+				EmailAddresses: []string{"me@example.com"},
+			},
+			"me@example.com",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			user := certificateUser(&tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{ca.crt},
+			})
+			require.Equal(t, ca.user, user)
+		})
+	}
+
+	require.Equal(t, "", certificateUser(nil))
+	require.Equal(t, "", certificateUser(&tls.ConnectionState{}))
+}
+
+func TestCheckCertificateUser(t *testing.T) {
+	require.True(t, checkCertificateUser("myuser", authCredentials{certUser: "myuser"}))
+	require.False(t, checkCertificateUser("myuser", authCredentials{certUser: "other"}))
+	require.False(t, checkCertificateUser("myuser", authCredentials{}))
+	require.False(t, checkCertificateUser("myuser", authCredentials{certUser: "myuser", user: "other"}))
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/redis"
+)
+
+const (
+	clusterKeyPrefix  = "mediamtx:"
+	clusterSyncPeriod = 5 * time.Second
+	clusterTimeout    = 5 * time.Second
+
+	// keys survive two failed syncs.
+	clusterKeyTTL = 3 * clusterSyncPeriod
+)
+
+// clusterSession contains the metadata of a WebRTC session that are shared with other nodes.
+type clusterSession struct {
+	roomID string
+	data   string
+}
+
+type clusterParent interface {
+	logger.Writer
+}
+
+// cluster shares the state of the node through Redis:
+// - the paths that are ready on the node, so that other nodes can relay them;
+// - the members of WebRTC rooms and the metadata of WebRTC sessions, that are
+//   meant for external tools, like balancer hooks and dashboards, and are not
+//   read by nodes, since rooms are hosted by a single node.
+// Keys expire when they're not refreshed, in order to remove the state of crashed nodes.
+type cluster struct {
+	nodeAddress string
+	parent      clusterParent
+
+	ctx       context.Context
+	ctxCancel func()
+	client    *redis.Client
+
+	mutex        sync.Mutex
+	paths        map[string]struct{}
+	removedPaths map[string]struct{}
+	sessions     map[string]clusterSession
+	prevSessions map[string]clusterSession
+
+	// in
+	chSync chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newCluster(
+	redisAddress string,
+	redisPassword string,
+	nodeAddress string,
+	parent clusterParent,
+) *cluster {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	c := &cluster{
+		nodeAddress:  strings.TrimSuffix(nodeAddress, "/"),
+		parent:       parent,
+		ctx:          ctx,
+		ctxCancel:    ctxCancel,
+		client:       redis.NewClient(redisAddress, redisPassword, clusterTimeout),
+		paths:        make(map[string]struct{}),
+		removedPaths: make(map[string]struct{}),
+		chSync:       make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+
+	c.Log(logger.Info, "node %s, using Redis on %s", c.nodeAddress, redisAddress)
+
+	go c.run()
+
+	return c
+}
+
+func (c *cluster) close() {
+	c.Log(logger.Info, "closing")
+	c.ctxCancel()
+	<-c.done
+}
+
+// Log is the main logging function.
+func (c *cluster) Log(level logger.Level, format string, args ...interface{}) {
+	c.parent.Log(level, "[cluster] "+format, args...)
+}
+
+func (c *cluster) run() {
+	defer close(c.done)
+
+	t := time.NewTicker(clusterSyncPeriod)
+	defer t.Stop()
+
+outer:
+	for {
+		select {
+		case <-t.C:
+			c.sync()
+
+		case <-c.chSync:
+			c.sync()
+
+		case <-c.ctx.Done():
+			break outer
+		}
+	}
+
+	c.mutex.Lock()
+	for name := range c.paths {
+		c.removedPaths[name] = struct{}{}
+	}
+	c.paths = make(map[string]struct{})
+	c.sessions = nil
+	c.mutex.Unlock()
+
+	c.sync()
+
+	c.client.Close()
+}
+
+func (c *cluster) scheduleSync() {
+	select {
+	case c.chSync <- struct{}{}:
+	default:
+	}
+}
+
+func (c *cluster) sync() {
+	c.mutex.Lock()
+	paths := make([]string, 0, len(c.paths))
+	for name := range c.paths {
+		paths = append(paths, name)
+	}
+	removedPaths := c.removedPaths
+	c.removedPaths = make(map[string]struct{})
+	sessions := c.sessions
+	prevSessions := c.prevSessions
+	c.prevSessions = sessions
+	c.mutex.Unlock()
+
+	ttl := strconv.FormatInt(clusterKeyTTL.Milliseconds(), 10)
+
+	err := func() error {
+		for name := range removedPaths {
+			// do not remove a path that has been taken over by another node
+			res, err := c.client.Do("GET", clusterKeyPrefix+"path:"+name)
+			if err != nil {
+				return err
+			}
+
+			if res == c.nodeAddress {
+				_, err = c.client.Do("DEL", clusterKeyPrefix+"path:"+name)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, name := range paths {
+			_, err := c.client.Do("SET", clusterKeyPrefix+"path:"+name, c.nodeAddress, "PX", ttl)
+			if err != nil {
+				return err
+			}
+		}
+
+		for id, s := range prevSessions {
+			if _, ok := sessions[id]; !ok {
+				_, err := c.client.Do("HDEL", clusterKeyPrefix+"room:"+s.roomID, id)
+				if err != nil {
+					return err
+				}
+
+				_, err = c.client.Do("DEL", clusterKeyPrefix+"session:"+id)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for id, s := range sessions {
+			_, err := c.client.Do("HSET", clusterKeyPrefix+"room:"+s.roomID, id, c.nodeAddress)
+			if err != nil {
+				return err
+			}
+
+			_, err = c.client.Do("PEXPIRE", clusterKeyPrefix+"room:"+s.roomID, ttl)
+			if err != nil {
+				return err
+			}
+
+			_, err = c.client.Do("SET", clusterKeyPrefix+"session:"+id, s.data, "PX", ttl)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}()
+	if err != nil {
+		c.Log(logger.Warn, "unable to sync state: %v", err)
+
+		// try again at next sync
+		c.mutex.Lock()
+		for name := range removedPaths {
+			if _, ok := c.paths[name]; !ok {
+				c.removedPaths[name] = struct{}{}
+			}
+		}
+		c.prevSessions = prevSessions
+		c.mutex.Unlock()
+	}
+}
+
+// pathReady is called by pathManager.
+func (c *cluster) pathReady(name string) {
+	c.mutex.Lock()
+	c.paths[name] = struct{}{}
+	delete(c.removedPaths, name)
+	c.mutex.Unlock()
+
+	c.scheduleSync()
+}
+
+// pathNotReady is called by pathManager.
+func (c *cluster) pathNotReady(name string) {
+	c.mutex.Lock()
+	delete(c.paths, name)
+	c.removedPaths[name] = struct{}{}
+	c.mutex.Unlock()
+
+	c.scheduleSync()
+}
+
+// setSessions is called by webRTCManager.
+func (c *cluster) setSessions(sessions map[string]clusterSession) {
+	c.mutex.Lock()
+	c.sessions = sessions
+	c.mutex.Unlock()
+
+	c.scheduleSync()
+}
+
+// findPath returns the URL of a path that is ready on another node.
+func (c *cluster) findPath(name string) (string, error) {
+	res, err := c.client.Do("GET", clusterKeyPrefix+"path:"+name)
+	if err != nil {
+		return "", err
+	}
+
+	nodeAddress, ok := res.(string)
+	if !ok {
+		return "", fmt.Errorf("path '%s' is not ready on any node", name)
+	}
+
+	if nodeAddress == c.nodeAddress {
+		return "", fmt.Errorf("path '%s' is ready on this node", name)
+	}
+
+	return nodeAddress + "/" + name, nil
+}
+
+// clusterSessions returns the metadata of sessions, to be shared with other nodes.
+func (m *webRTCManager) clusterSessions() map[string]clusterSession {
+	ret := make(map[string]clusterSession)
+
+	for sx := range m.sessions {
+		if sx.roomid == uuid.Nil {
+			continue
+		}
+
+		data, err := json.Marshal(struct {
+			Node    string            `json:"node"`
+			Room    string            `json:"room"`
+			Path    string            `json:"path"`
+			Publish bool              `json:"publish"`
+			Session *apiWebRTCSession `json:"session"`
+		}{
+			Node:    m.cluster.nodeAddress,
+			Room:    sx.roomid.String(),
+			Path:    sx.currentPathName(),
+			Publish: sx.req.publish,
+			Session: sx.apiItem(),
+		})
+		if err != nil {
+			continue
+		}
+
+		ret[sx.uuid.String()] = clusterSession{
+			roomID: sx.roomid.String(),
+			data:   string(data),
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testRedisServer is an in-memory Redis server that supports the commands used by cluster.
+type testRedisServer struct {
+	ln net.Listener
+
+	mutex  sync.Mutex
+	values map[string]string
+	hashes map[string]map[string]string
+}
+
+func newTestRedisServer(t *testing.T) *testRedisServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &testRedisServer{
+		ln:     ln,
+		values: make(map[string]string),
+		hashes: make(map[string]map[string]string),
+	}
+
+	go func() {
+		for {
+			nconn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(nconn)
+		}
+	}()
+
+	return s
+}
+
+func (s *testRedisServer) close() {
+	s.ln.Close()
+}
+
+func (s *testRedisServer) get(key string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.values[key]
+}
+
+func (s *testRedisServer) hget(key string, field string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hashes[key][field]
+}
+
+func (s *testRedisServer) handleConn(nconn net.Conn) {
+	defer nconn.Close()
+	br := bufio.NewReader(nconn)
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		n, _ := strconv.Atoi(line[1 : len(line)-2])
+		args := make([]string, n)
+
+		for i := range args {
+			_, err = br.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			line, err = br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			args[i] = line[:len(line)-2]
+		}
+
+		_, err = nconn.Write([]byte(s.exec(args)))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *testRedisServer) exec(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch args[0] {
+	case "GET":
+		v, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+
+	case "SET":
+		s.values[args[1]] = args[2]
+		return "+OK\r\n"
+
+	case "DEL":
+		delete(s.values, args[1])
+		delete(s.hashes, args[1])
+		return ":1\r\n"
+
+	case "HSET":
+		if s.hashes[args[1]] == nil {
+			s.hashes[args[1]] = make(map[string]string)
+		}
+		s.hashes[args[1]][args[2]] = args[3]
+		return ":1\r\n"
+
+	case "HDEL":
+		delete(s.hashes[args[1]], args[2])
+		return ":1\r\n"
+
+	case "PEXPIRE":
+		return ":1\r\n"
+	}
+
+	return "-ERR unknown command\r\n"
+}
+
+func TestCluster(t *testing.T) {
+	srv := newTestRedisServer(t)
+	defer srv.close()
+
+	nodeA := newCluster(srv.ln.Addr().String(), "", "rtsp://10.0.0.1:8554", nilLogger{})
+	defer nodeA.close()
+
+	nodeB := newCluster(srv.ln.Addr().String(), "", "rtsp://10.0.0.2:8554/", nilLogger{})
+	defer nodeB.close()
+
+	_, err := nodeB.findPath("mypath")
+	require.EqualError(t, err, "path 'mypath' is not ready on any node")
+
+	nodeA.pathReady("mypath")
+
+	require.Eventually(t, func() bool {
+		return srv.get("mediamtx:path:mypath") == "rtsp://10.0.0.1:8554"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ur, err := nodeB.findPath("mypath")
+	require.NoError(t, err)
+	require.Equal(t, "rtsp://10.0.0.1:8554/mypath", ur)
+
+	_, err = nodeA.findPath("mypath")
+	require.EqualError(t, err, "path 'mypath' is ready on this node")
+
+	nodeA.setSessions(map[string]clusterSession{
+		"mysession": {roomID: "myroom", data: `{"path":"mypath"}`},
+	})
+
+	require.Eventually(t, func() bool {
+		return srv.hget("mediamtx:room:myroom", "mysession") == "rtsp://10.0.0.1:8554" &&
+			srv.get("mediamtx:session:mysession") == `{"path":"mypath"}`
+	}, 2*time.Second, 10*time.Millisecond)
+
+	nodeA.setSessions(map[string]clusterSession{})
+	nodeA.pathNotReady("mypath")
+
+	require.Eventually(t, func() bool {
+		return srv.hget("mediamtx:room:myroom", "mysession") == "" &&
+			srv.get("mediamtx:session:mysession") == "" &&
+			srv.get("mediamtx:path:mypath") == ""
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"reflect"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/bluenviron/gortsplib/v3"
@@ -36,7 +37,10 @@ type Core struct {
 	logger          *logger.Logger
 	externalCmdPool *externalcmd.Pool
 	metrics         *metrics
+	tracer          *tracer
+	cluster         *cluster
 	pprof           *pprof
+	playbackServer  *playbackServer
 	pathManager     *pathManager
 	rtspServer      *rtspServer
 	rtspsServer     *rtspServer
@@ -50,6 +54,7 @@ type Core struct {
 
 	// in
 	chAPIConfigSet chan *conf.Conf
+	chAPIDrain     chan struct{}
 
 	// out
 	done chan struct{}
@@ -88,6 +93,7 @@ func New(args []string) (*Core, bool) {
 		ctxCancel:      ctxCancel,
 		confPath:       cli.Confpath,
 		chAPIConfigSet: make(chan *conf.Conf),
+		chAPIDrain:     make(chan struct{}),
 		done:           make(chan struct{}),
 	}
 
@@ -142,6 +148,8 @@ func (p *Core) run() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
+	var drained chan struct{}
+
 outer:
 	for {
 		select {
@@ -169,6 +177,19 @@ outer:
 				break outer
 			}
 
+		case <-p.chAPIDrain:
+			if drained != nil {
+				continue
+			}
+
+			p.Log(logger.Info, "draining")
+			drained = make(chan struct{})
+			go p.drain(p.webRTCManager, time.Duration(p.conf.DrainTimeout), drained)
+
+		case <-drained:
+			p.Log(logger.Info, "drain completed, shutting down")
+			break outer
+
 		case <-interrupt:
 			p.Log(logger.Info, "shutting down gracefully")
 			break outer
@@ -189,6 +210,7 @@ func (p *Core) createResources(initial bool) error {
 	if p.logger == nil {
 		p.logger, err = logger.New(
 			logger.Level(p.conf.LogLevel),
+			logger.Format(p.conf.LogFormat),
 			p.conf.LogDestinations,
 			p.conf.LogFile,
 		)
@@ -226,6 +248,26 @@ func (p *Core) createResources(initial bool) error {
 		}
 	}
 
+	if p.conf.OTLPTracesEndpoint != "" {
+		if p.tracer == nil {
+			p.tracer = newTracer(
+				p.conf.OTLPTracesEndpoint,
+				p,
+			)
+		}
+	}
+
+	if p.conf.Cluster {
+		if p.cluster == nil {
+			p.cluster = newCluster(
+				p.conf.ClusterRedisAddress,
+				p.conf.ClusterRedisPassword,
+				p.conf.ClusterNodeAddress,
+				p,
+			)
+		}
+	}
+
 	if p.conf.PPROF {
 		if p.pprof == nil {
 			p.pprof, err = newPPROF(
@@ -244,13 +286,19 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.ExternalAuthenticationURL,
 			p.conf.RTSPAddress,
 			p.conf.AuthMethods,
+			p.conf.AuthMaxFailures,
+			p.conf.AuthFailuresPeriod,
+			p.conf.AuthBanDuration,
 			p.conf.ReadTimeout,
 			p.conf.WriteTimeout,
 			p.conf.ReadBufferCount,
 			p.conf.UDPMaxPayloadSize,
 			p.conf.Paths,
+			newRoomRecordConf(p.conf),
 			p.externalCmdPool,
 			p.metrics,
+			p.cluster,
+			p.conf.OriginAddress,
 			p,
 		)
 	}
@@ -396,6 +444,8 @@ func (p *Core) createResources(initial bool) error {
 				p.conf.HLSAllowOrigin,
 				p.conf.HLSTrustedProxies,
 				p.conf.HLSDirectory,
+				p.conf.WebRTCRoomDVRDuration,
+				p.conf.WebRTCRoomDVRPath,
 				p.conf.ReadTimeout,
 				p.conf.ReadBufferCount,
 				p.pathManager,
@@ -415,21 +465,72 @@ func (p *Core) createResources(initial bool) error {
 				p.conf.WebRTCEncryption,
 				p.conf.WebRTCServerKey,
 				p.conf.WebRTCServerCert,
+				p.conf.WebRTCClientCA,
+				p.conf.WebRTCDTLSKey,
+				p.conf.WebRTCDTLSCert,
 				p.conf.WebRTCAllowOrigin,
 				p.conf.WebRTCTrustedProxies,
 				p.conf.WebRTCICEServers2,
+				p.conf.WebRTCHandshakeTimeout,
+				p.conf.WebRTCTrackGatherTimeout,
 				p.conf.ReadTimeout,
 				p.conf.ReadBufferCount,
 				p.conf.WebRTCICEHostNAT1To1IPs,
 				p.conf.WebRTCICEUDPMuxAddress,
 				p.conf.WebRTCICETCPMuxAddress,
+				p.conf.WebRTCICETCPFallback,
+				p.conf.WebRTCICEUDPPortMin,
+				p.conf.WebRTCICEUDPPortMax,
+				p.conf.WebRTCICEHostOnly,
+				p.conf.WebRTCICEHostIPs,
+				p.conf.WebRTCOpusInbandFEC,
+				p.conf.WebRTCOpusDTX,
+				p.conf.WebRTCOpusMaxAverageBitrate,
+				p.conf.WebRTCNACKBufferSize,
+				p.conf.WebRTCFECOverhead,
+				p.conf.WebRTCSVCAdaptation,
+				p.conf.WebRTCH264FrameDropping,
+				p.conf.WebRTCJitterBufferDepth,
+				newWebRTCDataChannelLimits(p.conf),
+				p.conf.WebRTCResumeTimeout,
+				p.conf.WebRTCMaxSessions,
+				p.conf.WebRTCMaxSessionsPerIP,
+				p.conf.WebRTCSessionsRetryAfter,
+				p.conf.WebRTCReadBufferMaxCount,
+				newRoomRecordConf(p.conf),
+				newRoomQuotaConf(p.conf),
+				p.conf.WebRTCRoomDVRDuration,
+				p.conf.WebRTCRoomDVRPath,
+				p.conf.WebRTCMaxVideoBitrate,
+				p.conf.WebRTCAutoCreateRooms,
+				p.conf.WebRTCPathTemplate,
+				p.conf.WebRTCRoomChatHistory,
+				p.conf.WebRTCRoomLogSize,
+				p.conf.WebRTCRoomSlate,
+				p.conf.WebRTCRoomSlateFrameRate,
+				p.conf.WebRTCRoomProfiles,
+				p.conf.Tenants,
+				p.conf.WebRTCLoadMaxCPU,
+				p.conf.WebRTCLoadMaxEgress,
+				p.conf.WebRTCBalancerInstances,
+				p.conf.WebRTCBalancerHook,
+				p.conf.WebRTCHealthThreshold,
+				p.conf.WebRTCHealthHook,
+				p.conf.WebRTCCaptureS3Prefix,
+				p.conf.WebRTCGeoIPDatabase,
 				p.pathManager,
 				p.metrics,
+				p.tracer,
+				p.cluster,
 				p,
 			)
 			if err != nil {
 				return err
 			}
+
+			if initial {
+				p.webRTCManager.recoverRooms()
+			}
 		}
 	}
 
@@ -451,10 +552,28 @@ func (p *Core) createResources(initial bool) error {
 		}
 	}
 
+	if p.conf.Playback {
+		if p.playbackServer == nil {
+			p.playbackServer, err = newPlaybackServer(
+				p.conf.PlaybackAddress,
+				p.conf.ReadTimeout,
+				p.pathManager,
+				p,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	if p.conf.API {
 		if p.api == nil {
 			p.api, err = newAPI(
 				p.conf.APIAddress,
+				p.conf.APIEncryption,
+				p.conf.APIServerKey,
+				p.conf.APIServerCert,
+				p.conf.APIClientCA,
 				p.conf.ReadTimeout,
 				p.conf,
 				p.pathManager,
@@ -485,6 +604,7 @@ func (p *Core) createResources(initial bool) error {
 
 func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	closeLogger := newConf == nil ||
+		newConf.LogFormat != p.conf.LogFormat ||
 		!reflect.DeepEqual(newConf.LogDestinations, p.conf.LogDestinations) ||
 		newConf.LogFile != p.conf.LogFile
 
@@ -493,6 +613,15 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.MetricsAddress != p.conf.MetricsAddress ||
 		newConf.ReadTimeout != p.conf.ReadTimeout
 
+	closeTracer := newConf == nil ||
+		newConf.OTLPTracesEndpoint != p.conf.OTLPTracesEndpoint
+
+	closeCluster := newConf == nil ||
+		newConf.Cluster != p.conf.Cluster ||
+		newConf.ClusterRedisAddress != p.conf.ClusterRedisAddress ||
+		newConf.ClusterRedisPassword != p.conf.ClusterRedisPassword ||
+		newConf.ClusterNodeAddress != p.conf.ClusterNodeAddress
+
 	closePPROF := newConf == nil ||
 		newConf.PPROF != p.conf.PPROF ||
 		newConf.PPROFAddress != p.conf.PPROFAddress ||
@@ -502,14 +631,22 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.ExternalAuthenticationURL != p.conf.ExternalAuthenticationURL ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		!reflect.DeepEqual(newConf.AuthMethods, p.conf.AuthMethods) ||
+		newConf.AuthMaxFailures != p.conf.AuthMaxFailures ||
+		newConf.AuthFailuresPeriod != p.conf.AuthFailuresPeriod ||
+		newConf.AuthBanDuration != p.conf.AuthBanDuration ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.ReadBufferCount != p.conf.ReadBufferCount ||
 		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
-		closeMetrics
+		newConf.OriginAddress != p.conf.OriginAddress ||
+		closeMetrics ||
+		closeCluster
 	if !closePathManager && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
 		p.pathManager.confReload(newConf.Paths)
 	}
+	if !closePathManager && !reflect.DeepEqual(newRoomRecordConf(newConf), newRoomRecordConf(p.conf)) {
+		p.pathManager.setRecordConf(newRoomRecordConf(newConf))
+	}
 
 	closeRTSPServer := newConf == nil ||
 		newConf.RTSP != p.conf.RTSP ||
@@ -593,6 +730,8 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.HLSAllowOrigin != p.conf.HLSAllowOrigin ||
 		!reflect.DeepEqual(newConf.HLSTrustedProxies, p.conf.HLSTrustedProxies) ||
 		newConf.HLSDirectory != p.conf.HLSDirectory ||
+		newConf.WebRTCRoomDVRDuration != p.conf.WebRTCRoomDVRDuration ||
+		newConf.WebRTCRoomDVRPath != p.conf.WebRTCRoomDVRPath ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.ReadBufferCount != p.conf.ReadBufferCount ||
 		closePathManager ||
@@ -604,16 +743,74 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.WebRTCEncryption != p.conf.WebRTCEncryption ||
 		newConf.WebRTCServerKey != p.conf.WebRTCServerKey ||
 		newConf.WebRTCServerCert != p.conf.WebRTCServerCert ||
+		newConf.WebRTCClientCA != p.conf.WebRTCClientCA ||
+		newConf.WebRTCDTLSKey != p.conf.WebRTCDTLSKey ||
+		newConf.WebRTCDTLSCert != p.conf.WebRTCDTLSCert ||
 		newConf.WebRTCAllowOrigin != p.conf.WebRTCAllowOrigin ||
 		!reflect.DeepEqual(newConf.WebRTCTrustedProxies, p.conf.WebRTCTrustedProxies) ||
-		!reflect.DeepEqual(newConf.WebRTCICEServers2, p.conf.WebRTCICEServers2) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.ReadBufferCount != p.conf.ReadBufferCount ||
 		!reflect.DeepEqual(newConf.WebRTCICEHostNAT1To1IPs, p.conf.WebRTCICEHostNAT1To1IPs) ||
 		newConf.WebRTCICEUDPMuxAddress != p.conf.WebRTCICEUDPMuxAddress ||
 		newConf.WebRTCICETCPMuxAddress != p.conf.WebRTCICETCPMuxAddress ||
+		newConf.WebRTCICETCPFallback != p.conf.WebRTCICETCPFallback ||
+		newConf.WebRTCICEHostOnly != p.conf.WebRTCICEHostOnly ||
+		!reflect.DeepEqual(newConf.WebRTCICEHostIPs, p.conf.WebRTCICEHostIPs) ||
+		newConf.WebRTCICEUDPPortMin != p.conf.WebRTCICEUDPPortMin ||
+		newConf.WebRTCICEUDPPortMax != p.conf.WebRTCICEUDPPortMax ||
+		newConf.WebRTCOpusInbandFEC != p.conf.WebRTCOpusInbandFEC ||
+		newConf.WebRTCOpusDTX != p.conf.WebRTCOpusDTX ||
+		newConf.WebRTCOpusMaxAverageBitrate != p.conf.WebRTCOpusMaxAverageBitrate ||
+		newConf.WebRTCNACKBufferSize != p.conf.WebRTCNACKBufferSize ||
+		newConf.WebRTCFECOverhead != p.conf.WebRTCFECOverhead ||
+		newConf.WebRTCSVCAdaptation != p.conf.WebRTCSVCAdaptation ||
+		newConf.WebRTCH264FrameDropping != p.conf.WebRTCH264FrameDropping ||
+		newConf.WebRTCJitterBufferDepth != p.conf.WebRTCJitterBufferDepth ||
+		newWebRTCDataChannelLimits(newConf) != newWebRTCDataChannelLimits(p.conf) ||
+		newConf.WebRTCResumeTimeout != p.conf.WebRTCResumeTimeout ||
+		newConf.WebRTCMaxSessions != p.conf.WebRTCMaxSessions ||
+		newConf.WebRTCMaxSessionsPerIP != p.conf.WebRTCMaxSessionsPerIP ||
+		newConf.WebRTCSessionsRetryAfter != p.conf.WebRTCSessionsRetryAfter ||
+		newConf.WebRTCReadBufferMaxCount != p.conf.WebRTCReadBufferMaxCount ||
+		newConf.WebRTCRoomDVRDuration != p.conf.WebRTCRoomDVRDuration ||
+		newConf.WebRTCRoomDVRPath != p.conf.WebRTCRoomDVRPath ||
+		newConf.WebRTCMaxVideoBitrate != p.conf.WebRTCMaxVideoBitrate ||
+		newConf.WebRTCAutoCreateRooms != p.conf.WebRTCAutoCreateRooms ||
+		newConf.WebRTCPathTemplate != p.conf.WebRTCPathTemplate ||
+		newConf.WebRTCRoomChatHistory != p.conf.WebRTCRoomChatHistory ||
+		newConf.WebRTCRoomLogSize != p.conf.WebRTCRoomLogSize ||
+		newConf.WebRTCRoomSlate != p.conf.WebRTCRoomSlate ||
+		newConf.WebRTCRoomSlateFrameRate != p.conf.WebRTCRoomSlateFrameRate ||
+		newConf.WebRTCLoadMaxCPU != p.conf.WebRTCLoadMaxCPU ||
+		newConf.WebRTCLoadMaxEgress != p.conf.WebRTCLoadMaxEgress ||
+		!reflect.DeepEqual(newConf.WebRTCBalancerInstances, p.conf.WebRTCBalancerInstances) ||
+		newConf.WebRTCBalancerHook != p.conf.WebRTCBalancerHook ||
+		newConf.WebRTCHealthThreshold != p.conf.WebRTCHealthThreshold ||
+		newConf.WebRTCHealthHook != p.conf.WebRTCHealthHook ||
+		newConf.WebRTCCaptureS3Prefix != p.conf.WebRTCCaptureS3Prefix ||
+		newConf.WebRTCGeoIPDatabase != p.conf.WebRTCGeoIPDatabase ||
 		closeMetrics ||
+		closeTracer ||
+		closeCluster ||
 		closePathManager
+	if !closeWebRTCManager && p.webRTCManager != nil &&
+		(!reflect.DeepEqual(newConf.WebRTCICEServers2, p.conf.WebRTCICEServers2) ||
+			!reflect.DeepEqual(newRoomRecordConf(newConf), newRoomRecordConf(p.conf)) ||
+			newRoomQuotaConf(newConf) != newRoomQuotaConf(p.conf) ||
+			newConf.WebRTCHandshakeTimeout != p.conf.WebRTCHandshakeTimeout ||
+			newConf.WebRTCTrackGatherTimeout != p.conf.WebRTCTrackGatherTimeout ||
+			!reflect.DeepEqual(newConf.WebRTCRoomProfiles, p.conf.WebRTCRoomProfiles) ||
+			!reflect.DeepEqual(newConf.Tenants, p.conf.Tenants)) {
+		p.webRTCManager.confReload(
+			newConf.WebRTCICEServers2,
+			newRoomRecordConf(newConf),
+			newRoomQuotaConf(newConf),
+			newConf.WebRTCHandshakeTimeout,
+			newConf.WebRTCTrackGatherTimeout,
+			newConf.WebRTCRoomProfiles,
+			newConf.Tenants,
+		)
+	}
 
 	closeSRTServer := newConf == nil ||
 		newConf.SRT != p.conf.SRT ||
@@ -624,9 +821,20 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
 		closePathManager
 
+	closePlaybackServer := newConf == nil ||
+		newConf.Playback != p.conf.Playback ||
+		newConf.PlaybackAddress != p.conf.PlaybackAddress ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closePathManager
+
 	closeAPI := newConf == nil ||
 		newConf.API != p.conf.API ||
 		newConf.APIAddress != p.conf.APIAddress ||
+		newConf.APIEncryption != p.conf.APIEncryption ||
+		newConf.APIServerKey != p.conf.APIServerKey ||
+		newConf.APIServerCert != p.conf.APIServerCert ||
+		newConf.APIClientCA != p.conf.APIClientCA ||
+		newConf.APIDebug != p.conf.APIDebug ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		closePathManager ||
 		closeRTSPServer ||
@@ -650,6 +858,11 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		}
 	}
 
+	if closePlaybackServer && p.playbackServer != nil {
+		p.playbackServer.close()
+		p.playbackServer = nil
+	}
+
 	if closeSRTServer && p.srtServer != nil {
 		p.srtServer.close()
 		p.srtServer = nil
@@ -700,6 +913,16 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.metrics = nil
 	}
 
+	if closeTracer && p.tracer != nil {
+		p.tracer.close()
+		p.tracer = nil
+	}
+
+	if closeCluster && p.cluster != nil {
+		p.cluster.close()
+		p.cluster = nil
+	}
+
 	if newConf == nil && p.externalCmdPool != nil {
 		p.Log(logger.Info, "waiting for external commands")
 		p.externalCmdPool.Close()
@@ -717,6 +940,23 @@ func (p *Core) reloadConf(newConf *conf.Conf, calledByAPI bool) error {
 	return p.createResources(false)
 }
 
+// drain waits for rooms and uploads of the WebRTC manager to complete.
+func (p *Core) drain(webRTCManager *webRTCManager, timeout time.Duration, drained chan struct{}) {
+	defer close(drained)
+
+	if webRTCManager != nil {
+		webRTCManager.drain(timeout)
+	}
+}
+
+// apiDrain is called by api.
+func (p *Core) apiDrain() {
+	select {
+	case p.chAPIDrain <- struct{}{}:
+	case <-p.ctx.Done():
+	}
+}
+
 // apiConfigSet is called by api.
 func (p *Core) apiConfigSet(conf *conf.Conf) {
 	select {
@@ -131,3 +131,51 @@ func TestCoreHotReloading(t *testing.T) {
 		defer conn.Close()
 	}()
 }
+
+func TestCoreHotReloadingWebRTCRecord(t *testing.T) {
+	recordDir, err := os.MkdirTemp("", "mediamtx-record")
+	require.NoError(t, err)
+	defer os.RemoveAll(recordDir)
+
+	confPath := filepath.Join(os.TempDir(), "rtsp-conf")
+
+	err = os.WriteFile(confPath, []byte(
+		"webrtcICEServers2:\n"+
+			"- url: stun:stun1.example.com:3478\n"+
+			"webrtcRecordPath: "+filepath.Join(recordDir, "first", "%room")+"\n"+
+			"webrtcRecordRegion: eu-west-3\n"),
+		0o644)
+	require.NoError(t, err)
+	defer os.Remove(confPath)
+
+	p, ok := New([]string{confPath})
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	m := p.webRTCManager
+	require.NotNil(t, m)
+
+	err = os.WriteFile(confPath, []byte(
+		"webrtcICEServers2:\n"+
+			"- url: stun:stun2.example.com:3478\n"+
+			"webrtcRecordPath: "+filepath.Join(recordDir, "second", "%club", "%room")+"\n"+
+			"webrtcRecordRegion: eu-central-1\n"),
+		0o644)
+	require.NoError(t, err)
+
+	time.Sleep(1 * time.Second)
+
+	// the manager has not been restarted
+	require.Equal(t, m, p.webRTCManager)
+
+	iceServers, err := m.generateICEServers(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stun:stun2.example.com:3478"}, iceServers[0].URLs)
+
+	roomID, err := m.apiRoomCreate("myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "")
+	require.NoError(t, err)
+
+	room := m.rooms[roomID]
+	require.Equal(t, filepath.Join(recordDir, "second", "myclub", roomID.String()), room.dir())
+	require.Equal(t, "eu-central-1", room.recordConf.region)
+}
@@ -0,0 +1,328 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gohlslib/pkg/codecparams"
+	"github.com/bluenviron/gohlslib/pkg/codecs"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	dashMuxerManifestName  = "index.mpd"
+	dashMuxerInitName      = "dash_init.mp4"
+	dashMuxerSegmentPrefix = "dash_seg"
+	dashMuxerSegmentExt    = ".mp4"
+)
+
+func dashDuration(d time.Duration) string {
+	return "PT" + strconv.FormatFloat(d.Seconds(), 'f', 3, 64) + "S"
+}
+
+type dashMPDSegment struct {
+	T int64 `xml:"t,attr"`
+	D int64 `xml:"d,attr"`
+}
+
+type dashMPDSegmentTemplate struct {
+	Timescale      int              `xml:"timescale,attr"`
+	Initialization string           `xml:"initialization,attr"`
+	Media          string           `xml:"media,attr"`
+	StartNumber    uint64           `xml:"startNumber,attr"`
+	Segments       []dashMPDSegment `xml:"SegmentTimeline>S"`
+}
+
+type dashMPDRepresentation struct {
+	ID              string                 `xml:"id,attr"`
+	Codecs          string                 `xml:"codecs,attr"`
+	Bandwidth       int                    `xml:"bandwidth,attr"`
+	SegmentTemplate dashMPDSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type dashMPDAdaptationSet struct {
+	ID               string                `xml:"id,attr"`
+	MimeType         string                `xml:"mimeType,attr"`
+	SegmentAlignment bool                  `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                   `xml:"startWithSAP,attr"`
+	Representation   dashMPDRepresentation `xml:"Representation"`
+}
+
+type dashMPDPeriod struct {
+	ID            string               `xml:"id,attr"`
+	Start         string               `xml:"start,attr"`
+	AdaptationSet dashMPDAdaptationSet `xml:"AdaptationSet"`
+}
+
+type dashMPD struct {
+	XMLName                    xml.Name      `xml:"MPD"`
+	XMLNS                      string        `xml:"xmlns,attr"`
+	Profiles                   string        `xml:"profiles,attr"`
+	Type                       string        `xml:"type,attr"`
+	AvailabilityStartTime      string        `xml:"availabilityStartTime,attr"`
+	PublishTime                string        `xml:"publishTime,attr"`
+	MinimumUpdatePeriod        string        `xml:"minimumUpdatePeriod,attr"`
+	MinBufferTime              string        `xml:"minBufferTime,attr"`
+	TimeShiftBufferDepth       string        `xml:"timeShiftBufferDepth,attr"`
+	SuggestedPresentationDelay string        `xml:"suggestedPresentationDelay,attr"`
+	Period                     dashMPDPeriod `xml:"Period"`
+}
+
+type dashMuxerSegment struct {
+	number   uint64
+	startDTS time.Duration
+	duration time.Duration
+	init     *fmp4.Init
+	data     []byte
+}
+
+// dashMuxer serves the stream of a path with MPEG-DASH.
+// Segments are produced by a fmp4Segmenter and the last ones are kept in memory.
+type dashMuxer struct {
+	segmentDuration time.Duration
+	segmentCount    int
+	parent          logger.Writer
+
+	// accessed by the segmenter only
+	current    *dashMuxerSegment
+	nextNumber uint64
+
+	mutex             sync.RWMutex
+	availabilityStart time.Time
+	initBytes         []byte
+	segments          []*dashMuxerSegment
+}
+
+// newDASHMuxer allocates a dashMuxer,
+// that must be added to a fmp4Segmenter with addOutput().
+func newDASHMuxer(
+	segmentDuration time.Duration,
+	segmentCount int,
+	parent logger.Writer,
+) *dashMuxer {
+	m := &dashMuxer{
+		segmentDuration: segmentDuration,
+		segmentCount:    segmentCount,
+		parent:          parent,
+		nextNumber:      1,
+	}
+
+	m.Log(logger.Info, "muxer created")
+
+	return m
+}
+
+func (m *dashMuxer) close() {
+	m.Log(logger.Info, "muxer destroyed")
+}
+
+// Log is the main logging function.
+func (m *dashMuxer) Log(level logger.Level, format string, args ...interface{}) {
+	m.parent.Log(level, "[DASH] "+format, args...)
+}
+
+// segmentOpen implements fmp4SegmenterSink.
+func (m *dashMuxer) segmentOpen(init *fmp4.Init, initBytes []byte, startDTS time.Duration) error {
+	m.mutex.Lock()
+	if m.availabilityStart.IsZero() {
+		m.availabilityStart = time.Now().Add(-startDTS)
+	}
+	m.initBytes = initBytes
+	m.mutex.Unlock()
+
+	m.current = &dashMuxerSegment{
+		number:   m.nextNumber,
+		startDTS: startDTS,
+		init:     init,
+	}
+	m.nextNumber++
+
+	return nil
+}
+
+// segmentPart implements fmp4SegmenterSink.
+func (m *dashMuxer) segmentPart(part []byte) error {
+	m.current.data = append(m.current.data, part...)
+	return nil
+}
+
+// segmentClose implements fmp4SegmenterSink.
+func (m *dashMuxer) segmentClose(endDTS time.Duration) error {
+	seg := m.current
+	m.current = nil
+
+	seg.duration = endDTS - seg.startDTS
+	if seg.duration <= 0 || seg.data == nil {
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.segments = append(m.segments, seg)
+	if len(m.segments) > m.segmentCount {
+		m.segments = m.segments[len(m.segments)-m.segmentCount:]
+	}
+
+	return nil
+}
+
+// manifest returns the MPD of the muxer.
+// It returns false when no segment is available yet.
+func (m *dashMuxer) manifest() ([]byte, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if len(m.segments) == 0 {
+		return nil, false
+	}
+
+	last := m.segments[len(m.segments)-1]
+
+	var codecStrings []string
+	for _, track := range last.init.Tracks {
+		codecStrings = append(codecStrings, codecparams.Marshal(codecs.FromFMP4(track.Codec)))
+	}
+
+	bandwidth := 0
+	var timeline []dashMPDSegment
+
+	for _, seg := range m.segments {
+		b := int(float64(len(seg.data)*8) / seg.duration.Seconds())
+		if b > bandwidth {
+			bandwidth = b
+		}
+
+		timeline = append(timeline, dashMPDSegment{
+			T: seg.startDTS.Milliseconds(),
+			D: seg.duration.Milliseconds(),
+		})
+	}
+
+	mpd := dashMPD{
+		XMLNS:                      "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:                   "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:                       "dynamic",
+		AvailabilityStartTime:      m.availabilityStart.UTC().Format(time.RFC3339Nano),
+		PublishTime:                time.Now().UTC().Format(time.RFC3339Nano),
+		MinimumUpdatePeriod:        dashDuration(m.segmentDuration),
+		MinBufferTime:              dashDuration(m.segmentDuration),
+		TimeShiftBufferDepth:       dashDuration(time.Duration(m.segmentCount) * m.segmentDuration),
+		SuggestedPresentationDelay: dashDuration(3 * m.segmentDuration),
+		Period: dashMPDPeriod{
+			ID:    "0",
+			Start: "PT0S",
+			AdaptationSet: dashMPDAdaptationSet{
+				ID:               "0",
+				MimeType:         dashMuxerMimeType(last.init),
+				SegmentAlignment: true,
+				StartWithSAP:     1,
+				Representation: dashMPDRepresentation{
+					ID:        "0",
+					Codecs:    strings.Join(codecStrings, ","),
+					Bandwidth: bandwidth,
+					SegmentTemplate: dashMPDSegmentTemplate{
+						Timescale:      1000,
+						Initialization: dashMuxerInitName,
+						Media:          dashMuxerSegmentPrefix + "$Number$" + dashMuxerSegmentExt,
+						StartNumber:    m.segments[0].number,
+						Segments:       timeline,
+					},
+				},
+			},
+		},
+	}
+
+	byts, err := xml.MarshalIndent(mpd, "", "  ")
+	if err != nil {
+		return nil, false
+	}
+
+	return append([]byte(xml.Header), byts...), true
+}
+
+func dashMuxerMimeType(init *fmp4.Init) string {
+	for _, track := range init.Tracks {
+		if track.Codec.IsVideo() {
+			return "video/mp4"
+		}
+	}
+	return "audio/mp4"
+}
+
+// file returns the content of the initialization section or of a segment.
+func (m *dashMuxer) file(fname string) ([]byte, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if fname == dashMuxerInitName {
+		if m.initBytes == nil {
+			return nil, false
+		}
+		return m.initBytes, true
+	}
+
+	if !strings.HasPrefix(fname, dashMuxerSegmentPrefix) || !strings.HasSuffix(fname, dashMuxerSegmentExt) {
+		return nil, false
+	}
+
+	number, err := strconv.ParseUint(
+		strings.TrimSuffix(strings.TrimPrefix(fname, dashMuxerSegmentPrefix), dashMuxerSegmentExt), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	for _, seg := range m.segments {
+		if seg.number == number {
+			return seg.data, true
+		}
+	}
+
+	return nil, false
+}
+
+// handleRequest serves the manifest and the segments of the muxer.
+func (m *dashMuxer) handleRequest(ctx *gin.Context, fname string) {
+	if fname == dashMuxerManifestName {
+		byts, ok := m.manifest()
+		if !ok {
+			ctx.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		ctx.Writer.Header().Set("Content-Type", "application/dash+xml")
+		ctx.Writer.Header().Set("Cache-Control", "no-cache")
+		ctx.Writer.WriteHeader(http.StatusOK)
+		ctx.Writer.Write(byts)
+		return
+	}
+
+	byts, ok := m.file(fname)
+	if !ok {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ctx.Writer.Header().Set("Content-Type", "video/mp4")
+	if fname == dashMuxerInitName {
+		// the initialization section changes when codec parameters change.
+		ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	} else {
+		ctx.Writer.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(m.segmentDuration.Seconds())*m.segmentCount))
+	}
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write(byts)
+}
+
+// isDASHFile checks whether a file requested to the HLS server belongs to DASH.
+func isDASHFile(fname string) bool {
+	return fname == dashMuxerManifestName || strings.HasPrefix(fname, "dash_")
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+func TestDASHMuxer(t *testing.T) {
+	stream, err := stream.New(
+		1472,
+		media.Medias{testMediaH264},
+		true,
+		new(uint64),
+		nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	m := newDASHMuxer(
+		500*time.Millisecond,
+		3,
+		nilLogger{},
+	)
+
+	sg := newFMP4Segmenter(1024, 500*time.Millisecond, stream, nilLogger{})
+	sg.addOutput(m, 500*time.Millisecond)
+	sg.start()
+
+	_, ok := m.manifest()
+	require.Equal(t, false, ok)
+
+	for i := 0; i < 30; i++ {
+		stream.WriteUnit(testMediaH264, testFormatH264, &formatprocessor.UnitH264{
+			PTS: time.Duration(i) * 100 * time.Millisecond,
+			AU: [][]byte{
+				{5, 1}, // IDR
+			},
+		})
+	}
+
+	sg.close()
+	m.close()
+
+	byts, ok := m.manifest()
+	require.Equal(t, true, ok)
+
+	mpd := string(byts)
+	require.Contains(t, mpd, `type="dynamic"`)
+	require.Contains(t, mpd, `mimeType="video/mp4"`)
+	require.Contains(t, mpd, `codecs="avc1.`)
+	require.Contains(t, mpd, `initialization="dash_init.mp4"`)
+	require.Contains(t, mpd, `media="dash_seg$Number$.mp4"`)
+
+	// only the last 3 segments are kept
+	require.Equal(t, 3, strings.Count(mpd, "<S "))
+	require.Contains(t, mpd, `startNumber="4"`)
+
+	byts, ok = m.file("dash_init.mp4")
+	require.Equal(t, true, ok)
+
+	var init fmp4.Init
+	err = init.Unmarshal(byts)
+	require.NoError(t, err)
+	require.Equal(t, &fmp4.CodecH264{
+		SPS: testFormatH264.SPS,
+		PPS: testFormatH264.PPS,
+	}, init.Tracks[0].Codec)
+
+	byts, ok = m.file("dash_seg4.mp4")
+	require.Equal(t, true, ok)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts)
+	require.NoError(t, err)
+	require.Len(t, parts[0].Tracks[0].Samples, 5)
+
+	_, ok = m.file("dash_seg1.mp4")
+	require.Equal(t, false, ok)
+
+	_, ok = m.file("dash_segx.mp4")
+	require.Equal(t, false, ok)
+}
@@ -0,0 +1,597 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aler9/writerseeker"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/ringbuffer"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/codecs/opus"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+func durationGoToMp4(v time.Duration, timeScale uint32) uint64 {
+	timeScale64 := uint64(timeScale)
+	secs := v / time.Second
+	dec := v % time.Second
+	return uint64(secs)*timeScale64 + uint64(dec)*timeScale64/uint64(time.Second)
+}
+
+// fmp4SegmenterSink receives the segments produced by a fmp4Segmenter.
+// Methods are called by the goroutine of the segmenter.
+type fmp4SegmenterSink interface {
+	// segmentOpen is called when a segment starts. initBytes is the marshaled init.
+	segmentOpen(init *fmp4.Init, initBytes []byte, startDTS time.Duration) error
+
+	// segmentPart is called with every marshaled part of the current segment.
+	segmentPart(part []byte) error
+
+	// segmentClose is called when the current segment ends.
+	segmentClose(endDTS time.Duration) error
+}
+
+type fmp4SegmenterSample struct {
+	*fmp4.PartSample
+	dts time.Duration
+}
+
+type fmp4SegmenterTrack struct {
+	s          *fmp4Segmenter
+	initTrack  *fmp4.InitTrack
+	nextSample *fmp4SegmenterSample
+}
+
+// record buffers a sample until the following one is available,
+// since the duration of a sample is the difference between their DTS.
+func (t *fmp4SegmenterTrack) record(sample *fmp4SegmenterSample) error {
+	prev := t.nextSample
+	t.nextSample = sample
+
+	if prev == nil {
+		return nil
+	}
+
+	prev.Duration = uint32(durationGoToMp4(sample.dts-prev.dts, t.initTrack.TimeScale))
+
+	return t.s.writeSample(t, prev, sample)
+}
+
+type fmp4SegmenterPart struct {
+	startDTS time.Duration
+	tracks   map[*fmp4SegmenterTrack]*fmp4.PartTrack
+}
+
+func newFMP4SegmenterPart(startDTS time.Duration) *fmp4SegmenterPart {
+	return &fmp4SegmenterPart{
+		startDTS: startDTS,
+		tracks:   make(map[*fmp4SegmenterTrack]*fmp4.PartTrack),
+	}
+}
+
+func (p *fmp4SegmenterPart) write(track *fmp4SegmenterTrack, sample *fmp4SegmenterSample) {
+	partTrack, ok := p.tracks[track]
+	if !ok {
+		partTrack = &fmp4.PartTrack{
+			ID:       track.initTrack.ID,
+			BaseTime: durationGoToMp4(sample.dts, track.initTrack.TimeScale),
+		}
+		p.tracks[track] = partTrack
+	}
+
+	partTrack.Samples = append(partTrack.Samples, sample.PartSample)
+}
+
+// fmp4SegmenterOutput is a sink with its own segment duration.
+type fmp4SegmenterOutput struct {
+	sink            fmp4SegmenterSink
+	segmentDuration time.Duration
+	startDTS        time.Duration
+	open            bool
+}
+
+// fmp4Segmenter reads a stream and splits it into CMAF fragments,
+// that are shared by all outputs of the segmenter, in order to
+// demux and mux the stream once, regardless of how many outputs are enabled.
+// Every output groups fragments into segments of its own duration,
+// that start with a key frame.
+// It is used by recordings and by the DASH output.
+type fmp4Segmenter struct {
+	partDuration time.Duration
+	stream       *stream.Stream
+	parent       logger.Writer
+
+	ringBuffer  *ringbuffer.RingBuffer
+	tracks      []*fmp4SegmenterTrack
+	hasVideo    bool
+	outputs     []*fmp4SegmenterOutput
+	currentPart *fmp4SegmenterPart
+	lastDTS     time.Duration
+
+	done chan struct{}
+}
+
+// newFMP4Segmenter allocates a fmp4Segmenter.
+// Outputs are added with addOutput(), then start() starts reading the stream.
+func newFMP4Segmenter(
+	readBufferCount int,
+	partDuration time.Duration,
+	stream *stream.Stream,
+	parent logger.Writer,
+) *fmp4Segmenter {
+	s := &fmp4Segmenter{
+		partDuration: partDuration,
+		stream:       stream,
+		parent:       parent,
+		done:         make(chan struct{}),
+	}
+
+	s.ringBuffer, _ = ringbuffer.New(uint64(readBufferCount))
+
+	s.addVideoTrack()
+	s.addAudioTrack()
+
+	return s
+}
+
+// addOutput adds a sink that receives segments of the given duration.
+// It must be called before start().
+func (s *fmp4Segmenter) addOutput(sink fmp4SegmenterSink, segmentDuration time.Duration) {
+	s.outputs = append(s.outputs, &fmp4SegmenterOutput{
+		sink:            sink,
+		segmentDuration: segmentDuration,
+	})
+}
+
+// start starts reading the stream.
+// If the stream doesn't contain any supported codec, the segmenter is closed immediately.
+func (s *fmp4Segmenter) start() {
+	if s.tracks == nil {
+		s.Log(logger.Warn,
+			"the stream doesn't contain any supported codec, which are currently H265, H264, Opus, MPEG-4 Audio")
+		close(s.done)
+		return
+	}
+
+	s.Log(logger.Info, "segmenting %d %s for %d %s",
+		len(s.tracks),
+		func() string {
+			if len(s.tracks) == 1 {
+				return "track"
+			}
+			return "tracks"
+		}(),
+		len(s.outputs),
+		func() string {
+			if len(s.outputs) == 1 {
+				return "output"
+			}
+			return "outputs"
+		}())
+
+	go s.run()
+}
+
+func (s *fmp4Segmenter) close() {
+	s.ringBuffer.Close()
+	<-s.done
+}
+
+// Log is the main logging function.
+func (s *fmp4Segmenter) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, "[segmenter] "+format, args...)
+}
+
+func (s *fmp4Segmenter) addTrack(codec fmp4.Codec, timeScale uint32) *fmp4SegmenterTrack {
+	track := &fmp4SegmenterTrack{
+		s: s,
+		initTrack: &fmp4.InitTrack{
+			ID:        len(s.tracks) + 1,
+			TimeScale: timeScale,
+			Codec:     codec,
+		},
+	}
+	s.tracks = append(s.tracks, track)
+	return track
+}
+
+func (s *fmp4Segmenter) addVideoTrack() {
+	var videoFormatH264 *formats.H264
+	videoMedia := s.stream.Medias().FindFormat(&videoFormatH264)
+
+	if videoFormatH264 != nil {
+		sps, pps := videoFormatH264.SafeParams()
+		track := s.addTrack(&fmp4.CodecH264{
+			SPS: sps,
+			PPS: pps,
+		}, 90000)
+		s.hasVideo = true
+
+		var dtsExtractor *h264.DTSExtractor
+		var startPTS time.Duration
+
+		s.stream.AddReader(s, videoMedia, videoFormatH264, func(unit formatprocessor.Unit) {
+			s.ringBuffer.Push(func() error {
+				tunit := unit.(*formatprocessor.UnitH264)
+
+				if tunit.AU == nil {
+					return nil
+				}
+
+				idrPresent := h264.IDRPresent(tunit.AU)
+
+				if dtsExtractor == nil {
+					if !idrPresent {
+						return nil
+					}
+					dtsExtractor = h264.NewDTSExtractor()
+					startPTS = tunit.PTS
+				}
+
+				pts := tunit.PTS - startPTS
+
+				dts, err := dtsExtractor.Extract(tunit.AU, pts)
+				if err != nil {
+					s.Log(logger.Warn, "unable to extract DTS: %v", err)
+					return nil
+				}
+
+				sample, err := fmp4.NewPartSampleH26x(
+					int32(durationGoToMp4(pts-dts, 90000)),
+					idrPresent,
+					tunit.AU)
+				if err != nil {
+					return err
+				}
+
+				return track.record(&fmp4SegmenterSample{
+					PartSample: sample,
+					dts:        dts,
+				})
+			})
+		})
+		return
+	}
+
+	s.addVideoTrackH265()
+}
+
+func (s *fmp4Segmenter) addVideoTrackH265() {
+	var videoFormatH265 *formats.H265
+	videoMedia := s.stream.Medias().FindFormat(&videoFormatH265)
+
+	if videoFormatH265 == nil {
+		return
+	}
+
+	vps, sps, pps := videoFormatH265.SafeParams()
+	codec := &fmp4.CodecH265{
+		VPS: vps,
+		SPS: sps,
+		PPS: pps,
+	}
+	track := s.addTrack(codec, 90000)
+	s.hasVideo = true
+
+	var dtsExtractor *h265.DTSExtractor
+	var startPTS time.Duration
+
+	s.stream.AddReader(s, videoMedia, videoFormatH265, func(unit formatprocessor.Unit) {
+		s.ringBuffer.Push(func() error {
+			tunit := unit.(*formatprocessor.UnitH265)
+
+			if tunit.AU == nil {
+				return nil
+			}
+
+			randomAccess := h265.IsRandomAccess(tunit.AU)
+
+			if randomAccess {
+				// parameters may be sent in-band, as with WebRTC publishers,
+				// and are written in the initialization section of the next segment.
+				codec.VPS, codec.SPS, codec.PPS = videoFormatH265.SafeParams()
+			}
+
+			if dtsExtractor == nil {
+				if !randomAccess {
+					return nil
+				}
+				dtsExtractor = h265.NewDTSExtractor()
+				startPTS = tunit.PTS
+			}
+
+			pts := tunit.PTS - startPTS
+
+			dts, err := dtsExtractor.Extract(tunit.AU, pts)
+			if err != nil {
+				s.Log(logger.Warn, "unable to extract DTS: %v", err)
+				return nil
+			}
+
+			sample, err := fmp4.NewPartSampleH26x(
+				int32(durationGoToMp4(pts-dts, 90000)),
+				randomAccess,
+				tunit.AU)
+			if err != nil {
+				return err
+			}
+
+			return track.record(&fmp4SegmenterSample{
+				PartSample: sample,
+				dts:        dts,
+			})
+		})
+	})
+}
+
+func (s *fmp4Segmenter) addAudioTrack() {
+	var audioFormatOpus *formats.Opus
+	audioMedia := s.stream.Medias().FindFormat(&audioFormatOpus)
+
+	if audioFormatOpus != nil {
+		track := s.addTrack(&fmp4.CodecOpus{
+			ChannelCount: func() int {
+				if audioFormatOpus.IsStereo {
+					return 2
+				}
+				return 1
+			}(),
+		}, uint32(audioFormatOpus.ClockRate()))
+
+		startPTSFilled := false
+		var startPTS time.Duration
+
+		s.stream.AddReader(s, audioMedia, audioFormatOpus, func(unit formatprocessor.Unit) {
+			s.ringBuffer.Push(func() error {
+				tunit := unit.(*formatprocessor.UnitOpus)
+
+				if !startPTSFilled {
+					startPTSFilled = true
+					startPTS = tunit.PTS
+				}
+
+				pts := tunit.PTS - startPTS
+
+				for _, packet := range tunit.Packets {
+					err := track.record(&fmp4SegmenterSample{
+						PartSample: &fmp4.PartSample{
+							Payload: packet,
+						},
+						dts: pts,
+					})
+					if err != nil {
+						return err
+					}
+
+					pts += opus.PacketDuration(packet)
+				}
+
+				return nil
+			})
+		})
+
+		return
+	}
+
+	var audioFormatMPEG4AudioGeneric *formats.MPEG4AudioGeneric
+	audioMedia = s.stream.Medias().FindFormat(&audioFormatMPEG4AudioGeneric)
+
+	if audioFormatMPEG4AudioGeneric != nil {
+		sampleRate := time.Duration(audioFormatMPEG4AudioGeneric.Config.SampleRate)
+		track := s.addTrack(&fmp4.CodecMPEG4Audio{
+			Config: *audioFormatMPEG4AudioGeneric.Config,
+		}, uint32(audioFormatMPEG4AudioGeneric.ClockRate()))
+
+		startPTSFilled := false
+		var startPTS time.Duration
+
+		s.stream.AddReader(s, audioMedia, audioFormatMPEG4AudioGeneric, func(unit formatprocessor.Unit) {
+			s.ringBuffer.Push(func() error {
+				tunit := unit.(*formatprocessor.UnitMPEG4AudioGeneric)
+
+				if tunit.AUs == nil {
+					return nil
+				}
+
+				if !startPTSFilled {
+					startPTSFilled = true
+					startPTS = tunit.PTS
+				}
+
+				for i, au := range tunit.AUs {
+					pts := tunit.PTS - startPTS +
+						time.Duration(i)*mpeg4audio.SamplesPerAccessUnit*time.Second/sampleRate
+
+					err := track.record(&fmp4SegmenterSample{
+						PartSample: &fmp4.PartSample{
+							Payload: au,
+						},
+						dts: pts,
+					})
+					if err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+		})
+	}
+}
+
+func (s *fmp4Segmenter) run() {
+	defer close(s.done)
+
+	err := s.runWriter()
+	s.Log(logger.Info, "stopped: %v", err)
+
+	s.stream.RemoveReader(s)
+
+	if s.currentPart != nil {
+		s.flushPart()
+		s.currentPart = nil
+
+		for _, o := range s.outputs {
+			s.closeSegment(o, s.lastDTS)
+		}
+	}
+}
+
+func (s *fmp4Segmenter) runWriter() error {
+	for {
+		item, ok := s.ringBuffer.Pull()
+		if !ok {
+			return fmt.Errorf("terminated")
+		}
+
+		err := item.(func() error)()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeSample writes a sample whose duration is known.
+// next is the following sample of the same track.
+func (s *fmp4Segmenter) writeSample(
+	track *fmp4SegmenterTrack,
+	sample *fmp4SegmenterSample,
+	next *fmp4SegmenterSample,
+) error {
+	leading := !s.hasVideo || track.initTrack.Codec.IsVideo()
+
+	if s.currentPart == nil {
+		// when there's video, segments start with a key frame
+		if !leading || sample.IsNonSyncSample {
+			return nil
+		}
+
+		err := s.openSegments(s.outputs, sample.dts)
+		if err != nil {
+			return err
+		}
+
+		s.currentPart = newFMP4SegmenterPart(sample.dts)
+	}
+
+	s.currentPart.write(track, sample)
+
+	if leading {
+		s.lastDTS = next.dts
+
+		// outputs whose segment must be split
+		var due []*fmp4SegmenterOutput
+		if !s.hasVideo || !next.IsNonSyncSample {
+			for _, o := range s.outputs {
+				if !o.open || (next.dts-o.startDTS) >= o.segmentDuration {
+					due = append(due, o)
+				}
+			}
+		}
+
+		if due != nil || (next.dts-s.currentPart.startDTS) >= s.partDuration {
+			s.flushPart()
+
+			for _, o := range due {
+				if o.open {
+					s.closeSegment(o, next.dts)
+				}
+			}
+
+			err := s.openSegments(due, next.dts)
+			if err != nil {
+				return err
+			}
+
+			s.currentPart = newFMP4SegmenterPart(next.dts)
+		}
+	}
+
+	return nil
+}
+
+// openSegments starts a segment in the given outputs.
+// Outputs that fail are kept closed and retry on the next key frame.
+func (s *fmp4Segmenter) openSegments(outputs []*fmp4SegmenterOutput, startDTS time.Duration) error {
+	if outputs == nil {
+		return nil
+	}
+
+	init := &fmp4.Init{}
+	for _, track := range s.tracks {
+		init.Tracks = append(init.Tracks, track.initTrack)
+	}
+
+	var ws writerseeker.WriterSeeker
+	err := init.Marshal(&ws)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range outputs {
+		err := o.sink.segmentOpen(init, ws.Bytes(), startDTS)
+		if err != nil {
+			s.Log(logger.Warn, "unable to open segment: %v", err)
+			continue
+		}
+
+		o.open = true
+		o.startDTS = startDTS
+	}
+
+	return nil
+}
+
+// flushPart marshals the current part, that is a CMAF fragment,
+// and sends it to all open outputs.
+func (s *fmp4Segmenter) flushPart() {
+	part := fmp4.Part{}
+	for _, track := range s.tracks {
+		if partTrack, ok := s.currentPart.tracks[track]; ok {
+			part.Tracks = append(part.Tracks, partTrack)
+		}
+	}
+
+	if part.Tracks == nil {
+		return
+	}
+
+	var ws writerseeker.WriterSeeker
+	err := part.Marshal(&ws)
+	if err != nil {
+		s.Log(logger.Warn, "unable to marshal part: %v", err)
+		return
+	}
+
+	for _, o := range s.outputs {
+		if !o.open {
+			continue
+		}
+
+		err := o.sink.segmentPart(ws.Bytes())
+		if err != nil {
+			s.Log(logger.Warn, "unable to write part: %v", err)
+			s.closeSegment(o, s.currentPart.startDTS)
+		}
+	}
+}
+
+func (s *fmp4Segmenter) closeSegment(o *fmp4SegmenterOutput, endDTS time.Duration) {
+	if !o.open {
+		return
+	}
+
+	o.open = false
+
+	err := o.sink.segmentClose(endDTS)
+	if err != nil {
+		s.Log(logger.Warn, "unable to close segment: %v", err)
+	}
+}
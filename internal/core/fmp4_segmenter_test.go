@@ -0,0 +1,136 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+type testSegmenterSink struct {
+	segments [][][]byte
+}
+
+func (s *testSegmenterSink) segmentOpen(_ *fmp4.Init, _ []byte, _ time.Duration) error {
+	s.segments = append(s.segments, nil)
+	return nil
+}
+
+func (s *testSegmenterSink) segmentPart(part []byte) error {
+	s.segments[len(s.segments)-1] = append(s.segments[len(s.segments)-1], part)
+	return nil
+}
+
+func (s *testSegmenterSink) segmentClose(_ time.Duration) error {
+	return nil
+}
+
+func TestFMP4SegmenterSharedFragments(t *testing.T) {
+	stream, err := stream.New(
+		1472,
+		media.Medias{testMediaH264},
+		true,
+		new(uint64),
+		nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	short := &testSegmenterSink{}
+	long := &testSegmenterSink{}
+
+	sg := newFMP4Segmenter(1024, 200*time.Millisecond, stream, nilLogger{})
+	sg.addOutput(short, 400*time.Millisecond)
+	sg.addOutput(long, 1200*time.Millisecond)
+	sg.start()
+
+	for i := 0; i < 24; i++ {
+		stream.WriteUnit(testMediaH264, testFormatH264, &formatprocessor.UnitH264{
+			PTS: time.Duration(i) * 100 * time.Millisecond,
+			AU: [][]byte{
+				{5, 1}, // IDR
+			},
+		})
+	}
+
+	sg.close()
+
+	require.Len(t, short.segments, 6)
+	require.Len(t, long.segments, 2)
+
+	// outputs receive the same fragments, grouped into segments of different duration.
+	var shortParts [][]byte
+	for _, seg := range short.segments {
+		require.Len(t, seg, 2)
+		shortParts = append(shortParts, seg...)
+	}
+
+	var longParts [][]byte
+	for _, seg := range long.segments {
+		require.Len(t, seg, 6)
+		longParts = append(longParts, seg...)
+	}
+
+	require.Equal(t, len(shortParts), len(longParts))
+	for i := range shortParts {
+		require.True(t, bytes.Equal(shortParts[i], longParts[i]))
+	}
+}
+
+func TestPathSegmenterPartDuration(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		pconf    conf.PathConf
+		duration time.Duration
+	}{
+		{
+			"record",
+			conf.PathConf{
+				Record:              true,
+				RecordPartDuration:  conf.StringDuration(100 * time.Millisecond),
+				DASHSegmentDuration: conf.StringDuration(50 * time.Millisecond),
+			},
+			100 * time.Millisecond,
+		},
+		{
+			"dash",
+			conf.PathConf{
+				DASH:                true,
+				RecordPartDuration:  conf.StringDuration(100 * time.Millisecond),
+				DASHSegmentDuration: conf.StringDuration(2 * time.Second),
+			},
+			2 * time.Second,
+		},
+		{
+			"record and shorter dash",
+			conf.PathConf{
+				Record:              true,
+				DASH:                true,
+				RecordPartDuration:  conf.StringDuration(time.Second),
+				DASHSegmentDuration: conf.StringDuration(500 * time.Millisecond),
+			},
+			500 * time.Millisecond,
+		},
+		{
+			"record and longer dash",
+			conf.PathConf{
+				Record:              true,
+				DASH:                true,
+				RecordPartDuration:  conf.StringDuration(100 * time.Millisecond),
+				DASHSegmentDuration: conf.StringDuration(2 * time.Second),
+			},
+			100 * time.Millisecond,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.duration, pathSegmenterPartDuration(&ca.pconf))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+type geoIPRange struct {
+	start   [16]byte
+	end     [16]byte
+	country string
+}
+
+// geoIPDatabase maps IPs to countries.
+// It is loaded from a CSV file in which every line contains
+// a network in CIDR notation and an ISO 3166-1 alpha-2 country code.
+type geoIPDatabase struct {
+	ranges []geoIPRange
+}
+
+func geoIPNetworkRange(ipnet *net.IPNet) (start [16]byte, end [16]byte) {
+	ip := ipnet.IP.To16()
+	mask := ipnet.Mask
+	if len(mask) == net.IPv4len {
+		// IPv4 masks are applied to the last bytes of IPv4-mapped addresses
+		mask = append(net.CIDRMask(96, 128)[:12], mask...)
+	}
+
+	for i := 0; i < 16; i++ {
+		start[i] = ip[i] & mask[i]
+		end[i] = ip[i] | ^mask[i]
+	}
+
+	return
+}
+
+func parseGeoIPDatabase(byts []byte) (*geoIPDatabase, error) {
+	db := &geoIPDatabase{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(byts))
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected network and country", line)
+		}
+
+		_, ipnet, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			// the first line can be a header
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		country := strings.ToUpper(strings.Trim(strings.TrimSpace(fields[1]), `"`))
+		if len(country) != 2 {
+			return nil, fmt.Errorf("line %d: invalid country code '%s'", line, country)
+		}
+
+		start, end := geoIPNetworkRange(ipnet)
+		db.ranges = append(db.ranges, geoIPRange{
+			start:   start,
+			end:     end,
+			country: country,
+		})
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start[:], db.ranges[j].start[:]) < 0
+	})
+
+	return db, nil
+}
+
+func loadGeoIPDatabase(fpath string) (*geoIPDatabase, error) {
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the GeoIP database: %v", err)
+	}
+
+	db, err := parseGeoIPDatabase(byts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the GeoIP database: %v", err)
+	}
+
+	return db, nil
+}
+
+// country returns the country of an IP, or an empty string if the IP is not in the database.
+func (db *geoIPDatabase) country(ip net.IP) string {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return ""
+	}
+
+	// find the last range that starts before the IP
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start[:], ip16) > 0
+	})
+	if i == 0 {
+		return ""
+	}
+
+	r := db.ranges[i-1]
+	if bytes.Compare(ip16, r.end[:]) > 0 {
+		return ""
+	}
+
+	return r.country
+}
@@ -0,0 +1,352 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	hlsDVRPlaylistName  = "dvr.m3u8"
+	hlsDVRSegmentPrefix = "dvr_"
+	hlsDVRSegmentExt    = ".mp4"
+
+	// segments whose DTS is not contiguous with the one of the previous segment
+	// belong to a new recording, that starts with a discontinuity.
+	hlsDVRMaxGap = 1 * time.Second
+
+	// the segments of paths that are not requested within this period are forgotten.
+	hlsDVRPathTTL = 1 * time.Minute
+)
+
+type hlsDVRSegment struct {
+	seq           uint64
+	filename      string
+	start         time.Time
+	duration      time.Duration
+	startDTS      time.Duration
+	initSize      int
+	size          int
+	discontinuity bool
+}
+
+type hlsDVRPath struct {
+	nextSeq          uint64
+	discontinuitySeq uint64
+	segments         []*hlsDVRSegment
+	lastUse          time.Time
+}
+
+// hlsDVR allows HLS readers to join rooms in the past, by serving the segments
+// written by the DVR of WebRTC rooms with a live playlist that starts at the
+// requested offset (EXT-X-START).
+// Segments are served as they are on disk, through byte ranges that skip
+// their initialization section.
+// Sequence numbers are assigned to segments when they are found for the first time,
+// in order to keep them stable while old segments are removed.
+type hlsDVR struct {
+	recordPath string
+	duration   time.Duration
+
+	mutex sync.Mutex
+	paths map[string]*hlsDVRPath
+}
+
+func newHLSDVR(recordPath string, duration time.Duration) *hlsDVR {
+	return &hlsDVR{
+		recordPath: recordPath,
+		duration:   duration,
+		paths:      make(map[string]*hlsDVRPath),
+	}
+}
+
+// hlsDVRInitSize returns the size of the initialization section of a segment,
+// that is made of the boxes that precede the first fragment.
+func hlsDVRInitSize(byts []byte) (int, error) {
+	pos := 0
+
+	for pos+8 <= len(byts) {
+		size := int(binary.BigEndian.Uint32(byts[pos:]))
+		typ := string(byts[pos+4 : pos+8])
+
+		if typ == "moof" || typ == "styp" {
+			return pos, nil
+		}
+
+		if size == 1 {
+			if pos+16 > len(byts) {
+				break
+			}
+			size = int(binary.BigEndian.Uint64(byts[pos+8:]))
+		}
+
+		if size < 8 {
+			break
+		}
+
+		pos += size
+	}
+
+	return 0, fmt.Errorf("fragment not found")
+}
+
+func hlsDVRReadSegment(seg *playbackSegment) (*hlsDVRSegment, error) {
+	byts, err := os.ReadFile(seg.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	initSize, err := hlsDVRInitSize(byts)
+	if err != nil {
+		return nil, err
+	}
+
+	var init fmp4.Init
+	err = init.Unmarshal(byts[:initSize])
+	if err != nil {
+		return nil, err
+	}
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts[initSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("segment is empty")
+	}
+
+	startDTS := playbackSegmentStartDTS(&init, parts)
+	endDTS := startDTS
+
+	for _, part := range parts {
+		for _, pt := range part.Tracks {
+			for _, track := range init.Tracks {
+				if track.ID != pt.ID {
+					continue
+				}
+
+				dts := pt.BaseTime
+				for _, sample := range pt.Samples {
+					dts += uint64(sample.Duration)
+				}
+
+				if d := durationMp4ToGo(dts, track.TimeScale); d > endDTS {
+					endDTS = d
+				}
+			}
+		}
+	}
+
+	return &hlsDVRSegment{
+		filename: seg.filename,
+		start:    seg.start,
+		duration: endDTS - startDTS,
+		startDTS: startDTS,
+		initSize: initSize,
+		size:     len(byts),
+	}, nil
+}
+
+// update returns the segments of a path, after adding the ones that were written
+// since the last update and removing the ones that were deleted.
+func (d *hlsDVR) update(pathName string, now time.Time) ([]*hlsDVRSegment, uint64, error) {
+	onDisk, err := playbackFindSegments(d.recordPath, pathName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for name, p := range d.paths {
+		if now.Sub(p.lastUse) >= hlsDVRPathTTL {
+			delete(d.paths, name)
+		}
+	}
+
+	p, ok := d.paths[pathName]
+	if !ok {
+		p = &hlsDVRPath{}
+		d.paths[pathName] = p
+	}
+	p.lastUse = now
+
+	existing := make(map[string]struct{}, len(onDisk))
+	for _, seg := range onDisk {
+		existing[seg.filename] = struct{}{}
+	}
+
+	// remove deleted segments
+	n := 0
+	for _, seg := range p.segments {
+		if _, ok := existing[seg.filename]; !ok {
+			if seg.discontinuity {
+				p.discontinuitySeq++
+			}
+			continue
+		}
+		p.segments[n] = seg
+		n++
+	}
+	p.segments = p.segments[:n]
+
+	var last *hlsDVRSegment
+	if len(p.segments) != 0 {
+		last = p.segments[len(p.segments)-1]
+	}
+
+	// add new segments. The last segment is being recorded and is added when a newer one exists.
+	for i := 0; i < (len(onDisk) - 1); i++ {
+		if last != nil && !onDisk[i].start.After(last.start) {
+			continue
+		}
+
+		seg, err := hlsDVRReadSegment(onDisk[i])
+		if err != nil {
+			continue
+		}
+
+		seg.seq = p.nextSeq
+		p.nextSeq++
+
+		if last != nil {
+			gap := seg.startDTS - (last.startDTS + last.duration)
+			seg.discontinuity = gap > hlsDVRMaxGap || gap < -hlsDVRMaxGap
+		}
+
+		p.segments = append(p.segments, seg)
+		last = seg
+	}
+
+	return p.segments, p.discontinuitySeq, nil
+}
+
+func (d *hlsDVR) findSegment(pathName string, seq uint64) *hlsDVRSegment {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	p, ok := d.paths[pathName]
+	if !ok {
+		return nil
+	}
+
+	for _, seg := range p.segments {
+		if seg.seq == seq {
+			return seg
+		}
+	}
+
+	return nil
+}
+
+func hlsDVRSegmentName(seg *hlsDVRSegment) string {
+	return hlsDVRSegmentPrefix + strconv.FormatUint(seg.seq, 10) + hlsDVRSegmentExt
+}
+
+func hlsDVRPlaylist(segments []*hlsDVRSegment, discontinuitySeq uint64, offset time.Duration) []byte {
+	var buf bytes.Buffer
+
+	targetDuration := 1
+	for _, seg := range segments {
+		if d := int(math.Ceil(seg.duration.Seconds())); d > targetDuration {
+			targetDuration = d
+		}
+	}
+
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#EXT-X-VERSION:7\n")
+	buf.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	buf.WriteString("#EXT-X-TARGETDURATION:" + strconv.Itoa(targetDuration) + "\n")
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatUint(segments[0].seq, 10) + "\n")
+	buf.WriteString("#EXT-X-DISCONTINUITY-SEQUENCE:" + strconv.FormatUint(discontinuitySeq, 10) + "\n")
+
+	if offset != 0 {
+		buf.WriteString("#EXT-X-START:TIME-OFFSET=" + strconv.FormatFloat(offset.Seconds(), 'f', 3, 64) +
+			",PRECISE=YES\n")
+	}
+
+	for i, seg := range segments {
+		name := hlsDVRSegmentName(seg)
+
+		if seg.discontinuity {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+
+		if i == 0 || seg.discontinuity {
+			buf.WriteString("#EXT-X-MAP:URI=\"" + name + "\",BYTERANGE=\"" + strconv.Itoa(seg.initSize) + "@0\"\n")
+		}
+
+		buf.WriteString("#EXT-X-PROGRAM-DATE-TIME:" + seg.start.UTC().Format("2006-01-02T15:04:05.000Z07:00") + "\n")
+		buf.WriteString("#EXTINF:" + strconv.FormatFloat(seg.duration.Seconds(), 'f', 5, 64) + ",\n")
+		buf.WriteString("#EXT-X-BYTERANGE:" + strconv.Itoa(seg.size-seg.initSize) + "@" +
+			strconv.Itoa(seg.initSize) + "\n")
+		buf.WriteString(name + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+// handleRequest is called by hlsHTTPServer.
+func (d *hlsDVR) handleRequest(ctx *gin.Context, pathName string, fname string) {
+	if fname == hlsDVRPlaylistName {
+		offset, _, err := webrtcDVROffset(ctx.Request.URL.RawQuery)
+		if err != nil || -offset > d.duration {
+			ctx.Writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		segments, discontinuitySeq, err := d.update(pathName, time.Now())
+		if err != nil || len(segments) == 0 {
+			ctx.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		ctx.Writer.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		ctx.Writer.Header().Set("Cache-Control", "no-cache")
+		ctx.Writer.WriteHeader(http.StatusOK)
+		ctx.Writer.Write(hlsDVRPlaylist(segments, discontinuitySeq, offset))
+		return
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(fname, hlsDVRSegmentPrefix),
+		hlsDVRSegmentExt), 10, 64)
+	if err != nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	seg := d.findSegment(pathName, seq)
+	if seg == nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(seg.filename)
+	if err != nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	ctx.Writer.Header().Set("Content-Type", "video/mp4")
+	ctx.Writer.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(d.duration.Seconds())))
+	http.ServeContent(ctx.Writer, ctx.Request, fname, seg.start, f)
+}
+
+// isHLSDVRFile checks whether a file requested to the HLS server belongs to the DVR.
+func isHLSDVRFile(fname string) bool {
+	return fname == hlsDVRPlaylistName ||
+		(strings.HasPrefix(fname, hlsDVRSegmentPrefix) && strings.HasSuffix(fname, hlsDVRSegmentExt))
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHLSDVR(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-hls-dvr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "%path", "%Y-%m-%d_%H-%M-%S-%f")
+	writeTestRecording(t, recordPath)
+
+	d := newHLSDVR(recordPath, time.Minute)
+
+	request := func(fname string, query string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/mypath/"+fname+query, nil)
+		for k, v := range header {
+			ctx.Request.Header[k] = v
+		}
+		d.handleRequest(ctx, "mypath", fname)
+		ctx.Writer.WriteHeaderNow()
+		return w
+	}
+
+	require.Equal(t, http.StatusBadRequest, request("dvr.m3u8", "?start=10s", nil).Code)
+	require.Equal(t, http.StatusBadRequest, request("dvr.m3u8", "?start=-2m", nil).Code)
+
+	// segments are not available before the playlist is requested
+	require.Equal(t, http.StatusNotFound, request("dvr_0.mp4", "", nil).Code)
+
+	w := request("dvr.m3u8", "?start=-30s", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// the last segment is not listed since it may be still recorded
+	segments, _, err := d.update("mypath", time.Now())
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+
+	playlist := w.Body.String()
+	require.True(t, strings.HasPrefix(playlist, "#EXTM3U\n"+
+		"#EXT-X-VERSION:7\n"+
+		"#EXT-X-INDEPENDENT-SEGMENTS\n"+
+		"#EXT-X-TARGETDURATION:"))
+	require.Contains(t, playlist, "#EXT-X-MEDIA-SEQUENCE:0\n")
+	require.Contains(t, playlist, "#EXT-X-START:TIME-OFFSET=-30.000,PRECISE=YES\n")
+	require.Contains(t, playlist, "#EXT-X-MAP:URI=\"dvr_0.mp4\",BYTERANGE=\""+
+		strconv.Itoa(segments[0].initSize)+"@0\"\n")
+	require.Contains(t, playlist, "dvr_1.mp4\n")
+	require.NotContains(t, playlist, "#EXT-X-DISCONTINUITY\n")
+
+	// the initialization section and the fragments are served with byte ranges
+	w = request("dvr_0.mp4", "", http.Header{
+		"Range": []string{"bytes=0-" + strconv.Itoa(segments[0].initSize-1)},
+	})
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	require.Equal(t, "video/mp4", w.Header().Get("Content-Type"))
+	require.Len(t, w.Body.Bytes(), segments[0].initSize)
+	require.Equal(t, "ftyp", string(w.Body.Bytes()[4:8]))
+
+	w = request("dvr_0.mp4", "", http.Header{
+		"Range": []string{"bytes=" + strconv.Itoa(segments[0].initSize) + "-"},
+	})
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	require.Equal(t, "moof", string(w.Body.Bytes()[4:8]))
+
+	// sequence numbers are kept when segments are removed
+	err = os.Remove(segments[0].filename)
+	require.NoError(t, err)
+
+	w = request("dvr.m3u8", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "#EXT-X-MEDIA-SEQUENCE:1\n")
+	require.NotContains(t, w.Body.String(), "#EXT-X-START")
+	require.Contains(t, w.Body.String(), "#EXT-X-MAP:URI=\"dvr_1.mp4\"")
+	require.Equal(t, http.StatusNotFound, request("dvr_0.mp4", "", nil).Code)
+}
+
+func TestIsHLSDVRFile(t *testing.T) {
+	require.Equal(t, true, isHLSDVRFile("dvr.m3u8"))
+	require.Equal(t, true, isHLSDVRFile("dvr_12.mp4"))
+	require.Equal(t, false, isHLSDVRFile("index.m3u8"))
+	require.Equal(t, false, isHLSDVRFile("seg12.mp4"))
+}
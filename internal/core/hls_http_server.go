@@ -16,10 +16,6 @@ import (
 	"github.com/bluenviron/mediamtx/internal/logger"
 )
 
-const (
-	hlsPauseAfterAuthError = 2 * time.Second
-)
-
 //go:embed hls_index.html
 var hlsIndex []byte
 
@@ -32,6 +28,7 @@ type hlsHTTPServer struct {
 	allowOrigin string
 	pathManager *pathManager
 	parent      hlsHTTPServerParent
+	dvr         *hlsDVR
 
 	inner *httpserv.WrappedServer
 }
@@ -43,6 +40,8 @@ func newHLSHTTPServer( //nolint:dupl
 	serverCert string,
 	allowOrigin string,
 	trustedProxies conf.IPsOrCIDRs,
+	dvrDuration conf.StringDuration,
+	dvrPath string,
 	readTimeout conf.StringDuration,
 	pathManager *pathManager,
 	parent hlsHTTPServerParent,
@@ -62,6 +61,10 @@ func newHLSHTTPServer( //nolint:dupl
 		parent:      parent,
 	}
 
+	if dvrDuration != 0 {
+		s.dvr = newHLSDVR(dvrPath, time.Duration(dvrDuration))
+	}
+
 	router := gin.New()
 	router.SetTrustedProxies(trustedProxies.ToTrustedProxies()) //nolint:errcheck
 
@@ -76,6 +79,7 @@ func newHLSHTTPServer( //nolint:dupl
 		time.Duration(readTimeout),
 		serverCert,
 		serverKey,
+		"",
 		router,
 		s,
 	)
@@ -122,6 +126,7 @@ func (s *hlsHTTPServer) onRequest(ctx *gin.Context) {
 		return
 
 	case strings.HasSuffix(pa, ".m3u8") ||
+		strings.HasSuffix(pa, ".mpd") ||
 		strings.HasSuffix(pa, ".ts") ||
 		strings.HasSuffix(pa, ".mp4") ||
 		strings.HasSuffix(pa, ".mp"):
@@ -177,9 +182,6 @@ func (s *hlsHTTPServer) onRequest(ctx *gin.Context) {
 
 			s.Log(logger.Info, "connection %v failed to authenticate: %v", remoteAddr, terr.message)
 
-			// wait some seconds to stop brute force attacks
-			<-time.After(hlsPauseAfterAuthError)
-
 			ctx.Writer.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -195,6 +197,22 @@ func (s *hlsHTTPServer) onRequest(ctx *gin.Context) {
 		ctx.Writer.Write(hlsIndex)
 
 	default:
+		if isDASHFile(fname) {
+			m := s.pathManager.getDASHMuxer(dir)
+			if m == nil {
+				ctx.Writer.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			m.handleRequest(ctx, fname)
+			return
+		}
+
+		if s.dvr != nil && isHLSDVRFile(fname) {
+			s.dvr.handleRequest(ctx, dir, fname)
+			return
+		}
+
 		s.parent.handleRequest(hlsMuxerHandleRequestReq{
 			path: dir,
 			file: fname,
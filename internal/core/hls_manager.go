@@ -6,6 +6,8 @@ import (
 	"sort"
 	"sync"
 
+	"github.com/bluenviron/gohlslib"
+
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
 )
@@ -77,6 +79,8 @@ func newHLSManager(
 	allowOrigin string,
 	trustedProxies conf.IPsOrCIDRs,
 	directory string,
+	dvrDuration conf.StringDuration,
+	dvrPath string,
 	readTimeout conf.StringDuration,
 	readBufferCount int,
 	pathManager *pathManager,
@@ -117,6 +121,8 @@ func newHLSManager(
 		serverCert,
 		allowOrigin,
 		trustedProxies,
+		dvrDuration,
+		dvrPath,
 		readTimeout,
 		m.pathManager,
 		m,
@@ -158,7 +164,8 @@ outer:
 	for {
 		select {
 		case pa := <-m.chPathReady:
-			if m.alwaysRemux && !pa.conf.SourceOnDemand {
+			// low-latency muxers are always created, in order to have parts ready when readers join
+			if (m.alwaysRemux || m.pathManager.isHLSLowLatency(pa.name)) && !pa.conf.SourceOnDemand {
 				if _, ok := m.muxers[pa.name]; !ok {
 					m.createMuxer(pa.name, "")
 				}
@@ -173,6 +180,14 @@ outer:
 
 		case req := <-m.chHandleRequest:
 			r, ok := m.muxers[req.path]
+
+			// the variant of the path has changed
+			if ok && r.variant != m.pathVariant(req.path) {
+				r.close()
+				delete(m.muxers, req.path)
+				ok = false
+			}
+
 			switch {
 			case ok:
 				r.processRequest(&req)
@@ -235,7 +250,7 @@ func (m *hlsManager) createMuxer(pathName string, remoteAddr string) *hlsMuxer {
 		m.ctx,
 		remoteAddr,
 		m.externalAuthenticationURL,
-		m.variant,
+		m.pathVariant(pathName),
 		m.segmentCount,
 		m.segmentDuration,
 		m.partDuration,
@@ -250,6 +265,15 @@ func (m *hlsManager) createMuxer(pathName string, remoteAddr string) *hlsMuxer {
 	return r
 }
 
+// pathVariant returns the variant of a path, that is low-latency
+// when the path is a path of a room that requires it.
+func (m *hlsManager) pathVariant(pathName string) conf.HLSVariant {
+	if m.pathManager.isHLSLowLatency(pathName) {
+		return conf.HLSVariant(gohlslib.MuxerVariantLowLatency)
+	}
+	return m.variant
+}
+
 // closeMuxer is called by hlsMuxer.
 func (m *hlsManager) closeMuxer(c *hlsMuxer) {
 	select {
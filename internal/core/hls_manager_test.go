@@ -219,3 +219,61 @@ func TestHLSRead(t *testing.T) {
 		Payload: []byte{0x01, 0x02, 0x03, 0x04},
 	}, pkt)*/
 }
+
+func TestHLSReadLowLatencyPath(t *testing.T) {
+	p, ok := newInstance("hlsVariant: mpegts\n" +
+		"paths:\n" +
+		"  all:\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	// paths of rooms with the llhls profile setting
+	p.pathManager.setHLSLowLatency("stream", true)
+
+	medi := &media.Media{
+		Type: media.TypeVideo,
+		Formats: []formats.Format{&formats.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+			SPS: []byte{ // 1920x1080 baseline
+				0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+				0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+				0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+			},
+			PPS: []byte{0x08, 0x06, 0x07, 0x08},
+		}},
+	}
+
+	v := gortsplib.TransportTCP
+	source := gortsplib.Client{
+		Transport: &v,
+	}
+	err := source.StartRecording("rtsp://localhost:8554/stream", media.Medias{medi})
+	require.NoError(t, err)
+	defer source.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		err = source.WritePacketRTP(medi, &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: 123 + uint16(i),
+				Timestamp:      45343 + uint32(i*90000),
+				SSRC:           563423,
+			},
+			Payload: []byte{
+				0x05, 0x02, 0x03, 0x04, // IDR
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	cnt := httpPullFile(t, hc, "http://localhost:8888/stream/stream.m3u8")
+	require.Contains(t, string(cnt), "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES")
+	require.Contains(t, string(cnt), "#EXT-X-PART-INF:")
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	loadMonitorPeriod = 1 * time.Second
+)
+
+// loadSample contains cumulative counters of the system.
+type loadSample struct {
+	cpuTotal uint64
+	cpuIdle  uint64
+	txBytes  uint64
+}
+
+// parseProcStat parses the CPU counters of /proc/stat.
+func parseProcStat(r io.Reader) (uint64, uint64, error) {
+	sc := bufio.NewScanner(r)
+
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var total uint64
+		var idle uint64
+
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			total += v
+
+			// idle and iowait
+			if i == 3 || i == 4 {
+				idle += v
+			}
+		}
+
+		return total, idle, nil
+	}
+
+	return 0, 0, fmt.Errorf("CPU counters not found")
+}
+
+// parseProcNetDev parses the bytes transmitted by all interfaces of /proc/net/dev,
+// except the loopback one.
+func parseProcNetDev(r io.Reader) (uint64, error) {
+	sc := bufio.NewScanner(r)
+	var total uint64
+
+	for sc.Scan() {
+		iface, stats, ok := strings.Cut(sc.Text(), ":")
+		if !ok || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+
+		fields := strings.Fields(stats)
+		if len(fields) < 9 {
+			return 0, fmt.Errorf("invalid line: '%s'", sc.Text())
+		}
+
+		v, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		total += v
+	}
+
+	return total, sc.Err()
+}
+
+func readLoadSample() (loadSample, error) {
+	var s loadSample
+
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+
+	s.cpuTotal, s.cpuIdle, err = parseProcStat(f)
+	if err != nil {
+		return s, err
+	}
+
+	f2, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return s, err
+	}
+	defer f2.Close()
+
+	s.txBytes, err = parseProcNetDev(f2)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+type loadMonitorParent interface {
+	logger.Writer
+}
+
+// loadMonitor measures the CPU usage and the egress bandwidth of the system,
+// and checks whether they exceed their thresholds.
+// It relies on /proc and is not available on other systems.
+type loadMonitor struct {
+	maxCPU    int
+	maxEgress int
+	parent    loadMonitorParent
+
+	ctx       context.Context
+	ctxCancel func()
+
+	mutex      sync.RWMutex
+	cpu        float64 // percent
+	egress     float64 // bits per second
+	overloaded bool
+
+	done chan struct{}
+}
+
+func newLoadMonitor(
+	maxCPU int,
+	maxEgress int,
+	parent loadMonitorParent,
+) *loadMonitor {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	lm := &loadMonitor{
+		maxCPU:    maxCPU,
+		maxEgress: maxEgress,
+		parent:    parent,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+		done:      make(chan struct{}),
+	}
+
+	go lm.run()
+
+	return lm
+}
+
+func (lm *loadMonitor) close() {
+	lm.ctxCancel()
+	<-lm.done
+}
+
+// Log is the main logging function.
+func (lm *loadMonitor) Log(level logger.Level, format string, args ...interface{}) {
+	lm.parent.Log(level, "[load monitor] "+format, args...)
+}
+
+func (lm *loadMonitor) run() {
+	defer close(lm.done)
+
+	prev, err := readLoadSample()
+	if err != nil {
+		lm.Log(logger.Warn, "load monitoring is not available: %v", err)
+		return
+	}
+	prevTime := time.Now()
+
+	t := time.NewTicker(loadMonitorPeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case now := <-t.C:
+			cur, err := readLoadSample()
+			if err != nil {
+				lm.Log(logger.Warn, "unable to measure load: %v", err)
+				continue
+			}
+
+			lm.update(prev, cur, now.Sub(prevTime))
+			prev = cur
+			prevTime = now
+
+		case <-lm.ctx.Done():
+			return
+		}
+	}
+}
+
+func (lm *loadMonitor) update(prev loadSample, cur loadSample, elapsed time.Duration) {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+
+	if cur.cpuTotal > prev.cpuTotal {
+		total := float64(cur.cpuTotal - prev.cpuTotal)
+		idle := float64(cur.cpuIdle - prev.cpuIdle)
+		lm.cpu = (total - idle) / total * 100
+	}
+
+	if cur.txBytes >= prev.txBytes && elapsed > 0 {
+		lm.egress = float64(cur.txBytes-prev.txBytes) * 8 / elapsed.Seconds()
+	}
+
+	overloaded := (lm.maxCPU != 0 && lm.cpu >= float64(lm.maxCPU)) ||
+		(lm.maxEgress != 0 && lm.egress >= float64(lm.maxEgress))
+
+	if overloaded != lm.overloaded {
+		lm.overloaded = overloaded
+
+		if overloaded {
+			lm.Log(logger.Warn, "server is overloaded (CPU %.0f%%, egress %.0f bit/s)", lm.cpu, lm.egress)
+		} else {
+			lm.Log(logger.Info, "server is not overloaded anymore")
+		}
+	}
+}
+
+// isOverloaded checks whether a threshold is exceeded.
+func (lm *loadMonitor) isOverloaded() bool {
+	lm.mutex.RLock()
+	defer lm.mutex.RUnlock()
+	return lm.overloaded
+}
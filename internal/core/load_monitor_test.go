@@ -0,0 +1,56 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	total, idle, err := parseProcStat(strings.NewReader(
+		"cpu  100 10 50 800 40 0 0 0 0 0\n" +
+			"cpu0 50 5 25 400 20 0 0 0 0 0\n" +
+			"intr 12345\n"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), total)
+	require.Equal(t, uint64(840), idle)
+}
+
+func TestParseProcNetDev(t *testing.T) {
+	txBytes, err := parseProcNetDev(strings.NewReader(
+		"Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo: 5000 50 0 0 0 0 0 0 5000 50 0 0 0 0 0 0\n" +
+			"  eth0: 1000 10 0 0 0 0 0 0 2000 20 0 0 0 0 0 0\n" +
+			"  eth1: 1000 10 0 0 0 0 0 0 3000 30 0 0 0 0 0 0\n"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(5000), txBytes)
+}
+
+func TestLoadMonitorUpdate(t *testing.T) {
+	lm := &loadMonitor{
+		maxCPU:    80,
+		maxEgress: 1000000,
+		parent:    nilLogger{},
+	}
+
+	lm.update(loadSample{cpuTotal: 1000, cpuIdle: 500}, loadSample{cpuTotal: 2000, cpuIdle: 1300}, time.Second)
+	require.Equal(t, float64(20), lm.cpu)
+	require.False(t, lm.isOverloaded())
+
+	lm.update(loadSample{cpuTotal: 2000, cpuIdle: 1300}, loadSample{cpuTotal: 3000, cpuIdle: 1400}, time.Second)
+	require.Equal(t, float64(90), lm.cpu)
+	require.True(t, lm.isOverloaded())
+
+	lm.update(loadSample{cpuTotal: 3000, cpuIdle: 1400, txBytes: 0},
+		loadSample{cpuTotal: 4000, cpuIdle: 2400, txBytes: 250000}, time.Second)
+	require.Equal(t, float64(0), lm.cpu)
+	require.Equal(t, float64(2000000), lm.egress)
+	require.True(t, lm.isOverloaded())
+
+	lm.update(loadSample{cpuTotal: 4000, cpuIdle: 2400, txBytes: 250000},
+		loadSample{cpuTotal: 5000, cpuIdle: 3400, txBytes: 260000}, time.Second)
+	require.False(t, lm.isOverloaded())
+}
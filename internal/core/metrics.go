@@ -58,6 +58,7 @@ func newMetrics(
 		time.Duration(readTimeout),
 		"",
 		"",
+		"",
 		router,
 		m,
 	)
@@ -206,11 +207,13 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 				out += metric("webrtc_sessions", tags, 1)
 				out += metric("webrtc_sessions_bytes_received", tags, int64(i.BytesReceived))
 				out += metric("webrtc_sessions_bytes_sent", tags, int64(i.BytesSent))
+				out += metric("webrtc_sessions_read_buffer_discarded", tags, int64(i.ReadBufferDiscarded))
 			}
 		} else {
 			out += metric("webrtc_sessions", "", 0)
 			out += metric("webrtc_sessions_bytes_received", "", 0)
 			out += metric("webrtc_sessions_bytes_sent", "", 0)
+			out += metric("webrtc_sessions_read_buffer_discarded", "", 0)
 		}
 	}
 
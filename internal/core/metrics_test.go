@@ -63,6 +63,7 @@ rtmp_conns_bytes_sent 0
 webrtc_sessions 0
 webrtc_sessions_bytes_received 0
 webrtc_sessions_bytes_sent 0
+webrtc_sessions_read_buffer_discarded 0
 `, string(bo))
 
 	medi := testMediaH264
@@ -138,6 +139,7 @@ webrtc_sessions_bytes_sent 0
 			`webrtc_sessions 0`+"\n"+
 			`webrtc_sessions_bytes_received 0`+"\n"+
 			`webrtc_sessions_bytes_sent 0`+"\n"+
+			`webrtc_sessions_read_buffer_discarded 0`+"\n"+
 			"$",
 		string(bo))
 }
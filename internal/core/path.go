@@ -38,7 +38,9 @@ type pathParent interface {
 	logger.Writer
 	pathReady(*path)
 	pathNotReady(*path)
+	setDASHMuxer(pathName string, m *dashMuxer)
 	closePath(*path)
+	addReader(req pathAddReaderReq) pathAddReaderRes
 }
 
 type pathOnDemandState int
@@ -125,6 +127,7 @@ type pathAddPublisherReq struct {
 	pathName    string
 	skipAuth    bool
 	credentials authCredentials
+	role        pathPublisherRole
 	res         chan pathAddPublisherRes
 }
 
@@ -176,12 +179,15 @@ type path struct {
 	writeTimeout      conf.StringDuration
 	readBufferCount   int
 	udpMaxPayloadSize int
+	recordConf        roomRecordConf
 	confName          string
 	conf              *conf.PathConf
 	name              string
 	matches           []string
 	wg                *sync.WaitGroup
 	externalCmdPool   *externalcmd.Pool
+	cluster           *cluster
+	originAddress     string
 	parent            pathParent
 
 	ctx                            context.Context
@@ -196,6 +202,21 @@ type path struct {
 	readerAddRequestsOnHold        []pathAddReaderReq
 	onDemandCmd                    *externalcmd.Cmd
 	onReadyCmd                     *externalcmd.Cmd
+	transcodeCmd                   *externalcmd.Cmd
+	segmenter                      *fmp4Segmenter
+	recorder                       *pathRecorder
+	dashMuxer                      *dashMuxer
+	srtPushers                     []*srtPusher
+	fallbackClock                  *pathFallbackClock
+	fallback                       *pathFallback
+	publisherStream                *stream.Stream
+	publisherForwarder             *pathStreamForwarder
+	ingestPolicy                   *pathIngestPolicy
+	sourceRole                     pathPublisherRole
+	primaryStalled                 bool
+	backup                         publisher
+	backupStream                   *stream.Stream
+	backupActive                   bool
 	onDemandStaticSourceState      pathOnDemandState
 	onDemandStaticSourceReadyTimer *time.Timer
 	onDemandStaticSourceCloseTimer *time.Timer
@@ -212,6 +233,7 @@ type path struct {
 	chAddPublisher            chan pathAddPublisherReq
 	chStartPublisher          chan pathStartPublisherReq
 	chStopPublisher           chan pathStopPublisherReq
+	chSetPublisherStalled     chan pathSetPublisherStalledReq
 	chAddReader               chan pathAddReaderReq
 	chRemoveReader            chan pathRemoveReaderReq
 	chAPIPathsGet             chan pathAPIPathsGetReq
@@ -227,12 +249,15 @@ func newPath(
 	writeTimeout conf.StringDuration,
 	readBufferCount int,
 	udpMaxPayloadSize int,
+	recordConf roomRecordConf,
 	confName string,
 	cnf *conf.PathConf,
 	name string,
 	matches []string,
 	wg *sync.WaitGroup,
 	externalCmdPool *externalcmd.Pool,
+	cluster *cluster,
+	originAddress string,
 	parent pathParent,
 ) *path {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
@@ -243,12 +268,15 @@ func newPath(
 		writeTimeout:                   writeTimeout,
 		readBufferCount:                readBufferCount,
 		udpMaxPayloadSize:              udpMaxPayloadSize,
+		recordConf:                     recordConf,
 		confName:                       confName,
 		conf:                           cnf,
 		name:                           name,
 		matches:                        matches,
 		wg:                             wg,
 		externalCmdPool:                externalCmdPool,
+		cluster:                        cluster,
+		originAddress:                  originAddress,
 		parent:                         parent,
 		ctx:                            ctx,
 		ctxCancel:                      ctxCancel,
@@ -266,6 +294,7 @@ func newPath(
 		chAddPublisher:                 make(chan pathAddPublisherReq),
 		chStartPublisher:               make(chan pathStartPublisherReq),
 		chStopPublisher:                make(chan pathStopPublisherReq),
+		chSetPublisherStalled:          make(chan pathSetPublisherStalledReq),
 		chAddReader:                    make(chan pathAddReaderReq),
 		chRemoveReader:                 make(chan pathRemoveReaderReq),
 		chAPIPathsGet:                  make(chan pathAPIPathsGetReq),
@@ -308,6 +337,9 @@ func (pa *path) run() {
 	} else if pa.conf.HasStaticSource() {
 		pa.source = newSourceStatic(
 			pa.conf,
+			pa.name,
+			pa.cluster,
+			pa.originAddress,
 			pa.readTimeout,
 			pa.writeTimeout,
 			pa.readBufferCount,
@@ -368,6 +400,10 @@ func (pa *path) run() {
 		}
 	}
 
+	if pa.backup != nil {
+		pa.backup.close()
+	}
+
 	if pa.onDemandCmd != nil {
 		pa.onDemandCmd.Close()
 		pa.Log(logger.Info, "runOnDemand command stopped")
@@ -474,6 +510,9 @@ func (pa *path) runInner() error {
 				return fmt.Errorf("not in use")
 			}
 
+		case req := <-pa.chSetPublisherStalled:
+			pa.handleSetPublisherStalled(req)
+
 		case req := <-pa.chAddReader:
 			pa.handleAddReader(req)
 
@@ -496,6 +535,7 @@ func (pa *path) runInner() error {
 func (pa *path) shouldClose() bool {
 	return pa.conf.Regexp != nil &&
 		pa.source == nil &&
+		pa.backup == nil &&
 		len(pa.readers) == 0 &&
 		len(pa.describeRequestsOnHold) == 0 &&
 		len(pa.readerAddRequestsOnHold) == 0
@@ -603,6 +643,7 @@ func (pa *path) setReady(medias media.Medias, allocateEncoder bool) error {
 
 	pa.stream = stream
 	pa.readyTime = time.Now()
+	pa.fallbackClock = &pathFallbackClock{}
 
 	if pa.conf.RunOnReady != "" {
 		pa.Log(logger.Info, "runOnReady command started")
@@ -616,6 +657,36 @@ func (pa *path) setReady(medias media.Medias, allocateEncoder bool) error {
 			})
 	}
 
+	if pa.conf.TranscodeAudioAAC && pathNeedsAACTranscode(medias) {
+		env := pa.externalCmdEnv()
+		env["MTX_TRANSCODE_PATH"] = pathTranscodePath(pa.conf.TranscodeAudioAACPath, pa.name)
+
+		pa.Log(logger.Info, "AAC transcoder started, publishing to '%s'", env["MTX_TRANSCODE_PATH"])
+		pa.transcodeCmd = externalcmd.NewCmd(
+			pa.externalCmdPool,
+			pathTranscodeAACCommand,
+			true,
+			env,
+			func(err error) {
+				pa.Log(logger.Info, "AAC transcoder exited: %v", err)
+			})
+	}
+
+	if pa.conf.Record || pa.conf.DASH {
+		pa.startSegmenter()
+	}
+
+	for _, target := range pa.conf.SRTPushTargets {
+		pa.srtPushers = append(pa.srtPushers, newSRTPusher(
+			target,
+			pa.readBufferCount,
+			pa.writeTimeout,
+			pa.udpMaxPayloadSize,
+			pa.stream,
+			pa,
+		))
+	}
+
 	pa.parent.pathReady(pa)
 
 	return nil
@@ -635,22 +706,127 @@ func (pa *path) setNotReady() {
 		pa.Log(logger.Info, "runOnReady command stopped")
 	}
 
+	if pa.transcodeCmd != nil {
+		pa.transcodeCmd.Close()
+		pa.transcodeCmd = nil
+		pa.Log(logger.Info, "AAC transcoder stopped")
+	}
+
+	if pa.segmenter != nil {
+		pa.stopSegmenter()
+	}
+
+	for _, p := range pa.srtPushers {
+		p.close()
+	}
+	pa.srtPushers = nil
+
+	if pa.fallback != nil {
+		pa.fallback.stop()
+		pa.fallback = nil
+	}
+
+	pa.stopPublisherStream()
+
+	if pa.backupStream != nil {
+		pa.stopBackupStream()
+		pa.Log(logger.Info, "closing backup publisher")
+		pa.backup.close()
+	}
+
 	if pa.stream != nil {
 		pa.stream.Close()
 		pa.stream = nil
 	}
 }
 
+// setReadyWithFallback makes the path ready, and provides the publisher with
+// a dedicated stream, that is copied into the path stream. This allows to
+// replace the publisher with the fallback source without closing readers.
+func (pa *path) setReadyWithFallback(medias media.Medias, generateRTPPackets bool) (*stream.Stream, error) {
+	if pa.stream != nil && !pathMediasCompatible(medias, pa.stream.Medias()) {
+		pa.Log(logger.Info, "codecs of the publisher are different from the previous ones, closing readers")
+		pa.setNotReady()
+	}
+
+	if pa.stream == nil {
+		pathMedias, err := pathCloneMedias(medias)
+		if err != nil {
+			return nil, err
+		}
+
+		// RTP packets are always generated, since they can come from different sources.
+		err = pa.setReady(pathMedias, true)
+		if err != nil {
+			return nil, err
+		}
+	} else if pa.fallback != nil {
+		pa.fallback.stop()
+		pa.fallback = nil
+		pa.Log(logger.Info, "publisher is back, readers switched to the publisher stream")
+	}
+
+	publisherStream, err := stream.New(
+		pa.udpMaxPayloadSize,
+		medias,
+		generateRTPPackets,
+		new(uint64),
+		pa.source,
+	)
+	if err != nil {
+		pa.setNotReady()
+		return nil, err
+	}
+
+	pa.publisherStream = publisherStream
+	pa.updateActivePublisher()
+
+	return publisherStream, nil
+}
+
+func (pa *path) stopPublisherStream() {
+	pa.stopIngestPolicy()
+
+	if pa.publisherForwarder != nil {
+		pa.publisherForwarder.close()
+		pa.publisherForwarder = nil
+	}
+
+	if pa.publisherStream != nil {
+		pa.publisherStream.Close()
+		pa.publisherStream = nil
+	}
+}
+
+// setNotReadyOrFallback is called when the publisher stops.
+// If a fallback source is set and there are readers, they are switched to it.
+func (pa *path) setNotReadyOrFallback() {
+	if pa.fallback != nil {
+		return
+	}
+
+	if pa.conf.FallbackSource == "" || len(pa.readers) == 0 {
+		pa.setNotReady()
+		return
+	}
+
+	pa.stopPublisherStream()
+
+	pa.Log(logger.Info, "publisher is gone, switching readers to path '%s'", pa.conf.FallbackSource)
+	pa.fallback = newPathFallback(pa.conf.FallbackSource, pa.stream, pa.fallbackClock, pa.parent, pa)
+}
+
 func (pa *path) doRemoveReader(r reader) {
 	delete(pa.readers, r)
 }
 
 func (pa *path) doPublisherRemove() {
 	if pa.stream != nil {
-		pa.setNotReady()
+		pa.primaryStopped()
 	}
 
 	pa.source = nil
+	pa.sourceRole = pathPublisherRoleStandalone
 }
 
 func (pa *path) handleSourceStaticSetReady(req pathSourceStaticSetReadyReq) {
@@ -748,6 +924,9 @@ func (pa *path) handleDescribe(req pathDescribeReq) {
 func (pa *path) handleRemovePublisher(req pathRemovePublisherReq) {
 	if pa.source == req.author {
 		pa.doPublisherRemove()
+	} else if pa.backup != nil && pa.backup == req.author {
+		pa.backupStopped()
+		pa.backup = nil
 	}
 	close(req.res)
 }
@@ -760,8 +939,26 @@ func (pa *path) handleAddPublisher(req pathAddPublisherReq) {
 		return
 	}
 
+	if req.role == pathPublisherRoleBackup {
+		// a backup can't replace a primary that is publishing directly into the path stream
+		if pa.source != nil && pa.sourceRole == pathPublisherRoleStandalone && pa.stream != nil {
+			req.res <- pathAddPublisherRes{
+				err: fmt.Errorf("the publisher of path '%s' has not been started with the primary role", pa.name),
+			}
+			return
+		}
+
+		pa.handleAddBackupPublisher(req)
+		return
+	}
+
 	if pa.source != nil {
-		if !pa.conf.OverridePublisher {
+		if pa.conf.DuplicatePublisher == "fork" && req.role == pathPublisherRoleStandalone {
+			req.res <- pathAddPublisherRes{err: errPathPublisherFork}
+			return
+		}
+
+		if pa.conf.DuplicatePublisher != "replace" {
 			req.res <- pathAddPublisherRes{err: fmt.Errorf("someone is already publishing to path '%s'", pa.name)}
 			return
 		}
@@ -772,17 +969,40 @@ func (pa *path) handleAddPublisher(req pathAddPublisherReq) {
 	}
 
 	pa.source = req.author
+	pa.sourceRole = req.role
 
 	req.res <- pathAddPublisherRes{path: pa}
 }
 
 func (pa *path) handleStartPublisher(req pathStartPublisherReq) {
+	if pa.backup != nil && pa.backup == req.author {
+		pa.handleStartBackupPublisher(req)
+		return
+	}
+
 	if pa.source != req.author {
 		req.res <- pathStartPublisherRes{err: fmt.Errorf("publisher is not assigned to this path anymore")}
 		return
 	}
 
-	err := pa.setReady(req.medias, req.generateRTPPackets)
+	if pa.conf.HasPublishPolicy() && pa.conf.PublishPolicyAction == "reject" {
+		err := pathIngestPolicyCheckMedias(pa.conf, req.medias)
+		if err != nil {
+			req.res <- pathStartPublisherRes{err: err}
+			return
+		}
+	}
+
+	publisherStream, err := func() (*stream.Stream, error) {
+		// publishers of a redundant ingest are copied into the path stream too,
+		// in order to switch between them without closing readers.
+		if pa.conf.FallbackSource != "" || pa.sourceRole != pathPublisherRoleStandalone || pa.backup != nil {
+			return pa.setReadyWithFallback(req.medias, req.generateRTPPackets)
+		}
+
+		err := pa.setReady(req.medias, req.generateRTPPackets)
+		return pa.stream, err
+	}()
 	if err != nil {
 		req.res <- pathStartPublisherRes{err: err}
 		return
@@ -792,6 +1012,14 @@ func (pa *path) handleStartPublisher(req pathStartPublisherReq) {
 		pa.name,
 		sourceMediaInfo(req.medias))
 
+	if pa.conf.HasPublishPolicy() {
+		pa.ingestPolicy = newPathIngestPolicy(pa.conf, publisherStream, req.author, pa)
+		// with the flag action, publishers with a forbidden SDP are accepted and reported
+		if err := pathIngestPolicyCheckMedias(pa.conf, req.medias); err != nil {
+			pa.ingestPolicy.onViolation(err)
+		}
+	}
+
 	if pa.conf.HasOnDemandPublisher() {
 		pa.onDemandPublisherReadyTimer.Stop()
 		pa.onDemandPublisherReadyTimer = newEmptyTimer()
@@ -811,12 +1039,14 @@ func (pa *path) handleStartPublisher(req pathStartPublisherReq) {
 		pa.readerAddRequestsOnHold = nil
 	}
 
-	req.res <- pathStartPublisherRes{stream: pa.stream}
+	req.res <- pathStartPublisherRes{stream: publisherStream}
 }
 
 func (pa *path) handleStopPublisher(req pathStopPublisherReq) {
 	if req.author == pa.source && pa.stream != nil {
-		pa.setNotReady()
+		pa.primaryStopped()
+	} else if pa.backup != nil && req.author == pa.backup {
+		pa.backupStopped()
 	}
 	close(req.res)
 }
@@ -828,6 +1058,11 @@ func (pa *path) handleRemoveReader(req pathRemoveReaderReq) {
 	close(req.res)
 
 	if len(pa.readers) == 0 {
+		// the fallback source is only used to serve existing readers
+		if pa.fallback != nil {
+			pa.setNotReady()
+		}
+
 		if pa.conf.HasOnDemandStaticSource() {
 			if pa.onDemandStaticSourceState == pathOnDemandStateReady {
 				pa.onDemandStaticSourceScheduleClose()
@@ -907,6 +1142,19 @@ func (pa *path) handleAPIPathsGet(req pathAPIPathsGetReq) {
 				}
 				return pa.source.apiSourceDescribe()
 			}(),
+			BackupSource: func() interface{} {
+				if pa.backup == nil {
+					return nil
+				}
+				return pa.backup.apiSourceDescribe()
+			}(),
+			BackupActive: pa.backupActive,
+			PublishPolicyViolation: func() *string {
+				if pa.ingestPolicy == nil {
+					return nil
+				}
+				return pa.ingestPolicy.apiViolation()
+			}(),
 			SourceReady: pa.stream != nil,
 			Ready:       pa.stream != nil,
 			ReadyTime: func() *time.Time {
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+// pathPublisherRole is the role of a publisher in a redundant ingest.
+type pathPublisherRole int
+
+const (
+	// publisher is the only one of the path.
+	pathPublisherRoleStandalone pathPublisherRole = iota
+
+	// publisher is forwarded to readers unless it stalls.
+	pathPublisherRolePrimary
+
+	// publisher is forwarded to readers when the primary is missing or stalls.
+	pathPublisherRoleBackup
+)
+
+// pathPublisherRoleFromQuery returns the role requested by a publisher
+// with the "role" query parameter.
+func pathPublisherRoleFromQuery(query string) (pathPublisherRole, error) {
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := vals.Get("role"); v {
+	case "":
+		return pathPublisherRoleStandalone, nil
+
+	case "primary":
+		return pathPublisherRolePrimary, nil
+
+	case "backup":
+		return pathPublisherRoleBackup, nil
+
+	default:
+		return 0, fmt.Errorf("invalid role: '%s'", v)
+	}
+}
+
+// pathRedundantPublisher is implemented by publishers that need to know
+// whether they are forwarded to readers, in order to record only the active one.
+type pathRedundantPublisher interface {
+	setActive(active bool)
+}
+
+type pathSetPublisherStalledReq struct {
+	author  publisher
+	stalled bool
+}
+
+func (pa *path) handleAddBackupPublisher(req pathAddPublisherReq) {
+	if pa.backup != nil {
+		if pa.conf.DuplicatePublisher != "replace" {
+			req.res <- pathAddPublisherRes{err: fmt.Errorf("a backup publisher is already publishing to path '%s'", pa.name)}
+			return
+		}
+
+		pa.Log(logger.Info, "closing existing backup publisher")
+		pa.backup.close()
+		pa.backupStopped()
+	}
+
+	pa.backup = req.author
+
+	req.res <- pathAddPublisherRes{path: pa}
+}
+
+func (pa *path) handleStartBackupPublisher(req pathStartPublisherReq) {
+	if pa.conf.HasPublishPolicy() && pa.conf.PublishPolicyAction == "reject" {
+		err := pathIngestPolicyCheckMedias(pa.conf, req.medias)
+		if err != nil {
+			req.res <- pathStartPublisherRes{err: err}
+			return
+		}
+	}
+
+	if pa.stream != nil && !pathMediasCompatible(req.medias, pa.stream.Medias()) {
+		req.res <- pathStartPublisherRes{
+			err: fmt.Errorf("codecs of the backup publisher are different from the ones of the path"),
+		}
+		return
+	}
+
+	if pa.stream == nil {
+		pathMedias, err := pathCloneMedias(req.medias)
+		if err != nil {
+			req.res <- pathStartPublisherRes{err: err}
+			return
+		}
+
+		err = pa.setReady(pathMedias, true)
+		if err != nil {
+			req.res <- pathStartPublisherRes{err: err}
+			return
+		}
+	} else if pa.fallback != nil {
+		pa.fallback.stop()
+		pa.fallback = nil
+	}
+
+	backupStream, err := stream.New(
+		pa.udpMaxPayloadSize,
+		req.medias,
+		req.generateRTPPackets,
+		new(uint64),
+		req.author,
+	)
+	if err != nil {
+		if pa.publisherStream == nil {
+			pa.setNotReady()
+		}
+		req.res <- pathStartPublisherRes{err: err}
+		return
+	}
+
+	pa.backupStream = backupStream
+	pa.updateActivePublisher()
+
+	req.author.Log(logger.Info, "is publishing to path '%s' as backup, %s",
+		pa.name,
+		sourceMediaInfo(req.medias))
+
+	req.res <- pathStartPublisherRes{stream: backupStream}
+}
+
+func (pa *path) handleSetPublisherStalled(req pathSetPublisherStalledReq) {
+	if req.author != pa.source || pa.primaryStalled == req.stalled {
+		return
+	}
+
+	pa.primaryStalled = req.stalled
+
+	if req.stalled {
+		pa.Log(logger.Warn, "primary publisher stalled")
+	} else {
+		pa.Log(logger.Info, "primary publisher recovered")
+	}
+
+	pa.updateActivePublisher()
+}
+
+// updateActivePublisher forwards the primary publisher to readers, or the backup
+// one when the primary is missing or stalled.
+func (pa *path) updateActivePublisher() {
+	useBackup := pa.backupStream != nil && (pa.publisherStream == nil || pa.primaryStalled)
+
+	src := pa.publisherStream
+	if useBackup {
+		src = pa.backupStream
+	}
+
+	if pa.publisherForwarder != nil && pa.publisherForwarder.src == src {
+		return
+	}
+
+	if pa.publisherForwarder != nil {
+		pa.publisherForwarder.close()
+		pa.publisherForwarder = nil
+	}
+
+	if src == nil {
+		return
+	}
+
+	pa.publisherForwarder = newPathStreamForwarder(src, pa.stream, pa.fallbackClock)
+
+	if useBackup != pa.backupActive {
+		pa.backupActive = useBackup
+
+		if useBackup {
+			pa.Log(logger.Info, "readers switched to the backup publisher")
+		} else {
+			pa.Log(logger.Info, "readers switched to the primary publisher")
+		}
+	}
+
+	if p, ok := pa.source.(pathRedundantPublisher); ok {
+		p.setActive(!useBackup)
+	}
+	if p, ok := pa.backup.(pathRedundantPublisher); ok {
+		p.setActive(useBackup)
+	}
+}
+
+// primaryStopped is called when the primary publisher stops.
+// If the backup publisher is ready, readers are switched to it.
+func (pa *path) primaryStopped() {
+	pa.primaryStalled = false
+	pa.stopIngestPolicy()
+
+	if pa.backupStream == nil {
+		pa.setNotReadyOrFallback()
+		return
+	}
+
+	if pa.publisherForwarder != nil && pa.publisherForwarder.src == pa.publisherStream {
+		pa.publisherForwarder.close()
+		pa.publisherForwarder = nil
+	}
+
+	if pa.publisherStream != nil {
+		pa.publisherStream.Close()
+		pa.publisherStream = nil
+	}
+
+	pa.updateActivePublisher()
+}
+
+// backupStopped is called when the backup publisher stops.
+func (pa *path) backupStopped() {
+	if pa.backupStream == nil {
+		return
+	}
+
+	if pa.publisherForwarder != nil && pa.publisherForwarder.src == pa.backupStream {
+		pa.publisherForwarder.close()
+		pa.publisherForwarder = nil
+	}
+
+	pa.backupStream.Close()
+	pa.backupStream = nil
+
+	if pa.publisherStream == nil {
+		pa.backupActive = false
+		pa.setNotReadyOrFallback()
+		return
+	}
+
+	pa.updateActivePublisher()
+}
+
+func (pa *path) stopBackupStream() {
+	if pa.backupStream != nil {
+		pa.backupStream.Close()
+		pa.backupStream = nil
+	}
+	pa.backupActive = false
+}
+
+// setPublisherStalled is called by a primary publisher when it stops or resumes
+// receiving media.
+func (pa *path) setPublisherStalled(req pathSetPublisherStalledReq) {
+	select {
+	case pa.chSetPublisherStalled <- req:
+	case <-pa.ctx.Done():
+	}
+}
@@ -0,0 +1,387 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	pathFallbackRetryPause = 2 * time.Second
+)
+
+// pathCloneMedias returns a deep copy of medias.
+// It is needed since formats are updated in place by format processors.
+func pathCloneMedias(medias media.Medias) (media.Medias, error) {
+	var ret media.Medias
+	err := ret.Unmarshal(medias.Marshal(false).MediaDescriptions)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+type pathFormatPair struct {
+	srcMedia *media.Media
+	srcForma formats.Format
+	dstMedia *media.Media
+	dstForma formats.Format
+}
+
+// pathMatchFormats associates every format of dst with a format of src that
+// has the same codec.
+func pathMatchFormats(src media.Medias, dst media.Medias) []pathFormatPair {
+	used := make(map[formats.Format]struct{})
+	var ret []pathFormatPair
+
+	for _, dstMedia := range dst {
+		for _, dstForma := range dstMedia.Formats {
+			func() {
+				for _, srcMedia := range src {
+					for _, srcForma := range srcMedia.Formats {
+						if _, ok := used[srcForma]; ok {
+							continue
+						}
+
+						if reflect.TypeOf(srcForma) == reflect.TypeOf(dstForma) {
+							used[srcForma] = struct{}{}
+							ret = append(ret, pathFormatPair{
+								srcMedia: srcMedia,
+								srcForma: srcForma,
+								dstMedia: dstMedia,
+								dstForma: dstForma,
+							})
+							return
+						}
+					}
+				}
+			}()
+		}
+	}
+
+	return ret
+}
+
+func pathFormatCount(medias media.Medias) int {
+	n := 0
+	for _, medi := range medias {
+		n += len(medi.Formats)
+	}
+	return n
+}
+
+// pathMediasCompatible checks whether a stream can replace another one
+// without interrupting readers.
+func pathMediasCompatible(src media.Medias, dst media.Medias) bool {
+	n := pathFormatCount(dst)
+	return pathFormatCount(src) == n && len(pathMatchFormats(src, dst)) == n
+}
+
+// pathUnitPTS returns the timestamp of a unit.
+func pathUnitPTS(unit formatprocessor.Unit) (time.Duration, bool) {
+	switch tunit := unit.(type) {
+	case *formatprocessor.UnitAV1:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitVP9:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitVP8:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitH265:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitH264:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitOpus:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitMPEG4AudioGeneric:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitMPEG4AudioLATM:
+		return tunit.PTS, true
+
+	case *formatprocessor.UnitMPEG1Audio:
+		return tunit.PTS, true
+	}
+
+	return 0, false
+}
+
+// pathRebaseUnit returns a copy of a unit with shifted timestamp and without
+// RTP packets, that are generated again by the destination stream.
+func pathRebaseUnit(unit formatprocessor.Unit, offset time.Duration) formatprocessor.Unit {
+	base := formatprocessor.BaseUnit{NTP: time.Now()}
+
+	switch tunit := unit.(type) {
+	case *formatprocessor.UnitAV1:
+		return &formatprocessor.UnitAV1{BaseUnit: base, PTS: tunit.PTS + offset, TU: tunit.TU}
+
+	case *formatprocessor.UnitVP9:
+		return &formatprocessor.UnitVP9{BaseUnit: base, PTS: tunit.PTS + offset, Frame: tunit.Frame}
+
+	case *formatprocessor.UnitVP8:
+		return &formatprocessor.UnitVP8{BaseUnit: base, PTS: tunit.PTS + offset, Frame: tunit.Frame}
+
+	case *formatprocessor.UnitH265:
+		return &formatprocessor.UnitH265{BaseUnit: base, PTS: tunit.PTS + offset, AU: tunit.AU}
+
+	case *formatprocessor.UnitH264:
+		return &formatprocessor.UnitH264{BaseUnit: base, PTS: tunit.PTS + offset, AU: tunit.AU}
+
+	case *formatprocessor.UnitOpus:
+		return &formatprocessor.UnitOpus{BaseUnit: base, PTS: tunit.PTS + offset, Packets: tunit.Packets}
+
+	case *formatprocessor.UnitMPEG4AudioGeneric:
+		return &formatprocessor.UnitMPEG4AudioGeneric{BaseUnit: base, PTS: tunit.PTS + offset, AUs: tunit.AUs}
+
+	case *formatprocessor.UnitMPEG4AudioLATM:
+		return &formatprocessor.UnitMPEG4AudioLATM{BaseUnit: base, PTS: tunit.PTS + offset, AU: tunit.AU}
+
+	case *formatprocessor.UnitMPEG1Audio:
+		return &formatprocessor.UnitMPEG1Audio{BaseUnit: base, PTS: tunit.PTS + offset, Frames: tunit.Frames}
+	}
+
+	return nil
+}
+
+// pathUnitIsRandomAccess checks whether decoding can start from a unit.
+func pathUnitIsRandomAccess(unit formatprocessor.Unit) bool {
+	switch tunit := unit.(type) {
+	case *formatprocessor.UnitH264:
+		return h264.IDRPresent(tunit.AU)
+
+	case *formatprocessor.UnitH265:
+		return h265.IsRandomAccess(tunit.AU)
+	}
+
+	return true
+}
+
+// pathFallbackClock keeps timestamps of a path continuous when the stream
+// switches between the publisher and the fallback source.
+type pathFallbackClock struct {
+	mutex    sync.Mutex
+	last     time.Duration
+	lastTime time.Time
+}
+
+// pathStreamForwarder copies units from a stream to another.
+type pathStreamForwarder struct {
+	src   *stream.Stream
+	clock *pathFallbackClock
+
+	// protected by clock.mutex
+	offsetSet bool
+	offset    time.Duration
+}
+
+func newPathStreamForwarder(
+	src *stream.Stream,
+	dst *stream.Stream,
+	clock *pathFallbackClock,
+) *pathStreamForwarder {
+	f := &pathStreamForwarder{
+		src:   src,
+		clock: clock,
+	}
+
+	for _, pair := range pathMatchFormats(src.Medias(), dst.Medias()) {
+		pair := pair
+		started := false
+
+		src.AddReader(f, pair.srcMedia, pair.srcForma, func(unit formatprocessor.Unit) {
+			// wait for a random access unit, otherwise readers can't decode the new stream
+			if !started {
+				if !pathUnitIsRandomAccess(unit) {
+					return
+				}
+				started = true
+			}
+
+			unit = f.rebase(unit)
+			if unit != nil {
+				dst.WriteUnit(pair.dstMedia, pair.dstForma, unit)
+			}
+		})
+	}
+
+	return f
+}
+
+// close stops the forwarder. After it returns, no more units are written.
+func (f *pathStreamForwarder) close() {
+	f.src.RemoveReader(f)
+}
+
+func (f *pathStreamForwarder) rebase(unit formatprocessor.Unit) formatprocessor.Unit {
+	// units without timestamp can't be forwarded
+	pts, ok := pathUnitPTS(unit)
+	if !ok {
+		return nil
+	}
+
+	f.clock.mutex.Lock()
+	defer f.clock.mutex.Unlock()
+
+	// the first unit of the new stream is placed after the last unit of the previous one,
+	// plus the time elapsed between them.
+	if !f.offsetSet {
+		f.offsetSet = true
+		if !f.clock.lastTime.IsZero() {
+			f.offset = f.clock.last + time.Since(f.clock.lastTime) - pts
+		} else {
+			f.offset = -pts
+		}
+	}
+
+	if out := pts + f.offset; out > f.clock.last {
+		f.clock.last = out
+	}
+	f.clock.lastTime = time.Now()
+
+	return pathRebaseUnit(unit, f.offset)
+}
+
+type pathFallbackPathManager interface {
+	addReader(req pathAddReaderReq) pathAddReaderRes
+}
+
+// pathFallback reads the fallback path and writes it into the stream of
+// a path whose publisher is gone.
+type pathFallback struct {
+	pathName    string
+	dst         *stream.Stream
+	clock       *pathFallbackClock
+	pathManager pathFallbackPathManager
+	parent      logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+	chClose   chan struct{}
+
+	done chan struct{}
+}
+
+func newPathFallback(
+	pathName string,
+	dst *stream.Stream,
+	clock *pathFallbackClock,
+	pathManager pathFallbackPathManager,
+	parent logger.Writer,
+) *pathFallback {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	f := &pathFallback{
+		pathName:    pathName,
+		dst:         dst,
+		clock:       clock,
+		pathManager: pathManager,
+		parent:      parent,
+		ctx:         ctx,
+		ctxCancel:   ctxCancel,
+		chClose:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f
+}
+
+// Log is the main logging function.
+func (f *pathFallback) Log(level logger.Level, format string, args ...interface{}) {
+	f.parent.Log(level, "[fallback %s] "+format, append([]interface{}{f.pathName}, args...)...)
+}
+
+// stop stops the fallback and waits for it to exit.
+func (f *pathFallback) stop() {
+	f.ctxCancel()
+	<-f.done
+}
+
+// close implements reader.
+// It is called when the fallback path stops, and causes a reconnection.
+func (f *pathFallback) close() {
+	select {
+	case f.chClose <- struct{}{}:
+	default:
+	}
+}
+
+// apiReaderDescribe implements reader.
+func (f *pathFallback) apiReaderDescribe() pathAPISourceOrReader {
+	return pathAPISourceOrReader{
+		Type: "pathFallback",
+		ID:   "",
+	}
+}
+
+func (f *pathFallback) run() {
+	defer close(f.done)
+
+	for {
+		err := f.runInner()
+		if f.ctx.Err() != nil {
+			return
+		}
+
+		f.Log(logger.Warn, "%v", err)
+
+		select {
+		case <-time.After(pathFallbackRetryPause):
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *pathFallback) runInner() error {
+	// discard signals of previous connections
+	select {
+	case <-f.chClose:
+	default:
+	}
+
+	res := f.pathManager.addReader(pathAddReaderReq{
+		author:   f,
+		pathName: f.pathName,
+		skipAuth: true,
+	})
+	if res.err != nil {
+		return res.err
+	}
+
+	defer res.path.removeReader(pathRemoveReaderReq{author: f})
+
+	if len(pathMatchFormats(res.stream.Medias(), f.dst.Medias())) == 0 {
+		return fmt.Errorf("the fallback stream doesn't contain any of the codecs of the publisher")
+	}
+
+	fw := newPathStreamForwarder(res.stream, f.dst, f.clock)
+	defer fw.close()
+
+	f.Log(logger.Info, "readers switched to the fallback stream, %s", sourceMediaInfo(res.stream.Medias()))
+
+	select {
+	case <-f.chClose:
+		return fmt.Errorf("fallback path is not ready anymore")
+
+	case <-f.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
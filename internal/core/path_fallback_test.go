@@ -0,0 +1,288 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+func TestPathMediasCompatible(t *testing.T) {
+	opusMedia := &media.Media{
+		Type: media.TypeAudio,
+		Formats: []formats.Format{&formats.Opus{
+			PayloadTyp: 111,
+			IsStereo:   true,
+		}},
+	}
+
+	clone, err := pathCloneMedias(media.Medias{testMediaH264, opusMedia})
+	require.NoError(t, err)
+	require.NotSame(t, testMediaH264, clone[0])
+
+	require.Equal(t, true, pathMediasCompatible(media.Medias{testMediaH264, opusMedia}, clone))
+	require.Equal(t, false, pathMediasCompatible(media.Medias{testMediaH264}, clone))
+	require.Equal(t, false, pathMediasCompatible(media.Medias{opusMedia, opusMedia}, clone))
+}
+
+func TestPathStreamForwarder(t *testing.T) {
+	dst, err := stream.New(
+		1472,
+		media.Medias{testMediaH264},
+		true,
+		new(uint64),
+		nilLogger{},
+	)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	recv := make(chan *formatprocessor.UnitH264, 10)
+	dst.AddReader(t, testMediaH264, testFormatH264, func(unit formatprocessor.Unit) {
+		recv <- unit.(*formatprocessor.UnitH264)
+	})
+
+	clock := &pathFallbackClock{}
+
+	for i, srcPTS := range []time.Duration{10 * time.Second, 3 * time.Second} {
+		srcMedias, err := pathCloneMedias(media.Medias{testMediaH264})
+		require.NoError(t, err)
+
+		src, err := stream.New(
+			1472,
+			srcMedias,
+			true,
+			new(uint64),
+			nilLogger{},
+		)
+		require.NoError(t, err)
+
+		f := newPathStreamForwarder(src, dst, clock)
+
+		// non-IDR frames are discarded until an IDR is received
+		src.WriteUnit(srcMedias[0], srcMedias[0].Formats[0], &formatprocessor.UnitH264{
+			PTS: srcPTS,
+			AU:  [][]byte{{1, 1}},
+		})
+		src.WriteUnit(srcMedias[0], srcMedias[0].Formats[0], &formatprocessor.UnitH264{
+			PTS: srcPTS,
+			AU:  [][]byte{{5, 1}},
+		})
+		src.WriteUnit(srcMedias[0], srcMedias[0].Formats[0], &formatprocessor.UnitH264{
+			PTS: srcPTS + 100*time.Millisecond,
+			AU:  [][]byte{{1, 2}},
+		})
+
+		f.close()
+		src.Close()
+
+		u1 := <-recv
+		u2 := <-recv
+
+		if i == 0 {
+			require.Equal(t, time.Duration(0), u1.PTS)
+		} else {
+			// timestamps of the second source continue the ones of the first source
+			require.GreaterOrEqual(t, u1.PTS, 100*time.Millisecond)
+		}
+		require.Equal(t, u1.PTS+100*time.Millisecond, u2.PTS)
+		require.NotEmpty(t, u1.RTPPackets)
+	}
+
+	require.Len(t, recv, 0)
+}
+
+func writeTestIDR(t *testing.T, c *gortsplib.Client, medi *media.Media, seq uint16, id byte) {
+	err := c.WritePacketRTP(medi, &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: seq,
+			Timestamp:      uint32(seq) * 9000,
+			SSRC:           978651231,
+			Marker:         true,
+		},
+		Payload: []byte{0x05, id},
+	})
+	require.NoError(t, err)
+}
+
+func TestPathFallbackSource(t *testing.T) {
+	p, ok := newInstance("paths:\n" +
+		"  slate:\n" +
+		"  main:\n" +
+		"    fallbackSource: slate\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	slateMedias, err := pathCloneMedias(media.Medias{testMediaH264})
+	require.NoError(t, err)
+
+	slate := gortsplib.Client{}
+	err = slate.StartRecording("rtsp://localhost:8554/slate", slateMedias)
+	require.NoError(t, err)
+	defer slate.Close()
+
+	publish := func() (*gortsplib.Client, *media.Media) {
+		medias, err := pathCloneMedias(media.Medias{testMediaH264})
+		require.NoError(t, err)
+
+		c := &gortsplib.Client{}
+		err = c.StartRecording("rtsp://localhost:8554/main", medias)
+		require.NoError(t, err)
+		return c, medias[0]
+	}
+
+	pub, pubMedia := publish()
+
+	recv := make(chan []byte, 100)
+
+	reader := gortsplib.Client{}
+
+	u, err := url.Parse("rtsp://localhost:8554/main")
+	require.NoError(t, err)
+
+	err = reader.Start(u.Scheme, u.Host)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	medias, baseURL, _, err := reader.Describe(u)
+	require.NoError(t, err)
+
+	err = reader.SetupAll(medias, baseURL)
+	require.NoError(t, err)
+
+	reader.OnPacketRTP(medias[0], medias[0].Formats[0], func(pkt *rtp.Packet) {
+		select {
+		case recv <- pkt.Payload:
+		default:
+		}
+	})
+
+	_, err = reader.Play(nil)
+	require.NoError(t, err)
+
+	waitFor := func(write func(seq uint16), id byte) {
+		for seq := uint16(1); ; seq++ {
+			require.Less(t, seq, uint16(50))
+			write(seq)
+
+			select {
+			case pl := <-recv:
+				if bytes.HasSuffix(pl, []byte{0x05, id}) {
+					return
+				}
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	waitFor(func(seq uint16) { writeTestIDR(t, pub, pubMedia, seq, 1) }, 1)
+
+	// publisher disconnects: readers are switched to the fallback source
+	pub.Close()
+
+	waitFor(func(seq uint16) { writeTestIDR(t, &slate, slateMedias[0], seq, 2) }, 2)
+
+	// publisher comes back
+	pub, pubMedia = publish()
+	defer pub.Close()
+
+	waitFor(func(seq uint16) { writeTestIDR(t, pub, pubMedia, seq, 3) }, 3)
+}
+
+func TestPathBackupPublisher(t *testing.T) {
+	p, ok := newInstance("paths:\n" +
+		"  main:\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	publish := func(role string) (*gortsplib.Client, *media.Media) {
+		medias, err := pathCloneMedias(media.Medias{testMediaH264})
+		require.NoError(t, err)
+
+		c := &gortsplib.Client{}
+		err = c.StartRecording("rtsp://localhost:8554/main?role="+role, medias)
+		require.NoError(t, err)
+		return c, medias[0]
+	}
+
+	primary, primaryMedia := publish("primary")
+
+	backup, backupMedia := publish("backup")
+	defer backup.Close()
+
+	recv := make(chan []byte, 100)
+
+	reader := gortsplib.Client{}
+
+	u, err := url.Parse("rtsp://localhost:8554/main")
+	require.NoError(t, err)
+
+	err = reader.Start(u.Scheme, u.Host)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	medias, baseURL, _, err := reader.Describe(u)
+	require.NoError(t, err)
+
+	err = reader.SetupAll(medias, baseURL)
+	require.NoError(t, err)
+
+	reader.OnPacketRTP(medias[0], medias[0].Formats[0], func(pkt *rtp.Packet) {
+		select {
+		case recv <- pkt.Payload:
+		default:
+		}
+	})
+
+	_, err = reader.Play(nil)
+	require.NoError(t, err)
+
+	// waitFor writes frames until the one with the given ID is received,
+	// and checks that the frames of the other publisher are not forwarded.
+	waitFor := func(write func(seq uint16), id byte, otherID byte) {
+		for seq := uint16(1); ; seq++ {
+			require.Less(t, seq, uint16(50))
+			write(seq)
+
+			select {
+			case pl := <-recv:
+				if bytes.HasSuffix(pl, []byte{0x05, id}) {
+					for len(recv) > 0 {
+						require.False(t, bytes.HasSuffix(<-recv, []byte{0x05, otherID}))
+					}
+					return
+				}
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	waitFor(func(seq uint16) {
+		writeTestIDR(t, primary, primaryMedia, seq, 1)
+		writeTestIDR(t, backup, backupMedia, seq, 2)
+	}, 1, 2)
+
+	// primary disconnects: readers are switched to the backup
+	primary.Close()
+
+	waitFor(func(seq uint16) { writeTestIDR(t, backup, backupMedia, seq, 2) }, 2, 1)
+
+	// primary comes back
+	primary, primaryMedia = publish("primary")
+	defer primary.Close()
+
+	waitFor(func(seq uint16) {
+		writeTestIDR(t, primary, primaryMedia, seq, 3)
+		writeTestIDR(t, backup, backupMedia, seq, 2)
+	}, 3, 2)
+}
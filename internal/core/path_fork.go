@@ -0,0 +1,46 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	pathMaxForks = 100
+)
+
+// errPathPublisherFork is returned by a path when someone is already publishing
+// and duplicatePublisher is 'fork'.
+var errPathPublisherFork = errors.New("publisher must be forked")
+
+// pathForkName returns the name of the n-th fork of a path.
+func pathForkName(name string, n int) string {
+	return fmt.Sprintf("%s_%d", name, n)
+}
+
+// forkPublisher adds a publisher to the first fork of a path that is free,
+// that is <path>_2, <path>_3 and so on.
+// The publisher has already been authenticated on the requested path.
+func (pm *pathManager) forkPublisher(req pathAddPublisherReq) pathAddPublisherRes {
+	pathName := req.pathName
+	req.skipAuth = true
+
+	for n := 2; n <= pathMaxForks; n++ {
+		req.pathName = pathForkName(pathName, n)
+
+		res := pm.addPublisherToPath(req)
+		if res.err == errPathPublisherFork {
+			continue
+		}
+
+		if res.err == nil {
+			pm.Log(logger.Info, "publisher of path '%s' has been forked to path '%s'", pathName, req.pathName)
+		}
+
+		return res
+	}
+
+	return pathAddPublisherRes{err: fmt.Errorf("all forks of path '%s' are in use", pathName)}
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	pathIngestPolicyBitrateWindow = 5 * time.Second
+)
+
+// pathIngestPolicyCheckResolution checks the resolution of a video stream against the limits of a path.
+func pathIngestPolicyCheckResolution(pconf *conf.PathConf, width int, height int) error {
+	if (pconf.PublishMaxWidth != 0 && width > pconf.PublishMaxWidth) ||
+		(pconf.PublishMaxHeight != 0 && height > pconf.PublishMaxHeight) {
+		return fmt.Errorf("resolution %dx%d exceeds the maximum allowed (%dx%d)",
+			width, height, pconf.PublishMaxWidth, pconf.PublishMaxHeight)
+	}
+	return nil
+}
+
+// pathIngestPolicyH264Resolution returns the resolution contained in a H264 SPS.
+func pathIngestPolicyH264Resolution(buf []byte) (int, int, bool) {
+	var sps h264.SPS
+	err := sps.Unmarshal(buf)
+	if err != nil {
+		return 0, 0, false
+	}
+	return sps.Width(), sps.Height(), true
+}
+
+// pathIngestPolicyH265Resolution returns the resolution contained in a H265 SPS.
+func pathIngestPolicyH265Resolution(buf []byte) (int, int, bool) {
+	var sps h265.SPS
+	err := sps.Unmarshal(buf)
+	if err != nil {
+		return 0, 0, false
+	}
+	return sps.Width(), sps.Height(), true
+}
+
+// pathIngestPolicyCheckMedias checks codecs and, when the SDP contains parameters,
+// resolution of a publisher against the policy of a path.
+func pathIngestPolicyCheckMedias(pconf *conf.PathConf, medias media.Medias) error {
+	for _, medi := range medias {
+		for _, forma := range medi.Formats {
+			if len(pconf.PublishCodecs) != 0 {
+				allowed := false
+				for _, codec := range pconf.PublishCodecs {
+					if strings.EqualFold(codec, forma.Codec()) {
+						allowed = true
+						break
+					}
+				}
+				if !allowed {
+					return fmt.Errorf("codec %s is not allowed", forma.Codec())
+				}
+			}
+
+			var width, height int
+			var ok bool
+
+			switch tforma := forma.(type) {
+			case *formats.H264:
+				sps, _ := tforma.SafeParams()
+				width, height, ok = pathIngestPolicyH264Resolution(sps)
+
+			case *formats.H265:
+				_, sps, _ := tforma.SafeParams()
+				width, height, ok = pathIngestPolicyH265Resolution(sps)
+			}
+
+			if ok {
+				err := pathIngestPolicyCheckResolution(pconf, width, height)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// pathIngestPolicy checks resolution and bitrate of a publisher while it is publishing,
+// since parameters may be missing from the SDP or may change afterwards.
+// When the policy is violated, the publisher is closed or the violation is
+// reported in the API, depending on publishPolicyAction.
+type pathIngestPolicy struct {
+	conf   *conf.PathConf
+	src    *stream.Stream
+	author publisher
+	parent logger.Writer
+
+	mutex       sync.Mutex
+	bytes       uint64
+	windowStart time.Time
+	violation   string
+}
+
+func newPathIngestPolicy(
+	pconf *conf.PathConf,
+	src *stream.Stream,
+	author publisher,
+	parent logger.Writer,
+) *pathIngestPolicy {
+	p := &pathIngestPolicy{
+		conf:   pconf,
+		src:    src,
+		author: author,
+		parent: parent,
+	}
+
+	for _, medi := range src.Medias() {
+		for _, forma := range medi.Formats {
+			src.AddReader(p, medi, forma, p.onUnit)
+		}
+	}
+
+	return p
+}
+
+// close stops the policy.
+func (p *pathIngestPolicy) close() {
+	p.src.RemoveReader(p)
+}
+
+func (p *pathIngestPolicy) onUnit(unit formatprocessor.Unit) {
+	err := p.checkUnit(unit, time.Now())
+	if err != nil {
+		p.onViolation(err)
+	}
+}
+
+func (p *pathIngestPolicy) checkUnit(unit formatprocessor.Unit, now time.Time) error {
+	if p.conf.PublishMaxWidth != 0 || p.conf.PublishMaxHeight != 0 {
+		err := p.checkResolution(unit)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.conf.PublishMaxBitrate != 0 {
+		return p.checkBitrate(unit, now)
+	}
+
+	return nil
+}
+
+func (p *pathIngestPolicy) checkResolution(unit formatprocessor.Unit) error {
+	switch tunit := unit.(type) {
+	case *formatprocessor.UnitH264:
+		for _, nalu := range tunit.AU {
+			if len(nalu) != 0 && h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeSPS {
+				if width, height, ok := pathIngestPolicyH264Resolution(nalu); ok {
+					return pathIngestPolicyCheckResolution(p.conf, width, height)
+				}
+			}
+		}
+
+	case *formatprocessor.UnitH265:
+		for _, nalu := range tunit.AU {
+			if len(nalu) != 0 && h265.NALUType((nalu[0]>>1)&0b111111) == h265.NALUType_SPS_NUT {
+				if width, height, ok := pathIngestPolicyH265Resolution(nalu); ok {
+					return pathIngestPolicyCheckResolution(p.conf, width, height)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *pathIngestPolicy) checkBitrate(unit formatprocessor.Unit, now time.Time) error {
+	n := 0
+	for _, pkt := range unit.GetRTPPackets() {
+		n += len(pkt.Payload)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.windowStart.IsZero() {
+		p.windowStart = now
+	}
+
+	p.bytes += uint64(n)
+
+	elapsed := now.Sub(p.windowStart)
+	if elapsed < pathIngestPolicyBitrateWindow {
+		return nil
+	}
+
+	bitrate := int(float64(p.bytes*8) / elapsed.Seconds())
+	p.bytes = 0
+	p.windowStart = now
+
+	if bitrate > p.conf.PublishMaxBitrate {
+		return fmt.Errorf("bitrate %d exceeds the maximum allowed (%d)", bitrate, p.conf.PublishMaxBitrate)
+	}
+
+	return nil
+}
+
+// onViolation is called when a violation is found. Only the first one is handled.
+func (p *pathIngestPolicy) onViolation(err error) {
+	p.mutex.Lock()
+	if p.violation != "" {
+		p.mutex.Unlock()
+		return
+	}
+	p.violation = err.Error()
+	p.mutex.Unlock()
+
+	if p.conf.PublishPolicyAction == "reject" {
+		p.parent.Log(logger.Warn, "closing publisher: %v", err)
+		p.author.close()
+		return
+	}
+
+	p.parent.Log(logger.Warn, "publisher flagged: %v", err)
+}
+
+// apiViolation returns the violation of the policy, if any.
+func (p *pathIngestPolicy) apiViolation() *string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.violation == "" {
+		return nil
+	}
+
+	v := p.violation
+	return &v
+}
+
+// stopIngestPolicy stops checking the policy of the primary publisher.
+func (pa *path) stopIngestPolicy() {
+	if pa.ingestPolicy != nil {
+		pa.ingestPolicy.close()
+		pa.ingestPolicy = nil
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+)
+
+func TestPathIngestPolicyCheckMedias(t *testing.T) {
+	audio := &media.Media{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{&formats.Opus{PayloadTyp: 97}},
+	}
+
+	err := pathIngestPolicyCheckMedias(&conf.PathConf{
+		PublishCodecs: []string{"h264", "opus"},
+	}, media.Medias{testMediaH264, audio})
+	require.NoError(t, err)
+
+	err = pathIngestPolicyCheckMedias(&conf.PathConf{
+		PublishCodecs: []string{"H264"},
+	}, media.Medias{testMediaH264, audio})
+	require.EqualError(t, err, "codec Opus is not allowed")
+
+	err = pathIngestPolicyCheckMedias(&conf.PathConf{
+		PublishMaxWidth:  1280,
+		PublishMaxHeight: 720,
+	}, media.Medias{testMediaH264})
+	require.EqualError(t, err, "resolution 1920x1080 exceeds the maximum allowed (1280x720)")
+}
+
+func TestPathIngestPolicyCheckUnit(t *testing.T) {
+	p := &pathIngestPolicy{
+		conf: &conf.PathConf{
+			PublishMaxHeight:  720,
+			PublishMaxBitrate: 1000,
+		},
+	}
+
+	now := time.Now()
+
+	// 500 bytes in 5 seconds are 800 bits/s
+	unit := &formatprocessor.UnitH264{
+		BaseUnit: formatprocessor.BaseUnit{
+			RTPPackets: []*rtp.Packet{{Payload: make([]byte, 250)}},
+		},
+		AU: [][]byte{{0x65, 1}},
+	}
+	require.NoError(t, p.checkUnit(unit, now))
+	require.NoError(t, p.checkUnit(unit, now.Add(pathIngestPolicyBitrateWindow)))
+
+	// 1000 bytes in 5 seconds are 1600 bits/s
+	unit.RTPPackets[0].Payload = make([]byte, 1000)
+	err := p.checkUnit(unit, now.Add(2*pathIngestPolicyBitrateWindow))
+	require.EqualError(t, err, "bitrate 1600 exceeds the maximum allowed (1000)")
+
+	unit = &formatprocessor.UnitH264{
+		AU: [][]byte{testFormatH264.SPS, testFormatH264.PPS, {0x65, 1}},
+	}
+	err = p.checkUnit(unit, now.Add(2*pathIngestPolicyBitrateWindow))
+	require.EqualError(t, err, "resolution 1920x1080 exceeds the maximum allowed (0x720)")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
@@ -54,6 +55,26 @@ func getConfForPath(pathConfs map[string]*conf.PathConf, name string) (string, *
 	return "", nil, nil, fmt.Errorf("path '%s' is not configured", name)
 }
 
+type pathManagerSetReadCredsReq struct {
+	pathName string
+	creds    *roomRTSPCredentials
+}
+
+type pathManagerSetPathCredsReq struct {
+	pathName string
+	creds    *roomRTSPCredentials
+}
+
+type pathManagerRoomGeo struct {
+	geo *roomGeo
+	db  *geoIPDatabase
+}
+
+type pathManagerSetRoomGeoReq struct {
+	pathName string
+	geo      *pathManagerRoomGeo
+}
+
 type pathManagerHLSManager interface {
 	pathReady(*path)
 	pathNotReady(*path)
@@ -67,13 +88,17 @@ type pathManager struct {
 	externalAuthenticationURL string
 	rtspAddress               string
 	authMethods               conf.AuthMethods
+	authLimiter               *authLimiter
 	readTimeout               conf.StringDuration
 	writeTimeout              conf.StringDuration
 	readBufferCount           int
 	udpMaxPayloadSize         int
 	pathConfs                 map[string]*conf.PathConf
+	recordConf                roomRecordConf
 	externalCmdPool           *externalcmd.Pool
 	metrics                   *metrics
+	cluster                   *cluster
+	originAddress             string
 	parent                    pathManagerParent
 
 	ctx         context.Context
@@ -82,6 +107,17 @@ type pathManager struct {
 	hlsManager  pathManagerHLSManager
 	paths       map[string]*path
 	pathsByConf map[string]map[*path]struct{}
+	readCreds   map[string]*roomRTSPCredentials
+	pathCreds   map[string]*roomRTSPCredentials
+	roomGeos    map[string]*pathManagerRoomGeo
+
+	// paths served with low-latency HLS, read by hlsManager
+	hlsLowLatencyMutex sync.RWMutex
+	hlsLowLatency      map[string]struct{}
+
+	// DASH muxers of paths, read by the HLS server
+	dashMuxersMutex sync.RWMutex
+	dashMuxers      map[string]*dashMuxer
 
 	// in
 	chReloadConf     chan map[string]*conf.PathConf
@@ -93,6 +129,10 @@ type pathManager struct {
 	chAddReader      chan pathAddReaderReq
 	chAddPublisher   chan pathAddPublisherReq
 	chSetHLSManager  chan pathManagerHLSManager
+	chSetRecordConf  chan roomRecordConf
+	chSetReadCreds   chan pathManagerSetReadCredsReq
+	chSetPathCreds   chan pathManagerSetPathCredsReq
+	chSetRoomGeo     chan pathManagerSetRoomGeoReq
 	chAPIPathsList   chan pathAPIPathsListReq
 	chAPIPathsGet    chan pathAPIPathsGetReq
 }
@@ -101,33 +141,50 @@ func newPathManager(
 	externalAuthenticationURL string,
 	rtspAddress string,
 	authMethods conf.AuthMethods,
+	authMaxFailures int,
+	authFailuresPeriod conf.StringDuration,
+	authBanDuration conf.StringDuration,
 	readTimeout conf.StringDuration,
 	writeTimeout conf.StringDuration,
 	readBufferCount int,
 	udpMaxPayloadSize int,
 	pathConfs map[string]*conf.PathConf,
+	recordConf roomRecordConf,
 	externalCmdPool *externalcmd.Pool,
 	metrics *metrics,
+	cluster *cluster,
+	originAddress string,
 	parent pathManagerParent,
 ) *pathManager {
 	ctx, ctxCancel := context.WithCancel(context.Background())
 
+	authLimiter := newAuthLimiter(authMaxFailures, time.Duration(authFailuresPeriod), time.Duration(authBanDuration))
+
 	pm := &pathManager{
 		externalAuthenticationURL: externalAuthenticationURL,
 		rtspAddress:               rtspAddress,
 		authMethods:               authMethods,
+		authLimiter:               authLimiter,
 		readTimeout:               readTimeout,
 		writeTimeout:              writeTimeout,
 		readBufferCount:           readBufferCount,
 		udpMaxPayloadSize:         udpMaxPayloadSize,
 		pathConfs:                 pathConfs,
+		recordConf:                recordConf,
 		externalCmdPool:           externalCmdPool,
 		metrics:                   metrics,
+		cluster:                   cluster,
+		originAddress:             originAddress,
 		parent:                    parent,
 		ctx:                       ctx,
 		ctxCancel:                 ctxCancel,
 		paths:                     make(map[string]*path),
 		pathsByConf:               make(map[string]map[*path]struct{}),
+		readCreds:                 make(map[string]*roomRTSPCredentials),
+		pathCreds:                 make(map[string]*roomRTSPCredentials),
+		roomGeos:                  make(map[string]*pathManagerRoomGeo),
+		hlsLowLatency:             make(map[string]struct{}),
+		dashMuxers:                make(map[string]*dashMuxer),
 		chReloadConf:              make(chan map[string]*conf.PathConf),
 		chClosePath:               make(chan *path),
 		chPathReady:               make(chan *path),
@@ -137,6 +194,10 @@ func newPathManager(
 		chAddReader:               make(chan pathAddReaderReq),
 		chAddPublisher:            make(chan pathAddPublisherReq),
 		chSetHLSManager:           make(chan pathManagerHLSManager),
+		chSetRecordConf:           make(chan roomRecordConf),
+		chSetReadCreds:            make(chan pathManagerSetReadCredsReq),
+		chSetPathCreds:            make(chan pathManagerSetPathCredsReq),
+		chSetRoomGeo:              make(chan pathManagerSetRoomGeoReq),
 		chAPIPathsList:            make(chan pathAPIPathsListReq),
 		chAPIPathsGet:             make(chan pathAPIPathsGetReq),
 	}
@@ -223,11 +284,20 @@ outer:
 				pm.hlsManager.pathReady(pa)
 			}
 
+			// paths relayed from other nodes are not announced
+			if pm.cluster != nil && pa.safeConf().Source != "cluster" {
+				pm.cluster.pathReady(pa.name)
+			}
+
 		case pa := <-pm.chPathNotReady:
 			if pm.hlsManager != nil {
 				pm.hlsManager.pathNotReady(pa)
 			}
 
+			if pm.cluster != nil && pa.safeConf().Source != "cluster" {
+				pm.cluster.pathNotReady(pa.name)
+			}
+
 		case req := <-pm.chGetConfForPath:
 			_, pathConf, _, err := getConfForPath(pm.pathConfs, req.name)
 			if err != nil {
@@ -235,8 +305,7 @@ outer:
 				continue
 			}
 
-			err = doAuthentication(pm.externalAuthenticationURL, pm.authMethods,
-				req.name, pathConf, req.publish, req.credentials)
+			err = pm.authenticate(req.name, pathConf, req.publish, req.credentials)
 			if err != nil {
 				req.res <- pathGetConfForPathRes{err: err}
 				continue
@@ -251,7 +320,7 @@ outer:
 				continue
 			}
 
-			err = doAuthentication(pm.externalAuthenticationURL, pm.authMethods, req.pathName, pathConf, false, req.credentials)
+			err = pm.authenticate(req.pathName, pathConf, false, req.credentials)
 			if err != nil {
 				req.res <- pathDescribeRes{err: err}
 				continue
@@ -272,7 +341,7 @@ outer:
 			}
 
 			if !req.skipAuth {
-				err = doAuthentication(pm.externalAuthenticationURL, pm.authMethods, req.pathName, pathConf, false, req.credentials)
+				err = pm.authenticate(req.pathName, pathConf, false, req.credentials)
 				if err != nil {
 					req.res <- pathAddReaderRes{err: err}
 					continue
@@ -294,7 +363,7 @@ outer:
 			}
 
 			if !req.skipAuth {
-				err = doAuthentication(pm.externalAuthenticationURL, pm.authMethods, req.pathName, pathConf, true, req.credentials)
+				err = pm.authenticate(req.pathName, pathConf, true, req.credentials)
 				if err != nil {
 					req.res <- pathAddPublisherRes{err: err}
 					continue
@@ -311,6 +380,30 @@ outer:
 		case s := <-pm.chSetHLSManager:
 			pm.hlsManager = s
 
+		case rc := <-pm.chSetRecordConf:
+			pm.recordConf = rc
+
+		case req := <-pm.chSetReadCreds:
+			if req.creds != nil {
+				pm.readCreds[req.pathName] = req.creds
+			} else {
+				delete(pm.readCreds, req.pathName)
+			}
+
+		case req := <-pm.chSetPathCreds:
+			if req.creds != nil {
+				pm.pathCreds[req.pathName] = req.creds
+			} else {
+				delete(pm.pathCreds, req.pathName)
+			}
+
+		case req := <-pm.chSetRoomGeo:
+			if req.geo != nil {
+				pm.roomGeos[req.pathName] = req.geo
+			} else {
+				delete(pm.roomGeos, req.pathName)
+			}
+
 		case req := <-pm.chAPIPathsList:
 			paths := make(map[string]*path)
 
@@ -354,12 +447,15 @@ func (pm *pathManager) createPath(
 		pm.writeTimeout,
 		pm.readBufferCount,
 		pm.udpMaxPayloadSize,
+		pm.recordConf,
 		pathConfName,
 		pathConf,
 		name,
 		matches,
 		&pm.wg,
 		pm.externalCmdPool,
+		pm.cluster,
+		pm.originAddress,
 		pm)
 
 	pm.paths[name] = pa
@@ -450,6 +546,14 @@ func (pm *pathManager) describe(req pathDescribeReq) pathDescribeRes {
 
 // addPublisher is called by a publisher.
 func (pm *pathManager) addPublisher(req pathAddPublisherReq) pathAddPublisherRes {
+	res := pm.addPublisherToPath(req)
+	if res.err == errPathPublisherFork {
+		return pm.forkPublisher(req)
+	}
+	return res
+}
+
+func (pm *pathManager) addPublisherToPath(req pathAddPublisherReq) pathAddPublisherRes {
 	req.res = make(chan pathAddPublisherRes)
 	select {
 	case pm.chAddPublisher <- req:
@@ -490,6 +594,155 @@ func (pm *pathManager) setHLSManager(s pathManagerHLSManager) {
 	}
 }
 
+// setRecordConf is called by core.
+// It applies to paths created after the call.
+func (pm *pathManager) setRecordConf(rc roomRecordConf) {
+	select {
+	case pm.chSetRecordConf <- rc:
+	case <-pm.ctx.Done():
+	}
+}
+
+// setReadCredentials sets the credentials that readers of a path must provide
+// with every protocol, instead of the ones of the path configuration.
+// Nil credentials remove them.
+func (pm *pathManager) setReadCredentials(pathName string, creds *roomRTSPCredentials) {
+	select {
+	case pm.chSetReadCreds <- pathManagerSetReadCredsReq{pathName: pathName, creds: creds}:
+	case <-pm.ctx.Done():
+	}
+}
+
+// setPathCredentials sets the credentials that both readers and publishers of a path
+// must provide with every protocol, instead of the ones of the path configuration.
+// Nil credentials remove them.
+func (pm *pathManager) setPathCredentials(pathName string, creds *roomRTSPCredentials) {
+	select {
+	case pm.chSetPathCreds <- pathManagerSetPathCredsReq{pathName: pathName, creds: creds}:
+	case <-pm.ctx.Done():
+	}
+}
+
+// setRoomGeo sets the geographic restrictions of the room that owns a path,
+// that are applied to clients of every protocol. Nil restrictions remove them.
+func (pm *pathManager) setRoomGeo(pathName string, geo *roomGeo, db *geoIPDatabase) {
+	req := pathManagerSetRoomGeoReq{pathName: pathName}
+	if geo != nil {
+		req.geo = &pathManagerRoomGeo{geo: geo, db: db}
+	}
+
+	select {
+	case pm.chSetRoomGeo <- req:
+	case <-pm.ctx.Done():
+	}
+}
+
+// setHLSLowLatency sets whether a path is served with low-latency HLS,
+// regardless of hlsVariant.
+func (pm *pathManager) setHLSLowLatency(pathName string, enabled bool) {
+	pm.hlsLowLatencyMutex.Lock()
+	defer pm.hlsLowLatencyMutex.Unlock()
+
+	if enabled {
+		pm.hlsLowLatency[pathName] = struct{}{}
+	} else {
+		delete(pm.hlsLowLatency, pathName)
+	}
+}
+
+// isHLSLowLatency checks whether a path is served with low-latency HLS, regardless of hlsVariant.
+func (pm *pathManager) isHLSLowLatency(pathName string) bool {
+	pm.hlsLowLatencyMutex.RLock()
+	defer pm.hlsLowLatencyMutex.RUnlock()
+
+	_, ok := pm.hlsLowLatency[pathName]
+	return ok
+}
+
+// setDASHMuxer sets the DASH muxer of a path. A nil muxer removes it.
+func (pm *pathManager) setDASHMuxer(pathName string, m *dashMuxer) {
+	pm.dashMuxersMutex.Lock()
+	defer pm.dashMuxersMutex.Unlock()
+
+	if m != nil {
+		pm.dashMuxers[pathName] = m
+	} else {
+		delete(pm.dashMuxers, pathName)
+	}
+}
+
+// getDASHMuxer returns the DASH muxer of a path, if any.
+func (pm *pathManager) getDASHMuxer(pathName string) *dashMuxer {
+	pm.dashMuxersMutex.RLock()
+	defer pm.dashMuxersMutex.RUnlock()
+
+	return pm.dashMuxers[pathName]
+}
+
+// authenticate authenticates a client and bans its IP
+// when it fails authentication too many times.
+func (pm *pathManager) authenticate(
+	pathName string,
+	pathConf *conf.PathConf,
+	publish bool,
+	credentials authCredentials,
+) error {
+	ip := credentials.ip.String()
+
+	if creds, ok := pm.readCreds[pathName]; ok && !publish {
+		clone := *pathConf
+		clone.ReadUser = conf.Credential(creds.user)
+		clone.ReadPass = conf.Credential(creds.pass)
+		pathConf = &clone
+	}
+
+	if creds, ok := pm.pathCreds[pathName]; ok {
+		clone := *pathConf
+		clone.ReadUser = conf.Credential(creds.user)
+		clone.ReadPass = conf.Credential(creds.pass)
+		clone.PublishUser = conf.Credential(creds.user)
+		clone.PublishPass = conf.Credential(creds.pass)
+		pathConf = &clone
+	}
+
+	if pm.authLimiter.banned(ip) {
+		return &errAuthentication{message: fmt.Sprintf("IP %s is banned because of too many authentication failures", ip)}
+	}
+
+	// internal workers, like the one of audio mixes, connect through the loopback interface
+	if g, ok := pm.roomGeos[pathName]; ok && !credentials.ip.IsLoopback() {
+		err := g.geo.check(credentials.ip, g.db)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := doAuthentication(pm.externalAuthenticationURL, pm.authMethods, pathName, pathConf, publish, credentials)
+	if err != nil {
+		// requests without credentials are used to ask for them
+		if _, ok := err.(*errAuthentication); ok && credentials.provided() {
+			if pm.authLimiter.onFailure(ip) {
+				pm.Log(logger.Warn, "IP %s has been banned for %v because of too many authentication failures",
+					ip, pm.authLimiter.banDuration)
+			}
+		}
+		return err
+	}
+
+	pm.authLimiter.onSuccess(ip)
+	return nil
+}
+
+// apiAuthBansList is called by api.
+func (pm *pathManager) apiAuthBansList() (*apiAuthBansList, error) {
+	return pm.authLimiter.apiBansList(), nil
+}
+
+// apiAuthBansDelete is called by api.
+func (pm *pathManager) apiAuthBansDelete(ip string) error {
+	return pm.authLimiter.apiBansDelete(ip)
+}
+
 // apiPathsList is called by api.
 func (pm *pathManager) apiPathsList() (*apiPathsList, error) {
 	req := pathAPIPathsListReq{
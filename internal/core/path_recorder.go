@@ -0,0 +1,227 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	pathRecorderFileExt = ".mp4"
+)
+
+// pathRecordFileName fills the variables of a recordPath.
+// The resulting file must be inside the directory that precedes the first variable.
+func pathRecordFileName(format string, pathName string, t time.Time) (string, error) {
+	err := conf.IsValidPathName(pathName)
+	if err != nil {
+		return "", fmt.Errorf("invalid path name: %v", err)
+	}
+
+	filename := strings.NewReplacer(
+		"%path", pathName,
+		"%Y", strconv.Itoa(t.Year()),
+		"%m", fmt.Sprintf("%02d", int(t.Month())),
+		"%d", fmt.Sprintf("%02d", t.Day()),
+		"%H", fmt.Sprintf("%02d", t.Hour()),
+		"%M", fmt.Sprintf("%02d", t.Minute()),
+		"%S", fmt.Sprintf("%02d", t.Second()),
+		"%f", fmt.Sprintf("%06d", t.Nanosecond()/1000),
+	).Replace(format) + pathRecorderFileExt
+
+	if !recordPathContains(recordPathRoot(format), filename) {
+		return "", fmt.Errorf("path '%s' is outside the record path", pathName)
+	}
+
+	return filename, nil
+}
+
+// pathRecordObjectKey returns the key of an uploaded segment.
+func pathRecordObjectKey(filename string) (string, error) {
+	key := strings.TrimLeft(filepath.ToSlash(filepath.Clean(filename)), "/")
+
+	for _, elem := range strings.Split(key, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("segment '%s' is outside the record path", filename)
+		}
+	}
+
+	return key, nil
+}
+
+type pathRecorderSegment struct {
+	filename string
+	f        *os.File
+}
+
+// pathRecorder writes the segments of a fmp4Segmenter to disk
+// and, when a bucket is set, uploads them.
+type pathRecorder struct {
+	recordPath string
+	maxAge     time.Duration
+	bucket     string
+	pathName   string
+	parent     logger.Writer
+
+	storage        recordStorage
+	currentSegment *pathRecorderSegment
+	uploads        sync.WaitGroup
+}
+
+// newPathRecorder allocates a pathRecorder,
+// that must be added to a fmp4Segmenter with addOutput().
+func newPathRecorder(
+	recordPath string,
+	maxAge time.Duration,
+	bucket string,
+	recordConf roomRecordConf,
+	pathName string,
+	parent logger.Writer,
+) *pathRecorder {
+	r := &pathRecorder{
+		recordPath: recordPath,
+		maxAge:     maxAge,
+		bucket:     bucket,
+		pathName:   pathName,
+		parent:     parent,
+	}
+
+	if bucket != "" {
+		var err error
+		r.storage, err = newRecordStorage(context.Background(), recordConf)
+		if err != nil {
+			r.Log(logger.Warn, "unable to create storage client, segments will be kept on disk: %v", err)
+		}
+	}
+
+	if r.maxAge != 0 {
+		r.deleteExpired()
+	}
+
+	return r
+}
+
+// close waits for pending uploads.
+// It must be called after the segmenter has been closed.
+func (r *pathRecorder) close() {
+	r.uploads.Wait()
+}
+
+// Log is the main logging function.
+func (r *pathRecorder) Log(level logger.Level, format string, args ...interface{}) {
+	r.parent.Log(level, "[recorder] "+format, args...)
+}
+
+// segmentOpen implements fmp4SegmenterSink.
+func (r *pathRecorder) segmentOpen(_ *fmp4.Init, initBytes []byte, _ time.Duration) error {
+	filename, err := pathRecordFileName(r.recordPath, r.pathName, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(initBytes)
+	if err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+
+	r.Log(logger.Debug, "opening segment '%s'", filename)
+
+	r.currentSegment = &pathRecorderSegment{
+		filename: filename,
+		f:        f,
+	}
+
+	return nil
+}
+
+// segmentPart implements fmp4SegmenterSink.
+func (r *pathRecorder) segmentPart(part []byte) error {
+	_, err := r.currentSegment.f.Write(part)
+	return err
+}
+
+// segmentClose implements fmp4SegmenterSink.
+func (r *pathRecorder) segmentClose(_ time.Duration) error {
+	seg := r.currentSegment
+	r.currentSegment = nil
+
+	err := seg.f.Close()
+	if err != nil {
+		return err
+	}
+
+	r.Log(logger.Debug, "closing segment '%s'", seg.filename)
+
+	if r.storage != nil {
+		r.uploads.Add(1)
+		go r.upload(seg.filename)
+	}
+
+	if r.maxAge != 0 {
+		r.deleteExpired()
+	}
+
+	return nil
+}
+
+// deleteExpired deletes segments older than maxAge.
+func (r *pathRecorder) deleteExpired() {
+	segments, err := playbackFindSegments(r.recordPath, r.pathName)
+	if err != nil {
+		r.Log(logger.Warn, "unable to find expired segments: %v", err)
+		return
+	}
+
+	for _, seg := range segments {
+		if time.Since(seg.start) > r.maxAge {
+			os.Remove(seg.filename)
+		}
+	}
+}
+
+func (r *pathRecorder) upload(filename string) {
+	defer r.uploads.Done()
+
+	key, err := pathRecordObjectKey(filename)
+	if err != nil {
+		r.Log(logger.Warn, "unable to upload '%s': %v", filename, err)
+		return
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		r.Log(logger.Warn, "unable to upload '%s': %v", filename, err)
+		return
+	}
+
+	err = r.storage.UploadObject(r.bucket, key, f, "")
+	f.Close()
+	if err != nil {
+		r.Log(logger.Warn, "unable to upload '%s': %v", filename, err)
+		return
+	}
+
+	os.Remove(filename)
+}
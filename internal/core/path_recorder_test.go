@@ -0,0 +1,129 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+func TestPathRecordFileName(t *testing.T) {
+	filename, err := pathRecordFileName("./recordings/%path/%Y-%m-%d_%H-%M-%S-%f", "mypath",
+		time.Date(2023, 5, 1, 10, 4, 9, 500000, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, "./recordings/mypath/2023-05-01_10-04-09-000500.mp4", filename)
+
+	_, err = pathRecordFileName("./recordings/%path/%Y-%m-%d_%H-%M-%S-%f", "a/../../../tmp/x",
+		time.Date(2023, 5, 1, 10, 4, 9, 500000, time.UTC))
+	require.EqualError(t, err, "invalid path name: can't contain '..' elements")
+
+	key, err := pathRecordObjectKey("./recordings/mypath/seg.mp4")
+	require.NoError(t, err)
+	require.Equal(t, "recordings/mypath/seg.mp4", key)
+
+	key, err = pathRecordObjectKey("/data/mypath/seg.mp4")
+	require.NoError(t, err)
+	require.Equal(t, "data/mypath/seg.mp4", key)
+
+	_, err = pathRecordObjectKey("recordings/../../tmp/seg.mp4")
+	require.Error(t, err)
+}
+
+// writeTestRecording records 1.2 seconds of H264 and MPEG-4 Audio
+// into segments of 500ms.
+func writeTestRecording(t *testing.T, recordPath string) {
+	audioFormat := &formats.MPEG4AudioGeneric{
+		PayloadTyp: 96,
+		Config: &mpeg4audio.Config{
+			Type:         2,
+			SampleRate:   44100,
+			ChannelCount: 2,
+		},
+		SizeLength:       13,
+		IndexLength:      3,
+		IndexDeltaLength: 3,
+	}
+	audioMedia := &media.Media{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{audioFormat},
+	}
+
+	stream, err := stream.New(
+		1472,
+		media.Medias{testMediaH264, audioMedia},
+		true,
+		new(uint64),
+		nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	r := newPathRecorder(
+		recordPath,
+		0,
+		"",
+		roomRecordConf{},
+		"mypath",
+		nilLogger{},
+	)
+
+	sg := newFMP4Segmenter(1024, 100*time.Millisecond, stream, nilLogger{})
+	sg.addOutput(r, 500*time.Millisecond)
+	sg.start()
+
+	for i := 0; i < 12; i++ {
+		stream.WriteUnit(testMediaH264, testFormatH264, &formatprocessor.UnitH264{
+			PTS: time.Duration(i) * 100 * time.Millisecond,
+			AU: [][]byte{
+				{5, 1}, // IDR
+			},
+		})
+
+		stream.WriteUnit(audioMedia, audioFormat, &formatprocessor.UnitMPEG4AudioGeneric{
+			PTS: time.Duration(i) * 100 * time.Millisecond,
+			AUs: [][]byte{{1, 2, 3, 4}},
+		})
+
+		// segment names have a resolution of one microsecond
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sg.close()
+	r.close()
+}
+
+func TestPathRecorder(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-path-recorder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestRecording(t, filepath.Join(dir, "%path", "%Y-%m-%d_%H-%M-%S-%f"))
+
+	files, err := os.ReadDir(filepath.Join(dir, "mypath"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	for _, f := range files {
+		byts, err := os.ReadFile(filepath.Join(dir, "mypath", f.Name()))
+		require.NoError(t, err)
+
+		var init fmp4.Init
+		err = init.Unmarshal(byts)
+		require.NoError(t, err)
+		require.Len(t, init.Tracks, 2)
+		require.Equal(t, &fmp4.CodecH264{
+			SPS: testFormatH264.SPS,
+			PPS: testFormatH264.PPS,
+		}, init.Tracks[0].Codec)
+		require.Equal(t, uint32(44100), init.Tracks[1].TimeScale)
+	}
+}
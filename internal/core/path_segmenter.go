@@ -0,0 +1,83 @@
+package core
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// pathSegmenterPartDuration returns the duration of the fragments produced by the segmenter,
+// that is the shortest among the durations required by the enabled outputs.
+func pathSegmenterPartDuration(pconf *conf.PathConf) time.Duration {
+	var partDuration time.Duration
+
+	for _, out := range []struct {
+		enabled  bool
+		duration conf.StringDuration
+	}{
+		{pconf.Record, pconf.RecordPartDuration},
+		{pconf.DASH, pconf.DASHSegmentDuration},
+	} {
+		if out.enabled && (partDuration == 0 || time.Duration(out.duration) < partDuration) {
+			partDuration = time.Duration(out.duration)
+		}
+	}
+
+	return partDuration
+}
+
+// startSegmenter starts the fMP4 segmenter of the path, that produces
+// the CMAF fragments shared by the recorder and the DASH muxer,
+// in order to demux and mux the stream once regardless of the enabled outputs.
+// HLS is served by gohlslib, that has its own muxer.
+func (pa *path) startSegmenter() {
+	pa.segmenter = newFMP4Segmenter(
+		pa.readBufferCount,
+		pathSegmenterPartDuration(pa.conf),
+		pa.stream,
+		pa,
+	)
+
+	if pa.conf.Record {
+		pa.recorder = newPathRecorder(
+			pa.conf.RecordPath,
+			0,
+			pa.conf.RecordBucket,
+			pa.recordConf,
+			pa.name,
+			pa,
+		)
+		pa.segmenter.addOutput(pa.recorder, time.Duration(pa.conf.RecordSegmentDuration))
+	}
+
+	if pa.conf.DASH {
+		pa.dashMuxer = newDASHMuxer(
+			time.Duration(pa.conf.DASHSegmentDuration),
+			pa.conf.DASHSegmentCount,
+			pa,
+		)
+		pa.segmenter.addOutput(pa.dashMuxer, time.Duration(pa.conf.DASHSegmentDuration))
+		pa.parent.setDASHMuxer(pa.name, pa.dashMuxer)
+	}
+
+	pa.segmenter.start()
+}
+
+func (pa *path) stopSegmenter() {
+	if pa.dashMuxer != nil {
+		pa.parent.setDASHMuxer(pa.name, nil)
+	}
+
+	pa.segmenter.close()
+	pa.segmenter = nil
+
+	if pa.recorder != nil {
+		pa.recorder.close()
+		pa.recorder = nil
+	}
+
+	if pa.dashMuxer != nil {
+		pa.dashMuxer.close()
+		pa.dashMuxer = nil
+	}
+}
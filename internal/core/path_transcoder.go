@@ -0,0 +1,40 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// pathTranscodeAACCommand is the FFmpeg worker that converts audio to AAC.
+// It reads and publishes through the RTSP server.
+const pathTranscodeAACCommand = "ffmpeg -hide_banner -loglevel error" +
+	" -rtsp_transport tcp -i rtsp://127.0.0.1:$RTSP_PORT/$MTX_PATH" +
+	" -map 0 -c:v copy -c:a aac -b:a 128k -ar 48000" +
+	" -f rtsp -rtsp_transport tcp rtsp://127.0.0.1:$RTSP_PORT/$MTX_TRANSCODE_PATH"
+
+// pathNeedsAACTranscode checks whether a stream contains Opus audio
+// and no MPEG-4 Audio, that is required by RTMP and most HLS players.
+func pathNeedsAACTranscode(medias media.Medias) bool {
+	hasOpus := false
+
+	for _, medi := range medias {
+		for _, forma := range medi.Formats {
+			switch forma.(type) {
+			case *formats.Opus:
+				hasOpus = true
+
+			case *formats.MPEG4AudioGeneric, *formats.MPEG4AudioLATM:
+				return false
+			}
+		}
+	}
+
+	return hasOpus
+}
+
+// pathTranscodePath returns the path in which the transcoded stream is published.
+func pathTranscodePath(format string, pathName string) string {
+	return strings.ReplaceAll(format, "%path", pathName)
+}
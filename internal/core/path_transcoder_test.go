@@ -0,0 +1,49 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathNeedsAACTranscode(t *testing.T) {
+	videoMedia := &media.Media{
+		Type:    media.TypeVideo,
+		Formats: []formats.Format{&formats.H264{PayloadTyp: 96, PacketizationMode: 1}},
+	}
+	opusMedia := &media.Media{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{&formats.Opus{PayloadTyp: 111, IsStereo: true}},
+	}
+	aacMedia := &media.Media{
+		Type: media.TypeAudio,
+		Formats: []formats.Format{&formats.MPEG4Audio{
+			PayloadTyp:       97,
+			SizeLength:       13,
+			IndexLength:      3,
+			IndexDeltaLength: 3,
+		}},
+	}
+
+	for _, ca := range []struct {
+		name   string
+		medias media.Medias
+		needed bool
+	}{
+		{"video only", media.Medias{videoMedia}, false},
+		{"opus", media.Medias{videoMedia, opusMedia}, true},
+		{"aac", media.Medias{videoMedia, aacMedia}, false},
+		{"opus and aac", media.Medias{opusMedia, aacMedia}, false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.needed, pathNeedsAACTranscode(ca.medias))
+		})
+	}
+}
+
+func TestPathTranscodePath(t *testing.T) {
+	require.Equal(t, "room/cam1_aac", pathTranscodePath("%path_aac", "room/cam1"))
+	require.Equal(t, "aac/room/cam1", pathTranscodePath("aac/%path", "room/cam1"))
+}
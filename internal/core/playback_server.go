@@ -0,0 +1,471 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aler9/writerseeker"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/httpserv"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	playbackMaxDrift = 5 * time.Second
+)
+
+func durationMp4ToGo(v uint64, timeScale uint32) time.Duration {
+	timeScale64 := uint64(timeScale)
+	secs := v / timeScale64
+	dec := v % timeScale64
+	return time.Duration(secs)*time.Second + time.Duration(dec)*time.Second/time.Duration(timeScale64)
+}
+
+// pathRecordFileRegexp returns a regexp that matches segments of a path
+// generated with pathRecordFileName.
+func pathRecordFileRegexp(format string, pathName string) *regexp.Regexp {
+	format = filepath.Clean(strings.ReplaceAll(format, "%path", pathName)) + pathRecorderFileExt
+
+	re := strings.NewReplacer(
+		"%Y", `(?P<Y>\d{4})`,
+		"%m", `(?P<m>\d{2})`,
+		"%d", `(?P<d>\d{2})`,
+		"%H", `(?P<H>\d{2})`,
+		"%M", `(?P<M>\d{2})`,
+		"%S", `(?P<S>\d{2})`,
+		"%f", `(?P<f>\d{6})`,
+	).Replace(regexp.QuoteMeta(format))
+
+	return regexp.MustCompile("^" + re + "$")
+}
+
+// recordPathRoot returns the directory that precedes the first variable of a record path.
+func recordPathRoot(format string) string {
+	if i := strings.Index(format, "%"); i >= 0 {
+		format = format[:i]
+	}
+	return filepath.Dir(format + "x")
+}
+
+// recordPathContains checks whether a path is inside a directory.
+func recordPathContains(root string, fpath string) bool {
+	rel, err := filepath.Rel(root, fpath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+type playbackSegment struct {
+	filename string
+	start    time.Time
+}
+
+// playbackFindSegments returns the segments of a path, sorted by date.
+func playbackFindSegments(format string, pathName string) ([]*playbackSegment, error) {
+	err := conf.IsValidPathName(pathName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path name: %v", err)
+	}
+
+	re := pathRecordFileRegexp(format, pathName)
+
+	// walk the directory that precedes the first variable
+	root := recordPathRoot(strings.ReplaceAll(format, "%path", pathName))
+	if !recordPathContains(recordPathRoot(format), root) {
+		return nil, fmt.Errorf("path '%s' is outside the record path", pathName)
+	}
+
+	var segments []*playbackSegment
+
+	err = filepath.WalkDir(root, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		m := re.FindStringSubmatch(fpath)
+		if m == nil {
+			return nil
+		}
+
+		values := map[string]int{"Y": 1970, "m": 1, "d": 1}
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				values[name], _ = strconv.Atoi(m[i])
+			}
+		}
+
+		segments = append(segments, &playbackSegment{
+			filename: fpath,
+			start: time.Date(values["Y"], time.Month(values["m"]), values["d"],
+				values["H"], values["M"], values["S"], values["f"]*1000, time.Local),
+		})
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].start.Before(segments[j].start)
+	})
+
+	return segments, nil
+}
+
+// playbackSelectSegments returns the segments that contain samples
+// between start and start+duration.
+func playbackSelectSegments(
+	segments []*playbackSegment,
+	start time.Time,
+	duration time.Duration,
+) []*playbackSegment {
+	end := start.Add(duration)
+	var ret []*playbackSegment
+
+	for i, seg := range segments {
+		if !seg.start.Before(end) {
+			break
+		}
+
+		if i == len(segments)-1 || segments[i+1].start.After(start) {
+			ret = append(ret, seg)
+		}
+	}
+
+	return ret
+}
+
+func playbackWriteBox(w io.Writer, m interface{ Marshal(io.WriteSeeker) error }) error {
+	var ws writerseeker.WriterSeeker
+	err := m.Marshal(&ws)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(ws.Bytes())
+	return err
+}
+
+// playbackReadSegment reads the tracks and the parts of a segment.
+func playbackReadSegment(filename string) (*fmp4.Init, fmp4.Parts, error) {
+	byts, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var init fmp4.Init
+	err = init.Unmarshal(byts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts)
+	if err != nil && parts != nil {
+		// the last part of a segment that is being recorded
+		// may be incomplete.
+		parts = parts[:len(parts)-1]
+	}
+
+	return &init, parts, nil
+}
+
+// playbackSegmentStartDTS returns the DTS of the first sample of a segment,
+// that was recorded at the date in the segment name.
+func playbackSegmentStartDTS(init *fmp4.Init, parts fmp4.Parts) time.Duration {
+	var startDTS time.Duration
+
+	for i, pt := range parts[0].Tracks {
+		for _, track := range init.Tracks {
+			if track.ID == pt.ID {
+				dts := durationMp4ToGo(pt.BaseTime, track.TimeScale)
+				if i == 0 || dts < startDTS {
+					startDTS = dts
+				}
+			}
+		}
+	}
+
+	return startDTS
+}
+
+// playbackTimeline maps DTS of samples to the date in which they were recorded.
+// DTS of segments written by the same recorder are contiguous, therefore dates are
+// computed from the first segment, unless they drift too much from segment names,
+// that happens when a new recording starts.
+type playbackTimeline struct {
+	set        bool
+	anchorDate time.Time
+	anchorDTS  time.Duration
+	last       time.Time
+}
+
+func (tl *playbackTimeline) addSegment(seg *playbackSegment, startDTS time.Duration) {
+	if tl.set {
+		drift := tl.anchorDate.Add(startDTS - tl.anchorDTS).Sub(seg.start)
+		if drift >= -playbackMaxDrift && drift <= playbackMaxDrift {
+			return
+		}
+	}
+
+	tl.set = true
+	tl.anchorDate = seg.start
+	tl.anchorDTS = startDTS
+
+	// dates never go back
+	if tl.anchorDate.Before(tl.last) {
+		tl.anchorDate = tl.last
+	}
+}
+
+func (tl *playbackTimeline) date(dts time.Duration) time.Time {
+	t := tl.anchorDate.Add(dts - tl.anchorDTS)
+	if t.After(tl.last) {
+		tl.last = t
+	}
+	return t
+}
+
+// playbackRemux writes to w a fMP4 file that contains the samples of segments
+// between start and start+duration. Timestamps of the output start from zero.
+// Segments that have different tracks than the first one are skipped.
+func playbackRemux(
+	w io.Writer,
+	segments []*playbackSegment,
+	start time.Time,
+	duration time.Duration,
+) error {
+	end := start.Add(duration)
+	var init *fmp4.Init
+	started := make(map[int]struct{})
+	var timeline playbackTimeline
+
+	for _, seg := range segments {
+		segInit, parts, err := playbackReadSegment(seg.filename)
+		if err != nil {
+			return err
+		}
+
+		if init == nil {
+			init = segInit
+
+			err = playbackWriteBox(w, init)
+			if err != nil {
+				return err
+			}
+		} else if !reflect.DeepEqual(init, segInit) {
+			continue
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+
+		tracks := make(map[int]*fmp4.InitTrack)
+		for _, track := range init.Tracks {
+			tracks[track.ID] = track
+		}
+
+		timeline.addSegment(seg, playbackSegmentStartDTS(init, parts))
+
+		for _, part := range parts {
+			outPart := &fmp4.Part{}
+
+			for _, pt := range part.Tracks {
+				// segments may be corrupted
+				track, ok := tracks[pt.ID]
+				if !ok {
+					continue
+				}
+
+				dts := durationMp4ToGo(pt.BaseTime, track.TimeScale)
+				var outTrack *fmp4.PartTrack
+
+				for _, sample := range pt.Samples {
+					t := timeline.date(dts)
+					dts += durationMp4ToGo(uint64(sample.Duration), track.TimeScale)
+
+					if t.Before(start) || !t.Before(end) {
+						continue
+					}
+
+					// video starts with a key frame
+					if _, ok := started[pt.ID]; !ok {
+						if track.Codec.IsVideo() && sample.IsNonSyncSample {
+							continue
+						}
+						started[pt.ID] = struct{}{}
+					}
+
+					if outTrack == nil {
+						outTrack = &fmp4.PartTrack{
+							ID:       pt.ID,
+							BaseTime: durationGoToMp4(t.Sub(start), track.TimeScale),
+						}
+						outPart.Tracks = append(outPart.Tracks, outTrack)
+					}
+
+					outTrack.Samples = append(outTrack.Samples, sample)
+				}
+			}
+
+			if outPart.Tracks != nil {
+				err = playbackWriteBox(w, outPart)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+type playbackServerParent interface {
+	logger.Writer
+}
+
+type playbackServer struct {
+	pathManager *pathManager
+	parent      playbackServerParent
+
+	httpServer *httpserv.WrappedServer
+}
+
+func newPlaybackServer(
+	address string,
+	readTimeout conf.StringDuration,
+	pathManager *pathManager,
+	parent playbackServerParent,
+) (*playbackServer, error) {
+	s := &playbackServer{
+		pathManager: pathManager,
+		parent:      parent,
+	}
+
+	router := gin.New()
+	router.SetTrustedProxies(nil) //nolint:errcheck
+
+	router.GET("/playback", s.onGet)
+
+	network, address := restrictNetwork("tcp", address)
+
+	var err error
+	s.httpServer, err = httpserv.NewWrappedServer(
+		network,
+		address,
+		time.Duration(readTimeout),
+		"",
+		"",
+		"",
+		router,
+		s,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log(logger.Info, "listener opened on "+address)
+
+	return s, nil
+}
+
+func (s *playbackServer) close() {
+	s.Log(logger.Info, "listener is closing")
+	s.httpServer.Close()
+}
+
+// Log is the main logging function.
+func (s *playbackServer) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, "[playback] "+format, args...)
+}
+
+func (s *playbackServer) writeError(ctx *gin.Context, status int, err error) {
+	ctx.JSON(status, &apiError{Error: err.Error()})
+}
+
+func (s *playbackServer) onGet(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %v", err))
+		return
+	}
+
+	duration, err := time.ParseDuration(ctx.Query("duration"))
+	if err != nil || duration <= 0 {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration"))
+		return
+	}
+
+	user, pass, hasCredentials := ctx.Request.BasicAuth()
+
+	res := s.pathManager.getConfForPath(pathGetConfForPathReq{
+		name:    pathName,
+		publish: false,
+		credentials: authCredentials{
+			query: ctx.Request.URL.RawQuery,
+			ip:    net.ParseIP(ctx.ClientIP()),
+			user:  user,
+			pass:  pass,
+			proto: authProtocolPlayback,
+		},
+	})
+	if res.err != nil {
+		if terr, ok := res.err.(*errAuthentication); ok {
+			if !hasCredentials {
+				ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+				ctx.Writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			s.Log(logger.Info, "connection %v failed to authenticate: %v", ctx.Request.RemoteAddr, terr.message)
+
+			ctx.Writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.writeError(ctx, http.StatusNotFound, res.err)
+		return
+	}
+
+	segments, err := playbackFindSegments(res.conf.RecordPath, pathName)
+	if err != nil {
+		s.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	segments = playbackSelectSegments(segments, start, duration)
+	if segments == nil {
+		s.writeError(ctx, http.StatusNotFound, fmt.Errorf("no recordings found"))
+		return
+	}
+
+	ctx.Writer.Header().Set("Content-Type", "video/mp4")
+	ctx.Writer.WriteHeader(http.StatusOK)
+
+	err = playbackRemux(ctx.Writer, segments, start, duration)
+	if err != nil {
+		s.Log(logger.Warn, "unable to serve recordings of '%s': %v", pathName, err)
+	}
+}
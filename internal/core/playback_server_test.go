@@ -0,0 +1,172 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaybackFindSegments(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	format := filepath.Join(dir, "%path", "%Y-%m-%d_%H-%M-%S-%f")
+
+	for _, name := range []string{
+		"2023-05-01_10-00-05-000000.mp4",
+		"2023-05-01_10-00-00-000000.mp4",
+		"2023-05-01_10-00-10-000000.mp4",
+		"other.mp4",
+	} {
+		os.MkdirAll(filepath.Join(dir, "mypath"), 0o755)
+		err := os.WriteFile(filepath.Join(dir, "mypath", name), nil, 0o644)
+		require.NoError(t, err)
+	}
+
+	segments, err := playbackFindSegments(format, "mypath")
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+	require.Equal(t, filepath.Join(dir, "mypath", "2023-05-01_10-00-00-000000.mp4"), segments[0].filename)
+	require.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 0, time.Local), segments[0].start)
+
+	segments = playbackSelectSegments(segments,
+		time.Date(2023, 5, 1, 10, 0, 7, 0, time.Local), 2*time.Second)
+	require.Len(t, segments, 1)
+	require.Equal(t, time.Date(2023, 5, 1, 10, 0, 5, 0, time.Local), segments[0].start)
+
+	segments, err = playbackFindSegments(format, "otherpath")
+	require.NoError(t, err)
+	require.Empty(t, segments)
+
+	_, err = playbackFindSegments(format, "x/../../outside")
+	require.EqualError(t, err, "invalid path name: can't contain '..' elements")
+}
+
+func TestRecordPathContains(t *testing.T) {
+	root := recordPathRoot(filepath.Join("recordings", "%path", "%Y-%m-%d"))
+	require.Equal(t, "recordings", root)
+
+	require.True(t, recordPathContains(root, filepath.Join("recordings", "mypath")))
+	require.True(t, recordPathContains(root, filepath.Join("recordings", "..mypath")))
+	require.False(t, recordPathContains(root, filepath.Join("recordings", "..", "mypath")))
+	require.False(t, recordPathContains(root, "other"))
+
+	require.True(t, recordPathContains(recordPathRoot("%path/%Y"), "mypath"))
+	require.False(t, recordPathContains(recordPathRoot("%path/%Y"), "../mypath"))
+}
+
+func TestPlaybackServer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "%path", "%Y-%m-%d_%H-%M-%S-%f")
+	start := time.Now()
+	writeTestRecording(t, recordPath)
+
+	p, ok := newInstance("playback: yes\n" +
+		"paths:\n" +
+		"  mypath:\n" +
+		"    recordPath: " + recordPath + "\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	res, err := hc.Get("http://localhost:9996/playback?path=mypath&start=" +
+		start.Add(-1*time.Second).Format(time.RFC3339) + "&duration=1h")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "video/mp4", res.Header.Get("Content-Type"))
+
+	byts, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	var init fmp4.Init
+	err = init.Unmarshal(byts)
+	require.NoError(t, err)
+	require.Len(t, init.Tracks, 2)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts)
+	require.NoError(t, err)
+
+	sampleCount := make(map[int]int)
+	for _, part := range parts {
+		for _, pt := range part.Tracks {
+			sampleCount[pt.ID] += len(pt.Samples)
+		}
+	}
+	require.Equal(t, map[int]int{1: 11, 2: 11}, sampleCount)
+
+	res2, err := hc.Get("http://localhost:9996/playback?path=mypath&start=" +
+		start.Add(-1*time.Hour).Format(time.RFC3339) + "&duration=10s")
+	require.NoError(t, err)
+	defer res2.Body.Close()
+	require.Equal(t, http.StatusNotFound, res2.StatusCode)
+
+	res3, err := hc.Get("http://localhost:9996/playback?path=mypath&start=invalid&duration=10s")
+	require.NoError(t, err)
+	defer res3.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res3.StatusCode)
+}
+
+func TestPlaybackRemuxUnknownTrack(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2009, 5, 20, 22, 15, 25, 0, time.UTC)
+	seg := &playbackSegment{
+		filename: filepath.Join(dir, "2009-05-20_22-15-25-000000.mp4"),
+		start:    start,
+	}
+
+	f, err := os.Create(seg.filename)
+	require.NoError(t, err)
+
+	err = playbackWriteBox(f, &fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 48000,
+			Codec:     &fmp4.CodecOpus{ChannelCount: 2},
+		}},
+	})
+	require.NoError(t, err)
+
+	// the part contains a track that is not in the initialization section
+	err = playbackWriteBox(f, &fmp4.Part{
+		Tracks: []*fmp4.PartTrack{
+			{
+				ID:      1,
+				Samples: []*fmp4.PartSample{{Duration: 960, Payload: []byte{1}}},
+			},
+			{
+				ID:      2,
+				Samples: []*fmp4.PartSample{{Duration: 960, Payload: []byte{2}}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	f.Close()
+
+	var buf bytes.Buffer
+	err = playbackRemux(&buf, []*playbackSegment{seg}, start, time.Second)
+	require.NoError(t, err)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	require.Len(t, parts[0].Tracks, 1)
+	require.Equal(t, 1, parts[0].Tracks[0].ID)
+}
@@ -40,6 +40,7 @@ func newPPROF(
 		time.Duration(readTimeout),
 		"",
 		"",
+		"",
 		http.DefaultServeMux,
 		pp,
 	)
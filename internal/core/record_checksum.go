@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// object metadata that contains the SHA-256 of uploaded recordings.
+	recordChecksumMetadataKey = "sha256"
+)
+
+// checksumWriter computes the SHA-256 of the data written to a file.
+type checksumWriter struct {
+	io.WriteCloser
+	h hash.Hash
+}
+
+func newChecksumWriter(w io.WriteCloser) *checksumWriter {
+	return &checksumWriter{
+		WriteCloser: w,
+		h:           sha256.New(),
+	}
+}
+
+// Write implements io.Writer.
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.h.Write(p[:n])
+	return n, err
+}
+
+func (w *checksumWriter) checksum() string {
+	return hex.EncodeToString(w.h.Sum(nil))
+}
+
+// fileChecksum computes the SHA-256 of a file, then seeks back to its beginning.
+func fileChecksum(f *os.File) (string, error) {
+	h := sha256.New()
+
+	_, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksum computes the SHA-256 of an object and compares it with the expected one.
+func verifyChecksum(key string, expected string, body io.Reader) (*apiRecordingVerification, error) {
+	h := sha256.New()
+
+	_, err := io.Copy(h, body)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &apiRecordingVerification{
+		Key:      key,
+		Expected: expected,
+		Actual:   hex.EncodeToString(h.Sum(nil)),
+	}
+
+	switch {
+	case expected == "":
+		v.Status = apiRecordingVerificationStatusMissing
+
+	case expected == v.Actual:
+		v.Status = apiRecordingVerificationStatusValid
+
+	default:
+		v.Status = apiRecordingVerificationStatusInvalid
+	}
+
+	return v, nil
+}
+
+// VerifyObjects downloads the objects of a bucket that start with prefix
+// and checks them against the SHA-256 stored in their metadata.
+func (c *s3Client) VerifyObjects(ctx context.Context, bucketName string, prefix string) (
+	[]*apiRecordingVerification, error,
+) {
+	items := []*apiRecordingVerification{}
+
+	paginator := s3.NewListObjectsV2Paginator(c.S3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			out, err := c.S3Client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(bucketName),
+				Key:    obj.Key,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := verifyChecksum(aws.ToString(obj.Key), out.Metadata[recordChecksumMetadataKey], out.Body)
+			out.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, v)
+		}
+	}
+
+	return items, nil
+}
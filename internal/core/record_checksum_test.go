@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomFileChecksum(t *testing.T) {
+	for _, ca := range []string{
+		"plain",
+		"encrypted",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-checksum")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			r := &Room{}
+			if ca == "encrypted" {
+				r.recordConf.encryptionKey = bytes.Repeat([]byte{0x01}, 32)
+			}
+
+			f, err := r.createFile(filepath.Join(dir, "test.ogg"))
+			require.NoError(t, err)
+
+			_, err = f.Write(bytes.Repeat([]byte{0x02}, 100000))
+			require.NoError(t, err)
+
+			err = f.Close()
+			require.NoError(t, err)
+
+			// the checksum is the one of the data on disk
+			byts, err := os.ReadFile(f.Filename)
+			require.NoError(t, err)
+			sum := sha256.Sum256(byts)
+			require.Equal(t, hex.EncodeToString(sum[:]), f.Checksum())
+
+			fi, err := os.Open(f.Filename)
+			require.NoError(t, err)
+			defer fi.Close()
+
+			checksum, err := fileChecksum(fi)
+			require.NoError(t, err)
+			require.Equal(t, f.Checksum(), checksum)
+
+			// the file can be read again
+			byts2, err := io.ReadAll(fi)
+			require.NoError(t, err)
+			require.Equal(t, byts, byts2)
+		})
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	checksum := hex.EncodeToString(sum[:])
+
+	v, err := verifyChecksum("a", checksum, bytes.NewReader([]byte("content")))
+	require.NoError(t, err)
+	require.Equal(t, &apiRecordingVerification{
+		Key:      "a",
+		Expected: checksum,
+		Actual:   checksum,
+		Status:   apiRecordingVerificationStatusValid,
+	}, v)
+
+	v, err = verifyChecksum("a", checksum, bytes.NewReader([]byte("tampered")))
+	require.NoError(t, err)
+	require.Equal(t, apiRecordingVerificationStatusInvalid, v.Status)
+
+	v, err = verifyChecksum("a", "", bytes.NewReader([]byte("content")))
+	require.NoError(t, err)
+	require.Equal(t, apiRecordingVerificationStatusMissing, v.Status)
+}
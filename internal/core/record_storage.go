@@ -0,0 +1,27 @@
+package core
+
+import (
+	"context"
+	"os"
+)
+
+// recordStorage is where recordings are stored once they are complete.
+// It is either a S3 bucket or a directory on a NAS.
+type recordStorage interface {
+	CreateBucket(name string, region string) error
+	UploadObject(bucketName string, objectKey string, file *os.File, checksum string) error
+	VerifyObjects(ctx context.Context, bucketName string, prefix string) ([]*apiRecordingVerification, error)
+}
+
+// newRecordStorage returns the storage of recordings selected by the configuration.
+func newRecordStorage(ctx context.Context, rc roomRecordConf) (recordStorage, error) {
+	if rc.nasPath != "" {
+		return newNASStorage(ctx, rc), nil
+	}
+
+	c, err := newS3Client(ctx, rc)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
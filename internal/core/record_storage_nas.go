@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	nasStorageRetryPause       = 5 * time.Second
+	nasStorageChecksumSuffix   = ".sha256"
+	nasStorageTempFilePrefix   = ".tmp-"
+	nasStorageDirPermissions   = 0o755
+	nasStorageFilePermissions  = 0o644
+	nasStorageTempFileIDLength = 8
+)
+
+// nasStorage stores recordings into a directory that is usually a NFS or SMB mount
+// of a NAS. Buckets are subdirectories and objects are files.
+// Since mounts can disappear or stall, files are written into temporary files
+// that are renamed once they are complete and flushed, failed writes are retried
+// while the local copy of the recording is kept, and free space is checked
+// before every write.
+type nasStorage struct {
+	ctx          context.Context
+	root         string
+	minFreeSpace uint64
+	retryTimeout time.Duration
+	retryPause   time.Duration
+}
+
+func newNASStorage(ctx context.Context, rc roomRecordConf) *nasStorage {
+	return &nasStorage{
+		ctx:          ctx,
+		root:         rc.nasPath,
+		minFreeSpace: rc.nasMinFreeSpace,
+		retryTimeout: rc.nasRetryTimeout,
+		retryPause:   nasStorageRetryPause,
+	}
+}
+
+// checkMount checks whether the root directory is available.
+// The root directory is never created, in order not to write into the
+// mount point when the NAS is not mounted.
+func (s *nasStorage) checkMount() error {
+	fi, err := os.Stat(s.root)
+	if err != nil {
+		return fmt.Errorf("NAS is not available: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("NAS is not available: '%s' is not a directory", s.root)
+	}
+	return nil
+}
+
+func (s *nasStorage) objectPath(bucketName string, objectKey string) (string, error) {
+	p := filepath.Join(s.root, bucketName, filepath.FromSlash(objectKey))
+
+	// prevent bucket names and keys from escaping the root directory
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid object '%s/%s'", bucketName, objectKey)
+	}
+
+	return p, nil
+}
+
+// withRetry calls cb until it succeeds or retryTimeout expires.
+func (s *nasStorage) withRetry(cb func() error) error {
+	deadline := time.Now().Add(s.retryTimeout)
+
+	for {
+		err := cb()
+		if err == nil {
+			return nil
+		}
+
+		if !time.Now().Add(s.retryPause).Before(deadline) {
+			return err
+		}
+
+		select {
+		case <-time.After(s.retryPause):
+		case <-s.ctx.Done():
+			return err
+		}
+	}
+}
+
+// CreateBucket implements recordStorage.
+func (s *nasStorage) CreateBucket(name string, _ string) error {
+	p, err := s.objectPath(name, "")
+	if err != nil {
+		return err
+	}
+
+	return s.withRetry(func() error {
+		err := s.checkMount()
+		if err != nil {
+			return err
+		}
+		return os.MkdirAll(p, nasStorageDirPermissions)
+	})
+}
+
+// UploadObject implements recordStorage.
+// The SHA-256 of the file is stored into a file next to the object;
+// if checksum is empty, it is computed by reading the file.
+func (s *nasStorage) UploadObject(bucketName string, objectKey string, file *os.File, checksum string) error {
+	if checksum == "" {
+		var err error
+		checksum, err = fileChecksum(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	dest, err := s.objectPath(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	return s.withRetry(func() error {
+		err := s.checkMount()
+		if err != nil {
+			return err
+		}
+
+		err = s.checkFreeSpace(uint64(fi.Size()))
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(dest), nasStorageDirPermissions)
+		if err != nil {
+			return err
+		}
+
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		err = nasWriteAtomic(dest, file)
+		if err != nil {
+			return err
+		}
+
+		return nasWriteAtomic(dest+nasStorageChecksumSuffix, strings.NewReader(checksum))
+	})
+}
+
+func (s *nasStorage) checkFreeSpace(size uint64) error {
+	free, err := nasFreeSpace(s.root)
+	if err != nil {
+		return err
+	}
+
+	if free < size+s.minFreeSpace {
+		return fmt.Errorf("not enough free space on NAS (%d bytes available, %d required)",
+			free, size+s.minFreeSpace)
+	}
+
+	return nil
+}
+
+// nasWriteAtomic writes data into a temporary file in the same directory of dest,
+// flushes it and renames it into dest, in order to never expose partial files.
+func nasWriteAtomic(dest string, r io.Reader) error {
+	var id [nasStorageTempFileIDLength]byte
+	_, err := rand.Read(id[:])
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(dest),
+		nasStorageTempFilePrefix+hex.EncodeToString(id[:])+"-"+filepath.Base(dest))
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, nasStorageFilePermissions)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	err = os.Rename(tmp, dest)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// VerifyObjects implements recordStorage.
+func (s *nasStorage) VerifyObjects(ctx context.Context, bucketName string, prefix string) (
+	[]*apiRecordingVerification, error,
+) {
+	err := s.checkMount()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := s.objectPath(bucketName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	items := []*apiRecordingVerification{}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() ||
+			strings.HasSuffix(d.Name(), nasStorageChecksumSuffix) ||
+			strings.HasPrefix(d.Name(), nasStorageTempFilePrefix) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, p)
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		expected, err := os.ReadFile(p + nasStorageChecksumSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		v, err := verifyChecksum(key, string(expected), f)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
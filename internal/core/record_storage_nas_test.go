@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNASStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-nas")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "nas")
+
+	s := newNASStorage(context.Background(), roomRecordConf{nasPath: root})
+
+	src := filepath.Join(dir, "rec.ogg")
+	err = os.WriteFile(src, []byte("testing"), 0o644)
+	require.NoError(t, err)
+
+	f, err := os.Open(src)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// the root directory is not created when the NAS is not mounted
+	err = s.UploadObject("mybucket", "event/rec.ogg", f, "")
+	require.Error(t, err)
+	_, err = os.Stat(root)
+	require.True(t, os.IsNotExist(err))
+
+	err = os.Mkdir(root, 0o755)
+	require.NoError(t, err)
+
+	err = s.CreateBucket("mybucket", "")
+	require.NoError(t, err)
+
+	err = s.UploadObject("mybucket", "event/rec.ogg", f, "")
+	require.NoError(t, err)
+
+	byts, err := os.ReadFile(filepath.Join(root, "mybucket", "event", "rec.ogg"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("testing"), byts)
+
+	entries, err := os.ReadDir(filepath.Join(root, "mybucket", "event"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	items, err := s.VerifyObjects(context.Background(), "mybucket", "event/")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, "event/rec.ogg", items[0].Key)
+	require.Equal(t, apiRecordingVerificationStatusValid, items[0].Status)
+
+	err = s.UploadObject("mybucket", "../../escape.ogg", f, "")
+	require.EqualError(t, err, "invalid object 'mybucket/../../escape.ogg'")
+
+	s.minFreeSpace = 1 << 62
+	err = s.UploadObject("mybucket", "event/rec2.ogg", f, "")
+	require.ErrorContains(t, err, "not enough free space on NAS")
+}
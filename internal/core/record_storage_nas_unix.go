@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package core
+
+import (
+	"syscall"
+)
+
+// nasFreeSpace returns the space available to unprivileged users on the file system of a directory.
+func nasFreeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(dir, &st)
+	if err != nil {
+		return 0, err
+	}
+
+	return st.Bavail * uint64(st.Bsize), nil //nolint:unconvert
+}
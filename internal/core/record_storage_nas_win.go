@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package core
+
+import (
+	"math"
+)
+
+// nasFreeSpace returns the space available on the file system of a directory.
+// Free space is not checked on Windows.
+func nasFreeSpace(_ string) (uint64, error) {
+	return math.MaxUint64, nil
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+type relaySourceParent interface {
+	rtspSourceParent
+}
+
+// relaySource relays with RTSP a path of another instance,
+// whose URL is resolved when the source starts.
+type relaySource struct {
+	typ     string
+	resolve func() (string, error)
+	parent  relaySourceParent
+
+	rtspSource *rtspSource
+}
+
+func newRelaySource(
+	typ string,
+	resolve func() (string, error),
+	readTimeout conf.StringDuration,
+	writeTimeout conf.StringDuration,
+	readBufferCount int,
+	parent relaySourceParent,
+) *relaySource {
+	return &relaySource{
+		typ:     typ,
+		resolve: resolve,
+		parent:  parent,
+		rtspSource: newRTSPSource(
+			readTimeout,
+			writeTimeout,
+			readBufferCount,
+			parent),
+	}
+}
+
+func (s *relaySource) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, "["+s.typ+"] "+format, args...)
+}
+
+// run implements sourceStaticImpl.
+func (s *relaySource) run(ctx context.Context, cnf *conf.PathConf, reloadConf chan *conf.PathConf) error {
+	ur, err := s.resolve()
+	if err != nil {
+		return err
+	}
+
+	s.Log(logger.Debug, "relaying %s", ur)
+
+	relayConf := *cnf
+	relayConf.Source = ur
+	relayConf.SourceFingerprint = ""
+	relayConf.RtspRangeType = conf.RtspRangeTypeUndefined
+
+	return s.rtspSource.run(ctx, &relayConf, reloadConf)
+}
+
+// apiSourceDescribe implements sourceStaticImpl.
+func (s *relaySource) apiSourceDescribe() pathAPISourceOrReader {
+	return pathAPISourceOrReader{
+		Type: s.typ,
+		ID:   "",
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginSource(t *testing.T) {
+	serverMedia := testMediaH264
+	stream := gortsplib.NewServerStream(media.Medias{serverMedia})
+
+	s := gortsplib.Server{
+		Handler: &testServer{
+			onDescribe: func(ctx *gortsplib.ServerHandlerOnDescribeCtx,
+			) (*base.Response, *gortsplib.ServerStream, error) {
+				require.Equal(t, "/mystream", ctx.Path)
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+				go func() {
+					time.Sleep(1 * time.Second)
+					stream.WritePacketRTP(serverMedia, &rtp.Packet{
+						Header: rtp.Header{
+							Version:        0x02,
+							PayloadType:    96,
+							SequenceNumber: 57899,
+							Timestamp:      345234345,
+							SSRC:           978651231,
+							Marker:         true,
+						},
+						Payload: []byte{0x01, 0x02, 0x03, 0x04},
+					})
+				}()
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "127.0.0.1:8555",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Wait() //nolint:errcheck
+	defer s.Close()
+
+	p, ok := newInstance("originAddress: rtsp://localhost:8555\n" +
+		"paths:\n" +
+		"  all:\n" +
+		"    source: origin\n" +
+		"    sourceProtocol: tcp\n" +
+		"    sourceOnDemand: yes\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	received := make(chan struct{})
+
+	c := gortsplib.Client{}
+
+	u, err := url.Parse("rtsp://127.0.0.1:8554/mystream")
+	require.NoError(t, err)
+
+	err = c.Start(u.Scheme, u.Host)
+	require.NoError(t, err)
+	defer c.Close()
+
+	medias, baseURL, _, err := c.Describe(u)
+	require.NoError(t, err)
+
+	var forma *formats.H264
+	medi := medias.FindFormat(&forma)
+
+	_, err = c.Setup(medi, baseURL, 0, 0)
+	require.NoError(t, err)
+
+	c.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+		require.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, pkt.Payload)
+		close(received)
+	})
+
+	_, err = c.Play(nil)
+	require.NoError(t, err)
+
+	<-received
+}
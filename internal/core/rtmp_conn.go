@@ -26,10 +26,6 @@ import (
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
-const (
-	rtmpPauseAfterAuthError = 2 * time.Second
-)
-
 func pathNameAndQuery(inURL *url.URL) (string, url.Values, string) {
 	// remove leading and trailing slashes inserted by OBS and some other clients
 	tmp := strings.TrimRight(inURL.String(), "/")
@@ -226,11 +222,6 @@ func (c *rtmpConn) runRead(conn *rtmp.Conn, u *url.URL) error {
 	})
 
 	if res.err != nil {
-		if terr, ok := res.err.(*errAuthentication); ok {
-			// wait some seconds to stop brute force attacks
-			<-time.After(rtmpPauseAfterAuthError)
-			return terr
-		}
 		return res.err
 	}
 
@@ -252,7 +243,10 @@ func (c *rtmpConn) runRead(conn *rtmp.Conn, u *url.URL) error {
 	var videoStartDTS time.Duration
 	var w *rtmp.Writer
 
-	videoMedia, videoFormat := c.setupVideo(
+	videoMedia, videoFormat := rtmpSetupVideo(
+		c,
+		c.nconn,
+		c.writeTimeout,
 		&w,
 		res.stream,
 		ringBuffer,
@@ -262,7 +256,10 @@ func (c *rtmpConn) runRead(conn *rtmp.Conn, u *url.URL) error {
 		medias = append(medias, videoMedia)
 	}
 
-	audioMedia, audioFormat := c.setupAudio(
+	audioMedia, audioFormat := rtmpSetupAudio(
+		c,
+		c.nconn,
+		c.writeTimeout,
 		&w,
 		res.stream,
 		ringBuffer,
@@ -323,7 +320,11 @@ func (c *rtmpConn) runRead(conn *rtmp.Conn, u *url.URL) error {
 	}
 }
 
-func (c *rtmpConn) setupVideo(
+// rtmpSetupVideo reads video from a stream and writes it to a RTMP writer.
+func rtmpSetupVideo(
+	reader interface{},
+	nconn net.Conn,
+	writeTimeout conf.StringDuration,
 	w **rtmp.Writer,
 	stream *stream.Stream,
 	ringBuffer *ringbuffer.RingBuffer,
@@ -338,7 +339,7 @@ func (c *rtmpConn) setupVideo(
 		var startPTS time.Duration
 		var videoDTSExtractor *h264.DTSExtractor
 
-		stream.AddReader(c, videoMedia, videoFormatH264, func(unit formatprocessor.Unit) {
+		stream.AddReader(reader, videoMedia, videoFormatH264, func(unit formatprocessor.Unit) {
 			ringBuffer.Push(func() error {
 				tunit := unit.(*formatprocessor.UnitH264)
 
@@ -401,7 +402,7 @@ func (c *rtmpConn) setupVideo(
 					pts -= *videoStartDTS
 				}
 
-				c.nconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
+				nconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
 				return (*w).WriteH264(pts, dts, idrPresent, tunit.AU)
 			})
 		})
@@ -412,7 +413,11 @@ func (c *rtmpConn) setupVideo(
 	return nil, nil
 }
 
-func (c *rtmpConn) setupAudio(
+// rtmpSetupAudio reads audio from a stream and writes it to a RTMP writer.
+func rtmpSetupAudio(
+	reader interface{},
+	nconn net.Conn,
+	writeTimeout conf.StringDuration,
 	w **rtmp.Writer,
 	stream *stream.Stream,
 	ringBuffer *ringbuffer.RingBuffer,
@@ -427,7 +432,7 @@ func (c *rtmpConn) setupAudio(
 		startPTSFilled := false
 		var startPTS time.Duration
 
-		stream.AddReader(c, audioMedia, audioFormatMPEG4Generic, func(unit formatprocessor.Unit) {
+		stream.AddReader(reader, audioMedia, audioFormatMPEG4Generic, func(unit formatprocessor.Unit) {
 			ringBuffer.Push(func() error {
 				tunit := unit.(*formatprocessor.UnitMPEG4AudioGeneric)
 
@@ -453,7 +458,7 @@ func (c *rtmpConn) setupAudio(
 				}
 
 				for i, au := range tunit.AUs {
-					c.nconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
+					nconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
 					err := (*w).WriteMPEG4Audio(
 						pts+time.Duration(i)*mpeg4audio.SamplesPerAccessUnit*
 							time.Second/time.Duration(audioFormatMPEG4Generic.ClockRate()),
@@ -481,7 +486,7 @@ func (c *rtmpConn) setupAudio(
 		startPTSFilled := false
 		var startPTS time.Duration
 
-		stream.AddReader(c, audioMedia, audioFormatMPEG4AudioLATM, func(unit formatprocessor.Unit) {
+		stream.AddReader(reader, audioMedia, audioFormatMPEG4AudioLATM, func(unit formatprocessor.Unit) {
 			ringBuffer.Push(func() error {
 				tunit := unit.(*formatprocessor.UnitMPEG4AudioLATM)
 
@@ -506,7 +511,7 @@ func (c *rtmpConn) setupAudio(
 					}
 				}
 
-				c.nconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
+				nconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
 				return (*w).WriteMPEG4Audio(pts, tunit.AU)
 			})
 		})
@@ -521,7 +526,7 @@ func (c *rtmpConn) setupAudio(
 		startPTSFilled := false
 		var startPTS time.Duration
 
-		stream.AddReader(c, audioMedia, audioFormatMPEG1, func(unit formatprocessor.Unit) {
+		stream.AddReader(reader, audioMedia, audioFormatMPEG1, func(unit formatprocessor.Unit) {
 			ringBuffer.Push(func() error {
 				tunit := unit.(*formatprocessor.UnitMPEG1Audio)
 
@@ -553,7 +558,7 @@ func (c *rtmpConn) setupAudio(
 						return fmt.Errorf("RTMP only supports MPEG-1 layer 3 audio")
 					}
 
-					c.nconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
+					nconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
 					err = (*w).WriteMPEG1Audio(pts, &h, frame)
 					if err != nil {
 						return err
@@ -590,11 +595,6 @@ func (c *rtmpConn) runPublish(conn *rtmp.Conn, u *url.URL) error {
 	})
 
 	if res.err != nil {
-		if terr, ok := res.err.(*errAuthentication); ok {
-			// wait some seconds to stop brute force attacks
-			<-time.After(rtmpPauseAfterAuthError)
-			return terr
-		}
 		return res.err
 	}
 
@@ -251,8 +251,9 @@ func TestRTMPServerAuthFail(t *testing.T) {
 			PacketizationMode: 1,
 		}
 
-		_, err = rtmp.NewWriter(conn1, videoTrack, nil)
-		require.NoError(t, err)
+		// the server closes the connection as soon as authentication fails,
+		// therefore writing may fail too.
+		rtmp.NewWriter(conn1, videoTrack, nil) //nolint:errcheck
 
 		time.Sleep(500 * time.Millisecond)
 
@@ -303,8 +304,9 @@ func TestRTMPServerAuthFail(t *testing.T) {
 			PacketizationMode: 1,
 		}
 
-		_, err = rtmp.NewWriter(conn1, videoTrack, nil)
-		require.NoError(t, err)
+		// the server closes the connection as soon as authentication fails,
+		// therefore writing may fail too.
+		rtmp.NewWriter(conn1, videoTrack, nil) //nolint:errcheck
 
 		time.Sleep(500 * time.Millisecond)
 
@@ -16,10 +16,6 @@ import (
 	"github.com/bluenviron/mediamtx/internal/logger"
 )
 
-const (
-	rtspPauseAfterAuthError = 2 * time.Second
-)
-
 type rtspConnParent interface {
 	logger.Writer
 }
@@ -209,9 +205,6 @@ func (c *rtspConn) handleAuthError(authErr error) (*base.Response, error) {
 		}, nil
 	}
 
-	// wait some seconds to stop brute force attacks
-	<-time.After(rtspPauseAfterAuthError)
-
 	return &base.Response{
 		StatusCode: base.StatusUnauthorized,
 	}, authErr
@@ -377,6 +377,40 @@ func TestRTSPServerPublisherOverride(t *testing.T) {
 	}
 }
 
+func TestRTSPServerPublisherFork(t *testing.T) {
+	p, ok := newInstance("rtmp: no\n" +
+		"paths:\n" +
+		"  all:\n" +
+		"    duplicatePublisher: fork\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	s1 := gortsplib.Client{}
+	err := s1.StartRecording("rtsp://localhost:8554/teststream", media.Medias{testMediaH264})
+	require.NoError(t, err)
+	defer s1.Close()
+
+	s2 := gortsplib.Client{}
+	err = s2.StartRecording("rtsp://localhost:8554/teststream", media.Medias{testMediaH264})
+	require.NoError(t, err)
+	defer s2.Close()
+
+	// both publishers are kept, the second one is moved to a suffixed path
+	for _, pathName := range []string{"teststream", "teststream_2"} {
+		c := gortsplib.Client{}
+
+		u, err := url.Parse("rtsp://localhost:8554/" + pathName)
+		require.NoError(t, err)
+
+		err = c.Start(u.Scheme, u.Host)
+		require.NoError(t, err)
+
+		_, _, _, err = c.Describe(u)
+		c.Close()
+		require.NoError(t, err)
+	}
+}
+
 func TestRTSPServerFallback(t *testing.T) {
 	for _, ca := range []string{
 		"absolute",
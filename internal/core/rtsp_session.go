@@ -132,9 +132,17 @@ func (s *rtspSession) onAnnounce(c *rtspConn, ctx *gortsplib.ServerHandlerOnAnno
 		}
 	}
 
+	role, err := pathPublisherRoleFromQuery(ctx.Query)
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, err
+	}
+
 	res := s.pathManager.addPublisher(pathAddPublisherReq{
 		author:   s,
 		pathName: ctx.Path,
+		role:     role,
 		credentials: authCredentials{
 			query:       ctx.Query,
 			ip:          c.ip(),
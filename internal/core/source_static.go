@@ -47,6 +47,9 @@ type sourceStatic struct {
 
 func newSourceStatic(
 	cnf *conf.PathConf,
+	pathName string,
+	cluster *cluster,
+	originAddress string,
 	readTimeout conf.StringDuration,
 	writeTimeout conf.StringDuration,
 	readBufferCount int,
@@ -97,6 +100,28 @@ func newSourceStatic(
 			readTimeout,
 			s)
 
+	case cnf.Source == "cluster":
+		s.impl = newRelaySource(
+			"clusterSource",
+			func() (string, error) {
+				return cluster.findPath(pathName)
+			},
+			readTimeout,
+			writeTimeout,
+			readBufferCount,
+			s)
+
+	case cnf.Source == "origin":
+		s.impl = newRelaySource(
+			"originSource",
+			func() (string, error) {
+				return strings.TrimSuffix(originAddress, "/") + "/" + pathName, nil
+			},
+			readTimeout,
+			writeTimeout,
+			readBufferCount,
+			s)
+
 	case cnf.Source == "rpiCamera":
 		s.impl = newRPICameraSource(
 			s)
@@ -152,6 +152,19 @@ func (c *srtConn) runInner() error {
 	return err
 }
 
+// srtSetPassphrase sets the passphrase required to decrypt a connection.
+func srtSetPassphrase(connReq srt.ConnRequest, passphrase string) error {
+	if passphrase == "" {
+		return nil
+	}
+
+	if !connReq.IsEncrypted() {
+		return fmt.Errorf("connection is not encrypted, but a passphrase is required")
+	}
+
+	return connReq.SetPassphrase(passphrase)
+}
+
 func (c *srtConn) runInner2(req srtNewConnReq) (bool, error) {
 	parts := strings.Split(req.connReq.StreamId(), ":")
 	if (len(parts) != 2 && len(parts) != 4) || (parts[0] != "read" && parts[0] != "publish") {
@@ -200,6 +213,11 @@ func (c *srtConn) runPublish(req srtNewConnReq, pathName string, user string, pa
 
 	defer res.path.removePublisher(pathRemovePublisherReq{author: c})
 
+	err := srtSetPassphrase(req.connReq, res.path.safeConf().SRTPublishPassphrase)
+	if err != nil {
+		return false, err
+	}
+
 	sconn, err := c.exchangeRequestWithConn(req)
 	if err != nil {
 		return true, err
@@ -404,6 +422,11 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 
 	defer res.path.removeReader(pathRemoveReaderReq{author: c})
 
+	err := srtSetPassphrase(req.connReq, res.path.safeConf().SRTReadPassphrase)
+	if err != nil {
+		return false, err
+	}
+
 	sconn, err := c.exchangeRequestWithConn(req)
 	if err != nil {
 		return true, err
@@ -423,9 +446,67 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 	}()
 
 	var w *mpegts.Writer
+	bw := bufio.NewWriterSize(sconn, srtMaxPayloadSize(c.udpMaxPayloadSize))
+
+	tracks, medias := srtSetupWriter(c, res.stream, ringBuffer, sconn, bw, c.writeTimeout, &w)
+
+	if len(tracks) == 0 {
+		return true, fmt.Errorf(
+			"the stream doesn't contain any supported codec, which are currently H265, H264, Opus, MPEG-4 Audio")
+	}
+
+	c.Log(logger.Info, "is reading from path '%s', %s",
+		res.path.name, sourceMediaInfo(medias))
+
+	pathConf := res.path.safeConf()
+
+	if pathConf.RunOnRead != "" {
+		c.Log(logger.Info, "runOnRead command started")
+		onReadCmd := externalcmd.NewCmd(
+			c.externalCmdPool,
+			pathConf.RunOnRead,
+			pathConf.RunOnReadRestart,
+			res.path.externalCmdEnv(),
+			func(err error) {
+				c.Log(logger.Info, "runOnRead command exited: %v", err)
+			})
+		defer func() {
+			onReadCmd.Close()
+			c.Log(logger.Info, "runOnRead command stopped")
+		}()
+	}
+
+	w = mpegts.NewWriter(bw, tracks)
+
+	// disable read deadline
+	sconn.SetReadDeadline(time.Time{})
+
+	for {
+		item, ok := ringBuffer.Pull()
+		if !ok {
+			return true, fmt.Errorf("terminated")
+		}
+
+		err := item.(func() error)()
+		if err != nil {
+			return true, err
+		}
+	}
+}
+
+// srtSetupWriter reads the tracks of a stream and writes them to a SRT connection
+// with the MPEG-TS format. The writer must be allocated before pulling from the ring buffer.
+func srtSetupWriter(
+	reader interface{},
+	stream *stream.Stream,
+	ringBuffer *ringbuffer.RingBuffer,
+	sconn srt.Conn,
+	bw *bufio.Writer,
+	writeTimeout conf.StringDuration,
+	w **mpegts.Writer,
+) ([]*mpegts.Track, media.Medias) {
 	var tracks []*mpegts.Track
 	var medias media.Medias
-	bw := bufio.NewWriterSize(sconn, srtMaxPayloadSize(c.udpMaxPayloadSize))
 
 	leadingTrackChosen := false
 	leadingTrackInitialized := false
@@ -440,7 +521,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 		return track
 	}
 
-	for _, medi := range res.stream.Medias() {
+	for _, medi := range stream.Medias() {
 		for _, format := range medi.Formats {
 			switch format := format.(type) {
 			case *formats.H265: //nolint:dupl
@@ -459,7 +540,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 				randomAccessReceived := false
 				dtsExtractor := h265.NewDTSExtractor()
 
-				res.stream.AddReader(c, medi, format, func(unit formatprocessor.Unit) {
+				stream.AddReader(reader, medi, format, func(unit formatprocessor.Unit) {
 					ringBuffer.Push(func() error {
 						tunit := unit.(*formatprocessor.UnitH265)
 						if tunit.AU == nil {
@@ -498,8 +579,8 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 						dts -= leadingTrackStartDTS
 						pts -= leadingTrackStartDTS
 
-						sconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
-						err = w.WriteH26x(track, durationGoToMPEGTS(pts), durationGoToMPEGTS(dts), randomAccess, tunit.AU)
+						sconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
+						err = (*w).WriteH26x(track, durationGoToMPEGTS(pts), durationGoToMPEGTS(dts), randomAccess, tunit.AU)
 						if err != nil {
 							return err
 						}
@@ -523,7 +604,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 				firstIDRReceived := false
 				dtsExtractor := h264.NewDTSExtractor()
 
-				res.stream.AddReader(c, medi, format, func(unit formatprocessor.Unit) {
+				stream.AddReader(reader, medi, format, func(unit formatprocessor.Unit) {
 					ringBuffer.Push(func() error {
 						tunit := unit.(*formatprocessor.UnitH264)
 						if tunit.AU == nil {
@@ -562,8 +643,8 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 						dts -= leadingTrackStartDTS
 						pts -= leadingTrackStartDTS
 
-						sconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
-						err = w.WriteH26x(track, durationGoToMPEGTS(pts), durationGoToMPEGTS(dts), idrPresent, tunit.AU)
+						sconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
+						err = (*w).WriteH26x(track, durationGoToMPEGTS(pts), durationGoToMPEGTS(dts), idrPresent, tunit.AU)
 						if err != nil {
 							return err
 						}
@@ -579,7 +660,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 				var startPTS time.Duration
 				startPTSFilled := false
 
-				res.stream.AddReader(c, medi, format, func(unit formatprocessor.Unit) {
+				stream.AddReader(reader, medi, format, func(unit formatprocessor.Unit) {
 					ringBuffer.Push(func() error {
 						tunit := unit.(*formatprocessor.UnitMPEG4AudioGeneric)
 						if tunit.AUs == nil {
@@ -599,8 +680,8 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 						pts -= startPTS
 						pts -= leadingTrackStartDTS
 
-						sconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
-						err = w.WriteMPEG4Audio(track, durationGoToMPEGTS(pts), tunit.AUs)
+						sconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
+						err := (*w).WriteMPEG4Audio(track, durationGoToMPEGTS(pts), tunit.AUs)
 						if err != nil {
 							return err
 						}
@@ -619,7 +700,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 					var startPTS time.Duration
 					startPTSFilled := false
 
-					res.stream.AddReader(c, medi, format, func(unit formatprocessor.Unit) {
+					stream.AddReader(reader, medi, format, func(unit formatprocessor.Unit) {
 						ringBuffer.Push(func() error {
 							tunit := unit.(*formatprocessor.UnitMPEG4AudioLATM)
 							if tunit.AU == nil {
@@ -639,8 +720,8 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 							pts -= startPTS
 							pts -= leadingTrackStartDTS
 
-							sconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
-							err = w.WriteMPEG4Audio(track, durationGoToMPEGTS(pts), [][]byte{tunit.AU})
+							sconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
+							err := (*w).WriteMPEG4Audio(track, durationGoToMPEGTS(pts), [][]byte{tunit.AU})
 							if err != nil {
 								return err
 							}
@@ -662,7 +743,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 				var startPTS time.Duration
 				startPTSFilled := false
 
-				res.stream.AddReader(c, medi, format, func(unit formatprocessor.Unit) {
+				stream.AddReader(reader, medi, format, func(unit formatprocessor.Unit) {
 					ringBuffer.Push(func() error {
 						tunit := unit.(*formatprocessor.UnitOpus)
 						if tunit.Packets == nil {
@@ -682,8 +763,8 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 						pts -= startPTS
 						pts -= leadingTrackStartDTS
 
-						sconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
-						err = w.WriteOpus(track, durationGoToMPEGTS(pts), tunit.Packets)
+						sconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
+						err := (*w).WriteOpus(track, durationGoToMPEGTS(pts), tunit.Packets)
 						if err != nil {
 							return err
 						}
@@ -697,7 +778,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 				var startPTS time.Duration
 				startPTSFilled := false
 
-				res.stream.AddReader(c, medi, format, func(unit formatprocessor.Unit) {
+				stream.AddReader(reader, medi, format, func(unit formatprocessor.Unit) {
 					ringBuffer.Push(func() error {
 						tunit := unit.(*formatprocessor.UnitMPEG1Audio)
 						if tunit.Frames == nil {
@@ -717,8 +798,8 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 						pts -= startPTS
 						pts -= leadingTrackStartDTS
 
-						sconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
-						err = w.WriteMPEG1Audio(track, durationGoToMPEGTS(pts), tunit.Frames)
+						sconn.SetWriteDeadline(time.Now().Add(time.Duration(writeTimeout)))
+						err := (*w).WriteMPEG1Audio(track, durationGoToMPEGTS(pts), tunit.Frames)
 						if err != nil {
 							return err
 						}
@@ -729,48 +810,7 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 		}
 	}
 
-	if len(tracks) == 0 {
-		return true, fmt.Errorf(
-			"the stream doesn't contain any supported codec, which are currently H265, H264, Opus, MPEG-4 Audio")
-	}
-
-	c.Log(logger.Info, "is reading from path '%s', %s",
-		res.path.name, sourceMediaInfo(medias))
-
-	pathConf := res.path.safeConf()
-
-	if pathConf.RunOnRead != "" {
-		c.Log(logger.Info, "runOnRead command started")
-		onReadCmd := externalcmd.NewCmd(
-			c.externalCmdPool,
-			pathConf.RunOnRead,
-			pathConf.RunOnReadRestart,
-			res.path.externalCmdEnv(),
-			func(err error) {
-				c.Log(logger.Info, "runOnRead command exited: %v", err)
-			})
-		defer func() {
-			onReadCmd.Close()
-			c.Log(logger.Info, "runOnRead command stopped")
-		}()
-	}
-
-	w = mpegts.NewWriter(bw, tracks)
-
-	// disable read deadline
-	sconn.SetReadDeadline(time.Time{})
-
-	for {
-		item, ok := ringBuffer.Pull()
-		if !ok {
-			return true, fmt.Errorf("terminated")
-		}
-
-		err := item.(func() error)()
-		if err != nil {
-			return true, err
-		}
-	}
+	return tracks, medias
 }
 
 func (c *srtConn) exchangeRequestWithConn(req srtNewConnReq) (srt.Conn, error) {
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/ringbuffer"
+	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
+	"github.com/datarhei/gosrt"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	srtPusherRetryPause = 5 * time.Second
+)
+
+// srtPusherRedactURL removes the passphrase from a SRT URL, in order to allow logging it.
+func srtPusherRedactURL(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "***"
+	}
+
+	q := u.Query()
+	q.Del("passphrase")
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// srtPusher pushes the stream of a path to a SRT listener, in caller mode.
+type srtPusher struct {
+	target            string
+	readBufferCount   int
+	writeTimeout      conf.StringDuration
+	udpMaxPayloadSize int
+	stream            *stream.Stream
+	parent            logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	done chan struct{}
+}
+
+func newSRTPusher(
+	target string,
+	readBufferCount int,
+	writeTimeout conf.StringDuration,
+	udpMaxPayloadSize int,
+	stream *stream.Stream,
+	parent logger.Writer,
+) *srtPusher {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	p := &srtPusher{
+		target:            target,
+		readBufferCount:   readBufferCount,
+		writeTimeout:      writeTimeout,
+		udpMaxPayloadSize: udpMaxPayloadSize,
+		stream:            stream,
+		parent:            parent,
+		ctx:               ctx,
+		ctxCancel:         ctxCancel,
+		done:              make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+func (p *srtPusher) close() {
+	p.ctxCancel()
+	<-p.done
+}
+
+// Log is the main logging function.
+func (p *srtPusher) Log(level logger.Level, format string, args ...interface{}) {
+	p.parent.Log(level, "[SRT push %s] "+format,
+		append([]interface{}{srtPusherRedactURL(p.target)}, args...)...)
+}
+
+func (p *srtPusher) run() {
+	defer close(p.done)
+
+	for {
+		err := p.runInner()
+		if p.ctx.Err() != nil {
+			return
+		}
+
+		p.Log(logger.Warn, "%v", err)
+
+		select {
+		case <-time.After(srtPusherRetryPause):
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *srtPusher) runInner() error {
+	srtConf := srt.DefaultConfig()
+	address, err := srtConf.UnmarshalURL(p.target)
+	if err != nil {
+		return err
+	}
+
+	err = srtConf.Validate()
+	if err != nil {
+		return err
+	}
+
+	sconn, err := srt.Dial("srt", address, srtConf)
+	if err != nil {
+		return err
+	}
+
+	writeDone := make(chan error)
+	go func() {
+		writeDone <- p.runWriter(sconn)
+	}()
+
+	select {
+	case err := <-writeDone:
+		sconn.Close()
+		return err
+
+	case <-p.ctx.Done():
+		sconn.Close()
+		<-writeDone
+		return fmt.Errorf("terminated")
+	}
+}
+
+func (p *srtPusher) runWriter(sconn srt.Conn) error {
+	ringBuffer, _ := ringbuffer.New(uint64(p.readBufferCount))
+
+	innerCtx, innerCtxCancel := context.WithCancel(p.ctx)
+	defer innerCtxCancel()
+
+	go func() {
+		<-innerCtx.Done()
+		ringBuffer.Close()
+	}()
+
+	var w *mpegts.Writer
+	bw := bufio.NewWriterSize(sconn, srtMaxPayloadSize(p.udpMaxPayloadSize))
+
+	tracks, medias := srtSetupWriter(p, p.stream, ringBuffer, sconn, bw, p.writeTimeout, &w)
+
+	defer p.stream.RemoveReader(p)
+
+	if len(tracks) == 0 {
+		return fmt.Errorf(
+			"the stream doesn't contain any supported codec, which are currently H265, H264, Opus, MPEG-4 Audio")
+	}
+
+	p.Log(logger.Info, "is pushing %s", sourceMediaInfo(medias))
+
+	w = mpegts.NewWriter(bw, tracks)
+
+	for {
+		item, ok := ringBuffer.Pull()
+		if !ok {
+			return fmt.Errorf("terminated")
+		}
+
+		err := item.(func() error)()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/datarhei/gosrt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+func TestSRTPusherRedactURL(t *testing.T) {
+	require.Equal(t, "srt://localhost:9000?latency=200000&streamid=mystream",
+		srtPusherRedactURL("srt://localhost:9000?streamid=mystream&passphrase=ttest1234567&latency=200000"))
+}
+
+func TestSRTPusher(t *testing.T) {
+	ln, err := srt.Listen("srt", "localhost:9998", srt.DefaultConfig())
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan []byte)
+
+	go func() {
+		conn, _, err := ln.Accept(func(req srt.ConnRequest) srt.ConnType {
+			if req.StreamId() != "mystream" {
+				return srt.REJECT
+			}
+
+			err := req.SetPassphrase("ttest1234567")
+			if err != nil {
+				return srt.REJECT
+			}
+
+			return srt.PUBLISH
+		})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 2048)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		received <- buf[:n]
+	}()
+
+	stream, err := stream.New(
+		1472,
+		media.Medias{testMediaH264},
+		true,
+		new(uint64),
+		nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	p := newSRTPusher(
+		"srt://localhost:9998?streamid=mystream&passphrase=ttest1234567",
+		512,
+		conf.StringDuration(10*time.Second),
+		1472,
+		stream,
+		nilLogger{},
+	)
+	defer p.close()
+
+	for i := 0; ; i++ {
+		stream.WriteUnit(testMediaH264, testFormatH264, &formatprocessor.UnitH264{
+			PTS: time.Duration(i) * 100 * time.Millisecond,
+			AU: [][]byte{
+				{5, 1}, // IDR
+			},
+		})
+
+		select {
+		case byts := <-received:
+			require.Equal(t, byte(0x47), byts[0]) // MPEG-TS sync byte
+			return
+
+		case <-time.After(100 * time.Millisecond):
+			require.Less(t, i, 50)
+		}
+	}
+}
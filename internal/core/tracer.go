@@ -0,0 +1,310 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	tracerFlushPeriod   = 5 * time.Second
+	tracerMaxBatchSize  = 512
+	tracerQueueSize     = 2048
+	tracerExportTimeout = 10 * time.Second
+)
+
+// errSpanAborted is the error of spans interrupted by a failure.
+var errSpanAborted = fmt.Errorf("aborted")
+
+// OTLP span kinds and status codes.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpStatusCodeOK     = 1
+	otlpStatusCodeError  = 2
+)
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	ret := make([]otlpAttribute, 0, len(attrs))
+	for k, v := range attrs {
+		ret = append(ret, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	return ret
+}
+
+// traceSpan is a timed operation.
+// Methods can be called on a nil span, that is returned when tracing is disabled.
+type traceSpan struct {
+	tracer     *tracer
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   *[8]byte
+	name       string
+	start      time.Time
+	attributes map[string]string
+
+	endOnce sync.Once
+	endTime time.Time
+	err     error
+}
+
+// startChild starts a span that is part of the same trace.
+func (sp *traceSpan) startChild(name string) *traceSpan {
+	if sp == nil {
+		return nil
+	}
+
+	child := sp.tracer.newSpan(name, nil)
+	child.traceID = sp.traceID
+	child.parentID = &sp.spanID
+	return child
+}
+
+// end ends the span and queues it for export.
+// Only the first call has effect.
+func (sp *traceSpan) end(err error) {
+	if sp == nil {
+		return
+	}
+
+	sp.endOnce.Do(func() {
+		sp.endTime = time.Now()
+		sp.err = err
+
+		select {
+		case sp.tracer.chSpan <- sp:
+		default:
+			// the queue is full, drop the span
+		}
+	})
+}
+
+func (sp *traceSpan) marshal() *otlpSpan {
+	out := &otlpSpan{
+		TraceID:           hex.EncodeToString(sp.traceID[:]),
+		SpanID:            hex.EncodeToString(sp.spanID[:]),
+		Name:              sp.name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(sp.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(sp.endTime.UnixNano(), 10),
+		Attributes:        otlpAttributes(sp.attributes),
+		Status:            otlpStatus{Code: otlpStatusCodeOK},
+	}
+
+	if sp.parentID != nil {
+		out.ParentSpanID = hex.EncodeToString(sp.parentID[:])
+	} else {
+		out.Kind = otlpSpanKindServer
+	}
+
+	if sp.err != nil {
+		out.Status = otlpStatus{Code: otlpStatusCodeError, Message: sp.err.Error()}
+	}
+
+	return out
+}
+
+type tracerParent interface {
+	logger.Writer
+}
+
+// tracer exports spans to an OpenTelemetry collector, with the OTLP/HTTP JSON encoding.
+type tracer struct {
+	endpoint string
+	parent   tracerParent
+
+	ctx        context.Context
+	ctxCancel  func()
+	httpClient *http.Client
+
+	// in
+	chSpan chan *traceSpan
+
+	// out
+	done chan struct{}
+}
+
+func newTracer(
+	endpoint string,
+	parent tracerParent,
+) *tracer {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	t := &tracer{
+		endpoint:   endpoint,
+		parent:     parent,
+		ctx:        ctx,
+		ctxCancel:  ctxCancel,
+		httpClient: &http.Client{Timeout: tracerExportTimeout},
+		chSpan:     make(chan *traceSpan, tracerQueueSize),
+		done:       make(chan struct{}),
+	}
+
+	t.Log(logger.Info, "exporting traces to %s", endpoint)
+
+	go t.run()
+
+	return t
+}
+
+func (t *tracer) close() {
+	t.ctxCancel()
+	<-t.done
+}
+
+// Log is the main logging function.
+func (t *tracer) Log(level logger.Level, format string, args ...interface{}) {
+	t.parent.Log(level, "[tracer] "+format, args...)
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(tracerFlushPeriod)
+	defer ticker.Stop()
+
+	var batch []*traceSpan
+
+	flush := func() {
+		if batch == nil {
+			return
+		}
+
+		err := t.export(batch)
+		if err != nil {
+			t.Log(logger.Warn, "unable to export %d spans: %v", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case sp := <-t.chSpan:
+			batch = append(batch, sp)
+			if len(batch) >= tracerMaxBatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+
+		case <-t.ctx.Done():
+			for {
+				select {
+				case sp := <-t.chSpan:
+					batch = append(batch, sp)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *tracer) export(spans []*traceSpan) error {
+	scope := &otlpScopeSpans{}
+	scope.Scope.Name = "mediamtx"
+	for _, sp := range spans {
+		scope.Spans = append(scope.Spans, sp.marshal())
+	}
+
+	res := &otlpResourceSpans{ScopeSpans: []*otlpScopeSpans{scope}}
+	res.Resource.Attributes = otlpAttributes(map[string]string{
+		"service.name":    "mediamtx",
+		"service.version": version,
+	})
+
+	enc, err := json.Marshal(&otlpTracesRequest{ResourceSpans: []*otlpResourceSpans{res}})
+	if err != nil {
+		return err
+	}
+
+	hres, err := t.httpClient.Post(t.endpoint, "application/json", bytes.NewReader(enc))
+	if err != nil {
+		return err
+	}
+	defer hres.Body.Close()
+
+	if hres.StatusCode < 200 || hres.StatusCode > 299 {
+		return fmt.Errorf("bad status code: %d", hres.StatusCode)
+	}
+
+	return nil
+}
+
+func (t *tracer) newSpan(name string, attributes map[string]string) *traceSpan {
+	sp := &traceSpan{
+		tracer:     t,
+		name:       name,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+	rand.Read(sp.spanID[:]) //nolint:errcheck
+	return sp
+}
+
+// startSpan starts a span that is the root of a new trace.
+// It returns nil when tracing is disabled.
+func (t *tracer) startSpan(name string, attributes map[string]string) *traceSpan {
+	if t == nil {
+		return nil
+	}
+
+	sp := t.newSpan(name, attributes)
+	rand.Read(sp.traceID[:]) //nolint:errcheck
+	return sp
+}
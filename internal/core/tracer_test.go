@@ -0,0 +1,69 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	received := make(chan *otlpTracesRequest, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req otlpTracesRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		require.NoError(t, err)
+
+		received <- &req
+	}))
+	defer srv.Close()
+
+	tr := newTracer(srv.URL, nilLogger{})
+
+	root := tr.startSpan("setup", map[string]string{"path": "mypath"})
+	child := root.startChild("authentication")
+	child.end(fmt.Errorf("invalid credentials"))
+	child.end(nil)
+	root.end(nil)
+
+	tr.close()
+
+	req := <-received
+	require.Len(t, req.ResourceSpans, 1)
+	require.Len(t, req.ResourceSpans[0].ScopeSpans, 1)
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "authentication", spans[0].Name)
+	require.Equal(t, otlpSpanKindInternal, spans[0].Kind)
+	require.Equal(t, otlpStatus{Code: otlpStatusCodeError, Message: "invalid credentials"}, spans[0].Status)
+
+	require.Equal(t, "setup", spans[1].Name)
+	require.Equal(t, otlpSpanKindServer, spans[1].Kind)
+	require.Equal(t, otlpStatus{Code: otlpStatusCodeOK}, spans[1].Status)
+	require.Equal(t, []otlpAttribute{{Key: "path", Value: otlpValue{StringValue: "mypath"}}}, spans[1].Attributes)
+
+	require.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, "", spans[1].ParentSpanID)
+}
+
+func TestTracerDisabled(t *testing.T) {
+	var tr *tracer
+
+	root := tr.startSpan("setup", nil)
+	require.Nil(t, root)
+
+	child := root.startChild("authentication")
+	require.Nil(t, child)
+
+	child.end(nil)
+	root.end(nil)
+}
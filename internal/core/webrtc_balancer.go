@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	// rooms are assigned to the same instance until they're inactive for this period.
+	webrtcBalancerRoomTTL = 1 * time.Hour
+
+	// query parameter that marks requests that have already been redirected.
+	webrtcBalancerRedirectedParam = "balanced"
+)
+
+// webrtcBalancerReq contains the details of a WHIP or WHEP request that is being balanced.
+type webrtcBalancerReq struct {
+	Path    string `json:"path"`
+	RoomID  string `json:"roomID"`
+	Publish bool   `json:"publish"`
+	IP      string `json:"ip"`
+	Query   string `json:"query"`
+
+	// host to which the request was sent.
+	host string
+}
+
+// webrtcBalancerRedirected returns whether a request has already been redirected by a balancer.
+// These requests are always served locally, in order to prevent redirect loops
+// between instances whose balancers disagree.
+func webrtcBalancerRedirected(query url.Values) bool {
+	return query.Get(webrtcBalancerRedirectedParam) != ""
+}
+
+// webrtcBalancerLocation returns the URL to which a request is redirected,
+// that is marked as redirected.
+func webrtcBalancerLocation(instance string, u *url.URL) string {
+	q := u.Query()
+	q.Set(webrtcBalancerRedirectedParam, "1")
+	return strings.TrimSuffix(instance, "/") + u.EscapedPath() + "?" + q.Encode()
+}
+
+// webrtcBalancerIsLocal returns whether an instance is the one that received a request.
+func webrtcBalancerIsLocal(instance string, host string) bool {
+	u, err := url.Parse(instance)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
+
+// webrtcBalancer chooses the instance that serves a WHIP or WHEP request.
+type webrtcBalancer interface {
+	// choose returns the base URL of the chosen instance,
+	// or an empty string when the request must be served locally.
+	choose(req webrtcBalancerReq) (string, error)
+}
+
+type webrtcBalancerAssignment struct {
+	instance string
+	lastUse  time.Time
+}
+
+// webrtcBalancerRoundRobin assigns rooms to instances in a round-robin fashion.
+// Publishers and readers of a room are sent to the same instance.
+type webrtcBalancerRoundRobin struct {
+	instances []string
+
+	mutex       sync.Mutex
+	next        int
+	assignments map[string]*webrtcBalancerAssignment
+}
+
+func newWebRTCBalancerRoundRobin(instances []string) *webrtcBalancerRoundRobin {
+	return &webrtcBalancerRoundRobin{
+		instances:   instances,
+		assignments: make(map[string]*webrtcBalancerAssignment),
+	}
+}
+
+// choose implements webrtcBalancer.
+func (b *webrtcBalancerRoundRobin) choose(req webrtcBalancerReq) (string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+
+	for roomID, a := range b.assignments {
+		if now.Sub(a.lastUse) >= webrtcBalancerRoomTTL {
+			delete(b.assignments, roomID)
+		}
+	}
+
+	a, ok := b.assignments[req.RoomID]
+	if !ok {
+		a = &webrtcBalancerAssignment{
+			instance: b.instances[b.next],
+		}
+		b.next = (b.next + 1) % len(b.instances)
+		b.assignments[req.RoomID] = a
+	}
+
+	a.lastUse = now
+	return a.instance, nil
+}
+
+// webrtcBalancerHook asks an external HTTP server which instance must serve a request.
+// The server receives a webrtcBalancerReq and replies with {"url": "base URL"}.
+// An empty URL means that the request is served locally.
+type webrtcBalancerHook struct {
+	url string
+	hc  *http.Client
+}
+
+func newWebRTCBalancerHook(url string, timeout time.Duration) *webrtcBalancerHook {
+	return &webrtcBalancerHook{
+		url: url,
+		hc: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// choose implements webrtcBalancer.
+func (b *webrtcBalancerHook) choose(req webrtcBalancerReq) (string, error) {
+	enc, _ := json.Marshal(req)
+
+	res, err := b.hc.Post(b.url, "application/json", bytes.NewReader(enc))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	var out struct {
+		URL string `json:"url"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return "", err
+	}
+
+	return out.URL, nil
+}
+
+// balance is called by webRTCHTTPServer.
+// When the balancer fails or chooses this instance, the request is served locally.
+func (m *webRTCManager) balance(req webrtcBalancerReq) string {
+	if m.balancer == nil {
+		return ""
+	}
+
+	ur, err := m.balancer.choose(req)
+	if err != nil {
+		m.Log(logger.Warn, "balancer failed, serving request locally: %v", err)
+		return ""
+	}
+
+	if webrtcBalancerIsLocal(ur, req.host) {
+		return ""
+	}
+
+	return ur
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCBalancerRoundRobin(t *testing.T) {
+	b := newWebRTCBalancerRoundRobin([]string{"http://node1:8889", "http://node2:8889"})
+
+	ur, err := b.choose(webrtcBalancerReq{RoomID: "room1", Publish: true})
+	require.NoError(t, err)
+	require.Equal(t, "http://node1:8889", ur)
+
+	ur, err = b.choose(webrtcBalancerReq{RoomID: "room2", Publish: true})
+	require.NoError(t, err)
+	require.Equal(t, "http://node2:8889", ur)
+
+	// readers are sent to the instance of the room
+	ur, err = b.choose(webrtcBalancerReq{RoomID: "room1"})
+	require.NoError(t, err)
+	require.Equal(t, "http://node1:8889", ur)
+
+	ur, err = b.choose(webrtcBalancerReq{RoomID: "room3", Publish: true})
+	require.NoError(t, err)
+	require.Equal(t, "http://node1:8889", ur)
+
+	// inactive rooms are assigned again
+	b.assignments["room2"].lastUse = time.Now().Add(-webrtcBalancerRoomTTL)
+	ur, err = b.choose(webrtcBalancerReq{RoomID: "room2"})
+	require.NoError(t, err)
+	require.Equal(t, "http://node2:8889", ur)
+	require.Len(t, b.assignments, 3)
+}
+
+func TestWebRTCBalancerHook(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webrtcBalancerReq
+		err := json.NewDecoder(r.Body).Decode(&req)
+		require.NoError(t, err)
+
+		switch req.RoomID {
+		case "room1":
+			require.Equal(t, webrtcBalancerReq{
+				Path:    "mypath",
+				RoomID:  "room1",
+				Publish: true,
+				IP:      "1.2.3.4",
+				Query:   "a=b",
+			}, req)
+			w.Write([]byte(`{"url":"https://node1:8889"}`)) //nolint:errcheck
+
+		case "room2":
+			w.Write([]byte(`{"url":""}`)) //nolint:errcheck
+
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer hook.Close()
+
+	b := newWebRTCBalancerHook(hook.URL, 5*time.Second)
+
+	ur, err := b.choose(webrtcBalancerReq{
+		Path:    "mypath",
+		RoomID:  "room1",
+		Publish: true,
+		IP:      "1.2.3.4",
+		Query:   "a=b",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "https://node1:8889", ur)
+
+	ur, err = b.choose(webrtcBalancerReq{RoomID: "room2"})
+	require.NoError(t, err)
+	require.Equal(t, "", ur)
+
+	_, err = b.choose(webrtcBalancerReq{RoomID: "room3"})
+	require.EqualError(t, err, "bad status code: 500")
+
+	m := &webRTCManager{
+		balancer: b,
+		parent:   nilLogger{},
+	}
+	require.Equal(t, "", m.balance(webrtcBalancerReq{RoomID: "room3"}))
+}
+
+func TestWebRTCBalancerRedirect(t *testing.T) {
+	u, err := url.Parse("/mypath/whep?a=b")
+	require.NoError(t, err)
+
+	require.False(t, webrtcBalancerRedirected(u.Query()))
+
+	l := webrtcBalancerLocation("https://node1:8889/", u)
+	require.Equal(t, "https://node1:8889/mypath/whep?a=b&balanced=1", l)
+
+	// redirected requests are not redirected again
+	u, err = url.Parse(l)
+	require.NoError(t, err)
+	require.True(t, webrtcBalancerRedirected(u.Query()))
+
+	// requests are served locally when the chosen instance is this one
+	m := &webRTCManager{balancer: newWebRTCBalancerRoundRobin([]string{"https://node1:8889"})}
+	require.Equal(t, "", m.balance(webrtcBalancerReq{RoomID: "room1", host: "node1:8889"}))
+	require.Equal(t, "https://node1:8889", m.balance(webrtcBalancerReq{RoomID: "room1", host: "node2:8889"}))
+}
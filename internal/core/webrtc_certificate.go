@@ -0,0 +1,102 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	webrtcCertificateValidity = 10 * 365 * 24 * time.Hour
+)
+
+func fileExists(fpath string) bool {
+	_, err := os.Stat(fpath)
+	return err == nil
+}
+
+// webrtcGenerateCertificate generates a long-lived, self-signed DTLS certificate
+// and saves it in PEM format.
+func webrtcGenerateCertificate(keyPath string, certPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "mediamtx"},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     now.Add(webrtcCertificateValidity),
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o644)
+}
+
+// webrtcLoadCertificate loads the DTLS certificate of the server.
+// If files do not exist, the certificate is generated and saved,
+// in order to keep the same fingerprint across restarts.
+func webrtcLoadCertificate(keyPath string, certPath string) (*webrtc.Certificate, error) {
+	keyExists := fileExists(keyPath)
+	certExists := fileExists(certPath)
+
+	switch {
+	case !keyExists && !certExists:
+		err := webrtcGenerateCertificate(keyPath, certPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate DTLS certificate: %v", err)
+		}
+
+	case !keyExists || !certExists:
+		return nil, fmt.Errorf("DTLS key and certificate must both exist or both be missing")
+	}
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load DTLS certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(cert.NotAfter) {
+		return nil, fmt.Errorf("DTLS certificate expired on %v", cert.NotAfter)
+	}
+
+	ret := webrtc.CertificateFromX509(pair.PrivateKey, cert)
+	return &ret, nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCLoadCertificate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-dtls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "dtls.key")
+	certPath := filepath.Join(dir, "dtls.crt")
+
+	cert1, err := webrtcLoadCertificate(keyPath, certPath)
+	require.NoError(t, err)
+
+	fp1, err := cert1.GetFingerprints()
+	require.NoError(t, err)
+
+	st, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), st.Mode().Perm())
+
+	cert2, err := webrtcLoadCertificate(keyPath, certPath)
+	require.NoError(t, err)
+
+	fp2, err := cert2.GetFingerprints()
+	require.NoError(t, err)
+	require.Equal(t, fp1, fp2)
+
+	err = os.Remove(certPath)
+	require.NoError(t, err)
+
+	_, err = webrtcLoadCertificate(keyPath, certPath)
+	require.EqualError(t, err, "DTLS key and certificate must both exist or both be missing")
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// webrtcDataChannelLimits are the limits applied to the data channel messages of a session.
+type webrtcDataChannelLimits struct {
+	maxSize uint64
+	maxRate int
+	action  string
+}
+
+func newWebRTCDataChannelLimits(c *conf.Conf) webrtcDataChannelLimits {
+	return webrtcDataChannelLimits{
+		maxSize: uint64(c.WebRTCDataChannelMaxSize),
+		maxRate: c.WebRTCDataChannelMaxRate,
+		action:  c.WebRTCDataChannelLimitAction,
+	}
+}
+
+type webrtcDataChannelVerdict int
+
+const (
+	webrtcDataChannelAccept webrtcDataChannelVerdict = iota
+	webrtcDataChannelDrop
+	webrtcDataChannelClose
+)
+
+// webrtcDataChannelLimiter applies limits to the data channel messages of a session.
+// The rate is limited with a token bucket that allows bursts of one second.
+// Tokens are shared by all the data channels of the session, whose messages are
+// received by different goroutines, therefore they are protected by a mutex.
+type webrtcDataChannelLimiter struct {
+	limits webrtcDataChannelLimits
+
+	mutex   sync.Mutex
+	tokens  float64
+	last    time.Time
+	dropped uint64
+}
+
+func newWebRTCDataChannelLimiter(limits webrtcDataChannelLimits) *webrtcDataChannelLimiter {
+	return &webrtcDataChannelLimiter{
+		limits: limits,
+		tokens: float64(limits.maxRate),
+	}
+}
+
+// check returns what to do with a message. When the message must be throttled,
+// it is accepted after the returned delay.
+func (l *webrtcDataChannelLimiter) check(size int, now time.Time) (webrtcDataChannelVerdict, time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.limits.maxSize != 0 && uint64(size) > l.limits.maxSize {
+		return l.exceeded(fmt.Errorf("message size (%d) exceeds the limit (%d)", size, l.limits.maxSize))
+	}
+
+	if l.limits.maxRate == 0 {
+		return webrtcDataChannelAccept, 0, nil
+	}
+
+	rate := float64(l.limits.maxRate)
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * rate
+		if l.tokens > rate {
+			l.tokens = rate
+		}
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return webrtcDataChannelAccept, 0, nil
+	}
+
+	if l.limits.action == "throttle" {
+		// the token is consumed in advance, delaying next messages too
+		delay := time.Duration((1 - l.tokens) / rate * float64(time.Second))
+		l.tokens--
+		return webrtcDataChannelAccept, delay, nil
+	}
+
+	return l.exceeded(fmt.Errorf("message rate exceeds the limit (%d/s)", l.limits.maxRate))
+}
+
+func (l *webrtcDataChannelLimiter) exceeded(err error) (webrtcDataChannelVerdict, time.Duration, error) {
+	if l.limits.action == "close" {
+		return webrtcDataChannelClose, 0, err
+	}
+
+	l.dropped++
+	return webrtcDataChannelDrop, 0, err
+}
+
+// limitDataChannelMessage applies data channel limits to a message of the session
+// and returns whether the message can be processed.
+// Throttled messages block the data channel, that propagates backpressure to the sender.
+func (s *webRTCSession) limitDataChannelMessage(msg webrtc.DataChannelMessage) bool {
+	verdict, delay, err := s.dcLimiter.check(len(msg.Data), time.Now())
+
+	switch verdict {
+	case webrtcDataChannelDrop:
+		// only the first drop is logged, in order not to flood the log
+		if s.dcLimiter.droppedCount() == 1 {
+			s.Log(logger.Warn, "data channel message dropped: %v", err)
+		}
+		return false
+
+	case webrtcDataChannelClose:
+		s.Log(logger.Warn, "closing session: %v", err)
+		s.close()
+		return false
+	}
+
+	if delay != 0 {
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *webrtcDataChannelLimiter) droppedCount() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.dropped
+}
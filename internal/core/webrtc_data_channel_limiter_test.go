@@ -0,0 +1,70 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCDataChannelLimiter(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("size", func(t *testing.T) {
+		l := newWebRTCDataChannelLimiter(webrtcDataChannelLimits{maxSize: 10, action: "throttle"})
+
+		verdict, _, err := l.check(10, now)
+		require.NoError(t, err)
+		require.Equal(t, webrtcDataChannelAccept, verdict)
+
+		// oversized messages can't be throttled
+		verdict, _, err = l.check(11, now)
+		require.EqualError(t, err, "message size (11) exceeds the limit (10)")
+		require.Equal(t, webrtcDataChannelDrop, verdict)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		l := newWebRTCDataChannelLimiter(webrtcDataChannelLimits{maxRate: 2, action: "drop"})
+
+		for i := 0; i < 2; i++ {
+			verdict, _, _ := l.check(1, now)
+			require.Equal(t, webrtcDataChannelAccept, verdict)
+		}
+
+		verdict, _, err := l.check(1, now)
+		require.EqualError(t, err, "message rate exceeds the limit (2/s)")
+		require.Equal(t, webrtcDataChannelDrop, verdict)
+		require.Equal(t, uint64(1), l.droppedCount())
+
+		verdict, _, _ = l.check(1, now.Add(500*time.Millisecond))
+		require.Equal(t, webrtcDataChannelAccept, verdict)
+	})
+
+	t.Run("throttle", func(t *testing.T) {
+		l := newWebRTCDataChannelLimiter(webrtcDataChannelLimits{maxRate: 4, action: "throttle"})
+
+		for i := 0; i < 4; i++ {
+			verdict, delay, _ := l.check(1, now)
+			require.Equal(t, webrtcDataChannelAccept, verdict)
+			require.Equal(t, time.Duration(0), delay)
+		}
+
+		verdict, delay, _ := l.check(1, now)
+		require.Equal(t, webrtcDataChannelAccept, verdict)
+		require.Equal(t, 250*time.Millisecond, delay)
+
+		_, delay, _ = l.check(1, now)
+		require.Equal(t, 500*time.Millisecond, delay)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		l := newWebRTCDataChannelLimiter(webrtcDataChannelLimits{maxRate: 1, action: "close"})
+
+		verdict, _, _ := l.check(1, now)
+		require.Equal(t, webrtcDataChannelAccept, verdict)
+
+		verdict, _, err := l.check(1, now)
+		require.Error(t, err)
+		require.Equal(t, webrtcDataChannelClose, verdict)
+	})
+}
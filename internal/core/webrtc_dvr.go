@@ -0,0 +1,362 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	webrtcDVRPartDuration    = 1 * time.Second
+	webrtcDVRSegmentDuration = 2 * time.Second
+	webrtcDVRPollPeriod      = 500 * time.Millisecond
+	webrtcDVRWaitTimeout     = 10 * time.Second
+)
+
+// webrtcDVROffset returns the offset requested by a reader
+// with the "start" query parameter, that must be negative.
+func webrtcDVROffset(query string) (time.Duration, bool, error) {
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return 0, false, err
+	}
+
+	v := vals.Get("start")
+	if v == "" {
+		return 0, false, nil
+	}
+
+	offset, err := time.ParseDuration(v)
+	if err != nil || offset >= 0 {
+		return 0, false, fmt.Errorf("invalid start: '%s'", v)
+	}
+
+	return offset, true, nil
+}
+
+type webrtcDVRTrack struct {
+	initTrack *fmp4.InitTrack
+	media     *media.Media
+	format    formats.Format
+}
+
+type webrtcDVRSample struct {
+	track  *webrtcDVRTrack
+	sample *fmp4.PartSample
+	dts    time.Time
+}
+
+// webrtcDVRPlayer reads segments of a path written by a pathRecorder
+// and writes their content to a stream, at the same pace they were recorded.
+type webrtcDVRPlayer struct {
+	recordPath string
+	pathName   string
+	start      time.Time
+	parent     logger.Writer
+
+	ctx        context.Context
+	ctxCancel  func()
+	init       *fmp4.Init
+	tracks     map[int]*webrtcDVRTrack
+	stream     *stream.Stream
+	playStart  time.Time
+	started    map[int]struct{}
+	timeline   playbackTimeline
+	lastPlayed time.Time
+
+	done chan struct{}
+}
+
+func newWebRTCDVRPlayer(
+	recordPath string,
+	pathName string,
+	offset time.Duration,
+	udpMaxPayloadSize int,
+	parent logger.Writer,
+) (*webrtcDVRPlayer, error) {
+	start := time.Now().Add(offset)
+
+	segments, err := playbackFindSegments(recordPath, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	segments = playbackSelectSegments(segments, start, -offset)
+	if segments == nil {
+		return nil, fmt.Errorf("no DVR segments available")
+	}
+
+	init, _, err := playbackReadSegment(segments[0].filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make(map[int]*webrtcDVRTrack)
+	var medias media.Medias
+
+	for _, initTrack := range init.Tracks {
+		track := &webrtcDVRTrack{initTrack: initTrack}
+
+		switch codec := initTrack.Codec.(type) {
+		case *fmp4.CodecH264:
+			track.format = &formats.H264{
+				PayloadTyp:        96,
+				SPS:               codec.SPS,
+				PPS:               codec.PPS,
+				PacketizationMode: 1,
+			}
+			track.media = &media.Media{
+				Type:    media.TypeVideo,
+				Formats: []formats.Format{track.format},
+			}
+
+		case *fmp4.CodecOpus:
+			track.format = &formats.Opus{
+				PayloadTyp: 111,
+				IsStereo:   (codec.ChannelCount == 2),
+			}
+			track.media = &media.Media{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{track.format},
+			}
+
+		case *fmp4.CodecMPEG4Audio:
+			track.format = &formats.MPEG4AudioGeneric{
+				PayloadTyp:       96,
+				Config:           &codec.Config,
+				SizeLength:       13,
+				IndexLength:      3,
+				IndexDeltaLength: 3,
+			}
+			track.media = &media.Media{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{track.format},
+			}
+
+		default:
+			continue
+		}
+
+		tracks[initTrack.ID] = track
+		medias = append(medias, track.media)
+	}
+
+	strm, err := stream.New(
+		udpMaxPayloadSize,
+		medias,
+		true,
+		new(uint64),
+		parent,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	return &webrtcDVRPlayer{
+		recordPath: recordPath,
+		pathName:   pathName,
+		start:      start,
+		parent:     parent,
+		ctx:        ctx,
+		ctxCancel:  ctxCancel,
+		init:       init,
+		tracks:     tracks,
+		stream:     strm,
+		started:    make(map[int]struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Log is the main logging function.
+func (p *webrtcDVRPlayer) Log(level logger.Level, format string, args ...interface{}) {
+	p.parent.Log(level, "[DVR] "+format, args...)
+}
+
+// play starts writing samples to the stream.
+// It must be called after readers have been added to the stream.
+func (p *webrtcDVRPlayer) play() {
+	p.playStart = time.Now()
+	go p.run()
+}
+
+func (p *webrtcDVRPlayer) close() {
+	p.ctxCancel()
+	if !p.playStart.IsZero() {
+		<-p.done
+	}
+	p.stream.Close()
+}
+
+func (p *webrtcDVRPlayer) run() {
+	defer close(p.done)
+
+	err := p.runInner()
+	if p.ctx.Err() == nil {
+		p.Log(logger.Info, "stopped: %v", err)
+	}
+}
+
+func (p *webrtcDVRPlayer) runInner() error {
+	lastNewSegment := time.Now()
+
+	for {
+		segments, err := playbackFindSegments(p.recordPath, p.pathName)
+		if err != nil {
+			return err
+		}
+
+		// the last segment is being recorded and is read when a newer one exists.
+		var toPlay []*playbackSegment
+		for i := 0; i < (len(segments) - 1); i++ {
+			if segments[i].start.After(p.lastPlayed) && segments[i+1].start.After(p.start) {
+				toPlay = append(toPlay, segments[i])
+			}
+		}
+
+		if toPlay != nil {
+			lastNewSegment = time.Now()
+
+			for _, seg := range toPlay {
+				err := p.playSegment(seg)
+				if err != nil {
+					return err
+				}
+				p.lastPlayed = seg.start
+			}
+			continue
+		}
+
+		if time.Since(lastNewSegment) >= webrtcDVRWaitTimeout {
+			return fmt.Errorf("no more segments available")
+		}
+
+		select {
+		case <-time.After(webrtcDVRPollPeriod):
+		case <-p.ctx.Done():
+			return fmt.Errorf("terminated")
+		}
+	}
+}
+
+func (p *webrtcDVRPlayer) playSegment(seg *playbackSegment) error {
+	init, parts, err := playbackReadSegment(seg.filename)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(init, p.init) {
+		p.Log(logger.Warn, "skipping segment '%s' since it has different tracks", seg.filename)
+		return nil
+	}
+
+	if len(parts) == 0 {
+		return nil
+	}
+
+	p.timeline.addSegment(seg, playbackSegmentStartDTS(init, parts))
+
+	for _, part := range parts {
+		var samples []*webrtcDVRSample
+
+		for _, pt := range part.Tracks {
+			track, ok := p.tracks[pt.ID]
+			if !ok {
+				continue
+			}
+
+			dts := durationMp4ToGo(pt.BaseTime, track.initTrack.TimeScale)
+
+			for _, sample := range pt.Samples {
+				samples = append(samples, &webrtcDVRSample{
+					track:  track,
+					sample: sample,
+					dts:    p.timeline.date(dts),
+				})
+				dts += durationMp4ToGo(uint64(sample.Duration), track.initTrack.TimeScale)
+			}
+		}
+
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].dts.Before(samples[j].dts)
+		})
+
+		for _, sample := range samples {
+			err := p.playSample(sample)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *webrtcDVRPlayer) playSample(sample *webrtcDVRSample) error {
+	if sample.dts.Before(p.start) {
+		return nil
+	}
+
+	track := sample.track
+
+	// video starts with a key frame
+	if _, ok := p.started[track.initTrack.ID]; !ok {
+		if track.initTrack.Codec.IsVideo() && sample.sample.IsNonSyncSample {
+			return nil
+		}
+		p.started[track.initTrack.ID] = struct{}{}
+	}
+
+	dts := sample.dts.Sub(p.start)
+
+	select {
+	case <-time.After(time.Until(p.playStart.Add(dts))):
+	case <-p.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+
+	pts := dts + time.Duration(sample.sample.PTSOffset)*time.Second/time.Duration(track.initTrack.TimeScale)
+	base := formatprocessor.BaseUnit{NTP: time.Now()}
+
+	switch track.format.(type) {
+	case *formats.H264:
+		au, err := sample.sample.GetH26x()
+		if err != nil {
+			return err
+		}
+
+		p.stream.WriteUnit(track.media, track.format, &formatprocessor.UnitH264{
+			BaseUnit: base,
+			PTS:      pts,
+			AU:       au,
+		})
+
+	case *formats.Opus:
+		p.stream.WriteUnit(track.media, track.format, &formatprocessor.UnitOpus{
+			BaseUnit: base,
+			PTS:      pts,
+			Packets:  [][]byte{sample.sample.Payload},
+		})
+
+	case *formats.MPEG4AudioGeneric:
+		p.stream.WriteUnit(track.media, track.format, &formatprocessor.UnitMPEG4AudioGeneric{
+			BaseUnit: base,
+			PTS:      pts,
+			AUs:      [][]byte{sample.sample.Payload},
+		})
+	}
+
+	return nil
+}
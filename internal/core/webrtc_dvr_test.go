@@ -0,0 +1,76 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+)
+
+func TestWebRTCDVROffset(t *testing.T) {
+	offset, ok, err := webrtcDVROffset("start=-120s&other=1")
+	require.NoError(t, err)
+	require.Equal(t, true, ok)
+	require.Equal(t, -120*time.Second, offset)
+
+	_, ok, err = webrtcDVROffset("other=1")
+	require.NoError(t, err)
+	require.Equal(t, false, ok)
+
+	_, _, err = webrtcDVROffset("start=120s")
+	require.EqualError(t, err, "invalid start: '120s'")
+}
+
+func TestWebRTCDVRPlayer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-dvr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "%path", "%Y-%m-%d_%H-%M-%S-%f")
+	recordStart := time.Now()
+	writeTestRecording(t, recordPath)
+
+	_, err = newWebRTCDVRPlayer(recordPath, "otherpath", -10*time.Second, 1472, nilLogger{})
+	require.EqualError(t, err, "no DVR segments available")
+
+	// join when the recording started
+	p, err := newWebRTCDVRPlayer(recordPath, "mypath", -time.Since(recordStart), 1472, nilLogger{})
+	require.NoError(t, err)
+	defer p.close()
+
+	var videoFormat *formats.H264
+	videoMedia := p.stream.Medias().FindFormat(&videoFormat)
+	require.NotNil(t, videoMedia)
+	require.Equal(t, testFormatH264.SPS, videoFormat.SPS)
+
+	var audioFormat *formats.MPEG4AudioGeneric
+	require.NotNil(t, p.stream.Medias().FindFormat(&audioFormat))
+
+	received := make(chan *formatprocessor.UnitH264, 20)
+	p.stream.AddReader(p, videoMedia, videoFormat, func(u formatprocessor.Unit) {
+		received <- u.(*formatprocessor.UnitH264)
+	})
+	defer p.stream.RemoveReader(p)
+
+	p.play()
+
+	// the last segment is not played since it may be still recorded
+	var prevPTS time.Duration
+	for i := 0; i < 10; i++ {
+		select {
+		case u := <-received:
+			if i != 0 {
+				require.Greater(t, u.PTS, prevPTS)
+			}
+			prevPTS = u.PTS
+			require.Equal(t, []byte{5, 1}, u.AU[len(u.AU)-1])
+		case <-time.After(3 * time.Second):
+			t.Fatalf("unit %d not received", i)
+		}
+	}
+}
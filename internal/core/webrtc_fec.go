@@ -0,0 +1,151 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/bluenviron/mediamtx/internal/ulpfec"
+)
+
+const (
+	webrtcMimeTypeRED    = "video/red"
+	webrtcMimeTypeULPFEC = "video/ulpfec"
+)
+
+// codecs used to send forward error correction of video.
+var fecCodecs = []webrtc.RTPCodecParameters{
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtcMimeTypeRED,
+			ClockRate: 90000,
+		},
+		PayloadType: 116,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtcMimeTypeULPFEC,
+			ClockRate: 90000,
+		},
+		PayloadType: 117,
+	},
+}
+
+// webrtcFECGroupSize returns the number of video packets protected by each FEC packet.
+func webrtcFECGroupSize(overhead int) int {
+	n := (100 + overhead/2) / overhead
+	if n < 1 {
+		return 1
+	}
+	if n > ulpfec.MaxGroupSize {
+		return ulpfec.MaxGroupSize
+	}
+	return n
+}
+
+func webrtcFindCodec(codecs []webrtc.RTPCodecParameters, mimeType string) (uint8, bool) {
+	for _, codec := range codecs {
+		if strings.EqualFold(codec.MimeType, mimeType) {
+			return uint8(codec.PayloadType), true
+		}
+	}
+	return 0, false
+}
+
+// webrtcFECWriter sends video packets inside RED payloads, followed by ULPFEC packets.
+// Since FEC packets share the sequence numbers of video packets, these are renumbered.
+type webrtcFECWriter struct {
+	writeStream webrtc.TrackLocalWriter
+	ssrc        uint32
+	mediaPT     uint8
+	redPT       uint8
+	fecPT       uint8
+	encoder     *ulpfec.Encoder
+	seq         uint16
+}
+
+// newWebRTCFECWriter allocates a webrtcFECWriter.
+// It returns nil when the reader doesn't support RED or ULPFEC.
+func newWebRTCFECWriter(
+	ctx webrtc.TrackLocalContext,
+	mediaPT uint8,
+	overhead int,
+) (*webrtcFECWriter, error) {
+	redPT, ok := webrtcFindCodec(ctx.CodecParameters(), webrtcMimeTypeRED)
+	if !ok {
+		return nil, nil
+	}
+
+	fecPT, ok := webrtcFindCodec(ctx.CodecParameters(), webrtcMimeTypeULPFEC)
+	if !ok {
+		return nil, nil
+	}
+
+	encoder := &ulpfec.Encoder{
+		GroupSize: webrtcFECGroupSize(overhead),
+	}
+	err := encoder.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	seq, err := randInt63n(65536)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webrtcFECWriter{
+		writeStream: ctx.WriteStream(),
+		ssrc:        uint32(ctx.SSRC()),
+		mediaPT:     mediaPT,
+		redPT:       redPT,
+		fecPT:       fecPT,
+		encoder:     encoder,
+		seq:         uint16(seq),
+	}, nil
+}
+
+// writeRTP writes a video packet, and a FEC packet when a group is complete.
+// It returns the number of written bytes.
+func (w *webrtcFECWriter) writeRTP(pkt *rtp.Packet) (int, error) {
+	// FEC is computed on the video packet as it is seen by the reader after
+	// removing the RED encapsulation.
+	media := &rtp.Packet{
+		Header:  pkt.Header,
+		Payload: pkt.Payload,
+	}
+	media.SSRC = w.ssrc
+	media.PayloadType = w.mediaPT
+	media.SequenceNumber = w.seq
+	w.seq++
+
+	fec, err := w.encoder.Encode(media)
+	if err != nil {
+		return 0, err
+	}
+
+	header := media.Header
+	header.PayloadType = w.redPT
+
+	n, err := w.writeStream.WriteRTP(&header, ulpfec.EncodeRED(w.mediaPT, media.Payload))
+	if err != nil {
+		return n, err
+	}
+
+	if fec == nil {
+		return n, nil
+	}
+
+	fecHeader := &rtp.Header{
+		Version:        2,
+		PayloadType:    w.redPT,
+		SequenceNumber: w.seq,
+		Timestamp:      w.encoder.Timestamp(),
+		SSRC:           w.ssrc,
+	}
+	w.seq++
+
+	n2, err := w.writeStream.WriteRTP(fecHeader, ulpfec.EncodeRED(w.fecPT, fec))
+	return n + n2, err
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/ulpfec"
+)
+
+func TestWebRTCFECGroupSize(t *testing.T) {
+	for _, ca := range []struct {
+		overhead int
+		size     int
+	}{
+		{100, 1},
+		{50, 2},
+		{30, 3},
+		{10, 10},
+		{1, 48},
+	} {
+		require.Equal(t, ca.size, webrtcFECGroupSize(ca.overhead))
+	}
+}
+
+func TestWebRTCFEC(t *testing.T) {
+	serverAPI, err := webrtcNewAPI(webrtcAPIConf{fec: true})
+	require.NoError(t, err)
+
+	server, err := serverAPI.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	track, err := newWebRTCCountedTrack(videoCodecs[len(videoCodecs)-1].RTPCodecCapability,
+		"video", "stream")
+	require.NoError(t, err)
+	track.fecOverhead = 50
+
+	_, err = server.AddTrack(track)
+	require.NoError(t, err)
+
+	clientAPI, err := webrtcNewAPI(webrtcAPIConf{fec: true})
+	require.NoError(t, err)
+
+	client, err := clientAPI.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+
+	recv := make(chan *rtp.Packet, 100)
+
+	client.OnTrack(func(tr *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			pkt, _, err := tr.ReadRTP()
+			if err != nil {
+				return
+			}
+			recv <- pkt
+		}
+	})
+
+	offer, err := server.CreateOffer(nil)
+	require.NoError(t, err)
+
+	gatherComplete := webrtc.GatheringCompletePromise(server)
+	err = server.SetLocalDescription(offer)
+	require.NoError(t, err)
+	<-gatherComplete
+
+	err = client.SetRemoteDescription(*server.LocalDescription())
+	require.NoError(t, err)
+
+	answer, err := client.CreateAnswer(nil)
+	require.NoError(t, err)
+
+	gatherComplete = webrtc.GatheringCompletePromise(client)
+	err = client.SetLocalDescription(answer)
+	require.NoError(t, err)
+	<-gatherComplete
+
+	err = server.SetRemoteDescription(*client.LocalDescription())
+	require.NoError(t, err)
+
+	media := make(map[uint16]*rtp.Packet)
+
+	// checks whether a FEC packet allows to recover the first of the two previous video packets
+	process := func(pkt *rtp.Packet) bool {
+		require.Equal(t, uint8(fecCodecs[0].PayloadType), pkt.PayloadType)
+
+		pt, block, err := ulpfec.DecodeRED(pkt.Payload)
+		require.NoError(t, err)
+
+		if pt != uint8(fecCodecs[1].PayloadType) {
+			pkt.PayloadType = pt
+			pkt.Payload = block
+			media[pkt.SequenceNumber] = pkt
+			return false
+		}
+
+		first, ok := media[pkt.SequenceNumber-2]
+		if !ok {
+			return false
+		}
+		second, ok := media[pkt.SequenceNumber-1]
+		if !ok {
+			return false
+		}
+
+		rec, err := ulpfec.Recover(block, pkt.SSRC, []*rtp.Packet{second})
+		require.NoError(t, err)
+		require.Equal(t, first.SequenceNumber, rec.SequenceNumber)
+		require.Equal(t, first.Timestamp, rec.Timestamp)
+		require.Equal(t, first.PayloadType, rec.PayloadType)
+		require.Equal(t, first.Payload, rec.Payload)
+		return true
+	}
+
+	for seq := uint16(1); ; seq++ {
+		require.Less(t, seq, uint16(200))
+
+		err = track.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				SequenceNumber: seq,
+				Timestamp:      uint32(seq) * 3000,
+				Marker:         true,
+			},
+			Payload: []byte{0x05, byte(seq), 0x03, 0x04},
+		})
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		for len(recv) > 0 {
+			if process(<-recv) {
+				return
+			}
+		}
+	}
+}
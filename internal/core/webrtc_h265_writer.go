@@ -0,0 +1,83 @@
+package core
+
+import (
+	"io"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/pion/rtp"
+)
+
+// webrtcH265Writer writes RTP/H265 packets into an Annex-B file,
+// like h264writer does with H264.
+type webrtcH265Writer struct {
+	w       io.WriteCloser
+	decoder *rtph265.Decoder
+	started bool
+}
+
+func newWebRTCH265Writer(w io.WriteCloser) (*webrtcH265Writer, error) {
+	decoder := &rtph265.Decoder{}
+	err := decoder.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return &webrtcH265Writer{
+		w:       w,
+		decoder: decoder,
+	}, nil
+}
+
+// WriteRTP implements media.Writer.
+func (w *webrtcH265Writer) WriteRTP(pkt *rtp.Packet) error {
+	au, _, err := w.decoder.DecodeUntilMarker(pkt)
+	if err != nil {
+		// incomplete or corrupted access units are skipped
+		return nil
+	}
+
+	// the file must start with a random access unit, otherwise it can't be decoded
+	if !w.started {
+		if !h265.IsRandomAccess(au) {
+			return nil
+		}
+		w.started = true
+	}
+
+	buf, err := h264.AnnexBMarshal(au)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(buf)
+	return err
+}
+
+// Close implements media.Writer.
+func (w *webrtcH265Writer) Close() error {
+	return w.w.Close()
+}
+
+// h265PayloadIsKeyFrame checks whether a RTP/H265 payload starts a key frame,
+// that is, whether it starts with a VPS.
+func h265PayloadIsKeyFrame(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+
+	switch h265.NALUType((payload[0] >> 1) & 0b111111) {
+	case h265.NALUType_VPS_NUT:
+		return true
+
+	case h265.NALUType_AggregationUnit:
+		// first NALU of the aggregation packet
+		if len(payload) < 5 {
+			return false
+		}
+		return h265.NALUType((payload[4]>>1)&0b111111) == h265.NALUType_VPS_NUT
+	}
+
+	return false
+}
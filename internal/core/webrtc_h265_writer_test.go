@@ -0,0 +1,71 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph265"
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestWebRTCH265Writer(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := newWebRTCH265Writer(nopWriteCloser{&buf})
+	require.NoError(t, err)
+
+	enc := &rtph265.Encoder{PayloadType: 96}
+	err = enc.Init()
+	require.NoError(t, err)
+
+	vps := []byte{0x40, 0x01, 0x0c}
+	sps := []byte{0x42, 0x01, 0x01}
+	pps := []byte{0x44, 0x01, 0xc0}
+	idr := []byte{0x26, 0x01, 0xaf}
+	nonIDR := []byte{0x02, 0x01, 0xd0}
+
+	for i, au := range [][][]byte{
+		{nonIDR},
+		{vps, sps, pps, idr},
+		{nonIDR},
+	} {
+		pkts, err := enc.Encode(au, 0)
+		require.NoError(t, err)
+
+		for _, pkt := range pkts {
+			err = w.WriteRTP(pkt)
+			require.NoError(t, err)
+		}
+
+		// the file starts with a random access unit
+		if i == 0 {
+			require.Equal(t, 0, buf.Len())
+		}
+	}
+
+	require.Equal(t, []byte{
+		0, 0, 0, 1, 0x40, 0x01, 0x0c,
+		0, 0, 0, 1, 0x42, 0x01, 0x01,
+		0, 0, 0, 1, 0x44, 0x01, 0xc0,
+		0, 0, 0, 1, 0x26, 0x01, 0xaf,
+		0, 0, 0, 1, 0x02, 0x01, 0xd0,
+	}, buf.Bytes())
+
+	err = w.Close()
+	require.NoError(t, err)
+}
+
+func TestH265PayloadIsKeyFrame(t *testing.T) {
+	require.True(t, h265PayloadIsKeyFrame([]byte{0x40, 0x01, 0x0c}))
+	require.True(t, h265PayloadIsKeyFrame([]byte{0x60, 0x01, 0x00, 0x03, 0x40, 0x01, 0x0c}))
+	require.False(t, h265PayloadIsKeyFrame([]byte{0x02, 0x01, 0xd0}))
+}
@@ -0,0 +1,324 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	// the health of a track is computed on samples of this duration.
+	webrtcHealthSampleDuration = 1 * time.Second
+
+	// number of samples that are taken into account.
+	webrtcHealthSampleCount = 10
+
+	// video is considered frozen when frames don't progress within this period,
+	webrtcHealthFreezeTimeout = 2 * time.Second
+
+	// or when key frames, that are requested periodically, are not received within this period.
+	webrtcHealthKeyFrameTimeout = 3 * keyFrameInterval
+
+	// penalties applied to the score, that starts from 100.
+	webrtcHealthMaxLossPenalty      = 50
+	webrtcHealthLossPenaltyFactor   = 500 // 10% loss gives the maximum penalty
+	webrtcHealthMaxBitratePenalty   = 25
+	webrtcHealthBitratePenaltyScale = 25 // bitrate deviating by 100% gives the maximum penalty
+	webrtcHealthFreezePenalty       = 60
+
+	webrtcHealthCheckPeriod = 1 * time.Second
+)
+
+type webrtcHealthSample struct {
+	bytes    uint64
+	expected uint64
+	received uint64
+}
+
+// webrtcTrackHealth measures the health of an incoming track.
+type webrtcTrackHealth struct {
+	video      bool
+	isKeyFrame func([]byte) bool // nil when key frames of the codec can't be detected
+
+	mutex         sync.Mutex
+	initialized   bool
+	maxSeq        uint16
+	lastTimestamp uint32
+	lastProgress  time.Time
+	lastKeyFrame  time.Time
+	sampleStart   time.Time
+	cur           webrtcHealthSample
+	samples       []webrtcHealthSample
+}
+
+func newWebRTCTrackHealth(video bool, isKeyFrame func([]byte) bool) *webrtcTrackHealth {
+	return &webrtcTrackHealth{
+		video:      video,
+		isKeyFrame: isKeyFrame,
+	}
+}
+
+// observe is called when a RTP packet is received.
+func (h *webrtcTrackHealth) observe(pkt *rtp.Packet, now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.initialized {
+		h.initialized = true
+		h.maxSeq = pkt.SequenceNumber
+		h.lastTimestamp = pkt.Timestamp
+		h.lastProgress = now
+		h.lastKeyFrame = now
+		h.sampleStart = now
+		h.cur.expected = 1
+	} else {
+		h.roll(now)
+
+		// packets that are reordered or duplicated don't increase the expected count
+		if diff := int16(pkt.SequenceNumber - h.maxSeq); diff > 0 {
+			h.cur.expected += uint64(diff)
+			h.maxSeq = pkt.SequenceNumber
+		}
+
+		if pkt.Timestamp != h.lastTimestamp {
+			h.lastTimestamp = pkt.Timestamp
+			h.lastProgress = now
+		}
+	}
+
+	h.cur.received++
+	h.cur.bytes += uint64(len(pkt.Payload))
+
+	if h.isKeyFrame != nil && h.isKeyFrame(pkt.Payload) {
+		h.lastKeyFrame = now
+	}
+}
+
+// roll closes the samples that ended before now.
+func (h *webrtcTrackHealth) roll(now time.Time) {
+	for i := 0; now.Sub(h.sampleStart) >= webrtcHealthSampleDuration; i++ {
+		// after a long silence, the samples are all empty
+		if i == webrtcHealthSampleCount {
+			h.sampleStart = now
+			break
+		}
+
+		h.samples = append(h.samples, h.cur)
+		if len(h.samples) > webrtcHealthSampleCount {
+			h.samples = h.samples[1:]
+		}
+
+		h.cur = webrtcHealthSample{}
+		h.sampleStart = h.sampleStart.Add(webrtcHealthSampleDuration)
+	}
+}
+
+// report returns the health of the track, or nil if no packet has been received yet.
+func (h *webrtcTrackHealth) report(now time.Time) *apiWebRTCSessionHealth {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.initialized {
+		return nil
+	}
+
+	h.roll(now)
+
+	var expected, received uint64
+	for _, s := range h.samples {
+		expected += s.expected
+		received += s.received
+	}
+
+	loss := 0.0
+	if expected != 0 && received < expected {
+		loss = float64(expected-received) / float64(expected)
+	}
+
+	variation := 0.0
+	if len(h.samples) >= 2 {
+		mean := 0.0
+		for _, s := range h.samples {
+			mean += float64(s.bytes)
+		}
+		mean /= float64(len(h.samples))
+
+		if mean != 0 {
+			sum := 0.0
+			for _, s := range h.samples {
+				d := float64(s.bytes) - mean
+				sum += d * d
+			}
+			variation = math.Sqrt(sum/float64(len(h.samples))) / mean
+		}
+	}
+
+	frozen := h.video && (now.Sub(h.lastProgress) >= webrtcHealthFreezeTimeout ||
+		(h.isKeyFrame != nil && now.Sub(h.lastKeyFrame) >= webrtcHealthKeyFrameTimeout))
+
+	score := 100.0
+	score -= math.Min(loss*webrtcHealthLossPenaltyFactor, webrtcHealthMaxLossPenalty)
+	score -= math.Min(variation*webrtcHealthBitratePenaltyScale, webrtcHealthMaxBitratePenalty)
+	if frozen {
+		score -= webrtcHealthFreezePenalty
+	}
+
+	return &apiWebRTCSessionHealth{
+		Score:            int(math.Max(0, math.Round(score))),
+		PacketLoss:       loss,
+		BitrateVariation: variation,
+		Frozen:           frozen,
+		Ready:            len(h.samples) == webrtcHealthSampleCount,
+	}
+}
+
+// webrtcHealthOfTracks returns the health of the least healthy track,
+// or nil if no track has received packets yet.
+func webrtcHealthOfTracks(tracks []*webRTCIncomingTrack, now time.Time) *apiWebRTCSessionHealth {
+	var worst *apiWebRTCSessionHealth
+	frozen := false
+	ready := true
+
+	for _, track := range tracks {
+		h := track.health.report(now)
+		if h == nil {
+			continue
+		}
+
+		if worst == nil || h.Score < worst.Score {
+			worst = h
+		}
+
+		frozen = frozen || h.Frozen
+		ready = ready && h.Ready
+	}
+
+	if worst != nil {
+		worst.Frozen = frozen
+		worst.Ready = ready
+	}
+
+	return worst
+}
+
+// webrtcHealthEvent is sent to the health hook.
+type webrtcHealthEvent struct {
+	Event   string                  `json:"event"`
+	Session uuid.UUID               `json:"session"`
+	Path    string                  `json:"path"`
+	RoomID  *uuid.UUID              `json:"roomID"`
+	Health  *apiWebRTCSessionHealth `json:"health"`
+}
+
+// webrtcHealthHook notifies an external HTTP server about changes of the health of publishers.
+type webrtcHealthHook struct {
+	url string
+	hc  *http.Client
+}
+
+func newWebRTCHealthHook(url string, timeout time.Duration) *webrtcHealthHook {
+	return &webrtcHealthHook{
+		url: url,
+		hc: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (h *webrtcHealthHook) send(e *webrtcHealthEvent) error {
+	enc, _ := json.Marshal(e)
+
+	res, err := h.hc.Post(h.url, "application/json", bytes.NewReader(enc))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// runHealthMonitor checks periodically the health of a publisher, and raises an alert
+// when the score drops below the threshold and when it recovers.
+// It returns when the session is closed.
+func (s *webRTCSession) runHealthMonitor() {
+	threshold := s.parent.healthThreshold
+	if threshold == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(webrtcHealthCheckPeriod)
+	defer ticker.Stop()
+
+	unhealthy := false
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		s.mutex.RLock()
+		tracks := s.incoming
+		s.mutex.RUnlock()
+
+		health := webrtcHealthOfTracks(tracks, time.Now())
+
+		// alerts are raised only after enough samples have been taken, in order not to
+		// report the instability of the first seconds. Frozen video is reported immediately.
+		if health == nil || (!health.Ready && !health.Frozen) {
+			continue
+		}
+
+		cur := health.Score < threshold
+		if cur == unhealthy {
+			continue
+		}
+		unhealthy = cur
+
+		if unhealthy {
+			s.logEvent(logger.Warn, "unhealthy", "health score dropped to %d (packet loss %.1f%%, "+
+				"bitrate variation %.2f, frozen %v)", health.Score, health.PacketLoss*100,
+				health.BitrateVariation, health.Frozen)
+		} else {
+			s.logEvent(logger.Info, "healthy", "health score recovered to %d", health.Score)
+		}
+
+		if s.parent.healthHook != nil {
+			e := &webrtcHealthEvent{
+				Event: func() string {
+					if unhealthy {
+						return "unhealthy"
+					}
+					return "healthy"
+				}(),
+				Session: s.uuid,
+				Path:    s.currentPathName(),
+				Health:  health,
+			}
+			if s.roomid != uuid.Nil {
+				e.RoomID = &s.roomid
+			}
+
+			go func() {
+				err := s.parent.healthHook.send(e)
+				if err != nil {
+					s.Log(logger.Warn, "health hook failed: %v", err)
+				}
+			}()
+		}
+	}
+}
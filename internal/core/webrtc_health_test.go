@@ -0,0 +1,96 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCTrackHealth(t *testing.T) {
+	start := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, ca := range []string{"healthy", "loss", "frozen"} {
+		t.Run(ca, func(t *testing.T) {
+			h := newWebRTCTrackHealth(true, nil)
+			require.Nil(t, h.report(start))
+
+			now := start
+			seq := uint16(65000) // sequence numbers wrap around
+
+			// 10 seconds of video at 50 packets per second
+			for i := 0; i < 500; i++ {
+				ts := uint32(i / 2 * 3000)
+				if ca == "frozen" && i >= 400 {
+					ts = 400 / 2 * 3000
+				}
+
+				if ca != "loss" || i%5 != 1 {
+					h.observe(&rtp.Packet{
+						Header: rtp.Header{
+							SequenceNumber: seq,
+							Timestamp:      ts,
+						},
+						Payload: make([]byte, 1000),
+					}, now)
+				}
+
+				seq++
+				now = now.Add(20 * time.Millisecond)
+			}
+
+			r := h.report(now)
+			require.True(t, r.Ready)
+			require.Less(t, r.BitrateVariation, 0.01)
+
+			switch ca {
+			case "healthy":
+				require.Equal(t, 100, r.Score)
+				require.Zero(t, r.PacketLoss)
+				require.False(t, r.Frozen)
+
+			case "loss":
+				require.InDelta(t, 0.2, r.PacketLoss, 0.01)
+				require.Equal(t, 50, r.Score)
+				require.False(t, r.Frozen)
+
+			case "frozen":
+				require.True(t, r.Frozen)
+				require.Equal(t, 40, r.Score)
+			}
+		})
+	}
+}
+
+func TestWebRTCTrackHealthKeyFrames(t *testing.T) {
+	start := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	h := newWebRTCTrackHealth(true, h264PayloadIsKeyFrame)
+
+	now := start
+	for i := 0; i < 500; i++ {
+		h.observe(&rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: uint16(i),
+				Timestamp:      uint32(i * 3000),
+			},
+			Payload: []byte{0x01, 0x00, 0x00, 0x00}, // non-IDR
+		}, now)
+		now = now.Add(20 * time.Millisecond)
+	}
+
+	r := h.report(now)
+	require.True(t, r.Frozen)
+
+	h.observe(&rtp.Packet{
+		Header: rtp.Header{
+			SequenceNumber: 500,
+			Timestamp:      500 * 3000,
+		},
+		Payload: []byte{0x07, 0x00, 0x00, 0x00}, // SPS
+	}, now)
+
+	r = h.report(now)
+	require.False(t, r.Frozen)
+}
@@ -3,8 +3,11 @@ package core
 import (
 	_ "embed"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,9 +29,12 @@ var webrtcReadIndex []byte
 
 type webRTCHTTPServerParent interface {
 	logger.Writer
-	generateICEServers() ([]webrtc.ICEServer, error)
+	generateICEServers([]conf.WebRTCICEServer) ([]webrtc.ICEServer, error)
+	balance(req webrtcBalancerReq) string
 	newSession(req webRTCNewSessionReq) webRTCNewSessionRes
 	addSessionCandidates(req webRTCAddSessionCandidatesReq) webRTCAddSessionCandidatesRes
+	renegotiateSession(req webRTCRenegotiateSessionReq) webRTCRenegotiateSessionRes
+	deleteSession(req webRTCDeleteSessionReq) error
 }
 
 type webRTCHTTPServer struct {
@@ -44,6 +50,7 @@ func newWebRTCHTTPServer( //nolint:dupl
 	encryption bool,
 	serverKey string,
 	serverCert string,
+	clientCA string,
 	allowOrigin string,
 	trustedProxies conf.IPsOrCIDRs,
 	readTimeout conf.StringDuration,
@@ -57,6 +64,7 @@ func newWebRTCHTTPServer( //nolint:dupl
 	} else {
 		serverKey = ""
 		serverCert = ""
+		clientCA = ""
 	}
 
 	s := &webRTCHTTPServer{
@@ -78,6 +86,7 @@ func newWebRTCHTTPServer( //nolint:dupl
 		time.Duration(readTimeout),
 		serverCert,
 		serverKey,
+		clientCA,
 		router,
 		s,
 	)
@@ -92,16 +101,138 @@ func (s *webRTCHTTPServer) Log(level logger.Level, format string, args ...interf
 	s.parent.Log(level, format, args...)
 }
 
+func (s *webRTCHTTPServer) writeError(ctx *gin.Context, status int, err error) {
+	ctx.JSON(status, &apiError{Error: err.Error()})
+}
+
 func (s *webRTCHTTPServer) close() {
 	s.inner.Close()
 }
 
+// webrtcSessionResource splits the path of a session resource, that is
+// the path of a WHIP or WHEP endpoint followed by the session ID.
+func webrtcSessionResource(pa string) (string, uuid.UUID) {
+	i := strings.LastIndex(pa, "/")
+	if i < 0 {
+		return pa, uuid.Nil
+	}
+
+	base := pa[:i]
+	if !strings.HasSuffix(base, "/whip") && !strings.HasSuffix(base, "/whep") {
+		return pa, uuid.Nil
+	}
+
+	id, err := uuid.Parse(pa[i+1:])
+	if err != nil {
+		return pa, uuid.Nil
+	}
+
+	return base, id
+}
+
+// webrtcSessionETag returns the entity tag of a session resource.
+func webrtcSessionETag(secret uuid.UUID) string {
+	return `"` + secret.String() + `"`
+}
+
+// webrtcParseIfMatch returns the session secret contained in a If-Match header.
+// Quoted entity tags and the secret alone are both accepted.
+func webrtcParseIfMatch(v string) (uuid.UUID, error) {
+	v = strings.TrimPrefix(v, "W/")
+	v = strings.TrimPrefix(v, `"`)
+	v = strings.TrimSuffix(v, `"`)
+	return uuid.Parse(v)
+}
+
+func (s *webRTCHTTPServer) writeSessionResourceError(ctx *gin.Context, err error) {
+	switch err {
+	case errWebRTCSessionNotFound:
+		s.writeError(ctx, http.StatusNotFound, err)
+
+	case errWebRTCPreconditionFailed:
+		s.writeError(ctx, http.StatusPreconditionFailed, err)
+
+	default:
+		s.writeError(ctx, http.StatusBadRequest, err)
+	}
+}
+
+// onSessionResource handles requests to a session resource.
+// The If-Match header is mandatory, in order to prevent clients from
+// modifying or deleting a session that has been replaced by another one.
+func (s *webRTCHTTPServer) onSessionResource(ctx *gin.Context, sessionID uuid.UUID) {
+	ifMatch := ctx.Request.Header.Get("If-Match")
+	if ifMatch == "" {
+		s.writeError(ctx, http.StatusPreconditionRequired, fmt.Errorf("If-Match header is missing"))
+		return
+	}
+
+	secret, err := webrtcParseIfMatch(ifMatch)
+	if err != nil {
+		s.writeError(ctx, http.StatusPreconditionFailed, errWebRTCPreconditionFailed)
+		return
+	}
+
+	switch ctx.Request.Method {
+	case http.MethodPatch:
+		s.onSessionPatch(ctx, sessionID, secret)
+
+	case http.MethodDelete:
+		err := s.parent.deleteSession(webRTCDeleteSessionReq{
+			sessionID: sessionID,
+			secret:    secret,
+		})
+		if err != nil {
+			s.writeSessionResourceError(ctx, err)
+			return
+		}
+
+		ctx.Writer.WriteHeader(http.StatusOK)
+
+	default:
+		ctx.Writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// onSessionPatch adds the candidates of a trickle ICE fragment to a session,
+// as described in the WHIP specification.
+func (s *webRTCHTTPServer) onSessionPatch(ctx *gin.Context, sessionID uuid.UUID, secret uuid.UUID) {
+	if ctx.Request.Header.Get("Content-Type") != "application/trickle-ice-sdpfrag" {
+		ctx.Writer.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	byts, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return
+	}
+
+	candidates, err := whip.ICEFragmentUnmarshal(byts)
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	res := s.parent.addSessionCandidates(webRTCAddSessionCandidatesReq{
+		sessionID:  sessionID,
+		secret:     secret,
+		candidates: candidates,
+	})
+	if res.err != nil {
+		s.writeSessionResourceError(ctx, res.err)
+		return
+	}
+
+	ctx.Writer.Header().Set("ETag", webrtcSessionETag(secret))
+	ctx.Writer.WriteHeader(http.StatusNoContent)
+}
+
 func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 	ctx.Writer.Header().Set("Access-Control-Allow-Origin", s.allowOrigin)
 	ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 	// remove leading prefix
-	pa := ctx.Request.URL.Path[1:]
+	pa, sessionID := webrtcSessionResource(ctx.Request.URL.Path[1:])
 
 	isWHIPorWHEP := strings.HasSuffix(pa, "/whip") || strings.HasSuffix(pa, "/whep")
 	isPreflight := ctx.Request.Method == http.MethodOptions &&
@@ -110,7 +241,7 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 	if !isWHIPorWHEP || isPreflight {
 		switch ctx.Request.Method {
 		case http.MethodOptions:
-			ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PATCH")
+			ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PATCH, DELETE")
 			ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
 			ctx.Writer.WriteHeader(http.StatusNoContent)
 			return
@@ -167,17 +298,32 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 	remoteAddr := net.JoinHostPort(ip, port)
 	user, pass, hasCredentials := ctx.Request.BasicAuth()
 
+	// WHIP and WHEP clients authenticate with "Authorization: Bearer"
+	token, hasToken := bearerToken(ctx.Request.Header.Get("Authorization"))
+	if hasToken {
+		user, pass = bearerTokenCredentials(token)
+		hasCredentials = true
+	}
+
+	// clients can be identified by a certificate when webrtcClientCA is set
+	certUser := certificateUser(ctx.Request.TLS)
+	if certUser != "" {
+		hasCredentials = true
+	}
+
 	// if request doesn't belong to a session, check authentication here
 	if !isWHIPorWHEP || ctx.Request.Method == http.MethodOptions {
 		res := s.pathManager.getConfForPath(pathGetConfForPathReq{
 			name:    dir,
 			publish: publish,
 			credentials: authCredentials{
-				query: ctx.Request.URL.RawQuery,
-				ip:    net.ParseIP(ip),
-				user:  user,
-				pass:  pass,
-				proto: authProtocolWebRTC,
+				query:    ctx.Request.URL.RawQuery,
+				ip:       net.ParseIP(ip),
+				user:     user,
+				pass:     pass,
+				token:    token,
+				certUser: certUser,
+				proto:    authProtocolWebRTC,
 			},
 		})
 		if res.err != nil {
@@ -190,9 +336,6 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 
 				s.Log(logger.Info, "connection %v failed to authenticate: %v", remoteAddr, terr.message)
 
-				// wait some seconds to stop brute force attacks
-				<-time.After(webrtcPauseAfterAuthError)
-
 				ctx.Writer.WriteHeader(http.StatusUnauthorized)
 				return
 			}
@@ -203,8 +346,9 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 	}
 
 	type POSTBody struct {
-		Offer  string `json:"offer"`
-		RoomID string `json:"roomID"`
+		Offer       string `json:"offer"`
+		RoomID      string `json:"roomID"`
+		ResumeToken string `json:"resumeToken"`
 	}
 	type PATCHBody struct {
 		SDP    string `json:"sdp"`
@@ -223,15 +367,21 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 		//ctx.Writer.Write(webrtcPublishIndex)
 
 	case "whip", "whep":
+		if sessionID != uuid.Nil && ctx.Request.Method != http.MethodOptions {
+			s.onSessionResource(ctx, sessionID)
+			return
+		}
+
 		switch ctx.Request.Method {
 		case http.MethodOptions:
-			servers, err := s.parent.generateICEServers()
+			// the room is not known yet, therefore global servers are provided
+			servers, err := s.parent.generateICEServers(nil)
 			if err != nil {
 				ctx.Writer.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
-			ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PATCH")
+			ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PATCH, DELETE")
 			ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
 			ctx.Writer.Header()["Link"] = whip.LinkHeaderMarshal(servers)
 			ctx.Writer.WriteHeader(http.StatusNoContent)
@@ -247,45 +397,104 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 				return
 			}
 
+			err = checkRoomID(body.RoomID)
+			if err != nil {
+				s.writeError(ctx, http.StatusBadRequest, err)
+				return
+			}
+
+			participantName, participantID, err := webrtcParticipantIdentity(ctx.Request.URL.RawQuery, token)
+			if err != nil {
+				s.writeError(ctx, http.StatusBadRequest, err)
+				return
+			}
+
+			// resumed sessions must stay on the instance that owns them
+			if body.ResumeToken == "" && !webrtcBalancerRedirected(ctx.Request.URL.Query()) {
+				ur := s.parent.balance(webrtcBalancerReq{
+					Path:    dir,
+					RoomID:  body.RoomID,
+					Publish: (fname == "whip"),
+					IP:      ip,
+					Query:   ctx.Request.URL.RawQuery,
+					host:    ctx.Request.Host,
+				})
+				if ur != "" {
+					ctx.Writer.Header().Set("Location", webrtcBalancerLocation(ur, ctx.Request.URL))
+					ctx.Writer.WriteHeader(http.StatusTemporaryRedirect)
+					return
+				}
+			}
+
 			res := s.parent.newSession(webRTCNewSessionReq{
-				pathName:   dir,
-				remoteAddr: remoteAddr,
-				roomID:     body.RoomID,
-				query:      ctx.Request.URL.RawQuery,
-				user:       user,
-				pass:       pass,
-				offer:      []byte(body.Offer),
-				publish:    (fname == "whip"),
+				pathName:    dir,
+				remoteAddr:  remoteAddr,
+				roomID:      body.RoomID,
+				query:       ctx.Request.URL.RawQuery,
+				user:        user,
+				certUser:    certUser,
+				pass:        pass,
+				token:       token,
+				offer:       []byte(body.Offer),
+				publish:     (fname == "whip"),
+				resumeToken: body.ResumeToken,
+
+				participantName: participantName,
+				participantID:   participantID,
 			})
 			if res.err != nil {
-				ctx.Writer.WriteHeader(res.errStatusCode)
+				if res.redirect != "" {
+					l := strings.TrimSuffix(res.redirect, "/") + ctx.Request.URL.RequestURI()
+					ctx.Writer.Header().Set("Location", l)
+					ctx.Writer.WriteHeader(res.errStatusCode)
+					return
+				}
+
+				// do not provide details about authentication failures
+				if res.errStatusCode == http.StatusUnauthorized {
+					ctx.Writer.WriteHeader(res.errStatusCode)
+					return
+				}
+
+				if res.retryAfter != 0 {
+					retryAfter := int64(math.Ceil(res.retryAfter.Seconds()))
+					ctx.Writer.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+				}
+
+				s.writeError(ctx, res.errStatusCode, res.err)
 				return
 			}
 
-			servers, err := s.parent.generateICEServers()
+			servers, err := s.parent.generateICEServers(res.sx.iceServers)
 			if err != nil {
 				ctx.Writer.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
 			ctx.Writer.Header().Set("Content-Type", "application/sdp")
-			ctx.Writer.Header().Set("Access-Control-Expose-Headers", "E-Tag, Accept-Patch, Link")
+			ctx.Writer.Header().Set("Access-Control-Expose-Headers",
+				"ETag, E-Tag, Accept-Patch, Link, Location, Resume-Token")
+			ctx.Writer.Header().Set("ETag", webrtcSessionETag(res.sx.secret))
 			ctx.Writer.Header().Set("E-Tag", res.sx.secret.String())
 			ctx.Writer.Header().Set("ID", res.sx.uuid.String())
-			ctx.Writer.Header().Set("Accept-Patch", "application/trickle-ice-sdpfrag")
+			if res.resumeToken != "" {
+				ctx.Writer.Header().Set("Resume-Token", res.resumeToken)
+			}
+			ctx.Writer.Header().Set("Accept-Patch", "application/trickle-ice-sdpfrag, application/sdp")
 			ctx.Writer.Header()["Link"] = whip.LinkHeaderMarshal(servers)
-			ctx.Writer.Header().Set("Location", ctx.Request.URL.String())
+			ctx.Writer.Header().Set("Location", ctx.Request.URL.Path+"/"+res.sx.uuid.String())
 			ctx.Writer.WriteHeader(http.StatusCreated)
 			ctx.Writer.Write(res.answer)
 
 		case http.MethodPatch:
-			secret, err := uuid.Parse(ctx.Request.Header.Get("If-Match"))
+			secret, err := webrtcParseIfMatch(ctx.Request.Header.Get("If-Match"))
 			if err != nil {
 				ctx.Writer.WriteHeader(http.StatusBadRequest)
 				return
 			}
 
-			if ctx.Request.Header.Get("Content-Type") != "application/trickle-ice-sdpfrag" {
+			contentType := ctx.Request.Header.Get("Content-Type")
+			if contentType != "application/trickle-ice-sdpfrag" && contentType != "application/sdp" {
 				ctx.Writer.WriteHeader(http.StatusBadRequest)
 				return
 			}
@@ -295,6 +504,24 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 			if err != nil {
 				return
 			}
+
+			// a new offer renegotiates the session, in order to add or remove tracks.
+			if contentType == "application/sdp" {
+				res := s.parent.renegotiateSession(webRTCRenegotiateSessionReq{
+					roomID: body.RoomID,
+					secret: secret,
+					offer:  []byte(body.SDP),
+				})
+				if res.err != nil {
+					s.writeError(ctx, http.StatusBadRequest, res.err)
+					return
+				}
+
+				ctx.Writer.Header().Set("Content-Type", "application/sdp")
+				ctx.Writer.WriteHeader(http.StatusOK)
+				ctx.Writer.Write(res.answer)
+				return
+			}
 			// byts, err := io.ReadAll(ctx.Request.Body)
 			// if err != nil {
 			// 	return
@@ -312,7 +539,7 @@ func (s *webRTCHTTPServer) onRequest(ctx *gin.Context) {
 				candidates: candidates,
 			})
 			if res.err != nil {
-				ctx.Writer.WriteHeader(http.StatusBadRequest)
+				s.writeError(ctx, http.StatusBadRequest, res.err)
 				return
 			}
 
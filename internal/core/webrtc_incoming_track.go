@@ -1,21 +1,35 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
-	wrtcmedia "github.com/pion/webrtc/v3/pkg/media"
 
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
 const (
 	keyFrameInterval = 2 * time.Second
+
+	// a track is considered muted when no packets are received within this period,
+	// or when audio packets contain only silence within this period.
+	webrtcTrackMuteTimeout = 2 * time.Second
+
+	// audio level of packets that contain silence, in -dBov (RFC 6464).
+	webrtcAudioLevelSilence = 127
+
+	// bitrate advertised to publishers when readers are not struggling anymore
+	webrtcFeedbackUnlimitedBitrate = 100 * 1000 * 1000
 )
 
 type webRTCIncomingTrack struct {
@@ -23,9 +37,20 @@ type webRTCIncomingTrack struct {
 	receiver  *webrtc.RTPReceiver
 	writeRTCP func([]rtcp.Packet) error
 
-	mediaType media.Type
-	format    formats.Format
-	media     *media.Media
+	bytesReceived *uint64
+	lastPacket    *int64
+	lastSound     *int64
+	audioLevelExt uint8 // ID of the audio level header extension, zero if not negotiated
+	mediaType     media.Type
+	format        formats.Format
+	media         *media.Media
+	health        *webrtcTrackHealth
+	capture       func(*rtp.Packet, bool)
+	standby       func() bool
+
+	streamMutex sync.RWMutex
+	stream      *stream.Stream
+	feedback    *webRTCPathFeedback
 }
 
 func newWebRTCIncomingTrack(
@@ -34,10 +59,15 @@ func newWebRTCIncomingTrack(
 	writeRTCP func([]rtcp.Packet) error,
 ) (*webRTCIncomingTrack, error) {
 	t := &webRTCIncomingTrack{
-		track:     track,
-		receiver:  receiver,
-		writeRTCP: writeRTCP,
+		track:         track,
+		receiver:      receiver,
+		writeRTCP:     writeRTCP,
+		bytesReceived: new(uint64),
+		lastPacket:    new(int64),
+		lastSound:     new(int64),
 	}
+	atomic.StoreInt64(t.lastPacket, time.Now().UnixNano())
+	atomic.StoreInt64(t.lastSound, time.Now().UnixNano())
 
 	switch strings.ToLower(track.Codec().MimeType) {
 	case strings.ToLower(webrtc.MimeTypeAV1):
@@ -65,6 +95,12 @@ func newWebRTCIncomingTrack(
 			PacketizationMode: 1,
 		}
 
+	case strings.ToLower(webrtc.MimeTypeH265):
+		t.mediaType = media.TypeVideo
+		t.format = &formats.H265{
+			PayloadTyp: uint8(track.PayloadType()),
+		}
+
 	case strings.ToLower(webrtc.MimeTypeOpus):
 		t.mediaType = media.TypeAudio
 		t.format = &formats.Opus{
@@ -96,10 +132,124 @@ func newWebRTCIncomingTrack(
 		Formats: []formats.Format{t.format},
 	}
 
+	// browsers keep sending silence when audio tracks are muted
+	if t.mediaType == media.TypeAudio && receiver != nil {
+		for _, ext := range receiver.GetParameters().HeaderExtensions {
+			if ext.URI == sdp.AudioLevelURI {
+				t.audioLevelExt = uint8(ext.ID)
+			}
+		}
+	}
+
+	switch t.format.(type) {
+	case *formats.H264:
+		t.health = newWebRTCTrackHealth(true, h264PayloadIsKeyFrame)
+
+	case *formats.H265:
+		t.health = newWebRTCTrackHealth(true, h265PayloadIsKeyFrame)
+
+	default:
+		t.health = newWebRTCTrackHealth(t.mediaType == media.TypeVideo, nil)
+	}
+
 	return t, nil
 }
 
-func (t *webRTCIncomingTrack) start(stream *stream.Stream, writer wrtcmedia.Writer, room *Room, publish bool) {
+func (t *webRTCIncomingTrack) apiItem() *apiWebRTCSessionTrack {
+	active := t.active()
+	return &apiWebRTCSessionTrack{
+		Type:          string(t.mediaType),
+		Codec:         webrtcCodecOfFormat(t.format),
+		BytesReceived: atomic.LoadUint64(t.bytesReceived),
+		Active:        &active,
+	}
+}
+
+// active returns whether packets have been received recently and,
+// when the audio level of packets is available, whether they contained sound.
+func (t *webRTCIncomingTrack) active() bool {
+	if t.audioLevelExt != 0 &&
+		time.Since(time.Unix(0, atomic.LoadInt64(t.lastSound))) >= webrtcTrackMuteTimeout {
+		return false
+	}
+	return t.inactiveFor() < webrtcTrackMuteTimeout
+}
+
+// onAudioLevel reads the audio level header extension of a packet.
+func (t *webRTCIncomingTrack) onAudioLevel(pkt *rtp.Packet, now time.Time) {
+	ext := pkt.GetExtension(t.audioLevelExt)
+	if len(ext) == 0 {
+		return
+	}
+
+	if ext[0]&0x7F < webrtcAudioLevelSilence {
+		atomic.StoreInt64(t.lastSound, now.UnixNano())
+	}
+}
+
+// inactiveFor returns the time elapsed since the last packet.
+func (t *webRTCIncomingTrack) inactiveFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(t.lastPacket)))
+}
+
+// webrtcInactivityCheckPeriod returns how often the inactivity of tracks is checked.
+func webrtcInactivityCheckPeriod(timeout time.Duration) time.Duration {
+	if period := timeout / 4; period < time.Second {
+		return period
+	}
+	return time.Second
+}
+
+// webrtcInactiveTrack returns a track that has not received packets within timeout, if any.
+func webrtcInactiveTrack(tracks []*webRTCIncomingTrack, timeout time.Duration) *webRTCIncomingTrack {
+	for _, track := range tracks {
+		if track.inactiveFor() >= timeout {
+			return track
+		}
+	}
+	return nil
+}
+
+// runMuteDetector calls onChange when the track gets muted or unmuted.
+// It returns when ctx is canceled.
+func (t *webRTCIncomingTrack) runMuteDetector(ctx context.Context, onChange func(active bool)) {
+	ticker := time.NewTicker(webrtcTrackMuteTimeout / 4)
+	defer ticker.Stop()
+
+	active := true
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if cur := t.active(); cur != active {
+			active = cur
+			onChange(active)
+		}
+	}
+}
+
+func (t *webRTCIncomingTrack) start(
+	ctx context.Context,
+	stream *stream.Stream,
+	recorder *roomTrackRecorder,
+	room *Room,
+	publish bool,
+	feedback *webRTCPathFeedback,
+	maxBitrate int,
+	jitterBufferDepth int,
+) {
+	t.stream = stream
+	t.feedback = feedback
+
+	var jitterBuffer *webrtcJitterBuffer
+	if jitterBufferDepth != 0 {
+		jitterBuffer = newWebRTCJitterBuffer(jitterBufferDepth)
+	}
+
 	go func() {
 		for {
 			pkt, _, err := t.track.ReadRTP()
@@ -113,25 +263,53 @@ func (t *webRTCIncomingTrack) start(stream *stream.Stream, writer wrtcmedia.Writ
 				continue
 			}
 
-			stream.WriteRTPPacket(t.media, t.format, pkt, time.Now())
+			atomic.AddUint64(t.bytesReceived, uint64(pkt.MarshalSize()))
+			atomic.StoreInt64(t.lastPacket, time.Now().UnixNano())
+			t.health.observe(pkt, time.Now())
 
-			if publish && room.recording {
-				err := writer.WriteRTP(pkt)
-				if err != nil {
-					panic(err)
-				}
+			if t.audioLevelExt != 0 {
+				t.onAudioLevel(pkt, time.Now())
+			}
+
+			if t.capture != nil {
+				t.capture(pkt, true)
+			}
+
+			if jitterBuffer == nil {
+				t.writePacket(pkt, recorder, room, publish)
+				continue
+			}
+
+			for _, pkt := range jitterBuffer.push(pkt) {
+				t.writePacket(pkt, recorder, room, publish)
 			}
 		}
 	}()
 
 	// read incoming RTCP packets to make interceptors work
+	// and to store sender reports of recorded tracks.
 	go func() {
 		buf := make([]byte, 1500)
 		for {
-			_, _, err := t.receiver.Read(buf)
+			n, _, err := t.receiver.Read(buf)
 			if err != nil {
 				return
 			}
+
+			if recorder == nil {
+				continue
+			}
+
+			pkts, err := rtcp.Unmarshal(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			for _, pkt := range pkts {
+				if sr, ok := pkt.(*rtcp.SenderReport); ok && sr.SSRC == uint32(t.track.SSRC()) {
+					recorder.writeSenderReport(sr)
+				}
+			}
 		}
 	}()
 
@@ -140,16 +318,122 @@ func (t *webRTCIncomingTrack) start(stream *stream.Stream, writer wrtcmedia.Writ
 			keyframeTicker := time.NewTicker(keyFrameInterval)
 			defer keyframeTicker.Stop()
 
-			for range keyframeTicker.C {
-				err := t.writeRTCP([]rtcp.Packet{
-					&rtcp.PictureLossIndication{
-						MediaSSRC: uint32(t.track.SSRC()),
-					},
-				})
-				if err != nil {
+			for {
+				select {
+				case <-keyframeTicker.C:
+					err := t.writeRTCP([]rtcp.Packet{
+						&rtcp.PictureLossIndication{
+							MediaSSRC: uint32(t.track.SSRC()),
+						},
+					})
+					if err != nil {
+						return
+					}
+
+				case <-ctx.Done():
 					return
 				}
 			}
 		}()
 	}
+
+	if t.mediaType == media.TypeVideo && feedback != nil {
+		go t.runBitrateController(ctx, maxBitrate)
+	}
+}
+
+func (t *webRTCIncomingTrack) writePacket(
+	pkt *rtp.Packet,
+	recorder *roomTrackRecorder,
+	room *Room,
+	publish bool,
+) {
+	t.streamMutex.RLock()
+	if t.stream != nil {
+		t.stream.WriteRTPPacket(t.media, t.format, pkt, time.Now())
+	}
+	t.streamMutex.RUnlock()
+
+	// backup publishers are recorded only when they replace the primary one
+	if publish && room.recording && recorder != nil && (t.standby == nil || !t.standby()) {
+		err := recorder.writeRTP(pkt)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// setStream changes the stream that incoming packets are written to.
+// When stream is nil, packets are discarded.
+func (t *webRTCIncomingTrack) setStream(stream *stream.Stream) {
+	t.streamMutex.Lock()
+	defer t.streamMutex.Unlock()
+	t.stream = stream
+}
+
+// setFeedback changes the readers whose feedback is used to control the bitrate.
+// It is called when the publisher is migrated to another path.
+func (t *webRTCIncomingTrack) setFeedback(feedback *webRTCPathFeedback) {
+	t.streamMutex.Lock()
+	defer t.streamMutex.Unlock()
+	t.feedback = feedback
+}
+
+func (t *webRTCIncomingTrack) currentFeedback() *webRTCPathFeedback {
+	t.streamMutex.RLock()
+	defer t.streamMutex.RUnlock()
+	return t.feedback
+}
+
+// runBitrateController sends REMB packets to the publisher, in order to make
+// its encoder lower the bitrate when most readers are struggling
+// or when the bitrate exceeds maxBitrate.
+// It returns when ctx is canceled.
+func (t *webRTCIncomingTrack) runBitrateController(
+	ctx context.Context,
+	maxBitrate int,
+) {
+	c := &webRTCBitrateController{
+		maxBitrate: float64(maxBitrate),
+	}
+	limited := false
+	prevBytes := uint64(0)
+
+	ticker := time.NewTicker(webrtcFeedbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		bytes := atomic.LoadUint64(t.bytesReceived)
+		incomingBitrate := float64(bytes-prevBytes) * 8 / webrtcFeedbackInterval.Seconds()
+		prevBytes = bytes
+
+		c.feedback = t.currentFeedback()
+		target := c.update(incomingBitrate)
+
+		if target == 0 {
+			if !limited {
+				continue
+			}
+			target = webrtcFeedbackUnlimitedBitrate
+			limited = false
+		} else {
+			limited = true
+		}
+
+		err := t.writeRTCP([]rtcp.Packet{
+			&rtcp.ReceiverEstimatedMaximumBitrate{
+				Bitrate: float32(target),
+				SSRCs:   []uint32{uint32(t.track.SSRC())},
+			},
+		})
+		if err != nil {
+			return
+		}
+	}
 }
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"github.com/pion/rtp"
+)
+
+// when a packet is older than this, the publisher is assumed to have restarted the sequence.
+const webrtcJitterBufferResetThreshold = 1000
+
+// webrtcJitterBuffer reorders and de-duplicates incoming RTP packets.
+// Packets are released as soon as they are in sequence. When a packet is missing,
+// following packets are held until a packet with a sequence number at least depth
+// positions after the missing one is received, in order to give the missing packet
+// the time to be retransmitted.
+type webrtcJitterBuffer struct {
+	depth int
+
+	initialized bool
+	expected    uint16
+	buffer      map[uint16]*rtp.Packet
+}
+
+func newWebRTCJitterBuffer(depth int) *webrtcJitterBuffer {
+	return &webrtcJitterBuffer{
+		depth:  depth,
+		buffer: make(map[uint16]*rtp.Packet),
+	}
+}
+
+// pop releases the packet with the expected sequence number, if present.
+func (b *webrtcJitterBuffer) pop(out []*rtp.Packet) []*rtp.Packet {
+	if pkt, ok := b.buffer[b.expected]; ok {
+		out = append(out, pkt)
+		delete(b.buffer, b.expected)
+	}
+	b.expected++
+	return out
+}
+
+// flush releases all buffered packets, in order.
+func (b *webrtcJitterBuffer) flush(out []*rtp.Packet) []*rtp.Packet {
+	for len(b.buffer) > 0 {
+		out = b.pop(out)
+	}
+	return out
+}
+
+// push adds a packet and returns the packets that can be released, in order.
+func (b *webrtcJitterBuffer) push(pkt *rtp.Packet) []*rtp.Packet {
+	if !b.initialized {
+		b.initialized = true
+		b.expected = pkt.SequenceNumber
+	}
+
+	diff := int(int16(pkt.SequenceNumber - b.expected))
+
+	var out []*rtp.Packet
+
+	switch {
+	case diff < -webrtcJitterBufferResetThreshold:
+		out = b.flush(out)
+		b.expected = pkt.SequenceNumber
+
+	case diff < 0:
+		// late or duplicate packet
+		return nil
+
+	case diff >= b.depth:
+		// the buffer is full: skip missing packets until the new one fits
+		for int(int16(pkt.SequenceNumber-b.expected)) >= b.depth {
+			if len(b.buffer) == 0 {
+				b.expected = pkt.SequenceNumber
+				break
+			}
+			out = b.pop(out)
+		}
+	}
+
+	if _, ok := b.buffer[pkt.SequenceNumber]; ok {
+		// duplicate packet
+		return out
+	}
+
+	b.buffer[pkt.SequenceNumber] = pkt
+
+	for {
+		if _, ok := b.buffer[b.expected]; !ok {
+			break
+		}
+		out = b.pop(out)
+	}
+
+	return out
+}
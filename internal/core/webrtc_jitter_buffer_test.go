@@ -0,0 +1,70 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCJitterBuffer(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		in   []uint16
+		out  []uint16
+	}{
+		{
+			"in order",
+			[]uint16{1, 2, 3, 4},
+			[]uint16{1, 2, 3, 4},
+		},
+		{
+			"reordered",
+			[]uint16{1, 3, 2, 5, 4},
+			[]uint16{1, 2, 3, 4, 5},
+		},
+		{
+			"duplicates",
+			[]uint16{1, 2, 2, 3, 1, 3, 4},
+			[]uint16{1, 2, 3, 4},
+		},
+		{
+			"lost",
+			[]uint16{1, 3, 4, 5, 6, 7, 8},
+			[]uint16{1, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			"late",
+			[]uint16{1, 3, 4, 5, 6, 2, 7},
+			[]uint16{1, 3, 4, 5, 6, 7},
+		},
+		{
+			"wrap around",
+			[]uint16{65534, 0, 65535, 1},
+			[]uint16{65534, 65535, 0, 1},
+		},
+		{
+			"jump",
+			[]uint16{1, 2, 1000, 1001},
+			[]uint16{1, 2, 1000, 1001},
+		},
+		{
+			"reset",
+			[]uint16{5000, 5001, 10, 11},
+			[]uint16{5000, 5001, 10, 11},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			b := newWebRTCJitterBuffer(4)
+			var out []uint16
+
+			for _, seq := range ca.in {
+				for _, pkt := range b.push(&rtp.Packet{Header: rtp.Header{SequenceNumber: seq}}) {
+					out = append(out, pkt.SequenceNumber)
+				}
+			}
+
+			require.Equal(t, ca.out, out)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// errWebRTCLoadRedirect is returned when a reader is redirected to another instance.
+type errWebRTCLoadRedirect struct {
+	url string
+}
+
+// Error implements the error interface.
+func (e errWebRTCLoadRedirect) Error() string {
+	return "server is overloaded, redirecting to " + e.url
+}
+
+// webrtcLoadShedding applies the load shedding policy of a path to a new reader.
+// Readers are degraded by limiting the video bitrate that is sent to them,
+// that is enforced by dropping layers and frames of the reader only,
+// without affecting the bitrate advertised to the publisher.
+// It returns the video bitrate limit to enforce on the reader.
+func webrtcLoadShedding(overloaded bool, pathConf *conf.PathConf, maxVideoBitrate int) (int, int, error) {
+	if !overloaded {
+		return maxVideoBitrate, 0, nil
+	}
+
+	switch pathConf.WebRTCLoadPolicy {
+	case "degrade":
+		if maxVideoBitrate == 0 || pathConf.WebRTCLoadMaxVideoBitrate < maxVideoBitrate {
+			maxVideoBitrate = pathConf.WebRTCLoadMaxVideoBitrate
+		}
+		return maxVideoBitrate, 0, nil
+
+	case "redirect":
+		return 0, http.StatusTemporaryRedirect, errWebRTCLoadRedirect{url: pathConf.WebRTCLoadRedirect}
+
+	default:
+		return 0, http.StatusServiceUnavailable, fmt.Errorf("server is overloaded")
+	}
+}
+
+// isOverloaded is called by webRTCSession.
+func (m *webRTCManager) isOverloaded() bool {
+	return m.loadMonitor != nil && m.loadMonitor.isOverloaded()
+}
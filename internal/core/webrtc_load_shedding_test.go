@@ -0,0 +1,79 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func TestWebRTCLoadShedding(t *testing.T) {
+	for _, ca := range []struct {
+		name            string
+		overloaded      bool
+		pathConf        conf.PathConf
+		maxVideoBitrate int
+		outBitrate      int
+		outStatusCode   int
+		outErr          string
+	}{
+		{
+			"not overloaded",
+			false,
+			conf.PathConf{WebRTCLoadPolicy: "reject"},
+			500000,
+			500000,
+			0,
+			"",
+		},
+		{
+			"reject",
+			true,
+			conf.PathConf{WebRTCLoadPolicy: "reject"},
+			0,
+			0,
+			http.StatusServiceUnavailable,
+			"server is overloaded",
+		},
+		{
+			"degrade",
+			true,
+			conf.PathConf{WebRTCLoadPolicy: "degrade", WebRTCLoadMaxVideoBitrate: 300000},
+			0,
+			300000,
+			0,
+			"",
+		},
+		{
+			"degrade with lower limit",
+			true,
+			conf.PathConf{WebRTCLoadPolicy: "degrade", WebRTCLoadMaxVideoBitrate: 300000},
+			200000,
+			200000,
+			0,
+			"",
+		},
+		{
+			"redirect",
+			true,
+			conf.PathConf{WebRTCLoadPolicy: "redirect", WebRTCLoadRedirect: "https://other:8889"},
+			0,
+			0,
+			http.StatusTemporaryRedirect,
+			"server is overloaded, redirecting to https://other:8889",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			bitrate, statusCode, err := webrtcLoadShedding(ca.overloaded, &ca.pathConf, ca.maxVideoBitrate)
+			require.Equal(t, ca.outBitrate, bitrate)
+			require.Equal(t, ca.outStatusCode, statusCode)
+			if ca.outErr != "" {
+				require.EqualError(t, err, ca.outErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
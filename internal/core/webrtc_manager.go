@@ -10,30 +10,39 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"sort"
 	"strconv"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/google/uuid"
 	"github.com/pion/ice/v2"
 	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordkey"
 )
 
 const (
-	webrtcPauseAfterAuthError  = 2 * time.Second
 	webrtcHandshakeTimeout     = 10 * time.Second
 	webrtcTrackGatherTimeout   = 3 * time.Second
+	webrtcTrackGatherGrace     = 500 * time.Millisecond
 	webrtcPayloadMaxSize       = 1188 // 1200 - 12 (RTP header)
 	webrtcStreamID             = "mediamtx"
 	webrtcTurnSecretExpiration = 24 * 3600 * time.Second
+	webrtcDrainCheckPeriod     = 1 * time.Second
+)
+
+var (
+	errWebRTCSessionNotFound    = errors.New("session not found")
+	errWebRTCPreconditionFailed = errors.New("entity tag doesn't match the one of the session")
 )
 
 var videoCodecs = []webrtc.RTPCodecParameters{
@@ -83,6 +92,15 @@ var videoCodecs = []webrtc.RTPCodecParameters{
 		},
 		PayloadType: 101,
 	},
+	// H265 can be received from publishers but can't be sent to readers.
+	// It's the last codec, in order not to be preferred over other ones.
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypeH265,
+			ClockRate: 90000,
+		},
+		PayloadType: 102,
+	},
 }
 
 var audioCodecs = []webrtc.RTPCodecParameters{
@@ -171,24 +189,100 @@ func randomTurnUser() (string, error) {
 	return string(b), nil
 }
 
-func webrtcNewAPI(
-	iceHostNAT1To1IPs []string,
-	iceUDPMux ice.UDPMux,
-	iceTCPMux ice.TCPMux,
-) (*webrtc.API, error) {
+func webrtcOpusFmtp(inbandFEC bool, dtx bool, maxAverageBitrate int) string {
+	fmtp := "minptime=10"
+	if inbandFEC {
+		fmtp += ";useinbandfec=1"
+	}
+	if dtx {
+		fmtp += ";usedtx=1"
+	}
+	if maxAverageBitrate != 0 {
+		fmtp += ";maxaveragebitrate=" + strconv.FormatInt(int64(maxAverageBitrate), 10)
+	}
+	return fmtp
+}
+
+// webrtcAudioCodecs returns the supported audio codecs,
+// with the given fmtp line applied to Opus.
+func webrtcAudioCodecs(opusFmtp string) []webrtc.RTPCodecParameters {
+	ret := make([]webrtc.RTPCodecParameters, len(audioCodecs))
+	copy(ret, audioCodecs)
+
+	if opusFmtp != "" {
+		for i := range ret {
+			if ret[i].MimeType == webrtc.MimeTypeOpus {
+				ret[i].SDPFmtpLine = opusFmtp
+			}
+		}
+	}
+
+	return ret
+}
+
+// webrtcAPIConf contains the parameters of the WebRTC API.
+// Zero values disable the related features.
+type webrtcAPIConf struct {
+	iceHostNAT1To1IPs []string
+	iceUDPMux         ice.UDPMux
+	iceTCPMux         ice.TCPMux
+	iceTCPFallback    bool
+	iceUDPPortMin     uint16
+	iceUDPPortMax     uint16
+	iceHostOnly       bool
+	iceHostIPs        []string
+	opusFmtp          string
+	nackBufferSize    uint16
+	fec               bool
+}
+
+func webrtcNewAPI(apiConf webrtcAPIConf) (*webrtc.API, error) {
 	settingsEngine := webrtc.SettingEngine{}
 
-	if len(iceHostNAT1To1IPs) != 0 {
-		settingsEngine.SetNAT1To1IPs(iceHostNAT1To1IPs, webrtc.ICECandidateTypeHost)
+	if len(apiConf.iceHostNAT1To1IPs) != 0 {
+		settingsEngine.SetNAT1To1IPs(apiConf.iceHostNAT1To1IPs, webrtc.ICECandidateTypeHost)
+	}
+
+	if apiConf.iceUDPMux != nil {
+		settingsEngine.SetICEUDPMux(apiConf.iceUDPMux)
 	}
 
-	if iceUDPMux != nil {
-		settingsEngine.SetICEUDPMux(iceUDPMux)
+	if apiConf.iceUDPPortMin != 0 {
+		err := settingsEngine.SetEphemeralUDPPortRange(apiConf.iceUDPPortMin, apiConf.iceUDPPortMax)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if apiConf.iceHostOnly {
+		// resolving mDNS candidates delays the connection
+		settingsEngine.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	}
+
+	if len(apiConf.iceHostIPs) != 0 {
+		settingsEngine.SetIPFilter(func(ip net.IP) bool {
+			for _, hostIP := range apiConf.iceHostIPs {
+				if ip.Equal(net.ParseIP(hostIP)) {
+					return true
+				}
+			}
+			return false
+		})
 	}
 
-	if iceTCPMux != nil {
-		settingsEngine.SetICETCPMux(iceTCPMux)
-		settingsEngine.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeTCP4})
+	if apiConf.iceTCPMux != nil {
+		settingsEngine.SetICETCPMux(apiConf.iceTCPMux)
+
+		if apiConf.iceTCPFallback {
+			// UDP is preferred by clients, TCP is used when UDP is blocked
+			settingsEngine.SetNetworkTypes([]webrtc.NetworkType{
+				webrtc.NetworkTypeUDP4,
+				webrtc.NetworkTypeUDP6,
+				webrtc.NetworkTypeTCP4,
+			})
+		} else {
+			settingsEngine.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeTCP4})
+		}
 	}
 
 	mediaEngine := &webrtc.MediaEngine{}
@@ -200,15 +294,61 @@ func webrtcNewAPI(
 		}
 	}
 
-	for _, codec := range audioCodecs {
+	if apiConf.fec {
+		for _, codec := range fecCodecs {
+			err := mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeVideo)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, codec := range webrtcAudioCodecs(apiConf.opusFmtp) {
 		err := mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeAudio)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// allow to limit the bitrate of publishers
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBGoogREMB}, webrtc.RTPCodecTypeVideo)
+
+	// allow to detect muted audio tracks of publishers
+	err := mediaEngine.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI},
+		webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverDirectionRecvonly)
+	if err != nil {
+		return nil, err
+	}
+
 	interceptorRegistry := &interceptor.Registry{}
-	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry); err != nil {
+
+	// same as webrtc.RegisterDefaultInterceptors(), except that the size of the
+	// retransmission buffer of outgoing tracks is configurable.
+	generator, err := nack.NewGeneratorInterceptor()
+	if err != nil {
+		return nil, err
+	}
+	interceptorRegistry.Add(generator)
+
+	// NACKs are always negotiated, in order to allow requesting retransmissions to publishers.
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: "nack"}, webrtc.RTPCodecTypeVideo)
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: "nack", Parameter: "pli"}, webrtc.RTPCodecTypeVideo)
+
+	if apiConf.nackBufferSize != 0 {
+		responder, err := nack.NewResponderInterceptor(nack.ResponderSize(apiConf.nackBufferSize))
+		if err != nil {
+			return nil, err
+		}
+		interceptorRegistry.Add(responder)
+	}
+
+	err = webrtc.ConfigureRTCPReports(interceptorRegistry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = webrtc.ConfigureTWCCSender(mediaEngine, interceptorRegistry)
+	if err != nil {
 		return nil, err
 	}
 
@@ -246,6 +386,45 @@ type webRTCManagerAPISessionsKickReq struct {
 	res  chan webRTCManagerAPISessionsKickRes
 }
 
+type webRTCManagerAPISessionsMigrateRes struct {
+	sx  *webRTCSession
+	err error
+}
+
+type webRTCManagerAPISessionsMigrateReq struct {
+	uuid     uuid.UUID
+	pathName string
+	res      chan webRTCManagerAPISessionsMigrateRes
+}
+
+type webRTCManagerSessionMigratedReq struct {
+	sx       *webRTCSession
+	prevPath string
+	newPath  string
+	fork     bool
+}
+
+type webRTCManagerAPISessionsCaptureRes struct {
+	data *apiWebRTCSessionCapture
+	err  error
+}
+
+type webRTCManagerAPISessionsCaptureReq struct {
+	uuid     uuid.UUID
+	format   string
+	duration time.Duration
+	res      chan webRTCManagerAPISessionsCaptureRes
+}
+
+type webRTCManagerAPIRoomsListRes struct {
+	data *apiWebRTCRoomsList
+	err  error
+}
+
+type webRTCManagerAPIRoomsListReq struct {
+	res chan webRTCManagerAPIRoomsListRes
+}
+
 type webRTCManagerAPIRoomsGetRes struct {
 	data *apiWebRTCRoom
 	err  error
@@ -262,9 +441,15 @@ type webRTCManagerAPIRoomsCreateRes struct {
 }
 
 type webRTCManagerAPIRoomsCreateReq struct {
-	eventName string
-	clubName string
-	res chan webRTCManagerAPIRoomsCreateRes
+	eventName  string
+	clubName   string
+	s3Conf     *apiWebRTCRoomS3
+	iceServers []conf.WebRTCICEServer
+	restream   *apiWebRTCRoomRestream
+	program    string
+	schedule   roomSchedule
+	profile    string
+	res        chan webRTCManagerAPIRoomsCreateRes
 }
 
 type webRTCManagerAPIRoomsJoinRes struct {
@@ -286,6 +471,56 @@ type webRTCManagerAPIRoomsRecordReq struct {
 	res  chan webRTCManagerAPIRoomsRecordRes
 }
 
+type webRTCManagerAPIRoomsRecordPauseRes struct {
+	err error
+}
+
+type webRTCManagerAPIRoomsRecordPauseReq struct {
+	uuid  uuid.UUID
+	pause bool
+	res   chan webRTCManagerAPIRoomsRecordPauseRes
+}
+
+type webRTCManagerAPIRoomsProgramRes struct {
+	err error
+}
+
+type webRTCManagerAPIRoomsProgramReq struct {
+	uuid   uuid.UUID
+	source string
+	res    chan webRTCManagerAPIRoomsProgramRes
+}
+
+type webRTCManagerAPIRoomsMixRes struct {
+	err error
+}
+
+type webRTCManagerAPIRoomsMixReq struct {
+	uuid uuid.UUID
+	mix  *apiWebRTCRoomMix
+	res  chan webRTCManagerAPIRoomsMixRes
+}
+
+type webRTCManagerAPIRoomsGeoRes struct {
+	err error
+}
+
+type webRTCManagerAPIRoomsGeoReq struct {
+	uuid uuid.UUID
+	geo  *apiWebRTCRoomGeo
+	res  chan webRTCManagerAPIRoomsGeoRes
+}
+
+type webRTCManagerAPIRoomsMessageRes struct {
+	err error
+}
+
+type webRTCManagerAPIRoomsMessageReq struct {
+	uuid uuid.UUID
+	data string
+	res  chan webRTCManagerAPIRoomsMessageRes
+}
+
 type webRTCManagerAPIRoomsCleanupRes struct {
 	err error
 }
@@ -295,23 +530,111 @@ type webRTCManagerAPIRoomsCleanupReq struct {
 	res  chan webRTCManagerAPIRoomsCleanupRes
 }
 
+type webRTCManagerAPIRoomsKeysCreateRes struct {
+	key string
+	err error
+}
+
+type webRTCManagerAPIRoomsKeysCreateReq struct {
+	uuid     uuid.UUID
+	pathName string
+	res      chan webRTCManagerAPIRoomsKeysCreateRes
+}
+
+type webRTCManagerAPIRoomsKeysRevokeRes struct {
+	err error
+}
+
+type webRTCManagerAPIRoomsTokensCreateRes struct {
+	token  string
+	expiry time.Time
+	err    error
+}
+
+type webRTCManagerAPIRoomsTokensCreateReq struct {
+	uuid          uuid.UUID
+	pathName      string
+	participantID string
+	duration      time.Duration
+	res           chan webRTCManagerAPIRoomsTokensCreateRes
+}
+
+type webRTCManagerAPIRoomsKeysRevokeReq struct {
+	uuid uuid.UUID
+	key  string
+	res  chan webRTCManagerAPIRoomsKeysRevokeRes
+}
+
+type webRTCManagerAPIRoomsCloneRes struct {
+	uuid uuid.UUID
+	err  error
+}
+
+type webRTCManagerAPIRoomsCloneReq struct {
+	uuid uuid.UUID
+	res  chan webRTCManagerAPIRoomsCloneRes
+}
+
+type webRTCManagerAPIRoomsLogsRes struct {
+	data *apiWebRTCRoomLogs
+	err  error
+}
+
+type webRTCManagerAPIRoomsLogsReq struct {
+	uuid     uuid.UUID
+	minLevel logger.Level
+	res      chan webRTCManagerAPIRoomsLogsRes
+}
+
 type webRTCNewSessionRes struct {
 	sx            *webRTCSession
 	answer        []byte
+	resumeToken   string
 	err           error
 	errStatusCode int
+	retryAfter    time.Duration
+	redirect      string
 }
 
 type webRTCNewSessionReq struct {
-	pathName   string
-	roomID     string
-	remoteAddr string
-	query      string
-	user       string
-	pass       string
-	offer      []byte
-	publish    bool
-	res        chan webRTCNewSessionRes
+	pathName    string
+	roomID      string
+	remoteAddr  string
+	query       string
+	user        string
+	pass        string
+	token       string
+	certUser    string
+	offer       []byte
+	publish     bool
+	resumeToken string
+	res         chan webRTCNewSessionRes
+
+	// identity of the participant
+	participantName string
+	participantID   string
+
+	// filled by webRTCManager when a session is resumed
+	sessionUUID uuid.UUID
+	resumed     *webRTCSession
+
+	// filled by webRTCManager when a valid publish key or access token of the room is provided
+	roomKeyAuth bool
+
+	// filled by webRTCManager when a reader provides a one-time access token of the room
+	accessToken string
+
+	// filled by webRTCManager when the access token is bound to a participant
+	verifiedParticipantID string
+
+	// filled by webRTCManager when pathName is replaced with webrtcPathTemplate
+	requestedPathName string
+
+	// filled by webRTCManager when a resumed session had been migrated to another path
+	migratedPathName string
+
+	// filled by webRTCManager when a reader receives the audio mix of the room
+	mixPathName string
 }
 
 type webRTCAddSessionCandidatesRes struct {
@@ -321,22 +644,70 @@ type webRTCAddSessionCandidatesRes struct {
 
 type webRTCAddSessionCandidatesReq struct {
 	roomID     string
+	sessionID  uuid.UUID
 	secret     uuid.UUID
 	candidates []*webrtc.ICECandidateInit
 	res        chan webRTCAddSessionCandidatesRes
 }
 
+type webRTCRenegotiateSessionRes struct {
+	sx     *webRTCSession
+	answer []byte
+	err    error
+}
+
+type webRTCDeleteSessionReq struct {
+	sessionID uuid.UUID
+	secret    uuid.UUID
+	res       chan error
+}
+
+type webRTCRenegotiateSessionReq struct {
+	roomID string
+	secret uuid.UUID
+	offer  []byte
+	res    chan webRTCRenegotiateSessionRes
+}
+
 type webRTCManagerParent interface {
 	logger.Writer
 }
 type webRTCManager struct {
-	allowOrigin     string
-	trustedProxies  conf.IPsOrCIDRs
-	iceServers      []conf.WebRTCICEServer
-	readBufferCount int
-	pathManager     *pathManager
-	metrics         *metrics
-	parent          webRTCManagerParent
+	allowOrigin        string
+	trustedProxies     conf.IPsOrCIDRs
+	readTimeout        conf.StringDuration
+	readBufferCount    int
+	iceHostOnly        bool
+	pathManager        *pathManager
+	metrics            *metrics
+	tracer             *tracer
+	cluster            *cluster
+	loadMonitor        *loadMonitor
+	balancer           webrtcBalancer
+	parent             webRTCManagerParent
+	opusFmtp           string
+	fecOverhead        int
+	svcAdaptation      bool
+	h264FrameDropping  bool
+	jitterBufferDepth  int
+	dcLimits           webrtcDataChannelLimits
+	healthThreshold    int
+	healthHook         *webrtcHealthHook
+	captureS3Prefix    string
+	geoIP              *geoIPDatabase
+	resumeTimeout      time.Duration
+	maxSessions        int
+	maxSessionsPerIP   int
+	retryAfter         time.Duration
+	readBufferMaxCount int
+	dvrDuration        time.Duration
+	dvrPath            string
+	maxVideoBitrate    int
+	autoCreateRooms    bool
+	pathTemplate       string
+	roomChatHistory    int
+	roomLogSize        int
+	slate              *roomSlate
 
 	ctx              context.Context
 	ctxCancel        func()
@@ -344,22 +715,57 @@ type webRTCManager struct {
 	udpMuxLn         net.PacketConn
 	tcpMuxLn         net.Listener
 	api              *webrtc.API
+	certificates     []webrtc.Certificate
 	rooms            map[uuid.UUID]*Room
 	sessions         map[*webRTCSession]struct{}
 	sessionsBySecret map[uuid.UUID]*webRTCSession
+	resumeStates     map[string]*webRTCResumeState
+	feedbacksMutex   sync.Mutex
+	feedbacks        map[string]*webRTCPathFeedback
+	packetizersMutex sync.Mutex
+	packetizers      map[formats.Format]*webrtcPacketizer
+	draining         bool
+	uploads          sync.WaitGroup
+
+	// parameters that can be reloaded without restarting the manager
+	confMutex          sync.RWMutex
+	iceServers         []conf.WebRTCICEServer
+	recordConf         roomRecordConf
+	quotaConf          roomQuotaConf
+	handshakeTimeout   time.Duration
+	trackGatherTimeout time.Duration
+	roomProfiles       conf.WebRTCRoomProfiles
+	tenants            conf.Tenants
 
 	// in
 	chNewSession           chan webRTCNewSessionReq
 	chCloseSession         chan *webRTCSession
+	chSessionMigrated      chan webRTCManagerSessionMigratedReq
 	chAddSessionCandidates chan webRTCAddSessionCandidatesReq
+	chRenegotiateSession   chan webRTCRenegotiateSessionReq
+	chDeleteSession        chan webRTCDeleteSessionReq
 	chAPISessionsList      chan webRTCManagerAPISessionsListReq
 	chAPISessionsGet       chan webRTCManagerAPISessionsGetReq
+	chAPIRoomsList         chan webRTCManagerAPIRoomsListReq
 	chAPIRoomsGet          chan webRTCManagerAPIRoomsGetReq
 	chAPIConnsKick         chan webRTCManagerAPISessionsKickReq
+	chAPISessionsCapture   chan webRTCManagerAPISessionsCaptureReq
+	chAPISessionsMigrate   chan webRTCManagerAPISessionsMigrateReq
 	chAPIRoomsCreation     chan webRTCManagerAPIRoomsCreateReq
 	chAPIRoomsJoin         chan webRTCManagerAPIRoomsJoinReq
 	chAPIRoomsRecord       chan webRTCManagerAPIRoomsRecordReq
+	chAPIRoomsRecordPause  chan webRTCManagerAPIRoomsRecordPauseReq
+	chAPIRoomsProgram      chan webRTCManagerAPIRoomsProgramReq
+	chAPIRoomsMix          chan webRTCManagerAPIRoomsMixReq
+	chAPIRoomsGeo          chan webRTCManagerAPIRoomsGeoReq
+	chAPIRoomsMessage      chan webRTCManagerAPIRoomsMessageReq
 	chAPIRoomsCleanup      chan webRTCManagerAPIRoomsCleanupReq
+	chAPIRoomsKeysCreate   chan webRTCManagerAPIRoomsKeysCreateReq
+	chAPIRoomsKeysRevoke   chan webRTCManagerAPIRoomsKeysRevokeReq
+	chAPIRoomsTokensCreate chan webRTCManagerAPIRoomsTokensCreateReq
+	chAPIRoomsLogs         chan webRTCManagerAPIRoomsLogsReq
+	chAPIRoomsClone        chan webRTCManagerAPIRoomsCloneReq
+	chAPIDrain             chan struct{}
 
 	// out
 	done chan struct{}
@@ -370,53 +776,179 @@ func newWebRTCManager(
 	encryption bool,
 	serverKey string,
 	serverCert string,
+	clientCA string,
+	dtlsKey string,
+	dtlsCert string,
 	allowOrigin string,
 	trustedProxies conf.IPsOrCIDRs,
 	iceServers []conf.WebRTCICEServer,
+	handshakeTimeout conf.StringDuration,
+	trackGatherTimeout conf.StringDuration,
 	readTimeout conf.StringDuration,
 	readBufferCount int,
 	iceHostNAT1To1IPs []string,
 	iceUDPMuxAddress string,
 	iceTCPMuxAddress string,
+	iceTCPFallback bool,
+	iceUDPPortMin int,
+	iceUDPPortMax int,
+	iceHostOnly bool,
+	iceHostIPs []string,
+	opusInbandFEC bool,
+	opusDTX bool,
+	opusMaxAverageBitrate int,
+	nackBufferSize int,
+	fecOverhead int,
+	svcAdaptation bool,
+	h264FrameDropping bool,
+	jitterBufferDepth int,
+	dcLimits webrtcDataChannelLimits,
+	resumeTimeout conf.StringDuration,
+	maxSessions int,
+	maxSessionsPerIP int,
+	retryAfter conf.StringDuration,
+	readBufferMaxCount int,
+	recordConf roomRecordConf,
+	quotaConf roomQuotaConf,
+	dvrDuration conf.StringDuration,
+	dvrPath string,
+	maxVideoBitrate int,
+	autoCreateRooms bool,
+	pathTemplate string,
+	roomChatHistory int,
+	roomLogSize int,
+	slatePath string,
+	slateFrameRate int,
+	roomProfiles conf.WebRTCRoomProfiles,
+	tenants conf.Tenants,
+	loadMaxCPU int,
+	loadMaxEgress int,
+	balancerInstances []string,
+	balancerHook string,
+	healthThreshold int,
+	healthHook string,
+	captureS3Prefix string,
+	geoIPDatabasePath string,
 	pathManager *pathManager,
 	metrics *metrics,
+	tracer *tracer,
+	cluster *cluster,
 	parent webRTCManagerParent,
 ) (*webRTCManager, error) {
+	var slate *roomSlate
+	if slatePath != "" {
+		var err error
+		slate, err = loadRoomSlate(slatePath, slateFrameRate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var geoIP *geoIPDatabase
+	if geoIPDatabasePath != "" {
+		var err error
+		geoIP, err = loadGeoIPDatabase(geoIPDatabasePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	ctx, ctxCancel := context.WithCancel(context.Background())
 
 	m := &webRTCManager{
 		allowOrigin:            allowOrigin,
 		trustedProxies:         trustedProxies,
-		iceServers:             iceServers,
+		readTimeout:            readTimeout,
 		readBufferCount:        readBufferCount,
+		iceServers:             iceServers,
+		iceHostOnly:            iceHostOnly,
+		recordConf:             recordConf,
+		quotaConf:              quotaConf,
+		handshakeTimeout:       time.Duration(handshakeTimeout),
+		trackGatherTimeout:     time.Duration(trackGatherTimeout),
+		roomProfiles:           roomProfiles,
+		tenants:                tenants,
+		fecOverhead:            fecOverhead,
+		svcAdaptation:          svcAdaptation,
+		h264FrameDropping:      h264FrameDropping,
+		jitterBufferDepth:      jitterBufferDepth,
+		dcLimits:               dcLimits,
+		healthThreshold:        healthThreshold,
+		captureS3Prefix:        captureS3Prefix,
+		geoIP:                  geoIP,
+		resumeTimeout:          time.Duration(resumeTimeout),
+		maxSessions:            maxSessions,
+		maxSessionsPerIP:       maxSessionsPerIP,
+		retryAfter:             time.Duration(retryAfter),
+		readBufferMaxCount:     readBufferMaxCount,
+		dvrDuration:            time.Duration(dvrDuration),
+		dvrPath:                dvrPath,
+		maxVideoBitrate:        maxVideoBitrate,
+		autoCreateRooms:        autoCreateRooms,
+		pathTemplate:           pathTemplate,
+		roomChatHistory:        roomChatHistory,
+		roomLogSize:            roomLogSize,
+		slate:                  slate,
 		pathManager:            pathManager,
 		metrics:                metrics,
+		tracer:                 tracer,
+		cluster:                cluster,
 		parent:                 parent,
 		ctx:                    ctx,
 		ctxCancel:              ctxCancel,
 		rooms:                  make(map[uuid.UUID]*Room),
 		sessions:               make(map[*webRTCSession]struct{}),
 		sessionsBySecret:       make(map[uuid.UUID]*webRTCSession),
+		resumeStates:           make(map[string]*webRTCResumeState),
+		feedbacks:              make(map[string]*webRTCPathFeedback),
+		packetizers:            make(map[formats.Format]*webrtcPacketizer),
 		chNewSession:           make(chan webRTCNewSessionReq),
 		chCloseSession:         make(chan *webRTCSession),
+		chSessionMigrated:      make(chan webRTCManagerSessionMigratedReq),
 		chAddSessionCandidates: make(chan webRTCAddSessionCandidatesReq),
+		chRenegotiateSession:   make(chan webRTCRenegotiateSessionReq),
+		chDeleteSession:        make(chan webRTCDeleteSessionReq),
 		chAPISessionsList:      make(chan webRTCManagerAPISessionsListReq),
 		chAPISessionsGet:       make(chan webRTCManagerAPISessionsGetReq),
 		chAPIConnsKick:         make(chan webRTCManagerAPISessionsKickReq),
+		chAPISessionsCapture:   make(chan webRTCManagerAPISessionsCaptureReq),
+		chAPISessionsMigrate:   make(chan webRTCManagerAPISessionsMigrateReq),
+		chAPIRoomsList:         make(chan webRTCManagerAPIRoomsListReq),
 		chAPIRoomsGet:          make(chan webRTCManagerAPIRoomsGetReq),
 		chAPIRoomsCreation:     make(chan webRTCManagerAPIRoomsCreateReq),
 		chAPIRoomsJoin:         make(chan webRTCManagerAPIRoomsJoinReq),
 		chAPIRoomsRecord:       make(chan webRTCManagerAPIRoomsRecordReq),
+		chAPIRoomsRecordPause:  make(chan webRTCManagerAPIRoomsRecordPauseReq),
+		chAPIRoomsProgram:      make(chan webRTCManagerAPIRoomsProgramReq),
+		chAPIRoomsMix:          make(chan webRTCManagerAPIRoomsMixReq),
+		chAPIRoomsGeo:          make(chan webRTCManagerAPIRoomsGeoReq),
+		chAPIRoomsMessage:      make(chan webRTCManagerAPIRoomsMessageReq),
 		chAPIRoomsCleanup:      make(chan webRTCManagerAPIRoomsCleanupReq),
+		chAPIRoomsKeysCreate:   make(chan webRTCManagerAPIRoomsKeysCreateReq),
+		chAPIRoomsKeysRevoke:   make(chan webRTCManagerAPIRoomsKeysRevokeReq),
+		chAPIRoomsTokensCreate: make(chan webRTCManagerAPIRoomsTokensCreateReq),
+		chAPIRoomsLogs:         make(chan webRTCManagerAPIRoomsLogsReq),
+		chAPIRoomsClone:        make(chan webRTCManagerAPIRoomsCloneReq),
+		chAPIDrain:             make(chan struct{}),
 		done:                   make(chan struct{}),
 	}
 
+	if dtlsKey != "" {
+		cert, err := webrtcLoadCertificate(dtlsKey, dtlsCert)
+		if err != nil {
+			ctxCancel()
+			return nil, err
+		}
+		m.certificates = []webrtc.Certificate{*cert}
+	}
+
 	var err error
 	m.httpServer, err = newWebRTCHTTPServer(
 		address,
 		encryption,
 		serverKey,
 		serverCert,
+		clientCA,
 		allowOrigin,
 		trustedProxies,
 		readTimeout,
@@ -445,7 +977,9 @@ func newWebRTCManager(
 	if iceTCPMuxAddress != "" {
 		m.tcpMuxLn, err = net.Listen(restrictNetwork("tcp", iceTCPMuxAddress))
 		if err != nil {
-			m.udpMuxLn.Close()
+			if m.udpMuxLn != nil {
+				m.udpMuxLn.Close()
+			}
 			m.httpServer.close()
 			ctxCancel()
 			return nil, err
@@ -453,10 +987,28 @@ func newWebRTCManager(
 		iceTCPMux = webrtc.NewICETCPMux(nil, m.tcpMuxLn, 8)
 	}
 
-	m.api, err = webrtcNewAPI(iceHostNAT1To1IPs, iceUDPMux, iceTCPMux)
+	m.opusFmtp = webrtcOpusFmtp(opusInbandFEC, opusDTX, opusMaxAverageBitrate)
+
+	m.api, err = webrtcNewAPI(webrtcAPIConf{
+		iceHostNAT1To1IPs: iceHostNAT1To1IPs,
+		iceUDPMux:         iceUDPMux,
+		iceTCPMux:         iceTCPMux,
+		iceTCPFallback:    iceTCPFallback,
+		iceUDPPortMin:     uint16(iceUDPPortMin),
+		iceUDPPortMax:     uint16(iceUDPPortMax),
+		iceHostOnly:       iceHostOnly,
+		iceHostIPs:        iceHostIPs,
+		opusFmtp:          m.opusFmtp,
+		nackBufferSize:    uint16(nackBufferSize),
+		fec:               fecOverhead != 0,
+	})
 	if err != nil {
-		m.udpMuxLn.Close()
-		m.tcpMuxLn.Close()
+		if m.udpMuxLn != nil {
+			m.udpMuxLn.Close()
+		}
+		if m.tcpMuxLn != nil {
+			m.tcpMuxLn.Close()
+		}
 		m.httpServer.close()
 		ctxCancel()
 		return nil, err
@@ -469,12 +1021,32 @@ func newWebRTCManager(
 	if m.tcpMuxLn != nil {
 		str += ", " + iceTCPMuxAddress + " (ICE/TCP)"
 	}
+	if iceUDPPortMin != 0 {
+		str += ", " + strconv.FormatInt(int64(iceUDPPortMin), 10) + "-" +
+			strconv.FormatInt(int64(iceUDPPortMax), 10) + " (ICE/UDP)"
+	}
 	m.Log(logger.Info, str)
 
 	if m.metrics != nil {
 		m.metrics.webRTCManagerSet(m)
 	}
 
+	if loadMaxCPU != 0 || loadMaxEgress != 0 {
+		m.loadMonitor = newLoadMonitor(loadMaxCPU, loadMaxEgress, m)
+	}
+
+	switch {
+	case balancerHook != "":
+		m.balancer = newWebRTCBalancerHook(balancerHook, time.Duration(readTimeout))
+
+	case len(balancerInstances) != 0:
+		m.balancer = newWebRTCBalancerRoundRobin(balancerInstances)
+	}
+
+	if healthHook != "" {
+		m.healthHook = newWebRTCHealthHook(healthHook, time.Duration(readTimeout))
+	}
+
 	go m.run()
 
 	return m, nil
@@ -496,79 +1068,309 @@ func (m *webRTCManager) run() {
 
 	var wg sync.WaitGroup
 
+	viewersTicker := time.NewTicker(webrtcRoomViewersSampleInterval)
+	defer viewersTicker.Stop()
+
+	scheduleTicker := time.NewTicker(webrtcRoomScheduleCheckInterval)
+	defer scheduleTicker.Stop()
+
+	gcTicker := time.NewTicker(webrtcRecordGCPeriod)
+	defer gcTicker.Stop()
+
 outer:
 	for {
 		select {
 		case req := <-m.chNewSession:
-			sx := newWebRTCSession(
-				m.ctx,
-				m.readBufferCount,
-				m.api,
-				req,
-				&wg,
-				m.pathManager,
-				m,
-			)
-			m.sessions[sx] = struct{}{}
-			parsedRoomID := uuid.MustParse(req.roomID)
-			room := m.findRoomByUUID(parsedRoomID)
-			if room == nil {
-				req.res <- webRTCNewSessionRes{err: fmt.Errorf("cannot create session: room doesn't exists")}
+			m.deleteExpiredResumeStates()
+
+			var resumeState *webRTCResumeState
+			if req.resumeToken != "" {
+				var err error
+				resumeState, err = m.findResumeState(req)
+				if err != nil {
+					m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+					req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusBadRequest}
+					continue
+				}
+			}
+
+			// sessions that are resumed are accepted, since they belong to ongoing rooms
+			if m.draining && resumeState == nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, errAPIDraining)
+				req.res <- webRTCNewSessionRes{err: errAPIDraining, errStatusCode: http.StatusServiceUnavailable}
 				continue
 			}
-			room.sessions[sx] = struct{}{}
-			room.sessionsBySecret[sx.secret] = sx
-			if req.publish {
-	
-				s := room.streamers[req.pathName]
-				if s == nil {
-					room.streamers[req.pathName] = &streamer{ 
-						id: req.pathName,
-					}
-					room.streamers[req.pathName].session = sx
-				} else {
-					s.session = sx
+
+			room, errStatusCode, err := m.findOrCreateSessionRoom(req)
+			if err != nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: errStatusCode}
+				continue
+			}
+
+			// paths of publishers are derived from the room, instead of being chosen by clients
+			if req.publish && m.pathTemplate != "" {
+				req.requestedPathName = req.pathName
+				req.pathName, err = webrtcTemplatePathName(m.pathTemplate, room, req)
+				if err != nil {
+					m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+					req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusBadRequest}
+					continue
 				}
-				
 			}
-			req.res <- webRTCNewSessionRes{sx: sx}
 
-		case sx := <-m.chCloseSession:
-			room := m.findRoomByUUID(sx.roomid)
-			if room != nil {
-				delete(room.sessions, sx)
-				delete(room.sessionsBySecret, sx.secret)
+			err = room.checkGeo(req.remoteAddr, m.geoIP)
+			if err != nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusForbidden}
+				continue
 			}
-			delete(m.sessions, sx)
-			delete(m.sessionsBySecret, sx.secret)
 
-		case req := <-m.chAddSessionCandidates:
-			parsedRoomID := uuid.MustParse(req.roomID)
-			room := m.findRoomByUUID(parsedRoomID)
-			if room == nil {
-				req.res <- webRTCAddSessionCandidatesRes{err: fmt.Errorf("room doesn't exists")}
+			req.roomKeyAuth, err = m.publishKeysRoom(room).authenticatePublishKey(req)
+			if err != nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusUnauthorized}
 				continue
 			}
-			sx, ok := room.sessionsBySecret[req.secret]
-			if !ok {
-				req.res <- webRTCAddSessionCandidatesRes{err: fmt.Errorf("session not found")}
+
+			req.accessToken, err = room.authenticateAccessToken(req, time.Now())
+			if err != nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusUnauthorized}
 				continue
 			}
+			if req.accessToken != "" {
+				req.roomKeyAuth = true
 
-			req.res <- webRTCAddSessionCandidatesRes{sx: sx}
+				// the identity provided by the client is replaced with the one of the token
+				if id := room.accessTokens[req.accessToken].participantID; id != "" {
+					req.participantID = id
+					req.verifiedParticipantID = id
+				}
+			}
 
-		case req := <-m.chAPISessionsList:
-			data := &apiWebRTCSessionsList{
-				Items: []*apiWebRTCSession{},
+			err = room.schedule.checkOpen(time.Now())
+			if err != nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusForbidden}
+				continue
 			}
 
-			for sx := range m.sessions {
-				data.Items = append(data.Items, sx.apiItem())
+			if !req.publish {
+				req.mixPathName, err = room.mixForReader(req)
+				if err != nil {
+					m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+					req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusForbidden}
+					continue
+				}
 			}
 
-			sort.Slice(data.Items, func(i, j int) bool {
-				return data.Items[i].Created.Before(data.Items[j].Created)
-			})
+			if !req.publish && room.quota.egressExceeded {
+				err = fmt.Errorf("egress quota of the room exceeded")
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusForbidden}
+				continue
+			}
+
+			var replaced *webRTCSession
+			if resumeState != nil {
+				replaced = resumeState.session
+			}
+
+			err = room.checkParticipants(replaced)
+			if err != nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusForbidden}
+				continue
+			}
+
+			err = m.checkTenantSession(room, req.pathName, replaced)
+			if err != nil {
+				m.Log(logger.Info, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{err: err, errStatusCode: http.StatusForbidden}
+				continue
+			}
+
+			err = m.checkSessionLimits(req.remoteAddr, replaced)
+			if err != nil {
+				m.Log(logger.Warn, "session from %s rejected: %v", req.remoteAddr, err)
+				req.res <- webRTCNewSessionRes{
+					err:           err,
+					errStatusCode: http.StatusServiceUnavailable,
+					retryAfter:    m.retryAfter,
+				}
+				continue
+			}
+
+			if resumeState != nil {
+				delete(m.resumeStates, resumeState.token)
+				req.sessionUUID = resumeState.uuid
+
+				// the resumed session keeps publishing to the path chosen through the API
+				if resumeState.migratedPathName != "" {
+					if req.requestedPathName == "" {
+						req.requestedPathName = req.pathName
+					}
+					req.pathName = resumeState.migratedPathName
+					req.migratedPathName = resumeState.migratedPathName
+					req.roomKeyAuth = true
+				}
+
+				// the previous session may not have noticed the network failure yet
+				if prev := resumeState.session; prev != nil {
+					delete(m.sessions, prev)
+					delete(m.sessionsBySecret, prev.secret)
+					delete(room.sessions, prev)
+					delete(room.sessionsBySecret, prev.secret)
+					prev.close()
+					req.resumed = prev
+				}
+			}
+
+			sx := newWebRTCSession(
+				m.ctx,
+				m.readBufferCount,
+				m.api,
+				m.certificates,
+				req,
+				room.iceServers,
+				room.logs,
+				&wg,
+				m.pathManager,
+				m,
+			)
+			m.sessions[sx] = struct{}{}
+			room.sessions[sx] = struct{}{}
+			room.sessionsBySecret[sx.secret] = sx
+
+			if resumeState != nil {
+				room.events.writeSession(roomEventResume, sx)
+			} else {
+				room.events.writeSession(roomEventJoin, sx)
+			}
+
+			if !req.publish {
+				room.analytics.readerJoined(sx, time.Now())
+			}
+
+			if req.accessToken != "" {
+				room.useAccessToken(req.accessToken, sx)
+			}
+
+			var resumeToken string
+			if req.publish && m.resumeTimeout != 0 {
+				resumeToken = m.addResumeState(sx)
+			}
+
+			if req.publish {
+	
+				s := room.streamers[req.pathName]
+				if s == nil {
+					room.streamers[req.pathName] = &streamer{ 
+						id: req.pathName,
+					}
+					room.streamers[req.pathName].session = sx
+				} else {
+					s.session = sx
+				}
+				m.enableLLHLS(room, req.pathName)
+				m.syncGeo(room)
+			}
+			req.res <- webRTCNewSessionRes{sx: sx, resumeToken: resumeToken}
+
+		case sx := <-m.chCloseSession:
+			resumable := m.expireResumeState(sx)
+			m.deleteExpiredResumeStates()
+
+			room := m.findRoomByUUID(sx.roomid)
+			if room != nil {
+				if _, ok := room.sessions[sx]; ok {
+					room.events.writeSession(roomEventLeave, sx)
+					if !sx.req.publish {
+						room.removeReader(sx)
+						room.analytics.readerLeft(sx, time.Now())
+					} else if resumable && m.slate != nil {
+						room.startSlate(sx, m.slate, m.resumeTimeout)
+					}
+				}
+				if sx.req.accessToken != "" {
+					room.releaseAccessToken(sx.req.accessToken, sx)
+				}
+				delete(room.sessions, sx)
+				delete(room.sessionsBySecret, sx.secret)
+			}
+			delete(m.sessions, sx)
+			delete(m.sessionsBySecret, sx.secret)
+
+		case req := <-m.chSessionMigrated:
+			m.onSessionMigrated(req)
+
+		case req := <-m.chAddSessionCandidates:
+			// sessions are identified by their resource URL
+			if req.sessionID != uuid.Nil {
+				sx, err := m.findSessionResource(req.sessionID, req.secret)
+				if err != nil {
+					req.res <- webRTCAddSessionCandidatesRes{err: err}
+					continue
+				}
+
+				req.res <- webRTCAddSessionCandidatesRes{sx: sx}
+				continue
+			}
+
+			err := checkRoomID(req.roomID)
+			if err != nil {
+				req.res <- webRTCAddSessionCandidatesRes{err: err}
+				continue
+			}
+			parsedRoomID := uuid.MustParse(req.roomID)
+			room := m.findRoomByUUID(parsedRoomID)
+			if room == nil {
+				req.res <- webRTCAddSessionCandidatesRes{err: fmt.Errorf("room doesn't exist")}
+				continue
+			}
+			sx, ok := room.sessionsBySecret[req.secret]
+			if !ok {
+				req.res <- webRTCAddSessionCandidatesRes{err: errWebRTCSessionNotFound}
+				continue
+			}
+
+			req.res <- webRTCAddSessionCandidatesRes{sx: sx}
+
+		case req := <-m.chRenegotiateSession:
+			err := checkRoomID(req.roomID)
+			if err != nil {
+				req.res <- webRTCRenegotiateSessionRes{err: err}
+				continue
+			}
+			parsedRoomID := uuid.MustParse(req.roomID)
+			room := m.findRoomByUUID(parsedRoomID)
+			if room == nil {
+				req.res <- webRTCRenegotiateSessionRes{err: fmt.Errorf("room doesn't exist")}
+				continue
+			}
+			sx, ok := room.sessionsBySecret[req.secret]
+			if !ok {
+				req.res <- webRTCRenegotiateSessionRes{err: fmt.Errorf("session not found")}
+				continue
+			}
+
+			req.res <- webRTCRenegotiateSessionRes{sx: sx}
+
+		case req := <-m.chAPISessionsList:
+			data := &apiWebRTCSessionsList{
+				Items: []*apiWebRTCSession{},
+			}
+
+			for sx := range m.sessions {
+				item := sx.apiItem()
+				item.Tenant = m.sessionTenant(sx)
+				data.Items = append(data.Items, item)
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
 
 			req.res <- webRTCManagerAPISessionsListRes{data: data}
 
@@ -579,7 +1381,21 @@ outer:
 				continue
 			}
 
-			req.res <- webRTCManagerAPISessionsGetRes{data: sx.apiItem()}
+			item := sx.apiItem()
+			item.Tenant = m.sessionTenant(sx)
+			req.res <- webRTCManagerAPISessionsGetRes{data: item}
+
+		case req := <-m.chDeleteSession:
+			sx, err := m.findSessionResource(req.sessionID, req.secret)
+			if err != nil {
+				req.res <- err
+				continue
+			}
+
+			delete(m.sessions, sx)
+			delete(m.sessionsBySecret, sx.secret)
+			sx.close()
+			req.res <- nil
 
 		case req := <-m.chAPIConnsKick:
 			sx := m.findSessionByUUID(req.uuid)
@@ -593,6 +1409,62 @@ outer:
 			sx.close()
 			req.res <- webRTCManagerAPISessionsKickRes{}
 
+		case req := <-m.chAPISessionsMigrate:
+			sx := m.findSessionByUUID(req.uuid)
+			if sx == nil {
+				req.res <- webRTCManagerAPISessionsMigrateRes{err: errAPINotFound}
+				continue
+			}
+
+			if !sx.req.publish {
+				req.res <- webRTCManagerAPISessionsMigrateRes{
+					err: errAPIBadRequest{fmt.Errorf("only publishers can be migrated")},
+				}
+				continue
+			}
+
+			// sessions can't be moved to paths of other tenants
+			tenantName := m.sessionTenant(sx)
+			if tenant := m.tenant(tenantName); tenant != nil && !tenant.OwnsPath(req.pathName) {
+				req.res <- webRTCManagerAPISessionsMigrateRes{
+					err: errAPIBadRequest{fmt.Errorf("path '%s' doesn't belong to tenant '%s'", req.pathName, tenantName)},
+				}
+				continue
+			}
+
+			req.res <- webRTCManagerAPISessionsMigrateRes{sx: sx}
+
+		case req := <-m.chAPISessionsCapture:
+			sx := m.findSessionByUUID(req.uuid)
+			if sx == nil {
+				req.res <- webRTCManagerAPISessionsCaptureRes{err: errAPINotFound}
+				continue
+			}
+
+			room := m.findRoomByUUID(sx.roomid)
+			if room == nil {
+				req.res <- webRTCManagerAPISessionsCaptureRes{err: errAPINotFound}
+				continue
+			}
+
+			data, err := sx.startCapture(room, m.captureS3Prefix, req.format, req.duration)
+			req.res <- webRTCManagerAPISessionsCaptureRes{data: data, err: err}
+
+		case req := <-m.chAPIRoomsList:
+			data := &apiWebRTCRoomsList{
+				Items: []*apiWebRTCRoom{},
+			}
+
+			for _, r := range m.rooms {
+				data.Items = append(data.Items, r.apiItem())
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
+
+			req.res <- webRTCManagerAPIRoomsListRes{data: data}
+
 		case req := <-m.chAPIRoomsGet:
 			r := m.findRoomByUUID(req.uuid)
 			if r == nil {
@@ -603,12 +1475,13 @@ outer:
 
 		case req := <-m.chAPIRoomsCreation:
 			{
-				roomID, err := m.createRoom(req.clubName, req.eventName)
+				room, err := m.createRoom(uuid.New(), req.clubName, req.eventName,
+					req.s3Conf, req.iceServers, req.restream, req.program, req.schedule, req.profile)
 				if err != nil {
 					req.res <- webRTCManagerAPIRoomsCreateRes{err: err}
 					continue
 				}
-				req.res <- webRTCManagerAPIRoomsCreateRes{uuid: roomID}
+				req.res <- webRTCManagerAPIRoomsCreateRes{uuid: room.uuid}
 			}
 		case req := <-m.chAPIRoomsJoin:
 			{
@@ -623,6 +1496,8 @@ outer:
 					req.res <- webRTCManagerAPIRoomsJoinRes{err: err}
 					continue
 				}
+				m.enableLLHLS(room, req.streamID)
+				m.syncGeo(room)
 
 				req.res <- webRTCManagerAPIRoomsJoinRes{}
 			}
@@ -644,6 +1519,86 @@ outer:
 				req.res <- webRTCManagerAPIRoomsRecordRes{}
 			}
 
+		case req := <-m.chAPIRoomsRecordPause:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsRecordPauseRes{err: errAPINotFound}
+					continue
+				}
+
+				err := room.setRecordingPaused(req.pause)
+				req.res <- webRTCManagerAPIRoomsRecordPauseRes{err: err}
+			}
+
+		case req := <-m.chAPIRoomsProgram:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsProgramRes{err: errAPINotFound}
+					continue
+				}
+
+				err := room.switchProgram(req.source)
+				if err != nil {
+					req.res <- webRTCManagerAPIRoomsProgramRes{err: errAPIBadRequest{err}}
+					continue
+				}
+
+				req.res <- webRTCManagerAPIRoomsProgramRes{}
+			}
+
+		case req := <-m.chAPIRoomsMix:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsMixRes{err: errAPINotFound}
+					continue
+				}
+
+				err := room.setMix(req.mix, m.pathManager, m.pathManager.externalCmdPool, m.pathManager.rtspAddress)
+				if err != nil {
+					req.res <- webRTCManagerAPIRoomsMixRes{err: errAPIBadRequest{err}}
+					continue
+				}
+				m.syncGeo(room)
+
+				req.res <- webRTCManagerAPIRoomsMixRes{}
+			}
+
+		case req := <-m.chAPIRoomsGeo:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsGeoRes{err: errAPINotFound}
+					continue
+				}
+
+				geo, err := newRoomGeo(req.geo, m.geoIP)
+				if err != nil {
+					req.res <- webRTCManagerAPIRoomsGeoRes{err: errAPIBadRequest{err}}
+					continue
+				}
+
+				room.geo = geo
+				m.syncGeo(room)
+				room.Log(logger.Info, "geographic restrictions updated")
+
+				req.res <- webRTCManagerAPIRoomsGeoRes{}
+			}
+
+		case req := <-m.chAPIRoomsMessage:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsMessageRes{err: errAPINotFound}
+					continue
+				}
+
+				err := room.sendMessage(req.data)
+				req.res <- webRTCManagerAPIRoomsMessageRes{err: err}
+			}
+
 		case req := <-m.chAPIRoomsCleanup:
 			{
 				room := m.findRoomByUUID(req.uuid)
@@ -652,6 +1607,8 @@ outer:
 					continue
 				}
 
+				m.disableLLHLS(room)
+				m.clearGeo(room)
 				err := room.cleanup()
 				if err != nil {
 					req.res <- webRTCManagerAPIRoomsCleanupRes{err: err}
@@ -661,6 +1618,93 @@ outer:
 
 				req.res <- webRTCManagerAPIRoomsCleanupRes{}
 			}
+
+		case req := <-m.chAPIRoomsKeysCreate:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsKeysCreateRes{err: errAPINotFound}
+					continue
+				}
+
+				key, err := room.mintPublishKey(req.pathName)
+				req.res <- webRTCManagerAPIRoomsKeysCreateRes{key: key, err: err}
+			}
+
+		case req := <-m.chAPIRoomsKeysRevoke:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsKeysRevokeRes{err: errAPINotFound}
+					continue
+				}
+
+				err := room.revokePublishKey(req.key)
+				req.res <- webRTCManagerAPIRoomsKeysRevokeRes{err: err}
+			}
+
+		case req := <-m.chAPIRoomsTokensCreate:
+			{
+				room := m.findRoomByUUID(req.uuid)
+				if room == nil {
+					req.res <- webRTCManagerAPIRoomsTokensCreateRes{err: errAPINotFound}
+					continue
+				}
+
+				token, expiry, err := room.mintAccessToken(req.pathName, req.participantID, req.duration, time.Now())
+				req.res <- webRTCManagerAPIRoomsTokensCreateRes{token: token, expiry: expiry, err: err}
+			}
+
+		case req := <-m.chAPIRoomsLogs:
+			room := m.findRoomByUUID(req.uuid)
+			if room == nil {
+				req.res <- webRTCManagerAPIRoomsLogsRes{err: errAPINotFound}
+				continue
+			}
+
+			req.res <- webRTCManagerAPIRoomsLogsRes{data: room.logs.apiItems(req.minLevel)}
+
+		case req := <-m.chAPIRoomsClone:
+			src := m.findRoomByUUID(req.uuid)
+			if src == nil {
+				req.res <- webRTCManagerAPIRoomsCloneRes{err: errAPINotFound}
+				continue
+			}
+
+			room, err := m.cloneRoom(src)
+			if err != nil {
+				req.res <- webRTCManagerAPIRoomsCloneRes{err: err}
+				continue
+			}
+
+			req.res <- webRTCManagerAPIRoomsCloneRes{uuid: room.uuid}
+
+		case <-m.chAPIDrain:
+			m.draining = true
+		case now := <-viewersTicker.C:
+			m.confMutex.RLock()
+			quotaConf := m.quotaConf
+			m.confMutex.RUnlock()
+
+			for _, room := range m.rooms {
+				room.sampleViewers(now)
+				room.checkQuotas(quotaConf)
+			}
+
+			if m.cluster != nil {
+				m.cluster.setSessions(m.clusterSessions())
+			}
+
+		case now := <-scheduleTicker.C:
+			m.checkSchedules(now)
+
+		case <-gcTicker.C:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.collectRecordingGarbage()
+			}()
+
 		case <-m.ctx.Done():
 			break outer
 		}
@@ -679,6 +1723,10 @@ outer:
 	if m.tcpMuxLn != nil {
 		m.tcpMuxLn.Close()
 	}
+
+	if m.loadMonitor != nil {
+		m.loadMonitor.close()
+	}
 }
 
 func (m *webRTCManager) findSessionByUUID(uuid uuid.UUID) *webRTCSession {
@@ -690,6 +1738,22 @@ func (m *webRTCManager) findSessionByUUID(uuid uuid.UUID) *webRTCSession {
 	return nil
 }
 
+// findSessionResource returns the session with the given ID, after checking
+// that the entity tag provided by the client is the one of the session.
+// A session that has been resumed has a different entity tag than the one it replaces.
+func (m *webRTCManager) findSessionResource(sessionID uuid.UUID, secret uuid.UUID) (*webRTCSession, error) {
+	sx := m.findSessionByUUID(sessionID)
+	if sx == nil {
+		return nil, errWebRTCSessionNotFound
+	}
+
+	if sx.secret != secret {
+		return nil, errWebRTCPreconditionFailed
+	}
+
+	return sx, nil
+}
+
 func (m *webRTCManager) findRoomByUUID(uuid uuid.UUID) *Room {
 	for rID, room := range m.rooms {
 		if rID == uuid {
@@ -699,10 +1763,53 @@ func (m *webRTCManager) findRoomByUUID(uuid uuid.UUID) *Room {
 	return nil
 }
 
-func (m *webRTCManager) generateICEServers() ([]webrtc.ICEServer, error) {
-	ret := make([]webrtc.ICEServer, len(m.iceServers))
+// confReload is called by core.
+func (m *webRTCManager) confReload(
+	iceServers []conf.WebRTCICEServer,
+	recordConf roomRecordConf,
+	quotaConf roomQuotaConf,
+	handshakeTimeout conf.StringDuration,
+	trackGatherTimeout conf.StringDuration,
+	roomProfiles conf.WebRTCRoomProfiles,
+	tenants conf.Tenants,
+) {
+	m.confMutex.Lock()
+	defer m.confMutex.Unlock()
+
+	m.iceServers = iceServers
+	m.recordConf = recordConf
+	m.quotaConf = quotaConf
+	m.handshakeTimeout = time.Duration(handshakeTimeout)
+	m.trackGatherTimeout = time.Duration(trackGatherTimeout)
+	m.roomProfiles = roomProfiles
+	m.tenants = tenants
+}
+
+// sessionTimeouts returns the handshake timeout and the track gather timeout of sessions.
+func (m *webRTCManager) sessionTimeouts() (time.Duration, time.Duration) {
+	m.confMutex.RLock()
+	defer m.confMutex.RUnlock()
+	return m.handshakeTimeout, m.trackGatherTimeout
+}
 
-	for i, server := range m.iceServers {
+// generateICEServers generates the ICE servers provided to clients.
+// Servers of a room, when set, replace the ones in the configuration.
+func (m *webRTCManager) generateICEServers(roomServers []conf.WebRTCICEServer) ([]webrtc.ICEServer, error) {
+	// STUN and TURN servers are not used by both parties, in order to gather host candidates only
+	if m.iceHostOnly {
+		return []webrtc.ICEServer{}, nil
+	}
+
+	iceServers := roomServers
+	if iceServers == nil {
+		m.confMutex.RLock()
+		iceServers = m.iceServers
+		m.confMutex.RUnlock()
+	}
+
+	ret := make([]webrtc.ICEServer, len(iceServers))
+
+	for i, server := range iceServers {
 		if server.Username == "AUTH_SECRET" {
 			expireDate := time.Now().Add(webrtcTurnSecretExpiration).Unix()
 
@@ -736,8 +1843,13 @@ func (m *webRTCManager) newSession(req webRTCNewSessionReq) webRTCNewSessionRes
 	select {
 	case m.chNewSession <- req:
 		res := <-req.res
+		if res.err != nil {
+			return res
+		}
 
-		return res.sx.new(req)
+		res2 := res.sx.new(req)
+		res2.resumeToken = res.resumeToken
+		return res2
 
 	case <-m.ctx.Done():
 		return webRTCNewSessionRes{err: fmt.Errorf("terminated"), errStatusCode: http.StatusInternalServerError}
@@ -752,33 +1864,179 @@ func (m *webRTCManager) closeSession(sx *webRTCSession) {
 	}
 }
 
+// sessionMigrated is called by webRTCSession.
+func (m *webRTCManager) sessionMigrated(req webRTCManagerSessionMigratedReq) {
+	select {
+	case m.chSessionMigrated <- req:
+	case <-m.ctx.Done():
+	}
+}
+
+// acquirePathFeedback is called by webRTCSession.
+func (m *webRTCManager) acquirePathFeedback(pathName string) *webRTCPathFeedback {
+	m.feedbacksMutex.Lock()
+	defer m.feedbacksMutex.Unlock()
+
+	f, ok := m.feedbacks[pathName]
+	if !ok {
+		f = newWebRTCPathFeedback()
+		m.feedbacks[pathName] = f
+	}
+
+	f.refCount++
+	return f
+}
+
+// releasePathFeedback is called by webRTCSession.
+func (m *webRTCManager) releasePathFeedback(pathName string) {
+	m.feedbacksMutex.Lock()
+	defer m.feedbacksMutex.Unlock()
+
+	f := m.feedbacks[pathName]
+	f.refCount--
+	if f.refCount == 0 {
+		delete(m.feedbacks, pathName)
+	}
+}
+
 // addSessionCandidates is called by webRTCHTTPServer.
 func (m *webRTCManager) addSessionCandidates(
 	req webRTCAddSessionCandidatesReq,
 ) webRTCAddSessionCandidatesRes {
 	req.res = make(chan webRTCAddSessionCandidatesRes)
 	select {
-	case m.chAddSessionCandidates <- req:
-		res1 := <-req.res
-		if res1.err != nil {
-			return res1
+	case m.chAddSessionCandidates <- req:
+		res1 := <-req.res
+		if res1.err != nil {
+			return res1
+		}
+
+		return res1.sx.addCandidates(req)
+
+	case <-m.ctx.Done():
+		return webRTCAddSessionCandidatesRes{err: fmt.Errorf("terminated")}
+	}
+}
+
+// deleteSession is called by webRTCHTTPServer.
+func (m *webRTCManager) deleteSession(req webRTCDeleteSessionReq) error {
+	req.res = make(chan error)
+	select {
+	case m.chDeleteSession <- req:
+		return <-req.res
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// renegotiateSession is called by webRTCHTTPServer.
+func (m *webRTCManager) renegotiateSession(
+	req webRTCRenegotiateSessionReq,
+) webRTCRenegotiateSessionRes {
+	req.res = make(chan webRTCRenegotiateSessionRes)
+	select {
+	case m.chRenegotiateSession <- req:
+		res1 := <-req.res
+		if res1.err != nil {
+			return res1
+		}
+
+		return res1.sx.renegotiate(req)
+
+	case <-m.ctx.Done():
+		return webRTCRenegotiateSessionRes{err: fmt.Errorf("terminated")}
+	}
+}
+
+// apiSessionsList is called by api.
+func (m *webRTCManager) apiSessionsList() (*apiWebRTCSessionsList, error) {
+	req := webRTCManagerAPISessionsListReq{
+		res: make(chan webRTCManagerAPISessionsListRes),
+	}
+
+	select {
+	case m.chAPISessionsList <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-m.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// apiSessionsGet is called by api.
+func (m *webRTCManager) apiSessionsGet(uuid uuid.UUID) (*apiWebRTCSession, error) {
+	req := webRTCManagerAPISessionsGetReq{
+		uuid: uuid,
+		res:  make(chan webRTCManagerAPISessionsGetRes),
+	}
+
+	select {
+	case m.chAPISessionsGet <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-m.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// apiSessionsKick is called by api.
+func (m *webRTCManager) apiSessionsKick(uuid uuid.UUID) error {
+	req := webRTCManagerAPISessionsKickReq{
+		uuid: uuid,
+		res:  make(chan webRTCManagerAPISessionsKickRes),
+	}
+
+	select {
+	case m.chAPIConnsKick <- req:
+		res := <-req.res
+		return res.err
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// apiSessionsMigrate is called by api.
+// The migration is performed by the session, outside of the main loop,
+// since it involves the source and destination paths.
+func (m *webRTCManager) apiSessionsMigrate(uuid uuid.UUID, pathName string) error {
+	req := webRTCManagerAPISessionsMigrateReq{
+		uuid:     uuid,
+		pathName: pathName,
+		res:      make(chan webRTCManagerAPISessionsMigrateRes),
+	}
+
+	select {
+	case m.chAPISessionsMigrate <- req:
+		res := <-req.res
+		if res.err != nil {
+			return res.err
 		}
-
-		return res1.sx.addCandidates(req)
+		return res.sx.migrate(pathName)
 
 	case <-m.ctx.Done():
-		return webRTCAddSessionCandidatesRes{err: fmt.Errorf("terminated")}
+		return fmt.Errorf("terminated")
 	}
 }
 
-// apiSessionsList is called by api.
-func (m *webRTCManager) apiSessionsList() (*apiWebRTCSessionsList, error) {
-	req := webRTCManagerAPISessionsListReq{
-		res: make(chan webRTCManagerAPISessionsListRes),
+// apiSessionsCapture is called by api.
+func (m *webRTCManager) apiSessionsCapture(
+	uuid uuid.UUID,
+	format string,
+	duration time.Duration,
+) (*apiWebRTCSessionCapture, error) {
+	req := webRTCManagerAPISessionsCaptureReq{
+		uuid:     uuid,
+		format:   format,
+		duration: duration,
+		res:      make(chan webRTCManagerAPISessionsCaptureRes),
 	}
 
 	select {
-	case m.chAPISessionsList <- req:
+	case m.chAPISessionsCapture <- req:
 		res := <-req.res
 		return res.data, res.err
 
@@ -787,15 +2045,14 @@ func (m *webRTCManager) apiSessionsList() (*apiWebRTCSessionsList, error) {
 	}
 }
 
-// apiSessionsGet is called by api.
-func (m *webRTCManager) apiSessionsGet(uuid uuid.UUID) (*apiWebRTCSession, error) {
-	req := webRTCManagerAPISessionsGetReq{
-		uuid: uuid,
-		res:  make(chan webRTCManagerAPISessionsGetRes),
+// apiRoomsList is called by api.
+func (m *webRTCManager) apiRoomsList() (*apiWebRTCRoomsList, error) {
+	req := webRTCManagerAPIRoomsListReq{
+		res: make(chan webRTCManagerAPIRoomsListRes),
 	}
 
 	select {
-	case m.chAPISessionsGet <- req:
+	case m.chAPIRoomsList <- req:
 		res := <-req.res
 		return res.data, res.err
 
@@ -804,21 +2061,52 @@ func (m *webRTCManager) apiSessionsGet(uuid uuid.UUID) (*apiWebRTCSession, error
 	}
 }
 
-// apiSessionsKick is called by api.
-func (m *webRTCManager) apiSessionsKick(uuid uuid.UUID) error {
-	req := webRTCManagerAPISessionsKickReq{
-		uuid: uuid,
-		res:  make(chan webRTCManagerAPISessionsKickRes),
+// drain stops accepting new sessions and rooms, waits for ongoing rooms to be
+// cleaned up or for the timeout to expire, then cleans up remaining rooms
+// and waits for their recordings to be uploaded.
+func (m *webRTCManager) drain(timeout time.Duration) {
+	select {
+	case m.chAPIDrain <- struct{}{}:
+	case <-m.ctx.Done():
+		return
 	}
 
-	select {
-	case m.chAPIConnsKick <- req:
-		res := <-req.res
-		return res.err
+	deadline := time.Now().Add(timeout)
 
-	case <-m.ctx.Done():
-		return fmt.Errorf("terminated")
+	t := time.NewTicker(webrtcDrainCheckPeriod)
+	defer t.Stop()
+
+	for {
+		rooms, err := m.apiRoomsList()
+		if err != nil {
+			return
+		}
+
+		if len(rooms.Items) == 0 {
+			break
+		}
+
+		if !time.Now().Before(deadline) {
+			m.Log(logger.Warn, "drain timeout expired, cleaning up %d rooms", len(rooms.Items))
+
+			for _, room := range rooms.Items {
+				err := m.apiRoomCleanup(room.ID)
+				if err != nil && err != errAPINotFound {
+					m.Log(logger.Warn, "unable to clean up room %v: %v", room.ID, err)
+				}
+			}
+			break
+		}
+
+		select {
+		case <-t.C:
+		case <-m.ctx.Done():
+			return
+		}
 	}
+
+	m.Log(logger.Info, "waiting for uploads")
+	m.uploads.Wait()
 }
 
 // apiRoomGet is called by api.
@@ -839,11 +2127,26 @@ func (m *webRTCManager) apiRoomGet(uuid uuid.UUID) (*apiWebRTCRoom, error) {
 }
 
 // apiRoomCreate is called by api.
-func (m *webRTCManager) apiRoomCreate(clubName, eventName string) (uuid.UUID, error) {
+func (m *webRTCManager) apiRoomCreate(
+	clubName string,
+	eventName string,
+	s3Conf *apiWebRTCRoomS3,
+	iceServers []conf.WebRTCICEServer,
+	restream *apiWebRTCRoomRestream,
+	program string,
+	schedule roomSchedule,
+	profile string,
+) (uuid.UUID, error) {
 	req := webRTCManagerAPIRoomsCreateReq{
-		clubName: clubName,
-		eventName: eventName,
-		res: make(chan webRTCManagerAPIRoomsCreateRes),
+		clubName:   clubName,
+		eventName:  eventName,
+		s3Conf:     s3Conf,
+		iceServers: iceServers,
+		restream:   restream,
+		program:    program,
+		schedule:   schedule,
+		profile:    profile,
+		res:        make(chan webRTCManagerAPIRoomsCreateRes),
 	}
 
 	select {
@@ -891,6 +2194,96 @@ func (m *webRTCManager) apiRoomRecord(id uuid.UUID) error {
 	}
 }
 
+// apiRoomRecordPause is called by api.
+func (m *webRTCManager) apiRoomRecordPause(id uuid.UUID, pause bool) error {
+	req := webRTCManagerAPIRoomsRecordPauseReq{
+		uuid:  id,
+		pause: pause,
+		res:   make(chan webRTCManagerAPIRoomsRecordPauseRes),
+	}
+
+	select {
+	case m.chAPIRoomsRecordPause <- req:
+		res := <-req.res
+		return res.err
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomProgram is called by api.
+func (m *webRTCManager) apiRoomProgram(id uuid.UUID, source string) error {
+	req := webRTCManagerAPIRoomsProgramReq{
+		uuid:   id,
+		source: source,
+		res:    make(chan webRTCManagerAPIRoomsProgramRes),
+	}
+
+	select {
+	case m.chAPIRoomsProgram <- req:
+		res := <-req.res
+		return res.err
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomMix is called by api.
+func (m *webRTCManager) apiRoomMix(id uuid.UUID, mix *apiWebRTCRoomMix) error {
+	req := webRTCManagerAPIRoomsMixReq{
+		uuid: id,
+		mix:  mix,
+		res:  make(chan webRTCManagerAPIRoomsMixRes),
+	}
+
+	select {
+	case m.chAPIRoomsMix <- req:
+		res := <-req.res
+		return res.err
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomGeo is called by api.
+func (m *webRTCManager) apiRoomGeo(id uuid.UUID, geo *apiWebRTCRoomGeo) error {
+	req := webRTCManagerAPIRoomsGeoReq{
+		uuid: id,
+		geo:  geo,
+		res:  make(chan webRTCManagerAPIRoomsGeoRes),
+	}
+
+	select {
+	case m.chAPIRoomsGeo <- req:
+		res := <-req.res
+		return res.err
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomMessage is called by api.
+func (m *webRTCManager) apiRoomMessage(id uuid.UUID, data string) error {
+	req := webRTCManagerAPIRoomsMessageReq{
+		uuid: id,
+		data: data,
+		res:  make(chan webRTCManagerAPIRoomsMessageRes),
+	}
+
+	select {
+	case m.chAPIRoomsMessage <- req:
+		res := <-req.res
+		return res.err
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
 // apiRoomCleanup is called by api.
 func (m *webRTCManager) apiRoomCleanup(id uuid.UUID) error {
 	req := webRTCManagerAPIRoomsCleanupReq{
@@ -908,31 +2301,327 @@ func (m *webRTCManager) apiRoomCleanup(id uuid.UUID) error {
 	}
 }
 
-func (m *webRTCManager) createRoom(clubName string, eventName string) (uuid.UUID, error) {
-	roomID := uuid.New()
-	sdkConfig, err := config.LoadDefaultConfig(context.TODO())
+// apiRoomKeysCreate is called by api.
+func (m *webRTCManager) apiRoomKeysCreate(id uuid.UUID, pathName string) (string, error) {
+	req := webRTCManagerAPIRoomsKeysCreateReq{
+		uuid:     id,
+		pathName: pathName,
+		res:      make(chan webRTCManagerAPIRoomsKeysCreateRes),
+	}
+
+	select {
+	case m.chAPIRoomsKeysCreate <- req:
+		res := <-req.res
+		return res.key, res.err
+
+	case <-m.ctx.Done():
+		return "", fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomKeysRevoke is called by api.
+func (m *webRTCManager) apiRoomKeysRevoke(id uuid.UUID, key string) error {
+	req := webRTCManagerAPIRoomsKeysRevokeReq{
+		uuid: id,
+		key:  key,
+		res:  make(chan webRTCManagerAPIRoomsKeysRevokeRes),
+	}
+
+	select {
+	case m.chAPIRoomsKeysRevoke <- req:
+		res := <-req.res
+		return res.err
+
+	case <-m.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomTokensCreate is called by api.
+func (m *webRTCManager) apiRoomTokensCreate(
+	id uuid.UUID,
+	pathName string,
+	participantID string,
+	duration time.Duration,
+) (string, time.Time, error) {
+	req := webRTCManagerAPIRoomsTokensCreateReq{
+		uuid:          id,
+		pathName:      pathName,
+		participantID: participantID,
+		duration:      duration,
+		res:           make(chan webRTCManagerAPIRoomsTokensCreateRes),
+	}
+
+	select {
+	case m.chAPIRoomsTokensCreate <- req:
+		res := <-req.res
+		return res.token, res.expiry, res.err
+
+	case <-m.ctx.Done():
+		return "", time.Time{}, fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomLogs is called by api.
+func (m *webRTCManager) apiRoomLogs(id uuid.UUID, minLevel logger.Level) (*apiWebRTCRoomLogs, error) {
+	req := webRTCManagerAPIRoomsLogsReq{
+		uuid:     id,
+		minLevel: minLevel,
+		res:      make(chan webRTCManagerAPIRoomsLogsRes),
+	}
+
+	select {
+	case m.chAPIRoomsLogs <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-m.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// apiRoomClone is called by api.
+func (m *webRTCManager) apiRoomClone(id uuid.UUID) (uuid.UUID, error) {
+	req := webRTCManagerAPIRoomsCloneReq{
+		uuid: id,
+		res:  make(chan webRTCManagerAPIRoomsCloneRes),
+	}
+
+	select {
+	case m.chAPIRoomsClone <- req:
+		res := <-req.res
+		return res.uuid, res.err
+
+	case <-m.ctx.Done():
+		return uuid.UUID{}, fmt.Errorf("terminated")
+	}
+}
+
+func (m *webRTCManager) createRoom(
+	roomID uuid.UUID,
+	clubName string,
+	eventName string,
+	s3Conf *apiWebRTCRoomS3,
+	iceServers []conf.WebRTCICEServer,
+	restream *apiWebRTCRoomRestream,
+	program string,
+	schedule roomSchedule,
+	profileName string,
+) (*Room, error) {
+	if m.draining {
+		return nil, errAPIDraining
+	}
+
+	err := recordkey.CheckName(clubName)
+	if err != nil {
+		return nil, errAPIBadRequest{fmt.Errorf("invalid club name: %v", err)}
+	}
+
+	err = recordkey.CheckName(eventName)
+	if err != nil {
+		return nil, errAPIBadRequest{fmt.Errorf("invalid event name: %v", err)}
+	}
+
+	for _, server := range iceServers {
+		err = server.Check()
+		if err != nil {
+			return nil, errAPIBadRequest{err}
+		}
+	}
+
+	err = checkRoomRestream(restream)
+	if err != nil {
+		return nil, errAPIBadRequest{err}
+	}
+
+	if program != "" {
+		err = conf.IsValidPathName(program)
+		if err != nil {
+			return nil, errAPIBadRequest{fmt.Errorf("invalid program path: %v", err)}
+		}
+	}
+
+	err = schedule.check(time.Now())
+	if err != nil {
+		return nil, errAPIBadRequest{err}
+	}
+
+	profile, err := m.roomProfile(profileName)
+	if err != nil {
+		return nil, errAPIBadRequest{err}
+	}
+
+	if iceServers == nil {
+		iceServers = profile.ICEServers
+	}
+
+	tenantName, tenant := m.tenantOfClub(clubName)
+
+	err = m.checkTenantRooms(tenantName, tenant)
+	if err != nil {
+		return nil, errAPIBadRequest{err}
+	}
+
+	m.confMutex.RLock()
+	recordConf, err := m.recordConf.withBucketRules(clubName).withProfile(profile).withTenant(tenant).
+		withS3Overrides(s3Conf)
+	m.confMutex.RUnlock()
+	if err != nil {
+		return nil, errAPIBadRequest{err}
+	}
+
+	if recordConf.bucket != "" {
+		err = conf.CheckS3BucketName(recordConf.bucket)
+		if err != nil {
+			return nil, errAPIBadRequest{err}
+		}
+	}
+
+	storage, err := newRecordStorage(m.ctx, recordConf)
 	if err != nil {
 		fmt.Println("Couldn't load default configuration. Have you set up your AWS account?")
 		fmt.Println(err)
-		return uuid.UUID{}, err
+		return nil, err
+	}
+
+	var rtspCreds *roomRTSPCredentials
+	if program != "" {
+		rtspCreds, err = newRoomRTSPCredentials()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	client := s3.NewFromConfig(sdkConfig)
 	room := &Room{
+		parent:           m,
 		uuid:             roomID,
+		recordDir:        recordkey.Dir(recordConf.path, clubName, eventName, roomID),
+		recordConf:       recordConf,
+		created:          time.Now(),
 		recording:        false,
-		clubName: clubName,
-		eventName: eventName,
+		clubName:         clubName,
+		eventName:        eventName,
+		tenant:           tenantName,
+		iceServers:       iceServers,
 		streamers:        map[string]*streamer{},
-		s3Client:         &s3Client{S3Client: client},
+		storage:          storage,
 		sessions:         make(map[*webRTCSession]struct{}),
 		sessionsBySecret: make(map[uuid.UUID]*webRTCSession),
+		publishKeys:      make(map[string]string),
+		accessTokens:     make(map[string]*roomAccessToken),
+		viewers:          newRoomViewers(webrtcRoomViewersMaxSamples),
+		analytics:        newRoomAnalytics(),
+		messages:         newRoomMessages(),
+		logs:             newRoomLogs(m.roomLogSize),
+		schedule:         schedule,
+		profile:          profileName,
+		codecs:           profile.Codecs,
+		maxParticipants:  profile.MaxParticipants,
+		e2ee:             profile.E2EE,
+		metadataFormat:   profile.MetadataFormat,
+		metadataValidate: profile.ValidateMetadata,
+		metadataExport:   profile.MetadataExport,
+		llhls:            profile.LLHLS,
+		uploads:          &m.uploads,
+	}
+	err = os.MkdirAll(room.dir(), os.ModePerm)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+
+	room.state, err = newRoomState(room,
+		roomEventLogFileName(room.dir(), roomID), roomChatFileName(room.dir(), roomID))
+	if err != nil {
+		return nil, err
+	}
+
+	room.events, err = newRoomEventLog(roomEventLogFileName(room.dir(), roomID))
+	if err != nil {
+		room.state.remove()
+		return nil, err
+	}
+
+	room.chat, err = newRoomChat(roomChatFileName(room.dir(), roomID), m.roomChatHistory)
+	if err != nil {
+		room.events.close()
+		room.state.remove()
+		return nil, err
+	}
+
+	if restream != nil {
+		for _, target := range restream.Targets {
+			room.restreamers = append(room.restreamers, newRoomRestreamer(
+				m.ctx,
+				target,
+				restream.Path,
+				m.readTimeout,
+				m.readBufferCount,
+				m.pathManager,
+				room,
+			))
+		}
 	}
+
+	if program != "" {
+		room.program = newRoomProgram(m.ctx, program, rtspCreds, m.pathManager, room)
+		m.enableLLHLS(room, program)
+	}
+
 	m.rooms[roomID] = room
-	roomDir := fmt.Sprintf("streams/%s/%s/", clubName, eventName)
-	err = os.MkdirAll(roomDir, os.ModePerm)
-	if err != nil && !errors.Is(err, os.ErrExist){
-		return uuid.UUID{}, err
+	return room, nil
+}
+
+// checkRoomID checks the room ID provided by a client.
+func checkRoomID(roomID string) error {
+	if roomID == "" {
+		return fmt.Errorf("room ID is missing")
+	}
+
+	_, err := uuid.Parse(roomID)
+	if err != nil {
+		return fmt.Errorf("invalid room ID: '%s'", roomID)
+	}
+
+	return nil
+}
+
+// findOrCreateSessionRoom returns the room of a new session.
+// When autoCreateRooms is enabled, publishing to an unknown room creates it,
+// with club and event names taken from the "club" and "event" query parameters.
+func (m *webRTCManager) findOrCreateSessionRoom(req webRTCNewSessionReq) (*Room, int, error) {
+	err := checkRoomID(req.roomID)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	roomID := uuid.MustParse(req.roomID)
+
+	room := m.findRoomByUUID(roomID)
+	if room != nil {
+		return room, 0, nil
+	}
+
+	query, err := url.ParseQuery(req.query)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
 	}
-	return roomID, nil
+
+	// publish keys belong to existing rooms
+	if !m.autoCreateRooms || !req.publish || query.Get("key") != "" {
+		return nil, http.StatusNotFound, fmt.Errorf("room doesn't exist")
+	}
+
+	room, err = m.createRoom(roomID, query.Get("club"), query.Get("event"), nil, nil, nil, "", roomSchedule{},
+		query.Get("profile"))
+	if err != nil {
+		var badRequest errAPIBadRequest
+		if errors.As(err, &badRequest) {
+			return nil, http.StatusBadRequest, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	room.Log(logger.Info, "created automatically by %s", req.remoteAddr)
+
+	return room, 0, nil
 }
@@ -3,7 +3,11 @@ package core
 import (
 	"bytes"
 	"context"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,10 +15,15 @@ import (
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
 	"github.com/bluenviron/gortsplib/v3/pkg/url"
+	"github.com/google/uuid"
+	"github.com/pion/ice/v2"
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/stretchr/testify/require"
 
+	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/webrtcpc"
 	"github.com/bluenviron/mediamtx/internal/whip"
@@ -43,10 +52,10 @@ func newWebRTCTestClient(
 
 	c := &webRTCTestClient{}
 
-	api, err := webrtcNewAPI(nil, nil, nil)
+	api, err := webrtcNewAPI(webrtcAPIConf{})
 	require.NoError(t, err)
 
-	pc, err := webrtcpc.New(iceServers, api, nilLogger{})
+	pc, err := webrtcpc.New(iceServers, nil, api, nilLogger{})
 	require.NoError(t, err)
 
 	var outgoingTrack1 *webrtc.TrackLocalStaticRTP
@@ -443,3 +452,1205 @@ func TestWebRTCPublish(t *testing.T) {
 		})
 	}
 }
+
+func TestWebRTCGatherOutgoingTracks(t *testing.T) {
+	vp8Format := &formats.VP8{PayloadTyp: 96}
+	h264Format := &formats.H264{PayloadTyp: 97, PacketizationMode: 1}
+	opusFormat := &formats.Opus{PayloadTyp: 111, IsStereo: true}
+	g722Format := &formats.G722{}
+
+	medias := media.Medias{
+		{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{vp8Format, h264Format},
+		},
+		{
+			Type:    media.TypeAudio,
+			Formats: []formats.Format{g722Format, opusFormat},
+		},
+	}
+
+	for _, ca := range []struct {
+		name    string
+		codecs  conf.WebRTCCodecs
+		mode    webrtcReadMode
+		formats []formats.Format
+	}{
+		{
+			"default priority",
+			nil,
+			webrtcReadModeAll,
+			[]formats.Format{vp8Format, opusFormat},
+		},
+		{
+			"forced video codec",
+			conf.WebRTCCodecs{"h264"},
+			webrtcReadModeAll,
+			[]formats.Format{h264Format},
+		},
+		{
+			"forced audio codec",
+			conf.WebRTCCodecs{"g722"},
+			webrtcReadModeAll,
+			[]formats.Format{g722Format},
+		},
+		{
+			"custom priority",
+			conf.WebRTCCodecs{"g722", "h264", "opus", "vp8"},
+			webrtcReadModeAll,
+			[]formats.Format{h264Format, g722Format},
+		},
+		{
+			"audio only",
+			nil,
+			webrtcReadModeAudio,
+			[]formats.Format{opusFormat},
+		},
+		{
+			"video only",
+			nil,
+			webrtcReadModeVideo,
+			[]formats.Format{vp8Format},
+		},
+		{
+			"audio only with custom priority",
+			conf.WebRTCCodecs{"h264", "g722"},
+			webrtcReadModeAudio,
+			[]formats.Format{g722Format},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			tracks, err := webrtcGatherOutgoingTracks(medias, ca.codecs, ca.mode)
+			require.NoError(t, err)
+
+			var gathered []formats.Format
+			for _, track := range tracks {
+				gathered = append(gathered, track.format)
+			}
+			require.Equal(t, ca.formats, gathered)
+		})
+	}
+
+	t.Run("no allowed codecs", func(t *testing.T) {
+		_, err := webrtcGatherOutgoingTracks(medias, conf.WebRTCCodecs{"av1", "g711"}, webrtcReadModeAll)
+		require.EqualError(t, err, "the stream doesn't contain any of the allowed codecs, which are av1, g711")
+	})
+}
+
+func TestWebRTCReadModeFromRequest(t *testing.T) {
+	offer := func(sections ...string) *webrtc.SessionDescription {
+		sdp := "v=0\r\n" +
+			"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+			"s=-\r\n" +
+			"t=0 0\r\n"
+		for _, s := range sections {
+			sdp += "m=" + s + " 9 UDP/TLS/RTP/SAVPF 96\r\n"
+		}
+		return &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}
+	}
+
+	for _, ca := range []struct {
+		name  string
+		query string
+		offer *webrtc.SessionDescription
+		mode  webrtcReadMode
+	}{
+		{"all", "", offer("video", "audio"), webrtcReadModeAll},
+		{"audio from query", "media=audio", offer("video", "audio"), webrtcReadModeAudio},
+		{"video from query", "media=video", offer("video", "audio"), webrtcReadModeVideo},
+		{"audio from offer", "", offer("audio"), webrtcReadModeAudio},
+		{"video from offer", "", offer("video"), webrtcReadModeVideo},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			mode, err := webrtcReadModeFromRequest(ca.query, ca.offer)
+			require.NoError(t, err)
+			require.Equal(t, ca.mode, mode)
+		})
+	}
+
+	_, err := webrtcReadModeFromRequest("media=video", offer("audio"))
+	require.EqualError(t, err, "video has been requested but the offer doesn't contain a video section")
+
+	_, err = webrtcReadModeFromRequest("media=other", offer("audio"))
+	require.EqualError(t, err, "invalid media: 'other'")
+}
+
+func TestWebRTCRenegotiationSections(t *testing.T) {
+	var desc sdp.SessionDescription
+	err := desc.Unmarshal([]byte("v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=video 0 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"a=mid:1\r\n" +
+		"a=sendonly\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:2\r\n" +
+		"a=inactive\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:3\r\n" +
+		"a=sendonly\r\n" +
+		"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+		"a=mid:4\r\n"))
+	require.NoError(t, err)
+
+	// disabled sections do not count against the single video track limit
+	trackCount, err := webrtcTrackCount(desc.MediaDescriptions)
+	require.NoError(t, err)
+	require.Equal(t, 2, trackCount)
+
+	require.Equal(t, map[string]struct{}{
+		"1": {},
+		"3": {},
+	}, webrtcActiveMids(desc.MediaDescriptions))
+}
+
+func TestWebRTCOpusFmtp(t *testing.T) {
+	for _, ca := range []struct {
+		name              string
+		inbandFEC         bool
+		dtx               bool
+		maxAverageBitrate int
+		fmtp              string
+	}{
+		{
+			"default",
+			true,
+			false,
+			0,
+			"minptime=10;useinbandfec=1",
+		},
+		{
+			"no fec",
+			false,
+			false,
+			0,
+			"minptime=10",
+		},
+		{
+			"all",
+			true,
+			true,
+			64000,
+			"minptime=10;useinbandfec=1;usedtx=1;maxaveragebitrate=64000",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.fmtp, webrtcOpusFmtp(ca.inbandFEC, ca.dtx, ca.maxAverageBitrate))
+		})
+	}
+}
+
+func TestWebRTCSetCodecPreferences(t *testing.T) {
+	opusFmtp := webrtcOpusFmtp(false, true, 0)
+
+	api, err := webrtcNewAPI(webrtcAPIConf{opusFmtp: opusFmtp})
+	require.NoError(t, err)
+
+	pc, err := webrtcpc.New(nil, nil, api, nilLogger{})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	tracks, err := webrtcGatherOutgoingTracks(media.Medias{{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{&formats.Opus{PayloadTyp: 111, IsStereo: true}},
+	}}, conf.WebRTCCodecs{"opus"}, webrtcReadModeAll)
+	require.NoError(t, err)
+
+	tracks[0].sender, err = pc.AddTrack(tracks[0].track)
+	require.NoError(t, err)
+
+	err = webrtcSetCodecPreferences(pc, tracks, opusFmtp, false)
+	require.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+
+	require.Contains(t, offer.SDP, "a=fmtp:111 minptime=10;usedtx=1\r\n")
+	require.NotContains(t, offer.SDP, "useinbandfec")
+	require.NotContains(t, offer.SDP, "G722")
+
+	// the static list of codecs must not be modified
+	require.Equal(t, "minptime=10;useinbandfec=1", audioCodecs[0].SDPFmtpLine)
+}
+
+func TestWebRTCUDPPortRange(t *testing.T) {
+	api, err := webrtcNewAPI(webrtcAPIConf{
+		iceUDPPortMin: 41000,
+		iceUDPPortMax: 41010,
+	})
+	require.NoError(t, err)
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close() //nolint:errcheck
+
+	_, err = pc.CreateDataChannel("test", nil)
+	require.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+
+	<-gatherComplete
+
+	var desc sdp.SessionDescription
+	err = desc.Unmarshal([]byte(pc.LocalDescription().SDP))
+	require.NoError(t, err)
+
+	for _, m := range desc.MediaDescriptions {
+		for _, attr := range m.Attributes {
+			if attr.Key != "candidate" {
+				continue
+			}
+
+			cnd, err := ice.UnmarshalCandidate(attr.Value)
+			require.NoError(t, err)
+
+			if cnd.NetworkType().IsUDP() && cnd.Type() == ice.CandidateTypeHost {
+				require.GreaterOrEqual(t, cnd.Port(), 41000)
+				require.LessOrEqual(t, cnd.Port(), 41010)
+			}
+		}
+	}
+}
+
+func TestWebRTCICEHostOnly(t *testing.T) {
+	var hostIP string
+
+	addrs, err := net.InterfaceAddrs()
+	require.NoError(t, err)
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			hostIP = ipnet.IP.String()
+			break
+		}
+	}
+	if hostIP == "" {
+		t.Skip("no IPv4 interfaces available")
+	}
+
+	api, err := webrtcNewAPI(webrtcAPIConf{
+		iceHostOnly: true,
+		iceHostIPs:  []string{hostIP},
+	})
+	require.NoError(t, err)
+
+	m := &webRTCManager{
+		iceHostOnly: true,
+		iceServers:  []conf.WebRTCICEServer{{URL: "stun:127.0.0.1:3478"}},
+	}
+
+	iceServers, err := m.generateICEServers(nil)
+	require.NoError(t, err)
+	require.Empty(t, iceServers)
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{ICEServers: iceServers})
+	require.NoError(t, err)
+	defer pc.Close() //nolint:errcheck
+
+	_, err = pc.CreateDataChannel("test", nil)
+	require.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+
+	<-gatherComplete
+
+	var desc sdp.SessionDescription
+	err = desc.Unmarshal([]byte(pc.LocalDescription().SDP))
+	require.NoError(t, err)
+
+	n := 0
+
+	for _, m := range desc.MediaDescriptions {
+		for _, attr := range m.Attributes {
+			if attr.Key != "candidate" {
+				continue
+			}
+
+			cnd, err := ice.UnmarshalCandidate(attr.Value)
+			require.NoError(t, err)
+
+			require.Equal(t, ice.CandidateTypeHost, cnd.Type())
+			require.Equal(t, hostIP, cnd.Address())
+			n++
+		}
+	}
+
+	require.NotZero(t, n)
+}
+
+func TestWebRTCNACKBufferSize(t *testing.T) {
+	for _, ca := range []string{"enabled", "disabled"} {
+		t.Run(ca, func(t *testing.T) {
+			size := uint16(1024)
+			if ca == "disabled" {
+				size = 0
+			}
+
+			serverAPI, err := webrtcNewAPI(webrtcAPIConf{nackBufferSize: size})
+			require.NoError(t, err)
+
+			server, err := serverAPI.NewPeerConnection(webrtc.Configuration{})
+			require.NoError(t, err)
+			defer server.Close() //nolint:errcheck
+
+			track, err := webrtc.NewTrackLocalStaticRTP(videoCodecs[len(videoCodecs)-1].RTPCodecCapability,
+				"video", "stream")
+			require.NoError(t, err)
+
+			sender, err := server.AddTrack(track)
+			require.NoError(t, err)
+
+			go func() {
+				for {
+					_, _, err := sender.ReadRTCP()
+					if err != nil {
+						return
+					}
+				}
+			}()
+
+			clientAPI, err := webrtcNewAPI(webrtcAPIConf{})
+			require.NoError(t, err)
+
+			client, err := clientAPI.NewPeerConnection(webrtc.Configuration{})
+			require.NoError(t, err)
+			defer client.Close() //nolint:errcheck
+
+			recv := make(chan uint16, 100)
+
+			client.OnTrack(func(tr *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+				for {
+					pkt, _, err := tr.ReadRTP()
+					if err != nil {
+						return
+					}
+					recv <- pkt.SequenceNumber
+				}
+			})
+
+			offer, err := server.CreateOffer(nil)
+			require.NoError(t, err)
+
+			gatherComplete := webrtc.GatheringCompletePromise(server)
+			err = server.SetLocalDescription(offer)
+			require.NoError(t, err)
+			<-gatherComplete
+
+			err = client.SetRemoteDescription(*server.LocalDescription())
+			require.NoError(t, err)
+
+			answer, err := client.CreateAnswer(nil)
+			require.NoError(t, err)
+
+			gatherComplete = webrtc.GatheringCompletePromise(client)
+			err = client.SetLocalDescription(answer)
+			require.NoError(t, err)
+			<-gatherComplete
+
+			err = server.SetRemoteDescription(*client.LocalDescription())
+			require.NoError(t, err)
+
+			var ssrc uint32
+
+			// send packets until the first one is received
+			for seq := uint16(1); ; seq++ {
+				require.Less(t, seq, uint16(200))
+
+				err = track.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 3000,
+						Marker:         true,
+					},
+					Payload: []byte{0x05, 0x01},
+				})
+				require.NoError(t, err)
+
+				select {
+				case <-recv:
+					ssrc = uint32(sender.GetParameters().Encodings[0].SSRC)
+				case <-time.After(50 * time.Millisecond):
+					continue
+				}
+				break
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			for len(recv) > 0 {
+				<-recv
+			}
+
+			// request packet 1 again
+			err = client.WriteRTCP([]rtcp.Packet{&rtcp.TransportLayerNack{
+				MediaSSRC: ssrc,
+				Nacks:     []rtcp.NackPair{{PacketID: 1}},
+			}})
+			require.NoError(t, err)
+
+			select {
+			case seq := <-recv:
+				require.Equal(t, "enabled", ca)
+				require.Equal(t, uint16(1), seq)
+			case <-time.After(500 * time.Millisecond):
+				require.Equal(t, "disabled", ca)
+			}
+		})
+	}
+}
+
+func newTestWebRTCPathFeedback(stats ...*webRTCReaderStats) *webRTCPathFeedback {
+	f := newWebRTCPathFeedback()
+	for _, st := range stats {
+		f.readers[&webRTCSession{}] = st
+	}
+	return f
+}
+
+func TestWebRTCPathFeedbackMedian(t *testing.T) {
+	now := time.Now()
+
+	for _, ca := range []struct {
+		name    string
+		stats   []*webRTCReaderStats
+		loss    float64
+		rtt     time.Duration
+		bitrate float64
+		ok      bool
+	}{
+		{
+			"no readers",
+			nil,
+			0,
+			0,
+			0,
+			false,
+		},
+		{
+			"stale readers",
+			[]*webRTCReaderStats{
+				{fractionLost: 0.5, updated: now.Add(-webrtcFeedbackMaxAge - time.Second)},
+			},
+			0,
+			0,
+			0,
+			false,
+		},
+		{
+			"median",
+			[]*webRTCReaderStats{
+				{fractionLost: 0.5, rtt: 300 * time.Millisecond, updated: now},
+				{fractionLost: 0.1, rtt: 100 * time.Millisecond, bitrate: 500000, updated: now},
+				{fractionLost: 0.2, rtt: 200 * time.Millisecond, bitrate: 300000, updated: now},
+				{fractionLost: 0.9, rtt: 900 * time.Millisecond, updated: now.Add(-webrtcFeedbackMaxAge - time.Second)},
+			},
+			0.2,
+			200 * time.Millisecond,
+			500000,
+			true,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			loss, rtt, bitrate, ok := newTestWebRTCPathFeedback(ca.stats...).median()
+			require.Equal(t, ca.ok, ok)
+			require.Equal(t, ca.loss, loss)
+			require.Equal(t, ca.rtt, rtt)
+			require.Equal(t, ca.bitrate, bitrate)
+		})
+	}
+}
+
+func TestWebRTCBitrateControllerUpdate(t *testing.T) {
+	for _, ca := range []struct {
+		name            string
+		stats           []*webRTCReaderStats
+		prevTarget      float64
+		incomingBitrate float64
+		target          float64
+	}{
+		{
+			"no readers",
+			nil,
+			500000,
+			1000000,
+			0,
+		},
+		{
+			"no incoming data",
+			[]*webRTCReaderStats{{fractionLost: 0.5}},
+			0,
+			0,
+			0,
+		},
+		{
+			"high loss",
+			[]*webRTCReaderStats{{fractionLost: 0.2}},
+			0,
+			1000000,
+			900000,
+		},
+		{
+			"high rtt",
+			[]*webRTCReaderStats{{fractionLost: 0.05, rtt: 2 * time.Second}},
+			0,
+			1000000,
+			850000,
+		},
+		{
+			"low loss without limit",
+			[]*webRTCReaderStats{{fractionLost: 0.01}},
+			0,
+			1000000,
+			0,
+		},
+		{
+			"low loss with limit",
+			[]*webRTCReaderStats{{fractionLost: 0.01}},
+			500000,
+			1000000,
+			540000,
+		},
+		{
+			"limit released",
+			[]*webRTCReaderStats{{fractionLost: 0}},
+			1450000,
+			1000000,
+			0,
+		},
+		{
+			"reader estimate",
+			[]*webRTCReaderStats{{fractionLost: 0, bitrate: 300000}},
+			0,
+			1000000,
+			300000,
+		},
+		{
+			"minimum bitrate",
+			[]*webRTCReaderStats{{fractionLost: 0.9}},
+			0,
+			150000,
+			webrtcFeedbackMinBitrate,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			for _, st := range ca.stats {
+				st.updated = time.Now()
+			}
+
+			c := &webRTCBitrateController{
+				feedback: newTestWebRTCPathFeedback(ca.stats...),
+				target:   ca.prevTarget,
+			}
+			require.InDelta(t, ca.target, c.update(ca.incomingBitrate), 0.001)
+		})
+	}
+}
+
+func TestWebRTCBitrateControllerMaxBitrate(t *testing.T) {
+	// publisher is limited even when there are no readers
+	c := &webRTCBitrateController{
+		feedback:   newTestWebRTCPathFeedback(),
+		maxBitrate: 800000,
+	}
+	require.Equal(t, float64(800000), c.update(1000000))
+
+	// lower targets computed from readers are kept
+	c = &webRTCBitrateController{
+		feedback:   newTestWebRTCPathFeedback(&webRTCReaderStats{fractionLost: 0.2, updated: time.Now()}),
+		maxBitrate: 950000,
+	}
+	require.InDelta(t, 900000, c.update(1000000), 0.001)
+
+	// limits requested by readers are taken into account
+	c = &webRTCBitrateController{
+		feedback: newTestWebRTCPathFeedback(&webRTCReaderStats{
+			bitrate:    700000,
+			maxBitrate: 400000,
+			updated:    time.Now(),
+		}),
+	}
+	require.InDelta(t, 400000, c.update(1000000), 0.001)
+}
+
+func TestWebRTCMaxVideoBitrate(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		global   int
+		path     int
+		query    string
+		expected int
+	}{
+		{"none", 0, 0, "", 0},
+		{"global", 1000000, 0, "", 1000000},
+		{"path", 1000000, 500000, "", 500000},
+		{"query", 0, 0, "maxVideoBitrate=300000", 300000},
+		{"query lower than path", 1000000, 500000, "maxVideoBitrate=300000", 300000},
+		{"query higher than path", 1000000, 500000, "maxVideoBitrate=3000000", 500000},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			v, err := webrtcMaxVideoBitrate(ca.global, &conf.PathConf{WebRTCMaxVideoBitrate: ca.path}, ca.query)
+			require.NoError(t, err)
+			require.Equal(t, ca.expected, v)
+		})
+	}
+
+	_, err := webrtcMaxVideoBitrate(0, &conf.PathConf{}, "maxVideoBitrate=abc")
+	require.EqualError(t, err, "invalid maxVideoBitrate: 'abc'")
+}
+
+func TestWebRTCSessionAPITracks(t *testing.T) {
+	outgoing, err := newWebRTCOutgoingTrackAudio(media.Medias{{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{&formats.Opus{PayloadTyp: 111, IsStereo: true}},
+	}}, "")
+	require.NoError(t, err)
+
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:     2,
+			PayloadType: 111,
+		},
+		Payload: []byte{1, 2, 3, 4},
+	}
+
+	for i := 0; i < 2; i++ {
+		err = outgoing.track.WriteRTP(pkt)
+		require.NoError(t, err)
+	}
+
+	bytesReceived := uint64(1000)
+	lastPacket := time.Now().UnixNano()
+	active := true
+
+	sx := &webRTCSession{
+		req: webRTCNewSessionReq{pathName: "mypath"},
+		incoming: []*webRTCIncomingTrack{{
+			bytesReceived: &bytesReceived,
+			lastPacket:    &lastPacket,
+			mediaType:     media.TypeVideo,
+			format:        &formats.H264{PayloadTyp: 96, PacketizationMode: 1},
+		}},
+		outgoing: []*webRTCOutgoingTrack{outgoing},
+	}
+
+	require.Equal(t, []*apiWebRTCSessionTrack{
+		{
+			Type:          "video",
+			Codec:         "h264",
+			BytesReceived: 1000,
+			Active:        &active,
+		},
+		{
+			Type:      "audio",
+			Codec:     "opus",
+			BytesSent: uint64(2 * pkt.MarshalSize()),
+		},
+	}, sx.apiItem().Tracks)
+}
+
+func TestWebRTCIncomingTrackMuteDetector(t *testing.T) {
+	lastPacket := time.Now().Add(-webrtcTrackMuteTimeout).UnixNano()
+	track := &webRTCIncomingTrack{lastPacket: &lastPacket}
+	require.False(t, track.active())
+
+	changes := make(chan bool)
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+
+	go track.runMuteDetector(ctx, func(active bool) {
+		changes <- active
+	})
+
+	require.Equal(t, false, <-changes)
+
+	atomic.StoreInt64(&lastPacket, time.Now().UnixNano())
+	require.Equal(t, true, <-changes)
+}
+
+func TestWebRTCIncomingTrackAudioLevel(t *testing.T) {
+	now := time.Now()
+	lastPacket := now.UnixNano()
+	lastSound := now.Add(-webrtcTrackMuteTimeout).UnixNano()
+	track := &webRTCIncomingTrack{
+		lastPacket:    &lastPacket,
+		lastSound:     &lastSound,
+		audioLevelExt: 1,
+		mediaType:     media.TypeAudio,
+	}
+
+	newPacket := func(level byte) *rtp.Packet {
+		pkt := &rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{1}}
+		err := pkt.SetExtension(1, []byte{0x80 | level})
+		require.NoError(t, err)
+		return pkt
+	}
+
+	// packets that contain only silence don't unmute the track
+	track.onAudioLevel(newPacket(webrtcAudioLevelSilence), now)
+	require.False(t, track.active())
+
+	track.onAudioLevel(newPacket(40), now)
+	require.True(t, track.active())
+}
+
+func TestWebRTCInactiveTrack(t *testing.T) {
+	recent := time.Now().UnixNano()
+	old := time.Now().Add(-10 * time.Second).UnixNano()
+
+	audio := &webRTCIncomingTrack{lastPacket: &recent, mediaType: media.TypeAudio}
+	video := &webRTCIncomingTrack{lastPacket: &old, mediaType: media.TypeVideo}
+
+	require.Nil(t, webrtcInactiveTrack([]*webRTCIncomingTrack{audio}, 5*time.Second))
+	require.Equal(t, video, webrtcInactiveTrack([]*webRTCIncomingTrack{audio, video}, 5*time.Second))
+	require.Nil(t, webrtcInactiveTrack([]*webRTCIncomingTrack{audio, video}, 20*time.Second))
+
+	require.Equal(t, 500*time.Millisecond, webrtcInactivityCheckPeriod(2*time.Second))
+	require.Equal(t, time.Second, webrtcInactivityCheckPeriod(30*time.Second))
+}
+
+func TestWebRTCFindOrCreateSessionRoom(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-autocreate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%club", "%event", "%room")},
+	}
+
+	roomID := uuid.New()
+
+	_, status, err := m.findOrCreateSessionRoom(webRTCNewSessionReq{roomID: "invalid", publish: true})
+	require.EqualError(t, err, "invalid room ID: 'invalid'")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	_, status, err = m.findOrCreateSessionRoom(webRTCNewSessionReq{roomID: roomID.String(), publish: true})
+	require.EqualError(t, err, "room doesn't exist")
+	require.Equal(t, http.StatusNotFound, status)
+
+	m.autoCreateRooms = true
+
+	// readers can't create rooms
+	_, status, err = m.findOrCreateSessionRoom(webRTCNewSessionReq{roomID: roomID.String()})
+	require.EqualError(t, err, "room doesn't exist")
+	require.Equal(t, http.StatusNotFound, status)
+
+	_, status, err = m.findOrCreateSessionRoom(webRTCNewSessionReq{
+		roomID:  roomID.String(),
+		query:   "club=myclub",
+		publish: true,
+	})
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	room, _, err := m.findOrCreateSessionRoom(webRTCNewSessionReq{
+		roomID:  roomID.String(),
+		query:   "club=myclub&event=myevent",
+		publish: true,
+	})
+	require.NoError(t, err)
+	defer room.events.close()
+	require.Equal(t, roomID, room.uuid)
+	require.Equal(t, "myclub", room.clubName)
+	require.Equal(t, "myevent", room.eventName)
+
+	room2, _, err := m.findOrCreateSessionRoom(webRTCNewSessionReq{roomID: roomID.String()})
+	require.NoError(t, err)
+	require.Equal(t, room, room2)
+}
+
+func TestWebRTCCheckRoomID(t *testing.T) {
+	require.EqualError(t, checkRoomID(""), "room ID is missing")
+	require.EqualError(t, checkRoomID("invalid"), "invalid room ID: 'invalid'")
+	require.NoError(t, checkRoomID(uuid.New().String()))
+}
+
+func TestWebRTCRoomICEServers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-ice")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%room")},
+		iceServers: []conf.WebRTCICEServer{{URL: "stun:stun.example.com:3478"}},
+	}
+
+	_, err = m.createRoom(uuid.New(), "myclub", "myevent", nil,
+		[]conf.WebRTCICEServer{{URL: "http://invalid"}}, nil, "", roomSchedule{}, "")
+	require.EqualError(t, err, "invalid ICE server: 'http://invalid'")
+
+	room, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, []conf.WebRTCICEServer{{
+		URL:      "turn:turn.example.com:3478",
+		Username: "myuser",
+		Password: "mypass",
+	}}, nil, "", roomSchedule{}, "")
+	require.NoError(t, err)
+	defer room.events.close()
+
+	servers, err := m.generateICEServers(room.iceServers)
+	require.NoError(t, err)
+	require.Equal(t, []webrtc.ICEServer{{
+		URLs:       []string{"turn:turn.example.com:3478"},
+		Username:   "myuser",
+		Credential: "mypass",
+	}}, servers)
+
+	servers, err = m.generateICEServers(nil)
+	require.NoError(t, err)
+	require.Equal(t, []webrtc.ICEServer{{URLs: []string{"stun:stun.example.com:3478"}, Credential: ""}}, servers)
+}
+
+func TestWebRTCRoomSchedule(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-schedule")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%room")},
+	}
+
+	now := time.Now()
+	start := now.Add(time.Hour)
+	end := now.Add(2 * time.Hour)
+	past := now.Add(-time.Hour)
+
+	_, err = m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", newRoomSchedule(&end, &start), "")
+	require.EqualError(t, err, "end time must be after start time")
+
+	_, err = m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", newRoomSchedule(nil, &past), "")
+	require.EqualError(t, err, "end time is in the past")
+
+	room, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", newRoomSchedule(&start, &end), "")
+	require.NoError(t, err)
+
+	require.EqualError(t, room.schedule.checkOpen(now), "room opens at "+start.Format(time.RFC3339))
+	require.NoError(t, room.schedule.checkOpen(start))
+	require.EqualError(t, room.schedule.checkOpen(end), "room is closed")
+
+	require.Equal(t, &start, room.apiItem().StartTime)
+	require.Equal(t, &end, room.apiItem().EndTime)
+
+	m.checkSchedules(now)
+	require.Len(t, m.rooms, 1)
+
+	// the room is cleaned up at end time
+	m.checkSchedules(end)
+	require.Len(t, m.rooms, 0)
+}
+
+func TestWebRTCRoomProfile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-profile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%room"), bucket: "default-bucket"},
+		roomProfiles: conf.WebRTCRoomProfiles{
+			"webinar": {
+				Codecs:          conf.WebRTCCodecs{"h264", "opus"},
+				MaxParticipants: 1,
+				Bucket:          "webinar-bucket",
+				ICEServers:      []conf.WebRTCICEServer{{URL: "stun:webinar.example.com:3478"}},
+			},
+		},
+	}
+
+	_, err = m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "missing")
+	require.EqualError(t, err, "room profile 'missing' doesn't exist")
+
+	room, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "webinar")
+	require.NoError(t, err)
+	defer room.events.close()
+
+	require.Equal(t, "webinar", room.apiItem().Profile)
+	require.Equal(t, "webinar-bucket", room.recordConf.bucket)
+	require.Equal(t, []conf.WebRTCICEServer{{URL: "stun:webinar.example.com:3478"}}, room.iceServers)
+
+	require.NoError(t, room.checkCodecs([]*webRTCIncomingTrack{{format: &formats.H264{}}}))
+	require.EqualError(t, room.checkCodecs([]*webRTCIncomingTrack{{format: &formats.VP8{}}}),
+		"codec 'vp8' is not allowed in the room, allowed codecs are h264, opus")
+
+	require.NoError(t, room.checkParticipants(nil))
+	sx := &webRTCSession{}
+	room.sessions[sx] = struct{}{}
+	require.EqualError(t, room.checkParticipants(nil), "room is full")
+	require.NoError(t, room.checkParticipants(sx))
+}
+
+func TestWebRTCRoomProfileE2EE(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-e2ee")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%room")},
+		roomProfiles: conf.WebRTCRoomProfiles{
+			"private": {
+				E2EE: true,
+			},
+		},
+	}
+
+	room, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "private")
+	require.NoError(t, err)
+	defer room.events.close()
+
+	require.NoError(t, room.checkCodecs([]*webRTCIncomingTrack{{format: &formats.VP8{}}, {format: &formats.Opus{}}}))
+	require.EqualError(t, room.checkCodecs([]*webRTCIncomingTrack{{format: &formats.H264{}}}),
+		"codec 'h264' can't be used with end-to-end encryption, allowed codecs are vp8, vp9, opus, g722, g711")
+
+	require.False(t, room.recordsTrack(roomManifestFileTypeAudio))
+	require.False(t, room.recordsTrack(roomManifestFileTypeVideo))
+	require.True(t, room.recordsTrack(roomManifestFileTypeMetadata))
+}
+
+func TestWebRTCManagerDraining(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-drain")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%room")},
+	}
+
+	room, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "")
+	require.NoError(t, err)
+	defer room.events.close()
+
+	// background uploads of rooms are waited by the manager
+	release := make(chan struct{})
+	room.inBackground(func() {
+		<-release
+	})
+
+	waited := make(chan struct{})
+	go func() {
+		m.uploads.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("uploads were not waited")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-waited
+
+	m.draining = true
+
+	_, err = m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "")
+	require.Equal(t, errAPIDraining, err)
+}
+
+func TestWebRTCManagerCloneRoom(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-clone")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%room")},
+	}
+
+	src, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, []conf.WebRTCICEServer{{
+		URL: "stun:stun.example.com:3478",
+	}}, nil, "", roomSchedule{}, "")
+	require.NoError(t, err)
+	defer src.events.close()
+
+	key, err := src.mintPublishKey("venue/cam1")
+	require.NoError(t, err)
+
+	room, err := m.cloneRoom(src)
+	require.NoError(t, err)
+	defer room.events.close()
+
+	require.NotEqual(t, src.uuid, room.uuid)
+	require.Equal(t, src.iceServers, room.iceServers)
+	require.Equal(t, &src.uuid, room.apiItem().RehearsalOf)
+
+	// participants use the same credentials
+	req := webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "key=" + key,
+		publish:  true,
+	}
+	ok, err := m.publishKeysRoom(room).authenticatePublishKey(req)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = room.mintPublishKey("venue/cam1")
+	require.Error(t, err)
+
+	// keys revoked in the original room are refused
+	err = src.revokePublishKey(key)
+	require.NoError(t, err)
+
+	_, err = m.publishKeysRoom(room).authenticatePublishKey(req)
+	require.EqualError(t, err, "invalid publish key")
+
+	// keys stop working when the original room is closed
+	key, err = src.mintPublishKey("venue/cam1")
+	require.NoError(t, err)
+	req.query = "key=" + key
+
+	delete(m.rooms, src.uuid)
+
+	_, err = m.publishKeysRoom(room).authenticatePublishKey(req)
+	require.EqualError(t, err, "invalid publish key")
+
+	// artifacts are not generated
+	require.Equal(t, errRoomRehearsal, room.record())
+	require.False(t, room.recordsTrack(roomManifestFileTypeMetadata))
+
+	_, err = m.cloneRoom(room)
+	require.Error(t, err)
+}
+
+func TestWebRTCSessionResource(t *testing.T) {
+	id := uuid.New()
+
+	pa, sessionID := webrtcSessionResource("mypath/whip/" + id.String())
+	require.Equal(t, "mypath/whip", pa)
+	require.Equal(t, id, sessionID)
+
+	pa, sessionID = webrtcSessionResource("my/path/whep/" + id.String())
+	require.Equal(t, "my/path/whep", pa)
+	require.Equal(t, id, sessionID)
+
+	pa, sessionID = webrtcSessionResource("mypath/whip")
+	require.Equal(t, "mypath/whip", pa)
+	require.Equal(t, uuid.Nil, sessionID)
+
+	pa, sessionID = webrtcSessionResource("mypath/" + id.String())
+	require.Equal(t, "mypath/"+id.String(), pa)
+	require.Equal(t, uuid.Nil, sessionID)
+}
+
+func TestWebRTCSessionETag(t *testing.T) {
+	secret := uuid.New()
+
+	for _, v := range []string{
+		webrtcSessionETag(secret),
+		"W/" + webrtcSessionETag(secret),
+		secret.String(),
+	} {
+		parsed, err := webrtcParseIfMatch(v)
+		require.NoError(t, err)
+		require.Equal(t, secret, parsed)
+	}
+
+	_, err := webrtcParseIfMatch("*")
+	require.Error(t, err)
+
+	sx := &webRTCSession{uuid: uuid.New(), secret: secret}
+	m := &webRTCManager{
+		sessions: map[*webRTCSession]struct{}{sx: {}},
+	}
+
+	found, err := m.findSessionResource(sx.uuid, secret)
+	require.NoError(t, err)
+	require.Equal(t, sx, found)
+
+	// the session has been replaced by a resumed one
+	_, err = m.findSessionResource(sx.uuid, uuid.New())
+	require.Equal(t, errWebRTCPreconditionFailed, err)
+
+	_, err = m.findSessionResource(uuid.New(), secret)
+	require.Equal(t, errWebRTCSessionNotFound, err)
+}
+
+func TestWebRTCManagerSessionMigrated(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-session-migrate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:          context.Background(),
+		parent:       nilLogger{},
+		rooms:        make(map[uuid.UUID]*Room),
+		recordConf:   roomRecordConf{path: filepath.Join(dir, "%room")},
+		resumeStates: make(map[string]*webRTCResumeState),
+	}
+
+	room, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "")
+	require.NoError(t, err)
+	defer room.events.close()
+
+	sx := &webRTCSession{
+		ctx:      context.Background(),
+		uuid:     uuid.New(),
+		roomid:   room.uuid,
+		pathName: "court-2",
+		req: webRTCNewSessionReq{
+			pathName: "court-2",
+			roomID:   room.uuid.String(),
+			publish:  true,
+		},
+	}
+	room.streamers["court-2"] = &streamer{id: "court-2", session: sx}
+
+	err = sx.migrate("court-2")
+	require.EqualError(t, err, "session is already publishing to path 'court-2'")
+
+	err = sx.migrate("/court-1")
+	require.Error(t, err)
+
+	token := m.addResumeState(sx)
+
+	sx.setPathName("court-1")
+	m.onSessionMigrated(webRTCManagerSessionMigratedReq{
+		sx:       sx,
+		prevPath: "court-2",
+		newPath:  "court-1",
+	})
+
+	require.Equal(t, []string{"court-1"}, room.apiItem().Paths)
+	require.Equal(t, "court-1", sx.apiItem().Path)
+
+	// resumed sessions publish to the new path
+	st, err := m.findResumeState(webRTCNewSessionReq{
+		pathName:    "court-2",
+		roomID:      room.uuid.String(),
+		publish:     true,
+		resumeToken: token,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "court-1", st.migratedPathName)
+}
@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
@@ -10,27 +12,131 @@ import (
 	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpvp8"
 	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpvp9"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
-	"github.com/bluenviron/gortsplib/v3/pkg/ringbuffer"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v3"
 
 	"github.com/bluenviron/mediamtx/internal/formatprocessor"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
+// webRTCCountedTrack is a TrackLocalStaticRTP that counts sent bytes
+// and packets requested again by the reader.
+// When fecOverhead is not zero and the reader supports it, FEC is added to video.
+type webRTCCountedTrack struct {
+	*webrtc.TrackLocalStaticRTP
+	bytesSent     *uint64
+	nacksReceived *uint64
+	fecOverhead   int
+	capture       func(*rtp.Packet, bool)
+
+	fecMutex sync.Mutex
+	fecID    string
+	fec      *webrtcFECWriter
+}
+
+func newWebRTCCountedTrack(
+	c webrtc.RTPCodecCapability,
+	id string,
+	streamID string,
+) (*webRTCCountedTrack, error) {
+	track, err := webrtc.NewTrackLocalStaticRTP(c, id, streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webRTCCountedTrack{
+		TrackLocalStaticRTP: track,
+		bytesSent:           new(uint64),
+		nacksReceived:       new(uint64),
+	}, nil
+}
+
+// Bind implements webrtc.TrackLocal.
+func (t *webRTCCountedTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, err := t.TrackLocalStaticRTP.Bind(ctx)
+	if err != nil {
+		return codec, err
+	}
+
+	if t.fecOverhead != 0 && t.Kind() == webrtc.RTPCodecTypeVideo {
+		fec, err := newWebRTCFECWriter(ctx, uint8(codec.PayloadType), t.fecOverhead)
+		if err != nil {
+			return webrtc.RTPCodecParameters{}, err
+		}
+
+		if fec != nil {
+			t.fecMutex.Lock()
+			t.fecID = ctx.ID()
+			t.fec = fec
+			t.fecMutex.Unlock()
+		}
+	}
+
+	return codec, nil
+}
+
+// Unbind implements webrtc.TrackLocal.
+func (t *webRTCCountedTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.fecMutex.Lock()
+	if t.fecID == ctx.ID() {
+		t.fec = nil
+	}
+	t.fecMutex.Unlock()
+
+	return t.TrackLocalStaticRTP.Unbind(ctx)
+}
+
+// WriteRTP implements webrtc.TrackLocalWriter.
+func (t *webRTCCountedTrack) WriteRTP(pkt *rtp.Packet) error {
+	if t.capture != nil {
+		t.capture(pkt, false)
+	}
+
+	t.fecMutex.Lock()
+	defer t.fecMutex.Unlock()
+
+	if t.fec != nil {
+		n, err := t.fec.writeRTP(pkt)
+		atomic.AddUint64(t.bytesSent, uint64(n))
+		return err
+	}
+
+	err := t.TrackLocalStaticRTP.WriteRTP(pkt)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddUint64(t.bytesSent, uint64(pkt.MarshalSize()))
+	return nil
+}
+
 type webRTCOutgoingTrack struct {
-	sender *webrtc.RTPSender
-	media  *media.Media
-	format formats.Format
-	track  *webrtc.TrackLocalStaticRTP
-	cb     func(formatprocessor.Unit) error
+	sender    *webrtc.RTPSender
+	media     *media.Media
+	format    formats.Format
+	track     *webRTCCountedTrack
+	packetize webrtcPacketizeFunc
+	svc       *webrtcSVCFilter
 }
 
-func newWebRTCOutgoingTrackVideo(medias media.Medias) (*webRTCOutgoingTrack, error) {
+// webrtcFindFormat is like media.Medias.FindFormat, but skips the format
+// when codec is not empty and is different from the codec of the format.
+func webrtcFindFormat(medias media.Medias, codec string, formatCodec string, forma interface{}) *media.Media {
+	if codec != "" && codec != formatCodec {
+		return nil
+	}
+	return medias.FindFormat(forma)
+}
+
+// newWebRTCOutgoingTrackVideo creates a video track with the first supported format.
+// If codec is not empty, only formats with this codec are considered.
+func newWebRTCOutgoingTrackVideo(medias media.Medias, codec string) (*webRTCOutgoingTrack, error) {
 	var av1Format *formats.AV1
-	videoMedia := medias.FindFormat(&av1Format)
+	videoMedia := webrtcFindFormat(medias, codec, "av1", &av1Format)
 
 	if videoMedia != nil {
-		webRTCTrak, err := webrtc.NewTrackLocalStaticRTP(
+		webRTCTrak, err := newWebRTCCountedTrack(
 			webrtc.RTPCodecCapability{
 				MimeType:  webrtc.MimeTypeAV1,
 				ClockRate: 90000,
@@ -55,32 +161,28 @@ func newWebRTCOutgoingTrackVideo(medias media.Medias) (*webRTCOutgoingTrack, err
 			media:  videoMedia,
 			format: av1Format,
 			track:  webRTCTrak,
-			cb: func(unit formatprocessor.Unit) error {
+			packetize: func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
 				tunit := unit.(*formatprocessor.UnitAV1)
 
 				if tunit.TU == nil {
-					return nil
+					return nil, nil
 				}
 
 				packets, err := encoder.Encode(tunit.TU, tunit.PTS)
 				if err != nil {
-					return nil //nolint:nilerr
-				}
-
-				for _, pkt := range packets {
-					webRTCTrak.WriteRTP(pkt) //nolint:errcheck
+					return nil, nil //nolint:nilerr
 				}
 
-				return nil
+				return packets, nil
 			},
 		}, nil
 	}
 
 	var vp9Format *formats.VP9
-	videoMedia = medias.FindFormat(&vp9Format)
+	videoMedia = webrtcFindFormat(medias, codec, "vp9", &vp9Format)
 
 	if videoMedia != nil {
-		webRTCTrak, err := webrtc.NewTrackLocalStaticRTP(
+		webRTCTrak, err := newWebRTCCountedTrack(
 			webrtc.RTPCodecCapability{
 				MimeType:  webrtc.MimeTypeVP9,
 				ClockRate: uint32(vp9Format.ClockRate()),
@@ -105,32 +207,28 @@ func newWebRTCOutgoingTrackVideo(medias media.Medias) (*webRTCOutgoingTrack, err
 			media:  videoMedia,
 			format: vp9Format,
 			track:  webRTCTrak,
-			cb: func(unit formatprocessor.Unit) error {
+			packetize: func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
 				tunit := unit.(*formatprocessor.UnitVP9)
 
 				if tunit.Frame == nil {
-					return nil
+					return nil, nil
 				}
 
 				packets, err := encoder.Encode(tunit.Frame, tunit.PTS)
 				if err != nil {
-					return nil //nolint:nilerr
-				}
-
-				for _, pkt := range packets {
-					webRTCTrak.WriteRTP(pkt) //nolint:errcheck
+					return nil, nil //nolint:nilerr
 				}
 
-				return nil
+				return packets, nil
 			},
 		}, nil
 	}
 
 	var vp8Format *formats.VP8
-	videoMedia = medias.FindFormat(&vp8Format)
+	videoMedia = webrtcFindFormat(medias, codec, "vp8", &vp8Format)
 
 	if videoMedia != nil {
-		webRTCTrak, err := webrtc.NewTrackLocalStaticRTP(
+		webRTCTrak, err := newWebRTCCountedTrack(
 			webrtc.RTPCodecCapability{
 				MimeType:  webrtc.MimeTypeVP8,
 				ClockRate: uint32(vp8Format.ClockRate()),
@@ -155,32 +253,28 @@ func newWebRTCOutgoingTrackVideo(medias media.Medias) (*webRTCOutgoingTrack, err
 			media:  videoMedia,
 			format: vp8Format,
 			track:  webRTCTrak,
-			cb: func(unit formatprocessor.Unit) error {
+			packetize: func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
 				tunit := unit.(*formatprocessor.UnitVP8)
 
 				if tunit.Frame == nil {
-					return nil
+					return nil, nil
 				}
 
 				packets, err := encoder.Encode(tunit.Frame, tunit.PTS)
 				if err != nil {
-					return nil //nolint:nilerr
-				}
-
-				for _, pkt := range packets {
-					webRTCTrak.WriteRTP(pkt) //nolint:errcheck
+					return nil, nil //nolint:nilerr
 				}
 
-				return nil
+				return packets, nil
 			},
 		}, nil
 	}
 
 	var h264Format *formats.H264
-	videoMedia = medias.FindFormat(&h264Format)
+	videoMedia = webrtcFindFormat(medias, codec, "h264", &h264Format)
 
 	if videoMedia != nil {
-		webRTCTrak, err := webrtc.NewTrackLocalStaticRTP(
+		webRTCTrak, err := newWebRTCCountedTrack(
 			webrtc.RTPCodecCapability{
 				MimeType:  webrtc.MimeTypeH264,
 				ClockRate: uint32(h264Format.ClockRate()),
@@ -208,11 +302,11 @@ func newWebRTCOutgoingTrackVideo(medias media.Medias) (*webRTCOutgoingTrack, err
 			media:  videoMedia,
 			format: h264Format,
 			track:  webRTCTrak,
-			cb: func(unit formatprocessor.Unit) error {
+			packetize: func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
 				tunit := unit.(*formatprocessor.UnitH264)
 
 				if tunit.AU == nil {
-					return nil
+					return nil, nil
 				}
 
 				if !firstNALUReceived {
@@ -227,14 +321,10 @@ func newWebRTCOutgoingTrackVideo(medias media.Medias) (*webRTCOutgoingTrack, err
 
 				packets, err := encoder.Encode(tunit.AU, tunit.PTS)
 				if err != nil {
-					return nil //nolint:nilerr
+					return nil, nil //nolint:nilerr
 				}
 
-				for _, pkt := range packets {
-					webRTCTrak.WriteRTP(pkt) //nolint:errcheck
-				}
-
-				return nil
+				return packets, nil
 			},
 		}, nil
 	}
@@ -242,12 +332,14 @@ func newWebRTCOutgoingTrackVideo(medias media.Medias) (*webRTCOutgoingTrack, err
 	return nil, nil
 }
 
-func newWebRTCOutgoingTrackAudio(medias media.Medias) (*webRTCOutgoingTrack, error) {
+// newWebRTCOutgoingTrackAudio creates an audio track with the first supported format.
+// If codec is not empty, only formats with this codec are considered.
+func newWebRTCOutgoingTrackAudio(medias media.Medias, codec string) (*webRTCOutgoingTrack, error) {
 	var opusFormat *formats.Opus
-	audioMedia := medias.FindFormat(&opusFormat)
+	audioMedia := webrtcFindFormat(medias, codec, "opus", &opusFormat)
 
 	if audioMedia != nil {
-		webRTCTrak, err := webrtc.NewTrackLocalStaticRTP(
+		webRTCTrak, err := newWebRTCCountedTrack(
 			webrtc.RTPCodecCapability{
 				MimeType:  webrtc.MimeTypeOpus,
 				ClockRate: uint32(opusFormat.ClockRate()),
@@ -264,21 +356,17 @@ func newWebRTCOutgoingTrackAudio(medias media.Medias) (*webRTCOutgoingTrack, err
 			media:  audioMedia,
 			format: opusFormat,
 			track:  webRTCTrak,
-			cb: func(unit formatprocessor.Unit) error {
-				for _, pkt := range unit.GetRTPPackets() {
-					webRTCTrak.WriteRTP(pkt) //nolint:errcheck
-				}
-
-				return nil
+			packetize: func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
+				return unit.GetRTPPackets(), nil
 			},
 		}, nil
 	}
 
 	var g722Format *formats.G722
-	audioMedia = medias.FindFormat(&g722Format)
+	audioMedia = webrtcFindFormat(medias, codec, "g722", &g722Format)
 
 	if audioMedia != nil {
-		webRTCTrak, err := webrtc.NewTrackLocalStaticRTP(
+		webRTCTrak, err := newWebRTCCountedTrack(
 			webrtc.RTPCodecCapability{
 				MimeType:  webrtc.MimeTypeG722,
 				ClockRate: uint32(g722Format.ClockRate()),
@@ -294,18 +382,14 @@ func newWebRTCOutgoingTrackAudio(medias media.Medias) (*webRTCOutgoingTrack, err
 			media:  audioMedia,
 			format: g722Format,
 			track:  webRTCTrak,
-			cb: func(unit formatprocessor.Unit) error {
-				for _, pkt := range unit.GetRTPPackets() {
-					webRTCTrak.WriteRTP(pkt) //nolint:errcheck
-				}
-
-				return nil
+			packetize: func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
+				return unit.GetRTPPackets(), nil
 			},
 		}, nil
 	}
 
 	var g711Format *formats.G711
-	audioMedia = medias.FindFormat(&g711Format)
+	audioMedia = webrtcFindFormat(medias, codec, "g711", &g711Format)
 
 	if audioMedia != nil {
 		var mtyp string
@@ -315,7 +399,7 @@ func newWebRTCOutgoingTrackAudio(medias media.Medias) (*webRTCOutgoingTrack, err
 			mtyp = webrtc.MimeTypePCMA
 		}
 
-		webRTCTrak, err := webrtc.NewTrackLocalStaticRTP(
+		webRTCTrak, err := newWebRTCCountedTrack(
 			webrtc.RTPCodecCapability{
 				MimeType:  mtyp,
 				ClockRate: uint32(g711Format.ClockRate()),
@@ -331,12 +415,8 @@ func newWebRTCOutgoingTrackAudio(medias media.Medias) (*webRTCOutgoingTrack, err
 			media:  audioMedia,
 			format: g711Format,
 			track:  webRTCTrak,
-			cb: func(unit formatprocessor.Unit) error {
-				for _, pkt := range unit.GetRTPPackets() {
-					webRTCTrak.WriteRTP(pkt) //nolint:errcheck
-				}
-
-				return nil
+			packetize: func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
+				return unit.GetRTPPackets(), nil
 			},
 		}, nil
 	}
@@ -344,32 +424,85 @@ func newWebRTCOutgoingTrackAudio(medias media.Medias) (*webRTCOutgoingTrack, err
 	return nil, nil
 }
 
+func (t *webRTCOutgoingTrack) apiItem() *apiWebRTCSessionTrack {
+	item := &apiWebRTCSessionTrack{
+		Type:          string(t.media.Type),
+		Codec:         webrtcCodecOfFormat(t.format),
+		BytesSent:     atomic.LoadUint64(t.track.bytesSent),
+		NACKsReceived: atomic.LoadUint64(t.track.nacksReceived),
+	}
+
+	if t.svc != nil {
+		item.SVC = t.svc.apiItem()
+	}
+
+	return item
+}
+
 func (t *webRTCOutgoingTrack) start(
 	ctx context.Context,
 	r reader,
 	stream *stream.Stream,
-	ringBuffer *ringbuffer.RingBuffer,
+	packetizer *webrtcPacketizer,
+	readBuf *webrtcReaderBuffer,
 	writeError chan error,
+	onRTCP func([]rtcp.Packet),
 ) {
 	// read incoming RTCP packets to make interceptors work
 	go func() {
-		buf := make([]byte, 1500)
 		for {
-			_, _, err := t.sender.Read(buf)
+			pkts, _, err := t.sender.ReadRTCP()
 			if err != nil {
 				return
 			}
+
+			// lost packets are retransmitted by the NACK responder interceptor
+			for _, pkt := range pkts {
+				if nack, ok := pkt.(*rtcp.TransportLayerNack); ok {
+					for _, pair := range nack.Nacks {
+						atomic.AddUint64(t.track.nacksReceived, uint64(len(pair.PacketList())))
+					}
+				}
+			}
+
+			if onRTCP != nil {
+				onRTCP(pkts)
+			}
+
+			if t.svc != nil {
+				t.svc.onRTCP(pkts)
+			}
 		}
 	}()
 
 	stream.AddReader(r, t.media, t.format, func(unit formatprocessor.Unit) {
-		ringBuffer.Push(func() {
-			err := t.cb(unit)
+		readBuf.push(func() {
+			var packets []*rtp.Packet
+			var err error
+
+			if t.svc != nil {
+				// since units are filtered, packets can't be shared with other readers
+				filtered := t.svc.filter(unit)
+				if filtered == nil {
+					return
+				}
+				packets, err = t.packetize(filtered)
+			} else {
+				// packets are shared with other readers
+				packets, err = packetizer.get(unit)
+			}
+
 			if err != nil {
 				select {
 				case writeError <- err:
 				case <-ctx.Done():
 				}
+				return
+			}
+
+			// packets are marshaled and encrypted with the SSRC and keys of this reader
+			for _, pkt := range packets {
+				t.track.WriteRTP(pkt) //nolint:errcheck
 			}
 		})
 	})
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+)
+
+// webrtcPacketizeFunc converts a unit into RTP packets.
+type webrtcPacketizeFunc func(formatprocessor.Unit) ([]*rtp.Packet, error)
+
+// webrtcPacketizer converts the units of a format into RTP packets once,
+// and shares packets among all WebRTC readers of the format, in order to avoid
+// encoding units again for every reader.
+// Since readers consume units at different speeds, packets of the most recent
+// units are kept, up to the size of the ring buffer of readers; readers that
+// fall further behind lose packets anyway.
+// Returned packets are shared and must not be modified.
+// Only packetization is shared: packets are marshaled and encrypted by every reader,
+// since SSRC, payload type and SRTP keys are negotiated by each peer connection,
+// therefore every reader allocates a buffer per packet
+// (see BenchmarkWebRTCPacketizerWrite).
+type webrtcPacketizer struct {
+	size      int
+	packetize webrtcPacketizeFunc
+
+	refCount int
+
+	mutex   sync.Mutex
+	packets map[formatprocessor.Unit][]*rtp.Packet
+	units   []formatprocessor.Unit
+	next    int
+}
+
+func newWebRTCPacketizer(size int, packetize webrtcPacketizeFunc) *webrtcPacketizer {
+	return &webrtcPacketizer{
+		size:      size,
+		packetize: packetize,
+		packets:   make(map[formatprocessor.Unit][]*rtp.Packet),
+	}
+}
+
+// get returns the RTP packets of a unit.
+func (p *webrtcPacketizer) get(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if pkts, ok := p.packets[unit]; ok {
+		return pkts, nil
+	}
+
+	pkts, err := p.packetize(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.units) < p.size {
+		p.units = append(p.units, unit)
+	} else {
+		// the cache is full, remove the oldest unit
+		delete(p.packets, p.units[p.next])
+		p.units[p.next] = unit
+		p.next = (p.next + 1) % p.size
+	}
+
+	p.packets[unit] = pkts
+
+	return pkts, nil
+}
+
+// acquirePacketizer is called by webRTCSession.
+// The packetizer of a format is created by the first reader, with its packetize function.
+func (m *webRTCManager) acquirePacketizer(
+	forma formats.Format,
+	packetize webrtcPacketizeFunc,
+) *webrtcPacketizer {
+	m.packetizersMutex.Lock()
+	defer m.packetizersMutex.Unlock()
+
+	p, ok := m.packetizers[forma]
+	if !ok {
+		p = newWebRTCPacketizer(m.readBufferCount, packetize)
+		m.packetizers[forma] = p
+	}
+
+	p.refCount++
+	return p
+}
+
+// releasePacketizer is called by webRTCSession.
+func (m *webRTCManager) releasePacketizer(forma formats.Format) {
+	m.packetizersMutex.Lock()
+	defer m.packetizersMutex.Unlock()
+
+	p := m.packetizers[forma]
+	p.refCount--
+	if p.refCount == 0 {
+		delete(m.packetizers, forma)
+	}
+}
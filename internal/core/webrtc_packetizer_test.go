@@ -0,0 +1,210 @@
+package core
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+)
+
+func TestWebRTCPacketizer(t *testing.T) {
+	calls := 0
+
+	p := newWebRTCPacketizer(2, func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
+		calls++
+		return []*rtp.Packet{{Payload: unit.(*formatprocessor.UnitVP8).Frame}}, nil
+	})
+
+	u1 := &formatprocessor.UnitVP8{Frame: []byte{1}}
+	u2 := &formatprocessor.UnitVP8{Frame: []byte{2}}
+	u3 := &formatprocessor.UnitVP8{Frame: []byte{3}}
+
+	// readers receive the same packets
+	pkts1, err := p.get(u1)
+	require.NoError(t, err)
+	pkts2, err := p.get(u1)
+	require.NoError(t, err)
+	require.Same(t, pkts1[0], pkts2[0])
+	require.Equal(t, 1, calls)
+
+	_, err = p.get(u2)
+	require.NoError(t, err)
+	_, err = p.get(u3)
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// the oldest unit has been removed
+	_, err = p.get(u2)
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	pkts3, err := p.get(u1)
+	require.NoError(t, err)
+	require.Equal(t, 4, calls)
+	require.Equal(t, []byte{1}, pkts3[0].Payload)
+}
+
+func TestWebRTCPacketizerRefCount(t *testing.T) {
+	m := &webRTCManager{
+		readBufferCount: 16,
+		packetizers:     make(map[formats.Format]*webrtcPacketizer),
+	}
+
+	forma := &formats.VP8{PayloadTyp: 96}
+	packetize := func(unit formatprocessor.Unit) ([]*rtp.Packet, error) {
+		return nil, nil
+	}
+
+	p1 := m.acquirePacketizer(forma, packetize)
+	p2 := m.acquirePacketizer(forma, packetize)
+	require.Same(t, p1, p2)
+
+	m.releasePacketizer(forma)
+	require.Len(t, m.packetizers, 1)
+
+	m.releasePacketizer(forma)
+	require.Len(t, m.packetizers, 0)
+}
+
+func BenchmarkWebRTCPacketizer(b *testing.B) {
+	forma := &formats.H264{PayloadTyp: 96, PacketizationMode: 1}
+
+	track, err := newWebRTCOutgoingTrackVideo(media.Medias{{
+		Type:    media.TypeVideo,
+		Formats: []formats.Format{forma},
+	}}, "")
+	require.NoError(b, err)
+
+	p := newWebRTCPacketizer(512, track.packetize)
+
+	au := [][]byte{make([]byte, 50000)}
+
+	// a unit read by 1000 readers is encoded once
+	for i := 0; i < b.N; i++ {
+		unit := &formatprocessor.UnitH264{AU: au}
+		for j := 0; j < 1000; j++ {
+			_, err := p.get(unit)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// testSRTPWriter marshals packets into a new buffer, like the SRTP session
+// of a peer connection does before encrypting them.
+type testSRTPWriter struct{}
+
+func (testSRTPWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	buf := make([]byte, header.MarshalSize()+len(payload))
+	n, err := header.MarshalTo(buf)
+	if err != nil {
+		return 0, err
+	}
+	copy(buf[n:], payload)
+	return len(buf), nil
+}
+
+func (testSRTPWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+type testTrackLocalContext struct {
+	id     string
+	ssrc   webrtc.SSRC
+	params []webrtc.RTPCodecParameters
+}
+
+func (c *testTrackLocalContext) CodecParameters() []webrtc.RTPCodecParameters {
+	return c.params
+}
+
+func (c *testTrackLocalContext) HeaderExtensions() []webrtc.RTPHeaderExtensionParameter {
+	return nil
+}
+
+func (c *testTrackLocalContext) SSRC() webrtc.SSRC {
+	return c.ssrc
+}
+
+func (c *testTrackLocalContext) WriteStream() webrtc.TrackLocalWriter {
+	return testSRTPWriter{}
+}
+
+func (c *testTrackLocalContext) ID() string {
+	return c.id
+}
+
+func (c *testTrackLocalContext) RTCPReader() interceptor.RTCPReader {
+	return nil
+}
+
+// BenchmarkWebRTCPacketizerWrite measures the allocations of delivering a unit to N readers.
+// Packetization is shared, while every reader marshals and encrypts packets
+// with its own SSRC, payload type and SRTP keys.
+func BenchmarkWebRTCPacketizerWrite(b *testing.B) {
+	forma := &formats.H264{PayloadTyp: 96, PacketizationMode: 1}
+
+	for _, n := range []int{1, 10, 100} {
+		b.Run("readers="+strconv.Itoa(n), func(b *testing.B) {
+			tracks := make([]*webRTCOutgoingTrack, n)
+
+			for i := range tracks {
+				track, err := newWebRTCOutgoingTrackVideo(media.Medias{{
+					Type:    media.TypeVideo,
+					Formats: []formats.Format{forma},
+				}}, "")
+				require.NoError(b, err)
+
+				_, err = track.track.Bind(&testTrackLocalContext{
+					id:   strconv.Itoa(i),
+					ssrc: webrtc.SSRC(i),
+					params: []webrtc.RTPCodecParameters{{
+						RTPCodecCapability: track.track.Codec(),
+						PayloadType:        96,
+					}},
+				})
+				require.NoError(b, err)
+
+				tracks[i] = track
+			}
+
+			p := newWebRTCPacketizer(512, tracks[0].packetize)
+
+			au := [][]byte{make([]byte, 50000)}
+			pkts, err := p.get(&formatprocessor.UnitH264{AU: au})
+			require.NoError(b, err)
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				unit := &formatprocessor.UnitH264{AU: au}
+				for _, track := range tracks {
+					pkts, err := p.get(unit)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					for _, pkt := range pkts {
+						track.track.WriteRTP(pkt) //nolint:errcheck
+					}
+				}
+			}
+
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+
+			b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N*len(pkts)*n), "allocs/packet/reader")
+		})
+	}
+}
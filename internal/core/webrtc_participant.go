@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/recordkey"
+)
+
+const (
+	// query parameters and token claims that contain the identity of a participant.
+	webrtcParticipantNameKey = "participantName"
+	webrtcParticipantIDKey   = "participantID"
+)
+
+// jwtClaims returns the claims of a JSON Web Token, or nil if token is not a JWT.
+// The signature is not verified: tokens are validated by the external authentication server.
+func jwtClaims(token string) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	byts, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(byts))
+	dec.UseNumber()
+
+	var claims map[string]interface{}
+	err = dec.Decode(&claims)
+	if err != nil {
+		return nil
+	}
+
+	return claims
+}
+
+// webrtcParticipantIdentity returns the name and ID of a participant.
+// They are taken from the claims of the bearer token, when it is a JWT,
+// otherwise from the query.
+func webrtcParticipantIdentity(rawQuery string, token string) (string, string, error) {
+	query, _ := url.ParseQuery(rawQuery)
+	name := query.Get(webrtcParticipantNameKey)
+	id := query.Get(webrtcParticipantIDKey)
+
+	if claims := jwtClaims(token); claims != nil {
+		if v, ok := claims[webrtcParticipantNameKey]; ok {
+			name = fmt.Sprint(v)
+		}
+		if v, ok := claims[webrtcParticipantIDKey]; ok {
+			id = fmt.Sprint(v)
+		}
+	}
+
+	if name != "" {
+		err := recordkey.CheckName(name)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid participant name: %v", err)
+		}
+	}
+
+	if id != "" {
+		err := recordkey.CheckName(id)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid participant ID: %v", err)
+		}
+	}
+
+	return name, id, nil
+}
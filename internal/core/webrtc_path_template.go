@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// webrtcPathElement converts a name into a string that can be used as
+// an element of a path name.
+func webrtcPathElement(name string) string {
+	var b strings.Builder
+
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			r == '-' || r == '_' || r == '.' || r == '~':
+			b.WriteRune(r)
+
+		case r == ' ':
+			b.WriteRune('-')
+
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	ret := strings.TrimLeft(b.String(), ".")
+	if ret == "" {
+		return "_"
+	}
+
+	return ret
+}
+
+// webrtcTemplatePathName returns the path of a publisher, by filling webrtcPathTemplate
+// with the club and event names of its room and with the name of the participant.
+// This prevents publishers of concurrent events from choosing the same path.
+func webrtcTemplatePathName(template string, room *Room, req webRTCNewSessionReq) (string, error) {
+	participant := req.participantName
+	if participant == "" {
+		participant = req.participantID
+	}
+	if participant == "" {
+		participant = req.user
+	}
+
+	if participant == "" && strings.Contains(template, "%participant") {
+		return "", fmt.Errorf("participant name is missing")
+	}
+
+	pathName := conf.WebRTCPathTemplateReplacer(
+		webrtcPathElement(room.clubName),
+		webrtcPathElement(room.eventName),
+		room.uuid.String(),
+		webrtcPathElement(participant),
+		req.pathName,
+	).Replace(template)
+
+	err := conf.IsValidPathName(pathName)
+	if err != nil {
+		return "", fmt.Errorf("invalid path '%s': %v", pathName, err)
+	}
+
+	return pathName, nil
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCTemplatePathName(t *testing.T) {
+	room := &Room{
+		uuid:      uuid.MustParse("6a4b4ca1-4b38-4a8e-9d1b-1c1a5d0c7f01"),
+		clubName:  "Club Nautique",
+		eventName: "Régates 2023",
+	}
+
+	pathName, err := webrtcTemplatePathName("%club/%event/%participant", room, webRTCNewSessionReq{
+		pathName:        "cam1",
+		participantName: "John Doe",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Club-Nautique/R_gates-2023/John-Doe", pathName)
+
+	pathName, err = webrtcTemplatePathName("%room/%path", room, webRTCNewSessionReq{
+		pathName: "venue/cam1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "6a4b4ca1-4b38-4a8e-9d1b-1c1a5d0c7f01/venue/cam1", pathName)
+
+	// the participant ID is used when the name is missing
+	pathName, err = webrtcTemplatePathName("%event/%participant", room, webRTCNewSessionReq{
+		participantID: "1234",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "R_gates-2023/1234", pathName)
+
+	_, err = webrtcTemplatePathName("%event/%participant", room, webRTCNewSessionReq{})
+	require.EqualError(t, err, "participant name is missing")
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	webrtcReaderBufferWarningPeriod = 10 * time.Second
+)
+
+// webrtcReaderBuffer is a queue between a stream and a WebRTC reader.
+// When the reader falls behind and the queue is full, the queue grows up to maxSize,
+// then new items are discarded and counted.
+type webrtcReaderBuffer struct {
+	maxSize int
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	items  []func()
+	first  int
+	count  int
+	closed bool
+
+	discarded *uint64
+}
+
+func newWebRTCReaderBuffer(size int, maxSize int) *webrtcReaderBuffer {
+	if maxSize < size {
+		maxSize = size
+	}
+
+	b := &webrtcReaderBuffer{
+		maxSize:   maxSize,
+		items:     make([]func(), size),
+		discarded: new(uint64),
+	}
+	b.cond = sync.NewCond(&b.mutex)
+	return b
+}
+
+func (b *webrtcReaderBuffer) grow() bool {
+	size := len(b.items) * 2
+	if size > b.maxSize {
+		size = b.maxSize
+	}
+
+	if size == len(b.items) {
+		return false
+	}
+
+	items := make([]func(), size)
+	for i := 0; i < b.count; i++ {
+		items[i] = b.items[(b.first+i)%len(b.items)]
+	}
+
+	b.items = items
+	b.first = 0
+	return true
+}
+
+// push adds an item at the end of the queue.
+// It returns false if the item has been discarded.
+func (b *webrtcReaderBuffer) push(item func()) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return false
+	}
+
+	if b.count == len(b.items) && !b.grow() {
+		atomic.AddUint64(b.discarded, 1)
+		return false
+	}
+
+	b.items[(b.first+b.count)%len(b.items)] = item
+	b.count++
+	b.cond.Signal()
+	return true
+}
+
+// pull removes an item from the beginning of the queue, waiting until one is available.
+// It returns false when the queue is closed.
+func (b *webrtcReaderBuffer) pull() (func(), bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for b.count == 0 && !b.closed {
+		b.cond.Wait()
+	}
+
+	if b.closed {
+		return nil, false
+	}
+
+	item := b.items[b.first]
+	b.items[b.first] = nil
+	b.first = (b.first + 1) % len(b.items)
+	b.count--
+	return item, true
+}
+
+// close makes pull() return false.
+func (b *webrtcReaderBuffer) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// size returns the current capacity of the queue.
+func (b *webrtcReaderBuffer) size() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.items)
+}
+
+// discardedCount returns the number of discarded items.
+func (b *webrtcReaderBuffer) discardedCount() uint64 {
+	return atomic.LoadUint64(b.discarded)
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCReaderBuffer(t *testing.T) {
+	b := newWebRTCReaderBuffer(2, 4)
+
+	var out []int
+	for i := 0; i < 6; i++ {
+		i := i
+		ok := b.push(func() { out = append(out, i) })
+		require.Equal(t, i < 4, ok)
+	}
+
+	require.Equal(t, 4, b.size())
+	require.Equal(t, uint64(2), b.discardedCount())
+
+	for i := 0; i < 4; i++ {
+		item, ok := b.pull()
+		require.True(t, ok)
+		item()
+	}
+	require.Equal(t, []int{0, 1, 2, 3}, out)
+
+	b.close()
+	_, ok := b.pull()
+	require.False(t, ok)
+	require.False(t, b.push(func() {}))
+}
+
+func TestWebRTCReaderBufferNoGrowth(t *testing.T) {
+	b := newWebRTCReaderBuffer(2, 0)
+
+	require.True(t, b.push(func() {}))
+	_, ok := b.pull()
+	require.True(t, ok)
+
+	// items wrap around the end of the buffer
+	require.True(t, b.push(func() {}))
+	require.True(t, b.push(func() {}))
+	require.False(t, b.push(func() {}))
+	require.Equal(t, 2, b.size())
+	require.Equal(t, uint64(1), b.discardedCount())
+}
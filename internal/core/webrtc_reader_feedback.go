@@ -0,0 +1,209 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	webrtcFeedbackInterval    = 1 * time.Second
+	webrtcFeedbackMaxAge      = 5 * time.Second
+	webrtcFeedbackMaxLoss     = 0.1
+	webrtcFeedbackMinLoss     = 0.02
+	webrtcFeedbackMaxRTT      = 1 * time.Second
+	webrtcFeedbackMinBitrate  = 100000
+	webrtcFeedbackIncrease    = 1.08
+	webrtcFeedbackRTTDecrease = 0.85
+	webrtcFeedbackReleaseRate = 1.5
+)
+
+// ntpCompactNow returns the current time in the compact NTP format used by RTCP.
+func ntpCompactNow() uint32 {
+	now := time.Now()
+	s := uint64(now.Unix()) + 2208988800
+	f := uint64(now.Nanosecond()) << 32 / 1e9
+	return uint32(((s << 32) | f) >> 16)
+}
+
+type webRTCReaderStats struct {
+	fractionLost float64
+	rtt          time.Duration
+	bitrate      float64 // estimated by the reader, zero if not available
+	maxBitrate   float64 // requested by the reader, zero if not available
+	updated      time.Time
+}
+
+// webRTCPathFeedback collects RTCP statistics of all WebRTC readers of a path,
+// in order to provide a bitrate target to the publisher.
+type webRTCPathFeedback struct {
+	refCount int
+
+	mutex   sync.Mutex
+	readers map[*webRTCSession]*webRTCReaderStats
+}
+
+func newWebRTCPathFeedback() *webRTCPathFeedback {
+	return &webRTCPathFeedback{
+		readers: make(map[*webRTCSession]*webRTCReaderStats),
+	}
+}
+
+// onReaderRTCP is called by readers when they receive RTCP packets.
+func (f *webRTCPathFeedback) onReaderRTCP(sx *webRTCSession, pkts []rtcp.Packet) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	stats, ok := f.readers[sx]
+	if !ok {
+		stats = &webRTCReaderStats{}
+		f.readers[sx] = stats
+	}
+
+	for _, pkt := range pkts {
+		switch pkt := pkt.(type) {
+		case *rtcp.ReceiverReport:
+			for _, report := range pkt.Reports {
+				stats.fractionLost = float64(report.FractionLost) / 256
+
+				if report.LastSenderReport != 0 {
+					rtt := ntpCompactNow() - report.LastSenderReport - report.Delay
+					stats.rtt = time.Duration(rtt) * time.Second / 65536
+				}
+
+				stats.updated = time.Now()
+			}
+
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			stats.bitrate = float64(pkt.Bitrate)
+			stats.updated = time.Now()
+		}
+	}
+}
+
+// setReaderMaxBitrate is called by readers that requested a video bitrate limit.
+// The limit is a vote on the bitrate advertised to the publisher, that is shared
+// by all readers; it is enforced on the reader itself by webrtcSVCFilter.
+func (f *webRTCPathFeedback) setReaderMaxBitrate(sx *webRTCSession, bitrate float64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	stats, ok := f.readers[sx]
+	if !ok {
+		stats = &webRTCReaderStats{}
+		f.readers[sx] = stats
+	}
+
+	stats.maxBitrate = bitrate
+}
+
+func (f *webRTCPathFeedback) removeReader(sx *webRTCSession) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.readers, sx)
+}
+
+// median returns the median statistics of readers that sent reports recently.
+func (f *webRTCPathFeedback) median() (float64, time.Duration, float64, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var losses []float64
+	var rtts []time.Duration
+	var bitrates []float64
+
+	for _, stats := range f.readers {
+		if time.Since(stats.updated) > webrtcFeedbackMaxAge {
+			continue
+		}
+
+		losses = append(losses, stats.fractionLost)
+		rtts = append(rtts, stats.rtt)
+
+		bitrate := stats.bitrate
+		if stats.maxBitrate != 0 && (bitrate == 0 || bitrate > stats.maxBitrate) {
+			bitrate = stats.maxBitrate
+		}
+
+		if bitrate != 0 {
+			bitrates = append(bitrates, bitrate)
+		}
+	}
+
+	if losses == nil {
+		return 0, 0, 0, false
+	}
+
+	sort.Float64s(losses)
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	sort.Float64s(bitrates)
+
+	var bitrate float64
+	if bitrates != nil {
+		bitrate = bitrates[len(bitrates)/2]
+	}
+
+	return losses[len(losses)/2], rtts[len(rtts)/2], bitrate, true
+}
+
+// webRTCBitrateController computes the bitrate to advertise to a publisher
+// by using the loss-based approach of Google Congestion Control.
+type webRTCBitrateController struct {
+	feedback   *webRTCPathFeedback
+	maxBitrate float64
+	target     float64
+}
+
+// update returns the bitrate that must be sent to the publisher with REMB,
+// or zero if the publisher must not be limited.
+func (c *webRTCBitrateController) update(incomingBitrate float64) float64 {
+	target := c.updateFromReaders(incomingBitrate)
+
+	if c.maxBitrate != 0 && (target == 0 || target > c.maxBitrate) {
+		return c.maxBitrate
+	}
+
+	return target
+}
+
+func (c *webRTCBitrateController) updateFromReaders(incomingBitrate float64) float64 {
+	loss, rtt, readersBitrate, ok := c.feedback.median()
+	if !ok || incomingBitrate == 0 {
+		c.target = 0
+		return 0
+	}
+
+	base := c.target
+	if base == 0 || base > incomingBitrate {
+		base = incomingBitrate
+	}
+
+	switch {
+	case loss > webrtcFeedbackMaxLoss:
+		c.target = base * (1 - 0.5*loss)
+
+	case rtt > webrtcFeedbackMaxRTT:
+		c.target = base * webrtcFeedbackRTTDecrease
+
+	case c.target != 0 && loss < webrtcFeedbackMinLoss:
+		c.target *= webrtcFeedbackIncrease
+
+		// readers are not struggling anymore, release the limit
+		if c.target > incomingBitrate*webrtcFeedbackReleaseRate {
+			c.target = 0
+		}
+	}
+
+	if readersBitrate != 0 && readersBitrate < incomingBitrate &&
+		(c.target == 0 || readersBitrate < c.target) {
+		c.target = readersBitrate
+	}
+
+	if c.target != 0 && c.target < webrtcFeedbackMinBitrate {
+		c.target = webrtcFeedbackMinBitrate
+	}
+
+	return c.target
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// webRTCResumeState allows a WHIP publisher to resume its session after a
+// network failure, by presenting the resume token received when the session was created.
+// The resumed session keeps the ID, and therefore the recording files, of the previous one.
+type webRTCResumeState struct {
+	token    string
+	uuid     uuid.UUID
+	roomID   string
+	pathName string
+
+	// set when the session is migrated to another path through the API
+	migratedPathName string
+
+	// the previous session, until it is closed
+	session *webRTCSession
+
+	// set when the previous session is closed
+	expires time.Time
+}
+
+func (st *webRTCResumeState) expired(now time.Time) bool {
+	return !st.expires.IsZero() && now.After(st.expires)
+}
+
+// addResumeState generates a resume token for a publisher.
+func (m *webRTCManager) addResumeState(sx *webRTCSession) string {
+	// resuming publishers provide the path they requested, not the one built with webrtcPathTemplate
+	pathName := sx.req.pathName
+	if sx.req.requestedPathName != "" {
+		pathName = sx.req.requestedPathName
+	}
+
+	st := &webRTCResumeState{
+		token:            uuid.New().String(),
+		uuid:             sx.uuid,
+		roomID:           sx.req.roomID,
+		pathName:         pathName,
+		migratedPathName: sx.req.migratedPathName,
+		session:          sx,
+	}
+	m.resumeStates[st.token] = st
+	return st.token
+}
+
+// findResumeState returns the state of the session that a publisher wants to resume.
+func (m *webRTCManager) findResumeState(req webRTCNewSessionReq) (*webRTCResumeState, error) {
+	st, ok := m.resumeStates[req.resumeToken]
+	if !ok || st.expired(time.Now()) {
+		return nil, fmt.Errorf("invalid or expired resume token")
+	}
+
+	if !req.publish || st.pathName != req.pathName || st.roomID != req.roomID {
+		return nil, fmt.Errorf("resume token doesn't belong to this path and room")
+	}
+
+	return st, nil
+}
+
+// expireResumeState starts the period in which a closed session can be resumed.
+// It returns false if the session can't be resumed.
+func (m *webRTCManager) expireResumeState(sx *webRTCSession) bool {
+	for _, st := range m.resumeStates {
+		if st.session == sx {
+			st.session = nil
+			st.expires = time.Now().Add(m.resumeTimeout)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *webRTCManager) deleteExpiredResumeStates() {
+	now := time.Now()
+	for token, st := range m.resumeStates {
+		if st.expired(now) {
+			delete(m.resumeStates, token)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCResumeState(t *testing.T) {
+	m := &webRTCManager{
+		resumeTimeout: 10 * time.Second,
+		resumeStates:  make(map[string]*webRTCResumeState),
+	}
+
+	roomID := uuid.New().String()
+
+	sx := &webRTCSession{
+		uuid: uuid.New(),
+		req: webRTCNewSessionReq{
+			pathName: "mypath",
+			roomID:   roomID,
+			publish:  true,
+		},
+	}
+
+	token := m.addResumeState(sx)
+
+	_, err := m.findResumeState(webRTCNewSessionReq{
+		pathName:    "mypath",
+		roomID:      roomID,
+		publish:     true,
+		resumeToken: "invalid",
+	})
+	require.EqualError(t, err, "invalid or expired resume token")
+
+	_, err = m.findResumeState(webRTCNewSessionReq{
+		pathName:    "otherpath",
+		roomID:      roomID,
+		publish:     true,
+		resumeToken: token,
+	})
+	require.EqualError(t, err, "resume token doesn't belong to this path and room")
+
+	_, err = m.findResumeState(webRTCNewSessionReq{
+		pathName:    "mypath",
+		roomID:      roomID,
+		resumeToken: token,
+	})
+	require.EqualError(t, err, "resume token doesn't belong to this path and room")
+
+	st, err := m.findResumeState(webRTCNewSessionReq{
+		pathName:    "mypath",
+		roomID:      roomID,
+		publish:     true,
+		resumeToken: token,
+	})
+	require.NoError(t, err)
+	require.Equal(t, sx.uuid, st.uuid)
+	require.Equal(t, sx, st.session)
+
+	// the token remains valid for a while after the session is closed
+	m.expireResumeState(sx)
+	require.Nil(t, st.session)
+	m.deleteExpiredResumeStates()
+	require.Len(t, m.resumeStates, 1)
+
+	st.expires = time.Now().Add(-time.Second)
+	_, err = m.findResumeState(webRTCNewSessionReq{
+		pathName:    "mypath",
+		roomID:      roomID,
+		publish:     true,
+		resumeToken: token,
+	})
+	require.EqualError(t, err, "invalid or expired resume token")
+
+	m.deleteExpiredResumeStates()
+	require.Len(t, m.resumeStates, 0)
+}
@@ -2,47 +2,280 @@ package core
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/chunkcrypt"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordkey"
+)
+
+const (
+	webrtcEncryptedFileExtension = ".enc"
 )
 
+// roomRecordConf contains the recording parameters applied to new rooms.
+type roomRecordConf struct {
+	path               string
+	region             string
+	bucket             string
+	buckets            []conf.WebRTCRecordBucket
+	s3Endpoint         string
+	s3AccessKeyID      string
+	s3SecretKey        string
+	s3PathStyle        bool
+	s3SkipTLSVerify    bool
+	s3AllowedEndpoints []string
+	sse                conf.RecordSSE
+	sseKMSKeyID        string
+	nasPath            string
+	nasMinFreeSpace    uint64
+	nasRetryTimeout    time.Duration
+	encryptionKey      []byte
+	overlayCommand     string
+	overlayTimeout     time.Duration
+	loudnessCommand    string
+	loudnessTarget     float64
+	tracks             conf.WebRTCRecordTracks
+	gcMaxAge           time.Duration
+}
+
+func newRoomRecordConf(c *conf.Conf) roomRecordConf {
+	encryptionKey, _ := hex.DecodeString(c.WebRTCRecordEncryptionKey)
+
+	return roomRecordConf{
+		path:               c.WebRTCRecordPath,
+		region:             c.WebRTCRecordRegion,
+		buckets:            c.WebRTCRecordBuckets,
+		s3Endpoint:         c.WebRTCRecordS3Endpoint,
+		s3AccessKeyID:      c.WebRTCRecordS3AccessKeyID,
+		s3SecretKey:        c.WebRTCRecordS3SecretKey,
+		s3PathStyle:        c.WebRTCRecordS3PathStyle,
+		s3SkipTLSVerify:    c.WebRTCRecordS3SkipTLSVerify,
+		s3AllowedEndpoints: c.WebRTCRecordS3AllowedEndpoints,
+		sse:                c.WebRTCRecordSSE,
+		sseKMSKeyID:        c.WebRTCRecordSSEKMSKeyID,
+		nasPath:            c.WebRTCRecordNASPath,
+		nasMinFreeSpace:    uint64(c.WebRTCRecordNASMinFreeSpace),
+		nasRetryTimeout:    time.Duration(c.WebRTCRecordNASRetryTimeout),
+		encryptionKey:      encryptionKey,
+		overlayCommand:     c.WebRTCRecordOverlayCommand,
+		overlayTimeout:     time.Duration(c.WebRTCRecordOverlayTimeout),
+		loudnessCommand:    c.WebRTCRecordLoudnessCommand,
+		loudnessTarget:     c.WebRTCRecordLoudnessTarget,
+		tracks:             c.WebRTCRecordTracks,
+		gcMaxAge:           time.Duration(c.WebRTCRecordGCMaxAge),
+	}
+}
+
+// withBucketRules returns a copy of the configuration with bucket and region
+// set by the first rule that matches the club name.
+func (c roomRecordConf) withBucketRules(clubName string) roomRecordConf {
+	for _, rule := range c.buckets {
+		if strings.HasPrefix(clubName, rule.ClubPrefix) {
+			c.bucket = rule.Bucket
+			if rule.Region != "" {
+				c.region = rule.Region
+			}
+			break
+		}
+	}
+
+	return c
+}
+
+// withS3Overrides returns a copy of the configuration with the S3 parameters
+// provided at room creation.
+// In order to prevent recordings and credentials from being sent to arbitrary hosts,
+// the endpoint can be overridden only with an allowed one and together with credentials,
+// and TLS verification can't be disabled.
+func (c roomRecordConf) withS3Overrides(o *apiWebRTCRoomS3) (roomRecordConf, error) {
+	if o == nil {
+		return c, nil
+	}
+
+	if o.SkipTLSVerify != nil {
+		return roomRecordConf{}, fmt.Errorf("'skipTLSVerify' can't be set for a single room")
+	}
+
+	if (o.AccessKeyID != nil) != (o.SecretKey != nil) {
+		return roomRecordConf{}, fmt.Errorf("'accessKeyID' and 'secretKey' must be set together")
+	}
+
+	if o.Endpoint != nil {
+		allowed := false
+		for _, e := range c.s3AllowedEndpoints {
+			if e == *o.Endpoint {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return roomRecordConf{}, fmt.Errorf("endpoint '%s' is not allowed", *o.Endpoint)
+		}
+
+		if o.AccessKeyID == nil {
+			return roomRecordConf{}, fmt.Errorf("'accessKeyID' and 'secretKey' are required when 'endpoint' is set")
+		}
+
+		c.s3Endpoint = *o.Endpoint
+		c.s3SkipTLSVerify = false
+	}
+
+	if o.Bucket != nil {
+		c.bucket = *o.Bucket
+	}
+	if o.Region != nil {
+		c.region = *o.Region
+	}
+	if o.AccessKeyID != nil {
+		c.s3AccessKeyID = *o.AccessKeyID
+		c.s3SecretKey = *o.SecretKey
+	}
+	if o.PathStyle != nil {
+		c.s3PathStyle = *o.PathStyle
+	}
+
+	return c, nil
+}
+
 type s3Client struct {
-	S3Client *s3.Client
+	S3Client    *s3.Client
+	SSE         conf.RecordSSE
+	SSEKMSKeyID string
 }
 
-// CreateBucket creates a bucket with the specified name in the specified Region.
-func (c *s3Client) CreateBucket(name string, region string) error {
-	_, err := c.S3Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
+func newS3Client(ctx context.Context, rc roomRecordConf) (*s3Client, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(rc.region),
+	}
+
+	if rc.s3AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(rc.s3AccessKeyID, rc.s3SecretKey, "")))
+	}
+
+	if rc.s3SkipTLSVerify {
+		opts = append(opts, config.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}))
+	}
+
+	sdkConfig, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(sdkConfig, func(o *s3.Options) {
+		if rc.s3Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(rc.s3Endpoint)
+		}
+		o.UsePathStyle = rc.s3PathStyle
+	})
+
+	return &s3Client{
+		S3Client:    client,
+		SSE:         rc.sse,
+		SSEKMSKeyID: rc.sseKMSKeyID,
+	}, nil
+}
+
+// s3CreateBucketInput returns the parameters needed to create a bucket.
+// us-east-1 is the default region of S3 and can't be used as location constraint.
+func s3CreateBucketInput(name string, region string) *s3.CreateBucketInput {
+	input := &s3.CreateBucketInput{
 		Bucket: aws.String(name),
-		CreateBucketConfiguration: &types.CreateBucketConfiguration{
+	}
+
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
 			LocationConstraint: types.BucketLocationConstraint(region),
-		},
-	})
-	if err != nil {
-			log.Printf("Couldn't create bucket %v in Region %v. Here's why: %v\n",
-			name, region, err)
-			return err
+		}
+	}
+
+	return input
 }
-return nil	
+
+// CreateBucket creates a bucket with the specified name in the specified Region.
+// It doesn't return an error if the bucket already exists and is owned by the caller.
+func (c *s3Client) CreateBucket(name string, region string) error {
+	_, err := c.S3Client.CreateBucket(context.TODO(), s3CreateBucketInput(name, region))
+	if err != nil {
+		var alreadyOwned *types.BucketAlreadyOwnedByYou
+		if errors.As(err, &alreadyOwned) {
+			return nil
+		}
+		return err
+	}
+	return nil
 }
 
-func (c *s3Client) UploadObject(bucketName string, objectKey string, file *os.File) error {
+// UploadObject uploads a file. The SHA-256 of the file is stored in the object metadata;
+// if checksum is empty, it is computed by reading the file.
+// Large files are uploaded in parts, and their upload is resumed if it was interrupted.
+func (c *s3Client) UploadObject(bucketName string, objectKey string, file *os.File, checksum string) error {
+	if checksum == "" {
+		var err error
+		checksum, err = fileChecksum(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() > webrtcMultipartPartSize {
+		return uploadMultipart(context.TODO(), c.S3Client,
+			c.createMultipartUploadInput(bucketName, objectKey, checksum), file, fi.Size(), checksum)
+	}
+
 	uploader := manager.NewUploader(c.S3Client)
-	_, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectKey),
-		Body:   file,
-	})
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(objectKey),
+		Body:        file,
+		ContentType: aws.String(recordingContentType(objectKey)),
+		Metadata:    map[string]string{recordChecksumMetadataKey: checksum},
+	}
+
+	switch c.SSE {
+	case conf.RecordSSES3:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+
+	case conf.RecordSSEKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if c.SSEKMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(c.SSEKMSKeyID)
+		}
+	}
+
+	_, err = uploader.Upload(context.TODO(), input)
 	if err != nil {
 		log.Printf("Couldn't upload large object to %v:%v. Here's why: %v\n",
 			bucketName, objectKey, err)
@@ -51,24 +284,281 @@ func (c *s3Client) UploadObject(bucketName string, objectKey string, file *os.Fi
 }
 
 type Room struct {
+	parent           logger.Writer
 	uuid             uuid.UUID
-	clubName string
-	eventName string
+	created          time.Time
+	clubName         string
+	eventName        string
+	tenant           string
+	recordDir        string
+	recordConf       roomRecordConf
+	iceServers       []conf.WebRTCICEServer
 	recording        bool
-	s3Client         *s3Client
+	storage          recordStorage
+	events           *roomEventLog
+	chat             *roomChat
+	messages         *roomMessages
+	logs             *roomLogs
+	viewers          *roomViewers
+	analytics        *roomAnalytics
+	schedule         roomSchedule
+	scheduleStarted  bool
+	profile          string
+	codecs           conf.WebRTCCodecs
+	maxParticipants  int
+	e2ee             bool
+	metadataFormat   string
+	metadataValidate bool
+	metadataExport   string
+	llhls            bool
+	recordersMutex   sync.Mutex
+	recorders        []*roomTrackRecorder
+	metadataFiles    []*roomManifestFile
+	paused           bool
+	pauseStart       time.Time
+	recordStopped    bool
+	gaps             []*roomManifestGap
+	restreamers      []*roomRestreamer
+	program          *roomProgram
+	mix              *roomMix
+	geo              *roomGeo
+	geoPaths         map[string]struct{}
+	quota            roomQuota
 	streamers        map[string]*streamer
 	sessions         map[*webRTCSession]struct{}
 	sessionsBySecret map[uuid.UUID]*webRTCSession
+	publishKeys      map[string]string
+	accessTokens     map[string]*roomAccessToken
+	rehearsalOf      uuid.UUID
+	uploads          *sync.WaitGroup
+	tasks            sync.WaitGroup
+	state            *roomState
 }
 type File struct {
 	Filename string
-	os.File
+	io.WriteCloser
+	checksum *checksumWriter
+}
+
+// Checksum returns the SHA-256 of the data written to disk.
+func (f *File) Checksum() string {
+	return f.checksum.checksum()
 }
+
 type streamer struct {
 	id      string
 	session *webRTCSession
 }
 
+// Log is the main logging function.
+func (r *Room) Log(level logger.Level, format string, args ...interface{}) {
+	r.logs.add(level, "", format, args)
+	r.parent.Log(level, "[room %s] "+format, append([]interface{}{r.uuid}, args...)...)
+}
+
+func (r *Room) dir() string {
+	return r.recordDir
+}
+
+// createFile creates a file in which recorded data is written.
+// If an encryption key is set, data is encrypted and the file name is changed accordingly.
+func (r *Room) createFile(filename string) (*File, error) {
+	if r.recordConf.encryptionKey != nil {
+		filename += webrtcEncryptedFileExtension
+	}
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.state.addFile(filename)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cw := newChecksumWriter(f)
+
+	if r.recordConf.encryptionKey == nil {
+		return &File{Filename: filename, WriteCloser: cw, checksum: cw}, nil
+	}
+
+	w, err := chunkcrypt.NewWriter(cw, r.recordConf.encryptionKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &File{Filename: filename, WriteCloser: w, checksum: cw}, nil
+}
+
+func (r *Room) bucketName() string {
+	if r.recordConf.bucket != "" {
+		return r.recordConf.bucket
+	}
+	return recordkey.BucketName(r.clubName)
+}
+
+// upload saves a file to the storage of recordings and deletes it from disk.
+func (r *Room) upload(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filename)
+	defer os.Remove(multipartStateFileName(filename))
+	defer file.Close()
+
+	objectKey := recordkey.ObjectKey(r.eventName, r.uuid, filepath.Base(filename))
+	return r.storage.UploadObject(r.bucketName(), objectKey, file, r.recorderChecksum(filename))
+}
+
+func (r *Room) uploadAndLog(filename string) {
+	err := r.upload(filename)
+	if err != nil {
+		r.Log(logger.Warn, "unable to upload '%s': %v", filename, err)
+	}
+}
+
+// inBackground runs a function in a goroutine that is waited by the manager when draining,
+// and before removing the state of the room.
+func (r *Room) inBackground(cb func()) {
+	if r.uploads != nil {
+		r.uploads.Add(1)
+	}
+	r.tasks.Add(1)
+
+	go func() {
+		defer func() {
+			r.tasks.Done()
+			if r.uploads != nil {
+				r.uploads.Done()
+			}
+		}()
+		cb()
+	}()
+}
+
+func (r *Room) uploadInBackground(filename string) {
+	r.inBackground(func() {
+		r.uploadAndLog(filename)
+	})
+}
+
+// recorderChecksum returns the SHA-256 computed while writing a recording,
+// or an empty string if it is not available.
+func (r *Room) recorderChecksum(filename string) string {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+
+	for _, rec := range r.recorders {
+		if c := rec.checksum(filename); c != "" {
+			return c
+		}
+	}
+	return ""
+}
+
+func (r *Room) addRecorder(rec *roomTrackRecorder) {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+	rec.setPaused(r.paused)
+	r.recorders = append(r.recorders, rec)
+}
+
+// resumeRecorder returns the recorder of a track of a session that is being resumed, if any.
+func (r *Room) resumeRecorder(session uuid.UUID, track *webRTCIncomingTrack) *roomTrackRecorder {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+
+	codec := webrtcCodecOfFormat(track.format)
+
+	for _, rec := range r.recorders {
+		if rec.session == session && rec.codec == codec && rec.reattach() {
+			return rec
+		}
+	}
+
+	return nil
+}
+
+// recordingMetadata checks whether metadata must be written.
+func (r *Room) recordingMetadata() bool {
+	if !r.recordsTrack(roomManifestFileTypeMetadata) {
+		return false
+	}
+
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+	return r.recording && !r.paused && !r.recordStopped
+}
+
+// recordsTrack checks whether tracks of the given type are recorded in the room.
+// Media of rooms with end-to-end encryption can't be decrypted, therefore it is not recorded.
+func (r *Room) recordsTrack(typ roomManifestFileType) bool {
+	if r.rehearsal() {
+		return false
+	}
+	if r.e2ee && typ != roomManifestFileTypeMetadata {
+		return false
+	}
+	return r.recordConf.tracks == nil || r.recordConf.tracks.Contains(string(typ))
+}
+
+func (r *Room) addMetadataFile(filename string, sx *webRTCSession) {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+	r.metadataFiles = append(r.metadataFiles, &roomManifestFile{
+		File:          filepath.Base(filename),
+		Type:          roomManifestFileTypeMetadata,
+		Format:        r.metadataFormat,
+		Session:       sx.uuid,
+		Participant:   roomParticipant(sx),
+		ParticipantID: sx.req.participantID,
+		StartOffset:   time.Since(r.created).Seconds(),
+	})
+}
+
+// writeManifest writes a manifest of all recorded files and returns its path.
+func (r *Room) writeManifest() (string, error) {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+
+	manifest := &roomManifest{
+		Room:  r.uuid,
+		Club:  r.clubName,
+		Event: r.eventName,
+		Start: r.created,
+		Files: []*roomManifestFile{},
+	}
+
+	for _, rec := range r.recorders {
+		if f := rec.manifestFile(r.created); f != nil {
+			manifest.Files = append(manifest.Files, f)
+		}
+	}
+
+	manifest.Files = append(manifest.Files, r.metadataFiles...)
+
+	manifest.Gaps = append(manifest.Gaps, r.gaps...)
+	if r.paused {
+		manifest.Gaps = append(manifest.Gaps, r.currentGap())
+	}
+
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].StartOffset < manifest.Files[j].StartOffset
+	})
+
+	filename := filepath.Join(r.dir(), webrtcRoomManifestFileName)
+	err := writeRoomManifest(filename, manifest)
+	if err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
+
 func (r *Room) join(streamID string) error {
 	s := &streamer{
 		id: streamID,
@@ -77,52 +567,174 @@ func (r *Room) join(streamID string) error {
 	return nil
 }
 
+// switchProgram selects the path of the room that is forwarded to the program.
+func (r *Room) switchProgram(source string) error {
+	if r.program == nil {
+		return fmt.Errorf("room has no program")
+	}
+
+	if _, ok := r.streamers[source]; !ok {
+		return fmt.Errorf("path '%s' doesn't belong to the room", source)
+	}
+
+	r.program.setSource(source)
+	r.events.write(roomEvent{Type: roomEventProgramSwitch, Path: source})
+
+	return nil
+}
+
 func (r *Room) apiItem() *apiWebRTCRoom {
 	var paths []string
 	for path := range r.streamers {
 		paths = append(paths, path)
 	}
 
+	sort.Strings(paths)
+
+	r.recordersMutex.Lock()
+	paused := r.paused
+	r.recordersMutex.Unlock()
+
+	restream := []*apiWebRTCRoomRestreamTarget{}
+	for _, rs := range r.restreamers {
+		restream = append(restream, rs.apiItem())
+	}
+
 	return &apiWebRTCRoom{
-		ID:    r.uuid,
-		Paths: paths,
+		ID:              r.uuid,
+		Created:         r.created,
+		Paths:           paths,
+		Recording:       r.recording,
+		RecordingPaused: paused,
+		EgressBytes:     r.quota.egress,
+		RecordedBytes:   r.quota.recordSize,
+		Restream:        restream,
+		StartTime:       timePtrIfNotZero(r.schedule.start),
+		EndTime:         timePtrIfNotZero(r.schedule.end),
+		Profile:         r.profile,
+		Tenant:          r.tenant,
+		RehearsalOf: func() *uuid.UUID {
+			if !r.rehearsal() {
+				return nil
+			}
+			v := r.rehearsalOf
+			return &v
+		}(),
+		Program: func() *apiWebRTCRoomProgram {
+			if r.program == nil {
+				return nil
+			}
+			return r.program.apiItem()
+		}(),
+		Mix: func() *apiWebRTCRoomMix {
+			if r.mix == nil {
+				return nil
+			}
+			return r.mix.apiItem()
+		}(),
+		Geo: func() *apiWebRTCRoomGeo {
+			if r.geo == nil {
+				return nil
+			}
+			return r.geo.apiItem()
+		}(),
+	}
+}
+
+// sampleViewers stores the current reader count of each path of the room.
+func (r *Room) sampleViewers(now time.Time) {
+	readers := make(map[string]int)
+
+	for path := range r.streamers {
+		readers[path] = 0
 	}
+
+	for sx := range r.sessions {
+		if !sx.req.publish {
+			readers[sx.req.pathName]++
+		}
+	}
+
+	r.viewers.add(&roomViewersSample{
+		time:    now,
+		readers: readers,
+	})
 }
 
 func (r *Room) record() error {
-	bucketName := strings.ReplaceAll(strings.TrimSpace(strings.ToLower(r.clubName)), " ", "-")
-	err := r.s3Client.CreateBucket(bucketName, "eu-west-3")
+	if r.rehearsal() {
+		return errRoomRehearsal
+	}
+
+	// buckets chosen by rules or at room creation are provisioned in advance
+	if r.recordConf.bucket == "" {
+		err := r.storage.CreateBucket(r.bucketName(), r.recordConf.region)
+		if err != nil {
+			r.Log(logger.Warn, "unable to create bucket '%s': %v", r.bucketName(), err)
+			r.events.writeError(err)
+		}
+	}
+
+	err := r.state.setRecording()
 	if err != nil {
-		//HANDLE Error !!!!
-		fmt.Println(err) 
+		r.Log(logger.Warn, "unable to write state: %v", err)
 	}
+
 	r.recording = true
+	r.events.write(roomEvent{Type: roomEventRecordStart})
+	return nil
+}
+
+func (r *Room) currentGap() *roomManifestGap {
+	return &roomManifestGap{
+		StartOffset: r.pauseStart.Sub(r.created).Seconds(),
+		Duration:    time.Since(r.pauseStart).Seconds(),
+	}
+}
+
+// setRecordingPaused pauses or resumes recording. Files are kept open
+// and the pause is reported in the manifest.
+func (r *Room) setRecordingPaused(paused bool) error {
+	if !r.recording {
+		return errAPIBadRequest{fmt.Errorf("room is not recording")}
+	}
+
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+
+	if paused == r.paused {
+		if paused {
+			return errAPIBadRequest{fmt.Errorf("recording is already paused")}
+		}
+		return errAPIBadRequest{fmt.Errorf("recording is not paused")}
+	}
+
+	r.paused = paused
+
+	for _, rec := range r.recorders {
+		rec.setPaused(paused)
+	}
+
+	if paused {
+		r.pauseStart = time.Now()
+		r.events.write(roomEvent{Type: roomEventRecordPause})
+	} else {
+		r.gaps = append(r.gaps, r.currentGap())
+		r.events.write(roomEvent{Type: roomEventRecordResume})
+	}
+
 	return nil
 }
 
 func (r *Room) cleanup() error {
+	r.sampleViewers(time.Now())
+
+	if r.recording {
+		r.events.write(roomEvent{Type: roomEventRecordStop})
+	}
+
 	for s := range r.sessions {
-		if len(s.writers) > 0 {
-			for fn, _ := range s.writers {
-				go func(filename string) {
-					// Open the file to upload
-					file, err := os.Open(filename)
-					if err != nil {
-						fmt.Println("Error opening file:", err)
-						return
-					}
-					defer file.Close()
-					//save file to S3
-
-					bucketName := strings.ReplaceAll(strings.TrimSpace(strings.ToLower(r.clubName)), " ", "-")
-					objectKey := fmt.Sprintf("%s/%s", r.eventName, filepath.Base(filename))
-					r.s3Client.UploadObject(bucketName, objectKey, file)
-
-					//delete file from disk
-					os.Remove(filename)
-				}(fn)
-			}
-		}
+		r.events.writeSession(roomEventLeave, s)
 		delete(r.sessions, s)
 		delete(r.sessionsBySecret, s.secret)
 		s.close()
@@ -130,5 +742,118 @@ func (r *Room) cleanup() error {
 	for k := range r.streamers {
 		delete(r.streamers, k)
 	}
+
+	for _, rs := range r.restreamers {
+		rs.stop()
+	}
+
+	if r.program != nil {
+		r.program.stop()
+	}
+
+	if r.mix != nil {
+		r.mix.close()
+	}
+
+	r.recordersMutex.Lock()
+	recorders := r.recorders
+	r.recordersMutex.Unlock()
+
+	var overlayRecorders []*roomTrackRecorder
+	var loudnessRecorders []*roomTrackRecorder
+
+	for _, rec := range recorders {
+		err := rec.close()
+		if err != nil {
+			r.Log(logger.Warn, "unable to close '%s': %v", rec.filename, err)
+		}
+
+		if !r.recording {
+			os.Remove(rec.filename)
+			continue
+		}
+
+		if r.recordConf.overlayCommand != "" && rec.fileType == roomManifestFileTypeVideo &&
+			rec.manifestFile(r.created) != nil {
+			overlayRecorders = append(overlayRecorders, rec)
+			continue
+		}
+
+		if r.recordConf.loudnessCommand != "" && rec.fileType == roomManifestFileTypeAudio &&
+			rec.manifestFile(r.created) != nil {
+			loudnessRecorders = append(loudnessRecorders, rec)
+			continue
+		}
+
+		r.uploadInBackground(rec.filename)
+	}
+
+	r.events.close()
+	r.chat.close()
+	r.closeMessages()
+
+	if r.recording {
+		// the manifest is written after overlays and loudness normalization,
+		// since they change file names
+		r.inBackground(func() {
+			for _, rec := range overlayRecorders {
+				err := r.applyOverlay(rec)
+				if err != nil {
+					r.Log(logger.Warn, "unable to apply overlay to '%s': %v", rec.filename, err)
+				}
+				r.uploadAndLog(rec.filename)
+			}
+
+			for _, rec := range loudnessRecorders {
+				err := r.applyLoudness(rec)
+				if err != nil {
+					r.Log(logger.Warn, "unable to process loudness of '%s': %v", rec.filename, err)
+				}
+				r.uploadAndLog(rec.filename)
+			}
+
+			syncFilename, err := r.writeSync()
+			if err != nil {
+				r.Log(logger.Warn, "unable to write sync: %v", err)
+			} else {
+				r.uploadAndLog(syncFilename)
+			}
+
+			manifestFilename, err := r.writeManifest()
+			if err != nil {
+				r.Log(logger.Warn, "unable to write manifest: %v", err)
+			} else {
+				r.uploadAndLog(manifestFilename)
+			}
+		})
+
+		r.uploadInBackground(r.events.filename)
+		r.uploadInBackground(r.chat.filename)
+
+		viewersFilename := roomViewersFileName(r.dir(), r.uuid)
+		err := r.viewers.writeCSV(viewersFilename)
+		if err != nil {
+			r.Log(logger.Warn, "unable to write viewers: %v", err)
+		} else {
+			r.uploadInBackground(viewersFilename)
+		}
+
+		analyticsFilename, err := r.writeAnalytics()
+		if err != nil {
+			r.Log(logger.Warn, "unable to write analytics: %v", err)
+		} else {
+			r.uploadInBackground(analyticsFilename)
+		}
+	} else {
+		os.Remove(r.events.filename)
+		os.Remove(r.chat.filename)
+	}
+
+	// the state is needed until all files are uploaded
+	go func() {
+		r.tasks.Wait()
+		r.state.remove()
+	}()
+
 	return nil
 }
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+const (
+	webrtcRoomAccessTokenSize            = 18
+	webrtcRoomAccessTokenDefaultDuration = 1 * time.Hour
+)
+
+// roomAccessToken is a one-time token that allows to read a path of the room
+// without the credentials of the path.
+type roomAccessToken struct {
+	pathName string
+	expiry   time.Time
+
+	// participant that owns the token, if any.
+	// It proves the identity of the participant, that is needed to read audio mixes.
+	participantID string
+
+	// session that is using the token.
+	session *webRTCSession
+}
+
+// mintAccessToken generates a one-time token that allows to read a path of the room until expiry.
+// Tokens are meant to be embedded into watch links, and are invalidated after
+// the first successful connection, in order to prevent links from being shared.
+func (r *Room) mintAccessToken(
+	pathName string,
+	participantID string,
+	duration time.Duration,
+	now time.Time,
+) (string, time.Time, error) {
+	err := conf.IsValidPathName(pathName)
+	if err != nil {
+		return "", time.Time{}, errAPIBadRequest{fmt.Errorf("invalid path: %w", err)}
+	}
+
+	if duration < 0 {
+		return "", time.Time{}, errAPIBadRequest{fmt.Errorf("duration can't be negative")}
+	}
+
+	if duration == 0 {
+		duration = webrtcRoomAccessTokenDefaultDuration
+	}
+
+	r.deleteExpiredAccessTokens(now)
+
+	var b [webrtcRoomAccessTokenSize]byte
+	_, err = rand.Read(b[:])
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b[:])
+	expiry := now.Add(duration)
+	r.accessTokens[token] = &roomAccessToken{
+		pathName:      pathName,
+		expiry:        expiry,
+		participantID: participantID,
+	}
+
+	return token, expiry, nil
+}
+
+func (r *Room) deleteExpiredAccessTokens(now time.Time) {
+	for token, t := range r.accessTokens {
+		if t.session == nil && !now.Before(t.expiry) {
+			delete(r.accessTokens, token)
+		}
+	}
+}
+
+// findAccessToken returns an access token.
+func (r *Room) findAccessToken(token string) (string, *roomAccessToken) {
+	var foundToken string
+	var found *roomAccessToken
+	for k, t := range r.accessTokens {
+		// all tokens are compared, in order not to leak timing information
+		if subtle.ConstantTimeCompare([]byte(k), []byte(token)) == 1 {
+			foundToken = k
+			found = t
+		}
+	}
+	return foundToken, found
+}
+
+// authenticateAccessToken checks the token provided by a session in the 'access' query parameter,
+// and returns the token when the session is allowed to read without further authentication.
+func (r *Room) authenticateAccessToken(req webRTCNewSessionReq, now time.Time) (string, error) {
+	query, err := url.ParseQuery(req.query)
+	if err != nil {
+		return "", err
+	}
+
+	token := query.Get("access")
+	if token == "" {
+		return "", nil
+	}
+
+	if req.publish {
+		return "", fmt.Errorf("access tokens can't be used to publish")
+	}
+
+	token, t := r.findAccessToken(token)
+	if t == nil {
+		return "", fmt.Errorf("invalid access token")
+	}
+
+	// the token allows to skip the authentication of a single path
+	if t.pathName != req.pathName {
+		return "", fmt.Errorf("access token is not valid for path '%s'", req.pathName)
+	}
+
+	if !now.Before(t.expiry) {
+		if t.session == nil {
+			delete(r.accessTokens, token)
+		}
+		return "", fmt.Errorf("access token is expired")
+	}
+
+	if t.session != nil {
+		return "", fmt.Errorf("access token has already been used")
+	}
+
+	return token, nil
+}
+
+// useAccessToken binds an access token to the session that is using it.
+func (r *Room) useAccessToken(token string, sx *webRTCSession) {
+	if t, ok := r.accessTokens[token]; ok {
+		t.session = sx
+	}
+}
+
+// releaseAccessToken is called when a session that was using an access token is closed.
+// The token is invalidated if the session was connected, otherwise it can be used again.
+func (r *Room) releaseAccessToken(token string, sx *webRTCSession) {
+	t, ok := r.accessTokens[token]
+	if !ok || t.session != sx {
+		return
+	}
+
+	if sx.hasConnected() {
+		delete(r.accessTokens, token)
+		return
+	}
+
+	t.session = nil
+}
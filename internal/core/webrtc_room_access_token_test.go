@@ -0,0 +1,92 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/webrtcpc"
+)
+
+func TestRoomAccessToken(t *testing.T) {
+	r := &Room{accessTokens: make(map[string]*roomAccessToken)}
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	_, _, err := r.mintAccessToken("venue/cam1", "", -time.Second, now)
+	require.Error(t, err)
+
+	_, _, err = r.mintAccessToken("", "", 0, now)
+	require.Error(t, err)
+
+	token, expiry, err := r.mintAccessToken("venue/cam1", "", 0, now)
+	require.NoError(t, err)
+	require.Len(t, token, 24)
+	require.Equal(t, now.Add(time.Hour), expiry)
+
+	req := webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "access=" + token,
+	}
+
+	// sessions without token are authenticated by paths
+	res, err := r.authenticateAccessToken(webRTCNewSessionReq{pathName: "venue/cam1"}, now)
+	require.NoError(t, err)
+	require.Equal(t, "", res)
+
+	_, err = r.authenticateAccessToken(webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "access=" + token,
+		publish:  true,
+	}, now)
+	require.EqualError(t, err, "access tokens can't be used to publish")
+
+	_, err = r.authenticateAccessToken(webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "access=wrong",
+	}, now)
+	require.EqualError(t, err, "invalid access token")
+
+	// the token can't be used to read other paths
+	_, err = r.authenticateAccessToken(webRTCNewSessionReq{
+		pathName: "unrelated",
+		query:    "access=" + token,
+	}, now)
+	require.EqualError(t, err, "access token is not valid for path 'unrelated'")
+
+	res, err = r.authenticateAccessToken(req, now)
+	require.NoError(t, err)
+	require.Equal(t, token, res)
+
+	// the token can't be used by other sessions while in use
+	sx := &webRTCSession{}
+	r.useAccessToken(token, sx)
+
+	_, err = r.authenticateAccessToken(req, now)
+	require.EqualError(t, err, "access token has already been used")
+
+	// the token can be used again when the connection fails
+	r.releaseAccessToken(token, sx)
+
+	res, err = r.authenticateAccessToken(req, now)
+	require.NoError(t, err)
+	require.Equal(t, token, res)
+
+	// the token is invalidated after a successful connection
+	sx = &webRTCSession{pc: &webrtcpc.PeerConnection{}}
+	r.useAccessToken(token, sx)
+	r.releaseAccessToken(token, sx)
+
+	_, err = r.authenticateAccessToken(req, now)
+	require.EqualError(t, err, "invalid access token")
+
+	token, _, err = r.mintAccessToken("venue/cam1", "", time.Minute, now)
+	require.NoError(t, err)
+
+	_, err = r.authenticateAccessToken(webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "access=" + token,
+	}, now.Add(time.Minute))
+	require.EqualError(t, err, "access token is expired")
+	require.Empty(t, r.accessTokens)
+}
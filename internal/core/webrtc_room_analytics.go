@@ -0,0 +1,187 @@
+package core
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	webrtcRoomAnalyticsFileSuffix = "-analytics.json"
+)
+
+// roomAnalyticsReader contains the statistics of a reader session.
+type roomAnalyticsReader struct {
+	Session     uuid.UUID  `json:"session"`
+	Participant string     `json:"participant"`
+	Path        string     `json:"path"`
+	Network     string     `json:"network"`
+	Joined      time.Time  `json:"joined"`
+	Left        *time.Time `json:"left"`
+	Duration    float64    `json:"duration"`
+}
+
+// roomAnalyticsNetwork contains the readers that come from the same network.
+type roomAnalyticsNetwork struct {
+	Network string `json:"network"`
+	Readers int    `json:"readers"`
+}
+
+// roomAnalyticsReport is the content of the analytics file of a room.
+type roomAnalyticsReport struct {
+	Room            uuid.UUID               `json:"room"`
+	Start           time.Time               `json:"start"`
+	End             time.Time               `json:"end"`
+	TotalReaders    int                     `json:"totalReaders"`
+	PeakConcurrency int                     `json:"peakConcurrency"`
+	PeakTime        *time.Time              `json:"peakTime"`
+	AverageDuration float64                 `json:"averageDuration"`
+	Networks        []*roomAnalyticsNetwork `json:"networks"`
+	Readers         []*roomAnalyticsReader  `json:"readers"`
+}
+
+// roomAnalyticsFileName returns the path of the analytics file of a room.
+func roomAnalyticsFileName(dir string, roomID uuid.UUID) string {
+	return filepath.Join(dir, roomID.String()+webrtcRoomAnalyticsFileSuffix)
+}
+
+// roomAnalyticsNetworkOf returns the network of an address, that is used as
+// a geographic hint without storing the full address of readers.
+// IPv4 addresses are truncated to /24, IPv6 addresses to /48.
+func roomAnalyticsNetworkOf(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		n := net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		return n.String()
+	}
+
+	n := net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}
+	return n.String()
+}
+
+// roomAnalytics keeps track of the readers that join and leave a room.
+type roomAnalytics struct {
+	readers  []*roomAnalyticsReader
+	active   map[*webRTCSession]*roomAnalyticsReader
+	peak     int
+	peakTime *time.Time
+}
+
+func newRoomAnalytics() *roomAnalytics {
+	return &roomAnalytics{
+		active: make(map[*webRTCSession]*roomAnalyticsReader),
+	}
+}
+
+func (a *roomAnalytics) readerJoined(sx *webRTCSession, now time.Time) {
+	r := &roomAnalyticsReader{
+		Session:     sx.uuid,
+		Participant: roomParticipant(sx),
+		Path:        sx.req.pathName,
+		Network:     roomAnalyticsNetworkOf(sx.req.remoteAddr),
+		Joined:      now,
+	}
+	a.readers = append(a.readers, r)
+	a.active[sx] = r
+
+	if len(a.active) > a.peak {
+		a.peak = len(a.active)
+		a.peakTime = &now
+	}
+}
+
+func (a *roomAnalytics) readerLeft(sx *webRTCSession, now time.Time) {
+	r, ok := a.active[sx]
+	if !ok {
+		return
+	}
+
+	r.Left = &now
+	r.Duration = now.Sub(r.Joined).Seconds()
+	delete(a.active, sx)
+}
+
+// report returns the statistics of the room. Readers that are still active
+// are considered as they left at the given time.
+func (a *roomAnalytics) report(roomID uuid.UUID, start time.Time, now time.Time) *roomAnalyticsReport {
+	rep := &roomAnalyticsReport{
+		Room:            roomID,
+		Start:           start,
+		End:             now,
+		TotalReaders:    len(a.readers),
+		PeakConcurrency: a.peak,
+		PeakTime:        a.peakTime,
+		Networks:        []*roomAnalyticsNetwork{},
+		Readers:         []*roomAnalyticsReader{},
+	}
+
+	networks := make(map[string]*roomAnalyticsNetwork)
+	var totalDuration float64
+
+	for _, r := range a.readers {
+		if r.Left == nil {
+			r = &roomAnalyticsReader{
+				Session:     r.Session,
+				Participant: r.Participant,
+				Path:        r.Path,
+				Network:     r.Network,
+				Joined:      r.Joined,
+				Duration:    now.Sub(r.Joined).Seconds(),
+			}
+		}
+
+		rep.Readers = append(rep.Readers, r)
+		totalDuration += r.Duration
+
+		if r.Network != "" {
+			n, ok := networks[r.Network]
+			if !ok {
+				n = &roomAnalyticsNetwork{Network: r.Network}
+				networks[r.Network] = n
+				rep.Networks = append(rep.Networks, n)
+			}
+			n.Readers++
+		}
+	}
+
+	if len(a.readers) != 0 {
+		rep.AverageDuration = totalDuration / float64(len(a.readers))
+	}
+
+	sort.SliceStable(rep.Networks, func(i, j int) bool {
+		return rep.Networks[i].Readers > rep.Networks[j].Readers
+	})
+
+	return rep
+}
+
+// writeAnalytics writes the analytics file of the room.
+func (r *Room) writeAnalytics() (string, error) {
+	filename := roomAnalyticsFileName(r.dir(), r.uuid)
+
+	enc, err := json.MarshalIndent(r.analytics.report(r.uuid, r.created, time.Now()), "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(filename, enc, 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	webrtcRoomChatFileSuffix = "-chat.jsonl"
+
+	// data channels with this label are used to chat with other participants of the room.
+	webrtcChatDataChannelLabel = "chat"
+)
+
+type roomChatMessage struct {
+	Time        time.Time `json:"time"`
+	Session     uuid.UUID `json:"session"`
+	Participant string    `json:"participant"`
+	Text        string    `json:"text"`
+}
+
+// roomChatChannel is the data channel of a participant.
+type roomChatChannel interface {
+	SendText(string) error
+}
+
+// roomChatFileName returns the path of the chat log of a room.
+func roomChatFileName(dir string, roomID uuid.UUID) string {
+	return filepath.Join(dir, roomID.String()+webrtcRoomChatFileSuffix)
+}
+
+// roomChat relays chat messages among participants of a room, keeps the most
+// recent ones in order to send them to participants that join later,
+// and writes all of them to a JSON Lines file.
+// History and channels are protected by a mutex, since messages are received
+// from the data channels of all participants.
+type roomChat struct {
+	filename    string
+	historySize int
+
+	mutex    sync.Mutex
+	f        *os.File
+	enc      *json.Encoder
+	history  []string
+	channels map[*webRTCSession]roomChatChannel
+}
+
+func newRoomChat(filename string, historySize int) (*roomChat, error) {
+	f, err := os.OpenFile(filename, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &roomChat{
+		filename:    filename,
+		historySize: historySize,
+		f:           f,
+		enc:         json.NewEncoder(f),
+		channels:    make(map[*webRTCSession]roomChatChannel),
+	}, nil
+}
+
+func (c *roomChat) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.f != nil {
+		c.f.Close()
+		c.f = nil
+	}
+
+	c.channels = make(map[*webRTCSession]roomChatChannel)
+}
+
+// addChannel sends the history to a participant, then relays new messages to it.
+func (c *roomChat) addChannel(sx *webRTCSession, ch roomChatChannel) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.f == nil {
+		return
+	}
+
+	for _, msg := range c.history {
+		ch.SendText(msg) //nolint:errcheck
+	}
+
+	c.channels[sx] = ch
+}
+
+func (c *roomChat) removeChannel(sx *webRTCSession) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.channels, sx)
+}
+
+func (c *roomChat) onMessage(sx *webRTCSession, text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.f == nil {
+		return
+	}
+
+	msg := roomChatMessage{
+		Time:        time.Now(),
+		Session:     sx.uuid,
+		Participant: roomParticipant(sx),
+		Text:        text,
+	}
+
+	c.enc.Encode(msg) //nolint:errcheck
+
+	enc, _ := json.Marshal(msg)
+
+	if c.historySize != 0 {
+		if len(c.history) == c.historySize {
+			c.history = c.history[1:]
+		}
+		c.history = append(c.history, string(enc))
+	}
+
+	for osx, ch := range c.channels {
+		if osx != sx {
+			ch.SendText(string(enc)) //nolint:errcheck
+		}
+	}
+}
+
+// onChatDataChannel handles the chat data channel of a session.
+func (s *webRTCSession) onChatDataChannel(room *Room, dc *webrtc.DataChannel) {
+	dc.OnOpen(func() {
+		room.chat.addChannel(s, dc)
+	})
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !s.limitDataChannelMessage(msg) {
+			return
+		}
+		room.chat.onMessage(s, string(msg.Data))
+	})
+
+	dc.OnClose(func() {
+		room.chat.removeChannel(s)
+	})
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	webrtcRoomEventsFileSuffix = "-events.jsonl"
+)
+
+type roomEventType string
+
+const (
+	roomEventJoin          roomEventType = "join"
+	roomEventLeave         roomEventType = "leave"
+	roomEventResume        roomEventType = "resume"
+	roomEventRecordStart   roomEventType = "record-start"
+	roomEventRecordStop    roomEventType = "record-stop"
+	roomEventRecordPause   roomEventType = "record-pause"
+	roomEventRecordResume  roomEventType = "record-resume"
+	roomEventError         roomEventType = "error"
+	roomEventTrackMute     roomEventType = "track-mute"
+	roomEventTrackUnmute   roomEventType = "track-unmute"
+	roomEventProgramSwitch roomEventType = "program-switch"
+	roomEventQuotaExceeded roomEventType = "quota-exceeded"
+	roomEventMigrate       roomEventType = "migrate"
+)
+
+type roomEvent struct {
+	Time    time.Time           `json:"time"`
+	Type    roomEventType       `json:"type"`
+	Session *uuid.UUID          `json:"session,omitempty"`
+	Path    string              `json:"path,omitempty"`
+	Publish bool                `json:"publish,omitempty"`
+	Track   string              `json:"track,omitempty"`
+	Message string              `json:"message,omitempty"`
+	Usage   *webRTCSessionUsage `json:"usage,omitempty"`
+}
+
+// roomEventLog writes the timeline of a room to a JSON Lines file.
+type roomEventLog struct {
+	filename string
+
+	mutex sync.Mutex
+	f     *os.File
+	enc   *json.Encoder
+}
+
+// roomEventLogFileName returns the path of the timeline of a room.
+// The room ID is part of the file name, since the recording directory
+// can be shared by multiple rooms.
+func roomEventLogFileName(dir string, roomID uuid.UUID) string {
+	return filepath.Join(dir, roomID.String()+webrtcRoomEventsFileSuffix)
+}
+
+func newRoomEventLog(filename string) (*roomEventLog, error) {
+	f, err := os.OpenFile(filename, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &roomEventLog{
+		filename: filename,
+		f:        f,
+		enc:      json.NewEncoder(f),
+	}, nil
+}
+
+func (l *roomEventLog) close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+}
+
+func (l *roomEventLog) write(e roomEvent) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.f == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	l.enc.Encode(e) //nolint:errcheck
+}
+
+func (l *roomEventLog) writeSession(typ roomEventType, sx *webRTCSession) {
+	e := roomEvent{
+		Type:    typ,
+		Session: &sx.uuid,
+		Path:    sx.currentPathName(),
+		Publish: sx.req.publish,
+	}
+
+	// the bandwidth used by the session is reported when it leaves the room,
+	// in order to allow reconciling egress costs.
+	if typ == roomEventLeave {
+		e.Usage = sx.bandwidthUsage()
+	}
+
+	l.write(e)
+}
+
+func roomTrackActiveEvent(sx *webRTCSession, track *webRTCIncomingTrack, active bool) roomEvent {
+	typ := roomEventTrackMute
+	if active {
+		typ = roomEventTrackUnmute
+	}
+
+	return roomEvent{
+		Time:    time.Now(),
+		Type:    typ,
+		Session: &sx.uuid,
+		Path:    sx.currentPathName(),
+		Track:   string(track.mediaType),
+	}
+}
+
+// onTrackActive is called when a track of a publisher gets muted or unmuted.
+// The event is written into the timeline of the room and sent to the data channels
+// of participants, in order to allow UIs to show camera-off indicators.
+func (r *Room) onTrackActive(sx *webRTCSession, track *webRTCIncomingTrack, active bool) {
+	e := roomTrackActiveEvent(sx, track, active)
+	r.events.write(e)
+	r.broadcastEvent(e)
+}
+
+func (l *roomEventLog) writeError(err error) {
+	l.write(roomEvent{
+		Type:    roomEventError,
+		Message: err.Error(),
+	})
+}
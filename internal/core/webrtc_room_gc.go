@@ -0,0 +1,143 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	webrtcRecordGCPeriod = 1 * time.Hour
+)
+
+// findRecordingGarbage returns the zero-byte files and the empty directories
+// under root that have not been modified within maxAge.
+// Directories that contain the state of a room are skipped, since the room
+// is still open or its files must be recovered.
+// Files are returned before the directories that contain them.
+func findRecordingGarbage(root string, maxAge time.Duration, now time.Time) ([]*apiRecordingGarbage, error) {
+	items := []*apiRecordingGarbage{}
+
+	_, err := findRecordingGarbageInDir(root, true, maxAge, now, &items)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return items, nil
+		}
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// findRecordingGarbageInDir returns whether dir is empty once garbage is removed.
+func findRecordingGarbageInDir(
+	dir string,
+	isRoot bool,
+	maxAge time.Duration,
+	now time.Time,
+	items *[]*apiRecordingGarbage,
+) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), webrtcRoomStateFileSuffix) {
+			return false, nil
+		}
+	}
+
+	remaining := 0
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		if entry.IsDir() {
+			empty, err := findRecordingGarbageInDir(path, false, maxAge, now, items)
+			if err != nil {
+				return false, err
+			}
+			if !empty {
+				remaining++
+			}
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			remaining++
+			continue
+		}
+
+		if !info.Mode().IsRegular() || info.Size() != 0 || now.Sub(info.ModTime()) < maxAge {
+			remaining++
+			continue
+		}
+
+		*items = append(*items, &apiRecordingGarbage{
+			Path:     path,
+			Type:     apiRecordingGarbageTypeFile,
+			Modified: info.ModTime(),
+		})
+	}
+
+	if isRoot || remaining != 0 {
+		return false, nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil || now.Sub(info.ModTime()) < maxAge {
+		return false, nil
+	}
+
+	*items = append(*items, &apiRecordingGarbage{
+		Path:     dir,
+		Type:     apiRecordingGarbageTypeDirectory,
+		Modified: info.ModTime(),
+	})
+
+	return true, nil
+}
+
+// removeRecordingGarbage removes garbage and returns the number of removed items.
+// Directories that are not empty anymore are not removed.
+func removeRecordingGarbage(items []*apiRecordingGarbage) int {
+	n := 0
+	for _, item := range items {
+		if os.Remove(item.Path) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// collectRecordingGarbage removes stale files and empty directories left by rooms.
+func (m *webRTCManager) collectRecordingGarbage() {
+	m.confMutex.RLock()
+	recordConf := m.recordConf
+	m.confMutex.RUnlock()
+
+	if recordConf.gcMaxAge == 0 {
+		return
+	}
+
+	root, err := roomStateRoot(recordConf.path)
+	if err != nil {
+		m.Log(logger.Warn, "unable to collect garbage: %v", err)
+		return
+	}
+
+	items, err := findRecordingGarbage(root, recordConf.gcMaxAge, time.Now())
+	if err != nil {
+		m.Log(logger.Warn, "unable to collect garbage: %v", err)
+		return
+	}
+
+	if n := removeRecordingGarbage(items); n != 0 {
+		m.Log(logger.Info, "removed %d stale files and empty directories", n)
+	}
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingGarbage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-gc")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	old := time.Now().Add(-48 * time.Hour)
+
+	mkdir := func(path string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, path), 0o755))
+	}
+
+	writeFile := func(path string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0o644))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, path), old, old))
+	}
+
+	// a failed session
+	mkdir("club1/event1/room1")
+	writeFile("club1/event1/room1/video.h264", "")
+	writeFile("club1/event1/room1/metadata.txt", "")
+
+	// a room with recordings
+	mkdir("club1/event2/room2")
+	writeFile("club1/event2/room2/audio.ogg", "audio")
+	writeFile("club1/event2/room2/empty.ogg", "")
+
+	// an open room
+	mkdir("club2/event3/room3")
+	writeFile("club2/event3/room3/video.h264", "")
+	writeFile("club2/event3/room3/room3"+webrtcRoomStateFileSuffix, "{}")
+
+	// a recent file
+	mkdir("club3")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "club3", "audio.ogg"), nil, 0o644))
+
+	for _, d := range []string{"club1/event1/room1", "club1/event1", "club1/event2/room2", "club1/event2", "club1"} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, d), old, old))
+	}
+
+	items, err := findRecordingGarbage(dir, 24*time.Hour, time.Now())
+	require.NoError(t, err)
+
+	var paths []string
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+
+	require.Equal(t, []string{
+		filepath.Join(dir, "club1/event1/room1/metadata.txt"),
+		filepath.Join(dir, "club1/event1/room1/video.h264"),
+		filepath.Join(dir, "club1/event1/room1"),
+		filepath.Join(dir, "club1/event1"),
+		filepath.Join(dir, "club1/event2/room2/empty.ogg"),
+	}, paths)
+	require.Equal(t, apiRecordingGarbageTypeDirectory, items[2].Type)
+
+	require.Equal(t, 5, removeRecordingGarbage(items))
+
+	_, err = os.Stat(filepath.Join(dir, "club1/event1"))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(dir, "club1/event2/room2/audio.ogg"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "club2/event3/room3/video.h264"))
+	require.NoError(t, err)
+
+	items, err = findRecordingGarbage(filepath.Join(dir, "missing"), 24*time.Hour, time.Now())
+	require.NoError(t, err)
+	require.Empty(t, items)
+}
@@ -0,0 +1,169 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// roomGeo restricts the IPs that can publish to or read a room,
+// for events whose broadcasting rights are geographically restricted.
+// Deny lists take precedence over allow lists. When an allow list is set,
+// only IPs that match one of the allow lists are accepted.
+type roomGeo struct {
+	allowCountries []string
+	denyCountries  []string
+	allowCIDRs     conf.IPsOrCIDRs
+	denyCIDRs      conf.IPsOrCIDRs
+}
+
+func newRoomGeo(req *apiWebRTCRoomGeo, db *geoIPDatabase) (*roomGeo, error) {
+	g := &roomGeo{
+		allowCIDRs: req.AllowCIDRs,
+		denyCIDRs:  req.DenyCIDRs,
+	}
+
+	for _, list := range []struct {
+		in  []string
+		out *[]string
+	}{
+		{req.AllowCountries, &g.allowCountries},
+		{req.DenyCountries, &g.denyCountries},
+	} {
+		for _, c := range list.in {
+			if len(c) != 2 {
+				return nil, fmt.Errorf("invalid country code '%s'", c)
+			}
+			*list.out = append(*list.out, strings.ToUpper(c))
+		}
+	}
+
+	if (g.allowCountries != nil || g.denyCountries != nil) && db == nil {
+		return nil, fmt.Errorf("restrictions by country require webrtcGeoIPDatabase")
+	}
+
+	if g.allowCountries == nil && g.denyCountries == nil && g.allowCIDRs == nil && g.denyCIDRs == nil {
+		return nil, nil
+	}
+
+	return g, nil
+}
+
+func roomGeoContains(countries []string, country string) bool {
+	for _, c := range countries {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks whether an IP can publish to or read the room.
+func (g *roomGeo) check(ip net.IP, db *geoIPDatabase) error {
+	if ip == nil {
+		return fmt.Errorf("unable to find the IP of the client")
+	}
+
+	country := ""
+	if db != nil {
+		country = db.country(ip)
+	}
+
+	if ipEqualOrInRange(ip, g.denyCIDRs) {
+		return fmt.Errorf("IP %v is not allowed in the room", ip)
+	}
+
+	if country != "" && roomGeoContains(g.denyCountries, country) {
+		return fmt.Errorf("country %s is not allowed in the room", country)
+	}
+
+	if g.allowCIDRs == nil && g.allowCountries == nil {
+		return nil
+	}
+
+	if ipEqualOrInRange(ip, g.allowCIDRs) {
+		return nil
+	}
+
+	if country != "" && roomGeoContains(g.allowCountries, country) {
+		return nil
+	}
+
+	if country == "" {
+		return fmt.Errorf("IP %v is not allowed in the room", ip)
+	}
+
+	return fmt.Errorf("country %s is not allowed in the room", country)
+}
+
+func (g *roomGeo) apiItem() *apiWebRTCRoomGeo {
+	return &apiWebRTCRoomGeo{
+		AllowCountries: g.allowCountries,
+		DenyCountries:  g.denyCountries,
+		AllowCIDRs:     g.allowCIDRs,
+		DenyCIDRs:      g.denyCIDRs,
+	}
+}
+
+// streamPaths returns the paths that contain streams of the room.
+func (r *Room) streamPaths() []string {
+	var ret []string
+	for pathName := range r.streamers {
+		ret = append(ret, pathName)
+	}
+	if r.program != nil {
+		ret = append(ret, r.program.pathName)
+	}
+	if r.mix != nil {
+		ret = append(ret, r.mix.pathName)
+	}
+	return ret
+}
+
+// syncGeo applies the restrictions of a room to all its paths through pathManager,
+// in order to enforce them on every protocol that can read the room,
+// and removes them from paths that don't belong to the room anymore.
+func (m *webRTCManager) syncGeo(room *Room) {
+	paths := make(map[string]struct{})
+	if room.geo != nil {
+		for _, pathName := range room.streamPaths() {
+			paths[pathName] = struct{}{}
+		}
+	}
+
+	for pathName := range room.geoPaths {
+		if _, ok := paths[pathName]; !ok {
+			m.pathManager.setRoomGeo(pathName, nil, nil)
+		}
+	}
+
+	for pathName := range paths {
+		m.pathManager.setRoomGeo(pathName, room.geo, m.geoIP)
+	}
+
+	room.geoPaths = paths
+}
+
+// clearGeo removes the restrictions of a room that is being closed from its paths.
+func (m *webRTCManager) clearGeo(room *Room) {
+	for pathName := range room.geoPaths {
+		m.pathManager.setRoomGeo(pathName, nil, nil)
+	}
+	room.geoPaths = nil
+}
+
+// checkGeo checks the IP of a session against the restrictions of the room, if any.
+func (r *Room) checkGeo(remoteAddr string, db *geoIPDatabase) error {
+	if r.geo == nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	return r.geo.check(net.ParseIP(host), db)
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func TestGeoIPDatabase(t *testing.T) {
+	db, err := parseGeoIPDatabase([]byte("network,country_iso_code\n" +
+		"# comment\n" +
+		"2.16.0.0/13,FR\n" +
+		"81.2.69.0/24,gb\n" +
+		"2001:db8::/32,\"IT\"\n"))
+	require.NoError(t, err)
+
+	for _, ca := range []struct {
+		ip      string
+		country string
+	}{
+		{"2.16.0.1", "FR"},
+		{"2.23.255.255", "FR"},
+		{"2.24.0.0", ""},
+		{"81.2.69.142", "GB"},
+		{"81.2.70.1", ""},
+		{"2001:db8::1", "IT"},
+		{"1.1.1.1", ""},
+	} {
+		require.Equal(t, ca.country, db.country(net.ParseIP(ca.ip)), ca.ip)
+	}
+
+	_, err = parseGeoIPDatabase([]byte("2.16.0.0/13,FRA\n"))
+	require.EqualError(t, err, "line 1: invalid country code 'FRA'")
+
+	_, err = parseGeoIPDatabase([]byte("2.16.0.0/13,FR\nwrong,FR\n"))
+	require.EqualError(t, err, "line 2: invalid CIDR address: wrong")
+}
+
+func TestRoomGeo(t *testing.T) {
+	db, err := parseGeoIPDatabase([]byte("2.16.0.0/13,FR\n81.2.69.0/24,GB\n"))
+	require.NoError(t, err)
+
+	parse := func(s string) *apiWebRTCRoomGeo {
+		var req apiWebRTCRoomGeo
+		err := json.Unmarshal([]byte(s), &req)
+		require.NoError(t, err)
+		return &req
+	}
+
+	_, err = newRoomGeo(parse(`{"allowCountries":["FRA"]}`), db)
+	require.EqualError(t, err, "invalid country code 'FRA'")
+
+	_, err = newRoomGeo(parse(`{"allowCountries":["FR"]}`), nil)
+	require.EqualError(t, err, "restrictions by country require webrtcGeoIPDatabase")
+
+	g, err := newRoomGeo(parse(`{}`), db)
+	require.NoError(t, err)
+	require.Nil(t, g)
+
+	r := &Room{}
+	require.NoError(t, r.checkGeo("1.1.1.1:5000", db))
+
+	for _, ca := range []struct {
+		name   string
+		geo    string
+		addr   string
+		errStr string
+	}{
+		{
+			"allowed country",
+			`{"allowCountries":["fr"]}`,
+			"2.16.0.1:5000",
+			"",
+		},
+		{
+			"not allowed country",
+			`{"allowCountries":["FR"]}`,
+			"81.2.69.1:5000",
+			"country GB is not allowed in the room",
+		},
+		{
+			"unknown country",
+			`{"allowCountries":["FR"]}`,
+			"1.1.1.1:5000",
+			"IP 1.1.1.1 is not allowed in the room",
+		},
+		{
+			"allowed network",
+			`{"allowCountries":["FR"],"allowCIDRs":["1.1.1.0/24"]}`,
+			"1.1.1.1:5000",
+			"",
+		},
+		{
+			"denied country",
+			`{"denyCountries":["GB"]}`,
+			"81.2.69.1:5000",
+			"country GB is not allowed in the room",
+		},
+		{
+			"other country",
+			`{"denyCountries":["GB"]}`,
+			"1.1.1.1:5000",
+			"",
+		},
+		{
+			"denied network in allowed country",
+			`{"allowCountries":["FR"],"denyCIDRs":["2.16.0.0/24"]}`,
+			"2.16.0.1:5000",
+			"IP 2.16.0.1 is not allowed in the room",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var err error
+			r.geo, err = newRoomGeo(parse(ca.geo), db)
+			require.NoError(t, err)
+
+			err = r.checkGeo(ca.addr, db)
+			if ca.errStr != "" {
+				require.EqualError(t, err, ca.errStr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPathManagerRoomGeo(t *testing.T) {
+	db, err := parseGeoIPDatabase([]byte("2.16.0.0/13,FR\n81.2.69.0/24,GB\n"))
+	require.NoError(t, err)
+
+	geo, err := newRoomGeo(&apiWebRTCRoomGeo{AllowCountries: []string{"FR"}}, db)
+	require.NoError(t, err)
+
+	pm := &pathManager{
+		authLimiter: newAuthLimiter(0, 0, 0),
+		roomGeos: map[string]*pathManagerRoomGeo{
+			"room/cam1": {geo: geo, db: db},
+		},
+	}
+
+	for _, ca := range []struct {
+		name     string
+		pathName string
+		ip       string
+		proto    authProtocol
+		errStr   string
+	}{
+		{"allowed country", "room/cam1", "2.16.0.1", authProtocolHLS, ""},
+		{"not allowed country", "room/cam1", "81.2.69.1", authProtocolHLS, "country GB is not allowed in the room"},
+		{"other protocol", "room/cam1", "81.2.69.1", authProtocolRTSP, "country GB is not allowed in the room"},
+		{"loopback", "room/cam1", "127.0.0.1", authProtocolRTSP, ""},
+		{"path outside rooms", "other", "81.2.69.1", authProtocolHLS, ""},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			err := pm.authenticate(ca.pathName, &conf.PathConf{}, false, authCredentials{
+				ip:    net.ParseIP(ca.ip),
+				proto: ca.proto,
+			})
+			if ca.errStr != "" {
+				require.EqualError(t, err, ca.errStr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
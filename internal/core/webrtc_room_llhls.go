@@ -0,0 +1,24 @@
+package core
+
+// enableLLHLS serves a path of a room with low-latency HLS, when the room requires it,
+// in order to allow browsers that can't use WebRTC to read it with a latency of a few seconds.
+func (m *webRTCManager) enableLLHLS(room *Room, pathName string) {
+	if room.llhls {
+		m.pathManager.setHLSLowLatency(pathName, true)
+	}
+}
+
+// disableLLHLS restores the default HLS variant on the paths of a room that is being closed.
+func (m *webRTCManager) disableLLHLS(room *Room) {
+	if !room.llhls {
+		return
+	}
+
+	for pathName := range room.streamers {
+		m.pathManager.setHLSLowLatency(pathName, false)
+	}
+
+	if room.program != nil {
+		m.pathManager.setHLSLowLatency(room.program.pathName, false)
+	}
+}
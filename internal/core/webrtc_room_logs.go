@@ -0,0 +1,99 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+type roomLogEntry struct {
+	time    time.Time
+	level   logger.Level
+	session string
+	message string
+}
+
+// roomLogs keeps the most recent log lines of a room and of its sessions,
+// in order to allow support staff to see what happened during an event.
+type roomLogs struct {
+	size int
+
+	mutex   sync.Mutex
+	entries []*roomLogEntry
+	next    int
+}
+
+func newRoomLogs(size int) *roomLogs {
+	return &roomLogs{
+		size: size,
+	}
+}
+
+// add formats a log line and stores it. Fields are discarded.
+func (l *roomLogs) add(level logger.Level, session string, format string, args []interface{}) {
+	if l == nil || l.size == 0 {
+		return
+	}
+
+	var rest []interface{}
+	for _, arg := range args {
+		if _, ok := arg.(logger.Fields); !ok {
+			rest = append(rest, arg)
+		}
+	}
+
+	e := &roomLogEntry{
+		time:    time.Now(),
+		level:   level,
+		session: session,
+		message: fmt.Sprintf(format, rest...),
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.entries) < l.size {
+		l.entries = append(l.entries, e)
+		return
+	}
+
+	// the buffer is full, overwrite the oldest line
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % l.size
+}
+
+// all returns log lines sorted by date.
+func (l *roomLogs) all() []*roomLogEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ret := make([]*roomLogEntry, 0, len(l.entries))
+	ret = append(ret, l.entries[l.next:]...)
+	ret = append(ret, l.entries[:l.next]...)
+	return ret
+}
+
+// apiItems returns the log lines that are at least as severe as minLevel.
+func (l *roomLogs) apiItems(minLevel logger.Level) *apiWebRTCRoomLogs {
+	data := &apiWebRTCRoomLogs{
+		Items: []*apiWebRTCRoomLog{},
+	}
+
+	for _, e := range l.all() {
+		if e.level < minLevel {
+			continue
+		}
+
+		data.Items = append(data.Items, &apiWebRTCRoomLog{
+			Time:    e.time,
+			Level:   conf.LogLevel(e.level),
+			Session: e.session,
+			Message: e.message,
+		})
+	}
+
+	return data
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+func TestRoomLogs(t *testing.T) {
+	l := newRoomLogs(3)
+
+	l.add(logger.Info, "", "room created", nil)
+	l.add(logger.Warn, "abc", "track %d lost", []interface{}{1, logger.Fields{"event": "lost"}})
+	l.add(logger.Info, "abc", "closed", nil)
+	l.add(logger.Error, "def", "failed: %v", []interface{}{"timeout"})
+
+	data := l.apiItems(logger.Debug)
+	require.Len(t, data.Items, 3)
+	require.Equal(t, "track 1 lost", data.Items[0].Message)
+	require.Equal(t, "abc", data.Items[0].Session)
+	require.Equal(t, "closed", data.Items[1].Message)
+	require.Equal(t, "failed: timeout", data.Items[2].Message)
+
+	data = l.apiItems(logger.Warn)
+	require.Len(t, data.Items, 2)
+	require.Equal(t, "track 1 lost", data.Items[0].Message)
+	require.Equal(t, "failed: timeout", data.Items[1].Message)
+
+	var disabled *roomLogs
+	disabled.add(logger.Info, "", "ignored", nil)
+}
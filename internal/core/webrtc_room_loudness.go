@@ -0,0 +1,66 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	webrtcRecordLoudnessFileSuffix = "-normalized.ogg"
+)
+
+// the summary printed by the ebur128 filter of FFmpeg.
+var loudnessRegexp = regexp.MustCompile(`I:\s*(-?[0-9]+(?:\.[0-9]+)?) LUFS`)
+
+// parseIntegratedLoudness returns the last integrated loudness printed by a command.
+func parseIntegratedLoudness(output []byte) (float64, bool) {
+	matches := loudnessRegexp.FindAllSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+
+	v, err := strconv.ParseFloat(string(matches[len(matches)-1][1]), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// applyLoudness runs the loudness command on a recorded audio track.
+// The integrated loudness printed by the command is stored in the manifest.
+// If the command writes a normalized file, the original file is replaced by it.
+func (r *Room) applyLoudness(rec *roomTrackRecorder) error {
+	output := strings.TrimSuffix(rec.filename, ".ogg") + webrtcRecordLoudnessFileSuffix
+
+	env := roomOverlayEnv(r, rec, output)
+	env["MTX_LOUDNESS_TARGET"] = strconv.FormatFloat(r.recordConf.loudnessTarget, 'f', -1, 64)
+
+	var buf bytes.Buffer
+	err := runRecordCommand(r.recordConf.loudnessCommand, env, r.recordConf.overlayTimeout, &buf)
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if v, ok := parseIntegratedLoudness(buf.Bytes()); ok {
+		rec.loudness = &v
+	}
+
+	// normalization is optional
+	if _, err := os.Stat(output); err != nil {
+		return nil
+	}
+
+	os.Remove(rec.filename)
+	rec.filename = output
+	rec.file = nil
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	wrtcmedia "github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/h264writer"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+
+	"github.com/bluenviron/mediamtx/internal/recordkey"
+)
+
+const (
+	webrtcRoomManifestFileName = "manifest.json"
+)
+
+type roomManifestFileType string
+
+const (
+	roomManifestFileTypeAudio    roomManifestFileType = "audio"
+	roomManifestFileTypeVideo    roomManifestFileType = "video"
+	roomManifestFileTypeMetadata roomManifestFileType = "metadata"
+)
+
+// roomManifestFile describes a file recorded in a room.
+// Offsets and durations are expressed in seconds.
+type roomManifestFile struct {
+	File          string               `json:"file"`
+	Type          roomManifestFileType `json:"type"`
+	Codec         string               `json:"codec,omitempty"`
+	Format        string               `json:"format,omitempty"`
+	Session       uuid.UUID            `json:"session"`
+	Participant   string               `json:"participant"`
+	ParticipantID string               `json:"participantID,omitempty"`
+	StartOffset   float64              `json:"startOffset"`
+	Duration      float64              `json:"duration"`
+	Loudness      *float64             `json:"loudness,omitempty"`
+}
+
+// roomManifestGap is a period in which recording was paused.
+// Nothing received in this period is written to files.
+type roomManifestGap struct {
+	StartOffset float64 `json:"startOffset"`
+	Duration    float64 `json:"duration"`
+}
+
+// roomManifest lists all the files recorded in a room, in order to allow
+// external tools to align them.
+type roomManifest struct {
+	Room  uuid.UUID           `json:"room"`
+	Club  string              `json:"club"`
+	Event string              `json:"event"`
+	Start time.Time           `json:"start"`
+	Files []*roomManifestFile `json:"files"`
+	Gaps  []*roomManifestGap  `json:"gaps,omitempty"`
+}
+
+// roomParticipant returns the identifier of the participant that owns a session,
+// that is the authenticated user, if any, or the path used to join the room.
+func roomParticipant(sx *webRTCSession) string {
+	if sx.req.participantName != "" {
+		return sx.req.participantName
+	}
+	if sx.req.user != "" {
+		return sx.req.user
+	}
+	return sx.req.pathName
+}
+
+// roomFilePrefix returns the prefix of the names of files recorded from a session.
+// The name of the participant, when provided, allows to attribute files at a glance.
+func roomFilePrefix(sx *webRTCSession) string {
+	if sx.req.participantName != "" {
+		return recordkey.Sanitize(sx.req.participantName) + "-" + sx.uuid.String()
+	}
+	return sx.uuid.String()
+}
+
+// roomTrackRecorder writes an incoming track to disk and keeps track of
+// the time span of written packets.
+type roomTrackRecorder struct {
+	filename      string
+	fileType      roomManifestFileType
+	codec         string
+	session       uuid.UUID
+	participant   string
+	participantID string
+	clockRate     int
+	writer        wrtcmedia.Writer
+	file          *File
+
+	mutex        sync.Mutex
+	closed       bool
+	paused       bool
+	resumed      bool
+	reattached   bool
+	waitKeyFrame bool
+	tsOffset     uint32
+	lastTS       uint32
+	firstTS      uint32
+	first        time.Time
+	last         time.Time
+	reports      []roomSyncReport
+	slateCancel  func()
+	loudness     *float64
+}
+
+// newRoomTrackRecorder allocates a roomTrackRecorder.
+// It returns nil if the codec of the track can't be recorded
+// or if recording has been stopped by a quota.
+func newRoomTrackRecorder(
+	room *Room,
+	sx *webRTCSession,
+	track *webRTCIncomingTrack,
+) (*roomTrackRecorder, error) {
+	if room.recordingStopped() {
+		return nil, nil
+	}
+
+	r := &roomTrackRecorder{
+		codec:         webrtcCodecOfFormat(track.format),
+		session:       sx.uuid,
+		participant:   roomParticipant(sx),
+		participantID: sx.req.participantID,
+		clockRate:     track.format.ClockRate(),
+	}
+
+	var filename string
+
+	switch track.format.(type) {
+	case *formats.Opus:
+		filename = fmt.Sprintf("%s-%s.ogg", roomFilePrefix(sx), media.TypeAudio)
+		r.fileType = roomManifestFileTypeAudio
+
+	case *formats.H264:
+		filename = fmt.Sprintf("%s-%s.h264", roomFilePrefix(sx), media.TypeVideo)
+		r.fileType = roomManifestFileTypeVideo
+
+	case *formats.H265:
+		filename = fmt.Sprintf("%s-%s.h265", roomFilePrefix(sx), media.TypeVideo)
+		r.fileType = roomManifestFileTypeVideo
+
+	default:
+		return nil, nil
+	}
+
+	if !room.recordsTrack(r.fileType) {
+		return nil, nil
+	}
+
+	f, err := room.createFile(filepath.Join(room.dir(), filename))
+	if err != nil {
+		return nil, err
+	}
+
+	r.filename = f.Filename
+	r.file = f
+
+	switch track.format.(type) {
+	case *formats.Opus:
+		r.writer, err = oggwriter.NewWith(f, 48000, 2)
+
+	case *formats.H265:
+		r.writer, err = newWebRTCH265Writer(f)
+
+	default:
+		r.writer = h264writer.NewWith(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// h264PayloadIsKeyFrame checks whether a RTP/H264 payload starts a key frame,
+// with the same criteria used by h264writer.
+func h264PayloadIsKeyFrame(payload []byte) bool {
+	const (
+		typeSTAPA = 24
+		typeSPS   = 7
+	)
+
+	if len(payload) < 4 {
+		return false
+	}
+
+	switch payload[0] & 0x1F {
+	case typeSPS:
+		return true
+
+	case typeSTAPA:
+		// first NALU of the aggregation packet
+		return payload[3]&0x1F == typeSPS
+	}
+
+	return false
+}
+
+func (r *roomTrackRecorder) writeRTP(pkt *rtp.Packet) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed || r.paused {
+		return nil
+	}
+
+	if r.waitKeyFrame {
+		if r.codec == "h265" {
+			if !h265PayloadIsKeyFrame(pkt.Payload) {
+				return nil
+			}
+		} else if !h264PayloadIsKeyFrame(pkt.Payload) {
+			return nil
+		}
+		r.waitKeyFrame = false
+	}
+
+	// remove the pause from timestamps, in order to prevent it
+	// from appearing in the recording.
+	if r.resumed {
+		r.tsOffset = pkt.Timestamp - r.lastTS
+		r.resumed = false
+	}
+
+	if r.tsOffset != 0 {
+		clone := *pkt
+		clone.Timestamp -= r.tsOffset
+		pkt = &clone
+	}
+	r.lastTS = pkt.Timestamp
+
+	err := r.writer.WriteRTP(pkt)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if r.first.IsZero() {
+		r.first = now
+		r.firstTS = pkt.Timestamp
+	}
+	r.last = now
+
+	return nil
+}
+
+// setPaused pauses or resumes writing, without closing the file.
+// After a pause, video is resumed from a key frame.
+func (r *roomTrackRecorder) setPaused(paused bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if paused == r.paused {
+		return
+	}
+
+	r.paused = paused
+
+	if !paused && !r.first.IsZero() {
+		r.resumed = true
+		r.waitKeyFrame = (r.fileType == roomManifestFileTypeVideo)
+	}
+}
+
+// reattach prepares the recorder to receive packets from a resumed session,
+// whose timestamps are unrelated to the previous ones.
+// It returns false if the file has been closed.
+func (r *roomTrackRecorder) reattach() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return false
+	}
+
+	r.reattached = true
+	r.stopSlate()
+
+	if !r.first.IsZero() {
+		r.resumed = true
+		r.waitKeyFrame = (r.fileType == roomManifestFileTypeVideo)
+	}
+
+	return true
+}
+
+// close closes the file. Packets received after this are discarded.
+func (r *roomTrackRecorder) close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	r.closed = true
+	r.stopSlate()
+	return r.writer.Close()
+}
+
+// checksum returns the SHA-256 of the file, if it has been closed and has the given name.
+func (r *roomTrackRecorder) checksum(filename string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.closed || r.file == nil || r.filename != filename {
+		return ""
+	}
+	return r.file.Checksum()
+}
+
+// manifestFile returns the manifest entry of the track, or nil if nothing
+// has been recorded.
+func (r *roomTrackRecorder) manifestFile(start time.Time) *roomManifestFile {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.first.IsZero() {
+		return nil
+	}
+
+	return &roomManifestFile{
+		File:          filepath.Base(r.filename),
+		Type:          r.fileType,
+		Codec:         r.codec,
+		Session:       r.session,
+		Participant:   r.participant,
+		ParticipantID: r.participantID,
+		StartOffset:   r.first.Sub(start).Seconds(),
+		Duration:      r.last.Sub(r.first).Seconds(),
+		Loudness:      r.loudness,
+	}
+}
+
+func writeRoomManifest(filename string, manifest *roomManifest) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	webrtcRoomMessagesFileSuffix = "-messages.txt"
+)
+
+// roomMessages sends the messages pushed through the API to the data channels
+// of participants, and writes them into a metadata file of the room.
+// Channels are protected by a mutex, since they are added and removed by sessions
+// while messages are pushed through the API.
+type roomMessages struct {
+	mutex    sync.Mutex
+	channels map[*webRTCSession]roomChatChannel
+	file     *File
+}
+
+func newRoomMessages() *roomMessages {
+	return &roomMessages{
+		channels: make(map[*webRTCSession]roomChatChannel),
+	}
+}
+
+func (m *roomMessages) addChannel(sx *webRTCSession, ch roomChatChannel) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.channels[sx] = ch
+}
+
+func (m *roomMessages) removeChannel(sx *webRTCSession) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.channels, sx)
+}
+
+// close closes the metadata file and returns its path, or an empty string
+// if no message has been recorded.
+func (m *roomMessages) close() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.channels = make(map[*webRTCSession]roomChatChannel)
+
+	if m.file == nil {
+		return ""
+	}
+
+	m.file.Close()
+	filename := m.file.Filename
+	m.file = nil
+	return filename
+}
+
+// sendMessage sends a message to the data channels of all participants and,
+// if metadata is being recorded, writes it into the metadata file of the room.
+func (r *Room) sendMessage(data string) error {
+	m := r.messages
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, ch := range m.channels {
+		ch.SendText(data) //nolint:errcheck
+	}
+
+	if !r.recordingMetadata() {
+		return nil
+	}
+
+	if m.file == nil {
+		f, err := r.createFile(filepath.Join(r.dir(), r.uuid.String()+webrtcRoomMessagesFileSuffix))
+		if err != nil {
+			return err
+		}
+		m.file = f
+
+		r.recordersMutex.Lock()
+		r.metadataFiles = append(r.metadataFiles, &roomManifestFile{
+			File:        filepath.Base(f.Filename),
+			Type:        roomManifestFileTypeMetadata,
+			Session:     uuid.Nil,
+			StartOffset: time.Since(r.created).Seconds(),
+		})
+		r.recordersMutex.Unlock()
+	}
+
+	_, err := io.WriteString(m.file, data+"\n")
+	return err
+}
+
+// broadcastEvent sends an event of the room, encoded in JSON, to the data channels
+// of all participants. Unlike messages pushed through the API, events are not
+// written into the metadata file, since they are already in the timeline of the room.
+func (r *Room) broadcastEvent(e roomEvent) {
+	byts, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	m := r.messages
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, ch := range m.channels {
+		ch.SendText(string(byts)) //nolint:errcheck
+	}
+}
+
+// closeMessages closes the metadata file of messages, then uploads it or removes it.
+func (r *Room) closeMessages() {
+	filename := r.messages.close()
+	if filename == "" {
+		return
+	}
+
+	if r.recording {
+		r.uploadInBackground(filename)
+	} else {
+		os.Remove(filename)
+	}
+}
+
+// onMessagesDataChannel allows a data channel of a reader to receive messages pushed through the API.
+func (s *webRTCSession) onMessagesDataChannel(room *Room, dc *webrtc.DataChannel) {
+	dc.OnOpen(func() {
+		room.messages.addChannel(s, dc)
+	})
+
+	dc.OnClose(func() {
+		room.messages.removeChannel(s)
+	})
+}
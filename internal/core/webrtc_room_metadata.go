@@ -0,0 +1,139 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// roomMetadataFormat is the format of the data channel messages of a room.
+// Messages of binary formats are written with a length prefix,
+// the others are written one per line.
+type roomMetadataFormat struct {
+	extension   string
+	contentType string
+	binary      bool
+	validate    func([]byte) error
+}
+
+var roomMetadataFormats = map[string]roomMetadataFormat{
+	"text": {
+		extension:   ".txt",
+		contentType: "text/plain",
+		validate:    func([]byte) error { return nil },
+	},
+	"json": {
+		extension:   ".jsonl",
+		contentType: "application/x-ndjson",
+		validate: func(byts []byte) error {
+			if !json.Valid(byts) {
+				return fmt.Errorf("invalid JSON")
+			}
+			return nil
+		},
+	},
+	"csv": {
+		extension:   ".csv",
+		contentType: "text/csv",
+		validate: func(byts []byte) error {
+			r := csv.NewReader(bytes.NewReader(byts))
+			records, err := r.ReadAll()
+			if err != nil {
+				return err
+			}
+			if len(records) != 1 {
+				return fmt.Errorf("a message must contain exactly one CSV record")
+			}
+			return nil
+		},
+	},
+	"protobuf": {
+		extension:   ".pb",
+		contentType: "application/x-protobuf",
+		binary:      true,
+		validate:    func([]byte) error { return nil },
+	},
+	"binary": {
+		extension:   ".bin",
+		contentType: "application/octet-stream",
+		binary:      true,
+		validate:    func([]byte) error { return nil },
+	},
+}
+
+// encode encodes a data channel message into a record of a metadata file.
+// In binary formats, a record is made of the size of the message,
+// as a 32-bit big-endian integer, followed by the message.
+// In the other formats, a record is a line; binary messages are encoded in base64,
+// since they may contain newlines.
+func (f roomMetadataFormat) encode(byts []byte, isString bool) []byte {
+	if f.binary {
+		buf := make([]byte, 4+len(byts))
+		binary.BigEndian.PutUint32(buf, uint32(len(byts)))
+		copy(buf[4:], byts)
+		return buf
+	}
+
+	if !isString {
+		buf := make([]byte, base64.StdEncoding.EncodedLen(len(byts))+1)
+		base64.StdEncoding.Encode(buf, byts)
+		buf[len(buf)-1] = '\n'
+		return buf
+	}
+
+	buf := make([]byte, len(byts)+1)
+	copy(buf, byts)
+	buf[len(buf)-1] = '\n'
+	return buf
+}
+
+// content types of recorded files, indexed by extension.
+var recordingContentTypes = map[string]string{
+	".ogg":    "audio/ogg",
+	".h264":   "video/h264",
+	".h265":   "video/h265",
+	".mp4":    "video/mp4",
+	".json":   "application/json",
+	".pcapng": "application/x-pcapng",
+	".vtt":    "text/vtt",
+	".srt":    "application/x-subrip",
+}
+
+// recordingContentType returns the content type of a recorded file.
+func recordingContentType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	if ct, ok := recordingContentTypes[ext]; ok {
+		return ct
+	}
+
+	for _, format := range roomMetadataFormats {
+		if format.extension == ext {
+			return format.contentType
+		}
+	}
+
+	return "application/octet-stream"
+}
+
+// metadataFormat returns the format of the data channel messages of the room.
+func (r *Room) metadataFileFormat() roomMetadataFormat {
+	if format, ok := roomMetadataFormats[r.metadataFormat]; ok {
+		return format
+	}
+	return roomMetadataFormats["text"]
+}
+
+// validateMetadata checks whether a data channel message complies with
+// the metadata format of the room. Messages are not checked unless the room requires it.
+func (r *Room) validateMetadata(byts []byte) error {
+	if !r.metadataValidate {
+		return nil
+	}
+	return r.metadataFileFormat().validate(byts)
+}
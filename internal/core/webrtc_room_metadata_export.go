@@ -0,0 +1,193 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	// duration of cues without end, that are not followed by other cues.
+	roomMetadataCueDefaultDuration = 5 * time.Second
+)
+
+// extensions of exported metadata files, indexed by export format.
+var roomMetadataExportExtensions = map[string]string{
+	"webvtt": ".vtt",
+	"srt":    ".srt",
+}
+
+// roomMetadataMessage is a metadata message that is exported as a cue.
+// Time and end are in seconds since the opening of the data channel;
+// when time is missing, the reception time of the message is used.
+type roomMetadataMessage struct {
+	Label *string  `json:"label"`
+	Time  *float64 `json:"time"`
+	End   *float64 `json:"end"`
+}
+
+type roomMetadataCue struct {
+	start time.Duration
+	end   time.Duration
+	label string
+}
+
+// roomMetadataExport collects the metadata messages of a session that carry a label,
+// in order to write them into a WebVTT or SRT file, that is uploaded
+// together with recordings and allows players to show score overlays and chapters.
+type roomMetadataExport struct {
+	format string
+	start  time.Time
+
+	mutex sync.Mutex
+	cues  []roomMetadataCue
+}
+
+func newRoomMetadataExport(format string, start time.Time) *roomMetadataExport {
+	return &roomMetadataExport{
+		format: format,
+		start:  start,
+	}
+}
+
+// add adds a metadata message. Messages without label are ignored.
+func (e *roomMetadataExport) add(byts []byte, now time.Time) {
+	var msg roomMetadataMessage
+	err := json.Unmarshal(byts, &msg)
+	if err != nil || msg.Label == nil || *msg.Label == "" {
+		return
+	}
+
+	cue := roomMetadataCue{
+		label: *msg.Label,
+	}
+
+	if msg.Time != nil {
+		cue.start = time.Duration(*msg.Time * float64(time.Second))
+	} else {
+		cue.start = now.Sub(e.start)
+	}
+
+	if msg.End != nil {
+		cue.end = time.Duration(*msg.End * float64(time.Second))
+	}
+
+	if cue.start < 0 || (cue.end != 0 && cue.end <= cue.start) {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.cues = append(e.cues, cue)
+}
+
+// sortedCues returns cues sorted by start, with the end filled
+// with the start of the next cue when it is missing.
+func (e *roomMetadataExport) sortedCues() []roomMetadataCue {
+	e.mutex.Lock()
+	cues := append([]roomMetadataCue(nil), e.cues...)
+	e.mutex.Unlock()
+
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].start < cues[j].start
+	})
+
+	for i := range cues {
+		if cues[i].end != 0 {
+			continue
+		}
+
+		if i < len(cues)-1 && cues[i+1].start > cues[i].start {
+			cues[i].end = cues[i+1].start
+		} else {
+			cues[i].end = cues[i].start + roomMetadataCueDefaultDuration
+		}
+	}
+
+	return cues
+}
+
+func roomMetadataTimestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d",
+		ms/3600000, (ms/60000)%60, (ms/1000)%60, sep, ms%1000)
+}
+
+// marshal encodes cues in the export format.
+func (e *roomMetadataExport) marshal() []byte {
+	var buf bytes.Buffer
+
+	if e.format == "webvtt" {
+		buf.WriteString("WEBVTT\n")
+	}
+
+	for i, cue := range e.sortedCues() {
+		// cues can't contain empty lines
+		label := strings.Join(strings.Fields(cue.label), " ")
+
+		if e.format == "webvtt" {
+			label = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(label)
+			fmt.Fprintf(&buf, "\n%s --> %s\n%s\n",
+				roomMetadataTimestamp(cue.start, "."), roomMetadataTimestamp(cue.end, "."), label)
+		} else {
+			if i != 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "%d\n%s --> %s\n%s\n", i+1,
+				roomMetadataTimestamp(cue.start, ","), roomMetadataTimestamp(cue.end, ","), label)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (e *roomMetadataExport) empty() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return len(e.cues) == 0
+}
+
+// exportMetadata writes the cues of a session into a file of the room, next to its metadata file,
+// and uploads it.
+func (r *Room) exportMetadata(e *roomMetadataExport, metadataFilename string, sx *webRTCSession) {
+	if e.empty() {
+		return
+	}
+
+	base := strings.TrimSuffix(metadataFilename, webrtcEncryptedFileExtension)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+
+	f, err := r.createFile(base + roomMetadataExportExtensions[e.format])
+	if err != nil {
+		r.Log(logger.Warn, "unable to export metadata: %v", err)
+		return
+	}
+
+	_, err = f.Write(e.marshal())
+	f.Close()
+	if err != nil {
+		r.Log(logger.Warn, "unable to export metadata: %v", err)
+		return
+	}
+
+	r.recordersMutex.Lock()
+	r.metadataFiles = append(r.metadataFiles, &roomManifestFile{
+		File:          filepath.Base(f.Filename),
+		Type:          roomManifestFileTypeMetadata,
+		Format:        e.format,
+		Session:       sx.uuid,
+		Participant:   roomParticipant(sx),
+		ParticipantID: sx.req.participantID,
+		StartOffset:   e.start.Sub(r.created).Seconds(),
+	})
+	r.recordersMutex.Unlock()
+
+	r.uploadAndLog(f.Filename)
+}
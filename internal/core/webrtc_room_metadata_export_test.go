@@ -0,0 +1,55 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomMetadataExport(t *testing.T) {
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, ca := range []struct {
+		format string
+		out    string
+	}{
+		{
+			"webvtt",
+			"WEBVTT\n" +
+				"\n" +
+				"00:00:01.500 --> 00:00:03.000\n" +
+				"Kick-off\n" +
+				"\n" +
+				"00:00:03.000 --> 00:00:10.000\n" +
+				"Goal &lt;home&gt; 1-0\n" +
+				"\n" +
+				"01:00:00.000 --> 01:00:05.000\n" +
+				"Half time\n",
+		},
+		{
+			"srt",
+			"1\n" +
+				"00:00:01,500 --> 00:00:03,000\n" +
+				"Kick-off\n" +
+				"\n" +
+				"2\n" +
+				"00:00:03,000 --> 00:00:10,000\n" +
+				"Goal <home> 1-0\n" +
+				"\n" +
+				"3\n" +
+				"01:00:00,000 --> 01:00:05,000\n" +
+				"Half time\n",
+		},
+	} {
+		t.Run(ca.format, func(t *testing.T) {
+			e := newRoomMetadataExport(ca.format, start)
+			e.add([]byte(`{"label":"Goal <home> 1-0","end":10}`), start.Add(3*time.Second))
+			e.add([]byte(`{"label":"Kick-off","time":1.5}`), start.Add(4*time.Second))
+			e.add([]byte(`{"score":"1-0"}`), start.Add(5*time.Second))
+			e.add([]byte(`not json`), start.Add(5*time.Second))
+			e.add([]byte(`{"label":"Half\ntime","time":3600}`), start.Add(6*time.Second))
+			require.Equal(t, ca.out, string(e.marshal()))
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomMetadataFormat(t *testing.T) {
+	r := &Room{}
+	require.Equal(t, ".txt", r.metadataFileFormat().extension)
+	require.NoError(t, r.validateMetadata([]byte("{")))
+
+	r = &Room{metadataFormat: "json", metadataValidate: true}
+	require.Equal(t, ".jsonl", r.metadataFileFormat().extension)
+	require.NoError(t, r.validateMetadata([]byte(`{"speed":12.5}`)))
+	require.EqualError(t, r.validateMetadata([]byte(`{"speed":`)), "invalid JSON")
+
+	r = &Room{metadataFormat: "csv", metadataValidate: true}
+	require.NoError(t, r.validateMetadata([]byte(`12.5,"a,b",3`)))
+	require.Error(t, r.validateMetadata([]byte("1,2\n3,4")))
+	require.Error(t, r.validateMetadata([]byte(`1,"2`)))
+
+	r = &Room{metadataFormat: "csv"}
+	require.NoError(t, r.validateMetadata([]byte(`1,"2`)))
+}
+
+func TestRecordingContentType(t *testing.T) {
+	for _, ca := range []struct {
+		file string
+		ct   string
+	}{
+		{"event/room/session-audio.ogg", "audio/ogg"},
+		{"event/room/session-video.h264", "video/h264"},
+		{"event/room/session-metadata.txt", "text/plain"},
+		{"event/room/session-metadata.jsonl", "application/x-ndjson"},
+		{"event/room/session-metadata.csv", "text/csv"},
+		{"event/room/session-metadata.pb", "application/x-protobuf"},
+		{"event/room/session-metadata.vtt", "text/vtt"},
+		{"event/room/room-manifest.json", "application/json"},
+		{"event/room/unknown", "application/octet-stream"},
+	} {
+		t.Run(ca.file, func(t *testing.T) {
+			require.Equal(t, ca.ct, recordingContentType(ca.file))
+		})
+	}
+}
+
+func TestRoomMetadataEncode(t *testing.T) {
+	text := roomMetadataFormats["text"]
+	require.Equal(t, []byte("hello\n"), text.encode([]byte("hello"), true))
+	require.Equal(t, []byte("AAoB\n"), text.encode([]byte{0x00, 0x0a, 0x01}, false))
+
+	binary := roomMetadataFormats["protobuf"]
+	require.Equal(t, []byte{0, 0, 0, 3, 0x00, 0x0a, 0x01}, binary.encode([]byte{0x00, 0x0a, 0x01}, false))
+	require.Equal(t, []byte{0, 0, 0, 2, 'h', 'i'}, binary.encode([]byte("hi"), true))
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+const (
+	// files bigger than this are uploaded in parts, that are resumed after a restart.
+	webrtcMultipartPartSize = 16 * 1024 * 1024
+
+	webrtcMultipartStateFileSuffix = ".upload.json"
+)
+
+func multipartStateFileName(filename string) string {
+	return filename + webrtcMultipartStateFileSuffix
+}
+
+// s3MultipartAPI is the part of the S3 client used by multipart uploads.
+type s3MultipartAPI interface {
+	CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput,
+		...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput,
+		...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+}
+
+type multipartPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// multipartState is the state of a multipart upload, that is written next to
+// the uploaded file after every part, in order to resume the upload
+// from the last completed part after a crash.
+type multipartState struct {
+	filename string
+
+	Bucket   string          `json:"bucket"`
+	Key      string          `json:"key"`
+	Size     int64           `json:"size"`
+	Checksum string          `json:"checksum"`
+	UploadID string          `json:"uploadID"`
+	Parts    []multipartPart `json:"parts"`
+}
+
+// loadMultipartState returns the state of a previous upload of the same file
+// to the same object, or nil if there's none.
+func loadMultipartState(filename string, bucket string, key string, size int64, checksum string) *multipartState {
+	byts, err := os.ReadFile(multipartStateFileName(filename))
+	if err != nil {
+		return nil
+	}
+
+	var s multipartState
+	err = json.Unmarshal(byts, &s)
+	if err != nil {
+		return nil
+	}
+
+	if s.Bucket != bucket || s.Key != key || s.Size != size || s.Checksum != checksum || s.UploadID == "" {
+		return nil
+	}
+
+	s.filename = filename
+	return &s
+}
+
+func (s *multipartState) write() error {
+	byts, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := multipartStateFileName(s.filename) + ".tmp"
+	err = os.WriteFile(tmp, byts, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, multipartStateFileName(s.filename))
+}
+
+func (s *multipartState) remove() {
+	os.Remove(multipartStateFileName(s.filename))
+}
+
+func (c *s3Client) createMultipartUploadInput(
+	bucket string,
+	key string,
+	checksum string,
+) *s3.CreateMultipartUploadInput {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(recordingContentType(key)),
+		Metadata:    map[string]string{recordChecksumMetadataKey: checksum},
+	}
+
+	switch c.SSE {
+	case conf.RecordSSES3:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+
+	case conf.RecordSSEKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if c.SSEKMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(c.SSEKMSKeyID)
+		}
+	}
+
+	return input
+}
+
+// uploadMultipart uploads a file in parts. If the upload of the same file
+// was interrupted, it is resumed from the last completed part.
+func uploadMultipart(
+	ctx context.Context,
+	api s3MultipartAPI,
+	create *s3.CreateMultipartUploadInput,
+	file *os.File,
+	size int64,
+	checksum string,
+) error {
+	bucket := aws.ToString(create.Bucket)
+	key := aws.ToString(create.Key)
+
+	state := loadMultipartState(file.Name(), bucket, key, size, checksum)
+
+	if state == nil {
+		res, err := api.CreateMultipartUpload(ctx, create)
+		if err != nil {
+			return err
+		}
+
+		state = &multipartState{
+			filename: file.Name(),
+			Bucket:   bucket,
+			Key:      key,
+			Size:     size,
+			Checksum: checksum,
+			UploadID: aws.ToString(res.UploadId),
+			Parts:    []multipartPart{},
+		}
+
+		err = state.write()
+		if err != nil {
+			return err
+		}
+	}
+
+	for offset := int64(len(state.Parts)) * webrtcMultipartPartSize; offset < size; offset += webrtcMultipartPartSize {
+		n := size - offset
+		if n > webrtcMultipartPartSize {
+			n = webrtcMultipartPartSize
+		}
+
+		number := int32(len(state.Parts) + 1)
+
+		res, err := api.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			UploadId:      aws.String(state.UploadID),
+			PartNumber:    number,
+			Body:          io.NewSectionReader(file, offset, n),
+			ContentLength: n,
+		})
+		if err != nil {
+			// the upload has been aborted or has expired, start again
+			var noSuchUpload *types.NoSuchUpload
+			if errors.As(err, &noSuchUpload) {
+				state.remove()
+			}
+			return fmt.Errorf("unable to upload part %d: %w", number, err)
+		}
+
+		state.Parts = append(state.Parts, multipartPart{
+			Number: number,
+			ETag:   aws.ToString(res.ETag),
+		})
+
+		err = state.write()
+		if err != nil {
+			return err
+		}
+	}
+
+	parts := make([]types.CompletedPart, len(state.Parts))
+	for i, part := range state.Parts {
+		parts[i] = types.CompletedPart{
+			PartNumber: part.Number,
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	_, err := api.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		var noSuchUpload *types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			state.remove()
+		}
+		return err
+	}
+
+	state.remove()
+	return nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+type testMultipartAPI struct {
+	creates   int
+	parts     []int32
+	completed []int32
+	failPart  int32
+}
+
+func (a *testMultipartAPI) CreateMultipartUpload(
+	_ context.Context, _ *s3.CreateMultipartUploadInput, _ ...func(*s3.Options),
+) (*s3.CreateMultipartUploadOutput, error) {
+	a.creates++
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(fmt.Sprintf("upload%d", a.creates))}, nil
+}
+
+func (a *testMultipartAPI) UploadPart(
+	_ context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options),
+) (*s3.UploadPartOutput, error) {
+	if in.PartNumber == a.failPart {
+		a.failPart = 0
+		return nil, fmt.Errorf("connection reset")
+	}
+
+	n, err := io.Copy(io.Discard, in.Body)
+	if err != nil {
+		return nil, err
+	}
+	if n != in.ContentLength {
+		return nil, fmt.Errorf("unexpected part size")
+	}
+
+	a.parts = append(a.parts, in.PartNumber)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag%d", in.PartNumber))}, nil
+}
+
+func (a *testMultipartAPI) CompleteMultipartUpload(
+	_ context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options),
+) (*s3.CompleteMultipartUploadOutput, error) {
+	for _, part := range in.MultipartUpload.Parts {
+		if aws.ToString(part.ETag) != fmt.Sprintf("etag%d", part.PartNumber) {
+			return nil, fmt.Errorf("wrong ETag")
+		}
+		a.completed = append(a.completed, part.PartNumber)
+	}
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func TestUploadMultipartResume(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-multipart")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "video.h264")
+	size := int64(2*webrtcMultipartPartSize + 1000)
+
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, f.Truncate(size))
+
+	c := &s3Client{}
+	create := c.createMultipartUploadInput("mybucket", "mykey", "checksum")
+	api := &testMultipartAPI{failPart: 2}
+
+	err = uploadMultipart(context.Background(), api, create, f, size, "checksum")
+	require.EqualError(t, err, "unable to upload part 2: connection reset")
+
+	state := loadMultipartState(filename, "mybucket", "mykey", size, "checksum")
+	require.NotNil(t, state)
+	require.Equal(t, "upload1", state.UploadID)
+	require.Equal(t, []multipartPart{{Number: 1, ETag: "etag1"}}, state.Parts)
+
+	// the state doesn't match another object
+	require.Nil(t, loadMultipartState(filename, "mybucket", "otherkey", size, "checksum"))
+
+	err = uploadMultipart(context.Background(), api, create, f, size, "checksum")
+	require.NoError(t, err)
+
+	require.Equal(t, 1, api.creates)
+	require.Equal(t, []int32{1, 2, 3}, api.parts)
+	require.Equal(t, []int32{1, 2, 3}, api.completed)
+
+	_, err = os.Stat(multipartStateFileName(filename))
+	require.True(t, os.IsNotExist(err))
+}
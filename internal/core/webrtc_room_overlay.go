@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+)
+
+const (
+	webrtcRecordOverlayFileSuffix = "-overlay.mp4"
+)
+
+// roomOverlayEnv returns the variables of the overlay command of a recorded track.
+func roomOverlayEnv(r *Room, rec *roomTrackRecorder, output string) map[string]string {
+	return map[string]string{
+		"MTX_INPUT":       rec.filename,
+		"MTX_OUTPUT":      output,
+		"MTX_ROOM_ID":     r.uuid.String(),
+		"MTX_CLUB":        r.clubName,
+		"MTX_EVENT":       r.eventName,
+		"MTX_SESSION_ID":  rec.session.String(),
+		"MTX_PARTICIPANT": rec.participant,
+		"MTX_START":       rec.first.UTC().Format(time.RFC3339),
+	}
+}
+
+// runRecordCommand runs a command that processes a recorded track and waits for its exit.
+// The command is killed when the timeout expires.
+// If output is not nil, the output of the command is copied into it too.
+func runRecordCommand(cmdstr string, env map[string]string, timeout time.Duration, output io.Writer) error {
+	// replace variables in both Linux and Windows, in order to allow using the
+	// same commands on both of them.
+	for key, val := range env {
+		cmdstr = strings.ReplaceAll(cmdstr, "$"+key, val)
+	}
+
+	cmdParts, err := shellquote.Split(cmdstr)
+	if err != nil {
+		return err
+	}
+	if len(cmdParts) == 0 {
+		return fmt.Errorf("command is empty")
+	}
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), timeout)
+	defer ctxCancel()
+
+	cmd := exec.CommandContext(ctx, cmdParts[0], cmdParts[1:]...)
+
+	cmd.Env = append([]string(nil), os.Environ()...)
+	for key, val := range env {
+		cmd.Env = append(cmd.Env, key+"="+val)
+	}
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if output != nil {
+		cmd.Stdout = io.MultiWriter(os.Stdout, output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, output)
+	}
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("command timed out")
+	}
+	return err
+}
+
+// applyOverlay burns the overlay into a recorded video track.
+// If it succeeds, the original file is replaced by the processed one,
+// otherwise the original file is kept.
+func (r *Room) applyOverlay(rec *roomTrackRecorder) error {
+	output := strings.TrimSuffix(rec.filename, ".h264") + webrtcRecordOverlayFileSuffix
+
+	err := runRecordCommand(r.recordConf.overlayCommand,
+		roomOverlayEnv(r, rec, output), r.recordConf.overlayTimeout, nil)
+	if err == nil {
+		_, err = os.Stat(output)
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	os.Remove(rec.filename)
+
+	rec.mutex.Lock()
+	rec.filename = output
+	rec.file = nil
+	rec.mutex.Unlock()
+
+	return nil
+}
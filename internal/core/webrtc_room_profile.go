@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// roomProfile returns the room profile with the given name.
+// An empty name returns an empty profile.
+func (m *webRTCManager) roomProfile(name string) (*conf.WebRTCRoomProfile, error) {
+	if name == "" {
+		return &conf.WebRTCRoomProfile{}, nil
+	}
+
+	m.confMutex.RLock()
+	defer m.confMutex.RUnlock()
+
+	profile, ok := m.roomProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("room profile '%s' doesn't exist", name)
+	}
+
+	return profile, nil
+}
+
+// withProfile returns a copy of the configuration with bucket, region
+// and recorded tracks set by a room profile.
+func (c roomRecordConf) withProfile(profile *conf.WebRTCRoomProfile) roomRecordConf {
+	if profile.Bucket != "" {
+		c.bucket = profile.Bucket
+	}
+	if profile.Region != "" {
+		c.region = profile.Region
+	}
+	if profile.RecordTracks != nil {
+		c.tracks = profile.RecordTracks
+	}
+	return c
+}
+
+// checkCodecs checks whether the tracks of a publisher use codecs allowed in the room.
+func (r *Room) checkCodecs(tracks []*webRTCIncomingTrack) error {
+	for _, track := range tracks {
+		codec := webrtcCodecOfFormat(track.format)
+
+		if r.e2ee && !conf.WebRTCE2EECodecs.Contains(codec) {
+			return fmt.Errorf("codec '%s' can't be used with end-to-end encryption, allowed codecs are %s",
+				codec, strings.Join(conf.WebRTCE2EECodecs, ", "))
+		}
+
+		if len(r.codecs) != 0 && !r.codecs.Contains(codec) {
+			return fmt.Errorf("codec '%s' is not allowed in the room, allowed codecs are %s",
+				codec, strings.Join(r.codecs, ", "))
+		}
+	}
+
+	return nil
+}
+
+// checkParticipants checks whether a session can join the room without
+// exceeding the maximum number of participants.
+// A session that is replaced by the new one is not counted.
+func (r *Room) checkParticipants(replaced *webRTCSession) error {
+	if r.maxParticipants == 0 {
+		return nil
+	}
+
+	n := len(r.sessions)
+	if _, ok := r.sessions[replaced]; ok {
+		n--
+	}
+
+	if n >= r.maxParticipants {
+		return fmt.Errorf("room is full")
+	}
+
+	return nil
+}
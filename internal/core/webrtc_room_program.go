@@ -0,0 +1,316 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	roomProgramRetryPause = 2 * time.Second
+)
+
+type roomProgramState string
+
+const (
+	roomProgramStateIdle    roomProgramState = "idle"
+	roomProgramStateRunning roomProgramState = "running"
+	roomProgramStateError   roomProgramState = "error"
+)
+
+type roomProgramPathManager interface {
+	addPublisher(req pathAddPublisherReq) pathAddPublisherRes
+	addReader(req pathAddReaderReq) pathAddReaderRes
+	setReadCredentials(pathName string, creds *roomRTSPCredentials)
+}
+
+// roomProgram publishes the program of a room, that is the stream of the
+// selected room path, into a dedicated path, that can be read with any protocol.
+// Readers must provide the RTSP credentials of the room, regardless of the protocol.
+// Switching the selected path doesn't interrupt readers of the program.
+type roomProgram struct {
+	pathName    string
+	rtspCreds   *roomRTSPCredentials
+	pathManager roomProgramPathManager
+	parent      logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+	mutex     sync.Mutex
+	source    string
+	state     roomProgramState
+	lastErr   error
+	next      string
+	chSource  chan struct{}
+	chClose   chan struct{}
+
+	// publisher
+	pubPath   *path
+	pubStream *stream.Stream
+	pubClock  *pathFallbackClock
+
+	done chan struct{}
+}
+
+func newRoomProgram(
+	parentCtx context.Context,
+	pathName string,
+	rtspCreds *roomRTSPCredentials,
+	pathManager roomProgramPathManager,
+	parent logger.Writer,
+) *roomProgram {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	p := &roomProgram{
+		pathName:    pathName,
+		rtspCreds:   rtspCreds,
+		pathManager: pathManager,
+		parent:      parent,
+		ctx:         ctx,
+		ctxCancel:   ctxCancel,
+		state:       roomProgramStateIdle,
+		chSource:    make(chan struct{}, 1),
+		chClose:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+
+	if rtspCreds != nil {
+		pathManager.setReadCredentials(pathName, rtspCreds)
+	}
+
+	go p.run()
+
+	return p
+}
+
+// Log is the main logging function.
+func (p *roomProgram) Log(level logger.Level, format string, args ...interface{}) {
+	p.parent.Log(level, "[program %s] "+format, append([]interface{}{p.pathName}, args...)...)
+}
+
+// stop stops the program and waits for it to exit.
+func (p *roomProgram) stop() {
+	p.ctxCancel()
+	<-p.done
+
+	if p.rtspCreds != nil {
+		p.pathManager.setReadCredentials(p.pathName, nil)
+	}
+}
+
+// close implements reader and publisher.
+// It is called when the selected path or the program path are closed, and causes a reconnection.
+func (p *roomProgram) close() {
+	select {
+	case p.chClose <- struct{}{}:
+	default:
+	}
+}
+
+// apiReaderDescribe implements reader.
+func (p *roomProgram) apiReaderDescribe() pathAPISourceOrReader {
+	return pathAPISourceOrReader{
+		Type: "roomProgram",
+		ID:   "",
+	}
+}
+
+// apiSourceDescribe implements source.
+func (p *roomProgram) apiSourceDescribe() pathAPISourceOrReader {
+	return pathAPISourceOrReader{
+		Type: "roomProgram",
+		ID:   "",
+	}
+}
+
+// setSource selects the path that is forwarded to the program.
+// It doesn't block, in order not to stall the caller while the program is connecting.
+func (p *roomProgram) setSource(source string) {
+	p.mutex.Lock()
+	p.next = source
+	p.mutex.Unlock()
+
+	select {
+	case p.chSource <- struct{}{}:
+	default:
+	}
+}
+
+func (p *roomProgram) nextSource() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.next
+}
+
+func (p *roomProgram) setState(source string, state roomProgramState, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.source = source
+	p.state = state
+	p.lastErr = err
+}
+
+func (p *roomProgram) apiItem() *apiWebRTCRoomProgram {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	item := &apiWebRTCRoomProgram{
+		Path:   p.pathName,
+		Source: p.source,
+		State:  string(p.state),
+	}
+	if p.rtspCreds != nil {
+		item.RTSPUser = p.rtspCreds.user
+		item.RTSPPass = p.rtspCreds.pass
+	}
+	if p.lastErr != nil {
+		item.Error = p.lastErr.Error()
+	}
+	return item
+}
+
+func (p *roomProgram) run() {
+	defer close(p.done)
+	defer p.stopPublisher()
+
+	source := ""
+
+	for {
+		if source == "" {
+			select {
+			case <-p.chSource:
+				source = p.nextSource()
+			case <-p.ctx.Done():
+				return
+			}
+		}
+
+		newSource, err := p.runSource(source)
+		if p.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			p.Log(logger.Warn, "%v", err)
+			p.setState(source, roomProgramStateError, err)
+
+			select {
+			case <-time.After(roomProgramRetryPause):
+			case <-p.chSource:
+				newSource = p.nextSource()
+			case <-p.ctx.Done():
+				return
+			}
+		}
+
+		if newSource != "" {
+			source = newSource
+		}
+	}
+}
+
+// runSource forwards a path to the program, until another path is selected.
+func (p *roomProgram) runSource(source string) (string, error) {
+	p.setState(source, roomProgramStateIdle, nil)
+
+	// discard signals of previous connections
+	select {
+	case <-p.chClose:
+	default:
+	}
+
+	res := p.pathManager.addReader(pathAddReaderReq{
+		author:   p,
+		pathName: source,
+		skipAuth: true,
+	})
+	if res.err != nil {
+		return "", res.err
+	}
+
+	defer res.path.removeReader(pathRemoveReaderReq{author: p})
+
+	medias := res.stream.Medias()
+
+	if p.pubStream != nil && !pathMediasCompatible(medias, p.pubStream.Medias()) {
+		p.Log(logger.Info, "codecs of path '%s' are different from the program ones, restarting the program", source)
+		p.stopPublisher()
+	}
+
+	if p.pubStream == nil {
+		err := p.startPublisher(medias)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fw := newPathStreamForwarder(res.stream, p.pubStream, p.pubClock)
+	defer fw.close()
+
+	p.Log(logger.Info, "switched to path '%s'", source)
+	p.setState(source, roomProgramStateRunning, nil)
+
+	select {
+	case <-p.chSource:
+		return p.nextSource(), nil
+
+	case <-p.chClose:
+		// the program path may have been closed too
+		fw.close()
+		p.stopPublisher()
+		return "", fmt.Errorf("path has been closed")
+
+	case <-p.ctx.Done():
+		return "", fmt.Errorf("terminated")
+	}
+}
+
+func (p *roomProgram) startPublisher(medias media.Medias) error {
+	res := p.pathManager.addPublisher(pathAddPublisherReq{
+		author:   p,
+		pathName: p.pathName,
+		skipAuth: true,
+	})
+	if res.err != nil {
+		return res.err
+	}
+
+	pubMedias, err := pathCloneMedias(medias)
+	if err != nil {
+		res.path.removePublisher(pathRemovePublisherReq{author: p})
+		return err
+	}
+
+	sres := res.path.startPublisher(pathStartPublisherReq{
+		author:             p,
+		medias:             pubMedias,
+		generateRTPPackets: true,
+	})
+	if sres.err != nil {
+		res.path.removePublisher(pathRemovePublisherReq{author: p})
+		return sres.err
+	}
+
+	p.pubPath = res.path
+	p.pubStream = sres.stream
+	p.pubClock = &pathFallbackClock{}
+
+	return nil
+}
+
+func (p *roomProgram) stopPublisher() {
+	if p.pubPath == nil {
+		return
+	}
+
+	p.pubPath.removePublisher(pathRemovePublisherReq{author: p})
+	p.pubPath = nil
+	p.pubStream = nil
+	p.pubClock = nil
+}
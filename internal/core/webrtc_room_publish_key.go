@@ -0,0 +1,92 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+const (
+	webrtcRoomPublishKeySize = 12
+)
+
+// mintPublishKey generates a key that allows to publish to a path of the room
+// without the credentials of the path. Keys are meant to be embedded into
+// the WHIP URL of encoders, and are valid until they are revoked or the room is closed.
+func (r *Room) mintPublishKey(pathName string) (string, error) {
+	if r.rehearsal() {
+		return "", errAPIBadRequest{fmt.Errorf("rehearsal rooms use the publish keys of the original room")}
+	}
+
+	err := conf.IsValidPathName(pathName)
+	if err != nil {
+		return "", errAPIBadRequest{fmt.Errorf("invalid path: %w", err)}
+	}
+
+	var b [webrtcRoomPublishKeySize]byte
+	_, err = rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+
+	key := base64.RawURLEncoding.EncodeToString(b[:])
+	r.publishKeys[key] = pathName
+
+	return key, nil
+}
+
+func (r *Room) revokePublishKey(key string) error {
+	if _, ok := r.publishKeys[key]; !ok {
+		return errAPINotFound
+	}
+
+	delete(r.publishKeys, key)
+	return nil
+}
+
+// publishKeyPath returns the path to which a key allows to publish.
+func (r *Room) publishKeyPath(key string) (string, bool) {
+	pathName := ""
+	found := false
+	for k, p := range r.publishKeys {
+		// all keys are compared, in order not to leak timing information
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			pathName = p
+			found = true
+		}
+	}
+	return pathName, found
+}
+
+// authenticatePublishKey checks the key provided by a session in the 'key' query parameter,
+// and returns whether the session is allowed to publish without further authentication.
+func (r *Room) authenticatePublishKey(req webRTCNewSessionReq) (bool, error) {
+	query, err := url.ParseQuery(req.query)
+	if err != nil {
+		return false, err
+	}
+
+	key := query.Get("key")
+	if key == "" {
+		return false, nil
+	}
+
+	if !req.publish {
+		return false, fmt.Errorf("publish keys can't be used to read")
+	}
+
+	pathName, ok := r.publishKeyPath(key)
+	if !ok {
+		return false, fmt.Errorf("invalid publish key")
+	}
+
+	if pathName != req.pathName {
+		return false, fmt.Errorf("publish key doesn't allow to publish to path '%s'", req.pathName)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomPublishKey(t *testing.T) {
+	r := &Room{publishKeys: make(map[string]string)}
+
+	_, err := r.mintPublishKey("")
+	require.Error(t, err)
+
+	key, err := r.mintPublishKey("venue/cam1")
+	require.NoError(t, err)
+	require.Len(t, key, 16)
+
+	other, err := r.mintPublishKey("venue/cam2")
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+
+	ok, err := r.authenticatePublishKey(webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "key=" + key,
+		publish:  true,
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// sessions without key are authenticated by paths
+	ok, err = r.authenticatePublishKey(webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		publish:  true,
+	})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = r.authenticatePublishKey(webRTCNewSessionReq{
+		pathName: "venue/cam2",
+		query:    "key=" + key,
+		publish:  true,
+	})
+	require.EqualError(t, err, "publish key doesn't allow to publish to path 'venue/cam2'")
+
+	_, err = r.authenticatePublishKey(webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "key=" + key,
+	})
+	require.EqualError(t, err, "publish keys can't be used to read")
+
+	err = r.revokePublishKey(key)
+	require.NoError(t, err)
+
+	err = r.revokePublishKey(key)
+	require.Equal(t, errAPINotFound, err)
+
+	_, err = r.authenticatePublishKey(webRTCNewSessionReq{
+		pathName: "venue/cam1",
+		query:    "key=" + key,
+		publish:  true,
+	})
+	require.EqualError(t, err, "invalid publish key")
+}
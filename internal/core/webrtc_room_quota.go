@@ -0,0 +1,114 @@
+package core
+
+import (
+	"os"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// roomQuotaConf contains the limits applied to each room.
+// A value of zero means no limit.
+type roomQuotaConf struct {
+	maxEgress     uint64
+	maxRecordSize uint64
+}
+
+func newRoomQuotaConf(c *conf.Conf) roomQuotaConf {
+	return roomQuotaConf{
+		maxEgress:     uint64(c.WebRTCRoomMaxEgress),
+		maxRecordSize: uint64(c.WebRTCRoomMaxRecordSize),
+	}
+}
+
+// roomQuota keeps track of the resources used by a room.
+// It is accessed by webRTCManager only.
+type roomQuota struct {
+	closedEgress   uint64 // bytes sent to readers that left the room
+	egress         uint64
+	recordSize     uint64
+	egressExceeded bool
+}
+
+// egress returns the bytes sent to the readers of the room.
+func (r *Room) egress() uint64 {
+	n := r.quota.closedEgress
+	for sx := range r.sessions {
+		if !sx.req.publish {
+			n += sx.bytesSent()
+		}
+	}
+	return n
+}
+
+// recordSize returns the size of the files recorded by the room.
+func (r *Room) recordSize() uint64 {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+
+	n := uint64(0)
+	for _, rec := range r.recorders {
+		fi, err := os.Stat(rec.filename)
+		if err == nil {
+			n += uint64(fi.Size())
+		}
+	}
+	return n
+}
+
+// removeReader accounts the bytes sent to a reader that is leaving the room.
+func (r *Room) removeReader(sx *webRTCSession) {
+	r.quota.closedEgress += sx.bytesSent()
+}
+
+// checkQuotas updates the resources used by the room. When a quota is exceeded,
+// new readers are rejected or recording is stopped.
+func (r *Room) checkQuotas(qc roomQuotaConf) {
+	r.quota.egress = r.egress()
+	r.quota.recordSize = r.recordSize()
+
+	egressExceeded := qc.maxEgress != 0 && r.quota.egress >= qc.maxEgress
+	if egressExceeded != r.quota.egressExceeded {
+		r.quota.egressExceeded = egressExceeded
+
+		if egressExceeded {
+			r.Log(logger.Warn, "egress quota exceeded, new readers are rejected")
+			r.events.write(roomEvent{Type: roomEventQuotaExceeded, Message: "egress"})
+		}
+	}
+
+	if qc.maxRecordSize != 0 && r.quota.recordSize >= qc.maxRecordSize && r.recording && r.stopRecording() {
+		r.Log(logger.Warn, "record size quota exceeded, recording is stopped")
+		r.events.write(roomEvent{Type: roomEventQuotaExceeded, Message: "record size"})
+	}
+}
+
+// stopRecording closes all recorded files permanently.
+// Files are uploaded when the room is cleaned up.
+// It returns false if recording was already stopped.
+func (r *Room) stopRecording() bool {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+
+	if r.recordStopped {
+		return false
+	}
+
+	r.recordStopped = true
+
+	for _, rec := range r.recorders {
+		err := rec.close()
+		if err != nil {
+			r.Log(logger.Warn, "unable to close '%s': %v", rec.filename, err)
+		}
+	}
+
+	return true
+}
+
+// recordingStopped checks whether recording has been stopped by a quota.
+func (r *Room) recordingStopped() bool {
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+	return r.recordStopped
+}
@@ -0,0 +1,327 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordkey"
+)
+
+const (
+	webrtcRoomStateFileSuffix = "-state.json"
+)
+
+func roomStateFileName(dir string, roomID uuid.UUID) string {
+	return filepath.Join(dir, roomID.String()+webrtcRoomStateFileSuffix)
+}
+
+// roomState is a sidecar file that is kept next to the files of a room
+// while the room is open, and that allows to upload these files
+// to the right bucket and key after a crash.
+type roomState struct {
+	mutex    sync.Mutex
+	filename string
+
+	Room      uuid.UUID `json:"room"`
+	Club      string    `json:"club"`
+	Event     string    `json:"event"`
+	Bucket    string    `json:"bucket"`
+	Region    string    `json:"region"`
+	Recording bool      `json:"recording"`
+	Files     []string  `json:"files"`
+}
+
+// newRoomState writes the state of a room, that contains the given files.
+func newRoomState(r *Room, filenames ...string) (*roomState, error) {
+	s := &roomState{
+		filename: roomStateFileName(r.dir(), r.uuid),
+		Room:     r.uuid,
+		Club:     r.clubName,
+		Event:    r.eventName,
+		Bucket:   r.bucketName(),
+		Region:   r.recordConf.region,
+		Files:    []string{},
+	}
+
+	for _, filename := range filenames {
+		s.Files = append(s.Files, filepath.Base(filename))
+	}
+
+	err := s.write()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func loadRoomState(filename string) (*roomState, error) {
+	byts, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &roomState{filename: filename}
+	err = json.Unmarshal(byts, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// write replaces the state file atomically, in order not to leave
+// a truncated file behind in case of crash.
+func (s *roomState) write() error {
+	byts, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.filename + ".tmp"
+	err = os.WriteFile(tmp, byts, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.filename)
+}
+
+func (s *roomState) addFile(filename string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Files = append(s.Files, filepath.Base(filename))
+	return s.write()
+}
+
+func (s *roomState) setRecording() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Recording = true
+	return s.write()
+}
+
+func (s *roomState) remove() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	os.Remove(s.filename)
+}
+
+// roomStateRoot returns the directory that contains the files of all rooms,
+// that is the part of the path template that doesn't depend on rooms.
+// Templates whose fixed part is empty or is a root directory are refused,
+// since the directory would contain files that don't belong to rooms.
+func roomStateRoot(template string) (string, error) {
+	var root string
+	i := strings.Index(template, "%")
+	if i < 0 {
+		root = filepath.Clean(template)
+	} else {
+		if template[:i] == "" {
+			return "", fmt.Errorf("record path '%s' doesn't start with a fixed directory", template)
+		}
+		root = filepath.Dir(template[:i] + "x")
+	}
+
+	// "." and root directories are the only paths whose parent is themselves
+	if filepath.Dir(root) == root {
+		return "", fmt.Errorf("record path '%s' doesn't start with a fixed directory", template)
+	}
+
+	return root, nil
+}
+
+// finalizeOggFile removes the last page of an Ogg file when it is incomplete,
+// as it happens when the process is killed while writing it.
+func finalizeOggFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var pos int64
+	header := make([]byte, 27)
+
+	for pos < fi.Size() {
+		_, err = f.ReadAt(header, pos)
+		if err != nil || string(header[:4]) != "OggS" {
+			break
+		}
+
+		segments := make([]byte, header[26])
+		_, err = f.ReadAt(segments, pos+27)
+		if err != nil {
+			break
+		}
+
+		size := int64(27 + len(segments))
+		for _, s := range segments {
+			size += int64(s)
+		}
+
+		if pos+size > fi.Size() {
+			break
+		}
+
+		pos += size
+	}
+
+	if pos == fi.Size() {
+		return nil
+	}
+
+	return f.Truncate(pos)
+}
+
+// recoverRooms uploads the files of rooms that were left on disk
+// by a previous instance of the server, that was not closed properly.
+func (m *webRTCManager) recoverRooms() {
+	m.confMutex.RLock()
+	recordConf := m.recordConf
+	m.confMutex.RUnlock()
+
+	root, err := roomStateRoot(recordConf.path)
+	if err != nil {
+		m.Log(logger.Warn, "unable to scan recordings: %v", err)
+		return
+	}
+
+	var filenames []string
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.IsDir() && strings.HasSuffix(path, webrtcRoomStateFileSuffix) {
+			filenames = append(filenames, path)
+		}
+		return nil
+	})
+	if err != nil {
+		m.Log(logger.Warn, "unable to scan recordings: %v", err)
+		return
+	}
+
+	if len(filenames) == 0 {
+		return
+	}
+
+	m.Log(logger.Info, "recovering %d rooms", len(filenames))
+
+	m.uploads.Add(1)
+	go func() {
+		defer m.uploads.Done()
+
+		for _, filename := range filenames {
+			err := m.recoverRoom(recordConf, filename)
+			if err != nil {
+				m.Log(logger.Warn, "unable to recover '%s': %v", filename, err)
+			}
+		}
+	}()
+}
+
+func (m *webRTCManager) recoverRoom(recordConf roomRecordConf, filename string) error {
+	state, err := loadRoomState(filename)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(filename)
+
+	// files of rooms that were not recording are not meant to be kept
+	if !state.Recording {
+		for _, name := range state.Files {
+			os.Remove(filepath.Join(dir, name))
+		}
+		state.remove()
+		return nil
+	}
+
+	recordConf.region = state.Region
+
+	storage, err := newRecordStorage(m.ctx, recordConf)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+
+	for _, name := range state.Files {
+		err := recoverRoomFile(storage, state, filepath.Join(dir, name))
+		if err != nil {
+			m.Log(logger.Warn, "unable to recover '%s': %v", name, err)
+			failed++
+		}
+	}
+
+	// the state is kept in order to retry at the next start
+	if failed != 0 {
+		return nil
+	}
+
+	m.Log(logger.Info, "room %v recovered", state.Room)
+	state.remove()
+	return nil
+}
+
+func recoverRoomFile(storage recordStorage, state *roomState, filename string) error {
+	if strings.HasSuffix(filename, ".ogg") {
+		err := finalizeOggFile(filename)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		// the file was uploaded before the crash
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	objectKey := recordkey.ObjectKey(state.Event, state.Room, filepath.Base(filename))
+	err = storage.UploadObject(state.Bucket, objectKey, f, "")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	return os.Remove(filename)
+}
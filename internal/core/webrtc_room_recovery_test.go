@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func oggPage(body []byte) []byte {
+	page := append([]byte("OggS"), make([]byte, 22)...)
+	page = append(page, 1, byte(len(body)))
+	return append(page, body...)
+}
+
+func TestFinalizeOggFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-ogg")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	complete := append(oggPage([]byte{1, 2, 3}), oggPage([]byte{4, 5, 6, 7})...)
+
+	for _, ca := range []struct {
+		name    string
+		content []byte
+	}{
+		{
+			"complete",
+			complete,
+		},
+		{
+			"truncated page",
+			append(append([]byte(nil), complete...), oggPage([]byte{8, 9, 10, 11})[:30]...),
+		},
+		{
+			"truncated header",
+			append(append([]byte(nil), complete...), []byte("OggS")...),
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			filename := filepath.Join(dir, "test.ogg")
+			err := os.WriteFile(filename, ca.content, 0o644)
+			require.NoError(t, err)
+
+			err = finalizeOggFile(filename)
+			require.NoError(t, err)
+
+			byts, err := os.ReadFile(filename)
+			require.NoError(t, err)
+			require.Equal(t, complete, byts)
+		})
+	}
+}
+
+func TestRoomStateRoot(t *testing.T) {
+	for _, ca := range []struct {
+		template string
+		root     string
+	}{
+		{"streams/%club/%event/%room", "streams"},
+		{"streams/%room", "streams"},
+		{"/data/rec/room-%room", "/data/rec"},
+		{"streams/", "streams"},
+	} {
+		root, err := roomStateRoot(ca.template)
+		require.NoError(t, err)
+		require.Equal(t, ca.root, root)
+	}
+
+	for _, template := range []string{
+		"%room",
+		"./%room",
+		"room-%room",
+		"/%room",
+		"/",
+		".",
+	} {
+		_, err := roomStateRoot(template)
+		require.Error(t, err, template)
+	}
+}
+
+func TestRoomStateRecovery(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-recovery")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &webRTCManager{
+		ctx:        context.Background(),
+		parent:     nilLogger{},
+		rooms:      make(map[uuid.UUID]*Room),
+		recordConf: roomRecordConf{path: filepath.Join(dir, "%room"), bucket: "mybucket"},
+	}
+
+	room, err := m.createRoom(uuid.New(), "myclub", "myevent", nil, nil, nil, "", roomSchedule{}, "")
+	require.NoError(t, err)
+
+	f, err := room.createFile(filepath.Join(room.dir(), "test.ogg"))
+	require.NoError(t, err)
+	_, err = f.Write(bytes.Repeat([]byte{1}, 10))
+	require.NoError(t, err)
+	f.Close()
+
+	// the room is not cleaned up, as it happens after a crash
+	room.events.close()
+	room.chat.close()
+
+	stateFilename := roomStateFileName(room.dir(), room.uuid)
+
+	state, err := loadRoomState(stateFilename)
+	require.NoError(t, err)
+	require.Equal(t, room.uuid, state.Room)
+	require.Equal(t, "myevent", state.Event)
+	require.Equal(t, "mybucket", state.Bucket)
+	require.Equal(t, false, state.Recording)
+	require.Equal(t, []string{
+		room.uuid.String() + webrtcRoomEventsFileSuffix,
+		room.uuid.String() + webrtcRoomChatFileSuffix,
+		"test.ogg",
+	}, state.Files)
+
+	// files of rooms that were not recording are removed
+	err = m.recoverRoom(m.recordConf, stateFilename)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(room.dir())
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
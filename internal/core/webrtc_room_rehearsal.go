@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+var errRoomRehearsal = errAPIBadRequest{fmt.Errorf("recording is disabled in rehearsal rooms")}
+
+// rehearsal checks whether the room is a rehearsal room, that
+// is neither recorded nor restreamed.
+func (r *Room) rehearsal() bool {
+	return r.rehearsalOf != uuid.Nil
+}
+
+// cloneRoom creates a rehearsal room with the configuration of an existing room.
+// Publish keys of the existing room are accepted (see publishKeysRoom), in order
+// to allow participants to test their setup with the same URLs that they'll use
+// during the event, while recording, restreaming and the schedule are not copied.
+func (m *webRTCManager) cloneRoom(src *Room) (*Room, error) {
+	if src.rehearsal() {
+		return nil, errAPIBadRequest{fmt.Errorf("rehearsal rooms can't be cloned")}
+	}
+
+	program := ""
+	if src.program != nil {
+		program = src.program.pathName
+	}
+
+	room, err := m.createRoom(uuid.New(), src.clubName, src.eventName, nil, src.iceServers,
+		nil, program, roomSchedule{}, src.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	room.rehearsalOf = src.uuid
+	room.geo = src.geo
+	m.syncGeo(room)
+
+	room.Log(logger.Info, "created as rehearsal of room %s", src.uuid)
+
+	return room, nil
+}
+
+// publishKeysRoom returns the room whose publish keys are checked when sessions join a room.
+// Rehearsal rooms don't own keys and look up the ones of the original room every time,
+// so that revoked keys are refused by rehearsals too, and that keys stop working
+// when the original room is closed.
+func (m *webRTCManager) publishKeysRoom(room *Room) *Room {
+	if !room.rehearsal() {
+		return room
+	}
+
+	if src := m.findRoomByUUID(room.rehearsalOf); src != nil {
+		return src
+	}
+
+	// the rehearsal room has no keys, therefore all keys are refused
+	return room
+}
@@ -0,0 +1,336 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/ringbuffer"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/rtmp"
+)
+
+const (
+	roomRestreamRetryPause = 5 * time.Second
+	roomRestreamMaxTargets = 8
+)
+
+type roomRestreamState string
+
+const (
+	roomRestreamStateWaiting roomRestreamState = "waiting"
+	roomRestreamStateRunning roomRestreamState = "running"
+	roomRestreamStateError   roomRestreamState = "error"
+)
+
+// checkRoomRestream checks the restream parameters provided at room creation.
+func checkRoomRestream(r *apiWebRTCRoomRestream) error {
+	if r == nil || len(r.Targets) == 0 {
+		return nil
+	}
+
+	if len(r.Targets) > roomRestreamMaxTargets {
+		return fmt.Errorf("at most %d restream targets are allowed", roomRestreamMaxTargets)
+	}
+
+	err := conf.IsValidPathName(r.Path)
+	if err != nil {
+		return fmt.Errorf("invalid restream path: %v", err)
+	}
+
+	for _, target := range r.Targets {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "rtmp" && u.Scheme != "rtmps") || u.Host == "" {
+			return fmt.Errorf("invalid restream target: '%s'", redactRestreamURL(target))
+		}
+	}
+
+	return nil
+}
+
+// redactRestreamURL removes the stream key, that is the last part of the path,
+// from a restream target.
+func redactRestreamURL(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return "***"
+	}
+
+	path := u.Path
+	if i := strings.LastIndex(path, "/"); i > 0 {
+		path = path[:i] + "/***"
+	}
+
+	// user info and query are removed too, since they may contain credentials
+	return u.Scheme + "://" + u.Host + path
+}
+
+type roomRestreamerPathManager interface {
+	addReader(req pathAddReaderReq) pathAddReaderRes
+}
+
+// roomRestreamer pushes a path of a room to an external RTMP server,
+// and reconnects when the path or the server goes away.
+type roomRestreamer struct {
+	target          string
+	pathName        string
+	timeout         conf.StringDuration
+	readBufferCount int
+	pathManager     roomRestreamerPathManager
+	parent          logger.Writer
+
+	ctx        context.Context
+	ctxCancel  func()
+	mutex      sync.Mutex
+	state      roomRestreamState
+	lastErr    error
+	ringBuffer *ringbuffer.RingBuffer
+
+	done chan struct{}
+}
+
+func newRoomRestreamer(
+	parentCtx context.Context,
+	target string,
+	pathName string,
+	timeout conf.StringDuration,
+	readBufferCount int,
+	pathManager roomRestreamerPathManager,
+	parent logger.Writer,
+) *roomRestreamer {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	r := &roomRestreamer{
+		target:          target,
+		pathName:        pathName,
+		timeout:         timeout,
+		readBufferCount: readBufferCount,
+		pathManager:     pathManager,
+		parent:          parent,
+		ctx:             ctx,
+		ctxCancel:       ctxCancel,
+		state:           roomRestreamStateWaiting,
+		done:            make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Log is the main logging function.
+func (r *roomRestreamer) Log(level logger.Level, format string, args ...interface{}) {
+	r.parent.Log(level, "[restream %s] "+format,
+		append([]interface{}{redactRestreamURL(r.target)}, args...)...)
+}
+
+// stop stops the restreamer and waits for it to exit.
+func (r *roomRestreamer) stop() {
+	r.ctxCancel()
+	<-r.done
+}
+
+// close implements reader.
+// It is called when the path stops, and causes a reconnection.
+func (r *roomRestreamer) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.ringBuffer != nil {
+		r.ringBuffer.Close()
+	}
+}
+
+// apiReaderDescribe implements reader.
+func (r *roomRestreamer) apiReaderDescribe() pathAPISourceOrReader {
+	return pathAPISourceOrReader{
+		Type: "roomRestreamer",
+		ID:   "",
+	}
+}
+
+func (r *roomRestreamer) setState(state roomRestreamState, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.state = state
+	r.lastErr = err
+}
+
+func (r *roomRestreamer) apiItem() *apiWebRTCRoomRestreamTarget {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	item := &apiWebRTCRoomRestreamTarget{
+		URL:   redactRestreamURL(r.target),
+		State: string(r.state),
+	}
+	if r.lastErr != nil {
+		item.Error = r.lastErr.Error()
+	}
+	return item
+}
+
+func (r *roomRestreamer) run() {
+	defer close(r.done)
+
+	for {
+		err := r.runInner()
+		if r.ctx.Err() != nil {
+			return
+		}
+
+		r.Log(logger.Warn, "%v", err)
+		r.setState(roomRestreamStateError, err)
+
+		select {
+		case <-time.After(roomRestreamRetryPause):
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *roomRestreamer) runInner() error {
+	// the ring buffer is allocated before the reader is added,
+	// in order to allow the path to close it at any time.
+	ringBuffer, _ := ringbuffer.New(uint64(r.readBufferCount))
+
+	r.mutex.Lock()
+	r.ringBuffer = ringBuffer
+	r.mutex.Unlock()
+
+	innerCtx, innerCtxCancel := context.WithCancel(r.ctx)
+	defer innerCtxCancel()
+
+	go func() {
+		<-innerCtx.Done()
+		ringBuffer.Close()
+	}()
+
+	res := r.pathManager.addReader(pathAddReaderReq{
+		author:   r,
+		pathName: r.pathName,
+		skipAuth: true,
+	})
+	if res.err != nil {
+		return res.err
+	}
+
+	defer res.path.removeReader(pathRemoveReaderReq{author: r})
+
+	u, err := url.Parse(r.target)
+	if err != nil {
+		return err
+	}
+
+	if u.Port() == "" {
+		if u.Scheme == "rtmps" {
+			u.Host = net.JoinHostPort(u.Host, "443")
+		} else {
+			u.Host = net.JoinHostPort(u.Host, "1935")
+		}
+	}
+
+	nconn, err := func() (net.Conn, error) {
+		ctx2, cancel2 := context.WithTimeout(r.ctx, time.Duration(r.timeout))
+		defer cancel2()
+
+		if u.Scheme == "rtmp" {
+			return (&net.Dialer{}).DialContext(ctx2, "tcp", u.Host)
+		}
+
+		return (&tls.Dialer{
+			Config: &tls.Config{ServerName: u.Hostname()},
+		}).DialContext(ctx2, "tcp", u.Host)
+	}()
+	if err != nil {
+		return err
+	}
+	defer nconn.Close()
+
+	return r.runWriter(u, nconn, res, ringBuffer)
+}
+
+func (r *roomRestreamer) runWriter(
+	u *url.URL,
+	nconn net.Conn,
+	res pathAddReaderRes,
+	ringBuffer *ringbuffer.RingBuffer,
+) error {
+	nconn.SetReadDeadline(time.Now().Add(time.Duration(r.timeout)))
+	nconn.SetWriteDeadline(time.Now().Add(time.Duration(r.timeout)))
+	conn, err := rtmp.NewClientConn(nconn, u, true)
+	if err != nil {
+		return err
+	}
+
+	var medias media.Medias
+	videoFirstIDRFound := false
+	var videoStartDTS time.Duration
+	var w *rtmp.Writer
+
+	videoMedia, videoFormat := rtmpSetupVideo(
+		r,
+		nconn,
+		r.timeout,
+		&w,
+		res.stream,
+		ringBuffer,
+		&videoFirstIDRFound,
+		&videoStartDTS)
+	if videoMedia != nil {
+		medias = append(medias, videoMedia)
+	}
+
+	audioMedia, audioFormat := rtmpSetupAudio(
+		r,
+		nconn,
+		r.timeout,
+		&w,
+		res.stream,
+		ringBuffer,
+		videoFormat,
+		&videoFirstIDRFound,
+		&videoStartDTS)
+	if audioFormat != nil {
+		medias = append(medias, audioMedia)
+	}
+
+	defer res.stream.RemoveReader(r)
+
+	if videoFormat == nil && audioFormat == nil {
+		return fmt.Errorf(
+			"the stream doesn't contain any supported codec, which are currently H264, MPEG-4 Audio, MPEG-1/2 Audio")
+	}
+
+	w, err = rtmp.NewWriter(conn, videoFormat, audioFormat)
+	if err != nil {
+		return err
+	}
+
+	// the server doesn't send anything after the handshake
+	nconn.SetReadDeadline(time.Time{})
+
+	r.Log(logger.Info, "is restreaming path '%s', %s", r.pathName, sourceMediaInfo(medias))
+	r.setState(roomRestreamStateRunning, nil)
+
+	for {
+		item, ok := ringBuffer.Pull()
+		if !ok {
+			return fmt.Errorf("terminated")
+		}
+
+		err := item.(func() error)()
+		if err != nil {
+			return err
+		}
+	}
+}
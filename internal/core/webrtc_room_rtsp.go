@@ -0,0 +1,39 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+const (
+	roomRTSPPassSize = 18
+)
+
+// roomRTSPCredentials are the credentials that are needed in order to read
+// the program of a room. They are generated when the room is created,
+// in order to allow devices that don't support WebRTC, like broadcast vans
+// and legacy decoders, to pull the program with RTSP without sharing path credentials.
+// They are required with every protocol, otherwise the program could be read
+// with the credentials of the path.
+type roomRTSPCredentials struct {
+	user string
+	pass string
+}
+
+func newRoomRTSPCredentials() (*roomRTSPCredentials, error) {
+	user, err := randomTurnUser()
+	if err != nil {
+		return nil, err
+	}
+
+	var b [roomRTSPPassSize]byte
+	_, err = rand.Read(b[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &roomRTSPCredentials{
+		user: user,
+		pass: base64.RawURLEncoding.EncodeToString(b[:]),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	webrtcRoomScheduleCheckInterval = 1 * time.Second
+)
+
+// roomSchedule is the time window in which a room accepts sessions.
+// Recording is started at start and the room is cleaned up at end.
+// Zero values mean that the window is not limited on that side.
+type roomSchedule struct {
+	start time.Time
+	end   time.Time
+}
+
+func newRoomSchedule(start *time.Time, end *time.Time) roomSchedule {
+	var s roomSchedule
+	if start != nil {
+		s.start = *start
+	}
+	if end != nil {
+		s.end = *end
+	}
+	return s
+}
+
+func (s roomSchedule) check(now time.Time) error {
+	if !s.end.IsZero() {
+		if !s.start.IsZero() && !s.end.After(s.start) {
+			return fmt.Errorf("end time must be after start time")
+		}
+
+		if !s.end.After(now) {
+			return fmt.Errorf("end time is in the past")
+		}
+	}
+
+	return nil
+}
+
+// checkOpen checks whether sessions can join the room.
+func (s roomSchedule) checkOpen(now time.Time) error {
+	if !s.start.IsZero() && now.Before(s.start) {
+		return fmt.Errorf("room opens at %s", s.start.Format(time.RFC3339))
+	}
+
+	if !s.end.IsZero() && !now.Before(s.end) {
+		return fmt.Errorf("room is closed")
+	}
+
+	return nil
+}
+
+func timePtrIfNotZero(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// checkSchedules starts recording of rooms whose start time is reached,
+// and cleans up rooms whose end time is reached.
+func (m *webRTCManager) checkSchedules(now time.Time) {
+	for id, room := range m.rooms {
+		if !room.schedule.end.IsZero() && !now.Before(room.schedule.end) {
+			room.Log(logger.Info, "end time reached, closing")
+
+			m.disableLLHLS(room)
+			m.clearGeo(room)
+			err := room.cleanup()
+			if err != nil {
+				room.Log(logger.Warn, "unable to clean up: %v", err)
+			}
+
+			delete(m.rooms, id)
+			continue
+		}
+
+		if !room.schedule.start.IsZero() && !room.scheduleStarted && !now.Before(room.schedule.start) {
+			room.scheduleStarted = true
+
+			if !room.recording {
+				room.Log(logger.Info, "start time reached, recording")
+
+				err := room.record()
+				if err != nil {
+					room.Log(logger.Warn, "unable to start recording: %v", err)
+				}
+			}
+		}
+	}
+}
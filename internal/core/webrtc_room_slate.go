@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/pion/rtp"
+)
+
+const (
+	// duration of roomSlateOpusSilence.
+	roomSlateOpusFrameDuration = 20 * time.Millisecond
+)
+
+// roomSlateOpusSilence is a 20ms Opus frame that contains silence.
+var roomSlateOpusSilence = []byte{0xf8, 0xff, 0xfe}
+
+// roomSlate is an image that is written into the video recordings of a publisher
+// while it is disconnected, in order to keep the timeline of recordings continuous.
+// Audio recordings are filled with silence.
+type roomSlate struct {
+	au        [][]byte
+	frameRate int
+}
+
+// loadRoomSlate loads a slate from a H264 Annex-B file that contains a single IDR access unit.
+func loadRoomSlate(filename string, frameRate int) (*roomSlate, error) {
+	byts, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	au, err := h264.AnnexBUnmarshal(byts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid slate: %v", err)
+	}
+
+	if !h264.IDRPresent(au) {
+		return nil, fmt.Errorf("invalid slate: IDR not found")
+	}
+
+	return &roomSlate{
+		au:        au,
+		frameRate: frameRate,
+	}, nil
+}
+
+// startSlate fills the recording with the slate until the recorder is reattached
+// or closed, or until duration has passed.
+func (r *roomTrackRecorder) startSlate(slate *roomSlate, duration time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed || r.slateCancel != nil || r.first.IsZero() {
+		return
+	}
+
+	var period time.Duration
+	var samples [][]byte
+	var step uint32
+
+	switch {
+	case r.codec == "h264":
+		period = time.Second / time.Duration(slate.frameRate)
+		samples = slate.au
+		step = uint32(90000 / slate.frameRate)
+
+	case r.codec == "opus":
+		period = roomSlateOpusFrameDuration
+		samples = [][]byte{roomSlateOpusSilence}
+		step = uint32(48000 * roomSlateOpusFrameDuration / time.Second)
+
+	default:
+		return
+	}
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), duration)
+	r.slateCancel = ctxCancel
+
+	go func() {
+		defer ctxCancel()
+
+		t := time.NewTicker(period)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				if !r.writeSlateSample(ctx, samples, step) {
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// writeSlateSample writes a sample of the slate, one RTP packet for each NALU,
+// after the last written sample.
+func (r *roomTrackRecorder) writeSlateSample(ctx context.Context, nalus [][]byte, step uint32) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// the slate has been stopped while waiting for the lock
+	if r.closed || ctx.Err() != nil {
+		return false
+	}
+
+	if r.paused {
+		return true
+	}
+
+	ts := r.lastTS + step
+
+	for i, nalu := range nalus {
+		err := r.writer.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				Version:   2,
+				Marker:    i == len(nalus)-1,
+				Timestamp: ts,
+			},
+			Payload: nalu,
+		})
+		if err != nil {
+			return false
+		}
+	}
+
+	r.lastTS = ts
+	r.last = time.Now()
+
+	return true
+}
+
+// stopSlate stops filling the recording with the slate.
+// It must be called with the mutex locked.
+func (r *roomTrackRecorder) stopSlate() {
+	if r.slateCancel != nil {
+		r.slateCancel()
+		r.slateCancel = nil
+	}
+}
+
+// startSlate fills the recordings of a publisher that disconnected with the slate,
+// until it resumes its session or duration has passed.
+func (r *Room) startSlate(session *webRTCSession, slate *roomSlate, duration time.Duration) {
+	if !r.recording {
+		return
+	}
+
+	r.recordersMutex.Lock()
+	defer r.recordersMutex.Unlock()
+
+	for _, rec := range r.recorders {
+		if rec.session == session.uuid {
+			rec.startSlate(slate, duration)
+		}
+	}
+}
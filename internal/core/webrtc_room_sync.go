@@ -0,0 +1,155 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+)
+
+const (
+	webrtcRoomSyncFileName = "sync.json"
+
+	// sender reports are stored at most once in this period, in order to
+	// allow to compensate clock drift without storing all of them.
+	webrtcRoomSyncReportInterval = 30 * time.Second
+)
+
+// ntpToTime converts a NTP timestamp of a RTCP sender report.
+func ntpToTime(v uint64) time.Time {
+	s := int64(v>>32) - 2208988800
+	ns := int64((v & 0xFFFFFFFF) * 1e9 >> 32)
+	return time.Unix(s, ns).UTC()
+}
+
+// roomSyncReport maps a RTP timestamp to the wallclock of the publisher,
+// as advertised by a RTCP sender report.
+type roomSyncReport struct {
+	NTPTime      time.Time `json:"ntpTime"`
+	RTPTimestamp uint32    `json:"rtpTimestamp"`
+}
+
+// roomSyncTrack contains the clock of a recorded track.
+// StartTime is the wallclock of the publisher at the first recorded sample.
+// Offset is the difference, in seconds, between StartTime and the StartTime
+// of the earliest track of the same session.
+type roomSyncTrack struct {
+	File              string           `json:"file"`
+	Session           uuid.UUID        `json:"session"`
+	Participant       string           `json:"participant"`
+	ClockRate         int              `json:"clockRate"`
+	FirstRTPTimestamp uint32           `json:"firstRTPTimestamp"`
+	StartTime         *time.Time       `json:"startTime"`
+	Offset            *float64         `json:"offset"`
+	SenderReports     []roomSyncReport `json:"senderReports"`
+}
+
+// roomSync allows to align the tracks recorded in a room with sample accuracy,
+// by using the clocks of publishers instead of the arrival time of packets.
+type roomSync struct {
+	Room   uuid.UUID        `json:"room"`
+	Tracks []*roomSyncTrack `json:"tracks"`
+}
+
+// writeSenderReport stores the mapping between RTP timestamps and wallclock
+// contained in a RTCP sender report.
+func (r *roomTrackRecorder) writeSenderReport(sr *rtcp.SenderReport) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// timestamps of resumed sessions are unrelated to the ones of reports.
+	if r.closed || r.reattached {
+		return
+	}
+
+	rep := roomSyncReport{
+		NTPTime:      ntpToTime(sr.NTPTime),
+		RTPTimestamp: sr.RTPTime,
+	}
+
+	if len(r.reports) != 0 &&
+		rep.NTPTime.Sub(r.reports[len(r.reports)-1].NTPTime) < webrtcRoomSyncReportInterval {
+		return
+	}
+
+	r.reports = append(r.reports, rep)
+}
+
+// syncTrack returns the clock of the track, or nil if nothing has been recorded.
+func (r *roomTrackRecorder) syncTrack() *roomSyncTrack {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.first.IsZero() {
+		return nil
+	}
+
+	t := &roomSyncTrack{
+		File:              filepath.Base(r.filename),
+		Session:           r.session,
+		Participant:       r.participant,
+		ClockRate:         r.clockRate,
+		FirstRTPTimestamp: r.firstTS,
+		SenderReports:     append([]roomSyncReport{}, r.reports...),
+	}
+
+	if len(r.reports) != 0 && r.clockRate != 0 {
+		rep := r.reports[0]
+		diff := time.Duration(int32(r.firstTS-rep.RTPTimestamp)) * time.Second / time.Duration(r.clockRate)
+		start := rep.NTPTime.Add(diff)
+		t.StartTime = &start
+	}
+
+	return t
+}
+
+func (r *Room) writeSync() (string, error) {
+	r.recordersMutex.Lock()
+	recorders := append([]*roomTrackRecorder(nil), r.recorders...)
+	r.recordersMutex.Unlock()
+
+	s := &roomSync{
+		Room:   r.uuid,
+		Tracks: []*roomSyncTrack{},
+	}
+
+	earliest := make(map[uuid.UUID]time.Time)
+
+	for _, rec := range recorders {
+		t := rec.syncTrack()
+		if t == nil {
+			continue
+		}
+
+		s.Tracks = append(s.Tracks, t)
+
+		if t.StartTime != nil {
+			if e, ok := earliest[t.Session]; !ok || t.StartTime.Before(e) {
+				earliest[t.Session] = *t.StartTime
+			}
+		}
+	}
+
+	for _, t := range s.Tracks {
+		if t.StartTime != nil {
+			offset := t.StartTime.Sub(earliest[t.Session]).Seconds()
+			t.Offset = &offset
+		}
+	}
+
+	enc, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	filename := filepath.Join(r.dir(), webrtcRoomSyncFileName)
+	err = os.WriteFile(filename, enc, 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
@@ -0,0 +1,1174 @@
+package core
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func readRoomEvents(t *testing.T, filename string) []roomEvent {
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var events []roomEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e roomEvent
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		require.NoError(t, err)
+		events = append(events, e)
+	}
+	require.NoError(t, scanner.Err())
+
+	return events
+}
+
+func TestRoomEventLog(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	roomID := uuid.New()
+	filename := roomEventLogFileName(dir, roomID)
+
+	l, err := newRoomEventLog(filename)
+	require.NoError(t, err)
+
+	sx := &webRTCSession{
+		uuid:     uuid.New(),
+		pathName: "mypath",
+		req: webRTCNewSessionReq{
+			pathName: "mypath",
+			publish:  true,
+		},
+	}
+
+	l.writeSession(roomEventJoin, sx)
+	l.write(roomEvent{Type: roomEventRecordStart})
+	l.writeError(errors.New("test error"))
+	l.write(roomEvent{Type: roomEventRecordStop})
+	l.write(roomTrackActiveEvent(sx, &webRTCIncomingTrack{mediaType: media.TypeVideo}, false))
+	sx.usage = newWebRTCSessionUsage(1000, 4000, 10*time.Second)
+	l.writeSession(roomEventLeave, sx)
+	l.close()
+
+	// events written after close are discarded
+	l.write(roomEvent{Type: roomEventError})
+
+	events := readRoomEvents(t, filename)
+	require.Len(t, events, 6)
+
+	for _, e := range events {
+		require.False(t, e.Time.IsZero())
+	}
+
+	require.Equal(t, roomEventJoin, events[0].Type)
+	require.Equal(t, &sx.uuid, events[0].Session)
+	require.Equal(t, "mypath", events[0].Path)
+	require.Equal(t, true, events[0].Publish)
+	require.Nil(t, events[0].Usage)
+	require.Equal(t, roomEventRecordStart, events[1].Type)
+	require.Equal(t, roomEventError, events[2].Type)
+	require.Equal(t, "test error", events[2].Message)
+	require.Equal(t, roomEventRecordStop, events[3].Type)
+	require.Equal(t, roomEventTrackMute, events[4].Type)
+	require.Equal(t, "video", events[4].Track)
+	require.Equal(t, roomEventLeave, events[5].Type)
+	require.Equal(t, &sx.uuid, events[5].Session)
+	require.Equal(t, &webRTCSessionUsage{
+		BytesReceived: 1000,
+		BytesSent:     4000,
+		Duration:      10,
+		Bitrate:       4000,
+	}, events[5].Usage)
+	require.Equal(t, "1000 bytes received, 4000 bytes sent in 10s, mean bitrate 4000 bit/s", events[5].Usage.String())
+}
+
+func TestRoomEventLogSharedDir(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	roomID1 := uuid.New()
+	roomID2 := uuid.New()
+	require.NotEqual(t, roomEventLogFileName(dir, roomID1), roomEventLogFileName(dir, roomID2))
+
+	// a room recreated with the same ID must not append to the previous timeline
+	for i := 0; i < 2; i++ {
+		l, err := newRoomEventLog(roomEventLogFileName(dir, roomID1))
+		require.NoError(t, err)
+		l.write(roomEvent{Type: roomEventRecordStart})
+		l.close()
+	}
+
+	l, err := newRoomEventLog(roomEventLogFileName(dir, roomID2))
+	require.NoError(t, err)
+	l.write(roomEvent{Type: roomEventRecordStop})
+	l.close()
+
+	events := readRoomEvents(t, roomEventLogFileName(dir, roomID1))
+	require.Len(t, events, 1)
+	require.Equal(t, roomEventRecordStart, events[0].Type)
+
+	events = readRoomEvents(t, roomEventLogFileName(dir, roomID2))
+	require.Len(t, events, 1)
+	require.Equal(t, roomEventRecordStop, events[0].Type)
+}
+
+type testRoomChatChannel struct {
+	msgs []roomChatMessage
+}
+
+func (c *testRoomChatChannel) SendText(s string) error {
+	var msg roomChatMessage
+	err := json.Unmarshal([]byte(s), &msg)
+	if err != nil {
+		return err
+	}
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+func TestRoomChat(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-chat")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := roomChatFileName(dir, uuid.New())
+
+	c, err := newRoomChat(filename, 2)
+	require.NoError(t, err)
+
+	sx1 := &webRTCSession{uuid: uuid.New(), req: webRTCNewSessionReq{pathName: "cam1"}}
+	sx2 := &webRTCSession{uuid: uuid.New(), req: webRTCNewSessionReq{pathName: "viewer", user: "coach"}}
+
+	ch1 := &testRoomChatChannel{}
+	c.addChannel(sx1, ch1)
+
+	c.onMessage(sx1, "one")
+	c.onMessage(sx1, "two")
+	c.onMessage(sx1, "three")
+
+	// messages are not sent back to the sender
+	require.Empty(t, ch1.msgs)
+
+	// participants that join later receive the last messages
+	ch2 := &testRoomChatChannel{}
+	c.addChannel(sx2, ch2)
+	require.Len(t, ch2.msgs, 2)
+	require.Equal(t, "two", ch2.msgs[0].Text)
+	require.Equal(t, "three", ch2.msgs[1].Text)
+	require.Equal(t, "cam1", ch2.msgs[1].Participant)
+	require.Equal(t, sx1.uuid, ch2.msgs[1].Session)
+
+	c.onMessage(sx2, "four")
+	require.Len(t, ch1.msgs, 1)
+	require.Equal(t, "four", ch1.msgs[0].Text)
+	require.Equal(t, "coach", ch1.msgs[0].Participant)
+
+	c.removeChannel(sx2)
+	c.onMessage(sx1, "five")
+	require.Len(t, ch2.msgs, 2)
+
+	c.close()
+
+	// messages sent after close are discarded
+	c.onMessage(sx1, "six")
+
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var texts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg roomChatMessage
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		require.NoError(t, err)
+		texts = append(texts, msg.Text)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, []string{"one", "two", "three", "four", "five"}, texts)
+}
+
+type testRoomMessagesChannel struct {
+	msgs []string
+}
+
+func (c *testRoomMessagesChannel) SendText(s string) error {
+	c.msgs = append(c.msgs, s)
+	return nil
+}
+
+func TestRoomSendMessage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-messages")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r := &Room{
+		uuid:      uuid.New(),
+		created:   time.Now(),
+		recordDir: dir,
+		messages:  newRoomMessages(),
+	}
+
+	sx1 := &webRTCSession{uuid: uuid.New()}
+	sx2 := &webRTCSession{uuid: uuid.New()}
+
+	ch1 := &testRoomMessagesChannel{}
+	r.messages.addChannel(sx1, ch1)
+	ch2 := &testRoomMessagesChannel{}
+	r.messages.addChannel(sx2, ch2)
+
+	// messages are not recorded when the room is not recording
+	err = r.sendMessage(`{"score":"1-0"}`)
+	require.NoError(t, err)
+	require.Nil(t, r.messages.file)
+
+	r.recording = true
+
+	r.messages.removeChannel(sx2)
+
+	err = r.sendMessage(`{"score":"2-0"}`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{`{"score":"1-0"}`, `{"score":"2-0"}`}, ch1.msgs)
+	require.Equal(t, []string{`{"score":"1-0"}`}, ch2.msgs)
+
+	require.Len(t, r.metadataFiles, 1)
+	require.Equal(t, r.uuid.String()+webrtcRoomMessagesFileSuffix, r.metadataFiles[0].File)
+	require.Equal(t, roomManifestFileTypeMetadata, r.metadataFiles[0].Type)
+
+	filename := r.messages.close()
+	require.Equal(t, filepath.Join(dir, r.uuid.String()+webrtcRoomMessagesFileSuffix), filename)
+
+	byts, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "{\"score\":\"2-0\"}\n", string(byts))
+}
+
+func TestRoomTrackActiveBroadcast(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r := &Room{
+		uuid:      uuid.New(),
+		created:   time.Now(),
+		recordDir: dir,
+		recording: true,
+		messages:  newRoomMessages(),
+	}
+
+	r.events, err = newRoomEventLog(roomEventLogFileName(dir, r.uuid))
+	require.NoError(t, err)
+
+	ch := &testRoomMessagesChannel{}
+	r.messages.addChannel(&webRTCSession{uuid: uuid.New()}, ch)
+
+	sx := &webRTCSession{
+		uuid:     uuid.New(),
+		pathName: "mypath",
+	}
+	track := &webRTCIncomingTrack{mediaType: media.TypeVideo}
+
+	r.onTrackActive(sx, track, false)
+	r.onTrackActive(sx, track, true)
+	r.events.close()
+
+	require.Len(t, ch.msgs, 2)
+
+	for i, typ := range []roomEventType{roomEventTrackMute, roomEventTrackUnmute} {
+		var e roomEvent
+		err = json.Unmarshal([]byte(ch.msgs[i]), &e)
+		require.NoError(t, err)
+		require.Equal(t, typ, e.Type)
+		require.Equal(t, &sx.uuid, e.Session)
+		require.Equal(t, "mypath", e.Path)
+		require.Equal(t, "video", e.Track)
+	}
+
+	events := readRoomEvents(t, roomEventLogFileName(dir, r.uuid))
+	require.Len(t, events, 2)
+	require.Equal(t, roomEventTrackMute, events[0].Type)
+
+	// events are not written into the metadata file of messages
+	require.Nil(t, r.messages.file)
+}
+
+func TestRoomManifest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	session1 := uuid.New()
+	session2 := uuid.New()
+
+	r := &Room{
+		uuid:      uuid.New(),
+		created:   start,
+		clubName:  "myclub",
+		eventName: "myevent",
+		recordDir: dir,
+		recorders: []*roomTrackRecorder{
+			{
+				filename:    filepath.Join(dir, "video.h264"),
+				fileType:    roomManifestFileTypeVideo,
+				codec:       "h264",
+				session:     session1,
+				participant: "cam1",
+				first:       start.Add(5 * time.Second),
+				last:        start.Add(65 * time.Second),
+			},
+			{
+				filename:    filepath.Join(dir, "audio.ogg"),
+				fileType:    roomManifestFileTypeAudio,
+				codec:       "opus",
+				session:     session2,
+				participant: "cam2",
+				first:       start.Add(2 * time.Second),
+				last:        start.Add(12500 * time.Millisecond),
+			},
+			{
+				// nothing has been recorded
+				filename: filepath.Join(dir, "empty.ogg"),
+				fileType: roomManifestFileTypeAudio,
+			},
+		},
+		metadataFiles: []*roomManifestFile{
+			{
+				File:        "metadata.jsonl",
+				Type:        roomManifestFileTypeMetadata,
+				Session:     session1,
+				Participant: "cam1",
+				StartOffset: 3,
+			},
+		},
+	}
+
+	filename, err := r.writeManifest()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, webrtcRoomManifestFileName), filename)
+
+	byts, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	var manifest roomManifest
+	err = json.Unmarshal(byts, &manifest)
+	require.NoError(t, err)
+
+	require.Equal(t, roomManifest{
+		Room:  r.uuid,
+		Club:  "myclub",
+		Event: "myevent",
+		Start: start,
+		Files: []*roomManifestFile{
+			{
+				File:        "audio.ogg",
+				Type:        roomManifestFileTypeAudio,
+				Codec:       "opus",
+				Session:     session2,
+				Participant: "cam2",
+				StartOffset: 2,
+				Duration:    10.5,
+			},
+			{
+				File:        "metadata.jsonl",
+				Type:        roomManifestFileTypeMetadata,
+				Session:     session1,
+				Participant: "cam1",
+				StartOffset: 3,
+			},
+			{
+				File:        "video.h264",
+				Type:        roomManifestFileTypeVideo,
+				Codec:       "h264",
+				Session:     session1,
+				Participant: "cam1",
+				StartOffset: 5,
+				Duration:    60,
+			},
+		},
+	}, manifest)
+}
+
+func TestRoomParticipant(t *testing.T) {
+	sx := &webRTCSession{req: webRTCNewSessionReq{pathName: "cam1"}}
+	require.Equal(t, "cam1", roomParticipant(sx))
+
+	sx.req.user = "coach"
+	require.Equal(t, "coach", roomParticipant(sx))
+
+	sx.uuid = uuid.MustParse("6f1e2c3a-7a4b-4c8e-9d0f-1a2b3c4d5e6f")
+	require.Equal(t, "6f1e2c3a-7a4b-4c8e-9d0f-1a2b3c4d5e6f", roomFilePrefix(sx))
+
+	sx.req.participantName = "Léa Martin"
+	require.Equal(t, "Léa Martin", roomParticipant(sx))
+	require.Equal(t, "Léa-Martin-6f1e2c3a-7a4b-4c8e-9d0f-1a2b3c4d5e6f", roomFilePrefix(sx))
+}
+
+func TestWebRTCParticipantIdentity(t *testing.T) {
+	name, id, err := webrtcParticipantIdentity("participantName=L%C3%A9a&participantID=42", "")
+	require.NoError(t, err)
+	require.Equal(t, "Léa", name)
+	require.Equal(t, "42", id)
+
+	// claims of JWTs take precedence over the query
+	token := "eyJhbGciOiJIUzI1NiJ9." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"participantName":"Tom","participantID":1234}`)) +
+		".c2lnbmF0dXJl"
+	name, id, err = webrtcParticipantIdentity("participantName=L%C3%A9a", token)
+	require.NoError(t, err)
+	require.Equal(t, "Tom", name)
+	require.Equal(t, "1234", id)
+
+	// other tokens are ignored
+	name, id, err = webrtcParticipantIdentity("participantName=L%C3%A9a", "user:pass")
+	require.NoError(t, err)
+	require.Equal(t, "Léa", name)
+	require.Equal(t, "", id)
+
+	_, _, err = webrtcParticipantIdentity("participantName=a%2Fb", "")
+	require.EqualError(t, err, "invalid participant name: name contains an invalid character: '/'")
+}
+
+func TestRoomRecordConfWithS3Overrides(t *testing.T) {
+	base := roomRecordConf{
+		region:             "eu-west-3",
+		s3Endpoint:         "https://s3.example.com",
+		s3AccessKeyID:      "serverid",
+		s3SecretKey:        "serversecret",
+		s3SkipTLSVerify:    true,
+		s3AllowedEndpoints: []string{"https://minio.example.com"},
+	}
+
+	str := func(v string) *string { return &v }
+	boolean := func(v bool) *bool { return &v }
+
+	for _, ca := range []struct {
+		name      string
+		overrides *apiWebRTCRoomS3
+		conf      roomRecordConf
+	}{
+		{
+			"none",
+			nil,
+			base,
+		},
+		{
+			"region and bucket",
+			&apiWebRTCRoomS3{
+				Region:    str("us-east-1"),
+				Bucket:    str("mybucket"),
+				PathStyle: boolean(true),
+			},
+			func() roomRecordConf {
+				c := base
+				c.region = "us-east-1"
+				c.bucket = "mybucket"
+				c.s3PathStyle = true
+				return c
+			}(),
+		},
+		{
+			"credentials",
+			&apiWebRTCRoomS3{
+				AccessKeyID: str("myid"),
+				SecretKey:   str("mysecret"),
+			},
+			func() roomRecordConf {
+				c := base
+				c.s3AccessKeyID = "myid"
+				c.s3SecretKey = "mysecret"
+				return c
+			}(),
+		},
+		{
+			"allowed endpoint",
+			&apiWebRTCRoomS3{
+				Endpoint:    str("https://minio.example.com"),
+				AccessKeyID: str("myid"),
+				SecretKey:   str("mysecret"),
+			},
+			func() roomRecordConf {
+				c := base
+				c.s3Endpoint = "https://minio.example.com"
+				c.s3AccessKeyID = "myid"
+				c.s3SecretKey = "mysecret"
+				c.s3SkipTLSVerify = false
+				return c
+			}(),
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			c, err := base.withS3Overrides(ca.overrides)
+			require.NoError(t, err)
+			require.Equal(t, ca.conf, c)
+		})
+	}
+
+	for _, ca := range []struct {
+		name      string
+		overrides *apiWebRTCRoomS3
+		err       string
+	}{
+		{
+			"skip tls verify",
+			&apiWebRTCRoomS3{
+				SkipTLSVerify: boolean(true),
+			},
+			"'skipTLSVerify' can't be set for a single room",
+		},
+		{
+			"access key without secret",
+			&apiWebRTCRoomS3{
+				AccessKeyID: str("myid"),
+			},
+			"'accessKeyID' and 'secretKey' must be set together",
+		},
+		{
+			"endpoint not allowed",
+			&apiWebRTCRoomS3{
+				Endpoint:    str("http://169.254.169.254"),
+				AccessKeyID: str("myid"),
+				SecretKey:   str("mysecret"),
+			},
+			"endpoint 'http://169.254.169.254' is not allowed",
+		},
+		{
+			"endpoint without credentials",
+			&apiWebRTCRoomS3{
+				Endpoint: str("https://minio.example.com"),
+			},
+			"'accessKeyID' and 'secretKey' are required when 'endpoint' is set",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := base.withS3Overrides(ca.overrides)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestRoomRecordConfWithBucketRules(t *testing.T) {
+	c := roomRecordConf{
+		region: "eu-west-3",
+		buckets: []conf.WebRTCRecordBucket{
+			{ClubPrefix: "acme", Bucket: "acme-recordings", Region: "us-east-1"},
+			{ClubPrefix: "ac", Bucket: "ac-recordings"},
+			{ClubPrefix: "", Bucket: "shared-recordings", Region: "eu-central-1"},
+		},
+	}
+
+	for _, ca := range []struct {
+		club   string
+		bucket string
+		region string
+	}{
+		{"acme-west", "acme-recordings", "us-east-1"},
+		{"acorn", "ac-recordings", "eu-west-3"},
+		{"other", "shared-recordings", "eu-central-1"},
+	} {
+		t.Run(ca.club, func(t *testing.T) {
+			rc := c.withBucketRules(ca.club)
+			require.Equal(t, ca.bucket, rc.bucket)
+			require.Equal(t, ca.region, rc.region)
+		})
+	}
+
+	c.buckets = c.buckets[:1]
+	rc := c.withBucketRules("other")
+	require.Equal(t, "", rc.bucket)
+	require.Equal(t, "eu-west-3", rc.region)
+}
+
+func TestS3CreateBucketInput(t *testing.T) {
+	input := s3CreateBucketInput("mybucket", "eu-west-3")
+	require.Equal(t, "mybucket", *input.Bucket)
+	require.Equal(t, types.BucketLocationConstraint("eu-west-3"),
+		input.CreateBucketConfiguration.LocationConstraint)
+
+	input = s3CreateBucketInput("mybucket", "us-east-1")
+	require.Equal(t, "mybucket", *input.Bucket)
+	require.Nil(t, input.CreateBucketConfiguration)
+}
+
+func TestRoomViewers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-viewers")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r := &Room{
+		streamers: map[string]*streamer{"cam1": {}, "cam2": {}},
+		sessions: map[*webRTCSession]struct{}{
+			{req: webRTCNewSessionReq{pathName: "cam1", publish: true}}: {},
+			{req: webRTCNewSessionReq{pathName: "cam1"}}:                {},
+			{req: webRTCNewSessionReq{pathName: "cam1"}}:                {},
+		},
+		viewers: newRoomViewers(2),
+	}
+
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		r.sampleViewers(start.Add(time.Duration(i) * webrtcRoomViewersSampleInterval))
+	}
+
+	// the oldest sample has been overwritten
+	samples := r.viewers.all()
+	require.Len(t, samples, 2)
+	require.Equal(t, start.Add(webrtcRoomViewersSampleInterval), samples[0].time)
+	require.Equal(t, map[string]int{"cam1": 2, "cam2": 0}, samples[1].readers)
+
+	filename := filepath.Join(dir, "viewers.csv")
+	err = r.viewers.writeCSV(filename)
+	require.NoError(t, err)
+
+	byts, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "time,path,readers\n"+
+		"2023-05-01T10:00:10Z,cam1,2\n"+
+		"2023-05-01T10:00:10Z,cam2,0\n"+
+		"2023-05-01T10:00:20Z,cam1,2\n"+
+		"2023-05-01T10:00:20Z,cam2,0\n", string(byts))
+}
+
+func TestRoomAnalyticsNetworkOf(t *testing.T) {
+	require.Equal(t, "192.168.3.0/24", roomAnalyticsNetworkOf("192.168.3.45:5000"))
+	require.Equal(t, "2001:db8:1::/48", roomAnalyticsNetworkOf("[2001:db8:1:2::1]:5000"))
+	require.Equal(t, "", roomAnalyticsNetworkOf("invalid"))
+}
+
+func TestRoomAnalytics(t *testing.T) {
+	a := newRoomAnalytics()
+
+	sx1 := &webRTCSession{uuid: uuid.New(), req: webRTCNewSessionReq{pathName: "cam1", remoteAddr: "10.0.0.1:1000"}}
+	sx2 := &webRTCSession{uuid: uuid.New(), req: webRTCNewSessionReq{pathName: "cam1", remoteAddr: "10.0.0.2:1000"}}
+	sx3 := &webRTCSession{uuid: uuid.New(), req: webRTCNewSessionReq{pathName: "cam2", remoteAddr: "10.0.1.1:1000"}}
+
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	a.readerJoined(sx1, start)
+	a.readerJoined(sx2, start.Add(10*time.Second))
+	a.readerLeft(sx1, start.Add(20*time.Second))
+	a.readerJoined(sx3, start.Add(30*time.Second))
+	a.readerLeft(sx3, start.Add(40*time.Second))
+
+	roomID := uuid.New()
+	rep := a.report(roomID, start, start.Add(60*time.Second))
+
+	require.Equal(t, roomID, rep.Room)
+	require.Equal(t, 3, rep.TotalReaders)
+	require.Equal(t, 2, rep.PeakConcurrency)
+	require.Equal(t, start.Add(10*time.Second), *rep.PeakTime)
+	require.Equal(t, float64(20+50+10)/3, rep.AverageDuration)
+	require.Equal(t, []*roomAnalyticsNetwork{
+		{Network: "10.0.0.0/24", Readers: 2},
+		{Network: "10.0.1.0/24", Readers: 1},
+	}, rep.Networks)
+
+	// readers that are still active are not modified
+	require.Nil(t, rep.Readers[1].Left)
+	require.Equal(t, float64(50), rep.Readers[1].Duration)
+	require.Equal(t, float64(0), a.readers[1].Duration)
+}
+
+type testRTPWriter struct {
+	pkts []*rtp.Packet
+}
+
+func (w *testRTPWriter) WriteRTP(pkt *rtp.Packet) error {
+	w.pkts = append(w.pkts, pkt)
+	return nil
+}
+
+func (w *testRTPWriter) Close() error {
+	return nil
+}
+
+func TestRoomTrackRecorderPause(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xc0, 0x28}
+	nonIDR := []byte{0x41, 0x9a, 0x00, 0x00}
+
+	w := &testRTPWriter{}
+	r := &roomTrackRecorder{
+		fileType: roomManifestFileTypeVideo,
+		writer:   w,
+	}
+
+	err := r.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 1000}, Payload: sps})
+	require.NoError(t, err)
+
+	r.setPaused(true)
+
+	err = r.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 2000}, Payload: sps})
+	require.NoError(t, err)
+
+	r.setPaused(false)
+
+	// video is resumed from a key frame
+	err = r.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 91000}, Payload: nonIDR})
+	require.NoError(t, err)
+
+	pkt := &rtp.Packet{Header: rtp.Header{Timestamp: 91000}, Payload: sps}
+	err = r.writeRTP(pkt)
+	require.NoError(t, err)
+
+	err = r.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 94000}, Payload: nonIDR})
+	require.NoError(t, err)
+
+	// the pause is removed from timestamps, without editing received packets
+	require.Len(t, w.pkts, 3)
+	require.Equal(t, uint32(1000), w.pkts[0].Timestamp)
+	require.Equal(t, uint32(1000), w.pkts[1].Timestamp)
+	require.Equal(t, uint32(4000), w.pkts[2].Timestamp)
+	require.Equal(t, uint32(91000), pkt.Timestamp)
+}
+
+func TestLoadRoomSlate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-slate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "slate.h264")
+	err = os.WriteFile(filename, []byte{
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xc0, 0x28,
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x3c, 0x80,
+		0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00,
+	}, 0o644)
+	require.NoError(t, err)
+
+	slate, err := loadRoomSlate(filename, 25)
+	require.NoError(t, err)
+	require.Equal(t, &roomSlate{
+		au: [][]byte{
+			{0x67, 0x42, 0xc0, 0x28},
+			{0x68, 0xce, 0x3c, 0x80},
+			{0x65, 0x88, 0x84, 0x00},
+		},
+		frameRate: 25,
+	}, slate)
+
+	err = os.WriteFile(filename, []byte{0x00, 0x00, 0x00, 0x01, 0x41, 0x9a, 0x00, 0x00}, 0o644)
+	require.NoError(t, err)
+
+	_, err = loadRoomSlate(filename, 25)
+	require.EqualError(t, err, "invalid slate: IDR not found")
+}
+
+func TestRoomTrackRecorderSlate(t *testing.T) {
+	slate := &roomSlate{
+		au:        [][]byte{{0x67, 0x42, 0xc0, 0x28}, {0x65, 0x88, 0x84, 0x00}},
+		frameRate: 50,
+	}
+
+	w := &testRTPWriter{}
+	r := &roomTrackRecorder{
+		fileType: roomManifestFileTypeVideo,
+		codec:    "h264",
+		writer:   w,
+	}
+
+	// nothing is written before the first packet
+	r.startSlate(slate, 10*time.Second)
+	require.Nil(t, r.slateCancel)
+
+	err := r.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 1000, Marker: true}, Payload: slate.au[1]})
+	require.NoError(t, err)
+
+	r.startSlate(slate, 10*time.Second)
+
+	require.Eventually(t, func() bool {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return len(w.pkts) >= 5
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.True(t, r.reattach())
+
+	n := len(w.pkts)
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, w.pkts, n)
+
+	// samples are written after the last one, one packet for each NALU
+	require.Equal(t, uint32(1000+1800), w.pkts[1].Timestamp)
+	require.False(t, w.pkts[1].Marker)
+	require.Equal(t, uint32(1000+1800), w.pkts[2].Timestamp)
+	require.True(t, w.pkts[2].Marker)
+	require.Equal(t, uint32(1000+2*1800), w.pkts[3].Timestamp)
+}
+
+func TestNTPToTime(t *testing.T) {
+	require.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 500000000, time.UTC),
+		ntpToTime(uint64(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC).Unix()+2208988800)<<32|0x80000000))
+}
+
+func TestRoomSync(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-sync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ntp := func(t time.Time) uint64 {
+		return uint64(t.Unix()+2208988800) << 32
+	}
+
+	sessionID := uuid.New()
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	video := &roomTrackRecorder{
+		filename:    filepath.Join(dir, "video.h264"),
+		fileType:    roomManifestFileTypeVideo,
+		session:     sessionID,
+		participant: "cam1",
+		clockRate:   90000,
+		writer:      &testRTPWriter{},
+	}
+
+	audio := &roomTrackRecorder{
+		filename:    filepath.Join(dir, "audio.ogg"),
+		fileType:    roomManifestFileTypeAudio,
+		session:     sessionID,
+		participant: "cam1",
+		clockRate:   48000,
+		writer:      &testRTPWriter{},
+	}
+
+	unsynced := &roomTrackRecorder{
+		filename:  filepath.Join(dir, "other.ogg"),
+		session:   uuid.New(),
+		clockRate: 48000,
+		writer:    &testRTPWriter{},
+	}
+
+	// video starts 1s after the report, audio 0.5s after the report
+	video.writeSenderReport(&rtcp.SenderReport{NTPTime: ntp(start), RTPTime: 10000})
+	err = video.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 100000}, Payload: []byte{1}})
+	require.NoError(t, err)
+
+	audio.writeSenderReport(&rtcp.SenderReport{NTPTime: ntp(start), RTPTime: 5000})
+	err = audio.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 29000}, Payload: []byte{1}})
+	require.NoError(t, err)
+
+	// reports are stored at most once in a period
+	audio.writeSenderReport(&rtcp.SenderReport{NTPTime: ntp(start.Add(time.Second)), RTPTime: 53000})
+	audio.writeSenderReport(&rtcp.SenderReport{NTPTime: ntp(start.Add(40 * time.Second)), RTPTime: 1925000})
+
+	err = unsynced.writeRTP(&rtp.Packet{Header: rtp.Header{Timestamp: 1}, Payload: []byte{1}})
+	require.NoError(t, err)
+
+	r := &Room{
+		uuid:      uuid.New(),
+		recordDir: dir,
+		recorders: []*roomTrackRecorder{video, audio, unsynced},
+	}
+
+	filename, err := r.writeSync()
+	require.NoError(t, err)
+
+	byts, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	var s roomSync
+	err = json.Unmarshal(byts, &s)
+	require.NoError(t, err)
+
+	require.Equal(t, r.uuid, s.Room)
+	require.Len(t, s.Tracks, 3)
+
+	require.Equal(t, "video.h264", s.Tracks[0].File)
+	require.Equal(t, start.Add(time.Second), *s.Tracks[0].StartTime)
+	require.Equal(t, 0.5, *s.Tracks[0].Offset)
+
+	require.Equal(t, start.Add(500*time.Millisecond), *s.Tracks[1].StartTime)
+	require.Equal(t, float64(0), *s.Tracks[1].Offset)
+	require.Equal(t, uint32(29000), s.Tracks[1].FirstRTPTimestamp)
+	require.Len(t, s.Tracks[1].SenderReports, 2)
+
+	require.Nil(t, s.Tracks[2].StartTime)
+	require.Nil(t, s.Tracks[2].Offset)
+}
+
+func TestRoomRecordingPause(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-pause")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r := &Room{
+		uuid:      uuid.New(),
+		created:   time.Now(),
+		recordDir: dir,
+	}
+
+	r.events, err = newRoomEventLog(roomEventLogFileName(dir, r.uuid))
+	require.NoError(t, err)
+
+	err = r.setRecordingPaused(true)
+	require.EqualError(t, err, "room is not recording")
+
+	r.recording = true
+
+	err = r.setRecordingPaused(false)
+	require.EqualError(t, err, "recording is not paused")
+
+	err = r.setRecordingPaused(true)
+	require.NoError(t, err)
+	require.True(t, r.apiItem().RecordingPaused)
+
+	err = r.setRecordingPaused(true)
+	require.EqualError(t, err, "recording is already paused")
+
+	// recorders added during a pause start paused
+	rec := &roomTrackRecorder{writer: &testRTPWriter{}}
+	r.addRecorder(rec)
+	require.True(t, rec.paused)
+
+	err = r.setRecordingPaused(false)
+	require.NoError(t, err)
+	require.False(t, rec.paused)
+
+	err = r.setRecordingPaused(true)
+	require.NoError(t, err)
+
+	filename, err := r.writeManifest()
+	require.NoError(t, err)
+
+	byts, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	var manifest roomManifest
+	err = json.Unmarshal(byts, &manifest)
+	require.NoError(t, err)
+
+	// the pause in progress is reported too
+	require.Len(t, manifest.Gaps, 2)
+
+	r.events.close()
+
+	events := readRoomEvents(t, r.events.filename)
+	require.Len(t, events, 3)
+	require.Equal(t, roomEventRecordPause, events[0].Type)
+	require.Equal(t, roomEventRecordResume, events[1].Type)
+	require.Equal(t, roomEventRecordPause, events[2].Type)
+}
+
+func TestRoomApplyOverlay(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-overlay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	session := uuid.New()
+
+	newRoom := func(cmd string) (*Room, *roomTrackRecorder) {
+		filename := filepath.Join(dir, session.String()+"-video.h264")
+		err := os.WriteFile(filename, []byte("video"), 0o644)
+		require.NoError(t, err)
+
+		return &Room{
+			uuid:      uuid.New(),
+			clubName:  "myclub",
+			eventName: "myevent",
+			recordConf: roomRecordConf{
+				overlayCommand: cmd,
+				overlayTimeout: 10 * time.Second,
+			},
+		}, &roomTrackRecorder{
+			filename: filename,
+			fileType: roomManifestFileTypeVideo,
+			session:  session,
+			first:    time.Now(),
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		r, rec := newRoom("sh -c 'printf %s $MTX_CLUB-$MTX_SESSION_ID > $MTX_OUTPUT'")
+
+		err := r.applyOverlay(rec)
+		require.NoError(t, err)
+
+		require.Equal(t, filepath.Join(dir, session.String()+"-video"+webrtcRecordOverlayFileSuffix), rec.filename)
+
+		byts, err := os.ReadFile(rec.filename)
+		require.NoError(t, err)
+		require.Equal(t, "myclub-"+session.String(), string(byts))
+
+		_, err = os.Stat(filepath.Join(dir, session.String()+"-video.h264"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		r, rec := newRoom("sh -c 'touch $MTX_OUTPUT; exit 1'")
+		original := rec.filename
+
+		err := r.applyOverlay(rec)
+		require.Error(t, err)
+		require.Equal(t, original, rec.filename)
+
+		_, err = os.Stat(original)
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(dir, session.String()+"-video"+webrtcRecordOverlayFileSuffix))
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestRoomApplyLoudness(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-loudness")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	session := uuid.New()
+
+	newRoom := func(cmd string) (*Room, *roomTrackRecorder) {
+		filename := filepath.Join(dir, session.String()+"-audio.ogg")
+		err := os.WriteFile(filename, []byte("audio"), 0o644)
+		require.NoError(t, err)
+
+		return &Room{
+			uuid:      uuid.New(),
+			clubName:  "myclub",
+			eventName: "myevent",
+			recordConf: roomRecordConf{
+				overlayTimeout:  10 * time.Second,
+				loudnessCommand: cmd,
+				loudnessTarget:  -16,
+			},
+		}, &roomTrackRecorder{
+			filename: filename,
+			fileType: roomManifestFileTypeAudio,
+			session:  session,
+			first:    time.Now(),
+		}
+	}
+
+	t.Run("measure", func(t *testing.T) {
+		r, rec := newRoom("sh -c 'echo \"I: -30.5 LUFS\" 1>&2; echo \"I: -18.2 LUFS\" 1>&2'")
+		original := rec.filename
+
+		err := r.applyLoudness(rec)
+		require.NoError(t, err)
+		require.Equal(t, original, rec.filename)
+		require.NotNil(t, rec.loudness)
+		require.Equal(t, -18.2, *rec.loudness)
+	})
+
+	t.Run("normalize", func(t *testing.T) {
+		r, rec := newRoom("sh -c 'printf %s $MTX_LOUDNESS_TARGET > $MTX_OUTPUT'")
+
+		err := r.applyLoudness(rec)
+		require.NoError(t, err)
+		require.Nil(t, rec.loudness)
+
+		require.Equal(t, filepath.Join(dir, session.String()+"-audio"+webrtcRecordLoudnessFileSuffix), rec.filename)
+
+		byts, err := os.ReadFile(rec.filename)
+		require.NoError(t, err)
+		require.Equal(t, "-16", string(byts))
+
+		_, err = os.Stat(filepath.Join(dir, session.String()+"-audio.ogg"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		r, rec := newRoom("sh -c 'touch $MTX_OUTPUT; exit 1'")
+		original := rec.filename
+
+		err := r.applyLoudness(rec)
+		require.Error(t, err)
+		require.Equal(t, original, rec.filename)
+
+		_, err = os.Stat(filepath.Join(dir, session.String()+"-audio"+webrtcRecordLoudnessFileSuffix))
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestRoomRecordTracks(t *testing.T) {
+	r := &Room{
+		recording: true,
+		recordConf: roomRecordConf{
+			tracks: conf.WebRTCRecordTracks{"audio", "video", "metadata"},
+		},
+	}
+
+	r.recordConf = r.recordConf.withProfile(&conf.WebRTCRoomProfile{})
+	require.True(t, r.recordsTrack(roomManifestFileTypeVideo))
+	require.True(t, r.recordingMetadata())
+
+	r.recordConf = r.recordConf.withProfile(&conf.WebRTCRoomProfile{
+		RecordTracks: conf.WebRTCRecordTracks{"audio"},
+	})
+	require.True(t, r.recordsTrack(roomManifestFileTypeAudio))
+	require.False(t, r.recordsTrack(roomManifestFileTypeVideo))
+	require.False(t, r.recordsTrack(roomManifestFileTypeMetadata))
+	require.False(t, r.recordingMetadata())
+
+	r.recordConf = r.recordConf.withProfile(&conf.WebRTCRoomProfile{
+		RecordTracks: conf.WebRTCRecordTracks{},
+	})
+	require.False(t, r.recordsTrack(roomManifestFileTypeAudio))
+}
+
+func TestRoomQuotas(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-room-quota")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r := &Room{
+		parent:    nilLogger{},
+		uuid:      uuid.New(),
+		created:   time.Now(),
+		recordDir: dir,
+		recording: true,
+		sessions:  make(map[*webRTCSession]struct{}),
+	}
+
+	r.events, err = newRoomEventLog(roomEventLogFileName(dir, r.uuid))
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "video.h264")
+	err = os.WriteFile(filename, make([]byte, 2000), 0o644)
+	require.NoError(t, err)
+
+	rec := &roomTrackRecorder{filename: filename, writer: &testRTPWriter{}}
+	r.addRecorder(rec)
+
+	r.quota.closedEgress = 5000
+
+	r.checkQuotas(roomQuotaConf{maxEgress: 10000, maxRecordSize: 3000})
+	require.False(t, r.quota.egressExceeded)
+	require.False(t, r.recordingStopped())
+	require.Equal(t, uint64(5000), r.apiItem().EgressBytes)
+	require.Equal(t, uint64(2000), r.apiItem().RecordedBytes)
+
+	r.checkQuotas(roomQuotaConf{maxEgress: 5000, maxRecordSize: 2000})
+	require.True(t, r.quota.egressExceeded)
+	require.True(t, r.recordingStopped())
+	require.True(t, rec.closed)
+	require.False(t, r.recordingMetadata())
+
+	// recording is stopped permanently, while readers are accepted again when the quota is raised
+	r.checkQuotas(roomQuotaConf{})
+	require.False(t, r.quota.egressExceeded)
+	require.True(t, r.recordingStopped())
+
+	events := readRoomEvents(t, roomEventLogFileName(dir, r.uuid))
+	require.Len(t, events, 2)
+	require.Equal(t, roomEventQuotaExceeded, events[0].Type)
+	require.Equal(t, "egress", events[0].Message)
+	require.Equal(t, roomEventQuotaExceeded, events[1].Type)
+	require.Equal(t, "record size", events[1].Message)
+}
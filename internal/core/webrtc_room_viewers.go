@@ -0,0 +1,99 @@
+package core
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	webrtcRoomViewersSampleInterval = 10 * time.Second
+	webrtcRoomViewersMaxSamples     = 8640 // 24h
+	webrtcRoomViewersFileSuffix     = "-viewers.csv"
+)
+
+type roomViewersSample struct {
+	time    time.Time
+	readers map[string]int // path name -> reader count
+}
+
+// roomViewers keeps the most recent reader counts of the paths of a room,
+// in order to provide a viewership curve.
+type roomViewers struct {
+	size    int
+	samples []*roomViewersSample
+	next    int
+}
+
+func newRoomViewers(size int) *roomViewers {
+	return &roomViewers{
+		size: size,
+	}
+}
+
+func (v *roomViewers) add(s *roomViewersSample) {
+	if len(v.samples) < v.size {
+		v.samples = append(v.samples, s)
+		return
+	}
+
+	// the buffer is full, overwrite the oldest sample
+	v.samples[v.next] = s
+	v.next = (v.next + 1) % v.size
+}
+
+// all returns samples sorted by date.
+func (v *roomViewers) all() []*roomViewersSample {
+	ret := make([]*roomViewersSample, 0, len(v.samples))
+	ret = append(ret, v.samples[v.next:]...)
+	ret = append(ret, v.samples[:v.next]...)
+	return ret
+}
+
+// roomViewersFileName returns the path of the viewership curve of a room.
+func roomViewersFileName(dir string, roomID uuid.UUID) string {
+	return filepath.Join(dir, roomID.String()+webrtcRoomViewersFileSuffix)
+}
+
+// writeCSV writes samples to a CSV file, with a row for each path of each sample.
+func (v *roomViewers) writeCSV(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+
+	err = w.Write([]string{"time", "path", "readers"})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range v.all() {
+		paths := make([]string, 0, len(s.readers))
+		for path := range s.readers {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			err = w.Write([]string{
+				s.time.UTC().Format(time.RFC3339),
+				path,
+				strconv.FormatInt(int64(s.readers[path]), 10),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
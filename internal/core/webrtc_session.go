@@ -3,25 +3,29 @@ package core
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
-	"github.com/bluenviron/gortsplib/v3/pkg/ringbuffer"
 	"github.com/google/uuid"
+	"github.com/pion/rtcp"
 	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
-	wrtcmedia "github.com/pion/webrtc/v3/pkg/media"
-	"github.com/pion/webrtc/v3/pkg/media/h264writer"
-	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
 
+	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
 	"github.com/bluenviron/mediamtx/internal/webrtcpc"
 )
 
@@ -53,51 +57,237 @@ func whipOffer(body []byte) *webrtc.SessionDescription {
 	}
 }
 
+// webrtcWaitUntilConnected waits until the ICE connection and the DTLS handshake
+// are complete, and traces them as children of span.
 func webrtcWaitUntilConnected(
 	ctx context.Context,
 	pc *webrtcpc.PeerConnection,
+	timeout time.Duration,
+	span *traceSpan,
 ) error {
-	t := time.NewTimer(webrtcHandshakeTimeout)
+	t := time.NewTimer(timeout)
 	defer t.Stop()
 
-outer:
+	step := span.startChild("ICE connection")
+	iceConnected := pc.ICEConnected()
+
 	for {
 		select {
 		case <-t.C:
-			return fmt.Errorf("deadline exceeded while waiting connection")
+			err := fmt.Errorf("deadline exceeded while waiting connection")
+			step.end(err)
+			return err
+
+		case <-iceConnected:
+			step.end(nil)
+			step = span.startChild("DTLS handshake")
+			iceConnected = nil
 
 		case <-pc.Connected():
-			break outer
+			step.end(nil)
+			return nil
 
 		case <-ctx.Done():
-			return fmt.Errorf("terminated")
+			err := fmt.Errorf("terminated")
+			step.end(err)
+			return err
 		}
 	}
+}
 
-	return nil
+func webrtcCodecOfFormat(forma formats.Format) string {
+	switch forma.(type) {
+	case *formats.AV1:
+		return "av1"
+	case *formats.VP9:
+		return "vp9"
+	case *formats.VP8:
+		return "vp8"
+	case *formats.H264:
+		return "h264"
+	case *formats.H265:
+		return "h265"
+	case *formats.Opus:
+		return "opus"
+	case *formats.G722:
+		return "g722"
+	case *formats.G711:
+		return "g711"
+	}
+	return ""
 }
 
-func webrtcGatherOutgoingTracks(medias media.Medias) ([]*webRTCOutgoingTrack, error) {
-	var tracks []*webRTCOutgoingTrack
+// webrtcReadMode selects the tracks sent to a reader.
+type webrtcReadMode int
+
+const (
+	webrtcReadModeAll webrtcReadMode = iota
+	webrtcReadModeVideo
+	webrtcReadModeAudio
+)
 
-	videoTrack, err := newWebRTCOutgoingTrackVideo(medias)
+// webrtcMaxVideoBitrate returns the video bitrate limit of a session, that is
+// the lowest between the one of the path (or the global one, when the path
+// doesn't set it) and the one requested with the "maxVideoBitrate" query parameter.
+// Zero means no limit.
+func webrtcMaxVideoBitrate(global int, pathConf *conf.PathConf, query string) (int, error) {
+	ret := global
+	if pathConf.WebRTCMaxVideoBitrate != 0 {
+		ret = pathConf.WebRTCMaxVideoBitrate
+	}
+
+	vals, err := url.ParseQuery(query)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	if videoTrack != nil {
-		tracks = append(tracks, videoTrack)
+	v := vals.Get("maxVideoBitrate")
+	if v == "" {
+		return ret, nil
+	}
+
+	tmp, err := strconv.ParseUint(v, 10, 31)
+	if err != nil || tmp == 0 {
+		return 0, fmt.Errorf("invalid maxVideoBitrate: '%s'", v)
 	}
 
-	audioTrack, err := newWebRTCOutgoingTrackAudio(medias)
+	if ret == 0 || int(tmp) < ret {
+		ret = int(tmp)
+	}
+
+	return ret, nil
+}
+
+// webrtcReadModeFromRequest returns the tracks requested by a reader,
+// with the "media" query parameter or with the media sections of the offer.
+func webrtcReadModeFromRequest(query string, offer *webrtc.SessionDescription) (webrtcReadMode, error) {
+	var sdp sdp.SessionDescription
+	err := sdp.Unmarshal([]byte(offer.SDP))
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	offerVideo := false
+	offerAudio := false
+	for _, media := range sdp.MediaDescriptions {
+		switch media.MediaName.Media {
+		case "video":
+			offerVideo = true
+		case "audio":
+			offerAudio = true
+		}
+	}
+
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	switch vals.Get("media") {
+	case "":
+		switch {
+		case offerVideo && !offerAudio:
+			return webrtcReadModeVideo, nil
+
+		case offerAudio && !offerVideo:
+			return webrtcReadModeAudio, nil
+		}
+		return webrtcReadModeAll, nil
+
+	case "video":
+		if !offerVideo {
+			return 0, fmt.Errorf("video has been requested but the offer doesn't contain a video section")
+		}
+		return webrtcReadModeVideo, nil
+
+	case "audio":
+		if !offerAudio {
+			return 0, fmt.Errorf("audio has been requested but the offer doesn't contain an audio section")
+		}
+		return webrtcReadModeAudio, nil
+
+	default:
+		return 0, fmt.Errorf("invalid media: '%s'", vals.Get("media"))
+	}
+}
+
+func webrtcGatherOutgoingTracksWithCodecs(
+	medias media.Medias,
+	codecs conf.WebRTCCodecs,
+	mode webrtcReadMode,
+) ([]*webRTCOutgoingTrack, error) {
+	var videoTrack *webRTCOutgoingTrack
+	var audioTrack *webRTCOutgoingTrack
+
+	for _, codec := range codecs {
+		if videoTrack == nil && mode != webrtcReadModeAudio {
+			var err error
+			videoTrack, err = newWebRTCOutgoingTrackVideo(medias, codec)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if audioTrack == nil && mode != webrtcReadModeVideo {
+			var err error
+			audioTrack, err = newWebRTCOutgoingTrackAudio(medias, codec)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var tracks []*webRTCOutgoingTrack
+
+	if videoTrack != nil {
+		tracks = append(tracks, videoTrack)
 	}
 
 	if audioTrack != nil {
 		tracks = append(tracks, audioTrack)
 	}
 
+	if tracks == nil {
+		return nil, fmt.Errorf(
+			"the stream doesn't contain any of the allowed codecs, which are %s", strings.Join(codecs, ", "))
+	}
+
+	return tracks, nil
+}
+
+func webrtcGatherOutgoingTracks(
+	medias media.Medias,
+	codecs conf.WebRTCCodecs,
+	mode webrtcReadMode,
+) ([]*webRTCOutgoingTrack, error) {
+	if len(codecs) != 0 {
+		return webrtcGatherOutgoingTracksWithCodecs(medias, codecs, mode)
+	}
+
+	var tracks []*webRTCOutgoingTrack
+
+	if mode != webrtcReadModeAudio {
+		videoTrack, err := newWebRTCOutgoingTrackVideo(medias, "")
+		if err != nil {
+			return nil, err
+		}
+
+		if videoTrack != nil {
+			tracks = append(tracks, videoTrack)
+		}
+	}
+
+	if mode != webrtcReadModeVideo {
+		audioTrack, err := newWebRTCOutgoingTrackAudio(medias, "")
+		if err != nil {
+			return nil, err
+		}
+
+		if audioTrack != nil {
+			tracks = append(tracks, audioTrack)
+		}
+	}
+
 	if tracks == nil {
 		return nil, fmt.Errorf(
 			"the stream doesn't contain any supported codec, which are currently AV1, VP9, VP8, H264, Opus, G722, G711")
@@ -106,6 +296,45 @@ func webrtcGatherOutgoingTracks(medias media.Medias) ([]*webRTCOutgoingTrack, er
 	return tracks, nil
 }
 
+// webrtcSetCodecPreferences removes from the answer all codecs
+// that are not used by outgoing tracks.
+// opusFmtp must be the same fmtp line used when registering codecs.
+// When fec is true, FEC codecs are kept in video sections.
+func webrtcSetCodecPreferences(
+	pc *webrtcpc.PeerConnection,
+	tracks []*webRTCOutgoingTrack,
+	opusFmtp string,
+	fec bool,
+) error {
+	allCodecs := append(append([]webrtc.RTPCodecParameters(nil), videoCodecs...), webrtcAudioCodecs(opusFmtp)...)
+
+	for _, tr := range pc.GetTransceivers() {
+		for _, track := range tracks {
+			if tr.Sender() != track.sender {
+				continue
+			}
+
+			var codecs []webrtc.RTPCodecParameters
+			for _, codec := range allCodecs {
+				if strings.EqualFold(codec.MimeType, track.track.Codec().MimeType) {
+					codecs = append(codecs, codec)
+				}
+			}
+
+			if fec && track.track.Kind() == webrtc.RTPCodecTypeVideo {
+				codecs = append(codecs, fecCodecs...)
+			}
+
+			err := tr.SetCodecPreferences(codecs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func webrtcTrackCount(medias []*sdp.MediaDescription) (int, error) {
 	videoTrack := false
 	audioTrack := false
@@ -113,6 +342,10 @@ func webrtcTrackCount(medias []*sdp.MediaDescription) (int, error) {
 	trackCount := 0
 
 	for _, media := range medias {
+		if !webrtcMediaDescriptionActive(media) {
+			continue
+		}
+
 		switch media.MediaName.Media {
 		case "video":
 			if videoTrack {
@@ -141,15 +374,73 @@ func webrtcTrackCount(medias []*sdp.MediaDescription) (int, error) {
 	return trackCount, nil
 }
 
+// webrtcMediaDescriptionActive checks whether a media section has been disabled
+// by setting its port to zero or its direction to inactive.
+func webrtcMediaDescriptionActive(md *sdp.MediaDescription) bool {
+	if md.MediaName.Port.Value == 0 {
+		return false
+	}
+	_, ok := md.Attribute("inactive")
+	return !ok
+}
+
+// webrtcActiveMids returns the mids of media sections that are not disabled.
+func webrtcActiveMids(medias []*sdp.MediaDescription) map[string]struct{} {
+	ret := make(map[string]struct{})
+	for _, md := range medias {
+		if md.MediaName.Media == "application" || !webrtcMediaDescriptionActive(md) {
+			continue
+		}
+		if mid, ok := md.Attribute("mid"); ok {
+			ret[mid] = struct{}{}
+		}
+	}
+	return ret
+}
+
+func webrtcIncomingTrackMid(pc *webrtcpc.PeerConnection, track *webRTCIncomingTrack) string {
+	for _, tr := range pc.GetTransceivers() {
+		if tr.Receiver() == track.receiver {
+			return tr.Mid()
+		}
+	}
+	return ""
+}
+
+// webrtcRenegotiate applies a new offer to an established peer connection
+// and returns the answer.
+func webrtcRenegotiate(
+	pc *webrtcpc.PeerConnection,
+	offer *webrtc.SessionDescription,
+) (*webrtc.SessionDescription, error) {
+	err := pc.SetRemoteDescription(*offer)
+	if err != nil {
+		return nil, err
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pc.SetLocalDescription(answer)
+	if err != nil {
+		return nil, err
+	}
+
+	return pc.LocalDescription(), nil
+}
+
 func webrtcGatherIncomingTracks(
 	ctx context.Context,
 	pc *webrtcpc.PeerConnection,
 	trackRecv chan trackRecvPair,
 	trackCount int,
+	timeout time.Duration,
 ) ([]*webRTCIncomingTrack, error) {
 	var tracks []*webRTCIncomingTrack
 
-	t := time.NewTimer(webrtcTrackGatherTimeout)
+	t := time.NewTimer(timeout)
 	defer t.Stop()
 
 	for {
@@ -180,68 +471,165 @@ func webrtcGatherIncomingTracks(
 	}
 }
 
+// webrtcGatherFirstIncomingTracks waits for the first track of a publisher, then waits
+// for the remaining ones for a short period only, in order to start publishing as soon
+// as possible. Tracks that arrive later are added by restarting the publisher.
+func webrtcGatherFirstIncomingTracks(
+	ctx context.Context,
+	pc *webrtcpc.PeerConnection,
+	trackRecv chan trackRecvPair,
+	trackCount int,
+	timeout time.Duration,
+) ([]*webRTCIncomingTrack, error) {
+	var tracks []*webRTCIncomingTrack
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	var grace *time.Timer
+	var graceC <-chan time.Time
+
+	defer func() {
+		if grace != nil {
+			grace.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-t.C:
+			if len(tracks) == 0 {
+				return nil, fmt.Errorf("deadline exceeded while waiting tracks")
+			}
+			return tracks, nil
+
+		case <-graceC:
+			return tracks, nil
+
+		case pair := <-trackRecv:
+			track, err := newWebRTCIncomingTrack(pair.track, pair.receiver, pc.WriteRTCP)
+			if err != nil {
+				return nil, err
+			}
+			tracks = append(tracks, track)
+
+			if len(tracks) == trackCount {
+				return tracks, nil
+			}
+
+			if grace == nil {
+				grace = time.NewTimer(webrtcTrackGatherGrace)
+				graceC = grace.C
+			}
+
+		case <-pc.Disconnected():
+			return nil, fmt.Errorf("peer connection closed")
+
+		case <-ctx.Done():
+			return nil, fmt.Errorf("terminated")
+		}
+	}
+}
+
 type webRTCSessionPathManager interface {
 	addPublisher(req pathAddPublisherReq) pathAddPublisherRes
 	addReader(req pathAddReaderReq) pathAddReaderRes
+	apiPathsGet(name string) (*apiPath, error)
 }
 
 type webRTCSession struct {
 	readBufferCount int
 	api             *webrtc.API
+	certificates    []webrtc.Certificate
 	req             webRTCNewSessionReq
+	iceServers      []conf.WebRTCICEServer // ICE servers of the room, if any
+	roomLogs        *roomLogs
 	wg              *sync.WaitGroup
 	pathManager     webRTCSessionPathManager
 	parent          *webRTCManager
-	writers         map[string]wrtcmedia.Writer
 	metadataFile    *File
+	metadataExport  *roomMetadataExport
+	dcLimiter       *webrtcDataChannelLimiter
 
 	ctx       context.Context
 	ctxCancel func()
 	created   time.Time
+	setupSpan *traceSpan
 	uuid      uuid.UUID
 	roomid    uuid.UUID
 	secret    uuid.UUID
 	mutex     sync.RWMutex
 	pc        *webrtcpc.PeerConnection
+	incoming  []*webRTCIncomingTrack
+	outgoing  []*webRTCOutgoingTrack
+	readBuf   *webrtcReaderBuffer
+	usage     *webRTCSessionUsage
+	capture   *webrtcCapture
+	standby   uint32 // a backup publisher that is not forwarded to readers
+	viewers   *int   // reader count of the path of a publisher
+	pathMutex sync.RWMutex
+	pathName  string // changed when the publisher is migrated to another path
 
 	chNew           chan webRTCNewSessionReq
 	chAddCandidates chan webRTCAddSessionCandidatesReq
+	chRenegotiate   chan webRTCRenegotiateSessionReq
+	chMigrate       chan webRTCMigrateSessionReq
+
+	done chan struct{}
 }
 
 func newWebRTCSession(
 	parentCtx context.Context,
 	readBufferCount int,
 	api *webrtc.API,
+	certificates []webrtc.Certificate,
 	req webRTCNewSessionReq,
+	iceServers []conf.WebRTCICEServer,
+	roomLogs *roomLogs,
 	wg *sync.WaitGroup,
 	pathManager webRTCSessionPathManager,
 	parent *webRTCManager,
 ) *webRTCSession {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
-	parsedRoomId, err := uuid.Parse(req.roomID)
-	if err != nil {
-		ctxCancel()
+
+	// the room ID has already been validated by webRTCManager
+	parsedRoomId, _ := uuid.Parse(req.roomID)
+
+	id := req.sessionUUID
+	if id == uuid.Nil {
+		id = uuid.New()
 	}
 
 	s := &webRTCSession{
 		readBufferCount: readBufferCount,
 		api:             api,
+		certificates:    certificates,
 		req:             req,
+		iceServers:      iceServers,
+		roomLogs:        roomLogs,
 		wg:              wg,
 		parent:          parent,
 		pathManager:     pathManager,
-		writers:         make(map[string]wrtcmedia.Writer),
 		ctx:             ctx,
 		ctxCancel:       ctxCancel,
 		created:         time.Now(),
-		uuid:            uuid.New(),
+		uuid:            id,
 		roomid:          parsedRoomId,
 		secret:          uuid.New(),
+		dcLimiter:       newWebRTCDataChannelLimiter(parent.dcLimits),
+		pathName:        req.pathName,
 		chNew:           make(chan webRTCNewSessionReq),
 		chAddCandidates: make(chan webRTCAddSessionCandidatesReq),
+		chRenegotiate:   make(chan webRTCRenegotiateSessionReq),
+		chMigrate:       make(chan webRTCMigrateSessionReq),
+		done:            make(chan struct{}),
 	}
 
-	s.Log(logger.Info, "created by %s", req.remoteAddr)
+	if req.resumed != nil {
+		s.logEvent(logger.Info, "created", "resumed by %s", req.remoteAddr)
+	} else {
+		s.logEvent(logger.Info, "created", "created by %s", req.remoteAddr)
+	}
 
 	wg.Add(1)
 	go s.run()
@@ -250,8 +638,21 @@ func newWebRTCSession(
 }
 
 func (s *webRTCSession) Log(level logger.Level, format string, args ...interface{}) {
+	s.logEvent(level, "", format, args...)
+}
+
+// logEvent writes a log entry that is marked with an event name
+// when the JSON log format is in use.
+func (s *webRTCSession) logEvent(level logger.Level, event string, format string, args ...interface{}) {
 	id := hex.EncodeToString(s.uuid[:4])
-	s.parent.Log(level, "[session %v] "+format, append([]interface{}{id}, args...)...)
+	s.roomLogs.add(level, s.uuid.String(), format, args)
+	s.parent.Log(level, "[session %v] "+format, append(append([]interface{}{id}, args...), logger.Fields{
+		"session_id":  s.uuid.String(),
+		"room_id":     s.req.roomID,
+		"path":        s.currentPathName(),
+		"remote_addr": s.req.remoteAddr,
+		"event":       event,
+	})...)
 }
 
 func (s *webRTCSession) close() {
@@ -260,6 +661,7 @@ func (s *webRTCSession) close() {
 
 func (s *webRTCSession) run() {
 	defer s.wg.Done()
+	defer close(s.done)
 
 	err := s.runInner()
 
@@ -267,7 +669,11 @@ func (s *webRTCSession) run() {
 
 	s.parent.closeSession(s)
 
-	s.Log(logger.Info, "closed (%v)", err)
+	s.logEvent(logger.Info, "closed", "closed (%v)", err)
+
+	if usage := s.bandwidthUsage(); usage != nil {
+		s.logEvent(logger.Info, "usage", "%s", usage)
+	}
 }
 
 func (s *webRTCSession) runInner() error {
@@ -279,10 +685,17 @@ func (s *webRTCSession) runInner() error {
 
 	errStatusCode, err := s.runInner2()
 
+	// the span has already been ended when setup succeeded
+	s.setupSpan.end(err)
+
 	if errStatusCode != 0 {
+		var redirect errWebRTCLoadRedirect
+		errors.As(err, &redirect)
+
 		s.req.res <- webRTCNewSessionRes{
 			err:           err,
 			errStatusCode: errStatusCode,
+			redirect:      redirect.url,
 		}
 	}
 
@@ -290,6 +703,18 @@ func (s *webRTCSession) runInner() error {
 }
 
 func (s *webRTCSession) runInner2() (int, error) {
+	name := "WebRTC read setup"
+	if s.req.publish {
+		name = "WebRTC publish setup"
+	}
+
+	s.setupSpan = s.parent.tracer.startSpan(name, map[string]string{
+		"session.id":  s.uuid.String(),
+		"room.id":     s.req.roomID,
+		"path":        s.req.pathName,
+		"remote.addr": s.req.remoteAddr,
+	})
+
 	if s.req.publish {
 		return s.runPublish()
 	}
@@ -297,46 +722,98 @@ func (s *webRTCSession) runInner2() (int, error) {
 }
 
 func (s *webRTCSession) runPublish() (int, error) {
+	// wait for the resumed session to stop publishing
+	if s.req.resumed != nil {
+		select {
+		case <-s.req.resumed.done:
+		case <-s.ctx.Done():
+			return http.StatusInternalServerError, fmt.Errorf("terminated")
+		}
+	}
+
 	ip, _, _ := net.SplitHostPort(s.req.remoteAddr)
 
+	role, err := pathPublisherRoleFromQuery(s.req.query)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// backup publishers are not recorded until they are forwarded
+	if role == pathPublisherRoleBackup {
+		atomic.StoreUint32(&s.standby, 1)
+	}
+
+	authSpan := s.setupSpan.startChild("authentication")
+
 	res := s.pathManager.addPublisher(pathAddPublisherReq{
 		author:   s,
 		pathName: s.req.pathName,
+		skipAuth: s.req.roomKeyAuth,
+		role:     role,
 		credentials: authCredentials{
-			query: s.req.query,
-			ip:    net.ParseIP(ip),
-			user:  s.req.user,
-			pass:  s.req.pass,
-			proto: authProtocolWebRTC,
-			id:    &s.uuid,
+			query:    s.req.query,
+			ip:       net.ParseIP(ip),
+			user:     s.req.user,
+			pass:     s.req.pass,
+			token:    s.req.token,
+			certUser: s.req.certUser,
+			proto:    authProtocolWebRTC,
+			id:       &s.uuid,
 		},
 	})
+	authSpan.end(res.err)
 	if res.err != nil {
 		if _, ok := res.err.(*errAuthentication); ok {
-			// wait some seconds to stop brute force attacks
-			<-time.After(webrtcPauseAfterAuthError)
-
 			return http.StatusUnauthorized, res.err
 		}
 
 		return http.StatusBadRequest, res.err
 	}
 
-	defer res.path.removePublisher(pathRemovePublisherReq{author: s})
+	// the path changes when the publisher is migrated
+	defer func() {
+		res.path.removePublisher(pathRemovePublisherReq{author: s})
+	}()
+
+	// another publisher is using the path and the publisher has been forked
+	if res.path.name != s.req.pathName {
+		s.setPathName(res.path.name)
+		s.parent.sessionMigrated(webRTCManagerSessionMigratedReq{
+			sx:       s,
+			prevPath: s.req.pathName,
+			newPath:  res.path.name,
+			fork:     true,
+		})
+	}
+
+	maxVideoBitrate, err := webrtcMaxVideoBitrate(s.parent.maxVideoBitrate, res.path.safeConf(), s.req.query)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	feedback := s.parent.acquirePathFeedback(res.path.name)
+	defer func() {
+		s.parent.releasePathFeedback(res.path.name)
+	}()
 
-	servers, err := s.parent.generateICEServers()
+	servers, err := s.parent.generateICEServers(s.iceServers)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 
 	pc, err := webrtcpc.New(
 		servers,
+		s.certificates,
 		s.api,
 		s)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
 	defer pc.Close()
+	defer s.saveUsage()
+
+	offerSpan := s.setupSpan.startChild("offer parse")
+	defer offerSpan.end(errSpanAborted)
 
 	offer := whipOffer(s.req.offer)
 
@@ -351,13 +828,22 @@ func (s *webRTCSession) runPublish() (int, error) {
 		return http.StatusBadRequest, err
 	}
 
-	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RtpTransceiverInit{
+	videoTransceiver, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RtpTransceiverInit{
 		Direction: webrtc.RTPTransceiverDirectionRecvonly,
 	})
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
 
+	// FEC codecs are registered in order to send FEC to readers,
+	// but video received from publishers must not be encapsulated in RED.
+	if s.parent.fecOverhead != 0 {
+		err = videoTransceiver.SetCodecPreferences(videoCodecs)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
 	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RtpTransceiverInit{
 		Direction: webrtc.RTPTransceiverDirectionRecvonly,
 	})
@@ -377,48 +863,73 @@ func (s *webRTCSession) runPublish() (int, error) {
 	room := s.parent.findRoomByUUID(s.roomid)
 
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		if dc.Label() == webrtcChatDataChannelLabel {
+			s.onChatDataChannel(room, dc)
+			return
+		}
+
 		dc.OnOpen(func() {
-			file := &File{}
-			filename := fmt.Sprintf("streams/%s/%s/%s-metadata.txt", room.clubName, room.eventName, s.uuid.String())
-			metadataFile, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0777)
+			room.messages.addChannel(s, dc)
+
+			if !room.recordsTrack(roomManifestFileTypeMetadata) {
+				return
+			}
+
+			file, err := room.createFile(filepath.Join(room.dir(),
+				roomFilePrefix(s)+"-metadata"+room.metadataFileFormat().extension))
 			if err != nil {
 				fmt.Println(err)
+				return
 			}
 
-			file.Filename = filename
-			file.File = *metadataFile
 			s.metadataFile = file
+
+			if room.metadataExport != "" {
+				s.metadataExport = newRoomMetadataExport(room.metadataExport, time.Now())
+			}
+
+			room.addMetadataFile(file.Filename, s)
 		})
 
 		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-			if room.recording {
-				line := msg.Data
-				line = append(line, byte(10))
-				s.metadataFile.WriteString(string(line))
+			if !s.limitDataChannelMessage(msg) {
+				return
+			}
+
+			if err := room.validateMetadata(msg.Data); err != nil {
+				s.Log(logger.Debug, "invalid metadata message discarded: %v", err)
+				return
+			}
+
+			if room.recordingMetadata() && s.metadataFile != nil {
+				s.metadataFile.Write(room.metadataFileFormat().encode(msg.Data, msg.IsString)) //nolint:errcheck
+
+				if s.metadataExport != nil && msg.IsString {
+					s.metadataExport.add(msg.Data, time.Now())
+				}
 			}
 		})
 
 		dc.OnClose(func() {
+			room.messages.removeChannel(s)
+
+			if s.metadataFile == nil {
+				return
+			}
+
 			s.metadataFile.Close()
 			if !room.recording {
 				os.Remove(s.metadataFile.Filename)
 			} else {
-				filename := s.metadataFile.Filename
-				fmt.Println(filename)
-
-				file, err := os.Open(filename)
+				//save file to S3 and delete it from disk
+				err := room.upload(s.metadataFile.Filename)
 				if err != nil {
 					fmt.Println(err)
 				}
-				defer file.Close()
-				//save file to S3
-				bucketName := strings.ReplaceAll(strings.TrimSpace(strings.ToLower(room.clubName)), " ", "-")
-				objectKey := fmt.Sprintf("%s/%s", room.eventName, filepath.Base(filename))
-
-				room.s3Client.UploadObject(bucketName, objectKey, file)
 
-				//delete file from disk
-				os.Remove(file.Name())
+				if s.metadataExport != nil {
+					room.exportMetadata(s.metadataExport, s.metadataFile.Filename, s)
+				}
 			}
 		})
 	})
@@ -438,7 +949,11 @@ func (s *webRTCSession) runPublish() (int, error) {
 		return http.StatusBadRequest, err
 	}
 
+	offerSpan.end(nil)
+
+	gatheringSpan := s.setupSpan.startChild("ICE gathering")
 	err = pc.WaitGatheringDone(s.ctx)
+	gatheringSpan.end(err)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
@@ -447,7 +962,9 @@ func (s *webRTCSession) runPublish() (int, error) {
 
 	go s.readRemoteCandidates(pc)
 
-	err = webrtcWaitUntilConnected(s.ctx, pc)
+	handshakeTimeout, trackGatherTimeout := s.parent.sessionTimeouts()
+
+	err = webrtcWaitUntilConnected(s.ctx, pc, handshakeTimeout, s.setupSpan)
 	if err != nil {
 		return 0, err
 	}
@@ -456,73 +973,328 @@ func (s *webRTCSession) runPublish() (int, error) {
 	s.pc = pc
 	s.mutex.Unlock()
 
-	tracks, err := webrtcGatherIncomingTracks(s.ctx, pc, trackRecv, trackCount)
+	go s.runViewers(pc, webrtcOfferHasDataChannels(sdp.MediaDescriptions))
+
+	// tracks that are still missing after this timeout are reported
+	missingTracksTimer := time.NewTimer(trackGatherTimeout)
+	defer missingTracksTimer.Stop()
+
+	// tracks are received with their first RTP packet
+	firstRTPSpan := s.setupSpan.startChild("first RTP")
+	tracks, err := webrtcGatherFirstIncomingTracks(s.ctx, pc, trackRecv, trackCount, trackGatherTimeout)
+	firstRTPSpan.end(err)
 	if err != nil {
 		return 0, err
 	}
+
+	missingTracks := trackCount - len(tracks)
+
+	s.setupSpan.end(nil)
+
+	s.mutex.Lock()
+	s.incoming = tracks
+	s.mutex.Unlock()
 	medias := webrtcMediasOfIncomingTracks(tracks)
 
-	rres := res.path.startPublisher(pathStartPublisherReq{
-		author:             s,
-		medias:             medias,
-		generateRTPPackets: true,
-	})
-	if rres.err != nil {
-		return 0, rres.err
+	go s.runHealthMonitor()
+
+	if role == pathPublisherRolePrimary {
+		go s.runStallMonitor(res.path)
 	}
 
-	for _, track := range tracks {
-		var writer wrtcmedia.Writer
-		var filename string
-		switch track.mediaType {
-		case media.TypeAudio:
-			// clubName is not unique for the moment, think of another way to build path in the future
-			filename = fmt.Sprintf("streams/%s/%s/%s-%s.ogg", room.clubName, room.eventName, s.uuid.String(), media.TypeAudio)
-			writer, err = oggwriter.New(filename, 48000, 2)
-			if err != nil {
-				panic(err)
+	started := make(map[*webRTCIncomingTrack]struct{})
+	var migration *webRTCSessionMigration
+
+	for {
+		err = room.checkCodecs(tracks)
+		if err != nil {
+			if migration != nil {
+				migration.req.res <- err
 			}
-			s.writers[filename] = writer
-		case media.TypeVideo:
-			filename = fmt.Sprintf("streams/%s/%s/%s-%s.h264", room.clubName, room.eventName, s.uuid.String(), media.TypeVideo)
-			writer, err = h264writer.New(filename)
-			if err != nil {
-				panic(err)
+			return 0, err
+		}
+
+		rres := res.path.startPublisher(pathStartPublisherReq{
+			author:             s,
+			medias:             medias,
+			generateRTPPackets: true,
+		})
+
+		if migration != nil {
+			migration.req.res <- rres.err
+			migration = nil
+		}
+
+		if rres.err != nil {
+			return 0, rres.err
+		}
+
+		for _, track := range tracks {
+			if _, ok := started[track]; ok {
+				track.setStream(rres.stream)
+				continue
 			}
-			s.writers[filename] = writer
+
+			// a resumed session keeps writing the files of the previous one
+			recorder := room.resumeRecorder(s.uuid, track)
+
+			if recorder == nil {
+				// clubName is not unique for the moment, think of another way to build path in the future
+				var err error
+				recorder, err = newRoomTrackRecorder(room, s, track)
+				if err != nil {
+					return 0, err
+				}
+
+				if recorder != nil {
+					room.addRecorder(recorder)
+				}
+			}
+
+			track.capture = s.captureRTP
+			track.standby = s.isStandby
+			track.start(s.ctx, rres.stream, recorder, room, true, feedback, maxVideoBitrate,
+				s.parent.jitterBufferDepth)
+			started[track] = struct{}{}
+
+			go track.runMuteDetector(s.ctx, func(active bool) {
+				if active {
+					s.logEvent(logger.Info, string(roomEventTrackUnmute), "%s track unmuted", track.mediaType)
+				} else {
+					s.logEvent(logger.Info, string(roomEventTrackMute), "%s track muted", track.mediaType)
+				}
+
+				if room != nil {
+					room.onTrackActive(s, track, active)
+				}
+			})
+		}
+
+		var dvr *pathRecorder
+		var dvrSegmenter *fmp4Segmenter
+		// media of rooms with end-to-end encryption can't be decrypted,
+		// while rehearsal rooms must not produce recordings.
+		if s.parent.dvrDuration != 0 && !room.e2ee && !room.rehearsal() {
+			dvr = newPathRecorder(
+				s.parent.dvrPath,
+				s.parent.dvrDuration,
+				"",
+				roomRecordConf{},
+				res.path.name,
+				s,
+			)
+			dvrSegmenter = newFMP4Segmenter(
+				s.readBufferCount,
+				webrtcDVRPartDuration,
+				rres.stream,
+				s,
+			)
+			dvrSegmenter.addOutput(dvr, webrtcDVRSegmentDuration)
+			dvrSegmenter.start()
+		}
+
+		var newTracks []*webRTCIncomingTrack
+		var lateTrack bool
+		newTracks, lateTrack, migration, err = s.waitPublishRenegotiation(
+			pc, trackRecv, tracks, missingTracks, missingTracksTimer.C,
+			time.Duration(res.path.safeConf().WebRTCInactivityTimeout))
+
+		if dvr != nil {
+			dvrSegmenter.close()
+			dvr.close()
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		// restart the publisher in order to make readers pick up the new tracks.
+		for _, track := range tracks {
+			track.setStream(nil)
+		}
+		res.path.stopPublisher(pathStopPublisherReq{author: s})
+
+		// tracks and room recordings are kept, while the publisher
+		// is moved to the destination path.
+		if migration != nil {
+			prevPath := res.path.name
+			res.path.removePublisher(pathRemovePublisherReq{author: s})
+			s.parent.releasePathFeedback(prevPath)
+
+			res = migration.res
+			s.setPathName(res.path.name)
+
+			feedback = s.parent.acquirePathFeedback(res.path.name)
+			for _, track := range tracks {
+				track.setFeedback(feedback)
+			}
+
+			s.parent.sessionMigrated(webRTCManagerSessionMigratedReq{
+				sx:       s,
+				prevPath: prevPath,
+				newPath:  res.path.name,
+			})
+			s.logEvent(logger.Info, "migrate", "migrated from path '%s' to path '%s'", prevPath, res.path.name)
+			continue
+		}
+
+		if lateTrack {
+			missingTracks--
+		} else {
+			// after a renegotiation, all tracks have been gathered
+			missingTracks = 0
+		}
+
+		tracks = newTracks
+		medias = webrtcMediasOfIncomingTracks(tracks)
+
+		s.mutex.Lock()
+		s.incoming = tracks
+		s.mutex.Unlock()
+
+		if lateTrack {
+			s.Log(logger.Info, "late track received, %s", sourceMediaInfo(medias))
+		} else {
+			s.logEvent(logger.Info, "renegotiate", "tracks changed after renegotiation, %s", sourceMediaInfo(medias))
 		}
-		track.start(rres.stream, writer, room, true)
 	}
+}
 
-	select {
-	case <-pc.Disconnected():
-		return 0, fmt.Errorf("peer connection closed")
+// waitPublishRenegotiation handles renegotiations, late tracks and migrations of a publisher
+// and returns when its tracks or its path change. It also returns whether a late track has been added.
+// If inactivityTimeout is not zero, an error is returned when a track doesn't receive
+// packets within it, in order to close publishers whose network silently died.
+func (s *webRTCSession) waitPublishRenegotiation(
+	pc *webrtcpc.PeerConnection,
+	trackRecv chan trackRecvPair,
+	tracks []*webRTCIncomingTrack,
+	missingTracks int,
+	missingTracksTimeout <-chan time.Time,
+	inactivityTimeout time.Duration,
+) ([]*webRTCIncomingTrack, bool, *webRTCSessionMigration, error) {
+	// tracks that have not been received yet are not waited for
+	var lateTrackRecv chan trackRecvPair
+	if missingTracks > 0 {
+		lateTrackRecv = trackRecv
+	}
 
-	case <-s.ctx.Done():
-		return 0, fmt.Errorf("terminated")
+	var inactivityCheck <-chan time.Time
+	if inactivityTimeout != 0 {
+		ticker := time.NewTicker(webrtcInactivityCheckPeriod(inactivityTimeout))
+		defer ticker.Stop()
+		inactivityCheck = ticker.C
+	}
+
+	for {
+		select {
+		case <-inactivityCheck:
+			if track := webrtcInactiveTrack(tracks, inactivityTimeout); track != nil {
+				return nil, false, nil, fmt.Errorf("no packets received on %s track within %v",
+					track.mediaType, inactivityTimeout)
+			}
+
+		case pair := <-lateTrackRecv:
+			track, err := newWebRTCIncomingTrack(pair.track, pair.receiver, pc.WriteRTCP)
+			if err != nil {
+				return nil, false, nil, err
+			}
+
+			newTracks := append(append([]*webRTCIncomingTrack(nil), tracks...), track)
+			return newTracks, true, nil, nil
+
+		case <-missingTracksTimeout:
+			if missingTracks > 0 {
+				s.Log(logger.Warn, "%d tracks have not been received yet", missingTracks)
+			}
+
+		case req := <-s.chRenegotiate:
+			var sdp sdp.SessionDescription
+			err := sdp.Unmarshal(req.offer)
+			if err != nil {
+				req.res <- webRTCRenegotiateSessionRes{err: err}
+				continue
+			}
+
+			trackCount, err := webrtcTrackCount(sdp.MediaDescriptions)
+			if err == nil && trackCount == 0 {
+				err = fmt.Errorf("at least one track is required")
+			}
+			if err != nil {
+				req.res <- webRTCRenegotiateSessionRes{err: err}
+				continue
+			}
+
+			answer, err := webrtcRenegotiate(pc, whipOffer(req.offer))
+			if err != nil {
+				req.res <- webRTCRenegotiateSessionRes{err: err}
+				return nil, false, nil, err
+			}
+
+			req.res <- webRTCRenegotiateSessionRes{answer: []byte(answer.SDP)}
+
+			active := webrtcActiveMids(sdp.MediaDescriptions)
+			var newTracks []*webRTCIncomingTrack
+
+			for _, track := range tracks {
+				if _, ok := active[webrtcIncomingTrackMid(pc, track)]; ok {
+					newTracks = append(newTracks, track)
+				}
+			}
+
+			if len(newTracks) == len(tracks) && len(newTracks) == trackCount {
+				continue
+			}
+
+			if len(newTracks) < trackCount {
+				_, trackGatherTimeout := s.parent.sessionTimeouts()
+				added, err := webrtcGatherIncomingTracks(
+					s.ctx, pc, trackRecv, trackCount-len(newTracks), trackGatherTimeout)
+				if err != nil {
+					return nil, false, nil, err
+				}
+				newTracks = append(newTracks, added...)
+			}
+
+			return newTracks, false, nil, nil
+
+		case req := <-s.chMigrate:
+			migration := s.addMigrationPublisher(req)
+			if migration != nil {
+				return tracks, false, migration, nil
+			}
+
+		case <-pc.Disconnected():
+			return nil, false, nil, fmt.Errorf("peer connection closed")
+
+		case <-s.ctx.Done():
+			return nil, false, nil, fmt.Errorf("terminated")
+		}
 	}
 }
 
 func (s *webRTCSession) runRead() (int, error) {
 	ip, _, _ := net.SplitHostPort(s.req.remoteAddr)
 
+	authSpan := s.setupSpan.startChild("authentication")
+
 	res := s.pathManager.addReader(pathAddReaderReq{
 		author:   s,
 		pathName: s.req.pathName,
 		credentials: authCredentials{
-			query: s.req.query,
-			ip:    net.ParseIP(ip),
-			user:  s.req.user,
-			pass:  s.req.pass,
-			proto: authProtocolWebRTC,
-			id:    &s.uuid,
+			query:    s.req.query,
+			ip:       net.ParseIP(ip),
+			user:     s.req.user,
+			pass:     s.req.pass,
+			token:    s.req.token,
+			certUser: s.req.certUser,
+			proto:    authProtocolWebRTC,
+			id:       &s.uuid,
 		},
+		skipAuth: s.req.roomKeyAuth,
 	})
+	authSpan.end(res.err)
 	if res.err != nil {
 		if _, ok := res.err.(*errAuthentication); ok {
-			// wait some seconds to stop brute force attacks
-			<-time.After(webrtcPauseAfterAuthError)
-
 			return http.StatusUnauthorized, res.err
 		}
 
@@ -535,26 +1307,118 @@ func (s *webRTCSession) runRead() (int, error) {
 
 	defer res.path.removeReader(pathRemoveReaderReq{author: s})
 
-	tracks, err := webrtcGatherOutgoingTracks(res.stream.Medias())
+	strm := res.stream
+
+	offset, isDVR, err := webrtcDVROffset(s.req.query)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
 
-	servers, err := s.parent.generateICEServers()
+	var dvr *webrtcDVRPlayer
+	if isDVR {
+		if s.parent.dvrDuration == 0 {
+			return http.StatusBadRequest, fmt.Errorf("DVR is disabled")
+		}
+
+		if -offset > s.parent.dvrDuration {
+			return http.StatusBadRequest, fmt.Errorf("start offset exceeds the DVR duration (%v)", s.parent.dvrDuration)
+		}
+
+		dvr, err = newWebRTCDVRPlayer(
+			s.parent.dvrPath,
+			res.path.name,
+			offset,
+			res.path.udpMaxPayloadSize,
+			s)
+		if err != nil {
+			return http.StatusNotFound, err
+		}
+		defer dvr.close()
+
+		strm = dvr.stream
+	}
+
+	pathConf := res.path.safeConf()
+
+	offerSpan := s.setupSpan.startChild("offer parse")
+	defer offerSpan.end(errSpanAborted)
+
+	offer := whipOffer(s.req.offer)
+
+	mode, err := webrtcReadModeFromRequest(s.req.query, offer)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	maxVideoBitrate, err := webrtcMaxVideoBitrate(s.parent.maxVideoBitrate, pathConf, s.req.query)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	readerMaxVideoBitrate, errStatusCode, err := webrtcLoadShedding(s.parent.isOverloaded(), pathConf, maxVideoBitrate)
+	if err != nil {
+		return errStatusCode, err
+	}
+
+	maxSpatialLayer, maxTemporalLayer, err := webrtcSVCMaxLayers(s.req.query)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	room := s.parent.findRoomByUUID(s.roomid)
+
+	codecs := pathConf.WebRTCReadCodecs
+	if len(codecs) == 0 && room != nil {
+		codecs = room.codecs
+	}
+
+	tracks, err := webrtcGatherOutgoingTracks(strm.Medias(), codecs, mode)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// the audio mix of the room is sent as an additional track
+	var mixStrm *stream.Stream
+	var mixTracks []*webRTCOutgoingTrack
+	if s.req.mixPathName != "" {
+		mixRes := s.pathManager.addReader(pathAddReaderReq{
+			author:   s,
+			pathName: s.req.mixPathName,
+			skipAuth: true,
+		})
+		if mixRes.err != nil {
+			return http.StatusNotFound, fmt.Errorf("audio mix is not available: %v", mixRes.err)
+		}
+
+		defer mixRes.path.removeReader(pathRemoveReaderReq{author: s})
+
+		mixStrm = mixRes.stream
+
+		mixTracks, err = webrtcGatherOutgoingTracks(mixStrm.Medias(), codecs, webrtcReadModeAudio)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	servers, err := s.parent.generateICEServers(s.iceServers)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 
 	pc, err := webrtcpc.New(
 		servers,
+		s.certificates,
 		s.api,
 		s)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
 	defer pc.Close()
+	defer s.saveUsage()
 
 	for _, track := range tracks {
+		track.track.fecOverhead = s.parent.fecOverhead
+
 		var err error
 		track.sender, err = pc.AddTrack(track.track)
 		if err != nil {
@@ -562,7 +1426,30 @@ func (s *webRTCSession) runRead() (int, error) {
 		}
 	}
 
-	offer := whipOffer(s.req.offer)
+	for _, track := range mixTracks {
+		var err error
+		track.sender, err = pc.AddTrack(track.track)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	if room != nil {
+		pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+			if dc.Label() == webrtcChatDataChannelLabel {
+				s.onChatDataChannel(room, dc)
+			} else {
+				s.onMessagesDataChannel(room, dc)
+			}
+		})
+	}
+
+	if len(codecs) != 0 {
+		err = webrtcSetCodecPreferences(pc, tracks, s.parent.opusFmtp, s.parent.fecOverhead != 0)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
 
 	err = pc.SetRemoteDescription(*offer)
 	if err != nil {
@@ -579,7 +1466,11 @@ func (s *webRTCSession) runRead() (int, error) {
 		return http.StatusBadRequest, err
 	}
 
+	offerSpan.end(nil)
+
+	gatheringSpan := s.setupSpan.startChild("ICE gathering")
 	err = pc.WaitGatheringDone(s.ctx)
+	gatheringSpan.end(err)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
@@ -588,48 +1479,130 @@ func (s *webRTCSession) runRead() (int, error) {
 
 	go s.readRemoteCandidates(pc)
 
-	err = webrtcWaitUntilConnected(s.ctx, pc)
+	handshakeTimeout, _ := s.parent.sessionTimeouts()
+
+	err = webrtcWaitUntilConnected(s.ctx, pc, handshakeTimeout, s.setupSpan)
 	if err != nil {
 		return 0, err
 	}
 
+	s.setupSpan.end(nil)
+
 	s.mutex.Lock()
 	s.pc = pc
+	s.outgoing = tracks
 	s.mutex.Unlock()
 
-	ringBuffer, _ := ringbuffer.New(uint64(s.readBufferCount))
-	defer ringBuffer.Close()
+	readBuf := newWebRTCReaderBuffer(s.readBufferCount, s.parent.readBufferMaxCount)
+	defer readBuf.close()
+
+	s.mutex.Lock()
+	s.readBuf = readBuf
+	s.mutex.Unlock()
 
 	writeError := make(chan error)
 
+	feedback := s.parent.acquirePathFeedback(res.path.name)
+	defer s.parent.releasePathFeedback(res.path.name)
+	defer feedback.removeReader(s)
+
+	if maxVideoBitrate != 0 && dvr == nil {
+		feedback.setReaderMaxBitrate(s, float64(maxVideoBitrate))
+	}
+
 	for _, track := range tracks {
-		track.start(s.ctx, s, res.stream, ringBuffer, writeError)
+		var onRTCP func([]rtcp.Packet)
+		// DVR readers do not affect the bitrate of the publisher
+		if track.media.Type == media.TypeVideo && dvr == nil {
+			onRTCP = func(pkts []rtcp.Packet) {
+				feedback.onReaderRTCP(s, pkts)
+			}
+		}
+
+		var packetizer *webrtcPacketizer
+		track.svc = webrtcNewSVCFilter(track.format, maxSpatialLayer, maxTemporalLayer,
+			s.parent.svcAdaptation, s.parent.h264FrameDropping, readerMaxVideoBitrate)
+		if track.svc == nil {
+			packetizer = s.parent.acquirePacketizer(track.format, track.packetize)
+			defer s.parent.releasePacketizer(track.format)
+		}
+
+		track.track.capture = s.captureRTP
+		track.start(s.ctx, s, strm, packetizer, readBuf, writeError, onRTCP)
+	}
+
+	defer strm.RemoveReader(s)
+
+	if mixStrm != nil {
+		for _, track := range mixTracks {
+			packetizer := s.parent.acquirePacketizer(track.format, track.packetize)
+			defer s.parent.releasePacketizer(track.format)
+
+			track.start(s.ctx, s, mixStrm, packetizer, readBuf, writeError, nil)
+		}
+
+		defer mixStrm.RemoveReader(s)
+
+		s.Log(logger.Info, "is receiving the audio mix of path '%s'", s.req.mixPathName)
 	}
 
-	defer res.stream.RemoveReader(s)
+	var dvrDone chan struct{}
+	if dvr != nil {
+		dvr.play()
+		dvrDone = dvr.done
 
-	s.Log(logger.Info, "is reading from path '%s', %s",
-		res.path.name, sourceMediaInfo(webrtcMediasOfOutgoingTracks(tracks)))
+		s.logEvent(logger.Info, "read", "is reading from path '%s' with an offset of %v, %s",
+			res.path.name, offset, sourceMediaInfo(webrtcMediasOfOutgoingTracks(tracks)))
+	} else {
+		s.logEvent(logger.Info, "read", "is reading from path '%s', %s",
+			res.path.name, sourceMediaInfo(webrtcMediasOfOutgoingTracks(tracks)))
+	}
 
 	go func() {
 		for {
-			item, ok := ringBuffer.Pull()
+			item, ok := readBuf.pull()
 			if !ok {
 				return
 			}
-			item.(func())()
+			item()
 		}
 	}()
 
-	select {
-	case <-pc.Disconnected():
-		return 0, fmt.Errorf("peer connection closed")
+	// warnings about discarded data are throttled
+	discardedTicker := time.NewTicker(webrtcReaderBufferWarningPeriod)
+	defer discardedTicker.Stop()
+	var discarded uint64
 
-	case err := <-writeError:
-		return 0, err
+	for {
+		select {
+		case <-discardedTicker.C:
+			cur := readBuf.discardedCount()
+			if cur != discarded {
+				s.Log(logger.Warn, "reader is too slow, %d units have been discarded (buffer size: %d)",
+					cur-discarded, readBuf.size())
+				discarded = cur
+			}
 
-	case <-s.ctx.Done():
-		return 0, fmt.Errorf("terminated")
+		case <-pc.Disconnected():
+			return 0, fmt.Errorf("peer connection closed")
+
+		case err := <-writeError:
+			return 0, err
+
+		case <-dvrDone:
+			return 0, fmt.Errorf("DVR playback ended")
+
+		case req := <-s.chRenegotiate:
+			answer, err := webrtcRenegotiate(pc, whipOffer(req.offer))
+			if err != nil {
+				req.res <- webRTCRenegotiateSessionRes{err: err}
+				return 0, err
+			}
+			req.res <- webRTCRenegotiateSessionRes{answer: []byte(answer.SDP)}
+
+		case <-s.ctx.Done():
+			return 0, fmt.Errorf("terminated")
+		}
 	}
 }
 
@@ -644,13 +1617,14 @@ func (s *webRTCSession) readRemoteCandidates(pc *webrtcpc.PeerConnection) {
 	for {
 		select {
 		case req := <-s.chAddCandidates:
+			var err error
 			for _, candidate := range req.candidates {
-				err := pc.AddICECandidate(*candidate)
+				err = pc.AddICECandidate(*candidate)
 				if err != nil {
-					req.res <- webRTCAddSessionCandidatesRes{err: err}
+					break
 				}
 			}
-			req.res <- webRTCAddSessionCandidatesRes{}
+			req.res <- webRTCAddSessionCandidatesRes{err: err}
 
 		case <-s.ctx.Done():
 			return
@@ -682,6 +1656,19 @@ func (s *webRTCSession) addCandidates(
 	}
 }
 
+// renegotiate is called by webRTCHTTPServer through webRTCManager.
+func (s *webRTCSession) renegotiate(
+	req webRTCRenegotiateSessionReq,
+) webRTCRenegotiateSessionRes {
+	select {
+	case s.chRenegotiate <- req:
+		return <-req.res
+
+	case <-s.ctx.Done():
+		return webRTCRenegotiateSessionRes{err: fmt.Errorf("terminated")}
+	}
+}
+
 // apiSourceDescribe implements sourceStaticImpl.
 func (s *webRTCSession) apiSourceDescribe() pathAPISourceOrReader {
 	return pathAPISourceOrReader{
@@ -690,11 +1677,90 @@ func (s *webRTCSession) apiSourceDescribe() pathAPISourceOrReader {
 	}
 }
 
+// setActive implements pathRedundantPublisher.
+func (s *webRTCSession) setActive(active bool) {
+	v := uint32(1)
+	if active {
+		v = 0
+	}
+
+	if atomic.SwapUint32(&s.standby, v) != v {
+		if active {
+			s.logEvent(logger.Info, "active", "forwarded to readers")
+		} else {
+			s.logEvent(logger.Info, "standby", "not forwarded to readers anymore")
+		}
+	}
+}
+
+func (s *webRTCSession) isStandby() bool {
+	return atomic.LoadUint32(&s.standby) == 1
+}
+
+// runStallMonitor reports to the path when all tracks of a primary publisher
+// stop receiving packets, in order to switch readers to the backup publisher.
+func (s *webRTCSession) runStallMonitor(pa *path) {
+	ticker := time.NewTicker(webrtcTrackMuteTimeout / 4)
+	defer ticker.Stop()
+
+	stalled := false
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		s.mutex.RLock()
+		cur := webrtcTracksStalled(s.incoming)
+		s.mutex.RUnlock()
+
+		if cur != stalled {
+			stalled = cur
+			pa.setPublisherStalled(pathSetPublisherStalledReq{author: s, stalled: stalled})
+		}
+	}
+}
+
+// webrtcTracksStalled checks whether all tracks stopped receiving packets.
+func webrtcTracksStalled(tracks []*webRTCIncomingTrack) bool {
+	if len(tracks) == 0 {
+		return false
+	}
+
+	for _, track := range tracks {
+		if track.active() {
+			return false
+		}
+	}
+	return true
+}
+
 // apiReaderDescribe implements reader.
 func (s *webRTCSession) apiReaderDescribe() pathAPISourceOrReader {
 	return s.apiSourceDescribe()
 }
 
+// bytesSent returns the bytes sent by outgoing tracks.
+func (s *webRTCSession) bytesSent() uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	n := uint64(0)
+	for _, track := range s.outgoing {
+		n += atomic.LoadUint64(track.track.bytesSent)
+	}
+	return n
+}
+
+// hasConnected checks whether the peer connection of the session has been established.
+func (s *webRTCSession) hasConnected() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.pc != nil
+}
+
 func (s *webRTCSession) apiItem() *apiWebRTCSession {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -704,6 +1770,11 @@ func (s *webRTCSession) apiItem() *apiWebRTCSession {
 	remoteCandidate := ""
 	bytesReceived := uint64(0)
 	bytesSent := uint64(0)
+	readBufferDiscarded := uint64(0)
+
+	if s.readBuf != nil {
+		readBufferDiscarded = s.readBuf.discardedCount()
+	}
 
 	if s.pc != nil {
 		peerConnectionEstablished = true
@@ -713,6 +1784,21 @@ func (s *webRTCSession) apiItem() *apiWebRTCSession {
 		bytesSent = s.pc.BytesSent()
 	}
 
+	tracks := []*apiWebRTCSessionTrack{}
+
+	for _, track := range s.incoming {
+		tracks = append(tracks, track.apiItem())
+	}
+
+	var health *apiWebRTCSessionHealth
+	if s.req.publish {
+		health = webrtcHealthOfTracks(s.incoming, time.Now())
+	}
+
+	for _, track := range s.outgoing {
+		tracks = append(tracks, track.apiItem())
+	}
+
 	return &apiWebRTCSession{
 		ID:                        s.uuid,
 		Created:                   s.created,
@@ -726,8 +1812,26 @@ func (s *webRTCSession) apiItem() *apiWebRTCSession {
 			}
 			return apiWebRTCSessionStateRead
 		}(),
-		Path:          s.req.pathName,
-		BytesReceived: bytesReceived,
-		BytesSent:     bytesSent,
+		Path: s.currentPathName(),
+		RoomID: func() *uuid.UUID {
+			if s.roomid == uuid.Nil {
+				return nil
+			}
+			return &s.roomid
+		}(),
+		ParticipantName:     s.req.participantName,
+		ParticipantID:       s.req.participantID,
+		BytesReceived:       bytesReceived,
+		BytesSent:           bytesSent,
+		ReadBufferDiscarded: readBufferDiscarded,
+		Tracks:              tracks,
+		Health:              health,
+		Viewers: func() *int {
+			if s.viewers == nil {
+				return nil
+			}
+			v := *s.viewers
+			return &v
+		}(),
 	}
 }
@@ -0,0 +1,374 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	webrtcCaptureDefaultDuration = 1 * time.Minute
+	webrtcCaptureMaxDuration     = 10 * time.Minute
+)
+
+// webrtcCaptureWriter writes RTP packets into a capture file.
+type webrtcCaptureWriter interface {
+	writePacket(byts []byte, incoming bool, t time.Time) error
+}
+
+// webrtcCaptureFormats are the available formats of captures, with their file extension.
+var webrtcCaptureFormats = map[string]string{
+	"pcapng":  ".pcapng",
+	"rtpdump": ".rtpdump",
+}
+
+// webrtcPcapngWriter writes packets in the pcapng format.
+// Since packets are captured after decryption, they are encapsulated
+// into synthetic IP and UDP headers built from the addresses of the session.
+type webrtcPcapngWriter struct {
+	w      io.Writer
+	local  *net.UDPAddr
+	remote *net.UDPAddr
+}
+
+func newWebRTCPcapngWriter(w io.Writer, local *net.UDPAddr, remote *net.UDPAddr) (*webrtcPcapngWriter, error) {
+	// section header block
+	shb := make([]byte, 28)
+	binary.LittleEndian.PutUint32(shb[0:], 0x0A0D0D0A)
+	binary.LittleEndian.PutUint32(shb[4:], 28)
+	binary.LittleEndian.PutUint32(shb[8:], 0x1A2B3C4D)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	binary.LittleEndian.PutUint64(shb[16:], 0xFFFFFFFFFFFFFFFF) // unknown section length
+	binary.LittleEndian.PutUint32(shb[24:], 28)
+
+	// interface description block, with LINKTYPE_RAW and timestamps in microseconds
+	idb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(idb[0:], 1)
+	binary.LittleEndian.PutUint32(idb[4:], 20)
+	binary.LittleEndian.PutUint16(idb[8:], 101)
+	binary.LittleEndian.PutUint32(idb[12:], 0)
+	binary.LittleEndian.PutUint32(idb[16:], 20)
+
+	_, err := w.Write(append(shb, idb...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &webrtcPcapngWriter{
+		w:      w,
+		local:  local,
+		remote: remote,
+	}, nil
+}
+
+func (c *webrtcPcapngWriter) writePacket(byts []byte, incoming bool, t time.Time) error {
+	src, dst := c.local, c.remote
+	if incoming {
+		src, dst = dst, src
+	}
+
+	pkt := webrtcCaptureUDPPacket(src, dst, byts)
+	padded := (len(pkt) + 3) &^ 3
+	blockLen := 32 + padded
+
+	// enhanced packet block
+	epb := make([]byte, blockLen)
+	ts := uint64(t.UnixMicro())
+	binary.LittleEndian.PutUint32(epb[0:], 6)
+	binary.LittleEndian.PutUint32(epb[4:], uint32(blockLen))
+	binary.LittleEndian.PutUint32(epb[8:], 0)
+	binary.LittleEndian.PutUint32(epb[12:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(epb[16:], uint32(ts))
+	binary.LittleEndian.PutUint32(epb[20:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(epb[24:], uint32(len(pkt)))
+	copy(epb[28:], pkt)
+	binary.LittleEndian.PutUint32(epb[blockLen-4:], uint32(blockLen))
+
+	_, err := c.w.Write(epb)
+	return err
+}
+
+// webrtcCaptureUDPPacket encapsulates a payload into IP and UDP headers.
+// The UDP checksum is not computed.
+func webrtcCaptureUDPPacket(src *net.UDPAddr, dst *net.UDPAddr, payload []byte) []byte {
+	udp := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)))
+	copy(udp[8:], payload)
+
+	src4, dst4 := src.IP.To4(), dst.IP.To4()
+
+	if src4 != nil && dst4 != nil {
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+		binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+		ip[8] = 64
+		ip[9] = 17
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+
+		var sum uint32
+		for i := 0; i < 20; i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(ip[i:]))
+		}
+		for sum > 0xFFFF {
+			sum = (sum >> 16) + (sum & 0xFFFF)
+		}
+		binary.BigEndian.PutUint16(ip[10:], ^uint16(sum))
+
+		return append(ip, udp...)
+	}
+
+	ip := make([]byte, 40)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(udp)))
+	ip[6] = 17
+	ip[7] = 64
+	copy(ip[8:], src.IP.To16())
+	copy(ip[24:], dst.IP.To16())
+
+	return append(ip, udp...)
+}
+
+// webrtcRtpdumpWriter writes packets in the rtpdump format of rtptools.
+// The format doesn't store the direction of packets.
+type webrtcRtpdumpWriter struct {
+	w     io.Writer
+	start time.Time
+}
+
+func newWebRTCRtpdumpWriter(w io.Writer, remote *net.UDPAddr, start time.Time) (*webrtcRtpdumpWriter, error) {
+	header := []byte("#!rtpplay1.0 " + remote.IP.String() + "/" + strconv.FormatInt(int64(remote.Port), 10) + "\n")
+
+	hdr := make([]byte, 16)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(start.Unix()))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(start.Nanosecond()/1000))
+	if ip4 := remote.IP.To4(); ip4 != nil {
+		copy(hdr[8:], ip4)
+	}
+	binary.BigEndian.PutUint16(hdr[12:], uint16(remote.Port))
+
+	_, err := w.Write(append(header, hdr...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &webrtcRtpdumpWriter{
+		w:     w,
+		start: start,
+	}, nil
+}
+
+func (c *webrtcRtpdumpWriter) writePacket(byts []byte, _ bool, t time.Time) error {
+	if len(byts) > 0xFFFF-8 {
+		return fmt.Errorf("packet is too big")
+	}
+
+	buf := make([]byte, 8+len(byts))
+	binary.BigEndian.PutUint16(buf[0:], uint16(len(buf)))
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(byts)))
+	binary.BigEndian.PutUint32(buf[4:], uint32(t.Sub(c.start).Milliseconds()))
+	copy(buf[8:], byts)
+
+	_, err := c.w.Write(buf)
+	return err
+}
+
+// webrtcCandidateAddr returns the address of a candidate returned by webrtcpc,
+// or the unspecified address if it can't be parsed.
+func webrtcCandidateAddr(candidate string) *net.UDPAddr {
+	parts := strings.Split(candidate, "/")
+	if len(parts) == 4 {
+		ip := net.ParseIP(parts[2])
+		port, err := strconv.ParseUint(parts[3], 10, 16)
+		if ip != nil && err == nil {
+			return &net.UDPAddr{IP: ip, Port: int(port)}
+		}
+	}
+
+	return &net.UDPAddr{IP: net.IPv4zero}
+}
+
+// webrtcCapture is a capture of the RTP packets of a session.
+// Packets of incoming and outgoing tracks are written by different goroutines,
+// therefore writes are serialized by a mutex.
+type webrtcCapture struct {
+	filename string
+	bucket   string
+	key      string
+
+	mutex  sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer
+	writer webrtcCaptureWriter
+	closed bool
+	err    error
+}
+
+func (c *webrtcCapture) writeRTP(pkt *rtp.Packet, incoming bool) {
+	byts, err := pkt.Marshal()
+	if err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed || c.err != nil {
+		return
+	}
+
+	c.err = c.writer.writePacket(byts, incoming, time.Now())
+}
+
+func (c *webrtcCapture) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+
+	err := c.buf.Flush()
+	if c.err == nil {
+		c.err = err
+	}
+
+	c.file.Close()
+	return c.err
+}
+
+// captureRTP writes a packet into the running capture, if any.
+func (s *webRTCSession) captureRTP(pkt *rtp.Packet, incoming bool) {
+	s.mutex.RLock()
+	c := s.capture
+	s.mutex.RUnlock()
+
+	if c != nil {
+		c.writeRTP(pkt, incoming)
+	}
+}
+
+// startCapture starts a capture of the RTP packets sent and received by the session,
+// that is stopped after duration or when the session is closed, and then uploaded
+// into the bucket of the room.
+func (s *webRTCSession) startCapture(
+	room *Room,
+	prefix string,
+	format string,
+	duration time.Duration,
+) (*apiWebRTCSessionCapture, error) {
+	ext, ok := webrtcCaptureFormats[format]
+	if !ok {
+		return nil, errAPIBadRequest{fmt.Errorf("invalid capture format: '%s'", format)}
+	}
+
+	if duration == 0 {
+		duration = webrtcCaptureDefaultDuration
+	}
+	if duration < 0 || duration > webrtcCaptureMaxDuration {
+		return nil, errAPIBadRequest{fmt.Errorf("duration must be between 0 and %v", webrtcCaptureMaxDuration)}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.capture != nil {
+		return nil, errAPIBadRequest{fmt.Errorf("a capture is already running")}
+	}
+
+	local, remote := &net.UDPAddr{IP: net.IPv4zero}, &net.UDPAddr{IP: net.IPv4zero}
+	if s.pc != nil {
+		local = webrtcCandidateAddr(s.pc.LocalCandidate())
+		remote = webrtcCandidateAddr(s.pc.RemoteCandidate())
+	}
+
+	f, err := os.CreateTemp("", "mediamtx-capture-*"+ext)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	buf := bufio.NewWriter(f)
+
+	var w webrtcCaptureWriter
+	if format == "pcapng" {
+		w, err = newWebRTCPcapngWriter(buf, local, remote)
+	} else {
+		w, err = newWebRTCRtpdumpWriter(buf, remote, now)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	c := &webrtcCapture{
+		filename: f.Name(),
+		bucket:   room.bucketName(),
+		key: prefix + room.uuid.String() + "/" + s.uuid.String() + "-" +
+			now.UTC().Format("20060102-150405") + ext,
+		file:   f,
+		buf:    buf,
+		writer: w,
+	}
+	s.capture = c
+
+	s.Log(logger.Info, "capture started")
+
+	s.parent.uploads.Add(1)
+	go func() {
+		defer s.parent.uploads.Done()
+
+		select {
+		case <-time.After(duration):
+		case <-s.ctx.Done():
+		}
+
+		s.mutex.Lock()
+		s.capture = nil
+		s.mutex.Unlock()
+
+		defer os.Remove(c.filename)
+
+		err := c.close()
+		if err == nil {
+			err = uploadCapture(room.storage, c)
+		}
+		if err != nil {
+			s.Log(logger.Warn, "unable to save capture: %v", err)
+			return
+		}
+
+		s.Log(logger.Info, "capture uploaded to '%s/%s'", c.bucket, c.key)
+	}()
+
+	return &apiWebRTCSessionCapture{
+		Format:   format,
+		Duration: duration.String(),
+		Bucket:   c.bucket,
+		Key:      c.key,
+	}, nil
+}
+
+func uploadCapture(storage recordStorage, c *webrtcCapture) error {
+	f, err := os.Open(c.filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return storage.UploadObject(c.bucket, c.key, f, "")
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCCandidateAddr(t *testing.T) {
+	addr := webrtcCandidateAddr("host/udp/192.168.2.5/45678")
+	require.Equal(t, &net.UDPAddr{IP: net.ParseIP("192.168.2.5"), Port: 45678}, addr)
+
+	addr = webrtcCandidateAddr("")
+	require.Equal(t, &net.UDPAddr{IP: net.IPv4zero}, addr)
+}
+
+func TestWebRTCPcapngWriter(t *testing.T) {
+	local := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8189}
+	remote := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 50000}
+
+	var buf bytes.Buffer
+	w, err := newWebRTCPcapngWriter(&buf, local, remote)
+	require.NoError(t, err)
+	require.Equal(t, 48, buf.Len())
+
+	err = w.writePacket([]byte{0x80, 0x60, 0x00, 0x01, 0x02}, true, time.Unix(1, 0))
+	require.NoError(t, err)
+
+	epb := buf.Bytes()[48:]
+	require.Equal(t, uint32(6), binary.LittleEndian.Uint32(epb[0:]))
+	blockLen := binary.LittleEndian.Uint32(epb[4:])
+	require.Equal(t, int(blockLen), len(epb))
+	require.Equal(t, uint32(0), blockLen%4)
+	require.Equal(t, uint32(20+8+5), binary.LittleEndian.Uint32(epb[20:]))
+
+	// incoming packets go from the remote address to the local one
+	ip := epb[28:]
+	require.Equal(t, []byte{10, 0, 0, 2}, ip[12:16])
+	require.Equal(t, []byte{10, 0, 0, 1}, ip[16:20])
+	require.Equal(t, uint16(50000), binary.BigEndian.Uint16(ip[20:]))
+	require.Equal(t, uint16(8189), binary.BigEndian.Uint16(ip[22:]))
+}
+
+func TestWebRTCRtpdumpWriter(t *testing.T) {
+	remote := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 50000}
+	start := time.Unix(1000, 0)
+
+	var buf bytes.Buffer
+	w, err := newWebRTCRtpdumpWriter(&buf, remote, start)
+	require.NoError(t, err)
+
+	header := "#!rtpplay1.0 10.0.0.2/50000\n"
+	require.Equal(t, header, buf.String()[:len(header)])
+	require.Equal(t, len(header)+16, buf.Len())
+
+	err = w.writePacket([]byte{1, 2, 3}, false, start.Add(1500*time.Millisecond))
+	require.NoError(t, err)
+
+	require.Equal(t, []byte{0, 11, 0, 3, 0, 0, 0x05, 0xDC, 1, 2, 3}, buf.Bytes()[len(header)+16:])
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"net"
+)
+
+// webrtcRemoteIP returns the IP of a remote address.
+func webrtcRemoteIP(remoteAddr string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return ip
+}
+
+// checkSessionLimits checks whether a new session can be created without exceeding
+// the limits on concurrent sessions.
+// replaced is a session that is going to be closed by the new one, and is not counted.
+func (m *webRTCManager) checkSessionLimits(remoteAddr string, replaced *webRTCSession) error {
+	if m.maxSessions == 0 && m.maxSessionsPerIP == 0 {
+		return nil
+	}
+
+	ip := webrtcRemoteIP(remoteAddr)
+	count := 0
+	countIP := 0
+
+	for sx := range m.sessions {
+		if sx == replaced {
+			continue
+		}
+
+		count++
+		if webrtcRemoteIP(sx.req.remoteAddr) == ip {
+			countIP++
+		}
+	}
+
+	if m.maxSessions != 0 && count >= m.maxSessions {
+		return fmt.Errorf("maximum number of sessions reached")
+	}
+
+	if m.maxSessionsPerIP != 0 && countIP >= m.maxSessionsPerIP {
+		return fmt.Errorf("maximum number of sessions of %s reached", ip)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCSessionLimits(t *testing.T) {
+	sx1 := &webRTCSession{req: webRTCNewSessionReq{remoteAddr: "192.168.1.1:5000"}}
+	sx2 := &webRTCSession{req: webRTCNewSessionReq{remoteAddr: "192.168.1.1:5001"}}
+	sx3 := &webRTCSession{req: webRTCNewSessionReq{remoteAddr: "192.168.1.2:5000"}}
+
+	m := &webRTCManager{
+		sessions: map[*webRTCSession]struct{}{
+			sx1: {},
+			sx2: {},
+			sx3: {},
+		},
+	}
+
+	require.NoError(t, m.checkSessionLimits("192.168.1.1:6000", nil))
+
+	m.maxSessionsPerIP = 2
+	err := m.checkSessionLimits("192.168.1.1:6000", nil)
+	require.EqualError(t, err, "maximum number of sessions of 192.168.1.1 reached")
+	require.NoError(t, m.checkSessionLimits("192.168.1.2:6000", nil))
+
+	// a resumed session replaces the previous one
+	require.NoError(t, m.checkSessionLimits("192.168.1.1:6000", sx1))
+
+	m.maxSessions = 3
+	err = m.checkSessionLimits("192.168.1.3:6000", nil)
+	require.EqualError(t, err, "maximum number of sessions reached")
+	require.NoError(t, m.checkSessionLimits("192.168.1.3:6000", sx3))
+}
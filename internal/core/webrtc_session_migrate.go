@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+type webRTCMigrateSessionReq struct {
+	pathName string
+	res      chan error
+}
+
+// webRTCSessionMigration is a migration whose destination path accepted the publisher.
+type webRTCSessionMigration struct {
+	req webRTCMigrateSessionReq
+	res pathAddPublisherRes
+}
+
+// migrate is called by webRTCManager.
+// It moves a publisher to another path, without interrupting its peer connection
+// and its recording files.
+func (s *webRTCSession) migrate(pathName string) error {
+	err := conf.IsValidPathName(pathName)
+	if err != nil {
+		return errAPIBadRequest{fmt.Errorf("invalid path name: %v (%s)", err, pathName)}
+	}
+
+	if pathName == s.currentPathName() {
+		return errAPIBadRequest{fmt.Errorf("session is already publishing to path '%s'", pathName)}
+	}
+
+	req := webRTCMigrateSessionReq{
+		pathName: pathName,
+		res:      make(chan error, 1),
+	}
+
+	select {
+	case s.chMigrate <- req:
+	case <-s.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+
+	select {
+	case err := <-req.res:
+		return err
+	case <-s.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// addMigrationPublisher adds the session to the destination path of a migration.
+// Authentication is skipped, since the migration has been requested through the API.
+func (s *webRTCSession) addMigrationPublisher(req webRTCMigrateSessionReq) *webRTCSessionMigration {
+	role, _ := pathPublisherRoleFromQuery(s.req.query)
+	if role != pathPublisherRoleStandalone {
+		req.res <- errAPIBadRequest{fmt.Errorf("primary and backup publishers can't be migrated")}
+		return nil
+	}
+
+	ip, _, _ := net.SplitHostPort(s.req.remoteAddr)
+
+	res := s.pathManager.addPublisher(pathAddPublisherReq{
+		author:   s,
+		pathName: req.pathName,
+		skipAuth: true,
+		credentials: authCredentials{
+			query: s.req.query,
+			ip:    net.ParseIP(ip),
+			proto: authProtocolWebRTC,
+			id:    &s.uuid,
+		},
+	})
+	if res.err != nil {
+		req.res <- errAPIBadRequest{res.err}
+		return nil
+	}
+
+	return &webRTCSessionMigration{req: req, res: res}
+}
+
+// currentPathName returns the path that the session is publishing to or reading from.
+func (s *webRTCSession) currentPathName() string {
+	s.pathMutex.RLock()
+	defer s.pathMutex.RUnlock()
+	return s.pathName
+}
+
+func (s *webRTCSession) setPathName(pathName string) {
+	s.pathMutex.Lock()
+	defer s.pathMutex.Unlock()
+	s.pathName = pathName
+}
+
+// onSessionMigrated moves a migrated publisher between the paths of its room.
+// The program of the room follows the publisher, while resumed sessions
+// publish to the new path.
+func (m *webRTCManager) onSessionMigrated(req webRTCManagerSessionMigratedReq) {
+	for _, st := range m.resumeStates {
+		if st.session == req.sx {
+			st.migratedPathName = req.newPath
+		}
+	}
+
+	room := m.findRoomByUUID(req.sx.roomid)
+	if room == nil {
+		return
+	}
+
+	if st, ok := room.streamers[req.prevPath]; ok && st.session == req.sx {
+		delete(room.streamers, req.prevPath)
+		if room.llhls {
+			m.pathManager.setHLSLowLatency(req.prevPath, false)
+		}
+	}
+	room.streamers[req.newPath] = &streamer{
+		id:      req.newPath,
+		session: req.sx,
+	}
+	m.enableLLHLS(room, req.newPath)
+	m.syncGeo(room)
+
+	if room.program != nil && room.program.nextSource() == req.prevPath {
+		room.program.setSource(req.newPath)
+	}
+
+	action := "migrated"
+	if req.fork {
+		action = "forked"
+	}
+
+	room.events.write(roomEvent{
+		Type:    roomEventMigrate,
+		Session: &req.sx.uuid,
+		Path:    req.newPath,
+		Publish: true,
+		Message: fmt.Sprintf("%s from path '%s'", action, req.prevPath),
+	})
+
+	room.Log(logger.Info, "session %s %s from path '%s' to path '%s'",
+		req.sx.uuid, action, req.prevPath, req.newPath)
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// webRTCSessionUsage is the bandwidth used by a session during its lifetime.
+type webRTCSessionUsage struct {
+	BytesReceived uint64  `json:"bytesReceived"`
+	BytesSent     uint64  `json:"bytesSent"`
+	Duration      float64 `json:"duration"`
+	Bitrate       float64 `json:"bitrate"`
+}
+
+func newWebRTCSessionUsage(bytesReceived uint64, bytesSent uint64, duration time.Duration) *webRTCSessionUsage {
+	u := &webRTCSessionUsage{
+		BytesReceived: bytesReceived,
+		BytesSent:     bytesSent,
+		Duration:      duration.Seconds(),
+	}
+
+	if u.Duration > 0 {
+		u.Bitrate = float64(bytesReceived+bytesSent) * 8 / u.Duration
+	}
+
+	return u
+}
+
+func (u *webRTCSessionUsage) String() string {
+	return fmt.Sprintf("%d bytes received, %d bytes sent in %s, mean bitrate %.0f bit/s",
+		u.BytesReceived, u.BytesSent, time.Duration(u.Duration*float64(time.Second)).Round(time.Second), u.Bitrate)
+}
+
+// saveUsage saves the bandwidth used by the session.
+// It must be called before the peer connection is closed, since counters are reset.
+func (s *webRTCSession) saveUsage() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pc == nil {
+		return
+	}
+
+	s.usage = newWebRTCSessionUsage(s.pc.BytesReceived(), s.pc.BytesSent(), time.Since(s.created))
+}
+
+// bandwidthUsage returns the bandwidth used by the session,
+// or nil if the peer connection was never established.
+func (s *webRTCSession) bandwidthUsage() *webRTCSessionUsage {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.usage
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/webrtcpc"
+)
+
+const (
+	// data channels with this label are created by the server in order to send
+	// the reader count of the path to publishers.
+	webrtcViewersDataChannelLabel = "viewers"
+
+	webrtcViewersInterval = 5 * time.Second
+)
+
+type webrtcViewersMessage struct {
+	Path    string `json:"path"`
+	Viewers int    `json:"viewers"`
+}
+
+// webrtcOfferHasDataChannels checks whether an offer contains a data channel section,
+// that is required by the server in order to create data channels.
+func webrtcOfferHasDataChannels(medias []*sdp.MediaDescription) bool {
+	for _, media := range medias {
+		if media.MediaName.Media == "application" && webrtcMediaDescriptionActive(media) {
+			return true
+		}
+	}
+	return false
+}
+
+// runViewers periodically reads the reader count of the path of a publisher,
+// exposes it in the API and, when the publisher supports data channels,
+// sends it to the publisher.
+func (s *webRTCSession) runViewers(pc *webrtcpc.PeerConnection, dataChannels bool) {
+	var dc *webrtc.DataChannel
+	dcOpen := make(chan struct{})
+	dcClosed := make(chan struct{})
+
+	if dataChannels {
+		var err error
+		dc, err = pc.CreateDataChannel(webrtcViewersDataChannelLabel, nil)
+		if err != nil {
+			s.Log(logger.Warn, "unable to create the viewers data channel: %v", err)
+			dc = nil
+		} else {
+			dc.OnOpen(func() { close(dcOpen) })
+			dc.OnClose(func() { close(dcClosed) })
+		}
+	}
+
+	t := time.NewTicker(webrtcViewersInterval)
+	defer t.Stop()
+
+	open := false
+
+	for {
+		select {
+		case <-t.C:
+			pathName := s.currentPathName()
+
+			data, err := s.pathManager.apiPathsGet(pathName)
+			if err != nil {
+				continue
+			}
+
+			viewers := len(data.Readers)
+
+			s.mutex.Lock()
+			s.viewers = &viewers
+			s.mutex.Unlock()
+
+			if open {
+				buf, _ := json.Marshal(webrtcViewersMessage{
+					Path:    pathName,
+					Viewers: viewers,
+				})
+				dc.SendText(string(buf)) //nolint:errcheck
+			}
+
+		case <-dcOpen:
+			open = true
+			dcOpen = nil
+
+		case <-dcClosed:
+			return
+
+		case <-pc.Disconnected():
+			return
+
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCOfferHasDataChannels(t *testing.T) {
+	video := &sdp.MediaDescription{
+		MediaName: sdp.MediaName{Media: "video", Port: sdp.RangedPort{Value: 9}},
+	}
+	application := &sdp.MediaDescription{
+		MediaName: sdp.MediaName{Media: "application", Port: sdp.RangedPort{Value: 9}},
+	}
+
+	require.False(t, webrtcOfferHasDataChannels([]*sdp.MediaDescription{video}))
+	require.True(t, webrtcOfferHasDataChannels([]*sdp.MediaDescription{video, application}))
+
+	// a rejected section can't be used
+	application.MediaName.Port.Value = 0
+	require.False(t, webrtcOfferHasDataChannels([]*sdp.MediaDescription{video, application}))
+}
+
+func TestWebRTCSessionAPIViewers(t *testing.T) {
+	s := &webRTCSession{req: webRTCNewSessionReq{publish: true}}
+	require.Nil(t, s.apiItem().Viewers)
+
+	viewers := 3
+	s.viewers = &viewers
+	require.Equal(t, 3, *s.apiItem().Viewers)
+}
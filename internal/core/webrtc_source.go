@@ -65,12 +65,12 @@ func (s *webRTCSource) run(ctx context.Context, cnf *conf.PathConf, _ chan *conf
 		return err
 	}
 
-	api, err := webrtcNewAPI(nil, nil, nil)
+	api, err := webrtcNewAPI(webrtcAPIConf{})
 	if err != nil {
 		return err
 	}
 
-	pc, err := webrtcpc.New(iceServers, api, s)
+	pc, err := webrtcpc.New(iceServers, nil, api, s)
 	if err != nil {
 		return err
 	}
@@ -132,12 +132,12 @@ func (s *webRTCSource) run(ctx context.Context, cnf *conf.PathConf, _ chan *conf
 		return err
 	}
 
-	err = webrtcWaitUntilConnected(ctx, pc)
+	err = webrtcWaitUntilConnected(ctx, pc, webrtcHandshakeTimeout, nil)
 	if err != nil {
 		return err
 	}
 
-	tracks, err := webrtcGatherIncomingTracks(ctx, pc, trackRecv, 0)
+	tracks, err := webrtcGatherIncomingTracks(ctx, pc, trackRecv, 0, webrtcTrackGatherTimeout)
 	if err != nil {
 		return err
 	}
@@ -154,7 +154,7 @@ func (s *webRTCSource) run(ctx context.Context, cnf *conf.PathConf, _ chan *conf
 	defer s.parent.setNotReady(pathSourceStaticSetNotReadyReq{})
 
 	for _, track := range tracks {
-		track.start(rres.stream, nil, nil, false)
+		track.start(ctx, rres.stream, nil, nil, false, nil, 0, 0)
 	}
 
 	select {
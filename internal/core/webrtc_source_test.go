@@ -20,10 +20,10 @@ import (
 func TestWebRTCSource(t *testing.T) {
 	state := 0
 
-	api, err := webrtcNewAPI(nil, nil, nil)
+	api, err := webrtcNewAPI(webrtcAPIConf{})
 	require.NoError(t, err)
 
-	pc, err := webrtcpc.New(nil, api, nilLogger{})
+	pc, err := webrtcpc.New(nil, nil, api, nilLogger{})
 	require.NoError(t, err)
 	defer pc.Close()
 
@@ -0,0 +1,555 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp/codecs"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+)
+
+const (
+	webrtcSVCAllLayers         = 255
+	webrtcSVCDowngradeInterval = 2 * time.Second
+	webrtcSVCUpgradeInterval   = 10 * time.Second
+	webrtcSVCMaxBitrateBurst   = 1 * time.Second
+)
+
+// AV1 OBU types that carry frame data.
+const (
+	av1OBUTypeSequenceHeader = 1
+	av1OBUTypeFrameHeader    = 3
+	av1OBUTypeTileGroup      = 4
+	av1OBUTypeFrame          = 6
+)
+
+// webrtcSVCMaxLayers returns the highest spatial and temporal layers requested
+// by a reader with the "maxSpatialLayer" and "maxTemporalLayer" query parameters.
+func webrtcSVCMaxLayers(query string) (int, int, error) {
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	parse := func(key string) (int, error) {
+		v := vals.Get(key)
+		if v == "" {
+			return webrtcSVCAllLayers, nil
+		}
+
+		tmp, err := strconv.ParseUint(v, 10, 8)
+		if err != nil || tmp >= webrtcSVCAllLayers {
+			return 0, fmt.Errorf("invalid %s: '%s'", key, v)
+		}
+
+		return int(tmp), nil
+	}
+
+	maxSpatial, err := parse("maxSpatialLayer")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	maxTemporal, err := parse("maxTemporalLayer")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return maxSpatial, maxTemporal, nil
+}
+
+// webrtcSVCFrame contains the layers of a frame.
+type webrtcSVCFrame struct {
+	spatial  int
+	temporal int
+	keyFrame bool
+}
+
+// webrtcVP9FrameLayers returns the layers of a VP9 frame, that are read from
+// the payload descriptor of the RTP packet that completed the frame, and whether
+// the payload descriptor contains layer indices.
+// Frames whose payload descriptor can't be read are considered key frames.
+func webrtcVP9FrameLayers(tunit *formatprocessor.UnitVP9) (webrtcSVCFrame, bool) {
+	if len(tunit.RTPPackets) == 0 {
+		return webrtcSVCFrame{keyFrame: true}, false
+	}
+
+	var p codecs.VP9Packet
+	_, err := p.Unmarshal(tunit.RTPPackets[0].Payload)
+	if err != nil {
+		return webrtcSVCFrame{keyFrame: true}, false
+	}
+
+	if !p.L {
+		return webrtcSVCFrame{keyFrame: !p.P}, false
+	}
+
+	return webrtcSVCFrame{
+		spatial:  int(p.SID),
+		temporal: int(p.TID),
+		keyFrame: !p.P && p.SID == 0,
+	}, true
+}
+
+// webrtcH264FrameLayers returns the layers of a H264 access unit.
+// Since H264 streams usually don't have temporal scalability, frames that are not
+// used as reference by other frames (nal_ref_idc is zero) are considered the
+// highest temporal layer, in order to allow dropping them without affecting other frames.
+func webrtcH264FrameLayers(au [][]byte) webrtcSVCFrame {
+	var frame webrtcSVCFrame
+	hasSlices := false
+	reference := false
+
+	for _, nalu := range au {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeIDR:
+			frame.keyFrame = true
+			hasSlices = true
+			reference = true
+
+		case h264.NALUTypeNonIDR, h264.NALUTypeDataPartitionA:
+			hasSlices = true
+			if (nalu[0]>>5)&0b11 != 0 {
+				reference = true
+			}
+		}
+	}
+
+	if hasSlices && !reference {
+		frame.temporal = 1
+	}
+
+	return frame
+}
+
+// webrtcVP8FrameLayers returns the layers of a VP8 frame.
+// Since temporal layers of VP8 are not supported, the frame is always in the base layer.
+func webrtcVP8FrameLayers(frame []byte) webrtcSVCFrame {
+	return webrtcSVCFrame{
+		keyFrame: len(frame) != 0 && frame[0]&0x01 == 0,
+	}
+}
+
+// webrtcFrameSize returns the size of a frame made of NALUs or OBUs, in bytes.
+func webrtcFrameSize(units [][]byte) int {
+	n := 0
+	for _, u := range units {
+		n += len(u)
+	}
+	return n
+}
+
+// webrtcAV1OBULayers returns the layers of an OBU, when it has an extension header.
+func webrtcAV1OBULayers(obu []byte) (int, int, bool) {
+	if len(obu) < 2 || (obu[0]>>2)&0b1 == 0 {
+		return 0, 0, false
+	}
+
+	return int(obu[1] >> 3 & 0b11), int(obu[1] >> 5), true
+}
+
+// webrtcAV1FilterTU removes OBUs that belong to layers higher than the given ones
+// from a temporal unit. It returns the filtered temporal unit, or nil if
+// the temporal unit doesn't contain any frame anymore, and the layers of the
+// temporal unit.
+func webrtcAV1FilterTU(tu [][]byte, maxSpatial int, maxTemporal int) ([][]byte, webrtcSVCFrame, bool) {
+	frame := webrtcSVCFrame{temporal: webrtcSVCAllLayers}
+	svc := false
+	dropped := false
+	hasFrames := false
+
+	filtered := make([][]byte, 0, len(tu))
+
+	for _, obu := range tu {
+		if len(obu) == 0 {
+			continue
+		}
+
+		typ := obu[0] >> 3
+		if typ == av1OBUTypeSequenceHeader {
+			frame.keyFrame = true
+		}
+
+		spatial, temporal, ok := webrtcAV1OBULayers(obu)
+		if ok {
+			svc = true
+
+			if spatial > frame.spatial {
+				frame.spatial = spatial
+			}
+			if temporal < frame.temporal {
+				frame.temporal = temporal
+			}
+
+			if spatial > maxSpatial || temporal > maxTemporal {
+				dropped = true
+				continue
+			}
+		}
+
+		if typ == av1OBUTypeFrameHeader || typ == av1OBUTypeTileGroup || typ == av1OBUTypeFrame {
+			hasFrames = true
+		}
+
+		filtered = append(filtered, obu)
+	}
+
+	if !svc {
+		return tu, frame, false
+	}
+
+	if !dropped {
+		return tu, frame, true
+	}
+
+	if !hasFrames {
+		return nil, frame, true
+	}
+
+	return filtered, frame, true
+}
+
+// webrtcSVCFilter drops the spatial and temporal layers of VP9 and AV1 streams,
+// and the non-reference frames of H264 streams, that exceed the ones requested
+// by a reader or, when adaptation is enabled, that the reader is unable to
+// receive without losses.
+// Limits are lowered immediately, while they are raised at the next key frame
+// (spatial layers) or at the next frame of the base temporal layer (temporal layers),
+// in order not to send frames whose references were not sent.
+// When the reader has a bitrate limit, frames that exceed it are dropped too,
+// starting from the highest layers. When a frame of the base layer is dropped,
+// frames are dropped until the next key frame.
+// Limits are protected by a mutex, since they are updated by RTCP feedback
+// while frames are filtered.
+type webrtcSVCFilter struct {
+	maxSpatial  int
+	maxTemporal int
+	adaptive    bool
+	maxBitrate  float64 // bits per second, zero means no limit
+
+	mutex          sync.Mutex
+	spatial        int // current limits
+	temporal       int
+	targetSpatial  int // limits to apply at the next switching point
+	targetTemporal int
+	seenSpatial    int // highest layers found in the stream
+	seenTemporal   int
+	lastChange     time.Time
+	goodSince      time.Time
+	budget         float64 // bytes that can be sent without exceeding maxBitrate
+	budgetUpdated  time.Time
+	waitKeyFrame   bool
+	bitrateDropped uint64
+}
+
+// webrtcNewSVCFilter returns a filter for the layers of a format sent to a reader,
+// or nil if the reader receives all layers and has no bitrate limit.
+func webrtcNewSVCFilter(
+	forma formats.Format,
+	maxSpatial int,
+	maxTemporal int,
+	svcAdaptation bool,
+	h264FrameDropping bool,
+	maxBitrate int,
+) *webrtcSVCFilter {
+	var adaptive bool
+
+	switch forma.(type) {
+	case *formats.VP9, *formats.AV1:
+		adaptive = svcAdaptation
+
+	case *formats.H264:
+		adaptive = h264FrameDropping
+
+	case *formats.VP8:
+
+	default:
+		return nil
+	}
+
+	if !adaptive && maxSpatial == webrtcSVCAllLayers && maxTemporal == webrtcSVCAllLayers &&
+		maxBitrate == 0 {
+		return nil
+	}
+
+	return newWebRTCSVCFilter(maxSpatial, maxTemporal, adaptive, maxBitrate)
+}
+
+func newWebRTCSVCFilter(maxSpatial int, maxTemporal int, adaptive bool, maxBitrate int) *webrtcSVCFilter {
+	return &webrtcSVCFilter{
+		maxSpatial:     maxSpatial,
+		maxTemporal:    maxTemporal,
+		adaptive:       adaptive,
+		maxBitrate:     float64(maxBitrate),
+		spatial:        maxSpatial,
+		temporal:       maxTemporal,
+		targetSpatial:  maxSpatial,
+		targetTemporal: maxTemporal,
+	}
+}
+
+// filter returns the unit to send to the reader, or nil if the unit must be dropped.
+func (f *webrtcSVCFilter) filter(unit formatprocessor.Unit) formatprocessor.Unit {
+	switch tunit := unit.(type) {
+	case *formatprocessor.UnitH264:
+		if tunit.AU == nil {
+			return unit
+		}
+
+		frame := webrtcH264FrameLayers(tunit.AU)
+
+		_, temporal := f.onFrame(frame)
+		if frame.temporal > temporal {
+			return nil
+		}
+
+		if !f.consumeBitrate(frame, webrtcFrameSize(tunit.AU), time.Now()) {
+			return nil
+		}
+
+		return unit
+
+	case *formatprocessor.UnitVP8:
+		if tunit.Frame == nil {
+			return unit
+		}
+
+		frame := webrtcVP8FrameLayers(tunit.Frame)
+		f.onFrame(frame)
+
+		if !f.consumeBitrate(frame, len(tunit.Frame), time.Now()) {
+			return nil
+		}
+
+		return unit
+
+	case *formatprocessor.UnitVP9:
+		if tunit.Frame == nil {
+			return unit
+		}
+
+		// streams without layer indices are made of the base layer only
+		frame, ok := webrtcVP9FrameLayers(tunit)
+
+		spatial, temporal := f.onFrame(frame)
+		if ok && (frame.spatial > spatial || frame.temporal > temporal) {
+			return nil
+		}
+
+		if !f.consumeBitrate(frame, len(tunit.Frame), time.Now()) {
+			return nil
+		}
+
+		return unit
+
+	case *formatprocessor.UnitAV1:
+		if tunit.TU == nil {
+			return unit
+		}
+
+		// layers are read first, since the frame may be a switching point
+		_, frame, ok := webrtcAV1FilterTU(tunit.TU, webrtcSVCAllLayers, webrtcSVCAllLayers)
+		if !ok {
+			frame = webrtcSVCFrame{keyFrame: frame.keyFrame}
+			f.onFrame(frame)
+
+			if !f.consumeBitrate(frame, webrtcFrameSize(tunit.TU), time.Now()) {
+				return nil
+			}
+
+			return unit
+		}
+
+		spatial, temporal := f.onFrame(frame)
+
+		tu, _, _ := webrtcAV1FilterTU(tunit.TU, spatial, temporal)
+		if tu == nil {
+			return nil
+		}
+
+		if !f.consumeBitrate(frame, webrtcFrameSize(tu), time.Now()) {
+			return nil
+		}
+
+		return &formatprocessor.UnitAV1{
+			BaseUnit: tunit.BaseUnit,
+			PTS:      tunit.PTS,
+			TU:       tu,
+		}
+	}
+
+	return unit
+}
+
+// onFrame updates the layers found in the stream and applies pending limits.
+// It returns the limits to use with the frame.
+func (f *webrtcSVCFilter) onFrame(frame webrtcSVCFrame) (int, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if frame.spatial > f.seenSpatial {
+		f.seenSpatial = frame.spatial
+	}
+	if frame.temporal > f.seenTemporal {
+		f.seenTemporal = frame.temporal
+	}
+
+	if f.targetSpatial < f.spatial || frame.keyFrame {
+		f.spatial = f.targetSpatial
+	}
+
+	if f.targetTemporal < f.temporal || frame.temporal == 0 {
+		f.temporal = f.targetTemporal
+	}
+
+	return f.spatial, f.temporal
+}
+
+// consumeBitrate returns whether a frame can be sent without exceeding the bitrate limit.
+// The limit is enforced with a token bucket that allows bursts of webrtcSVCMaxBitrateBurst.
+// Frames are sent while the budget is positive, since key frames
+// can be bigger than the burst.
+func (f *webrtcSVCFilter) consumeBitrate(frame webrtcSVCFrame, size int, now time.Time) bool {
+	if f.maxBitrate == 0 {
+		return true
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	burst := f.maxBitrate / 8 * webrtcSVCMaxBitrateBurst.Seconds()
+
+	if f.budgetUpdated.IsZero() {
+		f.budget = burst
+	} else {
+		f.budget += f.maxBitrate / 8 * now.Sub(f.budgetUpdated).Seconds()
+		if f.budget > burst {
+			f.budget = burst
+		}
+	}
+	f.budgetUpdated = now
+
+	if frame.keyFrame {
+		f.waitKeyFrame = false
+	}
+
+	if !f.waitKeyFrame && f.budget > 0 {
+		f.budget -= float64(size)
+		return true
+	}
+
+	f.bitrateDropped++
+
+	// frames that refer to the dropped one must be dropped too,
+	// until the next switching point.
+	switch {
+	case f.waitKeyFrame:
+
+	case frame.spatial > 0:
+		f.spatial = minInt(f.spatial, frame.spatial-1)
+
+	case frame.temporal > 0:
+		f.temporal = minInt(f.temporal, frame.temporal-1)
+
+	default:
+		f.waitKeyFrame = true
+	}
+
+	return false
+}
+
+// onRTCP is called when the reader sends RTCP packets.
+func (f *webrtcSVCFilter) onRTCP(pkts []rtcp.Packet) {
+	if !f.adaptive {
+		return
+	}
+
+	for _, pkt := range pkts {
+		if rr, ok := pkt.(*rtcp.ReceiverReport); ok {
+			for _, report := range rr.Reports {
+				f.onLoss(float64(report.FractionLost)/256, time.Now())
+			}
+		}
+	}
+}
+
+func (f *webrtcSVCFilter) onLoss(loss float64, now time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	spatial := minInt(f.targetSpatial, f.seenSpatial)
+	temporal := minInt(f.targetTemporal, f.seenTemporal)
+
+	switch {
+	case loss > webrtcFeedbackMaxLoss:
+		f.goodSince = time.Time{}
+
+		if now.Sub(f.lastChange) < webrtcSVCDowngradeInterval {
+			return
+		}
+
+		// frame rate is reduced before resolution
+		switch {
+		case temporal > 0:
+			f.targetTemporal = temporal - 1
+		case spatial > 0:
+			f.targetSpatial = spatial - 1
+		default:
+			return
+		}
+		f.lastChange = now
+
+	case loss < webrtcFeedbackMinLoss:
+		if f.goodSince.IsZero() {
+			f.goodSince = now
+		}
+
+		if now.Sub(f.goodSince) < webrtcSVCUpgradeInterval ||
+			now.Sub(f.lastChange) < webrtcSVCUpgradeInterval {
+			return
+		}
+
+		switch {
+		case spatial < minInt(f.maxSpatial, f.seenSpatial):
+			f.targetSpatial = spatial + 1
+		case temporal < minInt(f.maxTemporal, f.seenTemporal):
+			f.targetTemporal = temporal + 1
+		default:
+			return
+		}
+		f.lastChange = now
+
+	default:
+		f.goodSince = time.Time{}
+	}
+}
+
+// apiItem returns the layers that are currently sent.
+func (f *webrtcSVCFilter) apiItem() *apiWebRTCSessionSVC {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return &apiWebRTCSessionSVC{
+		SpatialLayer:         minInt(f.spatial, f.seenSpatial),
+		TemporalLayer:        minInt(f.temporal, f.seenTemporal),
+		BitrateDroppedFrames: f.bitrateDropped,
+	}
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
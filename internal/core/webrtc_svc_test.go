@@ -0,0 +1,205 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/formatprocessor"
+)
+
+func webrtcTestVP9Unit(sid uint8, tid uint8, inter bool) *formatprocessor.UnitVP9 {
+	b0 := byte(0x2C) // L, B, E
+	if inter {
+		b0 |= 0x40
+	}
+
+	return &formatprocessor.UnitVP9{
+		BaseUnit: formatprocessor.BaseUnit{
+			RTPPackets: []*rtp.Packet{{
+				Payload: []byte{b0, tid<<5 | sid<<1, 0, 1, 2, 3},
+			}},
+		},
+		Frame: []byte{1, 2, 3},
+	}
+}
+
+func TestWebRTCSVCMaxLayers(t *testing.T) {
+	s, tl, err := webrtcSVCMaxLayers("")
+	require.NoError(t, err)
+	require.Equal(t, webrtcSVCAllLayers, s)
+	require.Equal(t, webrtcSVCAllLayers, tl)
+
+	s, tl, err = webrtcSVCMaxLayers("maxSpatialLayer=0&maxTemporalLayer=1")
+	require.NoError(t, err)
+	require.Equal(t, 0, s)
+	require.Equal(t, 1, tl)
+
+	_, _, err = webrtcSVCMaxLayers("maxSpatialLayer=-1")
+	require.EqualError(t, err, "invalid maxSpatialLayer: '-1'")
+}
+
+func TestWebRTCSVCFilterVP9(t *testing.T) {
+	f := newWebRTCSVCFilter(0, 1, false, 0)
+
+	require.NotNil(t, f.filter(webrtcTestVP9Unit(0, 0, false)))
+	require.Nil(t, f.filter(webrtcTestVP9Unit(1, 0, false)))
+	require.NotNil(t, f.filter(webrtcTestVP9Unit(0, 1, true)))
+	require.Nil(t, f.filter(webrtcTestVP9Unit(0, 2, true)))
+
+	// streams without layer indices are not filtered
+	u := &formatprocessor.UnitVP9{
+		BaseUnit: formatprocessor.BaseUnit{
+			RTPPackets: []*rtp.Packet{{Payload: []byte{0x0C, 1, 2, 3}}},
+		},
+		Frame: []byte{1, 2, 3},
+	}
+	require.NotNil(t, f.filter(u))
+
+	require.Equal(t, &apiWebRTCSessionSVC{SpatialLayer: 0, TemporalLayer: 1}, f.apiItem())
+}
+
+func TestWebRTCSVCFilterAV1(t *testing.T) {
+	// temporal delimiter, sequence header, frame of spatial layer 0, frame of spatial layer 1
+	tu := [][]byte{
+		{2 << 3},
+		{1 << 3, 0xAA},
+		{6<<3 | 0b100, 0<<5 | 0<<3, 1, 2},
+		{6<<3 | 0b100, 0<<5 | 1<<3, 3, 4},
+	}
+
+	f := newWebRTCSVCFilter(0, webrtcSVCAllLayers, false, 0)
+
+	out := f.filter(&formatprocessor.UnitAV1{TU: tu, PTS: time.Second})
+	require.Equal(t, &formatprocessor.UnitAV1{TU: tu[:3], PTS: time.Second}, out)
+
+	// a temporal unit of the second temporal layer
+	tu = [][]byte{
+		{2 << 3},
+		{6<<3 | 0b100, 1<<5 | 1<<3, 5, 6},
+	}
+	require.Nil(t, f.filter(&formatprocessor.UnitAV1{TU: tu}))
+
+	// streams without extension headers are not filtered
+	u := &formatprocessor.UnitAV1{TU: [][]byte{{2 << 3}, {6 << 3, 1, 2}}}
+	require.Equal(t, u, f.filter(u))
+}
+
+func TestWebRTCSVCFilterAdaptation(t *testing.T) {
+	f := newWebRTCSVCFilter(webrtcSVCAllLayers, webrtcSVCAllLayers, true, 0)
+
+	f.filter(webrtcTestVP9Unit(0, 0, false))
+	f.filter(webrtcTestVP9Unit(1, 0, false))
+	f.filter(webrtcTestVP9Unit(0, 1, true))
+	f.filter(webrtcTestVP9Unit(1, 1, true))
+
+	now := time.Now()
+
+	// temporal layers are dropped first
+	f.onLoss(0.2, now)
+	require.Nil(t, f.filter(webrtcTestVP9Unit(0, 1, true)))
+	require.NotNil(t, f.filter(webrtcTestVP9Unit(1, 0, true)))
+
+	// changes are rate limited
+	f.onLoss(0.2, now.Add(time.Second))
+	require.NotNil(t, f.filter(webrtcTestVP9Unit(1, 0, true)))
+
+	f.onLoss(0.2, now.Add(3*time.Second))
+	require.Nil(t, f.filter(webrtcTestVP9Unit(1, 0, true)))
+	require.NotNil(t, f.filter(webrtcTestVP9Unit(0, 0, true)))
+
+	// spatial layers are restored at the next key frame
+	f.onLoss(0, now.Add(4*time.Second))
+	f.onLoss(0, now.Add(14*time.Second))
+	require.Nil(t, f.filter(webrtcTestVP9Unit(1, 0, true)))
+	require.NotNil(t, f.filter(webrtcTestVP9Unit(0, 0, false)))
+	require.NotNil(t, f.filter(webrtcTestVP9Unit(1, 0, false)))
+	require.Nil(t, f.filter(webrtcTestVP9Unit(0, 1, true)))
+}
+
+func TestWebRTCSVCFilterH264(t *testing.T) {
+	require.Nil(t, webrtcNewSVCFilter(&formats.H264{}, webrtcSVCAllLayers, webrtcSVCAllLayers, true, false, 0))
+
+	f := webrtcNewSVCFilter(&formats.H264{}, webrtcSVCAllLayers, webrtcSVCAllLayers, false, true, 0)
+	require.NotNil(t, f)
+
+	idr := &formatprocessor.UnitH264{AU: [][]byte{{0x67, 1}, {0x68, 1}, {0x65, 1}}}
+	ref := &formatprocessor.UnitH264{AU: [][]byte{{0x41, 1}}}
+	nonRef := &formatprocessor.UnitH264{AU: [][]byte{{0x01, 1}}}
+
+	require.NotNil(t, f.filter(idr))
+	require.NotNil(t, f.filter(nonRef))
+
+	f.onLoss(0.3, time.Now())
+	require.NotNil(t, f.filter(ref))
+	require.Nil(t, f.filter(nonRef))
+	require.Equal(t, &apiWebRTCSessionSVC{SpatialLayer: 0, TemporalLayer: 0}, f.apiItem())
+}
+
+func TestWebRTCSVCFilterMaxBitrate(t *testing.T) {
+	require.Nil(t, webrtcNewSVCFilter(&formats.VP8{}, webrtcSVCAllLayers, webrtcSVCAllLayers, true, true, 0))
+	require.NotNil(t, webrtcNewSVCFilter(&formats.VP8{}, webrtcSVCAllLayers, webrtcSVCAllLayers, false, false, 80000))
+
+	frame := make([]byte, 1000)
+	idr := &formatprocessor.UnitH264{AU: [][]byte{{0x67, 1}, {0x68, 1}, append([]byte{0x65}, frame...)}}
+	ref := &formatprocessor.UnitH264{AU: [][]byte{append([]byte{0x41}, frame...)}}
+	nonRef := &formatprocessor.UnitH264{AU: [][]byte{append([]byte{0x01}, frame...)}}
+
+	// a reader limited to 80kbit/s, that is 10 frames per second, among unlimited readers
+	limited := newWebRTCSVCFilter(webrtcSVCAllLayers, webrtcSVCAllLayers, false, 80000)
+	unlimited := []*webrtcSVCFilter{
+		newWebRTCSVCFilter(webrtcSVCAllLayers, webrtcSVCAllLayers, false, 0),
+		newWebRTCSVCFilter(webrtcSVCAllLayers, webrtcSVCAllLayers, true, 0),
+	}
+
+	limitedSent := 0
+	unlimitedSent := 0
+
+	for i := 0; i < 50; i++ {
+		var u formatprocessor.Unit
+		switch {
+		case i == 0:
+			u = idr
+		case i%2 == 0:
+			u = ref
+		default:
+			u = nonRef
+		}
+
+		if limited.filter(u) != nil {
+			limitedSent++
+		}
+
+		for _, f := range unlimited {
+			if f.filter(u) != nil {
+				unlimitedSent++
+			}
+		}
+	}
+
+	require.Equal(t, 100, unlimitedSent)
+	require.Greater(t, limitedSent, 0)
+	require.LessOrEqual(t, limitedSent, 11)
+	require.Equal(t, uint64(50-limitedSent), limited.bitrateDropped)
+}
+
+func TestWebRTCSVCFilterMaxBitrateKeyFrame(t *testing.T) {
+	f := newWebRTCSVCFilter(webrtcSVCAllLayers, webrtcSVCAllLayers, false, 8000)
+	now := time.Now()
+
+	// the burst is 1000 bytes
+	require.True(t, f.consumeBitrate(webrtcSVCFrame{keyFrame: true}, 1500, now))
+
+	// frames that exceed the limit are dropped, starting from the highest layers
+	require.False(t, f.consumeBitrate(webrtcSVCFrame{temporal: 1}, 100, now))
+	require.Equal(t, 0, f.temporal)
+	require.False(t, f.consumeBitrate(webrtcSVCFrame{}, 100, now))
+
+	// after a frame of the base layer is dropped, frames are dropped until the next key frame
+	require.False(t, f.consumeBitrate(webrtcSVCFrame{}, 100, now.Add(2*time.Second)))
+	require.True(t, f.consumeBitrate(webrtcSVCFrame{keyFrame: true}, 100, now.Add(2*time.Second)))
+	require.True(t, f.consumeBitrate(webrtcSVCFrame{}, 100, now.Add(2*time.Second)))
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// tenantOfClub returns the tenant that owns a club, if any.
+func (m *webRTCManager) tenantOfClub(clubName string) (string, *conf.Tenant) {
+	m.confMutex.RLock()
+	defer m.confMutex.RUnlock()
+
+	name := m.tenants.ByClub(clubName)
+	if name == "" {
+		return "", nil
+	}
+
+	return name, m.tenants[name]
+}
+
+// tenant returns the configuration of a tenant.
+// It returns nil when the tenant has been removed from the configuration.
+func (m *webRTCManager) tenant(name string) *conf.Tenant {
+	if name == "" {
+		return nil
+	}
+
+	m.confMutex.RLock()
+	defer m.confMutex.RUnlock()
+
+	return m.tenants[name]
+}
+
+// checkTenantRooms checks whether a room can be created without exceeding
+// the maximum number of rooms of its tenant.
+func (m *webRTCManager) checkTenantRooms(tenantName string, tenant *conf.Tenant) error {
+	if tenant == nil || tenant.MaxRooms == 0 {
+		return nil
+	}
+
+	n := 0
+	for _, room := range m.rooms {
+		if room.tenant == tenantName {
+			n++
+		}
+	}
+
+	if n >= tenant.MaxRooms {
+		return fmt.Errorf("maximum number of rooms of tenant '%s' reached", tenantName)
+	}
+
+	return nil
+}
+
+// checkTenantSession checks whether a session can join a room without using
+// paths of other tenants and without exceeding the maximum number of sessions of the tenant.
+// replaced is a session that is going to be closed by the new one, and is not counted.
+func (m *webRTCManager) checkTenantSession(room *Room, pathName string, replaced *webRTCSession) error {
+	tenant := m.tenant(room.tenant)
+	if tenant == nil {
+		return nil
+	}
+
+	if !tenant.OwnsPath(pathName) {
+		return fmt.Errorf("path '%s' doesn't belong to tenant '%s'", pathName, room.tenant)
+	}
+
+	if tenant.MaxSessions == 0 {
+		return nil
+	}
+
+	n := 0
+	for sx := range m.sessions {
+		if sx == replaced {
+			continue
+		}
+
+		if m.sessionTenant(sx) == room.tenant {
+			n++
+		}
+	}
+
+	if n >= tenant.MaxSessions {
+		return fmt.Errorf("maximum number of sessions of tenant '%s' reached", room.tenant)
+	}
+
+	return nil
+}
+
+// sessionTenant returns the tenant of a session, that is the one of its room.
+func (m *webRTCManager) sessionTenant(sx *webRTCSession) string {
+	room := m.findRoomByUUID(sx.roomid)
+	if room == nil {
+		return ""
+	}
+	return room.tenant
+}
+
+// withTenant returns a copy of the configuration with bucket and region
+// set by the tenant that owns the room.
+func (c roomRecordConf) withTenant(tenant *conf.Tenant) roomRecordConf {
+	if tenant == nil {
+		return c
+	}
+	if tenant.Bucket != "" {
+		c.bucket = tenant.Bucket
+	}
+	if tenant.Region != "" {
+		c.region = tenant.Region
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func TestWebRTCTenantLimits(t *testing.T) {
+	roomA := &Room{uuid: uuid.New(), tenant: "clubA"}
+	roomB := &Room{uuid: uuid.New(), tenant: "clubB"}
+
+	sx1 := &webRTCSession{roomid: roomA.uuid}
+	sx2 := &webRTCSession{roomid: roomB.uuid}
+
+	m := &webRTCManager{
+		rooms: map[uuid.UUID]*Room{
+			roomA.uuid: roomA,
+			roomB.uuid: roomB,
+		},
+		sessions: map[*webRTCSession]struct{}{
+			sx1: {},
+			sx2: {},
+		},
+		tenants: conf.Tenants{
+			"clubA": {
+				Clubs:       []string{"club-a"},
+				PathPrefix:  "club-a",
+				MaxRooms:    1,
+				MaxSessions: 1,
+			},
+		},
+	}
+
+	name, tenant := m.tenantOfClub("club-a")
+	require.Equal(t, "clubA", name)
+	require.Equal(t, 1, tenant.MaxRooms)
+
+	err := m.checkTenantRooms(name, tenant)
+	require.EqualError(t, err, "maximum number of rooms of tenant 'clubA' reached")
+
+	err = m.checkTenantSession(roomA, "club-b/cam", nil)
+	require.EqualError(t, err, "path 'club-b/cam' doesn't belong to tenant 'clubA'")
+
+	err = m.checkTenantSession(roomA, "club-a/cam", nil)
+	require.EqualError(t, err, "maximum number of sessions of tenant 'clubA' reached")
+
+	// a resumed session replaces the previous one
+	require.NoError(t, m.checkTenantSession(roomA, "club-a/cam", sx1))
+
+	// rooms of tenants that are not configured are not limited
+	require.NoError(t, m.checkTenantSession(roomB, "club-a/cam", nil))
+
+	rc := roomRecordConf{bucket: "default", region: "us-east-1"}.withTenant(&conf.Tenant{Bucket: "club-a"})
+	require.Equal(t, "club-a", rc.bucket)
+	require.Equal(t, "us-east-1", rc.region)
+}
+
+func TestAPITenantByToken(t *testing.T) {
+	tenants := conf.Tenants{
+		"club1": {APIToken: "secret1"},
+	}
+
+	for _, header := range []string{"Bearer secret1", "bearer secret1", "BEARER  secret1"} {
+		tenant := apiTenantByToken(tenants, header)
+		require.NotNil(t, tenant)
+		require.Equal(t, "club1", tenant.name)
+	}
+
+	for _, header := range []string{"", "Bearer", "Bearer ", "Basic secret1", "Bearer secret2"} {
+		require.Nil(t, apiTenantByToken(tenants, header))
+	}
+}
@@ -4,9 +4,12 @@ package httpserv
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/logger"
@@ -31,12 +34,14 @@ type WrappedServer struct {
 }
 
 // NewWrappedServer allocates a WrappedServer.
+// When clientCA is filled, clients must provide a certificate signed by it.
 func NewWrappedServer(
 	network string,
 	address string,
 	readTimeout time.Duration,
 	serverCert string,
 	serverKey string,
+	clientCA string,
 	handler http.Handler,
 	parent logger.Writer,
 ) (*WrappedServer, error) {
@@ -56,6 +61,23 @@ func NewWrappedServer(
 		tlsConfig = &tls.Config{
 			Certificates: []tls.Certificate{crt},
 		}
+
+		if clientCA != "" {
+			byts, err := os.ReadFile(clientCA)
+			if err != nil {
+				ln.Close()
+				return nil, err
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(byts) {
+				ln.Close()
+				return nil, fmt.Errorf("unable to load client CA '%s'", clientCA)
+			}
+
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
 	}
 
 	h := handler
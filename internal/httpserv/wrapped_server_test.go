@@ -24,6 +24,7 @@ func TestFilterEmptyPath(t *testing.T) {
 		10*time.Second,
 		"",
 		"",
+		"",
 		nil,
 		&testLogger{})
 	require.NoError(t, err)
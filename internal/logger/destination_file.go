@@ -7,26 +7,26 @@ import (
 )
 
 type destinationFile struct {
-	file *os.File
-	buf  bytes.Buffer
+	format Format
+	file   *os.File
+	buf    bytes.Buffer
 }
 
-func newDestinationFile(filePath string) (destination, error) {
+func newDestinationFile(format Format, filePath string) (destination, error) {
 	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
 		return nil, err
 	}
 
 	return &destinationFile{
-		file: f,
+		format: format,
+		file:   f,
 	}, nil
 }
 
-func (d *destinationFile) log(t time.Time, level Level, format string, args ...interface{}) {
+func (d *destinationFile) log(t time.Time, level Level, fields Fields, format string, args ...interface{}) {
 	d.buf.Reset()
-	writeTime(&d.buf, t, false)
-	writeLevel(&d.buf, level, false)
-	writeContent(&d.buf, format, args)
+	writeEntry(&d.buf, d.format, t, level, fields, format, args, false)
 	d.file.Write(d.buf.Bytes()) //nolint:errcheck
 }
 
@@ -9,22 +9,22 @@ import (
 )
 
 type destinationStdout struct {
+	format   Format
 	useColor bool
 
 	buf bytes.Buffer
 }
 
-func newDestionationStdout() destination {
+func newDestionationStdout(format Format) destination {
 	return &destinationStdout{
-		useColor: term.IsTerminal(int(os.Stdout.Fd())),
+		format:   format,
+		useColor: format == FormatText && term.IsTerminal(int(os.Stdout.Fd())),
 	}
 }
 
-func (d *destinationStdout) log(t time.Time, level Level, format string, args ...interface{}) {
+func (d *destinationStdout) log(t time.Time, level Level, fields Fields, format string, args ...interface{}) {
 	d.buf.Reset()
-	writeTime(&d.buf, t, d.useColor)
-	writeLevel(&d.buf, level, d.useColor)
-	writeContent(&d.buf, format, args)
+	writeEntry(&d.buf, d.format, t, level, fields, format, args, d.useColor)
 	os.Stdout.Write(d.buf.Bytes()) //nolint:errcheck
 }
 
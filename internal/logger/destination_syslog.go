@@ -7,26 +7,26 @@ import (
 )
 
 type destinationSysLog struct {
+	format Format
 	syslog io.WriteCloser
 	buf    bytes.Buffer
 }
 
-func newDestinationSyslog() (destination, error) {
+func newDestinationSyslog(format Format) (destination, error) {
 	syslog, err := newSysLog("mediamtx")
 	if err != nil {
 		return nil, err
 	}
 
 	return &destinationSysLog{
+		format: format,
 		syslog: syslog,
 	}, nil
 }
 
-func (d *destinationSysLog) log(t time.Time, level Level, format string, args ...interface{}) {
+func (d *destinationSysLog) log(t time.Time, level Level, fields Fields, format string, args ...interface{}) {
 	d.buf.Reset()
-	writeTime(&d.buf, t, false)
-	writeLevel(&d.buf, level, false)
-	writeContent(&d.buf, format, args)
+	writeEntry(&d.buf, d.format, t, level, fields, format, args, false)
 	d.syslog.Write(d.buf.Bytes())
 }
 
@@ -0,0 +1,36 @@
+package logger
+
+// Fields are structured fields of a log entry.
+// They can be passed as argument of Log() and are written only when the JSON format is in use.
+type Fields map[string]string
+
+// extractFields removes Fields from arguments and merges them.
+func extractFields(args []interface{}) (Fields, []interface{}) {
+	var fields Fields
+	var rest []interface{}
+
+	for i, arg := range args {
+		f, ok := arg.(Fields)
+		if !ok {
+			if fields != nil {
+				rest = append(rest, arg)
+			}
+			continue
+		}
+
+		if fields == nil {
+			fields = make(Fields)
+			rest = append([]interface{}{}, args[:i]...)
+		}
+
+		for k, v := range f {
+			fields[k] = v
+		}
+	}
+
+	if fields == nil {
+		return nil, args
+	}
+
+	return fields, rest
+}
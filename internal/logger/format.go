@@ -0,0 +1,12 @@
+package logger
+
+// Format is a log format.
+type Format int
+
+const (
+	// FormatText writes entries as human-readable lines.
+	FormatText Format = iota
+
+	// FormatJSON writes entries as JSON objects, one per line.
+	FormatJSON
+)
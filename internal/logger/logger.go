@@ -3,6 +3,7 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -19,7 +20,7 @@ type Logger struct {
 }
 
 // New allocates a log handler.
-func New(level Level, destinations []Destination, filePath string) (*Logger, error) {
+func New(level Level, format Format, destinations []Destination, filePath string) (*Logger, error) {
 	lh := &Logger{
 		level: level,
 	}
@@ -27,10 +28,10 @@ func New(level Level, destinations []Destination, filePath string) (*Logger, err
 	for _, destType := range destinations {
 		switch destType {
 		case DestinationStdout:
-			lh.destinations = append(lh.destinations, newDestionationStdout())
+			lh.destinations = append(lh.destinations, newDestionationStdout(format))
 
 		case DestinationFile:
-			dest, err := newDestinationFile(filePath)
+			dest, err := newDestinationFile(format, filePath)
 			if err != nil {
 				lh.Close()
 				return nil, err
@@ -38,7 +39,7 @@ func New(level Level, destinations []Destination, filePath string) (*Logger, err
 			lh.destinations = append(lh.destinations, dest)
 
 		case DestinationSyslog:
-			dest, err := newDestinationSyslog()
+			dest, err := newDestinationSyslog(format)
 			if err != nil {
 				lh.Close()
 				return nil, err
@@ -140,7 +141,58 @@ func writeContent(buf *bytes.Buffer, format string, args []interface{}) {
 	buf.WriteByte('\n')
 }
 
+func levelName(level Level) string {
+	switch level {
+	case Debug:
+		return "debug"
+
+	case Info:
+		return "info"
+
+	case Warn:
+		return "warn"
+	}
+
+	return "error"
+}
+
+func writeJSON(buf *bytes.Buffer, t time.Time, level Level, fields Fields, format string, args []interface{}) {
+	entry := make(map[string]string, len(fields)+3)
+	for k, v := range fields {
+		entry[k] = v
+	}
+
+	entry["time"] = t.Format(time.RFC3339Nano)
+	entry["level"] = levelName(level)
+	entry["message"] = fmt.Sprintf(format, args...)
+
+	enc, _ := json.Marshal(entry)
+	buf.Write(enc)
+	buf.WriteByte('\n')
+}
+
+func writeEntry(
+	buf *bytes.Buffer,
+	logFormat Format,
+	t time.Time,
+	level Level,
+	fields Fields,
+	format string,
+	args []interface{},
+	useColor bool,
+) {
+	if logFormat == FormatJSON {
+		writeJSON(buf, t, level, fields, format, args)
+		return
+	}
+
+	writeTime(buf, t, useColor)
+	writeLevel(buf, level, useColor)
+	writeContent(buf, format, args)
+}
+
 // Log writes a log entry.
+// Fields passed as arguments are removed from arguments and attached to the entry.
 func (lh *Logger) Log(level Level, format string, args ...interface{}) {
 	if level < lh.level {
 		return
@@ -150,8 +202,9 @@ func (lh *Logger) Log(level Level, format string, args ...interface{}) {
 	defer lh.mutex.Unlock()
 
 	t := time.Now()
+	fields, args := extractFields(args)
 
 	for _, dest := range lh.destinations {
-		dest.log(t, level, format, args...)
+		dest.log(t, level, fields, format, args...)
 	}
 }
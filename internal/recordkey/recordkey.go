@@ -0,0 +1,117 @@
+// Package recordkey contains functions to build file paths and object keys
+// of recordings from user-provided names.
+package recordkey
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxNameLength = 128
+)
+
+// CheckName checks whether a user-provided name can be used to build
+// file paths and object keys.
+func CheckName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("name is not valid UTF-8")
+	}
+
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return fmt.Errorf("name is longer than %d characters", maxNameLength)
+	}
+
+	if strings.TrimSpace(name) == "" || strings.Trim(name, ".") == "" {
+		return fmt.Errorf("invalid name: '%s'", name)
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) || r == '/' || r == '\\' {
+			return fmt.Errorf("name contains an invalid character: %q", r)
+		}
+	}
+
+	return nil
+}
+
+// Sanitize converts a name into a string that can be safely used as a
+// path element or as part of an object key.
+// Letters and digits of any alphabet are kept, spaces are replaced
+// with dashes and other characters are replaced with underscores.
+func Sanitize(name string) string {
+	var b strings.Builder
+
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.':
+			b.WriteRune(r)
+
+		case unicode.IsSpace(r):
+			b.WriteRune('-')
+
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	ret := strings.TrimLeft(b.String(), ".")
+	if ret == "" {
+		return "_"
+	}
+
+	return ret
+}
+
+// BucketName derives a valid S3 bucket name from a name.
+func BucketName(name string) string {
+	var b strings.Builder
+	dash := true
+
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	ret := strings.TrimRight(b.String(), "-")
+
+	if len(ret) > 63 {
+		ret = strings.TrimRight(ret[:63], "-")
+	}
+
+	for len(ret) < 3 {
+		ret += "0"
+	}
+
+	return ret
+}
+
+// Dir returns the local directory of a room, by filling a template
+// that can contain the %club, %event and %room variables.
+func Dir(template string, club string, event string, roomID uuid.UUID) string {
+	return strings.NewReplacer(
+		"%club", Sanitize(club),
+		"%event", Sanitize(event),
+		"%room", roomID.String(),
+	).Replace(template)
+}
+
+// ObjectKey returns the key of an object of a room.
+// The room ID is part of the key in order to avoid collisions between rooms
+// with the same event name.
+func ObjectKey(event string, roomID uuid.UUID, fileName string) string {
+	return Sanitize(event) + "/" + roomID.String() + "/" + fileName
+}
@@ -0,0 +1,76 @@
+package recordkey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckName(t *testing.T) {
+	for _, name := range []string{
+		"my club",
+		"Café Ünïcode",
+		"event-2023.10",
+	} {
+		require.NoError(t, CheckName(name))
+	}
+
+	for _, ca := range []struct {
+		name string
+		err  string
+	}{
+		{"", "name is empty"},
+		{"   ", "invalid name: '   '"},
+		{"..", "invalid name: '..'"},
+		{"a/b", "name contains an invalid character: '/'"},
+		{"a\\b", "name contains an invalid character: '\\\\'"},
+		{"a\nb", "name contains an invalid character: '\\n'"},
+		{strings.Repeat("a", 129), "name is longer than 128 characters"},
+	} {
+		require.EqualError(t, CheckName(ca.name), ca.err)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for _, ca := range []struct {
+		in  string
+		out string
+	}{
+		{"My Club", "My-Club"},
+		{"  Café Ünïcode ", "Café-Ünïcode"},
+		{"a/b:c*d", "a_b_c_d"},
+		{"../etc", "_etc"},
+		{"...", "_"},
+	} {
+		require.Equal(t, ca.out, Sanitize(ca.in))
+	}
+}
+
+func TestBucketName(t *testing.T) {
+	for _, ca := range []struct {
+		in  string
+		out string
+	}{
+		{"My Club", "my-club"},
+		{"Café Ünïcode", "caf-n-code"},
+		{"a/b", "a-b"},
+		{"--x--", "x00"},
+		{strings.Repeat("ab ", 30), strings.Repeat("ab-", 20) + "ab"},
+	} {
+		require.Equal(t, ca.out, BucketName(ca.in))
+	}
+}
+
+func TestDirAndObjectKey(t *testing.T) {
+	roomID := uuid.MustParse("c7b2d7b0-3c30-4b6b-9b38-0e1b8d3a3f2a")
+
+	require.Equal(t,
+		"streams/My-Club/final_1/c7b2d7b0-3c30-4b6b-9b38-0e1b8d3a3f2a",
+		Dir("streams/%club/%event/%room", "My Club", "final/1", roomID))
+
+	require.Equal(t,
+		"final_1/c7b2d7b0-3c30-4b6b-9b38-0e1b8d3a3f2a/audio.ogg",
+		ObjectKey("final/1", roomID, "audio.ogg"))
+}
@@ -0,0 +1,196 @@
+// Package redis contains a minimal Redis client.
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is an error returned by the server.
+type Error string
+
+// Error implements the error interface.
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Client is a Redis client.
+// It uses a single connection, that is opened when needed
+// and reopened after an error.
+type Client struct {
+	address  string
+	password string
+	timeout  time.Duration
+
+	mutex sync.Mutex
+	nconn net.Conn
+	br    *bufio.Reader
+}
+
+// NewClient allocates a Client.
+func NewClient(address string, password string, timeout time.Duration) *Client {
+	return &Client{
+		address:  address,
+		password: password,
+		timeout:  timeout,
+	}
+}
+
+// Close closes the connection.
+func (c *Client) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closeConn()
+}
+
+func (c *Client) closeConn() {
+	if c.nconn != nil {
+		c.nconn.Close()
+		c.nconn = nil
+		c.br = nil
+	}
+}
+
+func (c *Client) connect() error {
+	nconn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return err
+	}
+
+	c.nconn = nconn
+	c.br = bufio.NewReader(nconn)
+
+	if c.password != "" {
+		_, err = c.do([]string{"AUTH", c.password})
+		if err != nil {
+			c.closeConn()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Do sends a command and returns the reply.
+// Replies can be of type string, int64, []interface{} or nil.
+// Errors returned by the server are of type Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.nconn == nil {
+		err := c.connect()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := c.do(args)
+	if err != nil {
+		if _, ok := err.(Error); !ok {
+			c.closeConn()
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) do(args []string) (interface{}, error) {
+	c.nconn.SetDeadline(time.Now().Add(c.timeout))
+
+	buf := []byte("*" + strconv.FormatInt(int64(len(args)), 10) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.FormatInt(int64(len(arg)), 10)+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+
+	_, err := c.nconn.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return readReply(c.br)
+}
+
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("invalid line")
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func readReply(br *bufio.Reader) (interface{}, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, Error(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		le, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if le < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, le+2)
+		_, err = io.ReadFull(br, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		return string(buf[:le]), nil
+
+	case '*':
+		le, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if le < 0 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, le)
+		for i := range items {
+			items[i], err = readReply(br)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return items, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected reply type '%c'", line[0])
+	}
+}
@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readCommand(t *testing.T, br *bufio.Reader) []interface{} {
+	cmd, err := readReply(br)
+	require.NoError(t, err)
+	return cmd.([]interface{})
+}
+
+func TestClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	serverDone := make(chan struct{})
+
+	go func() {
+		defer close(serverDone)
+
+		nconn, err := ln.Accept()
+		require.NoError(t, err)
+		defer nconn.Close()
+		br := bufio.NewReader(nconn)
+
+		require.Equal(t, []interface{}{"AUTH", "mypass"}, readCommand(t, br))
+		_, err = nconn.Write([]byte("+OK\r\n"))
+		require.NoError(t, err)
+
+		require.Equal(t, []interface{}{"SET", "mykey", "myvalue", "PX", "1000"}, readCommand(t, br))
+		_, err = nconn.Write([]byte("+OK\r\n"))
+		require.NoError(t, err)
+
+		require.Equal(t, []interface{}{"GET", "mykey"}, readCommand(t, br))
+		_, err = nconn.Write([]byte("$7\r\nmyvalue\r\n"))
+		require.NoError(t, err)
+
+		require.Equal(t, []interface{}{"GET", "otherkey"}, readCommand(t, br))
+		_, err = nconn.Write([]byte("$-1\r\n"))
+		require.NoError(t, err)
+
+		require.Equal(t, []interface{}{"HGETALL", "myhash"}, readCommand(t, br))
+		_, err = nconn.Write([]byte("*2\r\n$1\r\na\r\n$1\r\nb\r\n"))
+		require.NoError(t, err)
+
+		require.Equal(t, []interface{}{"DEL", "mykey"}, readCommand(t, br))
+		_, err = nconn.Write([]byte(":1\r\n"))
+		require.NoError(t, err)
+
+		require.Equal(t, []interface{}{"HSET", "mykey"}, readCommand(t, br))
+		_, err = nconn.Write([]byte("-ERR wrong number of arguments\r\n"))
+		require.NoError(t, err)
+	}()
+
+	c := NewClient(ln.Addr().String(), "mypass", 5*time.Second)
+	defer c.Close()
+
+	res, err := c.Do("SET", "mykey", "myvalue", "PX", "1000")
+	require.NoError(t, err)
+	require.Equal(t, "OK", res)
+
+	res, err = c.Do("GET", "mykey")
+	require.NoError(t, err)
+	require.Equal(t, "myvalue", res)
+
+	res, err = c.Do("GET", "otherkey")
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	res, err = c.Do("HGETALL", "myhash")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"a", "b"}, res)
+
+	res, err = c.Do("DEL", "mykey")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res)
+
+	_, err = c.Do("HSET", "mykey")
+	require.EqualError(t, err, "redis: ERR wrong number of arguments")
+
+	<-serverDone
+}
@@ -0,0 +1,159 @@
+// Package ulpfec contains a ULPFEC (RFC 5109) encoder, that allows receivers to
+// recover lost RTP packets without asking for retransmissions.
+package ulpfec
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// MaxGroupSize is the maximum number of media packets that can be protected by a FEC packet.
+	MaxGroupSize = 48
+
+	rtpHeaderSize     = 12
+	headerSize        = 10
+	levelHeaderSize   = 4
+	levelHeaderSizeL  = 8
+	shortMaskMaxCount = 16
+)
+
+// Encoder generates a FEC packet every GroupSize media packets.
+// Every FEC packet contains the XOR of the media packets of its group,
+// therefore a single lost packet per group can be recovered.
+type Encoder struct {
+	// number of media packets protected by each FEC packet.
+	// It must be between 1 and MaxGroupSize.
+	GroupSize int
+
+	count       int
+	snBase      uint16
+	bits        [2]byte
+	ts          [4]byte
+	length      uint16
+	payload     []byte
+	protLen     int
+	mask        uint64
+	lastTS      uint32
+	initialized bool
+}
+
+// Init initializes the encoder.
+func (e *Encoder) Init() error {
+	if e.GroupSize < 1 || e.GroupSize > MaxGroupSize {
+		return fmt.Errorf("group size must be between 1 and %d", MaxGroupSize)
+	}
+
+	e.initialized = true
+	return nil
+}
+
+func (e *Encoder) reset() {
+	e.count = 0
+	e.bits = [2]byte{}
+	e.ts = [4]byte{}
+	e.length = 0
+	e.payload = e.payload[:0]
+	e.protLen = 0
+	e.mask = 0
+}
+
+// Encode adds a media packet to the current group.
+// When the group is complete, it returns the payload of a FEC packet, otherwise it returns nil.
+// Media packets must be passed in order, with their final sequence number and payload type.
+func (e *Encoder) Encode(pkt *rtp.Packet) ([]byte, error) {
+	if !e.initialized {
+		return nil, fmt.Errorf("encoder not initialized")
+	}
+
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if e.count == 0 {
+		e.snBase = pkt.SequenceNumber
+	}
+
+	offset := pkt.SequenceNumber - e.snBase
+	if offset >= MaxGroupSize {
+		return nil, fmt.Errorf("sequence number is too far from the base of the group")
+	}
+
+	e.bits[0] ^= buf[0]
+	e.bits[1] ^= buf[1]
+	for i := 0; i < 4; i++ {
+		e.ts[i] ^= buf[4+i]
+	}
+
+	body := buf[rtpHeaderSize:]
+	e.length ^= uint16(len(body))
+
+	for len(e.payload) < len(body) {
+		e.payload = append(e.payload, 0)
+	}
+	for i, b := range body {
+		e.payload[i] ^= b
+	}
+
+	if len(body) > e.protLen {
+		e.protLen = len(body)
+	}
+
+	e.mask |= 1 << (MaxGroupSize - 1 - uint64(offset))
+	e.lastTS = pkt.Timestamp
+	e.count++
+
+	if e.count < e.GroupSize {
+		return nil, nil
+	}
+
+	fec := e.marshal()
+	e.reset()
+	return fec, nil
+}
+
+// Timestamp returns the timestamp that must be used by the last FEC packet,
+// that is the timestamp of the last protected media packet.
+func (e *Encoder) Timestamp() uint32 {
+	return e.lastTS
+}
+
+func (e *Encoder) marshal() []byte {
+	long := (e.mask & ((1 << (MaxGroupSize - shortMaskMaxCount)) - 1)) != 0
+
+	lhSize := levelHeaderSize
+	if long {
+		lhSize = levelHeaderSizeL
+	}
+
+	buf := make([]byte, headerSize+lhSize+e.protLen)
+
+	// E = 0, L, P, X, CC recovery
+	buf[0] = e.bits[0] & 0x3F
+	if long {
+		buf[0] |= 0x40
+	}
+
+	// M, PT recovery
+	buf[1] = e.bits[1]
+
+	binary.BigEndian.PutUint16(buf[2:], e.snBase)
+	copy(buf[4:], e.ts[:])
+	binary.BigEndian.PutUint16(buf[8:], e.length)
+
+	// level 0 header
+	binary.BigEndian.PutUint16(buf[10:], uint16(e.protLen))
+	if long {
+		binary.BigEndian.PutUint16(buf[12:], uint16(e.mask>>32))
+		binary.BigEndian.PutUint32(buf[14:], uint32(e.mask))
+	} else {
+		binary.BigEndian.PutUint16(buf[12:], uint16(e.mask>>32))
+	}
+
+	copy(buf[headerSize+lhSize:], e.payload[:e.protLen])
+
+	return buf
+}
@@ -0,0 +1,107 @@
+package ulpfec
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func testPackets(n int) []*rtp.Packet {
+	var ret []*rtp.Packet
+	for i := 0; i < n; i++ {
+		payload := make([]byte, 10+i*7)
+		for j := range payload {
+			payload[j] = byte(i*31 + j)
+		}
+
+		ret = append(ret, &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         i == n-1,
+				PayloadType:    96,
+				SequenceNumber: 65530 + uint16(i),
+				Timestamp:      123456 + uint32(i/3)*3000,
+				SSRC:           0x11223344,
+				CSRC:           []uint32{},
+			},
+			Payload: payload,
+		})
+	}
+	return ret
+}
+
+func TestEncoderRecover(t *testing.T) {
+	for _, ca := range []struct {
+		name      string
+		groupSize int
+	}{
+		{"single", 1},
+		{"short mask", 5},
+		{"long mask", 20},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			e := &Encoder{GroupSize: ca.groupSize}
+			err := e.Init()
+			require.NoError(t, err)
+
+			packets := testPackets(ca.groupSize)
+
+			var fec []byte
+			for i, pkt := range packets {
+				fec, err = e.Encode(pkt)
+				require.NoError(t, err)
+				if i != len(packets)-1 {
+					require.Nil(t, fec)
+				}
+			}
+			require.NotNil(t, fec)
+			require.Equal(t, packets[len(packets)-1].Timestamp, e.Timestamp())
+
+			for lost := range packets {
+				var received []*rtp.Packet
+				for i, pkt := range packets {
+					if i != lost {
+						received = append(received, pkt)
+					}
+				}
+
+				rec, err := Recover(fec, 0x11223344, received)
+				require.NoError(t, err)
+				require.Equal(t, packets[lost], rec)
+			}
+		})
+	}
+}
+
+func TestEncoderGroups(t *testing.T) {
+	e := &Encoder{GroupSize: 2}
+	err := e.Init()
+	require.NoError(t, err)
+
+	packets := testPackets(4)
+	var fecs [][]byte
+
+	for _, pkt := range packets {
+		fec, err := e.Encode(pkt)
+		require.NoError(t, err)
+		if fec != nil {
+			fecs = append(fecs, fec)
+		}
+	}
+
+	require.Equal(t, 2, len(fecs))
+
+	rec, err := Recover(fecs[1], 0x11223344, []*rtp.Packet{packets[3]})
+	require.NoError(t, err)
+	require.Equal(t, packets[2], rec)
+
+	_, err = Recover(fecs[1], 0x11223344, nil)
+	require.EqualError(t, err, "more than one packet is missing")
+}
+
+func TestEncoderInvalidGroupSize(t *testing.T) {
+	e := &Encoder{GroupSize: 49}
+	err := e.Init()
+	require.EqualError(t, err, "group size must be between 1 and 48")
+}
@@ -0,0 +1,118 @@
+package ulpfec
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pion/rtp"
+)
+
+// Recover rebuilds the media packet that is missing from a group,
+// given the payload of the FEC packet and the other media packets of the group.
+func Recover(fec []byte, ssrc uint32, packets []*rtp.Packet) (*rtp.Packet, error) {
+	if len(fec) < headerSize+levelHeaderSize {
+		return nil, fmt.Errorf("FEC packet is too short")
+	}
+
+	if (fec[0] & 0x80) != 0 {
+		return nil, fmt.Errorf("FEC header extension is not supported")
+	}
+
+	long := (fec[0] & 0x40) != 0
+
+	lhSize := levelHeaderSize
+	if long {
+		lhSize = levelHeaderSizeL
+	}
+
+	if len(fec) < headerSize+lhSize {
+		return nil, fmt.Errorf("FEC packet is too short")
+	}
+
+	snBase := binary.BigEndian.Uint16(fec[2:])
+	protLen := int(binary.BigEndian.Uint16(fec[10:]))
+
+	mask := uint64(binary.BigEndian.Uint16(fec[12:])) << 32
+	if long {
+		mask |= uint64(binary.BigEndian.Uint32(fec[14:]))
+	}
+
+	payload := fec[headerSize+lhSize:]
+	if len(payload) != protLen {
+		return nil, fmt.Errorf("invalid protection length")
+	}
+
+	received := make(map[uint16]*rtp.Packet)
+	for _, pkt := range packets {
+		received[pkt.SequenceNumber] = pkt
+	}
+
+	missing := -1
+
+	bits := [2]byte{fec[0] & 0x3F, fec[1]}
+	var ts [4]byte
+	copy(ts[:], fec[4:8])
+	length := binary.BigEndian.Uint16(fec[8:])
+	body := append([]byte(nil), payload...)
+
+	for i := 0; i < MaxGroupSize; i++ {
+		if (mask & (1 << (MaxGroupSize - 1 - uint64(i)))) == 0 {
+			continue
+		}
+
+		seq := snBase + uint16(i)
+		pkt, ok := received[seq]
+		if !ok {
+			if missing >= 0 {
+				return nil, fmt.Errorf("more than one packet is missing")
+			}
+			missing = int(seq)
+			continue
+		}
+
+		buf, err := pkt.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		bits[0] ^= buf[0]
+		bits[1] ^= buf[1]
+		for j := 0; j < 4; j++ {
+			ts[j] ^= buf[4+j]
+		}
+
+		pktBody := buf[rtpHeaderSize:]
+		if len(pktBody) > protLen {
+			return nil, fmt.Errorf("packet is longer than the protection length")
+		}
+
+		length ^= uint16(len(pktBody))
+		for j, b := range pktBody {
+			body[j] ^= b
+		}
+	}
+
+	if missing < 0 {
+		return nil, fmt.Errorf("no packet is missing")
+	}
+
+	if int(length) > protLen {
+		return nil, fmt.Errorf("invalid recovered length")
+	}
+
+	buf := make([]byte, rtpHeaderSize+int(length))
+	buf[0] = 0x80 | (bits[0] & 0x3F)
+	buf[1] = bits[1]
+	binary.BigEndian.PutUint16(buf[2:], uint16(missing))
+	copy(buf[4:], ts[:])
+	binary.BigEndian.PutUint32(buf[8:], ssrc)
+	copy(buf[rtpHeaderSize:], body[:length])
+
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkt, nil
+}
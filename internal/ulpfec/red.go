@@ -0,0 +1,52 @@
+package ulpfec
+
+import (
+	"fmt"
+)
+
+// EncodeRED wraps a payload into a RED (RFC 2198) payload with a single block.
+// In WebRTC, both media and FEC packets are sent in RED payloads,
+// and the payload type of the block tells them apart.
+func EncodeRED(blockPayloadType uint8, block []byte) []byte {
+	buf := make([]byte, 1+len(block))
+	buf[0] = blockPayloadType & 0x7F
+	copy(buf[1:], block)
+	return buf
+}
+
+// DecodeRED extracts the primary block of a RED payload.
+func DecodeRED(buf []byte) (uint8, []byte, error) {
+	n := 0
+
+	// skip redundant blocks
+	for {
+		if len(buf[n:]) < 1 {
+			return 0, nil, fmt.Errorf("RED payload is too short")
+		}
+
+		if (buf[n] & 0x80) == 0 {
+			break
+		}
+
+		if len(buf[n:]) < 4 {
+			return 0, nil, fmt.Errorf("RED payload is too short")
+		}
+
+		n += 4
+	}
+
+	pt := buf[n] & 0x7F
+	headerLen := n + 1
+	n = headerLen
+
+	// redundant blocks precede the primary one
+	for i := 0; i < headerLen-1; i += 4 {
+		n += int(buf[i+2]&0x03)<<8 | int(buf[i+3])
+	}
+
+	if n > len(buf) {
+		return 0, nil, fmt.Errorf("RED payload is too short")
+	}
+
+	return pt, buf[n:], nil
+}
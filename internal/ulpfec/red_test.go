@@ -0,0 +1,32 @@
+package ulpfec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRED(t *testing.T) {
+	buf := EncodeRED(96, []byte{1, 2, 3})
+	require.Equal(t, []byte{96, 1, 2, 3}, buf)
+
+	pt, block, err := DecodeRED(buf)
+	require.NoError(t, err)
+	require.Equal(t, uint8(96), pt)
+	require.Equal(t, []byte{1, 2, 3}, block)
+}
+
+func TestDecodeREDRedundant(t *testing.T) {
+	// a redundant block of 2 bytes, followed by the primary block
+	buf := []byte{
+		0x80 | 96, 0x00, 0x00, 0x02,
+		97,
+		5, 6,
+		1, 2, 3,
+	}
+
+	pt, block, err := DecodeRED(buf)
+	require.NoError(t, err)
+	require.Equal(t, uint8(97), pt)
+	require.Equal(t, []byte{1, 2, 3}, block)
+}
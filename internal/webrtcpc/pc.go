@@ -17,6 +17,7 @@ type PeerConnection struct {
 	*webrtc.PeerConnection
 	stateChangeMutex  sync.Mutex
 	newLocalCandidate chan *webrtc.ICECandidateInit
+	iceConnected      chan struct{}
 	connected         chan struct{}
 	disconnected      chan struct{}
 	closed            chan struct{}
@@ -26,10 +27,14 @@ type PeerConnection struct {
 // New allocates a PeerConnection.
 func New(
 	iceServers []webrtc.ICEServer,
+	certificates []webrtc.Certificate,
 	api *webrtc.API,
 	log logger.Writer,
 ) (*PeerConnection, error) {
-	configuration := webrtc.Configuration{ICEServers: iceServers}
+	configuration := webrtc.Configuration{
+		ICEServers:   iceServers,
+		Certificates: certificates,
+	}
 
 	pc, err := api.NewPeerConnection(configuration)
 	if err != nil {
@@ -39,6 +44,7 @@ func New(
 	co := &PeerConnection{
 		PeerConnection:    pc,
 		newLocalCandidate: make(chan *webrtc.ICECandidateInit),
+		iceConnected:      make(chan struct{}),
 		connected:         make(chan struct{}),
 		disconnected:      make(chan struct{}),
 		closed:            make(chan struct{}),
@@ -72,6 +78,16 @@ func New(
 		}
 	})
 
+	var iceConnectedOnce sync.Once
+
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			iceConnectedOnce.Do(func() {
+				close(co.iceConnected)
+			})
+		}
+	})
+
 	pc.OnICECandidate(func(i *webrtc.ICECandidate) {
 		if i != nil {
 			v := i.ToJSON()
@@ -94,6 +110,12 @@ func (co *PeerConnection) Close() {
 	<-co.closed
 }
 
+// ICEConnected returns when the ICE transport is connected,
+// that happens before the DTLS handshake.
+func (co *PeerConnection) ICEConnected() <-chan struct{} {
+	return co.iceConnected
+}
+
 // Connected returns when connected.
 func (co *PeerConnection) Connected() <-chan struct{} {
 	return co.connected
@@ -9,6 +9,7 @@ import (
 )
 
 // ICEFragmentUnmarshal decodes an ICE fragment.
+// The end-of-candidates attribute is decoded into a candidate with an empty value.
 func ICEFragmentUnmarshal(buf []byte) ([]*webrtc.ICECandidateInit, error) {
 	buf = append([]byte("v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\n"), buf...)
 
@@ -33,16 +34,27 @@ func ICEFragmentUnmarshal(buf []byte) ([]*webrtc.ICECandidateInit, error) {
 		midNum := uint16(tmp)
 
 		for _, attr := range media.Attributes {
-			if attr.Key == "candidate" {
+			switch attr.Key {
+			case "candidate":
 				ret = append(ret, &webrtc.ICECandidateInit{
 					Candidate:     attr.Value,
 					SDPMid:        &mid,
 					SDPMLineIndex: &midNum,
 				})
+
+			case "end-of-candidates":
+				ret = append(ret, &webrtc.ICECandidateInit{
+					SDPMid:        &mid,
+					SDPMLineIndex: &midNum,
+				})
 			}
 		}
 	}
 
+	if _, ok := sdp.Attribute("end-of-candidates"); ok {
+		ret = append(ret, &webrtc.ICECandidateInit{})
+	}
+
 	return ret, nil
 }
 
@@ -206,3 +206,26 @@ func TestICEFragmentMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestICEFragmentUnmarshalEndOfCandidates(t *testing.T) {
+	candidates, err := ICEFragmentUnmarshal([]byte("a=ice-ufrag:tUQMzoQAVLzlvBys\r\n" +
+		"a=ice-pwd:pimyGfJcjjRwvUjnmGOODSjtIxyDljQj\r\n" +
+		"a=end-of-candidates\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:0\r\n" +
+		"a=candidate:3628911098 1 udp 2130706431 192.168.3.218 49462 typ host\r\n" +
+		"a=end-of-candidates\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, []*webrtc.ICECandidateInit{
+		{
+			Candidate:     "3628911098 1 udp 2130706431 192.168.3.218 49462 typ host",
+			SDPMid:        stringPtr("0"),
+			SDPMLineIndex: uint16Ptr(0),
+		},
+		{
+			SDPMid:        stringPtr("0"),
+			SDPMLineIndex: uint16Ptr(0),
+		},
+		{},
+	}, candidates)
+}